@@ -0,0 +1,99 @@
+#!/usr/bin/env bash
+# usb-gadget.sh — present the board as a USB network adapter via configfs
+#
+# Creates a USB gadget with a single network function, binds it to the USB
+# device controller, assigns the board's address to the resulting interface
+# and serves DHCP on it, so a laptop plugged into the OTG port gets an address
+# and can reach the BoardingPass API. The gadget is removed on exit.
+#
+# Usage: usb-gadget.sh <function>
+#   function — USB network function: ncm, ecm or rndis
+#
+# Environment (from /run/boardingpass/usb-gadget.env):
+#   BOARDINGPASS_USB_UDC      — USB device controller (from /sys/class/udc)
+#   BOARDINGPASS_USB_ADDRESS  — board address on the link (e.g. 10.0.2.1)
+#   BOARDINGPASS_USB_NETMASK  — prefix length (e.g. 24)
+
+set -euo pipefail
+
+FUNCTION="${1:?Usage: usb-gadget.sh <ncm|ecm|rndis>}"
+UDC="${BOARDINGPASS_USB_UDC:?BOARDINGPASS_USB_UDC not set}"
+ADDRESS="${BOARDINGPASS_USB_ADDRESS:?BOARDINGPASS_USB_ADDRESS not set}"
+NETMASK="${BOARDINGPASS_USB_NETMASK:-24}"
+GADGET="/sys/kernel/config/usb_gadget/boardingpass"
+FUNC_DIR="${GADGET}/functions/${FUNCTION}.usb0"
+CONFIG_DIR="${GADGET}/configs/c.1"
+
+case "${FUNCTION}" in
+    ncm|ecm|rndis) ;;
+    *) echo "Unsupported USB function: ${FUNCTION}" >&2; exit 1 ;;
+esac
+
+cleanup() {
+    echo "Removing USB gadget..."
+    if [[ -n "${DNSMASQ_PID:-}" ]]; then
+        kill "${DNSMASQ_PID}" 2>/dev/null || true
+        wait "${DNSMASQ_PID}" 2>/dev/null || true
+    fi
+    if [[ -n "${IFNAME:-}" ]]; then
+        ip addr flush dev "${IFNAME}" 2>/dev/null || true
+    fi
+    [[ -d "${GADGET}" ]] || return 0
+    echo "" > "${GADGET}/UDC" 2>/dev/null || true
+    rm -f "${CONFIG_DIR}/${FUNCTION}.usb0" "${GADGET}/os_desc/c.1"
+    rmdir "${CONFIG_DIR}/strings/0x409" "${CONFIG_DIR}" 2>/dev/null || true
+    rmdir "${FUNC_DIR}" "${GADGET}/strings/0x409" "${GADGET}" 2>/dev/null || true
+}
+
+trap cleanup EXIT
+trap 'exit 0' TERM INT
+
+modprobe libcomposite
+
+# Remove leftovers from an unclean shutdown
+cleanup
+
+SERIAL="$(cat /etc/machine-id 2>/dev/null || hostname -s)"
+
+mkdir -p "${GADGET}"
+echo 0x1d6b > "${GADGET}/idVendor"   # Linux Foundation
+echo 0x0104 > "${GADGET}/idProduct"  # Multifunction Composite Gadget
+echo 0x0100 > "${GADGET}/bcdDevice"
+echo 0x0200 > "${GADGET}/bcdUSB"
+mkdir -p "${GADGET}/strings/0x409"
+echo "BoardingPass" > "${GADGET}/strings/0x409/manufacturer"
+echo "BoardingPass-$(hostname -s)" > "${GADGET}/strings/0x409/product"
+echo "${SERIAL}" > "${GADGET}/strings/0x409/serialnumber"
+
+mkdir -p "${CONFIG_DIR}/strings/0x409"
+echo "${FUNCTION}" > "${CONFIG_DIR}/strings/0x409/configuration"
+echo 250 > "${CONFIG_DIR}/MaxPower"
+
+mkdir -p "${FUNC_DIR}"
+if [[ "${FUNCTION}" == "rndis" ]]; then
+    # Microsoft OS descriptors make Windows load its RNDIS driver without an .inf
+    echo 1 > "${GADGET}/os_desc/use"
+    echo 0xcd > "${GADGET}/os_desc/b_vendor_code"
+    echo MSFT100 > "${GADGET}/os_desc/qw_sign"
+    echo RNDIS > "${FUNC_DIR}/os_desc/interface.rndis/compatible_id"
+    echo 5162001 > "${FUNC_DIR}/os_desc/interface.rndis/sub_compatible_id"
+    ln -s "${CONFIG_DIR}" "${GADGET}/os_desc/c.1"
+fi
+ln -s "${FUNC_DIR}" "${CONFIG_DIR}/${FUNCTION}.usb0"
+
+echo "${UDC}" > "${GADGET}/UDC"
+
+IFNAME="$(cat "${FUNC_DIR}/ifname")"
+echo "USB ${FUNCTION} gadget bound to ${UDC} as ${IFNAME}"
+
+nmcli device set "${IFNAME}" managed no 2>/dev/null || true
+ip link set "${IFNAME}" up
+ip addr add "${ADDRESS}/${NETMASK}" dev "${IFNAME}"
+
+# DHCP for the USB host; the interface name is only known once bound
+dnsmasq --keep-in-foreground --conf-file=/run/boardingpass/dnsmasq-usb-gadget.conf \
+    --interface="${IFNAME}" &
+DNSMASQ_PID=$!
+
+# Stay alive until stopped by systemd (SIGTERM) or dnsmasq exits
+wait "${DNSMASQ_PID}" || true
@@ -8,6 +8,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/fzdarsky/boardingpass/internal/cli/clicontext"
 	"github.com/fzdarsky/boardingpass/internal/cli/commands"
@@ -42,6 +43,8 @@ func main() {
 
 	// Route to command implementations
 	switch command {
+	case "discover":
+		commands.NewDiscoverCommand().Execute(args)
 	case "pass":
 		commands.NewPassCommand().Execute(args)
 	case "info":
@@ -52,8 +55,24 @@ func main() {
 		commands.NewLoadCommand().Execute(args)
 	case "command":
 		commands.NewCommandCommand().Execute(args)
+	case "diagnose":
+		commands.NewDiagnoseCommand().Execute(args)
+	case "audit":
+		commands.NewAuditCommand().Execute(args)
+	case "enroll":
+		commands.NewEnrollCommand().Execute(args)
 	case "complete":
 		commands.NewCompleteCommand().Execute(args)
+	case "shell":
+		commands.NewShellCommand().Execute(args)
+	case "context":
+		commands.NewContextCommand().Execute(args)
+	case "fleet":
+		commands.NewFleetCommand().Execute(args)
+	case "controller":
+		commands.NewControllerCommand().Execute(args)
+	case "relay":
+		commands.NewRelayCommand().Execute(args)
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown command '%s'\n\n", command)
 		printUsage()
@@ -68,11 +87,14 @@ func main() {
 //	boarding -y pass --host localhost        (before command)
 //	boarding pass -y --host localhost        (after command)
 //	boarding pass --host localhost -y        (at the end)
+//	boarding --serial /dev/ttyUSB0 info      (connect over a serial line)
+//	boarding --relay wss://relay/devices/SN1 info  (connect through a rendezvous server)
+//	boarding --context edge-01 info         (use a named context)
 func parseGlobalFlags(args []string) ([]string, string) {
 	remainingArgs := make([]string, 0, len(args))
 	var command string
 
-	for i := range len(args) {
+	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
 		// Check for global flags
@@ -80,6 +102,33 @@ func parseGlobalFlags(args []string) ([]string, string) {
 			clicontext.SetAssumeYes(true)
 			continue
 		}
+		if arg == "--serial" && i+1 < len(args) {
+			i++
+			clicontext.SetSerial(args[i])
+			continue
+		}
+		if device, ok := strings.CutPrefix(arg, "--serial="); ok {
+			clicontext.SetSerial(device)
+			continue
+		}
+		if arg == "--relay" && i+1 < len(args) {
+			i++
+			clicontext.SetRelay(args[i])
+			continue
+		}
+		if relayURL, ok := strings.CutPrefix(arg, "--relay="); ok {
+			clicontext.SetRelay(relayURL)
+			continue
+		}
+		if arg == "--context" && i+1 < len(args) {
+			i++
+			clicontext.SetContext(args[i])
+			continue
+		}
+		if name, ok := strings.CutPrefix(arg, "--context="); ok {
+			clicontext.SetContext(name)
+			continue
+		}
 
 		// First non-flag argument is the command
 		if command == "" && !isFlag(arg) {
@@ -106,19 +155,34 @@ Usage:
   boarding <command> [flags]
 
 Available Commands:
+  discover     Find BoardingPass services on the local network via mDNS
   pass         Authenticate with BoardingPass service
   info         Query system information (CPU, board, TPM, OS, FIPS)
   connections  Query network interface configuration
   load         Upload configuration directory to device
   command      Execute allow-listed command on device
+  diagnose     Check network connectivity of the device
+  enroll       Enroll the device with a management service
+  audit        Show the audit log of provisioning actions
   complete     Complete provisioning and terminate session
+  shell        Interactive session with a device (completion, history)
+  context      Manage named connection settings for devices
+  fleet        Provision many devices from an inventory in parallel
+  controller   Run a provisioning controller that devices report to
+  relay        Run a rendezvous server for devices behind NAT
   version      Show version information
 
 Global Flags:
   --help, -h        Show help information
   --assumeyes, -y   Automatically answer 'yes' to prompts (non-interactive mode)
+  --serial <device> Connect through a serial line (e.g. /dev/ttyUSB0) instead of the network
+  --relay <url>     Connect through a rendezvous server (wss://<relay>/devices/<device-id>)
+  --context <name>  Use a named context instead of the current one
 
 Examples:
+  # Find devices on the local network
+  boarding discover
+
   # Authenticate with BoardingPass service
   boarding pass --host 192.168.1.100 --username admin
 
@@ -128,6 +192,9 @@ Examples:
   # Query system information
   boarding info
 
+  # Authenticate over a serial console or USB OTG cable
+  boarding --serial /dev/ttyUSB0 pass --username admin
+
   # Query network interfaces
   boarding connections
 
@@ -137,9 +204,38 @@ Examples:
   # Execute command
   boarding command "systemctl restart networking"
 
+  # Check that the device can reach a management service
+  boarding diagnose --endpoint https://api.example.com --proxy
+
+  # Enroll with Flight Control and wait for approval
+  boarding enroll flightctl --server https://api.flightctl.example.com --token-file token --wait
+
+  # List the management services the device can enroll with
+  boarding enroll backends
+
+  # Show who did what on the device, and verify the record
+  boarding audit
+
   # Complete provisioning
   boarding complete
 
+  # Work with a device interactively
+  boarding shell
+
+  # Switch between devices with named contexts
+  boarding context add edge-01 --host 192.168.1.101 --username admin --use
+  boarding --context edge-02 info
+
+  # Provision all devices in an inventory file
+  boarding fleet --load ./edge-config --complete rack1.yaml
+
+  # Receive reports from devices with a configured callback
+  boarding controller serve
+
+  # Provision a device behind NAT through a rendezvous server
+  boarding relay
+  boarding --relay wss://relay.example.com:9457/devices/SN1234 pass --username admin
+
 For detailed help on a specific command, run:
   boarding <command> --help
 
@@ -97,6 +97,56 @@ func TestParseGlobalFlags(t *testing.T) {
 	}
 }
 
+func TestParseGlobalFlags_Serial(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           []string
+		expectedCommand string
+		expectedArgs    []string
+		expectedSerial  string
+	}{
+		{
+			name:            "serial before command",
+			input:           []string{"--serial", "/dev/ttyUSB0", "info"},
+			expectedCommand: "info",
+			expectedArgs:    []string{},
+			expectedSerial:  "/dev/ttyUSB0",
+		},
+		{
+			name:            "serial with equals after command",
+			input:           []string{"pass", "--serial=/dev/ttyACM0", "--username", "admin"},
+			expectedCommand: "pass",
+			expectedArgs:    []string{"--username", "admin"},
+			expectedSerial:  "/dev/ttyACM0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clicontext.SetSerial("")
+			t.Cleanup(func() { clicontext.SetSerial("") })
+
+			args, command := parseGlobalFlags(tt.input)
+
+			if command != tt.expectedCommand {
+				t.Errorf("parseGlobalFlags() command = %v, want %v", command, tt.expectedCommand)
+			}
+			if len(args) != len(tt.expectedArgs) {
+				t.Errorf("parseGlobalFlags() args = %v, want %v", args, tt.expectedArgs)
+			} else {
+				for i, arg := range args {
+					if arg != tt.expectedArgs[i] {
+						t.Errorf("parseGlobalFlags() args[%d] = %v, want %v", i, arg, tt.expectedArgs[i])
+					}
+				}
+			}
+			if clicontext.Serial() != tt.expectedSerial {
+				t.Errorf("parseGlobalFlags() Serial = %v, want %v", clicontext.Serial(), tt.expectedSerial)
+			}
+		})
+	}
+}
+
 func TestIsFlag(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/config"
+)
+
+// runAudit prints the audit log and verifies its hash chain. It reads the
+// file directly, so it also works after the service has gone inert.
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	configPath := fs.String("config", "/etc/boardingpass/config.yaml", "path to configuration file")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boardingpass audit [flags]
+
+Print the records of the audit log as JSON lines and verify their hash
+chain. Exits non-zero if the chain is broken.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	records, err := audit.ReadFile(cfg.Service.AuditLog)
+	encoder := json.NewEncoder(os.Stdout)
+	for i := range records {
+		if encErr := encoder.Encode(&records[i]); encErr != nil {
+			return encErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := audit.Verify(records); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d records, hash chain verified\n", len(records))
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/controller"
+	"github.com/fzdarsky/boardingpass/internal/inventory"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/network"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/fzdarsky/boardingpass/pkg/version"
+)
+
+// Backoff between attempts to reach the controller, reset when addresses change.
+const (
+	callbackRetryMin = 5 * time.Second
+	callbackRetryMax = 5 * time.Minute
+)
+
+// newReporter creates the reporter for the configured controller, trusting
+// the configured CA or, without one, the system roots.
+func newReporter(cfg *config.Config) (*controller.Reporter, error) {
+	var rootCAs *x509.CertPool
+	if cfg.Service.Callback.CACert != "" {
+		pem, err := os.ReadFile(cfg.Service.Callback.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read controller CA: %w", err)
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.Service.Callback.CACert)
+		}
+	}
+	return controller.NewReporter(cfg.Service.Callback.URL, rootCAs), nil
+}
+
+// followCallback reports to the controller on start and once addresses have
+// settled after a change, retrying with backoff until the controller
+// accepts the report.
+func followCallback(ctx context.Context, watcher *network.Watcher, reporter *controller.Reporter,
+	cfg *config.Config, logger *logging.Logger) {
+	changes, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	backoff := callbackRetryMin
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			backoff = callbackRetryMin
+			retry.Reset(addressSettleDelay)
+			continue
+		case <-retry.C:
+		}
+
+		announcement := deviceAnnouncement(cfg)
+		if err := reporter.Report(ctx, announcement); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("failed to report to controller", map[string]any{
+				"url":      cfg.Service.Callback.URL,
+				"error":    err.Error(),
+				"retry_in": backoff.String(),
+			})
+			retry.Reset(backoff)
+			backoff = min(2*backoff, callbackRetryMax)
+			continue
+		}
+
+		retry.Stop()
+		backoff = callbackRetryMin
+		logger.Info("reported to controller", map[string]any{
+			"url":       cfg.Service.Callback.URL,
+			"addresses": announcement.Addresses,
+		})
+	}
+}
+
+// deviceAnnouncement describes the device and how to reach it.
+func deviceAnnouncement(cfg *config.Config) *protocol.DeviceAnnouncement {
+	info := inventory.GetSystemInfo()
+	announcement := &protocol.DeviceAnnouncement{
+		ID:        deviceID(),
+		Version:   version.Get().String(),
+		System:    info,
+		Addresses: []string{},
+		Port:      cfg.Service.Port,
+	}
+
+	if interfaces, err := network.GetInterfaces(); err == nil {
+		announcement.Interfaces = interfaces
+	}
+	if fp, err := tlspkg.CertificateFingerprint(cfg.Service.TLSCert); err == nil {
+		announcement.Fingerprint = fp
+	}
+	for _, ip := range routedAddresses(cfg) {
+		announcement.Addresses = append(announcement.Addresses, ip.String())
+	}
+	return announcement
+}
+
+// deviceID identifies the device to the controller and the rendezvous
+// server: its serial number or, without one, its first hardware address.
+func deviceID() string {
+	if info, err := inventory.GetProductInfo(); err == nil && info.Serial != "" && info.Serial != "Unknown" {
+		return info.Serial
+	}
+	return firstHardwareAddr().String()
+}
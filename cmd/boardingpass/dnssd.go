@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/mdns"
+	"github.com/fzdarsky/boardingpass/internal/network"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+)
+
+// dnssdUpdateTimeout bounds each registration attempt, so an unreachable DNS
+// server delays neither address tracking nor shutdown for long.
+const dnssdUpdateTimeout = 10 * time.Second
+
+// Backoff between registration attempts, reset when addresses change.
+const (
+	dnssdRetryMin = 5 * time.Second
+	dnssdRetryMax = 5 * time.Minute
+)
+
+// newRegistrar creates the wide-area DNS-SD registrar, reading the TSIG
+// secret if updates are signed.
+func newRegistrar(cfg *config.Config, logger *logging.Logger) (*mdns.Registrar, error) {
+	settings := cfg.Service.DNSSD
+	ttl, err := settings.GetTTL()
+	if err != nil {
+		return nil, err
+	}
+
+	var key *mdns.TSIGKey
+	if settings.TSIG.KeyName != "" {
+		data, err := os.ReadFile(settings.TSIG.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TSIG secret: %w", err)
+		}
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode TSIG secret: %w", err)
+		}
+		key = &mdns.TSIGKey{
+			Name:      settings.TSIG.KeyName,
+			Algorithm: settings.TSIG.Algorithm,
+			Secret:    secret,
+		}
+	}
+
+	registrar := mdns.NewRegistrar(settings.Server, mdns.ServiceRecord{
+		Instance: mdnsInstanceName(cfg),
+		Service:  "_boardingpass._tcp",
+		Domain:   settings.Zone,
+		Port:     cfg.Service.Port,
+		TXT:      mdnsTXT(cfg),
+		Addrs:    routedAddresses(cfg),
+	}, key, ttl, logger)
+	registrar.SetConflictSuffix(mdnsConflictSuffix(cfg))
+	return registrar, nil
+}
+
+// followWideArea registers the service records and updates them once
+// addresses have settled after a change, retrying with backoff until the
+// DNS server accepts the update.
+func followWideArea(ctx context.Context, watcher *network.Watcher, registrar *mdns.Registrar,
+	cfg *config.Config, logger *logging.Logger) {
+	changes, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	backoff := dnssdRetryMin
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			backoff = dnssdRetryMin
+			retry.Reset(addressSettleDelay)
+			continue
+		case <-retry.C:
+		}
+
+		if err := syncWideArea(ctx, registrar, cfg); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("DNS-SD registration failed", map[string]any{
+				"server":   cfg.Service.DNSSD.Server,
+				"error":    err.Error(),
+				"retry_in": backoff.String(),
+			})
+			retry.Reset(backoff)
+			backoff = min(2*backoff, dnssdRetryMax)
+			continue
+		}
+		backoff = dnssdRetryMin
+	}
+}
+
+// syncWideArea registers the service records with the current addresses and
+// certificate fingerprint, or updates them if they changed.
+func syncWideArea(ctx context.Context, registrar *mdns.Registrar, cfg *config.Config) error {
+	ctx, cancel := context.WithTimeout(ctx, dnssdUpdateTimeout)
+	defer cancel()
+
+	if fp, err := tlspkg.CertificateFingerprint(cfg.Service.TLSCert); err == nil {
+		if err := registrar.SetTXT(ctx, mdns.TXTFingerprint, fp); err != nil {
+			return err
+		}
+	}
+	return registrar.SetAddresses(ctx, routedAddresses(cfg))
+}
+
+// deregisterWideArea removes the service records from the zone on shutdown,
+// including after provisioning completes.
+func deregisterWideArea(registrar *mdns.Registrar, logger *logging.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnssdUpdateTimeout)
+	defer cancel()
+	if err := registrar.Deregister(ctx); err != nil {
+		logger.Warn("failed to remove DNS-SD records", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
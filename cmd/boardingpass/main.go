@@ -9,17 +9,31 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/fzdarsky/boardingpass/internal/api"
 	"github.com/fzdarsky/boardingpass/internal/api/handlers"
 	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
 	"github.com/fzdarsky/boardingpass/internal/auth"
+	"github.com/fzdarsky/boardingpass/internal/command"
 	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/controller"
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/internal/diagnostics"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
+	"github.com/fzdarsky/boardingpass/internal/inventory"
 	"github.com/fzdarsky/boardingpass/internal/lifecycle"
 	"github.com/fzdarsky/boardingpass/internal/logging"
 	"github.com/fzdarsky/boardingpass/internal/mdns"
+	"github.com/fzdarsky/boardingpass/internal/network"
+	"github.com/fzdarsky/boardingpass/internal/system"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
 	"github.com/fzdarsky/boardingpass/internal/transport"
 	"github.com/fzdarsky/boardingpass/pkg/version"
 )
@@ -44,6 +58,20 @@ func main() {
 		}
 		return
 
+	case "audit":
+		if err := runAudit(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Audit log check failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+
+	case "qr":
+		if err := runQR(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "QR code generation failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+
 	default:
 		// Default: run the service
 		// Parse command-line flags for service mode
@@ -136,6 +164,14 @@ func run(configPath, verifierPath string) error {
 	// Create auth handler
 	authHandler := handlers.NewAuthHandler(verifierCfg, sessionManager, rateLimiter, srpStore, stdLogger)
 
+	// Open the audit log, which outlives the service as the record of how
+	// the device was provisioned
+	auditLog, err := audit.Open(cfg.Service.AuditLog, logger)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	authHandler.SetAuditLog(auditLog)
+
 	// Create shutdown manager for graceful termination
 	shutdownManager := lifecycle.NewShutdownManager()
 
@@ -193,14 +229,33 @@ func run(configPath, verifierPath string) error {
 	networkHandler := handlers.NewNetworkHandler()
 	mux.Handle("/network", activityMiddleware(authMiddleware.Require(networkHandler)))
 
-	// Complete endpoint (requires authentication)
+	// Create wide-area DNS-SD registrar for networks mDNS does not reach
+	var registrar *mdns.Registrar
+	if cfg.Service.DNSSD.Enabled {
+		registrar, err = newRegistrar(cfg, logger)
+		if err != nil {
+			return fmt.Errorf("failed to set up DNS-SD registration: %w", err)
+		}
+	}
+
+	// Complete endpoint (requires authentication). Shutdown removes the
+	// DNS-SD records; a reboot does not wait for it, so remove them first.
+	reboot := lifecycle.SystemReboot
+	if registrar != nil {
+		reboot = func() {
+			deregisterWideArea(registrar, logger)
+			lifecycle.SystemReboot()
+		}
+	}
 	completeHandler := handlers.NewCompleteHandler(cfg.Service.SentinelFile, func(reason string) {
 		shutdownManager.Shutdown(reason)
-	}, lifecycle.SystemReboot, logger)
+	}, reboot, logger)
+	completeHandler.SetAuditLog(auditLog)
 	mux.Handle("/complete", activityMiddleware(authMiddleware.Require(completeHandler)))
 
 	// Configure endpoint (requires authentication)
 	configureHandler := handlers.NewConfigureHandler(cfg, logger)
+	configureHandler.SetAuditLog(auditLog)
 	mux.Handle("/configure", activityMiddleware(authMiddleware.Require(configureHandler)))
 
 	// Command endpoint (requires authentication)
@@ -208,7 +263,72 @@ func run(configPath, verifierPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create command handler: %w", err)
 	}
+	commandHandler.SetAuditLog(auditLog)
 	mux.Handle("/command", activityMiddleware(authMiddleware.Require(commandHandler)))
+	mux.Handle("/commands", activityMiddleware(authMiddleware.Require(http.HandlerFunc(commandHandler.ServeList))))
+
+	// Typed system settings endpoints (require authentication). They talk to
+	// system services over D-Bus; without a system bus they report an error.
+	var systemManager *system.Manager
+	if bus, err := dbus.SystemBus(); err != nil {
+		logger.Warn("system bus unavailable, system settings endpoints disabled", map[string]any{
+			"error": err.Error(),
+		})
+	} else {
+		defer func() { _ = bus.Close() }()
+		systemManager = system.NewManager(bus, "")
+	}
+	systemHandler := handlers.NewSystemHandler(systemManager, logger)
+	systemHandler.SetAuditLog(auditLog)
+	mux.Handle("/system/hostname", activityMiddleware(authMiddleware.Require(http.HandlerFunc(systemHandler.ServeHostname))))
+	mux.Handle("/system/time", activityMiddleware(authMiddleware.Require(http.HandlerFunc(systemHandler.ServeTime))))
+	mux.Handle("/system/proxy", activityMiddleware(authMiddleware.Require(http.HandlerFunc(systemHandler.ServeProxy))))
+	mux.Handle("/network/interfaces/{name}", activityMiddleware(authMiddleware.Require(http.HandlerFunc(systemHandler.ServeInterface))))
+
+	// WiFi client endpoints (require authentication). The client shares the
+	// radio with the WiFi AP transport, which is created here for that.
+	var wifiAP *transport.WiFiHandler
+	var accessPoint handlers.AccessPoint
+	if cfg.Transports.WiFi.Enabled {
+		wifiAP = transport.NewWiFiHandler(cfg.Transports.WiFi, logger)
+		accessPoint = wifiAP
+	}
+	var wifiClient handlers.WiFiClient
+	if systemManager != nil {
+		wifiClient = systemManager
+		if wifiAP != nil {
+			wifiAP.SetScanner(systemManager.ScanWiFi)
+		}
+	}
+	wifiHandler := handlers.NewWiFiHandler(wifiClient, accessPoint, logger)
+	wifiHandler.SetAuditLog(auditLog)
+	mux.Handle("/network/wifi/scan", activityMiddleware(authMiddleware.Require(http.HandlerFunc(wifiHandler.ServeScan))))
+	mux.Handle("/network/wifi/connect", activityMiddleware(authMiddleware.Require(http.HandlerFunc(wifiHandler.ServeConnect))))
+
+	// Connectivity diagnostics endpoint (requires authentication)
+	diagnosticsHandler := handlers.NewDiagnosticsHandler(diagnostics.NewRunner(""), logger)
+	mux.Handle("/diagnostics/connectivity", activityMiddleware(authMiddleware.Require(http.HandlerFunc(diagnosticsHandler.ServeConnectivity))))
+
+	// Enrollment endpoints (require authentication)
+	flightControl := enrollment.NewFlightControl(cfg.Enrollment.FlightControl, cfg.Paths, logger)
+	if systemManager != nil {
+		flightControl.SetRestartFunc(systemManager.RestartUnit)
+	}
+	enrollmentBackends, err := newEnrollmentBackends(cfg, flightControl, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create enrollment backends: %w", err)
+	}
+	completeHandler.SetEnrollments(enrollmentBackends)
+	inactivityTracker.SetBusyFunc(enrollmentBackends.InProgress)
+	enrollmentHandler := handlers.NewEnrollmentHandler(enrollmentBackends, logger)
+	enrollmentHandler.SetAuditLog(auditLog)
+	mux.Handle("/enrollment", activityMiddleware(authMiddleware.Require(http.HandlerFunc(enrollmentHandler.ServeStatus))))
+	mux.Handle("/enrollment/backends", activityMiddleware(authMiddleware.Require(http.HandlerFunc(enrollmentHandler.ServeBackends))))
+	mux.Handle("/enrollment/{backend}", activityMiddleware(authMiddleware.Require(http.HandlerFunc(enrollmentHandler.ServeBackend))))
+	mux.Handle("/enrollment/{backend}/validate", activityMiddleware(authMiddleware.Require(http.HandlerFunc(enrollmentHandler.ServeValidate))))
+
+	// Audit endpoint (requires authentication)
+	mux.Handle("/audit", activityMiddleware(authMiddleware.Require(handlers.NewAuditHandler(auditLog, logger))))
 
 	// Register captive portal routes (suppresses iOS/Android captive portal popups)
 	api.RegisterCaptivePortalRoutes(mux)
@@ -221,43 +341,106 @@ func run(configPath, verifierPath string) error {
 			Service:  "_boardingpass._tcp",
 			Domain:   "local",
 			Port:     cfg.Service.Port,
-			TXT:      map[string]string{"version": version.Get().String()},
+			TXT:      mdnsTXT(cfg),
 			Addrs:    collectTransportAddresses(cfg),
 		}, logger)
+		announcer.SetConflictSuffix(mdnsConflictSuffix(cfg))
+	}
+
+	// Create reporter for phoning home to a provisioning controller
+	var reporter *controller.Reporter
+	if cfg.Service.Callback.URL != "" {
+		reporter, err = newReporter(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to set up controller callback: %w", err)
+		}
+	}
+
+	// Publish the provisioning state once a configuration bundle was applied
+	stateAnnouncer := announcer // unaffected by clearing announcer if it fails to start
+	configureHandler.SetAppliedCallback(func() {
+		if stateAnnouncer != nil {
+			stateAnnouncer.SetTXT(mdns.TXTState, mdns.StateConfigured)
+		}
+		if registrar != nil {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), dnssdUpdateTimeout)
+				defer cancel()
+				if err := registrar.SetTXT(ctx, mdns.TXTState, mdns.StateConfigured); err != nil {
+					logger.Warn("failed to update DNS-SD TXT record", map[string]any{
+						"error": err.Error(),
+					})
+				}
+			}()
+		}
+	})
+
+	// Watch for link and address changes, shared by the components below
+	netWatcher := network.NewWatcher(logger)
+
+	// Listener callbacks for transports that bind addresses at runtime;
+	// they keep the mDNS announcement in sync with the listeners
+	addListener := server.AddListener
+	removeListener := server.RemoveListener
+	if announcer != nil {
+		addListener = func(address string, port int) error {
+			if err := server.AddListener(address, port); err != nil {
+				return err
+			}
+			announcer.AddAddress(hostIP(address))
+			return nil
+		}
+		removeListener = func(address string) error {
+			if err := server.RemoveListener(address); err != nil {
+				return err
+			}
+			if host, _, err := net.SplitHostPort(address); err == nil {
+				announcer.RemoveAddress(hostIP(host))
+			}
+			return nil
+		}
 	}
 
 	// Create and configure transport manager
 	transportMgr := transport.NewManager(cfg, logger)
 
-	if cfg.Transports.WiFi.Enabled {
-		transportMgr.Register(transport.NewWiFiHandler(cfg.Transports.WiFi, logger))
+	if cfg.Transports.Ethernet.Enabled && len(cfg.Transports.Ethernet.Interfaces) > 0 {
+		ethernetHandler := transport.NewEthernetHandler(cfg.Transports.Ethernet, cfg.Service.Port, logger)
+		ethernetHandler.SetWatcher(netWatcher)
+		ethernetHandler.SetListenerCallbacks(addListener, removeListener)
+		transportMgr.Register(ethernetHandler)
+	}
+
+	if wifiAP != nil {
+		transportMgr.Register(wifiAP)
 	}
 	if cfg.Transports.Bluetooth.Enabled {
 		transportMgr.Register(transport.NewBluetoothHandler(cfg.Transports.Bluetooth, cfg.Service.Port, logger))
 	}
+	if cfg.Transports.BLE.Enabled {
+		transportMgr.Register(transport.NewBLEHandler(cfg.Transports.BLE, cfg.Service.Port,
+			cfg.Service.TLSCert, middleware.Transport(string(transport.TypeBLE), server.Handler()), logger))
+	}
 	if cfg.Transports.USB.Enabled {
 		usbHandler := transport.NewUSBHandler(cfg.Transports.USB, cfg.Service.Port, logger)
-		addListener := server.AddListener
-		removeListener := server.RemoveListener
-		if announcer != nil {
-			addListener = func(address string, port int) error {
-				if err := server.AddListener(address, port); err != nil {
-					return err
-				}
-				announcer.AddAddress(net.ParseIP(address))
-				return nil
-			}
-			removeListener = func(address string) error {
-				if err := server.RemoveListener(address); err != nil {
-					return err
-				}
-				announcer.RemoveAddress(net.ParseIP(address))
-				return nil
-			}
-		}
+		usbHandler.SetWatcher(netWatcher)
 		usbHandler.SetListenerCallbacks(addListener, removeListener)
 		transportMgr.Register(usbHandler)
 	}
+	if cfg.Transports.Serial.Enabled {
+		serialHandler := transport.NewSerialHandler(cfg.Transports.Serial, logger)
+		serialHandler.SetListenerCallbacks(server.ServeListener, server.RemoveListener)
+		transportMgr.Register(serialHandler)
+	}
+	if cfg.Transports.Relay.Enabled {
+		relayID := cfg.Transports.Relay.DeviceID
+		if relayID == "" {
+			relayID = deviceID()
+		}
+		relayHandler := transport.NewRelayHandler(cfg.Transports.Relay, relayID, logger)
+		relayHandler.SetListenerCallbacks(server.ServeListener, server.RemoveListener)
+		transportMgr.Register(relayHandler)
+	}
 
 	// Set up signal handling for graceful shutdown
 	ctx := context.Background()
@@ -268,6 +451,18 @@ func run(configPath, verifierPath string) error {
 	// Start inactivity tracker
 	go inactivityTracker.Start(shutdownCtx)
 
+	// Start the network watcher before transports, so none misses a change
+	if err := netWatcher.Start(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to start network watcher: %w", err)
+	}
+	go followAddressChanges(shutdownCtx, netWatcher, server, announcer, cfg)
+	if registrar != nil {
+		go followWideArea(shutdownCtx, netWatcher, registrar, cfg, logger)
+	}
+	if reporter != nil {
+		go followCallback(shutdownCtx, netWatcher, reporter, cfg, logger)
+	}
+
 	// Start transient transports (non-fatal — failures are logged, not blocking)
 	if err := transportMgr.StartAll(shutdownCtx); err != nil {
 		logger.Warn("transport manager startup had errors", map[string]any{
@@ -320,6 +515,11 @@ func run(configPath, verifierPath string) error {
 		announcer.Stop()
 	}
 
+	// Remove wide-area DNS-SD records
+	if registrar != nil {
+		deregisterWideArea(registrar, logger)
+	}
+
 	// Stop captive portal server
 	if captivePortal != nil {
 		captivePortal.Stop()
@@ -332,6 +532,8 @@ func run(configPath, verifierPath string) error {
 		})
 	}
 
+	netWatcher.Stop()
+
 	// Clean up
 	shutdownManager.Stop()
 	inactivityTracker.Stop()
@@ -339,6 +541,71 @@ func run(configPath, verifierPath string) error {
 	return nil
 }
 
+// addressSettleDelay is how long to wait after the last address change
+// before telling remote peers about it, so a burst of changes (DHCP, SLAAC)
+// results in a single update, and followAddressChanges has regenerated the
+// certificate for the new addresses.
+const addressSettleDelay = 2 * time.Second
+
+// followAddressChanges updates the server and, when no static addresses are
+// configured, the mDNS announcer whenever network addresses change.
+func followAddressChanges(ctx context.Context, watcher *network.Watcher, server *api.Server,
+	announcer *mdns.Announcer, cfg *config.Config) {
+	changes, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+
+	// With named Ethernet interfaces, the listener callbacks maintain the addresses
+	dynamicMDNS := announcer != nil && len(staticTransportAddresses(cfg)) == 0 &&
+		len(cfg.Transports.Ethernet.Interfaces) == 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+		}
+
+		server.Refresh()
+		if announcer != nil {
+			// The certificate is regenerated when its addresses change
+			if fp, err := tlspkg.CertificateFingerprint(cfg.Service.TLSCert); err == nil {
+				announcer.SetTXT(mdns.TXTFingerprint, fp)
+			}
+		}
+		switch {
+		case dynamicMDNS:
+			announcer.SetAddresses(discoverInterfaceAddresses())
+		case announcer != nil:
+			// Announce on links that came up with a configured address
+			announcer.Refresh()
+		}
+	}
+}
+
+// newEnrollmentBackends registers Flight Control and the configured command
+// backends.
+func newEnrollmentBackends(cfg *config.Config, flightControl *enrollment.FlightControl,
+	logger *logging.Logger) (*enrollment.Registry, error) {
+	registry := enrollment.NewRegistry()
+	if err := registry.Register(flightControl); err != nil {
+		return nil, err
+	}
+	if len(cfg.Enrollment.Backends) == 0 {
+		return registry, nil
+	}
+
+	executor, err := command.NewExecutorFor(cfg.Commands)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create command executor: %w", err)
+	}
+	for _, settings := range cfg.Enrollment.Backends {
+		cmd, _ := cfg.GetCommandByID(settings.Command)
+		if err := registry.Register(enrollment.NewCommandBackend(settings, cmd, executor, logger)); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
 // notifySystemd sends a notification to systemd if NOTIFY_SOCKET is set.
 // This enables systemd Type=notify service management.
 func notifySystemd(state string) {
@@ -401,8 +668,118 @@ func mdnsInstanceName(cfg *config.Config) string {
 	return "BoardingPass-" + hostname
 }
 
+// mdnsConflictSuffix returns the suffix that tells devices sharing an mDNS
+// instance name apart: the device serial number or, without one, the last
+// three bytes of the first hardware address. With rename set to "number",
+// conflicts are resolved with a counter instead.
+func mdnsConflictSuffix(cfg *config.Config) string {
+	if cfg.Service.MDNS.Rename == config.MDNSRenameNumber {
+		return ""
+	}
+
+	if info, err := inventory.GetProductInfo(); err == nil && info.Serial != "Unknown" {
+		// Host names only allow letters, digits and hyphens
+		serial := strings.Map(func(r rune) rune {
+			if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return r
+			}
+			return -1
+		}, info.Serial)
+		if len(serial) > 16 {
+			serial = serial[len(serial)-16:]
+		}
+		if serial != "" {
+			return serial
+		}
+	}
+
+	if hw := firstHardwareAddr(); len(hw) >= 3 {
+		return fmt.Sprintf("%02x%02x%02x", hw[len(hw)-3], hw[len(hw)-2], hw[len(hw)-1])
+	}
+	return ""
+}
+
+// firstHardwareAddr returns the hardware address of the first non-loopback
+// interface that has one.
+func firstHardwareAddr() net.HardwareAddr {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) < 3 {
+			continue
+		}
+		return iface.HardwareAddr
+	}
+	return nil
+}
+
+// mdnsTXT returns the TXT record metadata: the service version, the device
+// serial and model, the certificate fingerprint to verify on first connect,
+// the enabled transports, and the provisioning state.
+func mdnsTXT(cfg *config.Config) map[string]string {
+	txt := map[string]string{
+		mdns.TXTVersion: version.Get().String(),
+		mdns.TXTState:   mdns.StateUnprovisioned,
+	}
+
+	if info, err := inventory.GetProductInfo(); err == nil {
+		if info.Serial != "" && info.Serial != "Unknown" {
+			txt[mdns.TXTSerial] = info.Serial
+		}
+		var model []string
+		for _, part := range []string{info.Vendor, info.Name} {
+			if part != "" && part != "Unknown" {
+				model = append(model, part)
+			}
+		}
+		if len(model) > 0 {
+			txt[mdns.TXTModel] = strings.Join(model, " ")
+		}
+	}
+
+	if fp, err := tlspkg.CertificateFingerprint(cfg.Service.TLSCert); err == nil {
+		txt[mdns.TXTFingerprint] = fp
+	}
+
+	var transports []string
+	for _, t := range []struct {
+		typ     transport.Type
+		enabled bool
+	}{
+		{transport.TypeEthernet, cfg.Transports.Ethernet.Enabled},
+		{transport.TypeWiFi, cfg.Transports.WiFi.Enabled},
+		{transport.TypeBluetooth, cfg.Transports.Bluetooth.Enabled},
+		{transport.TypeBLE, cfg.Transports.BLE.Enabled},
+		{transport.TypeUSB, cfg.Transports.USB.Enabled},
+		{transport.TypeSerial, cfg.Transports.Serial.Enabled},
+		{transport.TypeRelay, cfg.Transports.Relay.Enabled},
+	} {
+		if t.enabled {
+			transports = append(transports, string(t.typ))
+		}
+	}
+	if len(transports) > 0 {
+		txt[mdns.TXTTransports] = strings.Join(transports, ",")
+	}
+
+	return txt
+}
+
 // collectTransportAddresses gathers static IP addresses from all enabled transports.
 func collectTransportAddresses(cfg *config.Config) []net.IP {
+	addrs := staticTransportAddresses(cfg)
+	// If no static addresses configured, use all non-loopback interface addresses,
+	// unless listeners are bound to named Ethernet interfaces as they appear
+	if len(addrs) == 0 && len(cfg.Transports.Ethernet.Interfaces) == 0 {
+		addrs = discoverInterfaceAddresses()
+	}
+	return addrs
+}
+
+// staticTransportAddresses returns the IP addresses configured for enabled transports.
+func staticTransportAddresses(cfg *config.Config) []net.IP {
 	var addrs []net.IP
 	if cfg.Transports.Ethernet.Address != "" {
 		if ip := net.ParseIP(cfg.Transports.Ethernet.Address); ip != nil {
@@ -419,13 +796,23 @@ func collectTransportAddresses(cfg *config.Config) []net.IP {
 			addrs = append(addrs, ip)
 		}
 	}
-	// If no static addresses configured, use all non-loopback interface addresses
-	if len(addrs) == 0 {
-		addrs = discoverInterfaceAddresses()
-	}
 	return addrs
 }
 
+// routedAddresses returns the addresses a remote client or controller can
+// reach across routed networks. Only the Ethernet transport qualifies; the
+// other transports are links to a nearby client. Link-local addresses are
+// omitted, as they are meaningless off-link.
+func routedAddresses(cfg *config.Config) []net.IP {
+	addrs := discoverInterfaceAddresses(cfg.Transports.Ethernet.Interfaces...)
+	if ip := net.ParseIP(cfg.Transports.Ethernet.Address); ip != nil && !ip.IsUnspecified() {
+		addrs = []net.IP{ip}
+	}
+	return slices.DeleteFunc(addrs, func(ip net.IP) bool {
+		return ip.IsLoopback() || ip.IsLinkLocalUnicast()
+	})
+}
+
 func printVersion() {
 	v := version.Get()
 	fmt.Printf("gitVersion: %s\n", v.GitVersion)
@@ -437,8 +824,9 @@ func printVersion() {
 	fmt.Printf("platform: %s\n", v.Platform)
 }
 
-// discoverInterfaceAddresses returns IPv4 addresses from all non-loopback interfaces.
-func discoverInterfaceAddresses() []net.IP {
+// discoverInterfaceAddresses returns IPv4 and IPv6 addresses from all
+// non-loopback interfaces, or only from the named interfaces if any are given.
+func discoverInterfaceAddresses(names ...string) []net.IP {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil
@@ -448,6 +836,9 @@ func discoverInterfaceAddresses() []net.IP {
 		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
 			continue
 		}
+		if len(names) > 0 && !slices.Contains(names, iface.Name) {
+			continue
+		}
 		ifAddrs, err := iface.Addrs()
 		if err != nil {
 			continue
@@ -459,8 +850,19 @@ func discoverInterfaceAddresses() []net.IP {
 			}
 			if v4 := ipNet.IP.To4(); v4 != nil {
 				addrs = append(addrs, v4)
+			} else {
+				addrs = append(addrs, ipNet.IP)
 			}
 		}
 	}
 	return addrs
 }
+
+// hostIP parses a listener host, dropping the zone of IPv6 link-local addresses.
+func hostIP(host string) net.IP {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	return net.IP(addr.WithZone("").AsSlice())
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/fzdarsky/boardingpass/internal/auth"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/inventory"
+	"github.com/fzdarsky/boardingpass/internal/qr"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+	"github.com/fzdarsky/boardingpass/internal/transport"
+)
+
+// defaultQRScale is the number of pixels per module for PNG output.
+const defaultQRScale = 8
+
+// runQR prints a QR code containing everything a client needs to onboard this
+// device: how to reach it, which certificate to expect, and the credentials.
+func runQR(args []string) error {
+	fs := flag.NewFlagSet("qr", flag.ContinueOnError)
+	configPath := fs.String("config", "/etc/boardingpass/config.yaml", "path to configuration file")
+	verifierPath := fs.String("verifier", DefaultVerifierPath, "path to SRP verifier file")
+	format := fs.String("format", "terminal", "output format: terminal, png, svg, or uri")
+	outputPath := fs.String("output", "", "write to file instead of stdout")
+	scale := fs.Int("scale", defaultQRScale, "pixels per module (png only)")
+	noPassword := fs.Bool("no-password", false, "omit the device password from the payload")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boardingpass qr [flags]
+
+Print an onboarding QR code for this device. The code encodes a
+boardingpass:// URI with the device ID, enabled transports, WiFi
+credentials, TLS certificate fingerprint and login credentials.
+
+The URI can be consumed with: boarding pass --qr <file>, or - for stdin
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	payload, err := buildQRPayload(cfg, *verifierPath, !*noPassword)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outputPath != "" {
+		//nolint:gosec // G304: Output path is from command-line argument
+		f, err := os.OpenFile(*outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		out = f
+	}
+
+	if *format == "uri" {
+		_, err := fmt.Fprintln(out, payload.URI())
+		return err
+	}
+
+	code, err := payload.QRCode()
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	switch *format {
+	case "terminal":
+		_, err = io.WriteString(out, code.Terminal())
+	case "png":
+		err = code.WritePNG(out, *scale)
+	case "svg":
+		_, err = io.WriteString(out, code.SVG())
+	default:
+		return fmt.Errorf("unsupported format %q (supported: terminal, png, svg, uri)", *format)
+	}
+	return err
+}
+
+// buildQRPayload assembles the onboarding payload from the service configuration,
+// the TLS certificate and the SRP verifier.
+func buildQRPayload(cfg *config.Config, verifierPath string, includePassword bool) (*qr.Payload, error) {
+	payload := &qr.Payload{
+		DeviceID:   qrDeviceID(),
+		Port:       cfg.Service.Port,
+		Transports: qrTransports(cfg),
+	}
+
+	if cfg.Transports.WiFi.Enabled {
+		payload.WiFiSSID = cfg.Transports.WiFi.SSID
+		if payload.WiFiSSID == "" {
+			// Mirrors the SSID default applied by the WiFi transport
+			hostname, _ := os.Hostname()
+			if hostname == "" {
+				hostname = "device"
+			}
+			payload.WiFiSSID = "BoardingPass-" + hostname
+		}
+		payload.WiFiPSK = cfg.Transports.WiFi.Password
+	}
+
+	fingerprint, err := tlspkg.CertificateFingerprint(cfg.Service.TLSCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute certificate fingerprint: %w", err)
+	}
+	payload.Fingerprint = fingerprint
+
+	verifierCfg, err := auth.LoadVerifierConfig(verifierPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load verifier config: %w", err)
+	}
+	payload.Username = verifierCfg.Username
+
+	if includePassword {
+		password, err := auth.GeneratePassword(verifierCfg.PasswordGenerator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+		payload.Password = password
+	}
+
+	return payload, nil
+}
+
+// qrDeviceID returns the board serial number, falling back to the hostname.
+func qrDeviceID() string {
+	info, err := inventory.GetProductInfo()
+	if err == nil && info.Serial != "" && info.Serial != "Unknown" {
+		return info.Serial
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// qrTransports lists the enabled transports with their static addresses.
+// Ethernet without a static address advertises the current addresses of its
+// configured interfaces, or of all interfaces.
+func qrTransports(cfg *config.Config) []qr.Transport {
+	var transports []qr.Transport
+
+	if cfg.Transports.Ethernet.Enabled {
+		if cfg.Transports.Ethernet.Address != "" && !net.ParseIP(cfg.Transports.Ethernet.Address).IsUnspecified() {
+			transports = append(transports, qr.Transport{
+				Type:    string(transport.TypeEthernet),
+				Address: cfg.Transports.Ethernet.Address,
+			})
+		} else {
+			for _, ip := range discoverInterfaceAddresses(cfg.Transports.Ethernet.Interfaces...) {
+				// Link-local IPv6 addresses are useless without their zone
+				if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+					continue
+				}
+				transports = append(transports, qr.Transport{
+					Type:    string(transport.TypeEthernet),
+					Address: ip.String(),
+				})
+			}
+		}
+	}
+	if cfg.Transports.WiFi.Enabled {
+		address := cfg.Transports.WiFi.Address
+		if address == "" {
+			address = "10.0.0.1"
+		}
+		transports = append(transports, qr.Transport{Type: string(transport.TypeWiFi), Address: address})
+	}
+	if cfg.Transports.Bluetooth.Enabled {
+		transports = append(transports, qr.Transport{
+			Type:    string(transport.TypeBluetooth),
+			Address: cfg.Transports.Bluetooth.Address,
+		})
+	}
+	if cfg.Transports.BLE.Enabled {
+		transports = append(transports, qr.Transport{Type: string(transport.TypeBLE)})
+	}
+	if cfg.Transports.USB.Enabled {
+		// Only gadget mode has a known address; in host mode the phone assigns it
+		var address string
+		if cfg.Transports.USB.IsGadget() {
+			address = cfg.Transports.USB.Address
+			if address == "" {
+				address = transport.DefaultUSBGadgetAddress
+			}
+		}
+		transports = append(transports, qr.Transport{Type: string(transport.TypeUSB), Address: address})
+	}
+	if cfg.Transports.Serial.Enabled {
+		transports = append(transports, qr.Transport{Type: string(transport.TypeSerial)})
+	}
+	if cfg.Transports.Relay.Enabled {
+		transports = append(transports, qr.Transport{Type: string(transport.TypeRelay)})
+	}
+
+	return transports
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// AuditHandler handles GET /audit requests for the audit log.
+type AuditHandler struct {
+	log    *audit.Log
+	logger *logging.Logger
+}
+
+// NewAuditHandler creates a new audit handler.
+func NewAuditHandler(log *audit.Log, logger *logging.Logger) *AuditHandler {
+	return &AuditHandler{
+		log:    log,
+		logger: logger,
+	}
+}
+
+// ServeHTTP handles the GET /audit endpoint, which returns the records of
+// the audit log and whether their hash chain is intact.
+//
+// Authentication: Required (via middleware)
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	records, err := h.log.Records()
+	if err == nil {
+		err = audit.Verify(records)
+	}
+	resp := protocol.AuditLog{Records: records, Verified: err == nil}
+	if resp.Records == nil {
+		resp.Records = []protocol.AuditRecord{}
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		h.logger.WarnContext(r.Context(), "Audit log verification failed", map[string]any{
+			"error":     err.Error(),
+			"client_ip": r.RemoteAddr,
+		})
+	}
+	middleware.WriteJSON(w, resp, http.StatusOK)
+}
+
+// auditRecord starts an audit record of the request r, with the username of
+// its session and the transport it arrived on. The client IP is the peer of
+// the connection; an X-Forwarded-For header is recorded separately, as
+// clients can set it to anything.
+func auditRecord(r *http.Request, event string) protocol.AuditRecord {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	rec := protocol.AuditRecord{
+		Event:        event,
+		Transport:    middleware.GetTransport(r.Context()),
+		ClientIP:     clientIP,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+	}
+	if session := middleware.GetSession(r.Context()); session != nil {
+		rec.Username = session.Username
+	}
+	return rec
+}
+
+// auditResult completes rec with the outcome of the recorded action: a
+// success if err is nil, or else a failure for the reason err.
+func auditResult(rec protocol.AuditRecord, err error) protocol.AuditRecord {
+	rec.Success = err == nil
+	if err != nil {
+		rec.Message = err.Error()
+	}
+	return rec
+}
@@ -8,7 +8,9 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/fzdarsky/boardingpass/internal/audit"
 	"github.com/fzdarsky/boardingpass/internal/auth"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
 )
 
 // AuthHandler handles SRP-6a authentication endpoints.
@@ -18,6 +20,7 @@ type AuthHandler struct {
 	rateLimiter    *auth.RateLimiter
 	srpStore       *auth.SRPStore
 	logger         *log.Logger
+	audit          *audit.Log
 }
 
 // NewAuthHandler creates a new authentication handler.
@@ -37,6 +40,12 @@ func NewAuthHandler(
 	}
 }
 
+// SetAuditLog sets the audit log that records authentication successes
+// and failures.
+func (ah *AuthHandler) SetAuditLog(log *audit.Log) {
+	ah.audit = log
+}
+
 // SRPInitRequest represents the POST /auth/srp/init request body.
 type SRPInitRequest struct {
 	Username string `json:"username"`
@@ -72,6 +81,7 @@ func (ah *AuthHandler) HandleSRPInit(w http.ResponseWriter, r *http.Request) {
 	if locked {
 		// Client is locked out
 		ah.logAuthEvent("srp_init_rate_limited", clientIP, "", "client locked out")
+		ah.auditAuth(r, "", "client locked out")
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", auth.FormatRetryAfter(retryAfter)))
 		writeJSONError(w, http.StatusTooManyRequests, "too_many_requests",
 			"Too many failed authentication attempts. Please try again later.")
@@ -101,6 +111,7 @@ func (ah *AuthHandler) HandleSRPInit(w http.ResponseWriter, r *http.Request) {
 	// Verify username matches configured username
 	if req.Username != ah.verifierConfig.Username {
 		ah.logAuthEvent("srp_init_invalid_username", clientIP, req.Username, "username mismatch")
+		ah.auditAuth(r, req.Username, "unknown username")
 		// Don't reveal whether username is valid - treat as auth failure
 		delay := ah.rateLimiter.RecordFailure(clientIP)
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", auth.FormatRetryAfter(delay)))
@@ -165,6 +176,7 @@ func (ah *AuthHandler) HandleSRPVerify(w http.ResponseWriter, r *http.Request) {
 	if locked {
 		// Client is locked out
 		ah.logAuthEvent("srp_verify_rate_limited", clientIP, "", "client locked out")
+		ah.auditAuth(r, "", "client locked out")
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", auth.FormatRetryAfter(retryAfter)))
 		writeJSONError(w, http.StatusTooManyRequests, "too_many_requests",
 			"Too many failed authentication attempts. Please try again later.")
@@ -195,6 +207,7 @@ func (ah *AuthHandler) HandleSRPVerify(w http.ResponseWriter, r *http.Request) {
 	server := ah.srpStore.Retrieve(req.SessionID)
 	if server == nil {
 		ah.logAuthEvent("srp_verify_invalid_session", clientIP, "", "session not found or expired")
+		ah.auditAuth(r, "", "SRP session not found or expired")
 		// Invalid or expired session - treat as auth failure
 		delay := ah.rateLimiter.RecordFailure(clientIP)
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", auth.FormatRetryAfter(delay)))
@@ -209,6 +222,7 @@ func (ah *AuthHandler) HandleSRPVerify(w http.ResponseWriter, r *http.Request) {
 	M2, err := server.Verify(req.M1)
 	if err != nil {
 		ah.logAuthEvent("srp_verify_failed", clientIP, username, fmt.Sprintf("verification failed: %v", err))
+		ah.auditAuth(r, username, "invalid proof")
 		// Authentication failed
 		delay := ah.rateLimiter.RecordFailure(clientIP)
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", auth.FormatRetryAfter(delay)))
@@ -234,6 +248,7 @@ func (ah *AuthHandler) HandleSRPVerify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ah.logAuthEvent("srp_verify_success", clientIP, username, "authentication successful")
+	ah.auditAuth(r, username, "")
 	writeJSONResponse(w, http.StatusOK, resp)
 }
 
@@ -248,6 +263,16 @@ func (ah *AuthHandler) logAuthEvent(event, clientIP, username, details string) {
 		event, clientIP, username, redactedDetails)
 }
 
+// auditAuth records an authentication attempt; failure is empty if it
+// succeeded.
+func (ah *AuthHandler) auditAuth(r *http.Request, username, failure string) {
+	rec := auditRecord(r, protocol.AuditEventAuth)
+	rec.Username = username
+	rec.Success = failure == ""
+	rec.Message = failure
+	ah.audit.Record(rec)
+}
+
 // getClientIP extracts the client IP address from the request.
 // Checks X-Forwarded-For header first (for proxies), then RemoteAddr.
 func getClientIP(r *http.Request) string {
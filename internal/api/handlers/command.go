@@ -2,26 +2,38 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"time"
 
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
 	"github.com/fzdarsky/boardingpass/internal/command"
 	"github.com/fzdarsky/boardingpass/internal/config"
 	"github.com/fzdarsky/boardingpass/internal/logging"
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
 )
 
+// commandResponseGrace is the time allowed beyond a command's timeout for
+// sending its response.
+const commandResponseGrace = 30 * time.Second
+
+// redactedParam replaces the values of secret params in audit records.
+const redactedParam = "[redacted]"
+
 // CommandHandler handles POST /command requests for executing allow-listed commands.
 type CommandHandler struct {
 	allowList *command.AllowList
 	executor  command.CommandExecutor
 	logger    *logging.Logger
+	audit     *audit.Log
 }
 
 // NewCommandHandler creates a new command handler.
 func NewCommandHandler(cfg *config.Config, logger *logging.Logger) (*CommandHandler, error) {
-	// Create executor
-	executor, err := command.NewExecutor()
+	executor, err := command.NewExecutorFor(cfg.Commands)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create command executor: %w", err)
 	}
@@ -45,13 +57,20 @@ func NewCommandHandlerWithExecutor(cfg *config.Config, executor command.CommandE
 	}, nil
 }
 
+// SetAuditLog sets the audit log that records the commands requested, with
+// their params and exit codes.
+func (h *CommandHandler) SetAuditLog(log *audit.Log) {
+	h.audit = log
+}
+
 // ServeHTTP handles the POST /command endpoint.
 //
 // This endpoint:
 // 1. Validates command ID against the allow-list (T095)
-// 2. Executes the command (via sudo unless opted out)
-// 3. Captures stdout, stderr, and exit code (T096)
-// 4. Logs execution with exit codes (T098)
+// 2. Validates the params against their count limit and schemas
+// 3. Executes the command (via sudo unless opted out)
+// 4. Captures stdout, stderr, and exit code (T096) within the command's limits
+// 5. Logs execution with exit codes (T098)
 //
 // Authentication: Required (via middleware) (T097)
 func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -84,42 +103,44 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"command_id": req.ID,
 			"client_ip":  r.RemoteAddr,
 		})
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		if err := json.NewEncoder(w).Encode(map[string]string{
-			"error":   "command_not_allowed",
-			"message": fmt.Sprintf("Command %q is not in the allow-list", req.ID),
-		}); err != nil {
-			h.logger.ErrorContext(r.Context(), "Failed to encode error response", map[string]any{
-				"error":     err.Error(),
-				"client_ip": r.RemoteAddr,
-			})
-		}
+		h.auditCommand(r, &req, nil, "command is not in the allow-list")
+		h.writeError(w, r, http.StatusForbidden, "command_not_allowed",
+			fmt.Sprintf("Command %q is not in the allow-list", req.ID))
 		return
 	}
 
-	// Validate param count against max_params
-	if len(req.Params) > cmdDef.MaxParams {
+	// Validate param count against max_params or the declared params
+	if limit := cmdDef.ParamLimit(); len(req.Params) > limit {
 		h.logger.WarnContext(r.Context(), "Too many params for command", map[string]any{
 			"command_id":  req.ID,
 			"param_count": len(req.Params),
-			"max_params":  cmdDef.MaxParams,
+			"max_params":  limit,
 			"client_ip":   r.RemoteAddr,
 		})
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		if err := json.NewEncoder(w).Encode(map[string]string{
-			"error":   "too_many_params",
-			"message": fmt.Sprintf("Command %q accepts at most %d params, got %d", req.ID, cmdDef.MaxParams, len(req.Params)),
-		}); err != nil {
-			h.logger.ErrorContext(r.Context(), "Failed to encode error response", map[string]any{
-				"error":     err.Error(),
-				"client_ip": r.RemoteAddr,
-			})
-		}
+		h.auditCommand(r, &req, nil, fmt.Sprintf("too many params, at most %d are accepted", limit))
+		h.writeError(w, r, http.StatusBadRequest, "too_many_params",
+			fmt.Sprintf("Command %q accepts at most %d params, got %d", req.ID, limit, len(req.Params)))
+		return
+	}
+
+	// Validate params against their schemas
+	if err := command.ValidateParams(cmdDef, req.Params); err != nil {
+		h.logger.WarnContext(r.Context(), "Invalid params for command", map[string]any{
+			"command_id": req.ID,
+			"error":      err.Error(),
+			"client_ip":  r.RemoteAddr,
+		})
+		h.auditCommand(r, &req, nil, err.Error())
+		h.writeError(w, r, http.StatusBadRequest, "invalid_params", err.Error())
 		return
 	}
 
+	// Keep the response writable until the command times out, past the
+	// server's write timeout. Transports without deadlines do not need it.
+	if timeout, err := cmdDef.GetTimeout(); err == nil {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + commandResponseGrace))
+	}
+
 	// T096: Execute command and capture stdout/stderr
 	response, err := h.executor.Execute(r.Context(), cmdDef, cmdDef.NeedsSudo(), req.Params)
 	if err != nil {
@@ -128,6 +149,12 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"error":      err.Error(),
 			"client_ip":  r.RemoteAddr,
 		})
+		h.auditCommand(r, &req, nil, err.Error())
+		var errResp *protocol.ErrorResponse
+		if errors.As(err, &errResp) {
+			middleware.WriteJSONError(w, errResp, middleware.HTTPStatusForErrorCode(errResp.Code))
+			return
+		}
 		http.Error(w, fmt.Sprintf("Command execution failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -138,9 +165,12 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"exit_code":   response.ExitCode,
 		"stdout_size": len(response.Stdout),
 		"stderr_size": len(response.Stderr),
+		"truncated":   response.Truncated,
 		"client_ip":   r.RemoteAddr,
 	})
 
+	h.auditCommand(r, &req, response, "")
+
 	// T096: Return response with stdout/stderr and exit code
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -151,3 +181,101 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 }
+
+// ServeList handles the GET /commands endpoint, listing the allow-listed
+// commands with their parameters so clients can offer them.
+//
+// Authentication: Required (via middleware)
+func (h *CommandHandler) ServeList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list := protocol.CommandList{Commands: make([]protocol.CommandInfo, 0, h.allowList.Count())}
+	for _, cmd := range h.allowList.List() {
+		list.Commands = append(list.Commands, commandInfo(cmd))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to encode response", map[string]any{
+			"error":     err.Error(),
+			"client_ip": r.RemoteAddr,
+		})
+	}
+}
+
+// commandInfo describes a command definition to clients.
+func commandInfo(cmd *config.CommandDefinition) protocol.CommandInfo {
+	info := protocol.CommandInfo{
+		ID:          cmd.ID,
+		Description: cmd.Description,
+		MaxParams:   cmd.ParamLimit(),
+		Sudo:        cmd.NeedsSudo(),
+	}
+	if timeout, err := cmd.GetTimeout(); err == nil {
+		info.Timeout = timeout.String()
+	}
+	for _, p := range cmd.Params {
+		paramType := p.Type
+		if paramType == "" {
+			paramType = config.ParamTypeString
+		}
+		info.Params = append(info.Params, protocol.CommandParam{
+			Name:        p.Name,
+			Description: p.Description,
+			Type:        paramType,
+			Pattern:     p.Pattern,
+			Enum:        p.Enum,
+			Optional:    p.Optional,
+			Secret:      p.Secret,
+		})
+	}
+	return info
+}
+
+// auditCommand records a command request. resp is nil if the command did
+// not run, and failure tells why.
+func (h *CommandHandler) auditCommand(r *http.Request, req *protocol.CommandRequest, resp *protocol.CommandResponse, failure string) {
+	rec := auditRecord(r, protocol.AuditEventCommand)
+	rec.Command = &protocol.AuditCommand{ID: req.ID, Params: h.redactParams(req.ID, req.Params)}
+	rec.Message = failure
+	if resp != nil {
+		rec.Command.ExitCode = &resp.ExitCode
+		rec.Success = resp.ExitCode == 0
+	}
+	h.audit.Record(rec)
+}
+
+// redactParams returns params with the values of the command's secret
+// params replaced, so that tokens do not end up in the audit log.
+func (h *CommandHandler) redactParams(id string, params []string) []string {
+	cmdDef, ok := h.allowList.Get(id)
+	if !ok || !slices.ContainsFunc(cmdDef.Params, func(p config.CommandParam) bool { return p.Secret }) {
+		return params
+	}
+	redacted := slices.Clone(params)
+	for i := range redacted {
+		if i < len(cmdDef.Params) && cmdDef.Params[i].Secret && redacted[i] != "" {
+			redacted[i] = redactedParam
+		}
+	}
+	return redacted
+}
+
+// writeError writes a JSON error response.
+func (h *CommandHandler) writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"error":   code,
+		"message": message,
+	}); err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to encode error response", map[string]any{
+			"error":     err.Error(),
+			"client_ip": r.RemoteAddr,
+		})
+	}
+}
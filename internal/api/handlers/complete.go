@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
 	"github.com/fzdarsky/boardingpass/internal/lifecycle"
 	"github.com/fzdarsky/boardingpass/internal/logging"
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
@@ -19,6 +22,8 @@ type CompleteHandler struct {
 	shutdownFunc func(string)
 	rebootFunc   func()
 	logger       *logging.Logger
+	audit        *audit.Log
+	enrollments  *enrollment.Registry
 }
 
 // NewCompleteHandler creates a new complete handler.
@@ -31,13 +36,25 @@ func NewCompleteHandler(sentinelPath string, shutdownFunc func(string), rebootFu
 	}
 }
 
+// SetAuditLog sets the audit log that records the completion.
+func (h *CompleteHandler) SetAuditLog(log *audit.Log) {
+	h.audit = log
+}
+
+// SetEnrollments sets the enrollment backends whose unfinished enrollments
+// keep provisioning from completing.
+func (h *CompleteHandler) SetEnrollments(enrollments *enrollment.Registry) {
+	h.enrollments = enrollments
+}
+
 // ServeHTTP handles the POST /complete endpoint.
 //
 // This endpoint:
 // 1. Parses optional request body for reboot flag
-// 2. Creates the sentinel file to prevent service from starting again
-// 3. Initiates graceful service shutdown or schedules reboot
-// 4. Returns response confirming shutdown/reboot is in progress
+// 2. Rejects the request while an enrollment has not finished
+// 3. Creates the sentinel file to prevent service from starting again
+// 4. Initiates graceful service shutdown or schedules reboot
+// 5. Returns response confirming shutdown/reboot is in progress
 //
 // Authentication: Required (via middleware)
 func (h *CompleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -64,12 +81,29 @@ func (h *CompleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"client_ip": r.RemoteAddr,
 	})
 
+	rec := auditRecord(r, protocol.AuditEventComplete)
+	rec.Reboot = req.Reboot
+
+	// An enrollment awaiting approval would be lost with the process
+	if h.enrollments != nil && h.enrollments.InProgress() {
+		h.logger.WarnContext(r.Context(), "Provisioning completion rejected while an enrollment is in progress", map[string]any{
+			"client_ip": r.RemoteAddr,
+		})
+		rec.Message = "enrollment in progress"
+		h.audit.Record(rec)
+		middleware.WriteJSONError(w, protocol.NewEnrollmentInProgressError(
+			"wait for the enrollment to finish before completing provisioning"), http.StatusConflict)
+		return
+	}
+
 	// Create sentinel file
 	if err := h.sentinel.Create(); err != nil {
 		h.logger.ErrorContext(r.Context(), "Failed to create sentinel file", map[string]any{
 			"error":     err.Error(),
 			"client_ip": r.RemoteAddr,
 		})
+		rec.Message = err.Error()
+		h.audit.Record(rec)
 		http.Error(w, fmt.Sprintf("Failed to create sentinel file: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -78,6 +112,8 @@ func (h *CompleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"path":      h.sentinel.Path(),
 		"client_ip": r.RemoteAddr,
 	})
+	rec.Success = true
+	h.audit.Record(rec)
 
 	// Determine status based on reboot flag
 	status := "shutting_down"
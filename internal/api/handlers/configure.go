@@ -1,20 +1,28 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/fzdarsky/boardingpass/internal/audit"
 	"github.com/fzdarsky/boardingpass/internal/config"
 	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/network/nmkeyfile"
 	"github.com/fzdarsky/boardingpass/internal/provisioning"
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
 )
 
 // ConfigureHandler handles POST /configure requests for configuration bundle provisioning.
 type ConfigureHandler struct {
-	config *config.Config
-	logger *logging.Logger
+	config    *config.Config
+	logger    *logging.Logger
+	onApplied func()
+	audit     *audit.Log
 }
 
 // NewConfigureHandler creates a new configure handler.
@@ -25,13 +33,26 @@ func NewConfigureHandler(cfg *config.Config, logger *logging.Logger) *ConfigureH
 	}
 }
 
+// SetAppliedCallback registers a function called after a bundle was applied
+// successfully.
+func (h *ConfigureHandler) SetAppliedCallback(fn func()) {
+	h.onApplied = fn
+}
+
+// SetAuditLog sets the audit log that records the bundles applied, with
+// the paths, hashes and modes of their files.
+func (h *ConfigureHandler) SetAuditLog(log *audit.Log) {
+	h.audit = log
+}
+
 // ServeHTTP handles the POST /configure endpoint.
 //
 // This endpoint:
 // 1. Validates bundle size (10MB max) and file count (100 files max)
 // 2. Validates all file paths against the allow-list from config
-// 3. Applies configuration atomically with rollback on failure
-// 4. Creates sentinel file on success (triggers service shutdown)
+// 3. Validates NetworkManager keyfiles under /etc/NetworkManager/system-connections/
+// 4. Applies configuration atomically with rollback on failure
+// 5. Creates sentinel file on success (triggers service shutdown)
 //
 // Authentication: Required (via middleware)
 // Content redaction: All configuration payloads are redacted in logs
@@ -65,6 +86,7 @@ func (h *ConfigureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"error":     err.Error(),
 			"client_ip": r.RemoteAddr,
 		})
+		h.auditBundle(r, &bundle, err)
 		http.Error(w, fmt.Sprintf("Bundle validation failed: %v", err), http.StatusBadRequest)
 		return
 	}
@@ -80,6 +102,7 @@ func (h *ConfigureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"error":     err.Error(),
 			"client_ip": r.RemoteAddr,
 		})
+		h.auditBundle(r, &bundle, err)
 		http.Error(w, fmt.Sprintf("Path validation failed: %v", err), http.StatusBadRequest)
 		return
 	}
@@ -91,15 +114,29 @@ func (h *ConfigureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"error":     err.Error(),
 			"client_ip": r.RemoteAddr,
 		})
+		h.auditBundle(r, &bundle, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	if err := applier.Apply(r.Context(), &bundle); err != nil {
+		// Malformed NetworkManager keyfiles are rejected before anything is written
+		var keyfileErr *nmkeyfile.ValidationError
+		if errors.As(err, &keyfileErr) {
+			h.logger.WarnContext(r.Context(), "Keyfile validation failed", map[string]any{
+				"error":     err.Error(),
+				"client_ip": r.RemoteAddr,
+			})
+			h.auditBundle(r, &bundle, err)
+			http.Error(w, fmt.Sprintf("Keyfile validation failed: %v", err), http.StatusBadRequest)
+			return
+		}
+
 		h.logger.ErrorContext(r.Context(), "Configuration provisioning failed", map[string]any{
 			"error":     err.Error(),
 			"client_ip": r.RemoteAddr,
 		})
+		h.auditBundle(r, &bundle, err)
 		http.Error(w, fmt.Sprintf("Provisioning failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -117,6 +154,12 @@ func (h *ConfigureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"client_ip":  r.RemoteAddr,
 	})
 
+	h.auditBundle(r, &bundle, nil)
+
+	if h.onApplied != nil {
+		h.onApplied()
+	}
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -129,3 +172,23 @@ func (h *ConfigureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 }
+
+// auditBundle records a bundle that was applied, or failed to apply with
+// err. Files are recorded by path, mode and the hash of their content, up
+// to the number a bundle may have.
+func (h *ConfigureHandler) auditBundle(r *http.Request, bundle *protocol.ConfigBundle, err error) {
+	rec := auditRecord(r, protocol.AuditEventConfigure)
+	rec.Success = err == nil
+	if err != nil {
+		rec.Message = err.Error()
+	}
+	for _, file := range bundle.Files[:min(len(bundle.Files), provisioning.MaxFileCount)] {
+		f := protocol.AuditFile{Path: file.Path, Mode: file.Mode}
+		if content, err := base64.StdEncoding.DecodeString(file.Content); err == nil {
+			sum := sha256.Sum256(content)
+			f.SHA256 = hex.EncodeToString(sum[:])
+		}
+		rec.Files = append(rec.Files, f)
+	}
+	h.audit.Record(rec)
+}
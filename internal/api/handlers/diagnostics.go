@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/diagnostics"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// DiagnosticsHandler handles the POST /diagnostics/connectivity endpoint.
+type DiagnosticsHandler struct {
+	runner *diagnostics.Runner
+	logger *logging.Logger
+}
+
+// NewDiagnosticsHandler creates a new diagnostics handler.
+func NewDiagnosticsHandler(runner *diagnostics.Runner, logger *logging.Logger) *DiagnosticsHandler {
+	return &DiagnosticsHandler{
+		runner: runner,
+		logger: logger,
+	}
+}
+
+// ServeConnectivity handles the POST /diagnostics/connectivity endpoint.
+// The body is optional; without one, only the checks that need no targets
+// run. Failed checks are part of a 200 OK response.
+//
+// Authentication: Required (via middleware)
+func (h *DiagnosticsHandler) ServeConnectivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req protocol.ConnectivityRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		middleware.WriteJSONError(w, protocol.NewInvalidRequestError(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.runner.Run(r.Context(), &req)
+	if err != nil {
+		var errResp *protocol.ErrorResponse
+		if !errors.As(err, &errResp) {
+			errResp = protocol.NewSystemError(err.Error())
+		}
+		middleware.WriteJSONError(w, errResp, middleware.HTTPStatusForErrorCode(errResp.Code))
+		return
+	}
+
+	failed := []string{}
+	for _, c := range resp.Checks {
+		if c.Status == protocol.CheckFail {
+			failed = append(failed, c.Check+" "+c.Target)
+		}
+	}
+	h.logger.InfoContext(r.Context(), "Connectivity diagnostics run", map[string]any{
+		"passed":    resp.Passed,
+		"failed":    failed,
+		"client_ip": r.RemoteAddr,
+	})
+	middleware.WriteJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// EnrollmentHandler handles the enrollment endpoints: GET /enrollment,
+// GET /enrollment/backends, GET and POST /enrollment/{backend} and
+// POST /enrollment/{backend}/validate.
+type EnrollmentHandler struct {
+	backends *enrollment.Registry
+	logger   *logging.Logger
+	audit    *audit.Log
+}
+
+// NewEnrollmentHandler creates a new enrollment handler.
+func NewEnrollmentHandler(backends *enrollment.Registry, logger *logging.Logger) *EnrollmentHandler {
+	return &EnrollmentHandler{
+		backends: backends,
+		logger:   logger,
+	}
+}
+
+// SetAuditLog sets the audit log that records the enrollments started,
+// without their request fields.
+func (h *EnrollmentHandler) SetAuditLog(log *audit.Log) {
+	h.audit = log
+}
+
+// ServeStatus handles the GET /enrollment endpoint, which returns the status
+// of the last enrollment of any backend.
+//
+// Authentication: Required (via middleware)
+func (h *EnrollmentHandler) ServeStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := h.backends.Status()
+	if status == nil {
+		http.Error(w, "No enrollment", http.StatusNotFound)
+		return
+	}
+	middleware.WriteJSON(w, status, http.StatusOK)
+}
+
+// ServeBackends handles the GET /enrollment/backends endpoint, listing the
+// available backends with the fields of their enrollment requests so
+// clients can build forms for them.
+//
+// Authentication: Required (via middleware)
+func (h *EnrollmentHandler) ServeBackends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	backends := h.backends.List()
+	list := protocol.EnrollmentBackendList{Backends: make([]protocol.EnrollmentBackend, 0, len(backends))}
+	for _, b := range backends {
+		list.Backends = append(list.Backends, b.Info())
+	}
+	middleware.WriteJSON(w, list, http.StatusOK)
+}
+
+// ServeBackend handles the /enrollment/{backend} endpoint. GET returns the
+// status of the backend's last enrollment. POST starts an enrollment and
+// responds with 202 Accepted once the backend accepted the request; GET
+// reports its progress.
+//
+// Authentication: Required (via middleware)
+// Content redaction: Request fields are never logged, as they hold tokens
+func (h *EnrollmentHandler) ServeBackend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("backend")
+	backend, ok := h.backends.Get(name)
+	if !ok {
+		http.Error(w, "Unknown enrollment backend", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		status := backend.Status()
+		if status == nil {
+			http.Error(w, "No enrollment", http.StatusNotFound)
+			return
+		}
+		middleware.WriteJSON(w, status, http.StatusOK)
+		return
+	}
+
+	req, ok := decodeEnrollmentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := backend.Enroll(r.Context(), req)
+	rec := auditRecord(r, protocol.AuditEventEnroll)
+	rec.Target = name
+	h.audit.Record(auditResult(rec, err))
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "Enrollment failed", map[string]any{
+			"backend":   name,
+			"error":     err.Error(),
+			"client_ip": r.RemoteAddr,
+		})
+		writeEnrollmentError(w, err)
+		return
+	}
+
+	h.logger.InfoContext(r.Context(), "Enrollment started", map[string]any{
+		"backend":      status.Backend,
+		"state":        status.State,
+		"server":       status.Server,
+		"request_name": status.RequestName,
+		"client_ip":    r.RemoteAddr,
+	})
+	middleware.WriteJSON(w, status, http.StatusAccepted)
+}
+
+// ServeValidate handles the POST /enrollment/{backend}/validate endpoint,
+// which checks an enrollment request without enrolling, so clients can
+// validate forms before submitting them. It responds with 204 No Content
+// if the request is valid.
+//
+// Authentication: Required (via middleware)
+func (h *EnrollmentHandler) ServeValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	backend, ok := h.backends.Get(r.PathValue("backend"))
+	if !ok {
+		http.Error(w, "Unknown enrollment backend", http.StatusNotFound)
+		return
+	}
+	req, ok := decodeEnrollmentRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := backend.Validate(req); err != nil {
+		writeEnrollmentError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeEnrollmentRequest reads the JSON enrollment request of r, writing an
+// error response if it is not valid JSON.
+func decodeEnrollmentRequest(w http.ResponseWriter, r *http.Request) (json.RawMessage, bool) {
+	var req json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.WriteJSONError(w, protocol.NewInvalidRequestError(err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+	return req, true
+}
+
+func writeEnrollmentError(w http.ResponseWriter, err error) {
+	var errResp *protocol.ErrorResponse
+	if !errors.As(err, &errResp) {
+		errResp = protocol.NewSystemError(err.Error())
+	}
+	middleware.WriteJSONError(w, errResp, middleware.HTTPStatusForErrorCode(errResp.Code))
+}
@@ -47,11 +47,7 @@ func (h *InfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.cacheMu.RUnlock()
 
 	// Cache miss or expired - gather fresh data
-	info, err := gatherSystemInfo()
-	if err != nil {
-		http.Error(w, "Failed to gather system information", http.StatusInternalServerError)
-		return
-	}
+	info := inventory.GetSystemInfo()
 
 	// Update cache
 	h.cacheMu.Lock()
@@ -66,62 +62,3 @@ func (h *InfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
-
-// gatherSystemInfo collects system information from all inventory components.
-func gatherSystemInfo() (protocol.SystemInfo, error) {
-	hostname, err := inventory.GetHostname()
-	if err != nil {
-		// Non-fatal: continue with empty hostname
-		hostname = "unknown"
-	}
-
-	tpmInfo, err := inventory.GetTPMInfo()
-	if err != nil {
-		// Non-fatal: continue with empty TPM info
-		tpmInfo = protocol.TPMInfo{Present: false}
-	}
-
-	firmwareInfo := inventory.GetFirmwareInfo()
-
-	productInfo, err := inventory.GetProductInfo()
-	if err != nil {
-		// Non-fatal: continue with unknown product info
-		productInfo = protocol.ProductInfo{
-			Vendor:  "Unknown",
-			Family:  "Unknown",
-			Name:    "Unknown",
-			Version: "Unknown",
-			Serial:  "Unknown",
-		}
-	}
-
-	cpuInfo := inventory.GetCPUInfo()
-
-	osInfo, err := inventory.GetOSInfo()
-	if err != nil {
-		// Non-fatal: continue with unknown OS info
-		osInfo = protocol.OSInfo{
-			Distribution: "Unknown",
-			Version:      "Unknown",
-			FIPSEnabled:  false,
-		}
-	}
-
-	clockTime, clockSync, err := inventory.GetClockStatus()
-	if err != nil {
-		// Non-fatal: use current time and unsynchronized
-		clockTime = time.Now().UTC()
-		clockSync = false
-	}
-	osInfo.SystemTime = clockTime.UTC().Format(time.RFC3339)
-	osInfo.ClockSynchronized = clockSync
-
-	return protocol.SystemInfo{
-		Hostname: hostname,
-		TPM:      tpmInfo,
-		Firmware: firmwareInfo,
-		Product:  productInfo,
-		CPU:      cpuInfo,
-		OS:       osInfo,
-	}, nil
-}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/system"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// SystemHandler handles the typed provisioning endpoints:
+// PUT /system/hostname, PUT /system/time, PUT /system/proxy and
+// PUT /network/interfaces/{name}.
+type SystemHandler struct {
+	manager *system.Manager
+	logger  *logging.Logger
+	audit   *audit.Log
+}
+
+// NewSystemHandler creates a new system handler. If manager is nil, because
+// the system bus is unavailable, all requests fail with a system error.
+func NewSystemHandler(manager *system.Manager, logger *logging.Logger) *SystemHandler {
+	return &SystemHandler{
+		manager: manager,
+		logger:  logger,
+	}
+}
+
+// SetAuditLog sets the audit log that records the settings applied, without
+// their values.
+func (h *SystemHandler) SetAuditLog(log *audit.Log) {
+	h.audit = log
+}
+
+// ServeHostname handles the PUT /system/hostname endpoint.
+//
+// Authentication: Required (via middleware)
+func (h *SystemHandler) ServeHostname(w http.ResponseWriter, r *http.Request) {
+	var cfg protocol.HostnameConfig
+	h.serve(w, r, "hostname", &cfg, func(ctx context.Context) error {
+		return h.manager.SetHostname(ctx, &cfg)
+	})
+}
+
+// ServeTime handles the PUT /system/time endpoint.
+//
+// Authentication: Required (via middleware)
+func (h *SystemHandler) ServeTime(w http.ResponseWriter, r *http.Request) {
+	var cfg protocol.TimeConfig
+	h.serve(w, r, "time", &cfg, func(ctx context.Context) error {
+		return h.manager.SetTime(ctx, &cfg)
+	})
+}
+
+// ServeProxy handles the PUT /system/proxy endpoint.
+//
+// Authentication: Required (via middleware)
+func (h *SystemHandler) ServeProxy(w http.ResponseWriter, r *http.Request) {
+	var cfg protocol.ProxyConfig
+	h.serve(w, r, "proxy", &cfg, func(ctx context.Context) error {
+		return h.manager.SetProxy(ctx, &cfg)
+	})
+}
+
+// ServeInterface handles the PUT /network/interfaces/{name} endpoint.
+//
+// Authentication: Required (via middleware)
+func (h *SystemHandler) ServeInterface(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var cfg protocol.InterfaceConfig
+	h.serve(w, r, "interface "+name, &cfg, func(ctx context.Context) error {
+		return h.manager.ConfigureInterface(ctx, name, &cfg)
+	})
+}
+
+// serve decodes the request body into cfg and applies it, responding with
+// 204 No Content on success.
+func (h *SystemHandler) serve(w http.ResponseWriter, r *http.Request, setting string, cfg any, apply func(context.Context) error) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.manager == nil {
+		middleware.WriteJSONError(w, protocol.NewSystemError("system bus unavailable"), http.StatusInternalServerError)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		middleware.WriteJSONError(w, protocol.NewInvalidRequestError(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err := apply(r.Context())
+	rec := auditRecord(r, protocol.AuditEventSystem)
+	rec.Target = setting
+	h.audit.Record(auditResult(rec, err))
+	if err != nil {
+		var errResp *protocol.ErrorResponse
+		if !errors.As(err, &errResp) {
+			errResp = protocol.NewSystemError(err.Error())
+		}
+		h.logger.WarnContext(r.Context(), "Failed to apply system setting", map[string]any{
+			"setting":   setting,
+			"error":     err.Error(),
+			"client_ip": r.RemoteAddr,
+		})
+		middleware.WriteJSONError(w, errResp, middleware.HTTPStatusForErrorCode(errResp.Code))
+		return
+	}
+
+	h.logger.InfoContext(r.Context(), "System setting applied", map[string]any{
+		"setting":   setting,
+		"client_ip": r.RemoteAddr,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
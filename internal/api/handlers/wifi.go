@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/system"
+	"github.com/fzdarsky/boardingpass/internal/transport"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// defaultSwitchOverDelay is how long a switch-over waits before stopping the
+// access point, so the response reaches the client through it.
+const defaultSwitchOverDelay = 5 * time.Second
+
+// WiFiClient scans for and connects to WiFi networks. It is implemented by
+// *system.Manager.
+type WiFiClient interface {
+	WiFiDevices(ctx context.Context) ([]string, error)
+	ScanWiFi(ctx context.Context, iface string) ([]protocol.WiFiNetwork, error)
+	ConnectWiFi(ctx context.Context, iface string, req *protocol.WiFiConnectRequest) ([]string, error)
+}
+
+// AccessPoint is the WiFi access point transport that may share the radio
+// with the WiFi client. It is implemented by *transport.WiFiHandler.
+type AccessPoint interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	TransportState() transport.State
+	Interface() string
+	ClientInterface(ctx context.Context, ssid string) (iface, mode string, err error)
+	CachedScan() ([]protocol.WiFiNetwork, time.Time)
+}
+
+// WiFiHandler handles the WiFi client endpoints: GET /network/wifi/scan and
+// POST and GET /network/wifi/connect.
+//
+// If the access point runs on a radio that cannot also be a client, the
+// scan returns the networks found before the access point started, and a
+// connection is made by a switch-over: the access point stops after a delay,
+// and starts again if the connection fails.
+type WiFiHandler struct {
+	client WiFiClient
+	ap     AccessPoint
+	logger *logging.Logger
+	audit  *audit.Log
+	delay  time.Duration
+
+	mu     sync.Mutex
+	status *protocol.WiFiConnectStatus // last connection attempt
+}
+
+// NewWiFiHandler creates a new WiFi handler. If client is nil, because the
+// system bus is unavailable, all requests fail with a system error. ap is
+// nil if the WiFi transport is disabled.
+func NewWiFiHandler(client WiFiClient, ap AccessPoint, logger *logging.Logger) *WiFiHandler {
+	return &WiFiHandler{
+		client: client,
+		ap:     ap,
+		logger: logger,
+		delay:  defaultSwitchOverDelay,
+	}
+}
+
+// SetAuditLog sets the audit log that records the connection attempts,
+// with their outcome.
+func (h *WiFiHandler) SetAuditLog(log *audit.Log) {
+	h.audit = log
+}
+
+// SetSwitchOverDelay sets how long a switch-over waits before stopping the
+// access point.
+func (h *WiFiHandler) SetSwitchOverDelay(d time.Duration) {
+	h.delay = d
+}
+
+// ServeScan handles the GET /network/wifi/scan endpoint. The optional
+// "interface" query parameter selects the WiFi device to scan on.
+//
+// Authentication: Required (via middleware)
+func (h *WiFiHandler) ServeScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.client == nil {
+		middleware.WriteJSONError(w, protocol.NewSystemError("system bus unavailable"), http.StatusInternalServerError)
+		return
+	}
+	if h.switchingOver() {
+		middleware.WriteJSONError(w, protocol.NewWiFiBusyError("a switch-over to a WiFi network is in progress"), http.StatusConflict)
+		return
+	}
+
+	iface, mode, err := h.clientInterface(r.Context(), r.URL.Query().Get("interface"), "")
+	if err != nil {
+		h.writeError(w, r, "scan", err)
+		return
+	}
+
+	if mode == protocol.WiFiModeSwitchOver {
+		networks, scannedAt := h.ap.CachedScan()
+		if scannedAt.IsZero() {
+			middleware.WriteJSONError(w, protocol.NewWiFiBusyError(
+				"the radio serves the access point and no scan was made before it started"), http.StatusConflict)
+			return
+		}
+		middleware.WriteJSON(w, &protocol.WiFiScanResponse{
+			Interface: iface,
+			Networks:  nonNil(networks),
+			ScannedAt: scannedAt,
+			Cached:    true,
+		}, http.StatusOK)
+		return
+	}
+
+	networks, err := h.client.ScanWiFi(r.Context(), iface)
+	if err != nil {
+		h.writeError(w, r, "scan", err)
+		return
+	}
+	middleware.WriteJSON(w, &protocol.WiFiScanResponse{
+		Interface: iface,
+		Networks:  nonNil(networks),
+		ScannedAt: time.Now().UTC(),
+	}, http.StatusOK)
+}
+
+// ServeConnect handles the POST /network/wifi/connect endpoint, which
+// connects to a WiFi network, and GET /network/wifi/connect, which returns
+// the state of the last connection attempt.
+//
+// POST responds with 200 OK once the device is connected, or with 202
+// Accepted if the connection is made by a switch-over, whose progress GET
+// reports once the client has rejoined the device's network.
+//
+// Authentication: Required (via middleware)
+func (h *WiFiHandler) ServeConnect(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.serveStatus(w)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.client == nil {
+		middleware.WriteJSONError(w, protocol.NewSystemError("system bus unavailable"), http.StatusInternalServerError)
+		return
+	}
+
+	var req protocol.WiFiConnectRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		middleware.WriteJSONError(w, protocol.NewInvalidRequestError(err.Error()), http.StatusBadRequest)
+		return
+	}
+	rec := auditRecord(r, protocol.AuditEventWiFi)
+	rec.Target = req.SSID
+	if err := system.ValidateWiFiConnect(&req); err != nil {
+		h.audit.Record(auditResult(rec, err))
+		h.writeError(w, r, "connect", err)
+		return
+	}
+
+	iface, mode, err := h.clientInterface(r.Context(), req.Interface, req.SSID)
+	if err != nil {
+		h.audit.Record(auditResult(rec, err))
+		h.writeError(w, r, "connect", err)
+		return
+	}
+
+	status := &protocol.WiFiConnectStatus{
+		State:     protocol.WiFiStateConnecting,
+		SSID:      req.SSID,
+		Interface: iface,
+		Mode:      mode,
+	}
+	if mode == protocol.WiFiModeSwitchOver {
+		switchAt := time.Now().Add(h.delay).UTC()
+		status.State = protocol.WiFiStateScheduled
+		status.SwitchAt = &switchAt
+	}
+	if !h.begin(status) {
+		middleware.WriteJSONError(w, protocol.NewWiFiBusyError("another WiFi connection attempt is in progress"), http.StatusConflict)
+		return
+	}
+
+	if mode == protocol.WiFiModeSwitchOver {
+		h.logger.InfoContext(r.Context(), "WiFi switch-over scheduled", map[string]any{
+			"ssid":      req.SSID,
+			"interface": iface,
+			"switch_at": status.SwitchAt,
+			"client_ip": r.RemoteAddr,
+		})
+		response := *status // the switch-over updates status
+		go h.switchOver(iface, &req, rec)
+		middleware.WriteJSON(w, &response, http.StatusAccepted)
+		return
+	}
+
+	addresses, err := h.client.ConnectWiFi(r.Context(), iface, &req)
+	status = h.finish(addresses, err)
+	h.audit.Record(auditResult(rec, err))
+	if err != nil {
+		h.writeError(w, r, "connect", err)
+		return
+	}
+	h.logger.InfoContext(r.Context(), "WiFi network connected", map[string]any{
+		"ssid":      req.SSID,
+		"interface": iface,
+		"mode":      mode,
+		"client_ip": r.RemoteAddr,
+	})
+	middleware.WriteJSON(w, status, http.StatusOK)
+}
+
+// serveStatus responds with the last connection attempt.
+func (h *WiFiHandler) serveStatus(w http.ResponseWriter) {
+	h.mu.Lock()
+	var status *protocol.WiFiConnectStatus
+	if h.status != nil {
+		copied := *h.status
+		status = &copied
+	}
+	h.mu.Unlock()
+
+	if status == nil {
+		http.Error(w, "No WiFi connection attempt", http.StatusNotFound)
+		return
+	}
+	middleware.WriteJSON(w, status, http.StatusOK)
+}
+
+// clientInterface returns the interface to scan on, or to connect to the
+// network ssid on, and the mode of the connection. An empty name selects the
+// access point's radio, or else the first WiFi device.
+func (h *WiFiHandler) clientInterface(ctx context.Context, name, ssid string) (string, string, error) {
+	if h.ap != nil {
+		if name == "" {
+			return h.ap.ClientInterface(ctx, ssid)
+		}
+		if name == h.ap.Interface() && h.ap.TransportState() == transport.StateActive {
+			return name, protocol.WiFiModeSwitchOver, nil
+		}
+	}
+	if name != "" {
+		return name, protocol.WiFiModeDirect, nil
+	}
+
+	devices, err := h.client.WiFiDevices(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if len(devices) == 0 {
+		return "", "", protocol.NewInterfaceNotFoundError("no WiFi device found")
+	}
+	return devices[0], protocol.WiFiModeDirect, nil
+}
+
+// switchOver stops the access point, connects to the network and starts the
+// access point again if that fails. The outcome is recorded in rec.
+func (h *WiFiHandler) switchOver(iface string, req *protocol.WiFiConnectRequest, rec protocol.AuditRecord) {
+	time.Sleep(h.delay)
+	h.mu.Lock()
+	h.status.State = protocol.WiFiStateConnecting
+	h.mu.Unlock()
+
+	ctx := context.Background()
+	if err := h.ap.Stop(ctx); err != nil {
+		h.finish(nil, err)
+		h.audit.Record(auditResult(rec, err))
+		h.logger.Error("Failed to stop WiFi access point for switch-over", map[string]any{
+			"interface": iface,
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	addresses, err := h.client.ConnectWiFi(ctx, iface, req)
+	h.finish(addresses, err)
+	h.audit.Record(auditResult(rec, err))
+	if err == nil {
+		h.logger.Info("WiFi network connected, access point stays stopped", map[string]any{
+			"ssid":      req.SSID,
+			"interface": iface,
+			"addresses": addresses,
+		})
+		return
+	}
+
+	h.logger.Warn("WiFi switch-over failed, restarting access point", map[string]any{
+		"ssid":      req.SSID,
+		"interface": iface,
+		"error":     err.Error(),
+	})
+	if err := h.ap.Start(ctx); err != nil {
+		h.logger.Error("Failed to restart WiFi access point", map[string]any{
+			"interface": iface,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// begin records status as the current attempt, unless another attempt is
+// still in progress.
+func (h *WiFiHandler) begin(status *protocol.WiFiConnectStatus) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.status != nil && (h.status.State == protocol.WiFiStateScheduled || h.status.State == protocol.WiFiStateConnecting) {
+		return false
+	}
+	h.status = status
+	return true
+}
+
+// finish records the outcome of the current attempt and returns a copy of
+// its status.
+func (h *WiFiHandler) finish(addresses []string, err error) *protocol.WiFiConnectStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.status.State = protocol.WiFiStateFailed
+		h.status.Error = err.Error()
+		var errResp *protocol.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Details != "" {
+			h.status.Error = errResp.Details
+		}
+	} else {
+		h.status.State = protocol.WiFiStateConnected
+		h.status.Addresses = addresses
+	}
+	status := *h.status
+	return &status
+}
+
+// switchingOver reports whether a switch-over is scheduled or running.
+func (h *WiFiHandler) switchingOver() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status != nil && h.status.Mode == protocol.WiFiModeSwitchOver &&
+		(h.status.State == protocol.WiFiStateScheduled || h.status.State == protocol.WiFiStateConnecting)
+}
+
+func (h *WiFiHandler) writeError(w http.ResponseWriter, r *http.Request, operation string, err error) {
+	var errResp *protocol.ErrorResponse
+	if !errors.As(err, &errResp) {
+		errResp = protocol.NewSystemError(err.Error())
+	}
+	h.logger.WarnContext(r.Context(), "WiFi operation failed", map[string]any{
+		"operation": operation,
+		"error":     err.Error(),
+		"client_ip": r.RemoteAddr,
+	})
+	middleware.WriteJSONError(w, errResp, middleware.HTTPStatusForErrorCode(errResp.Code))
+}
+
+// nonNil returns networks, or an empty slice, so it encodes as [].
+func nonNil(networks []protocol.WiFiNetwork) []protocol.WiFiNetwork {
+	if networks == nil {
+		return []protocol.WiFiNetwork{}
+	}
+	return networks
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/fzdarsky/boardingpass/internal/auth"
 )
@@ -10,7 +11,8 @@ import (
 type contextKey string
 
 const (
-	sessionContextKey contextKey = "session"
+	sessionContextKey   contextKey = "session"
+	transportContextKey contextKey = "transport"
 )
 
 // withSession stores a session in the request context.
@@ -27,3 +29,24 @@ func GetSession(ctx context.Context) *auth.Session {
 	}
 	return session
 }
+
+// WithTransport stores the transport a request arrived on in its context.
+func WithTransport(ctx context.Context, transport string) context.Context {
+	return context.WithValue(ctx, transportContextKey, transport)
+}
+
+// GetTransport retrieves the transport a request arrived on, such as
+// "ethernet" or "ble". Returns "" if it is not known.
+func GetTransport(ctx context.Context) string {
+	transport, _ := ctx.Value(transportContextKey).(string)
+	return transport
+}
+
+// Transport is an HTTP middleware that marks requests as arriving on
+// transport, for transports that pass requests to the handler directly
+// rather than through a listener.
+func Transport(transport string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithTransport(r.Context(), transport)))
+	})
+}
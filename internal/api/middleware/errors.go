@@ -55,7 +55,8 @@ func HTTPStatusForErrorCode(code protocol.ErrorCode) int {
 		protocol.ErrCodeBundleTooLarge,
 		protocol.ErrCodeTooManyFiles,
 		protocol.ErrCodeInvalidFileMode,
-		protocol.ErrCodeInvalidConfiguration:
+		protocol.ErrCodeInvalidConfiguration,
+		protocol.ErrCodeValidationFailed:
 		return http.StatusBadRequest
 
 	// 401 Unauthorized
@@ -74,9 +75,15 @@ func HTTPStatusForErrorCode(code protocol.ErrorCode) int {
 		return http.StatusForbidden
 
 	// 404 Not Found
-	case protocol.ErrCodeVerifierNotFound:
+	case protocol.ErrCodeVerifierNotFound,
+		protocol.ErrCodeInterfaceNotFound:
 		return http.StatusNotFound
 
+	// 409 Conflict
+	case protocol.ErrCodeWiFiBusy,
+		protocol.ErrCodeEnrollmentInProgress:
+		return http.StatusConflict
+
 	// 429 Too Many Requests
 	case protocol.ErrCodeRateLimitExceeded:
 		return http.StatusTooManyRequests
@@ -94,10 +101,17 @@ func HTTPStatusForErrorCode(code protocol.ErrorCode) int {
 	case protocol.ErrCodeShuttingDown:
 		return http.StatusServiceUnavailable
 
-	// 502 Bad Gateway (command execution failure)
-	case protocol.ErrCodeCommandFailed:
+	// 502 Bad Gateway (command execution failure, WiFi network or management
+	// service rejected the device)
+	case protocol.ErrCodeCommandFailed,
+		protocol.ErrCodeWiFiConnectFailed,
+		protocol.ErrCodeEnrollmentFailed:
 		return http.StatusBadGateway
 
+	// 504 Gateway Timeout (command did not finish in time)
+	case protocol.ErrCodeCommandTimeout:
+		return http.StatusGatewayTimeout
+
 	default:
 		return http.StatusInternalServerError
 	}
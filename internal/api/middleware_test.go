@@ -155,6 +155,7 @@ func TestHTTPStatusForErrorCode(t *testing.T) {
 		{protocol.ErrCodeInvalidRequest, http.StatusBadRequest},
 		{protocol.ErrCodeInvalidPath, http.StatusBadRequest},
 		{protocol.ErrCodeBundleTooLarge, http.StatusBadRequest},
+		{protocol.ErrCodeValidationFailed, http.StatusBadRequest},
 
 		// 401 Unauthorized
 		{protocol.ErrCodeUnauthorized, http.StatusUnauthorized},
@@ -168,6 +169,8 @@ func TestHTTPStatusForErrorCode(t *testing.T) {
 
 		// 404 Not Found
 		{protocol.ErrCodeVerifierNotFound, http.StatusNotFound},
+		{protocol.ErrCodeInterfaceNotFound, http.StatusNotFound},
+		{protocol.ErrCodeWiFiBusy, http.StatusConflict},
 
 		// 429 Too Many Requests
 		{protocol.ErrCodeRateLimitExceeded, http.StatusTooManyRequests},
@@ -182,6 +185,10 @@ func TestHTTPStatusForErrorCode(t *testing.T) {
 
 		// 503 Service Unavailable
 		{protocol.ErrCodeShuttingDown, http.StatusServiceUnavailable},
+
+		// 504 Gateway Timeout
+		{protocol.ErrCodeCommandTimeout, http.StatusGatewayTimeout},
+		{protocol.ErrCodeWiFiConnectFailed, http.StatusBadGateway},
 	}
 
 	for _, tt := range tests {
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,7 +22,9 @@ import (
 type Server struct {
 	httpServer *http.Server
 	tlsConfig  *tls.Config
+	certMgr    *tlspkg.CertManager
 	listeners  []net.Listener
+	pending    []string // configured addresses that could not be bound yet
 	logger     *logging.Logger
 	config     *config.Config
 	mu         sync.Mutex
@@ -45,6 +48,7 @@ func New(cfg *config.Config, logger *logging.Logger) (*Server, error) {
 		logger: logger,
 		config: cfg,
 	}
+	server.httpServer.ConnContext = server.connContext
 
 	// Configure TLS with CertManager for dynamic SAN support.
 	// When a TLS handshake arrives on an IP not in the cert's SANs,
@@ -62,6 +66,7 @@ func New(cfg *config.Config, logger *logging.Logger) (*Server, error) {
 	tlsCfg := certMgr.ServerTLSConfig()
 	server.httpServer.TLSConfig = tlsCfg
 	server.tlsConfig = tlsCfg
+	server.certMgr = certMgr
 
 	return server, nil
 }
@@ -69,7 +74,7 @@ func New(cfg *config.Config, logger *logging.Logger) (*Server, error) {
 // Start begins serving HTTPS requests on all configured listeners.
 func (s *Server) Start(ctx context.Context) error {
 	addrs := s.configuredAddresses()
-	if len(addrs) == 0 {
+	if len(addrs) == 0 && !s.hasDynamicTransports() {
 		return fmt.Errorf("no transports enabled")
 	}
 
@@ -82,6 +87,9 @@ func (s *Server) Start(ctx context.Context) error {
 				"address": addr,
 				"error":   err.Error(),
 			})
+			s.mu.Lock()
+			s.pending = append(s.pending, addr)
+			s.mu.Unlock()
 			continue
 		}
 
@@ -100,7 +108,10 @@ func (s *Server) Start(ctx context.Context) error {
 		}(ln)
 	}
 
-	if len(s.listeners) == 0 {
+	s.mu.Lock()
+	bound := len(s.listeners)
+	s.mu.Unlock()
+	if len(addrs) > 0 && bound == 0 {
 		return fmt.Errorf("no listeners could be created")
 	}
 
@@ -115,8 +126,9 @@ func (s *Server) Start(ctx context.Context) error {
 }
 
 // AddListener creates and starts serving on a new address at runtime.
+// IPv6 addresses may carry a zone, e.g. "fe80::1%eth0".
 func (s *Server) AddListener(address string, port int) error {
-	addr := fmt.Sprintf("%s:%d", address, port)
+	addr := net.JoinHostPort(address, strconv.Itoa(port))
 
 	ln, err := s.createListener(addr)
 	if err != nil {
@@ -143,6 +155,77 @@ func (s *Server) AddListener(address string, port int) error {
 	return nil
 }
 
+// Refresh reacts to network address changes. It binds configured listeners
+// whose address was not assigned yet and regenerates the certificate if an
+// interface address is missing from its SANs.
+func (s *Server) Refresh() {
+	if s.certMgr != nil {
+		s.certMgr.Refresh()
+	}
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	var still []string
+	for _, addr := range pending {
+		ln, err := s.createListener(addr)
+		if err != nil {
+			still = append(still, addr)
+			continue
+		}
+
+		s.mu.Lock()
+		s.listeners = append(s.listeners, ln)
+		s.mu.Unlock()
+
+		s.logger.Info("HTTPS listener started", map[string]any{
+			"address": addr,
+		})
+
+		go func() {
+			if err := s.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+				s.logger.Warn("listener error", map[string]any{
+					"address": addr,
+					"error":   err.Error(),
+				})
+			}
+		}()
+	}
+
+	s.mu.Lock()
+	s.pending = append(s.pending, still...)
+	s.mu.Unlock()
+}
+
+// ServeListener serves HTTPS on a listener provided by a transport, such as
+// streams multiplexed over a serial line. The listener is wrapped with TLS
+// and can be removed with RemoveListener using its address.
+func (s *Server) ServeListener(ln net.Listener) {
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+
+	s.mu.Lock()
+	s.listeners = append(s.listeners, ln)
+	s.mu.Unlock()
+
+	s.logger.Info("added HTTPS listener", map[string]any{
+		"address": ln.Addr().String(),
+		"network": ln.Addr().Network(),
+	})
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Warn("listener stopped", map[string]any{
+				"address": ln.Addr().String(),
+				"error":   err.Error(),
+			})
+		}
+	}()
+}
+
 // RemoveListener closes the listener bound to the given address.
 func (s *Server) RemoveListener(address string) error {
 	s.mu.Lock()
@@ -203,24 +286,19 @@ func (s *Server) RegisterRouteFunc(pattern string, handler http.HandlerFunc) {
 func (s *Server) configuredAddresses() []string {
 	var addrs []string
 
-	port := s.config.Service.Port
+	port := strconv.Itoa(s.config.Service.Port)
 
-	if s.config.Transports.Ethernet.Enabled {
-		addrs = append(addrs, fmt.Sprintf("%s:%d",
-			s.config.Transports.Ethernet.Address, port,
-		))
+	// Ethernet listeners bound to named interfaces are added dynamically via AddListener
+	if s.config.Transports.Ethernet.Enabled && len(s.config.Transports.Ethernet.Interfaces) == 0 {
+		addrs = append(addrs, net.JoinHostPort(s.config.Transports.Ethernet.Address, port))
 	}
 
 	if s.config.Transports.WiFi.Enabled {
-		addrs = append(addrs, fmt.Sprintf("%s:%d",
-			s.config.Transports.WiFi.Address, port,
-		))
+		addrs = append(addrs, net.JoinHostPort(s.config.Transports.WiFi.Address, port))
 	}
 
 	if s.config.Transports.Bluetooth.Enabled {
-		addrs = append(addrs, fmt.Sprintf("%s:%d",
-			s.config.Transports.Bluetooth.Address, port,
-		))
+		addrs = append(addrs, net.JoinHostPort(s.config.Transports.Bluetooth.Address, port))
 	}
 
 	// USB addresses are added dynamically via AddListener
@@ -228,6 +306,14 @@ func (s *Server) configuredAddresses() []string {
 	return addrs
 }
 
+// hasDynamicTransports reports whether an enabled transport adds listeners
+// at runtime or serves without one, so no configured address is required.
+func (s *Server) hasDynamicTransports() bool {
+	t := s.config.Transports
+	return (t.Ethernet.Enabled && len(t.Ethernet.Interfaces) > 0) ||
+		t.USB.Enabled || t.BLE.Enabled || t.Serial.Enabled || t.Relay.Enabled
+}
+
 // createListener creates a TLS listener on the given address.
 func (s *Server) createListener(addr string) (net.Listener, error) {
 	lc := net.ListenConfig{}
@@ -0,0 +1,83 @@
+//nolint:revive // "api" is a clear and appropriate package name
+package api
+
+import (
+	"context"
+	"net"
+	"slices"
+
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/transport"
+)
+
+// connContext marks the requests of a connection with the transport it
+// arrived on, so that handlers can record it.
+func (s *Server) connContext(ctx context.Context, c net.Conn) context.Context {
+	return middleware.WithTransport(ctx, s.transportOf(c.LocalAddr()))
+}
+
+// transportOf returns the transport a connection with the local address
+// addr arrived on. Listeners that transports provide are named after their
+// transport, e.g. "serial"; TCP connections are matched by the transports'
+// static addresses, including the default USB gadget address, then by the
+// interface they arrived on.
+func (s *Server) transportOf(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return addr.Network()
+	}
+	t := s.config.Transports
+
+	static := []struct {
+		transport transport.Type
+		enabled   bool
+		address   string
+	}{
+		{transport.TypeWiFi, t.WiFi.Enabled, t.WiFi.Address},
+		{transport.TypeBluetooth, t.Bluetooth.Enabled, t.Bluetooth.Address},
+		{transport.TypeUSB, t.USB.Enabled, transport.USBAddress(t.USB)},
+		{transport.TypeEthernet, t.Ethernet.Enabled, t.Ethernet.Address},
+	}
+	for _, st := range static {
+		if ip := net.ParseIP(st.address); st.enabled && ip != nil && ip.Equal(tcpAddr.IP) {
+			return string(st.transport)
+		}
+	}
+
+	if name := interfaceOf(tcpAddr.IP); name != "" {
+		switch {
+		case t.Ethernet.Enabled && slices.Contains(t.Ethernet.Interfaces, name):
+			return string(transport.TypeEthernet)
+		case t.WiFi.Enabled && name == t.WiFi.Interface:
+			return string(transport.TypeWiFi)
+		case t.USB.Enabled && transport.IsUSBInterface(t.USB, name):
+			return string(transport.TypeUSB)
+		}
+	}
+
+	// Ethernet listens on all other addresses
+	if t.Ethernet.Enabled {
+		return string(transport.TypeEthernet)
+	}
+	return addr.Network()
+}
+
+// interfaceOf returns the name of the interface that has ip, or "".
+func interfaceOf(ip net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+//nolint:revive // "api" is a clear and appropriate package name
+package api
+
+import (
+	"net"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_TransportOf(t *testing.T) {
+	loopback := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9455}
+
+	tests := []struct {
+		name       string
+		transports config.TransportSettings
+		addr       net.Addr
+		want       string
+	}{
+		{
+			name: "serial listener",
+			addr: mux.Addr{Net: "serial", Name: "ttyGS0"},
+			want: "serial",
+		},
+		{
+			name:       "static address",
+			transports: config.TransportSettings{WiFi: config.WiFiTransport{Enabled: true, Address: "127.0.0.1"}},
+			addr:       loopback,
+			want:       "wifi",
+		},
+		{
+			name: "static address of a disabled transport",
+			transports: config.TransportSettings{
+				WiFi:     config.WiFiTransport{Address: "127.0.0.1"},
+				Ethernet: config.EthernetTransport{Enabled: true, Address: "0.0.0.0"},
+			},
+			addr: loopback,
+			want: "ethernet",
+		},
+		{
+			name: "default USB gadget address",
+			transports: config.TransportSettings{
+				USB:      config.USBTransport{Enabled: true, Mode: config.USBModeGadget},
+				Ethernet: config.EthernetTransport{Enabled: true, Address: "0.0.0.0"},
+			},
+			addr: &net.TCPAddr{IP: net.IPv4(10, 0, 2, 1), Port: 9455},
+			want: "usb",
+		},
+		{
+			name: "non-USB interface with the default USB config",
+			transports: config.TransportSettings{
+				USB:      config.USBTransport{Enabled: true},
+				Ethernet: config.EthernetTransport{Enabled: true, Address: "0.0.0.0"},
+			},
+			addr: loopback,
+			want: "ethernet",
+		},
+		{
+			name:       "unknown address",
+			transports: config.TransportSettings{USB: config.USBTransport{Enabled: true, InterfacePrefix: "usb"}},
+			addr:       loopback,
+			want:       "tcp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{config: &config.Config{Transports: tt.transports}}
+			assert.Equal(t, tt.want, s.transportOf(tt.addr))
+		})
+	}
+}
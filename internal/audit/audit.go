@@ -0,0 +1,301 @@
+// Package audit keeps a tamper-evident record of the provisioning actions
+// taken on the device: authentications, configuration bundles, commands,
+// system settings, WiFi connections, enrollments and completion.
+//
+// Records are appended to a JSON-lines file, each carrying the SHA-256 hash
+// of the record before it. Changing, inserting or removing a record breaks
+// the chain, which Verify detects; the hash of each new record is also
+// logged, so the journal anchors the end of the chain. The file is kept when
+// the service goes inert, as the record of how the device was provisioned.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// genesisHash is the previous hash of the first record.
+var genesisHash = strings.Repeat("0", sha256.Size*2)
+
+// maxRecordBytes limits the length of a line when reading the log.
+const maxRecordBytes = 1 << 20
+
+// Log appends records to an audit log file.
+type Log struct {
+	path   string
+	logger *logging.Logger
+
+	mu       sync.Mutex
+	seq      uint64
+	lastHash string
+}
+
+// Open opens the audit log at path, creating it and its directory if
+// needed, and continues the chain of the records it holds. A partial last
+// line, left by a crash while appending, is removed, so that new records
+// start on a line of their own.
+func Open(path string, logger *logging.Logger) (*Log, error) {
+	l := &Log{path: path, logger: logger, lastHash: genesisHash}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	removed, err := truncatePartialLine(path)
+	if err != nil {
+		return nil, err
+	}
+	if removed > 0 {
+		logger.Warn("Removed a partial record from the end of the audit log", map[string]any{
+			"path":  path,
+			"bytes": removed,
+		})
+	}
+
+	records, err := ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		var recordErr *RecordError
+		if !errors.As(err, &recordErr) {
+			return nil, err
+		}
+		// Chain new records to the last readable one; Verify reports the
+		// unreadable line
+		logger.Warn("Audit log contains an unreadable record", map[string]any{
+			"path":  path,
+			"error": err.Error(),
+		})
+	}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		l.seq, l.lastHash = last.Seq, last.Hash
+	}
+	return l, nil
+}
+
+// truncatePartialLine removes the bytes after the last newline of the file
+// at path, returning how many were removed.
+func truncatePartialLine(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0) //nolint:gosec // G304: path of the configured audit log
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	size := info.Size()
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if keep := start + int64(i) + 1; keep < size {
+				return size - keep, truncate(f, keep)
+			}
+			return 0, nil
+		}
+		end = start
+	}
+	if size == 0 {
+		return 0, nil
+	}
+	return size, truncate(f, 0)
+}
+
+func truncate(f *os.File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return nil
+}
+
+// Path returns the path of the log file.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record appends rec to the log, setting its sequence number, time and
+// hashes. Failures are logged, as they must not fail the recorded action.
+// A nil Log records nothing.
+func (l *Log) Record(rec protocol.AuditRecord) {
+	if l == nil {
+		return
+	}
+	if err := l.Append(rec); err != nil {
+		l.logger.Error("Failed to write audit record", map[string]any{
+			"event": rec.Event,
+			"error": err.Error(),
+		})
+	}
+}
+
+// Append appends rec to the log, setting its sequence number, time and
+// hashes. The record is synced to disk before Append returns.
+func (l *Log) Append(rec protocol.AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.seq + 1
+	rec.Time = time.Now().UTC()
+	rec.PrevHash = l.lastHash
+	hash, err := Hash(&rec)
+	if err != nil {
+		return err
+	}
+	rec.Hash = hash
+	line, err := json.Marshal(&rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	l.seq, l.lastHash = rec.Seq, rec.Hash
+	l.logger.Info("Audit record written", map[string]any{
+		"seq":   rec.Seq,
+		"event": rec.Event,
+		"hash":  rec.Hash,
+	})
+	return nil
+}
+
+// Records reads the records of the log. If lines cannot be read, it returns
+// the other records with a *RecordError for the first of them.
+func (l *Log) Records() ([]protocol.AuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records, err := ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return records, err
+}
+
+// RecordError reports a line of the log that is not a record.
+type RecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("audit log line %d: %v", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// ReadFile reads the records of the audit log at path. If lines cannot be
+// read, it returns the other records with a *RecordError for the first of
+// them.
+func ReadFile(path string) ([]protocol.AuditRecord, error) {
+	f, err := os.Open(path) //nolint:gosec // G304: path of the configured audit log
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return Read(f)
+}
+
+// Read reads audit records from r, one JSON object per line. Lines that
+// are not records are skipped, so that they do not hide the records after
+// them; the first is reported as a *RecordError. Verify then finds where
+// the chain is broken.
+func Read(r io.Reader) ([]protocol.AuditRecord, error) {
+	var records []protocol.AuditRecord
+	var firstErr error
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxRecordBytes)
+	line := 1
+	for ; scanner.Scan(); line++ {
+		var rec protocol.AuditRecord
+		decoder := json.NewDecoder(strings.NewReader(scanner.Text()))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rec); err != nil {
+			if firstErr == nil {
+				firstErr = &RecordError{Line: line, Err: err}
+			}
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil && firstErr == nil {
+		firstErr = &RecordError{Line: line, Err: err}
+	}
+	return records, firstErr
+}
+
+// Verify checks that records form an unbroken chain from the start of the
+// log, returning an error for the first record that does not.
+func Verify(records []protocol.AuditRecord) error {
+	prev := genesisHash
+	for i := range records {
+		rec := &records[i]
+		if rec.Seq != uint64(i)+1 {
+			return fmt.Errorf("record %d: has sequence number %d", i+1, rec.Seq)
+		}
+		if rec.PrevHash != prev {
+			return fmt.Errorf("record %d: previous hash does not match record %d", rec.Seq, rec.Seq-1)
+		}
+		hash, err := Hash(rec)
+		if err != nil {
+			return err
+		}
+		if rec.Hash != hash {
+			return fmt.Errorf("record %d: hash does not match its content", rec.Seq)
+		}
+		prev = rec.Hash
+	}
+	return nil
+}
+
+// Hash computes the hash of rec: the SHA-256 of its JSON encoding with an
+// empty hash field, hex-encoded.
+func Hash(rec *protocol.AuditRecord) (string, error) {
+	r := *rec
+	r.Hash = ""
+	data, err := json.Marshal(&r)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,184 @@
+package audit_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLog(t *testing.T, path string) *audit.Log {
+	t.Helper()
+	log, err := audit.Open(path, logging.New(logging.LevelError, logging.FormatJSON))
+	require.NoError(t, err)
+	return log
+}
+
+func TestLog_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+
+	log := newLog(t, path)
+	require.NoError(t, log.Append(protocol.AuditRecord{Event: protocol.AuditEventAuth, Success: true, Username: "admin"}))
+	require.NoError(t, log.Append(protocol.AuditRecord{Event: protocol.AuditEventConfigure, Success: true}))
+
+	// A reopened log continues the chain
+	log = newLog(t, path)
+	require.NoError(t, log.Append(protocol.AuditRecord{Event: protocol.AuditEventComplete, Success: true}))
+
+	records, err := log.Records()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, uint64(3), records[2].Seq)
+	assert.Equal(t, records[1].Hash, records[2].PrevHash)
+	assert.Equal(t, strings.Repeat("0", 64), records[0].PrevHash)
+	assert.Equal(t, "admin", records[0].Username)
+	require.NoError(t, audit.Verify(records))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestLog_Records_Missing(t *testing.T) {
+	log := newLog(t, filepath.Join(t.TempDir(), "audit.jsonl"))
+	records, err := log.Records()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.NoError(t, audit.Verify(records))
+}
+
+func TestLog_Record_Nil(t *testing.T) {
+	var log *audit.Log
+	assert.NotPanics(t, func() { log.Record(protocol.AuditRecord{Event: protocol.AuditEventAuth}) })
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := newLog(t, path)
+	for _, event := range []string{protocol.AuditEventAuth, protocol.AuditEventCommand, protocol.AuditEventComplete} {
+		require.NoError(t, log.Append(protocol.AuditRecord{Event: event, Success: true}))
+	}
+	records, err := log.Records()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		tamper  func([]protocol.AuditRecord) []protocol.AuditRecord
+		wantErr string
+	}{
+		{
+			name: "modified record",
+			tamper: func(r []protocol.AuditRecord) []protocol.AuditRecord {
+				r[1].Username = "mallory"
+				return r
+			},
+			wantErr: "record 2: hash does not match",
+		},
+		{
+			name: "removed record",
+			tamper: func(r []protocol.AuditRecord) []protocol.AuditRecord {
+				return append(r[:1], r[2:]...)
+			},
+			wantErr: "record 2: has sequence number 3",
+		},
+		{
+			name: "removed first record",
+			tamper: func(r []protocol.AuditRecord) []protocol.AuditRecord {
+				return r[1:]
+			},
+			wantErr: "record 1: has sequence number 2",
+		},
+		{
+			name: "rehashed record",
+			tamper: func(r []protocol.AuditRecord) []protocol.AuditRecord {
+				r[1].Success = false
+				r[1].Hash, _ = audit.Hash(&r[1])
+				return r
+			},
+			wantErr: "record 3: previous hash does not match record 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := tt.tamper(append([]protocol.AuditRecord(nil), records...))
+			assert.ErrorContains(t, audit.Verify(tampered), tt.wantErr)
+		})
+	}
+}
+
+func TestOpen_UnreadableRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := newLog(t, path)
+	require.NoError(t, log.Append(protocol.AuditRecord{Event: protocol.AuditEventAuth}))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString("{\"seq\":\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	records, err := audit.ReadFile(path)
+	var recordErr *audit.RecordError
+	require.ErrorAs(t, err, &recordErr)
+	assert.Equal(t, 2, recordErr.Line)
+	assert.Len(t, records, 1)
+
+	// New records are still appended to the chain, and read past the
+	// unreadable line
+	log = newLog(t, path)
+	require.NoError(t, log.Append(protocol.AuditRecord{Event: protocol.AuditEventComplete}))
+	records, err = log.Records()
+	assert.ErrorAs(t, err, &recordErr)
+	require.Len(t, records, 2)
+	assert.Equal(t, protocol.AuditEventComplete, records[1].Event)
+}
+
+func TestOpen_PartialRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := newLog(t, path)
+	require.NoError(t, log.Append(protocol.AuditRecord{Event: protocol.AuditEventAuth}))
+
+	// A crash while appending leaves a truncated line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"time":"2026-10-18T09:00:00Z","eve`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	log = newLog(t, path)
+	require.NoError(t, log.Append(protocol.AuditRecord{Event: protocol.AuditEventComplete}))
+
+	records, err := log.Records()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, protocol.AuditEventComplete, records[1].Event)
+	assert.NoError(t, audit.Verify(records))
+}
+
+func TestRead_SkipsUnreadableLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := newLog(t, path)
+	for _, event := range []string{protocol.AuditEventAuth, protocol.AuditEventConfigure, protocol.AuditEventComplete} {
+		require.NoError(t, log.Append(protocol.AuditRecord{Event: event}))
+	}
+
+	// Corrupt the record in the middle
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[1] = "garbage\n"
+	records, err := audit.Read(strings.NewReader(strings.Join(lines, "")))
+
+	var recordErr *audit.RecordError
+	require.ErrorAs(t, err, &recordErr)
+	assert.Equal(t, 2, recordErr.Line)
+	require.Len(t, records, 2)
+	assert.Equal(t, protocol.AuditEventComplete, records[1].Event)
+	assert.Error(t, audit.Verify(records))
+}
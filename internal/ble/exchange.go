@@ -0,0 +1,279 @@
+package ble
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/fzdarsky/boardingpass/internal/logging"
+)
+
+// requestQueueSize bounds the number of complete requests waiting to be served.
+const requestQueueSize = 8
+
+// ErrBusy is returned when a request arrives while the request queue is full.
+var ErrBusy = errors.New("ble: too many pending requests")
+
+type request struct {
+	id   uint8
+	data []byte
+}
+
+// Server answers framed HTTP requests from a single central using an http.Handler.
+// Requests are served one at a time, in the order they complete.
+type Server struct {
+	handler    http.Handler
+	send       func(frame []byte) error
+	remoteAddr string
+	logger     *logging.Logger
+
+	mu        sync.Mutex
+	frameSize int
+	asm       Reassembler
+
+	requests chan request
+}
+
+// NewServer creates a server that writes response frames with send.
+// remoteAddr is reported to handlers as http.Request.RemoteAddr.
+func NewServer(handler http.Handler, send func(frame []byte) error, remoteAddr string, logger *logging.Logger) *Server {
+	return &Server{
+		handler:    handler,
+		send:       send,
+		remoteAddr: remoteAddr,
+		logger:     logger,
+		frameSize:  PayloadSize(DefaultMTU),
+		requests:   make(chan request, requestQueueSize),
+	}
+}
+
+// SetMTU updates the ATT MTU used to size response frames.
+func (s *Server) SetMTU(mtu int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frameSize = PayloadSize(mtu)
+}
+
+// Receive feeds a request frame written by the central.
+func (s *Server) Receive(frame []byte) error {
+	s.mu.Lock()
+	id, data, done, err := s.asm.Feed(frame)
+	s.mu.Unlock()
+	if err != nil || !done {
+		return err
+	}
+
+	select {
+	case s.requests <- request{id: id, data: data}:
+		return nil
+	default:
+		return ErrBusy
+	}
+}
+
+// Serve handles queued requests until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context) {
+	for {
+		select {
+		case req := <-s.requests:
+			s.serveOne(ctx, req)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) serveOne(ctx context.Context, req request) {
+	resp := s.handle(ctx, req.data)
+
+	s.mu.Lock()
+	frameSize := s.frameSize
+	s.mu.Unlock()
+
+	frames, err := Fragment(req.id, resp, frameSize)
+	if err != nil {
+		s.logger.Warn("failed to fragment BLE response", map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	for _, f := range frames {
+		if err := s.send(f); err != nil {
+			s.logger.Warn("failed to send BLE response frame", map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+}
+
+// handle parses a serialized request, runs the handler and returns the
+// serialized response.
+func (s *Server) handle(ctx context.Context, data []byte) []byte {
+	httpReq, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return serializeResponse(http.StatusBadRequest, http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			[]byte("malformed request\n"))
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.RemoteAddr = s.remoteAddr
+
+	rw := &responseWriter{header: make(http.Header)}
+	s.handler.ServeHTTP(rw, httpReq)
+	_ = httpReq.Body.Close()
+
+	return serializeResponse(rw.statusCode(), rw.header, rw.body.Bytes())
+}
+
+// responseWriter buffers a complete response so it can be framed.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *responseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func serializeResponse(status int, header http.Header, body []byte) []byte {
+	resp := &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	var buf bytes.Buffer
+	_ = resp.Write(&buf) // writes to a bytes.Buffer cannot fail
+	return buf.Bytes()
+}
+
+// Client sends framed HTTP requests to a Server. It implements http.RoundTripper,
+// so it can back an http.Client.
+type Client struct {
+	send      func(frame []byte) error
+	frameSize int
+
+	sendMu sync.Mutex // keeps the frames of one request contiguous
+
+	mu      sync.Mutex
+	asm     Reassembler
+	nextID  uint8
+	pending map[uint8]chan []byte
+}
+
+// NewClient creates a client that writes request frames with send.
+func NewClient(send func(frame []byte) error, mtu int) *Client {
+	return &Client{
+		send:      send,
+		frameSize: PayloadSize(mtu),
+		pending:   make(map[uint8]chan []byte),
+	}
+}
+
+// Receive feeds a response frame notified by the server.
+func (c *Client) Receive(frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, data, done, err := c.asm.Feed(frame)
+	if err != nil || !done {
+		return err
+	}
+	if ch, ok := c.pending[id]; ok {
+		delete(c.pending, id)
+		ch <- data
+	}
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return nil, fmt.Errorf("ble: failed to serialize request: %w", err)
+	}
+
+	id, ch, err := c.register()
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := Fragment(id, buf.Bytes(), c.frameSize)
+	if err != nil {
+		c.unregister(id)
+		return nil, err
+	}
+
+	c.sendMu.Lock()
+	for _, f := range frames {
+		if err := c.send(f); err != nil {
+			c.sendMu.Unlock()
+			c.unregister(id)
+			return nil, fmt.Errorf("ble: failed to send request: %w", err)
+		}
+	}
+	c.sendMu.Unlock()
+
+	select {
+	case data := <-ch:
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+		if err != nil {
+			return nil, fmt.Errorf("ble: malformed response: %w", err)
+		}
+		return resp, nil
+	case <-req.Context().Done():
+		c.unregister(id)
+		return nil, req.Context().Err()
+	}
+}
+
+func (c *Client) register() (uint8, chan []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for range 256 {
+		id := c.nextID
+		c.nextID++
+		if _, busy := c.pending[id]; !busy {
+			ch := make(chan []byte, 1)
+			c.pending[id] = ch
+			return id, ch, nil
+		}
+	}
+	return 0, nil, ErrBusy
+}
+
+func (c *Client) unregister(id uint8) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
@@ -0,0 +1,168 @@
+package ble
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPeer wires a Client and Server together in memory, the way a central and
+// the peripheral exchange frames over the request and response characteristics.
+func newPeer(t *testing.T, handler http.Handler, mtu int) *http.Client {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var client *Client
+	server := NewServer(handler, func(frame []byte) error {
+		return client.Receive(frame)
+	}, "[AA:BB:CC:DD:EE:FF]:0", logging.New(logging.LevelError, logging.FormatJSON))
+	server.SetMTU(mtu)
+
+	client = NewClient(server.Receive, mtu)
+	go server.Serve(ctx)
+
+	return &http.Client{Transport: client, Timeout: 10 * time.Second}
+}
+
+func echoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	})
+}
+
+func TestExchange_RoundTrip(t *testing.T) {
+	client := newPeer(t, echoHandler(), DefaultMTU)
+
+	resp, err := client.Post("http://ble/configure?x=1", "application/json", strings.NewReader(`{"a":1}`))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, `{"a":1}`, string(body))
+	assert.Equal(t, "/configure", resp.Header.Get("X-Path"))
+	assert.Equal(t, "[AA:BB:CC:DD:EE:FF]:0", resp.Header.Get("X-Remote-Addr"))
+}
+
+func TestExchange_LargeBody(t *testing.T) {
+	payload := bytes.Repeat([]byte("boardingpass"), 20000)
+
+	for _, mtu := range []int{DefaultMTU, 517} {
+		t.Run(fmt.Sprintf("mtu %d", mtu), func(t *testing.T) {
+			client := newPeer(t, echoHandler(), mtu)
+
+			resp, err := client.Post("http://ble/echo", "application/octet-stream", bytes.NewReader(payload))
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, payload, body)
+		})
+	}
+}
+
+func TestExchange_ConcurrentRequests(t *testing.T) {
+	client := newPeer(t, echoHandler(), 185)
+
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			want := strings.Repeat(fmt.Sprintf("request-%d;", i), 100)
+			resp, err := client.Post("http://ble/echo", "text/plain", strings.NewReader(want))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = resp.Body.Close() }()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(body))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExchange_DefaultStatus(t *testing.T) {
+	client := newPeer(t, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), DefaultMTU)
+
+	resp, err := client.Get("http://ble/info")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(0), resp.ContentLength)
+}
+
+func TestServer_MalformedRequest(t *testing.T) {
+	responses := make(chan []byte, 1)
+	var asm Reassembler
+	server := NewServer(echoHandler(), func(frame []byte) error {
+		_, msg, done, err := asm.Feed(frame)
+		if done {
+			responses <- msg
+		}
+		return err
+	}, "[ble]:0", logging.New(logging.LevelError, logging.FormatJSON))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Serve(ctx)
+
+	frames, err := Fragment(9, []byte("not http\r\n\r\n"), PayloadSize(DefaultMTU))
+	require.NoError(t, err)
+	for _, f := range frames {
+		require.NoError(t, server.Receive(f))
+	}
+
+	select {
+	case msg := <-responses:
+		assert.True(t, strings.HasPrefix(string(msg), "HTTP/1.1 400"), string(msg))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response")
+	}
+}
+
+func TestServer_Busy(t *testing.T) {
+	server := NewServer(echoHandler(), func([]byte) error { return nil }, "[ble]:0",
+		logging.New(logging.LevelError, logging.FormatJSON))
+
+	// Serve is not running, so complete requests accumulate in the queue
+	frames, err := Fragment(0, []byte("GET / HTTP/1.1\r\n\r\n"), 512)
+	require.NoError(t, err)
+	for range requestQueueSize {
+		require.NoError(t, server.Receive(frames[0]))
+	}
+	assert.ErrorIs(t, server.Receive(frames[0]), ErrBusy)
+}
+
+func TestClient_ContextCancelled(t *testing.T) {
+	client := NewClient(func([]byte) error { return nil }, DefaultMTU)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://ble/info", nil)
+	require.NoError(t, err)
+
+	_, err = client.RoundTrip(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, client.pending)
+}
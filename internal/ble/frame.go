@@ -0,0 +1,170 @@
+// Package ble carries the BoardingPass REST API over Bluetooth Low Energy GATT.
+//
+// HTTP/1.1 requests and responses are serialized in wire format and split
+// into frames that fit a single ATT write or notification:
+//
+//	byte 0     flags (0x80 = first frame of a message, 0x40 = last frame)
+//	byte 1     message ID, echoed in the response
+//	byte 2     frame sequence number within the message (wraps at 256)
+//	bytes 3-6  total message length, big-endian (first frame only)
+//	rest       message bytes
+//
+// The central writes request frames to the request characteristic and
+// receives response frames as notifications on the response characteristic.
+package ble
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Frame flags.
+const (
+	FlagFirst byte = 0x80
+	FlagLast  byte = 0x40
+)
+
+const (
+	headerSize      = 3
+	firstHeaderSize = headerSize + 4
+
+	// attOverhead is the ATT opcode and handle preceding each write or notification.
+	attOverhead = 3
+
+	// DefaultMTU is the minimum ATT MTU every LE device supports.
+	DefaultMTU = 23
+
+	// MaxMessageSize bounds a reassembled message. It accommodates the largest
+	// configuration bundle after Base64 and JSON encoding.
+	MaxMessageSize = 16 * 1024 * 1024
+)
+
+// Errors returned by the Reassembler.
+var (
+	ErrFrameTooShort   = errors.New("ble: frame too short")
+	ErrUnexpectedFrame = errors.New("ble: continuation frame without a message in progress")
+	ErrSequence        = errors.New("ble: frame out of sequence")
+	ErrMessageTooLarge = errors.New("ble: message too large")
+	ErrLengthMismatch  = errors.New("ble: message length does not match header")
+)
+
+// PayloadSize returns the number of frame bytes that fit into one ATT
+// write or notification for the given MTU.
+func PayloadSize(mtu int) int {
+	if mtu < DefaultMTU {
+		mtu = DefaultMTU
+	}
+	return mtu - attOverhead
+}
+
+// Fragment splits a message into frames of at most frameSize bytes.
+func Fragment(id uint8, msg []byte, frameSize int) ([][]byte, error) {
+	if frameSize <= firstHeaderSize {
+		return nil, fmt.Errorf("ble: frame size %d too small", frameSize)
+	}
+	if len(msg) > MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	var frames [][]byte
+	var seq uint8
+	rest := msg
+	for first := true; first || len(rest) > 0; first = false {
+		var frame []byte
+		n := frameSize - headerSize
+		if first {
+			frame = make([]byte, firstHeaderSize, frameSize)
+			frame[0] = FlagFirst
+			binary.BigEndian.PutUint32(frame[headerSize:], uint32(len(msg))) // #nosec G115 - bounded by MaxMessageSize
+			n = frameSize - firstHeaderSize
+		} else {
+			frame = make([]byte, headerSize, frameSize)
+		}
+		frame[1] = id
+		frame[2] = seq
+		seq++
+
+		n = min(n, len(rest))
+		frame = append(frame, rest[:n]...)
+		rest = rest[n:]
+		if len(rest) == 0 {
+			frame[0] |= FlagLast
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// Reassembler collects frames into complete messages. It handles one message
+// at a time; a new first frame discards any partial message.
+type Reassembler struct {
+	active bool
+	id     uint8
+	seq    uint8
+	length int
+	buf    []byte
+}
+
+// Feed adds a frame. It returns the message ID and data once the last frame
+// of a message has arrived, and done=false otherwise. On error the partial
+// message is discarded.
+func (r *Reassembler) Feed(frame []byte) (id uint8, msg []byte, done bool, err error) {
+	if len(frame) < headerSize {
+		r.reset()
+		return 0, nil, false, ErrFrameTooShort
+	}
+	flags, fid, seq := frame[0], frame[1], frame[2]
+
+	if flags&FlagFirst != 0 {
+		if len(frame) < firstHeaderSize {
+			r.reset()
+			return 0, nil, false, ErrFrameTooShort
+		}
+		length := int(binary.BigEndian.Uint32(frame[headerSize:]))
+		if length > MaxMessageSize {
+			r.reset()
+			return 0, nil, false, ErrMessageTooLarge
+		}
+		r.active = true
+		r.id = fid
+		r.seq = seq
+		r.length = length
+		r.buf = make([]byte, 0, min(length, 64*1024))
+		frame = frame[firstHeaderSize:]
+	} else {
+		if !r.active {
+			return 0, nil, false, ErrUnexpectedFrame
+		}
+		if fid != r.id || seq != r.seq+1 {
+			r.reset()
+			return 0, nil, false, ErrSequence
+		}
+		r.seq = seq
+		frame = frame[headerSize:]
+	}
+
+	if len(r.buf)+len(frame) > r.length {
+		r.reset()
+		return 0, nil, false, ErrLengthMismatch
+	}
+	r.buf = append(r.buf, frame...)
+
+	if flags&FlagLast == 0 {
+		return 0, nil, false, nil
+	}
+
+	id, msg = r.id, r.buf
+	complete := len(msg) == r.length
+	r.reset()
+	if !complete {
+		return 0, nil, false, ErrLengthMismatch
+	}
+	return id, msg, true, nil
+}
+
+func (r *Reassembler) reset() {
+	r.active = false
+	r.buf = nil
+	r.length = 0
+}
@@ -0,0 +1,132 @@
+package ble
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadSize(t *testing.T) {
+	assert.Equal(t, 20, PayloadSize(DefaultMTU))
+	assert.Equal(t, 20, PayloadSize(0))
+	assert.Equal(t, 514, PayloadSize(517))
+}
+
+func TestFragment_RoundTrip(t *testing.T) {
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	for _, mtu := range []int{23, 64, 185, 247, 517} {
+		frameSize := PayloadSize(mtu)
+		frames, err := Fragment(42, msg, frameSize)
+		require.NoError(t, err)
+
+		var r Reassembler
+		for i, f := range frames {
+			assert.LessOrEqual(t, len(f), frameSize)
+			assert.Equal(t, i == 0, f[0]&FlagFirst != 0)
+			assert.Equal(t, i == len(frames)-1, f[0]&FlagLast != 0)
+
+			id, got, done, err := r.Feed(f)
+			require.NoError(t, err)
+			if i < len(frames)-1 {
+				assert.False(t, done)
+				continue
+			}
+			require.True(t, done)
+			assert.Equal(t, uint8(42), id)
+			assert.Equal(t, msg, got)
+		}
+	}
+}
+
+func TestFragment_EmptyMessage(t *testing.T) {
+	frames, err := Fragment(1, nil, 20)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, FlagFirst|FlagLast, frames[0][0])
+
+	var r Reassembler
+	id, msg, done, err := r.Feed(frames[0])
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, uint8(1), id)
+	assert.Empty(t, msg)
+}
+
+func TestFragment_Errors(t *testing.T) {
+	_, err := Fragment(0, []byte("x"), firstHeaderSize)
+	assert.Error(t, err)
+
+	_, err = Fragment(0, make([]byte, MaxMessageSize+1), 512)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func TestReassembler_Errors(t *testing.T) {
+	frames, err := Fragment(7, bytes.Repeat([]byte("x"), 100), 20)
+	require.NoError(t, err)
+	require.Greater(t, len(frames), 3)
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   error
+	}{
+		{"too short", [][]byte{{FlagFirst, 0}}, ErrFrameTooShort},
+		{"first frame without length", [][]byte{{FlagFirst, 0, 0, 0}}, ErrFrameTooShort},
+		{"continuation without first", [][]byte{frames[1]}, ErrUnexpectedFrame},
+		{"sequence gap", [][]byte{frames[0], frames[2]}, ErrSequence},
+		{"message too large", [][]byte{{FlagFirst, 0, 0, 0x7f, 0xff, 0xff, 0xff}}, ErrMessageTooLarge},
+		{"length exceeded", [][]byte{{FlagFirst, 0, 0, 0, 0, 0, 1, 'a', 'b'}}, ErrLengthMismatch},
+		{"length short", [][]byte{{FlagFirst | FlagLast, 0, 0, 0, 0, 0, 3, 'a'}}, ErrLengthMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Reassembler
+			var err error
+			for _, f := range tt.frames {
+				_, _, _, err = r.Feed(f)
+			}
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestReassembler_NewFirstFrameDiscardsPartial(t *testing.T) {
+	a, err := Fragment(1, bytes.Repeat([]byte("a"), 50), 20)
+	require.NoError(t, err)
+	b, err := Fragment(2, []byte("b"), 20)
+	require.NoError(t, err)
+
+	var r Reassembler
+	_, _, done, err := r.Feed(a[0])
+	require.NoError(t, err)
+	require.False(t, done)
+
+	id, msg, done, err := r.Feed(b[0])
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, uint8(2), id)
+	assert.Equal(t, []byte("b"), msg)
+}
+
+func TestReassembler_SequenceWraps(t *testing.T) {
+	// 300 frames wrap the 8-bit sequence number
+	msg := bytes.Repeat([]byte("z"), 13+299*17)
+	frames, err := Fragment(3, msg, 20)
+	require.NoError(t, err)
+	require.Len(t, frames, 300)
+
+	var r Reassembler
+	for _, f := range frames[:len(frames)-1] {
+		_, _, done, err := r.Feed(f)
+		require.NoError(t, err)
+		require.False(t, done)
+	}
+	_, got, done, err := r.Feed(frames[len(frames)-1])
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, msg, got)
+}
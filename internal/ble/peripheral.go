@@ -0,0 +1,469 @@
+package ble
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+)
+
+// GATT UUIDs. The service and the first four characteristics match the
+// discovery service advertised by ble-advertise.sh and the mobile app.
+const (
+	ServiceUUID         = "BBBBBBBB-BBBB-BBBB-BBBB-BBBBBBBBBBBB"
+	DeviceNameCharUUID  = "00000001-BBBB-BBBB-BBBB-BBBBBBBBBBBB"
+	AddressCharUUID     = "00000002-BBBB-BBBB-BBBB-BBBBBBBBBBBB"
+	PortCharUUID        = "00000003-BBBB-BBBB-BBBB-BBBBBBBBBBBB"
+	FingerprintCharUUID = "00000004-BBBB-BBBB-BBBB-BBBBBBBBBBBB"
+	RequestCharUUID     = "00000005-BBBB-BBBB-BBBB-BBBBBBBBBBBB"
+	ResponseCharUUID    = "00000006-BBBB-BBBB-BBBB-BBBBBBBBBBBB"
+)
+
+// BlueZ D-Bus names.
+const (
+	bluezService         = "org.bluez"
+	adapterInterface     = "org.bluez.Adapter1"
+	deviceInterface      = "org.bluez.Device1"
+	gattManagerInterface = "org.bluez.GattManager1"
+	advManagerInterface  = "org.bluez.LEAdvertisingManager1"
+	gattServiceInterface = "org.bluez.GattService1"
+	gattCharInterface    = "org.bluez.GattCharacteristic1"
+	advInterface         = "org.bluez.LEAdvertisement1"
+	objectManagerIface   = "org.freedesktop.DBus.ObjectManager"
+)
+
+// Exported object paths.
+const (
+	appPath     = dbus.ObjectPath("/org/boardingpass/gatt")
+	servicePath = appPath + "/service0"
+	advPath     = dbus.ObjectPath("/org/boardingpass/advertisement0")
+)
+
+// Info is the static device information served by the discovery characteristics.
+type Info struct {
+	DeviceName  string
+	Address     string
+	Port        int
+	Fingerprint string
+}
+
+// characteristic is a GATT characteristic exported by the peripheral.
+type characteristic struct {
+	path  dbus.ObjectPath
+	uuid  string
+	flags []string
+	value []byte // static value of read-only characteristics
+}
+
+// deviceMatch routes changes of BlueZ device properties, such as Connected,
+// to the peripheral.
+const deviceMatch = "type='signal',sender='" + bluezService + "',interface='" + dbus.PropertiesInterface +
+	"',member='PropertiesChanged',arg0='" + deviceInterface + "'"
+
+// Peripheral registers the BoardingPass GATT service and LE advertisement
+// with BlueZ and serves API requests written by a connected central.
+// Notifications reach every subscribed central, so it serves one central at a
+// time; others are turned away until it disconnects or unsubscribes.
+type Peripheral struct {
+	conn    *dbus.Conn
+	adapter dbus.ObjectPath
+	info    Info
+	handler http.Handler
+	logger  *logging.Logger
+	chars   []characteristic
+
+	mu         sync.Mutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	signals    chan *dbus.Message
+	central    dbus.ObjectPath // device path of the central being served
+	server     *Server
+	stopServer context.CancelFunc
+	notifying  bool
+	value      []byte
+}
+
+// NewPeripheral creates a peripheral on the given adapter (e.g. "hci0").
+func NewPeripheral(conn *dbus.Conn, adapter string, info Info, handler http.Handler, logger *logging.Logger) *Peripheral {
+	p := &Peripheral{
+		conn:    conn,
+		adapter: dbus.ObjectPath("/org/bluez/" + adapter),
+		info:    info,
+		handler: handler,
+		logger:  logger,
+	}
+
+	// API traffic is not wrapped in TLS, so BlueZ must only pass it over an
+	// encrypted link; centrals pair on first access.
+	read := []string{"read"}
+	p.chars = []characteristic{
+		{uuid: DeviceNameCharUUID, flags: read, value: []byte(info.DeviceName)},
+		{uuid: AddressCharUUID, flags: read, value: []byte(info.Address)},
+		{uuid: PortCharUUID, flags: read, value: []byte(strconv.Itoa(info.Port))},
+		{uuid: FingerprintCharUUID, flags: read, value: []byte(info.Fingerprint)},
+		{uuid: RequestCharUUID, flags: []string{"encrypt-write", "write-without-response"}},
+		{uuid: ResponseCharUUID, flags: []string{"encrypt-read", "notify"}},
+	}
+	for i := range p.chars {
+		p.chars[i].path = dbus.ObjectPath(fmt.Sprintf("%s/char%d", servicePath, i))
+	}
+
+	return p
+}
+
+// Start exports the GATT application and advertisement and registers them with BlueZ.
+func (p *Peripheral) Start(ctx context.Context) error {
+	p.mu.Lock()
+	p.ctx, p.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	p.signals = make(chan *dbus.Message, 16)
+	watchCtx, signals := p.ctx, p.signals
+	p.mu.Unlock()
+
+	p.export()
+
+	// Without disconnect signals, a central is released when it unsubscribes
+	if err := p.conn.AddMatch(ctx, deviceMatch); err != nil {
+		p.logger.Warn("failed to watch BLE device connections", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	p.conn.Signal(signals)
+	go p.watchDevices(watchCtx, signals)
+
+	if err := p.conn.SetProperty(ctx, bluezService, p.adapter, adapterInterface, "Powered", true); err != nil {
+		p.unexport()
+		return fmt.Errorf("failed to power on adapter %s: %w", path.Base(string(p.adapter)), err)
+	}
+
+	if _, err := p.conn.Call(ctx, bluezService, p.adapter, gattManagerInterface, "RegisterApplication",
+		appPath, map[string]any{}); err != nil {
+		p.unexport()
+		return fmt.Errorf("failed to register GATT application: %w", err)
+	}
+
+	if _, err := p.conn.Call(ctx, bluezService, p.adapter, advManagerInterface, "RegisterAdvertisement",
+		advPath, map[string]any{}); err != nil {
+		_, _ = p.conn.Call(ctx, bluezService, p.adapter, gattManagerInterface, "UnregisterApplication", appPath)
+		p.unexport()
+		return fmt.Errorf("failed to register LE advertisement: %w", err)
+	}
+
+	return nil
+}
+
+// Stop unregisters the advertisement and GATT application and stops serving requests.
+func (p *Peripheral) Stop(ctx context.Context) error {
+	var errs []string
+	if _, err := p.conn.Call(ctx, bluezService, p.adapter, advManagerInterface, "UnregisterAdvertisement", advPath); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := p.conn.Call(ctx, bluezService, p.adapter, gattManagerInterface, "UnregisterApplication", appPath); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	p.mu.Lock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.signals != nil {
+		p.conn.RemoveSignal(p.signals)
+	}
+	p.central, p.server, p.stopServer = "", nil, nil
+	p.notifying = false
+	p.mu.Unlock()
+
+	p.unexport()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to unregister from BlueZ: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (p *Peripheral) export() {
+	p.conn.Export(appPath, objectManagerIface, map[string]dbus.Method{
+		"GetManagedObjects": func(*dbus.Message) ([]any, error) {
+			return []any{p.managedObjects()}, nil
+		},
+	})
+
+	p.conn.ExportProperties(servicePath, func() map[string]map[string]any {
+		return p.managedObjects()[servicePath]
+	})
+
+	for _, c := range p.chars {
+		p.conn.ExportProperties(c.path, func() map[string]map[string]any {
+			return p.managedObjects()[c.path]
+		})
+		p.conn.Export(c.path, gattCharInterface, p.characteristicMethods(c))
+	}
+
+	p.conn.ExportProperties(advPath, func() map[string]map[string]any {
+		return map[string]map[string]any{advInterface: p.advertisementProperties()}
+	})
+	p.conn.Export(advPath, advInterface, map[string]dbus.Method{
+		"Release": func(*dbus.Message) ([]any, error) {
+			p.logger.Info("BLE advertisement released by BlueZ")
+			return nil, nil
+		},
+	})
+}
+
+func (p *Peripheral) unexport() {
+	p.conn.Unexport(appPath)
+	p.conn.Unexport(servicePath)
+	for _, c := range p.chars {
+		p.conn.Unexport(c.path)
+	}
+	p.conn.Unexport(advPath)
+}
+
+// managedObjects describes the GATT application in the form BlueZ expects
+// from ObjectManager.GetManagedObjects.
+func (p *Peripheral) managedObjects() map[dbus.ObjectPath]map[string]map[string]any {
+	charPaths := make([]dbus.ObjectPath, 0, len(p.chars))
+	for _, c := range p.chars {
+		charPaths = append(charPaths, c.path)
+	}
+
+	objects := map[dbus.ObjectPath]map[string]map[string]any{
+		servicePath: {
+			gattServiceInterface: {
+				"UUID":            ServiceUUID,
+				"Primary":         true,
+				"Characteristics": charPaths,
+			},
+		},
+	}
+
+	p.mu.Lock()
+	notifying := p.notifying
+	p.mu.Unlock()
+
+	for _, c := range p.chars {
+		props := map[string]any{
+			"UUID":    c.uuid,
+			"Service": servicePath,
+			"Flags":   c.flags,
+		}
+		switch c.uuid {
+		case ResponseCharUUID:
+			props["Notifying"] = notifying
+		case RequestCharUUID:
+			// write-only
+		default:
+			props["Value"] = c.value
+		}
+		objects[c.path] = map[string]map[string]any{gattCharInterface: props}
+	}
+
+	return objects
+}
+
+func (p *Peripheral) advertisementProperties() map[string]any {
+	return map[string]any{
+		"Type":         "peripheral",
+		"ServiceUUIDs": []string{ServiceUUID},
+		"LocalName":    p.info.DeviceName,
+	}
+}
+
+func (p *Peripheral) characteristicMethods(c characteristic) map[string]dbus.Method {
+	switch c.uuid {
+	case RequestCharUUID:
+		return map[string]dbus.Method{
+			"WriteValue": p.writeRequest,
+		}
+	case ResponseCharUUID:
+		return map[string]dbus.Method{
+			"ReadValue": func(call *dbus.Message) ([]any, error) {
+				p.mu.Lock()
+				defer p.mu.Unlock()
+				return []any{readAt(p.value, call)}, nil
+			},
+			"StartNotify": func(*dbus.Message) ([]any, error) {
+				p.setNotifying(true)
+				return nil, nil
+			},
+			"StopNotify": func(*dbus.Message) ([]any, error) {
+				p.setNotifying(false)
+				return nil, nil
+			},
+		}
+	default:
+		return map[string]dbus.Method{
+			"ReadValue": func(call *dbus.Message) ([]any, error) {
+				return []any{readAt(c.value, call)}, nil
+			},
+		}
+	}
+}
+
+// writeRequest handles a request frame written by a central.
+func (p *Peripheral) writeRequest(call *dbus.Message) ([]any, error) {
+	if len(call.Body) != 2 {
+		return nil, &dbus.Error{Name: "org.bluez.Error.InvalidArguments", Message: "expected value and options"}
+	}
+	frame, ok := call.Body[0].([]byte)
+	if !ok {
+		return nil, &dbus.Error{Name: "org.bluez.Error.InvalidArguments", Message: "value must be a byte array"}
+	}
+	opts, _ := call.Body[1].(map[string]any)
+
+	if offset, _ := option[uint16](opts, "offset"); offset != 0 {
+		return nil, &dbus.Error{Name: "org.bluez.Error.InvalidOffset", Message: "frames must be written in one operation"}
+	}
+	device, _ := option[dbus.ObjectPath](opts, "device")
+
+	server, err := p.serverFor(device)
+	if err != nil {
+		p.logger.Warn("BLE central rejected", map[string]any{
+			"device": string(device),
+			"error":  err.Error(),
+		})
+		return nil, &dbus.Error{Name: "org.bluez.Error.NotPermitted", Message: err.Error()}
+	}
+	if mtu, ok := option[uint16](opts, "mtu"); ok {
+		server.SetMTU(int(mtu))
+	}
+
+	if err := server.Receive(frame); err != nil {
+		p.logger.Warn("invalid BLE request frame", map[string]any{
+			"device": string(device),
+			"error":  err.Error(),
+		})
+		return nil, &dbus.Error{Name: "org.bluez.Error.Failed", Message: err.Error()}
+	}
+	return nil, nil
+}
+
+// serverFor returns the request server for a central, creating it on first
+// use. It fails while another central is being served.
+func (p *Peripheral) serverFor(device dbus.ObjectPath) (*Server, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.server != nil {
+		if device != p.central {
+			return nil, fmt.Errorf("another central is connected")
+		}
+		return p.server, nil
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.central, p.stopServer = device, cancel
+	p.server = NewServer(p.handler, p.notify, remoteAddr(device), p.logger)
+	go p.server.Serve(ctx)
+
+	p.logger.Info("BLE central connected", map[string]any{
+		"device": string(device),
+	})
+	return p.server, nil
+}
+
+// release stops serving the central with the given device path, so that
+// another central can connect.
+func (p *Peripheral) release(device dbus.ObjectPath) {
+	p.mu.Lock()
+	if p.server == nil || device != p.central {
+		p.mu.Unlock()
+		return
+	}
+	p.stopServer()
+	p.central, p.server, p.stopServer = "", nil, nil
+	p.mu.Unlock()
+
+	p.logger.Info("BLE central disconnected", map[string]any{
+		"device": string(device),
+	})
+}
+
+// watchDevices releases the served central when BlueZ reports that it
+// disconnected, until ctx is cancelled.
+func (p *Peripheral) watchDevices(ctx context.Context, signals <-chan *dbus.Message) {
+	for {
+		select {
+		case msg := <-signals:
+			if msg.Member != "PropertiesChanged" || len(msg.Body) < 2 || msg.Body[0] != deviceInterface {
+				continue
+			}
+			changed, _ := msg.Body[1].(map[string]any)
+			if v, ok := changed["Connected"].(dbus.Variant); ok && v.Value == false {
+				p.release(msg.Path)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notify sends a response frame as a notification on the response characteristic.
+// BlueZ delivers notifications to every subscribed central, which is why
+// only one central is served at a time.
+func (p *Peripheral) notify(frame []byte) error {
+	p.mu.Lock()
+	if !p.notifying {
+		p.mu.Unlock()
+		return fmt.Errorf("no central subscribed to responses")
+	}
+	p.value = frame
+	p.mu.Unlock()
+
+	return p.conn.EmitPropertiesChanged(p.chars[len(p.chars)-1].path, gattCharInterface,
+		map[string]any{"Value": frame})
+}
+
+// setNotifying records whether any central is subscribed to responses.
+// Once none is, the served central is released.
+func (p *Peripheral) setNotifying(on bool) {
+	p.mu.Lock()
+	p.notifying = on
+	central := p.central
+	p.mu.Unlock()
+
+	if !on {
+		p.release(central)
+	}
+}
+
+// readAt returns value from the offset requested in a ReadValue call.
+func readAt(value []byte, call *dbus.Message) []byte {
+	if len(call.Body) == 1 {
+		opts, _ := call.Body[0].(map[string]any)
+		if offset, ok := option[uint16](opts, "offset"); ok {
+			if int(offset) >= len(value) {
+				return []byte{}
+			}
+			return value[offset:]
+		}
+	}
+	return value
+}
+
+// option extracts a typed value from a BlueZ a{sv} options dictionary.
+func option[T any](opts map[string]any, key string) (T, bool) {
+	var zero T
+	v, ok := opts[key].(dbus.Variant)
+	if !ok {
+		return zero, false
+	}
+	t, ok := v.Value.(T)
+	return t, ok
+}
+
+// remoteAddr derives a stable client identifier from a BlueZ device path
+// (/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF), used for logging and rate limiting.
+func remoteAddr(device dbus.ObjectPath) string {
+	base := path.Base(string(device))
+	mac, ok := strings.CutPrefix(base, "dev_")
+	if !ok {
+		return "[ble]:0"
+	}
+	return "[" + strings.ReplaceAll(mac, "_", ":") + "]:0"
+}
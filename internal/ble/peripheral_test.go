@@ -0,0 +1,271 @@
+package ble_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/ble"
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/internal/dbus/dbustest"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAdapter = dbus.ObjectPath("/org/bluez/hci0")
+	testDevice  = dbus.ObjectPath("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF")
+)
+
+// fakeBlueZ implements the parts of the BlueZ adapter API used by the peripheral.
+type fakeBlueZ struct {
+	conn *dbus.Conn
+
+	mu           sync.Mutex
+	powered      bool
+	appOwner     string
+	app          dbus.ObjectPath
+	objects      map[dbus.ObjectPath]any
+	adv          map[string]any
+	unregistered []string
+}
+
+func newFakeBlueZ(t *testing.T, bus *dbustest.Bus) *fakeBlueZ {
+	t.Helper()
+	f := &fakeBlueZ{conn: bus.Dial(t)}
+	require.NoError(t, f.conn.RequestName(context.Background(), "org.bluez"))
+
+	f.conn.Export(testAdapter, dbus.PropertiesInterface, map[string]dbus.Method{
+		"Set": func(call *dbus.Message) ([]any, error) {
+			if call.Body[1] == "Powered" {
+				f.mu.Lock()
+				f.powered, _ = call.Body[2].(dbus.Variant).Value.(bool)
+				f.mu.Unlock()
+			}
+			return nil, nil
+		},
+	})
+	f.conn.Export(testAdapter, "org.bluez.GattManager1", map[string]dbus.Method{
+		"RegisterApplication": func(call *dbus.Message) ([]any, error) {
+			app := call.Body[0].(dbus.ObjectPath)
+			reply, err := f.conn.Call(context.Background(), call.Sender, app,
+				"org.freedesktop.DBus.ObjectManager", "GetManagedObjects")
+			if err != nil {
+				return nil, err
+			}
+			objects, _ := reply[0].(map[dbus.ObjectPath]any)
+			f.mu.Lock()
+			f.appOwner, f.app, f.objects = call.Sender, app, objects
+			f.mu.Unlock()
+			return nil, nil
+		},
+		"UnregisterApplication": func(*dbus.Message) ([]any, error) {
+			f.mu.Lock()
+			f.unregistered = append(f.unregistered, "application")
+			f.mu.Unlock()
+			return nil, nil
+		},
+	})
+	f.conn.Export(testAdapter, "org.bluez.LEAdvertisingManager1", map[string]dbus.Method{
+		"RegisterAdvertisement": func(call *dbus.Message) ([]any, error) {
+			props, err := f.conn.GetAllProperties(context.Background(), call.Sender,
+				call.Body[0].(dbus.ObjectPath), "org.bluez.LEAdvertisement1")
+			if err != nil {
+				return nil, err
+			}
+			f.mu.Lock()
+			f.adv = props
+			f.mu.Unlock()
+			return nil, nil
+		},
+		"UnregisterAdvertisement": func(*dbus.Message) ([]any, error) {
+			f.mu.Lock()
+			f.unregistered = append(f.unregistered, "advertisement")
+			f.mu.Unlock()
+			return nil, nil
+		},
+	})
+	return f
+}
+
+// characteristic returns the object path of the characteristic with the given UUID.
+func (f *fakeBlueZ) characteristic(t *testing.T, uuid string) dbus.ObjectPath {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for path, ifaces := range f.objects {
+		props, _ := ifaces.(map[string]any)["org.bluez.GattCharacteristic1"].(map[string]any)
+		if v, ok := props["UUID"].(dbus.Variant); ok && v.Value == uuid {
+			return path
+		}
+	}
+	t.Fatalf("characteristic %s not registered", uuid)
+	return ""
+}
+
+func TestPeripheral_ServesRequests(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	bluez := newFakeBlueZ(t, bus)
+	conn := bus.Dial(t)
+	ctx := context.Background()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+		_, _ = io.WriteString(w, "pong "+r.URL.Path)
+	})
+	info := ble.Info{DeviceName: "BoardingPass-test", Port: 8443, Fingerprint: "SHA256:abc"}
+	p := ble.NewPeripheral(conn, "hci0", info, handler, logging.New(logging.LevelError, logging.FormatJSON))
+	require.NoError(t, p.Start(ctx))
+
+	bluez.mu.Lock()
+	assert.True(t, bluez.powered)
+	assert.Equal(t, "peripheral", bluez.adv["Type"])
+	assert.Equal(t, []string{ble.ServiceUUID}, bluez.adv["ServiceUUIDs"])
+	assert.Equal(t, "BoardingPass-test", bluez.adv["LocalName"])
+	owner := bluez.appOwner
+	bluez.mu.Unlock()
+
+	// Discovery characteristics
+	value, err := bluez.conn.Call(ctx, owner, bluez.characteristic(t, ble.PortCharUUID),
+		"org.bluez.GattCharacteristic1", "ReadValue", map[string]any{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("8443"), value[0])
+
+	value, err = bluez.conn.Call(ctx, owner, bluez.characteristic(t, ble.FingerprintCharUUID),
+		"org.bluez.GattCharacteristic1", "ReadValue", map[string]any{"offset": dbus.MakeVariant(uint16(7))})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abc"), value[0])
+
+	// Subscribe to responses and forward notifications to a client
+	respPath := bluez.characteristic(t, ble.ResponseCharUUID)
+	reqPath := bluez.characteristic(t, ble.RequestCharUUID)
+	_, err = bluez.conn.Call(ctx, owner, respPath, "org.bluez.GattCharacteristic1", "StartNotify")
+	require.NoError(t, err)
+
+	signals := make(chan *dbus.Message, 64)
+	bluez.conn.Signal(signals)
+
+	const mtu = 64
+	client := ble.NewClient(func(frame []byte) error {
+		_, err := bluez.conn.Call(ctx, owner, reqPath, "org.bluez.GattCharacteristic1", "WriteValue",
+			frame, map[string]any{
+				"device": dbus.MakeVariant(testDevice),
+				"mtu":    dbus.MakeVariant(uint16(mtu)),
+			})
+		return err
+	}, mtu)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case msg := <-signals:
+				if msg.Path != respPath || msg.Member != "PropertiesChanged" {
+					continue
+				}
+				changed, _ := msg.Body[1].(map[string]any)
+				if v, ok := changed["Value"].(dbus.Variant); ok {
+					_ = client.Receive(v.Value.([]byte))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	httpClient := &http.Client{Transport: client, Timeout: 10 * time.Second}
+	resp, err := httpClient.Get("http://ble/" + strings.Repeat("x", 200))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "pong /"+strings.Repeat("x", 200), string(body))
+	assert.Equal(t, "[AA:BB:CC:DD:EE:FF]:0", resp.Header.Get("X-Remote-Addr"))
+
+	require.NoError(t, p.Stop(ctx))
+	bluez.mu.Lock()
+	assert.ElementsMatch(t, []string{"advertisement", "application"}, bluez.unregistered)
+	bluez.mu.Unlock()
+}
+
+func TestPeripheral_RejectsInvalidWrites(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	bluez := newFakeBlueZ(t, bus)
+	conn := bus.Dial(t)
+	ctx := context.Background()
+
+	p := ble.NewPeripheral(conn, "hci0", ble.Info{DeviceName: "bp"}, http.NotFoundHandler(),
+		logging.New(logging.LevelError, logging.FormatJSON))
+	require.NoError(t, p.Start(ctx))
+	t.Cleanup(func() { _ = p.Stop(ctx) })
+
+	reqPath := bluez.characteristic(t, ble.RequestCharUUID)
+	bluez.mu.Lock()
+	owner := bluez.appOwner
+	bluez.mu.Unlock()
+
+	_, err := bluez.conn.Call(ctx, owner, reqPath, "org.bluez.GattCharacteristic1", "WriteValue",
+		[]byte{0x00, 0x01, 0x01}, map[string]any{"device": dbus.MakeVariant(testDevice)})
+	var dbusErr *dbus.Error
+	require.ErrorAs(t, err, &dbusErr)
+	assert.Equal(t, "org.bluez.Error.Failed", dbusErr.Name)
+
+	_, err = bluez.conn.Call(ctx, owner, reqPath, "org.bluez.GattCharacteristic1", "WriteValue",
+		[]byte{0x00}, map[string]any{"offset": dbus.MakeVariant(uint16(4))})
+	require.ErrorAs(t, err, &dbusErr)
+	assert.Equal(t, "org.bluez.Error.InvalidOffset", dbusErr.Name)
+}
+
+func TestPeripheral_ServesOneCentralAtATime(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	bluez := newFakeBlueZ(t, bus)
+	conn := bus.Dial(t)
+	ctx := context.Background()
+
+	p := ble.NewPeripheral(conn, "hci0", ble.Info{DeviceName: "bp"}, http.NotFoundHandler(),
+		logging.New(logging.LevelError, logging.FormatJSON))
+	require.NoError(t, p.Start(ctx))
+	t.Cleanup(func() { _ = p.Stop(ctx) })
+
+	reqPath := bluez.characteristic(t, ble.RequestCharUUID)
+	bluez.mu.Lock()
+	owner := bluez.appOwner
+	props := bluez.objects[reqPath].(map[string]any)["org.bluez.GattCharacteristic1"].(map[string]any)
+	bluez.mu.Unlock()
+	assert.Contains(t, props["Flags"].(dbus.Variant).Value, "encrypt-write")
+
+	// A frame that starts a request without completing it
+	frame := []byte{0x80, 0x01, 0x00, 0x00, 0x00, 0x00, 0x10}
+	write := func(device dbus.ObjectPath) error {
+		_, err := bluez.conn.Call(ctx, owner, reqPath, "org.bluez.GattCharacteristic1", "WriteValue",
+			frame, map[string]any{"device": dbus.MakeVariant(device)})
+		return err
+	}
+	other := dbus.ObjectPath("/org/bluez/hci0/dev_11_22_33_44_55_66")
+
+	require.NoError(t, write(testDevice))
+	var dbusErr *dbus.Error
+	require.ErrorAs(t, write(other), &dbusErr)
+	assert.Equal(t, "org.bluez.Error.NotPermitted", dbusErr.Name)
+
+	// Once the first central disconnects, the other one is served
+	require.NoError(t, bluez.conn.EmitPropertiesChanged(testDevice, "org.bluez.Device1",
+		map[string]any{"Connected": false}))
+	assert.Eventually(t, func() bool { return write(other) == nil }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPeripheral_StartFailsWithoutBlueZ(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	conn := bus.Dial(t)
+
+	p := ble.NewPeripheral(conn, "hci0", ble.Info{}, http.NotFoundHandler(),
+		logging.New(logging.LevelError, logging.FormatJSON))
+	err := p.Start(context.Background())
+	assert.ErrorContains(t, err, "failed to power on adapter hci0")
+}
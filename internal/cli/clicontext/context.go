@@ -8,6 +8,18 @@ type Global struct {
 	// AssumeYes automatically answers 'yes' to all prompts (non-interactive mode).
 	// This is particularly useful for CI/CD pipelines and automated scripts.
 	AssumeYes bool
+
+	// Serial is the serial device to reach the service through instead of
+	// the network, e.g. /dev/ttyUSB0.
+	Serial string
+
+	// Relay is the rendezvous server URL to reach the device through, e.g.
+	// wss://relay.example.com:9457/devices/SN1234.
+	Relay string
+
+	// Context is the named context selected with --context, overriding the
+	// current one.
+	Context string
 }
 
 var (
@@ -42,3 +54,45 @@ func SetAssumeYes(value bool) {
 	defer mu.Unlock()
 	globalContext.AssumeYes = value
 }
+
+// Serial returns the serial device selected with --serial, if any.
+func Serial() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return globalContext.Serial
+}
+
+// SetSerial sets the serial device.
+func SetSerial(device string) {
+	mu.Lock()
+	defer mu.Unlock()
+	globalContext.Serial = device
+}
+
+// Relay returns the relay URL selected with --relay, if any.
+func Relay() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return globalContext.Relay
+}
+
+// SetRelay sets the relay URL.
+func SetRelay(relayURL string) {
+	mu.Lock()
+	defer mu.Unlock()
+	globalContext.Relay = relayURL
+}
+
+// Context returns the context name selected with --context, if any.
+func Context() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return globalContext.Context
+}
+
+// SetContext sets the context name.
+func SetContext(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	globalContext.Context = name
+}
@@ -9,6 +9,8 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,11 +19,17 @@ import (
 )
 
 const (
-	defaultTimeout  = 30 * time.Second
-	contentTypeJSON = "application/json"
-	maxRetries      = 3
-	initialBackoff  = 500 * time.Millisecond
-	maxBackoff      = 5 * time.Second
+	defaultTimeout = 30 * time.Second
+	// defaultCommandTimeout is the service's default command timeout, used
+	// if the device does not report a command's timeout
+	defaultCommandTimeout = 5 * time.Minute
+	// commandResponseGrace is the time allowed beyond a command's timeout
+	// for receiving its response
+	commandResponseGrace = 30 * time.Second
+	contentTypeJSON      = "application/json"
+	maxRetries           = 3
+	initialBackoff       = 500 * time.Millisecond
+	maxBackoff           = 5 * time.Second
 )
 
 // Client is an HTTP client for the BoardingPass API.
@@ -29,6 +37,9 @@ type Client struct {
 	baseURL      string
 	httpClient   *http.Client
 	sessionToken string
+
+	mu              sync.Mutex
+	commandTimeouts map[string]time.Duration // by command ID, fetched once
 }
 
 // NewClient creates a new BoardingPass API client.
@@ -39,6 +50,21 @@ func NewClient(cfg *config.Config) (*Client, error) {
 		return nil, fmt.Errorf("failed to create transport: %w", err)
 	}
 
+	if cfg.Serial != "" {
+		dialer, err := NewSerialDialer(cfg.Serial, cfg.BaudRate)
+		if err != nil {
+			return nil, err
+		}
+		transport.base.DialContext = dialer.DialContext
+	}
+	if cfg.Relay != "" {
+		dialer, err := NewRelayDialer(cfg.Relay, cfg.RelayCACert)
+		if err != nil {
+			return nil, err
+		}
+		transport.base.DialContext = dialer.DialContext
+	}
+
 	httpClient := &http.Client{
 		Transport: transport,
 		Timeout:   defaultTimeout,
@@ -112,8 +138,18 @@ func (c *Client) GetNetwork() (*protocol.NetworkConfig, error) {
 	return &network, nil
 }
 
+// ListCommands retrieves the allow-listed commands from the device.
+func (c *Client) ListCommands() (*protocol.CommandList, error) {
+	var list protocol.CommandList
+	if err := c.get("/commands", &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
 // ExecuteCommand executes an allow-listed command on the device.
 // Optional params are appended after a -- separator on the server side.
+// The request waits for as long as the command may run on the device.
 func (c *Client) ExecuteCommand(commandID string, params []string) (*protocol.CommandResponse, error) {
 	req := protocol.CommandRequest{
 		ID:     commandID,
@@ -121,12 +157,113 @@ func (c *Client) ExecuteCommand(commandID string, params []string) (*protocol.Co
 	}
 
 	var resp protocol.CommandResponse
-	if err := c.post("/command", req, &resp); err != nil {
+	timeout := c.commandTimeout(commandID) + commandResponseGrace
+	if err := c.withTimeout(timeout).post("/command", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// commandTimeout returns the timeout of a command on the device, or the
+// service's default if the device does not report it.
+func (c *Client) commandTimeout(commandID string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.commandTimeouts == nil {
+		c.commandTimeouts = make(map[string]time.Duration)
+		if list, err := c.ListCommands(); err == nil {
+			for _, cmd := range list.Commands {
+				if timeout, err := time.ParseDuration(cmd.Timeout); err == nil {
+					c.commandTimeouts[cmd.ID] = timeout
+				}
+			}
+		}
+	}
+	if timeout, ok := c.commandTimeouts[commandID]; ok {
+		return timeout
+	}
+	return defaultCommandTimeout
+}
+
+// withTimeout returns a client for a single request that times out after d
+// rather than the default timeout.
+func (c *Client) withTimeout(d time.Duration) *Client {
+	httpClient := *c.httpClient
+	httpClient.Timeout = d
+	return &Client{
+		baseURL:      c.baseURL,
+		httpClient:   &httpClient,
+		sessionToken: c.sessionToken,
+	}
+}
+
+// Diagnose runs connectivity diagnostics on the device.
+func (c *Client) Diagnose(req *protocol.ConnectivityRequest) (*protocol.ConnectivityResponse, error) {
+	var resp protocol.ConnectivityResponse
+	if err := c.post("/diagnostics/connectivity", req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
+// EnrollFlightControl submits a Flight Control enrollment request from the device.
+func (c *Client) EnrollFlightControl(req *protocol.FlightControlEnrollRequest) (*protocol.EnrollmentStatus, error) {
+	var status protocol.EnrollmentStatus
+	if err := c.post("/enrollment/flightctl", req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetEnrollment retrieves the status of the device's last enrollment.
+func (c *Client) GetEnrollment() (*protocol.EnrollmentStatus, error) {
+	var status protocol.EnrollmentStatus
+	if err := c.get("/enrollment", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListEnrollmentBackends retrieves the enrollment backends of the device and
+// the fields of their enrollment requests.
+func (c *Client) ListEnrollmentBackends() (*protocol.EnrollmentBackendList, error) {
+	var list protocol.EnrollmentBackendList
+	if err := c.get("/enrollment/backends", &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Enroll submits an enrollment request to the named backend of the device.
+func (c *Client) Enroll(backend string, req map[string]any) (*protocol.EnrollmentStatus, error) {
+	var status protocol.EnrollmentStatus
+	if err := c.post("/enrollment/"+url.PathEscape(backend), req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetBackendEnrollment retrieves the status of the last enrollment with the
+// named backend.
+func (c *Client) GetBackendEnrollment(backend string) (*protocol.EnrollmentStatus, error) {
+	var status protocol.EnrollmentStatus
+	if err := c.get("/enrollment/"+url.PathEscape(backend), &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetAudit retrieves the audit log of the device and whether its hash chain
+// is intact.
+func (c *Client) GetAudit() (*protocol.AuditLog, error) {
+	var log protocol.AuditLog
+	if err := c.get("/audit", &log); err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
 // PostConfigure uploads a configuration bundle to the device.
 func (c *Client) PostConfigure(bundle *protocol.ConfigBundle) error {
 	return c.post("/configure", bundle, nil)
@@ -281,9 +418,16 @@ func (c *Client) handleErrorResponse(statusCode int, body []byte) error {
 	var apiError struct {
 		Error   string `json:"error"`
 		Message string `json:"message"`
+		Details string `json:"details"`
 	}
 
 	if err := json.Unmarshal(body, &apiError); err == nil && apiError.Message != "" {
+		if apiError.Details != "" {
+			apiError.Message += ": " + apiError.Details
+		}
+		if statusCode == http.StatusUnauthorized {
+			return &AuthError{Message: fmt.Sprintf("%s (HTTP %d)", apiError.Message, statusCode)}
+		}
 		return fmt.Errorf("%s (HTTP %d)", apiError.Message, statusCode)
 	}
 
@@ -315,6 +459,6 @@ func (e *AuthError) Error() string {
 
 // IsAuthError checks if an error is an authentication error.
 func IsAuthError(err error) bool {
-	_, ok := err.(*AuthError)
-	return ok
+	var authErr *AuthError
+	return errors.As(err, &authErr)
 }
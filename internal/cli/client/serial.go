@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/mux"
+	"github.com/fzdarsky/boardingpass/internal/serial"
+)
+
+// serialProbeTimeout bounds the initial check that the service answers on the line.
+const serialProbeTimeout = 5 * time.Second
+
+// SerialDialer opens connections to the service as streams multiplexed over
+// a serial line. TLS runs inside each stream, exactly as over TCP.
+type SerialDialer struct {
+	session *mux.Session
+}
+
+// NewSerialDialer opens a serial device and checks that the BoardingPass
+// service answers on it.
+func NewSerialDialer(device string, baud int) (*SerialDialer, error) {
+	port, err := serial.Open(device, baud)
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewSerialDialerFromConn(port, filepath.Base(device))
+
+	ctx, cancel := context.WithTimeout(context.Background(), serialProbeTimeout)
+	defer cancel()
+	if _, err := d.session.Ping(ctx); err != nil {
+		_ = d.Close()
+		return nil, fmt.Errorf("no response from BoardingPass service on %s: %w", device, err)
+	}
+
+	return d, nil
+}
+
+// NewSerialDialerFromConn multiplexes streams over an already open line.
+func NewSerialDialerFromConn(conn io.ReadWriteCloser, name string) *SerialDialer {
+	return &SerialDialer{
+		session: mux.Client(conn, mux.Addr{Net: "serial", Name: name}),
+	}
+}
+
+// DialContext opens a new stream. The network and address are ignored, as
+// the line leads to exactly one service.
+func (d *SerialDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	return d.session.Open(ctx)
+}
+
+// Close closes the serial line.
+func (d *SerialDialer) Close() error {
+	return d.session.Close()
+}
@@ -2,6 +2,8 @@
 package client
 
 import (
+	"fmt"
+
 	"github.com/fzdarsky/boardingpass/pkg/srp"
 )
 
@@ -17,3 +19,51 @@ func NewSRPClient(username, password string) *SRPClient {
 		Client: srp.NewClient(username, password),
 	}
 }
+
+// Authenticate performs SRP-6a authentication and keeps the session token
+// for subsequent requests. It returns the token, so callers can store it.
+func (c *Client) Authenticate(username, password string) (string, error) {
+	// Normalize password to canonical form (lowercase, no separators)
+	// Both client and server must apply the same normalization before SRP
+	srpClient := NewSRPClient(username, srp.NormalizePassword(password))
+	defer srpClient.ClearSecrets()
+
+	// Phase 1: Generate ephemeral keypair and send Init request
+	A, err := srpClient.GenerateEphemeralKeypair()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ephemeral keypair: %w", err)
+	}
+
+	initResp, err := c.SRPInit(username, A)
+	if err != nil {
+		return "", fmt.Errorf("SRP init failed: %w", err)
+	}
+
+	// Set server response (salt and B)
+	if err := srpClient.SetServerResponse(initResp.Salt, initResp.B); err != nil {
+		return "", fmt.Errorf("invalid server response: %w", err)
+	}
+
+	// Compute shared secret and session key
+	if err := srpClient.ComputeSharedSecret(); err != nil {
+		return "", fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	// Phase 2: Compute client proof and send Verify request
+	M1, err := srpClient.ComputeClientProof()
+	if err != nil {
+		return "", fmt.Errorf("failed to compute client proof: %w", err)
+	}
+
+	verifyResp, err := c.SRPVerify(initResp.SessionID, M1)
+	if err != nil {
+		return "", fmt.Errorf("SRP verify failed: %w", err)
+	}
+
+	// Verify server proof
+	if err := srpClient.VerifyServerProof(verifyResp.M2); err != nil {
+		return "", fmt.Errorf("server authentication failed: %w", err)
+	}
+
+	return verifyResp.SessionToken, nil
+}
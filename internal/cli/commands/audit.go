@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/config"
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/cli/session"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// AuditCommand implements the 'audit' command for retrieving the audit log.
+type AuditCommand struct{}
+
+// NewAuditCommand creates a new audit command instance.
+func NewAuditCommand() *AuditCommand {
+	return &AuditCommand{}
+}
+
+// AuditRecords is a list of audit records, rendered as a table by default.
+type AuditRecords []protocol.AuditRecord
+
+// TableHeader implements output.Table.
+func (a AuditRecords) TableHeader() []string {
+	return []string{"SEQ", "TIME", "EVENT", "USER", "TRANSPORT", "RESULT", "DETAILS"}
+}
+
+// TableRows implements output.Table.
+func (a AuditRecords) TableRows() [][]string {
+	rows := make([][]string, 0, len(a))
+	for _, rec := range a {
+		result := "failed"
+		if rec.Success {
+			result = "ok"
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(rec.Seq, 10),
+			rec.Time.Local().Format(time.DateTime),
+			rec.Event,
+			valueOrDash(rec.Username),
+			valueOrDash(rec.Transport),
+			result,
+			valueOrDash(auditDetails(&rec)),
+		})
+	}
+	return rows
+}
+
+// auditDetails summarizes what a record is about.
+func auditDetails(rec *protocol.AuditRecord) string {
+	var details []string
+	switch {
+	case rec.Command != nil:
+		cmd := strings.Join(append([]string{rec.Command.ID}, rec.Command.Params...), " ")
+		if rec.Command.ExitCode != nil {
+			cmd += fmt.Sprintf(" (exit %d)", *rec.Command.ExitCode)
+		}
+		details = append(details, cmd)
+	case len(rec.Files) > 0:
+		paths := make([]string, 0, len(rec.Files))
+		for _, f := range rec.Files {
+			paths = append(paths, f.Path)
+		}
+		details = append(details, strings.Join(paths, ", "))
+	case rec.Reboot:
+		details = append(details, "reboot")
+	}
+	if rec.Message != "" {
+		details = append(details, rec.Message)
+	}
+	return strings.Join(details, ": ")
+}
+
+// Execute runs the audit command with the provided arguments.
+func (c *AuditCommand) Execute(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+
+	// Define flags
+	outputFormat := fs.String("output", "table", "Output format (table, yaml or json)")
+	host := fs.String("host", "", "BoardingPass service hostname or IP")
+	port := fs.Int("port", 0, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding audit [flags]
+
+Show the audit log of the device: every authentication, configuration
+bundle, command and completion, with the user and transport it came from.
+The records form a hash chain, which the device verifies. Requires prior
+authentication via 'boarding pass'.
+
+Exits with status 1 if the hash chain is broken.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Output Formats:
+  table  Aligned columns (default)
+  yaml   YAML format
+  json   JSON format
+
+Examples:
+  # Show the audit log
+  boarding audit --host 192.168.1.100
+
+  # Export the records with their hashes
+  boarding audit --output json > audit.json
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	// Load base configuration
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError("failed to load configuration: %v", err)
+	}
+
+	// Apply command-line flags (highest priority)
+	cfg.ApplyFlags(*host, *port, *caCert)
+
+	// Parse output format
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	log, err := c.audit(cfg, format)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	if !log.Verified {
+		fmt.Fprintf(os.Stderr, "Error: audit log hash chain is broken: %s\n", log.Error)
+		os.Exit(1)
+	}
+}
+
+// audit retrieves the audit log of the device and displays it.
+func (c *AuditCommand) audit(cfg *config.Config, format output.Format) (*protocol.AuditLog, error) {
+	// Create API client
+	apiClient, err := createClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load session token
+	store, err := session.NewStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access session store: %w", err)
+	}
+
+	token, err := store.Load(cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session token: %w", err)
+	}
+
+	if token == "" {
+		return nil, fmt.Errorf("no active session. Run 'boarding pass' to authenticate")
+	}
+
+	apiClient.SetSessionToken(token)
+
+	log, err := apiClient.GetAudit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve audit log: %w", err)
+	}
+
+	// The table shows the records; yaml and json include the verification
+	var data any = log
+	if format == output.FormatTable {
+		data = AuditRecords(log.Records)
+	}
+	formatted, err := output.FormatData(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format output: %w", err)
+	}
+
+	fmt.Print(formatted)
+	return log, nil
+}
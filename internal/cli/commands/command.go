@@ -137,6 +137,10 @@ func (c *CommandCommand) executeCommand(cfg *config.Config, commandID string, pa
 		_, _ = fmt.Fprint(os.Stderr, resp.Stderr)
 	}
 
+	if resp.Truncated {
+		fmt.Fprintf(os.Stderr, "\nWarning: output was truncated by the device\n")
+	}
+
 	// Exit with the command's exit code
 	if resp.ExitCode != 0 {
 		fmt.Fprintf(os.Stderr, "\nCommand exited with code %d\n", resp.ExitCode)
@@ -4,11 +4,17 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/fzdarsky/boardingpass/internal/cli/client"
 	"github.com/fzdarsky/boardingpass/internal/cli/config"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
 )
 
+// serverCertValidDays is the validity of certificates generated for the
+// servers the CLI runs, such as the controller and the relay.
+const serverCertValidDays = 365
+
 // createClient creates a new API client from the configuration.
 // It handles config loading, flag merging, and client initialization.
 func createClient(cfg *config.Config) (*client.Client, error) {
@@ -31,3 +37,26 @@ func exitWithError(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
 	os.Exit(1)
 }
+
+// selfSignedCertificate returns the self-signed certificate and key of a
+// server the CLI runs, kept in a subdirectory of the user configuration
+// directory and generated if missing.
+func selfSignedCertificate(name string) (string, string, error) {
+	dir, err := config.UserConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir = filepath.Join(dir, name)
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+
+	if !tlspkg.CertificateExists(certFile, keyFile) {
+		if err := config.EnsureDir(dir); err != nil {
+			return "", "", err
+		}
+		if err := tlspkg.GenerateSelfSignedCert(certFile, keyFile, serverCertValidDays); err != nil {
+			return "", "", fmt.Errorf("failed to generate %s certificate: %w", name, err)
+		}
+	}
+	return certFile, keyFile, nil
+}
@@ -0,0 +1,326 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/config"
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/cli/session"
+)
+
+// ContextCommand implements the 'context' command for managing named
+// connection settings of devices.
+type ContextCommand struct{}
+
+// NewContextCommand creates a new context command instance.
+func NewContextCommand() *ContextCommand {
+	return &ContextCommand{}
+}
+
+// ContextEntry is a context as listed by 'boarding context list'.
+type ContextEntry struct {
+	Current        bool `json:"current" yaml:"current"`
+	config.Context `yaml:",inline"`
+	Authenticated  bool `json:"authenticated" yaml:"authenticated"`
+}
+
+// ContextEntries is a list of contexts, rendered as a table by default.
+type ContextEntries []ContextEntry
+
+// TableHeader implements output.Table.
+func (e ContextEntries) TableHeader() []string {
+	return []string{"CURRENT", "NAME", "HOST", "PORT", "USERNAME", "SESSION"}
+}
+
+// TableRows implements output.Table.
+func (e ContextEntries) TableRows() [][]string {
+	rows := make([][]string, 0, len(e))
+	for _, ctx := range e {
+		current := ""
+		if ctx.Current {
+			current = "*"
+		}
+		session := "-"
+		if ctx.Authenticated {
+			session = "active"
+		}
+		rows = append(rows, []string{
+			current,
+			ctx.Name,
+			ctx.Host,
+			strconv.Itoa(ctx.Port),
+			valueOrDash(ctx.Username),
+			session,
+		})
+	}
+	return rows
+}
+
+// Execute runs the context command with the provided arguments.
+func (c *ContextCommand) Execute(args []string) {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" || args[0] == "help" {
+		c.printUsage()
+		if len(args) == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		c.executeAdd(args[1:])
+	case "use":
+		c.executeUse(args[1:])
+	case "list":
+		c.executeList(args[1:])
+	case "delete":
+		c.executeDelete(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown context subcommand '%s'\n\n", args[0])
+		c.printUsage()
+		os.Exit(1)
+	}
+}
+
+func (c *ContextCommand) printUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: boarding context <subcommand> [flags]
+
+Manage contexts, named connection settings for devices. Commands use the
+current context, or the one given with the global --context flag, in place
+of the host, port and CA certificate remembered in config.yaml.
+
+Subcommands:
+  add      Add or replace a context
+  use      Make a context the current one
+  list     List contexts
+  delete   Delete a context and its session token
+
+For detailed help on a subcommand, run:
+  boarding context <subcommand> --help
+`)
+}
+
+func (c *ContextCommand) executeAdd(args []string) {
+	fs := flag.NewFlagSet("context add", flag.ExitOnError)
+
+	// Define flags
+	host := fs.String("host", "", "BoardingPass service hostname or IP (required)")
+	port := fs.Int("port", 9455, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+	username := fs.String("username", "", "Default username for 'boarding pass'")
+	use := fs.Bool("use", false, "Make the context the current one")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding context add <name> [flags]
+
+Add a context, replacing any context of the same name. The context's
+session token is the one stored for its host and port, so authenticate
+with 'boarding --context <name> pass'.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Examples:
+  # Add a context and switch to it
+  boarding context add edge-01 --host 192.168.1.101 --username admin --use
+
+  # Add a context with a custom CA certificate
+  boarding context add lab --host lab.internal --ca-cert /etc/ssl/lab-ca.pem
+`)
+	}
+
+	name, args := contextName(args)
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+	if name == "" {
+		name = fs.Arg(0)
+	}
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "Error: context name is required\n\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *host == "" {
+		exitWithError("--host is required")
+	}
+	if *caCert != "" {
+		if _, err := os.Stat(*caCert); err != nil {
+			exitWithError("CA certificate file not found: %s", *caCert)
+		}
+	}
+
+	store, err := session.NewStore()
+	if err != nil {
+		exitWithError("failed to access session store: %v", err)
+	}
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	err = contexts.Set(config.Context{
+		Name:     name,
+		Host:     *host,
+		Port:     *port,
+		CACert:   *caCert,
+		Username: *username,
+		Session:  store.Path(*host, *port),
+	})
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	if *use {
+		_ = contexts.Use(name)
+	}
+	if err := contexts.Save(); err != nil {
+		exitWithError("%v", err)
+	}
+
+	if *use {
+		fmt.Fprintf(os.Stderr, "Context %s added and in use.\n", name)
+	} else {
+		fmt.Fprintf(os.Stderr, "Context %s added.\n", name)
+	}
+}
+
+func (c *ContextCommand) executeUse(args []string) {
+	fs := flag.NewFlagSet("context use", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding context use <name>
+
+Make a context the current one, used by commands without --context.
+`)
+	}
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: context name is required\n\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	if err := contexts.Use(fs.Arg(0)); err != nil {
+		exitWithError("%v", err)
+	}
+	if err := contexts.Save(); err != nil {
+		exitWithError("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Switched to context %s.\n", fs.Arg(0))
+}
+
+func (c *ContextCommand) executeList(args []string) {
+	fs := flag.NewFlagSet("context list", flag.ExitOnError)
+	outputFormat := fs.String("output", "table", "Output format (table, yaml or json)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding context list [flags]
+
+List contexts. The current context is marked with *, and SESSION shows
+whether a session token is stored for it.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	if len(contexts.Contexts) == 0 && format == output.FormatTable {
+		fmt.Fprintln(os.Stderr, "No contexts defined. Add one with 'boarding context add'.")
+		return
+	}
+
+	entries := make(ContextEntries, 0, len(contexts.Contexts))
+	for _, ctx := range contexts.Contexts {
+		entries = append(entries, ContextEntry{
+			Current:       ctx.Name == contexts.Current,
+			Context:       ctx,
+			Authenticated: fileExists(ctx.Session),
+		})
+	}
+
+	formatted, err := output.FormatData(entries, format)
+	if err != nil {
+		exitWithError("failed to format output: %v", err)
+	}
+	fmt.Print(formatted)
+}
+
+func (c *ContextCommand) executeDelete(args []string) {
+	fs := flag.NewFlagSet("context delete", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding context delete <name>
+
+Delete a context. Its session token is deleted too, unless another context
+shares it.
+`)
+	}
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: context name is required\n\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+	name := fs.Arg(0)
+
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	ctx, ok := contexts.Get(name)
+	if !ok {
+		exitWithError("context %q not found", name)
+	}
+	sessionFile := ctx.Session
+	contexts.Delete(name)
+	if err := contexts.Save(); err != nil {
+		exitWithError("%v", err)
+	}
+
+	shared := slices.ContainsFunc(contexts.Contexts, func(other config.Context) bool {
+		return other.Session == sessionFile
+	})
+	if sessionFile != "" && !shared {
+		if err := os.Remove(sessionFile); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete session token: %v\n", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Context %s deleted.\n", name)
+}
+
+// contextName splits off a leading context name, so flags may follow it.
+func contextName(args []string) (string, []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
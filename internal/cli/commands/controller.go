@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/controller"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+)
+
+const (
+	defaultControllerListen = ":9456"
+)
+
+// ControllerCommand implements the 'controller' command, a minimal
+// provisioning controller that devices with a configured callback report to.
+type ControllerCommand struct{}
+
+// NewControllerCommand creates a new controller command instance.
+func NewControllerCommand() *ControllerCommand {
+	return &ControllerCommand{}
+}
+
+// ControllerDevices is a list of devices that called in, rendered as a
+// table by default.
+type ControllerDevices []controller.Device
+
+// TableHeader implements output.Table.
+func (d ControllerDevices) TableHeader() []string {
+	return []string{"ID", "HOSTNAME", "ADDRESS", "PORT", "VERSION", "LAST SEEN"}
+}
+
+// TableRows implements output.Table.
+func (d ControllerDevices) TableRows() [][]string {
+	rows := make([][]string, 0, len(d))
+	for _, dev := range d {
+		rows = append(rows, []string{
+			dev.ID,
+			valueOrDash(dev.System.Hostname),
+			valueOrDash(strings.Join(dev.Addresses, ",")),
+			strconv.Itoa(dev.Port),
+			valueOrDash(dev.Version),
+			dev.LastSeen.Local().Format(time.DateTime),
+		})
+	}
+	return rows
+}
+
+// Execute runs the controller command with the provided arguments.
+func (c *ControllerCommand) Execute(args []string) {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" || args[0] == "help" {
+		c.printUsage()
+		if len(args) == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch args[0] {
+	case "serve":
+		c.executeServe(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown controller subcommand '%s'\n\n", args[0])
+		c.printUsage()
+		os.Exit(1)
+	}
+}
+
+func (c *ControllerCommand) printUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: boarding controller <subcommand> [flags]
+
+Run a minimal provisioning controller that devices report to when their
+service.callback setting points at it.
+
+Subcommands:
+  serve   Receive device reports and list the devices that called in
+
+For detailed help on a subcommand, run:
+  boarding controller <subcommand> --help
+`)
+}
+
+func (c *ControllerCommand) executeServe(args []string) {
+	fs := flag.NewFlagSet("controller serve", flag.ExitOnError)
+
+	// Define flags
+	listen := fs.String("listen", defaultControllerListen, "Address to listen on")
+	certFile := fs.String("cert", "", "TLS certificate (default: generated self-signed certificate)")
+	keyFile := fs.String("key", "", "TLS private key (required with --cert)")
+	outputFormat := fs.String("output", "table", "Format of the device list printed on exit (table, yaml or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding controller serve [flags]
+
+Accept reports from BoardingPass services at https://<host>:9456/devices
+and print each device as it calls in. Devices report their system
+information, network interfaces, certificate fingerprint and reachable
+addresses on start and whenever their addresses change. GET /devices
+returns the devices that called in as JSON; the list is also printed on
+exit.
+
+Without --cert, a self-signed certificate is generated on first use and
+kept in the user configuration directory. Copy it to the devices and set
+service.callback.ca_cert to its path there.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Examples:
+  # Serve with a generated self-signed certificate
+  boarding controller serve
+
+  # Serve with your own certificate on a different port
+  boarding controller serve --listen :8443 --cert controller.crt --key controller.key
+
+  # List the devices that called in
+  curl --cacert controller.crt https://controller.example.com:9456/devices
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		exitWithError("--cert and --key must be given together")
+	}
+
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	if *certFile == "" {
+		if *certFile, *keyFile, err = selfSignedCertificate("controller"); err != nil {
+			exitWithError("%v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := c.serve(ctx, *listen, *certFile, *keyFile, format); err != nil {
+		exitWithError("%v", err)
+	}
+}
+
+// serve accepts device reports until ctx is done, then prints the devices
+// that called in.
+func (c *ControllerCommand) serve(ctx context.Context, listen, certFile, keyFile string, format output.Format) error {
+	registry := controller.NewRegistry()
+	registry.SetReportCallback(func(dev controller.Device, first bool) {
+		event := "updated"
+		if first {
+			event = "called in"
+		}
+		fmt.Printf("%s  %s (%s) %s from %s: %s port %d\n", dev.LastSeen.Local().Format(time.DateTime),
+			dev.ID, valueOrDash(dev.System.Hostname), event, dev.RemoteAddr,
+			valueOrDash(strings.Join(dev.Addresses, ",")), dev.Port)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/devices", registry)
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	if fp, err := tlspkg.CertificateFingerprint(certFile); err == nil {
+		fmt.Fprintf(os.Stderr, "Controller certificate: %s (%s)\n", certFile, fp)
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s, press Ctrl+C to stop.\n", listen)
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServeTLS(certFile, keyFile) }()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("controller server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to stop controller server: %w", err)
+	}
+
+	devices := ControllerDevices(registry.Devices())
+	if len(devices) == 0 && format == output.FormatTable {
+		fmt.Fprintln(os.Stderr, "No devices called in.")
+		return nil
+	}
+
+	formatted, err := output.FormatData(devices, format)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+	fmt.Print(formatted)
+	return nil
+}
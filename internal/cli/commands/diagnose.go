@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/config"
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/cli/session"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// DiagnoseCommand implements the 'diagnose' command for running connectivity diagnostics.
+type DiagnoseCommand struct{}
+
+// NewDiagnoseCommand creates a new diagnose command instance.
+func NewDiagnoseCommand() *DiagnoseCommand {
+	return &DiagnoseCommand{}
+}
+
+// ConnectivityChecks is a list of connectivity check results, rendered as a
+// table by default.
+type ConnectivityChecks []protocol.ConnectivityCheck
+
+// TableHeader implements output.Table.
+func (c ConnectivityChecks) TableHeader() []string {
+	return []string{"CHECK", "TARGET", "STATUS", "TIME", "MESSAGE"}
+}
+
+// TableRows implements output.Table.
+func (c ConnectivityChecks) TableRows() [][]string {
+	rows := make([][]string, 0, len(c))
+	for _, check := range c {
+		duration := "-"
+		if check.Status != protocol.CheckSkip {
+			duration = strconv.FormatFloat(check.DurationMS, 'f', 1, 64) + "ms"
+		}
+		rows = append(rows, []string{
+			check.Check,
+			valueOrDash(check.Target),
+			check.Status,
+			duration,
+			valueOrDash(check.Message),
+		})
+	}
+	return rows
+}
+
+// Execute runs the diagnose command with the provided arguments.
+func (c *DiagnoseCommand) Execute(args []string) {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+
+	// Define flags
+	outputFormat := fs.String("output", "table", "Output format (table, yaml or json)")
+	host := fs.String("host", "", "BoardingPass service hostname or IP")
+	port := fs.Int("port", 0, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+	var endpoints, ntpServers multiString
+	fs.Var(&endpoints, "endpoint", "URL or host:port to check reachability of (can be repeated)")
+	fs.Var(&ntpServers, "ntp-server", "NTP server to check the clock offset to (can be repeated)")
+	useProxy := fs.Bool("proxy", false, "Reach the endpoints through the device's configured proxy")
+	minMTU := fs.Int("min-mtu", 0, "Minimum MTU of the default route's interface (default 1280)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding diagnose [flags]
+
+Check the network connectivity of the device: its default route and MTU,
+DNS resolution, TCP and TLS reachability of endpoints, and the clock offset
+to NTP servers. Without --ntp-server, the device's configured NTP servers
+are checked. Requires prior authentication via 'boarding pass'.
+
+Exits with status 1 if any check fails.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Output Formats:
+  table  Aligned columns (default)
+  yaml   YAML format
+  json   JSON format
+
+Examples:
+  # Check the default route, MTU and configured NTP servers
+  boarding diagnose --host 192.168.1.100
+
+  # Check that a management service is reachable through the proxy
+  boarding diagnose --endpoint https://api.flightctl.example.com --proxy
+
+  # Check several endpoints and a specific NTP server
+  boarding diagnose --endpoint quay.io:443 --endpoint registry.example.com:5000 --ntp-server pool.ntp.org
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	// Load base configuration
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError("failed to load configuration: %v", err)
+	}
+
+	// Apply command-line flags (highest priority)
+	cfg.ApplyFlags(*host, *port, *caCert)
+
+	// Parse output format
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	req := &protocol.ConnectivityRequest{
+		Endpoints:  []string(endpoints),
+		UseProxy:   *useProxy,
+		NTPServers: []string(ntpServers),
+		MinMTU:     *minMTU,
+	}
+	passed, err := c.diagnose(cfg, req, format)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+// diagnose runs the connectivity checks on the device and displays the
+// results. It reports whether all checks passed.
+func (c *DiagnoseCommand) diagnose(cfg *config.Config, req *protocol.ConnectivityRequest, format output.Format) (bool, error) {
+	// Create API client
+	apiClient, err := createClient(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	// Load session token
+	store, err := session.NewStore()
+	if err != nil {
+		return false, fmt.Errorf("failed to access session store: %w", err)
+	}
+
+	token, err := store.Load(cfg.Host, cfg.Port)
+	if err != nil {
+		return false, fmt.Errorf("failed to load session token: %w", err)
+	}
+
+	if token == "" {
+		return false, fmt.Errorf("no active session. Run 'boarding pass' to authenticate")
+	}
+
+	apiClient.SetSessionToken(token)
+
+	resp, err := apiClient.Diagnose(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to run diagnostics: %w", err)
+	}
+
+	// The table shows the checks; yaml and json include the overall result
+	var data any = resp
+	if format == output.FormatTable {
+		data = ConnectivityChecks(resp.Checks)
+	}
+	formatted, err := output.FormatData(data, format)
+	if err != nil {
+		return false, fmt.Errorf("failed to format output: %w", err)
+	}
+
+	fmt.Print(formatted)
+	return resp.Passed, nil
+}
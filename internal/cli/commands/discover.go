@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/mdns"
+)
+
+const (
+	discoverService = "_boardingpass._tcp"
+	discoverDomain  = "local"
+)
+
+// DiscoverCommand implements the 'discover' command for finding BoardingPass
+// services on the local network via mDNS.
+type DiscoverCommand struct{}
+
+// NewDiscoverCommand creates a new discover command instance.
+func NewDiscoverCommand() *DiscoverCommand {
+	return &DiscoverCommand{}
+}
+
+// Device is a BoardingPass service found on the local network.
+type Device struct {
+	Name        string   `json:"name" yaml:"name"`
+	Host        string   `json:"host" yaml:"host"`
+	Addresses   []string `json:"addresses" yaml:"addresses"`
+	Port        int      `json:"port" yaml:"port"`
+	Serial      string   `json:"serial,omitempty" yaml:"serial,omitempty"`
+	Model       string   `json:"model,omitempty" yaml:"model,omitempty"`
+	Fingerprint string   `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Transports  []string `json:"transports,omitempty" yaml:"transports,omitempty"`
+	State       string   `json:"state,omitempty" yaml:"state,omitempty"`
+	Version     string   `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// Devices is a list of discovered devices, rendered as a table by default.
+type Devices []Device
+
+// TableHeader implements output.Table.
+func (d Devices) TableHeader() []string {
+	return []string{"NAME", "ADDRESS", "PORT", "SERIAL", "MODEL", "STATE", "TRANSPORTS"}
+}
+
+// TableRows implements output.Table.
+func (d Devices) TableRows() [][]string {
+	rows := make([][]string, 0, len(d))
+	for _, dev := range d {
+		address := "-"
+		if len(dev.Addresses) > 0 {
+			address = dev.Addresses[0]
+		}
+		rows = append(rows, []string{
+			dev.Name,
+			address,
+			strconv.Itoa(dev.Port),
+			valueOrDash(dev.Serial),
+			valueOrDash(dev.Model),
+			valueOrDash(dev.State),
+			valueOrDash(strings.Join(dev.Transports, ",")),
+		})
+	}
+	return rows
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Execute runs the discover command with the provided arguments.
+func (c *DiscoverCommand) Execute(args []string) {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+
+	// Define flags
+	outputFormat := fs.String("output", "table", "Output format (table, yaml or json)")
+	timeout := fs.Duration("timeout", 3*time.Second, "How long to wait for devices to respond")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding discover [flags]
+
+Browse the local network for BoardingPass services announced via mDNS and
+list them with their addresses, serial number, model, provisioning state
+and enabled transports. No authentication is required.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Output Formats:
+  table  Aligned columns (default)
+  yaml   YAML format
+  json   JSON format
+
+Examples:
+  # List devices on the local network
+  boarding discover
+
+  # Wait longer on slow or busy networks
+  boarding discover --timeout 10s
+
+  # Machine-readable output, including certificate fingerprints
+  boarding discover --output json
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	// Parse output format
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	if err := c.discover(*timeout, format); err != nil {
+		exitWithError("%v", err)
+	}
+}
+
+// discover browses for services until the timeout expires and displays them.
+func (c *DiscoverCommand) discover(timeout time.Duration, format output.Format) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	entries, err := mdns.Browse(ctx, discoverService, discoverDomain)
+	if err != nil {
+		return fmt.Errorf("failed to browse for devices: %w", err)
+	}
+
+	devices := devicesFromEntries(entries)
+	if len(devices) == 0 && format == output.FormatTable {
+		fmt.Fprintln(os.Stderr, "No devices found.")
+		return nil
+	}
+
+	formatted, err := output.FormatData(devices, format)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+
+	fmt.Print(formatted)
+	return nil
+}
+
+// devicesFromEntries converts browse results into devices, reading the
+// metadata the service publishes in its TXT record.
+func devicesFromEntries(entries []mdns.ServiceEntry) Devices {
+	devices := make(Devices, 0, len(entries))
+	for _, e := range entries {
+		dev := Device{
+			Name:        e.Instance,
+			Host:        strings.TrimSuffix(e.Host, "."),
+			Addresses:   make([]string, 0, len(e.Addrs)),
+			Port:        e.Port,
+			Serial:      e.TXT[mdns.TXTSerial],
+			Model:       e.TXT[mdns.TXTModel],
+			Fingerprint: e.TXT[mdns.TXTFingerprint],
+			State:       e.TXT[mdns.TXTState],
+			Version:     e.TXT[mdns.TXTVersion],
+		}
+		// IPv4 first; link-local IPv6 addresses are unusable without a zone
+		for _, ip := range e.Addrs {
+			if ip.To4() != nil {
+				dev.Addresses = append(dev.Addresses, ip.String())
+			}
+		}
+		for _, ip := range e.Addrs {
+			if ip.To4() == nil && !ip.IsLinkLocalUnicast() {
+				dev.Addresses = append(dev.Addresses, ip.String())
+			}
+		}
+		if t := e.TXT[mdns.TXTTransports]; t != "" {
+			dev.Transports = strings.Split(t, ",")
+		}
+		devices = append(devices, dev)
+	}
+	return devices
+}
@@ -0,0 +1,582 @@
+package commands
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/clicontext"
+	"github.com/fzdarsky/boardingpass/internal/cli/client"
+	"github.com/fzdarsky/boardingpass/internal/cli/config"
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/cli/session"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"golang.org/x/term"
+)
+
+const (
+	// enrollPollInterval is how often --wait checks the enrollment status.
+	enrollPollInterval = 5 * time.Second
+
+	flightControlBackend = "flightctl"
+)
+
+// EnrollmentBackends is a list of enrollment backends, rendered as a table
+// by default.
+type EnrollmentBackends []protocol.EnrollmentBackend
+
+// TableHeader implements output.Table.
+func (b EnrollmentBackends) TableHeader() []string {
+	return []string{"NAME", "DISPLAY NAME", "FIELDS", "DESCRIPTION"}
+}
+
+// TableRows implements output.Table. Required fields are marked with *.
+func (b EnrollmentBackends) TableRows() [][]string {
+	rows := make([][]string, 0, len(b))
+	for _, backend := range b {
+		fields := make([]string, 0, len(backend.Fields))
+		for _, field := range backend.Fields {
+			if field.Required {
+				fields = append(fields, field.Name+"*")
+			} else {
+				fields = append(fields, field.Name)
+			}
+		}
+		rows = append(rows, []string{
+			backend.Name,
+			backend.DisplayName,
+			valueOrDash(strings.Join(fields, ",")),
+			valueOrDash(backend.Description),
+		})
+	}
+	return rows
+}
+
+// EnrollCommand implements the 'enroll' command for enrolling the device
+// with management services.
+type EnrollCommand struct{}
+
+// NewEnrollCommand creates a new enroll command instance.
+func NewEnrollCommand() *EnrollCommand {
+	return &EnrollCommand{}
+}
+
+// Execute runs the enroll command with the provided arguments.
+func (c *EnrollCommand) Execute(args []string) {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" || args[0] == "help" {
+		c.printUsage()
+		if len(args) == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch args[0] {
+	case "flightctl":
+		c.executeFlightControl(args[1:])
+	case "status":
+		c.executeStatus(args[1:])
+	case "backends":
+		c.executeBackends(args[1:])
+	default:
+		if strings.HasPrefix(args[0], "-") {
+			fmt.Fprintf(os.Stderr, "Error: unknown enroll subcommand '%s'\n\n", args[0])
+			c.printUsage()
+			os.Exit(1)
+		}
+		c.executeBackend(args[0], args[1:])
+	}
+}
+
+func (c *EnrollCommand) printUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: boarding enroll <subcommand> [flags]
+
+Enroll the device with a management service. The device submits the
+enrollment request itself and configures the management agent once the
+request is approved. Requires prior authentication via 'boarding pass'.
+
+Subcommands:
+  flightctl  Enroll with Flight Control
+  <backend>  Enroll with another backend of the device, e.g. awx
+  backends   List the enrollment backends and their fields
+  status     Show the status of the last enrollment
+
+For detailed help on a subcommand, run:
+  boarding enroll <subcommand> --help
+`)
+}
+
+func (c *EnrollCommand) executeFlightControl(args []string) {
+	fs := flag.NewFlagSet("enroll flightctl", flag.ExitOnError)
+
+	// Define flags
+	server := fs.String("server", "", "Flight Control API URL (default: configured on the device)")
+	token := fs.String("token", "", "Bearer token for the Flight Control API, e.g. from 'flightctl login'")
+	tokenFile := fs.String("token-file", "", "File containing the bearer token")
+	serverCA := fs.String("server-ca", "", "PEM file with the CA of the Flight Control API (default: configured on the device or system roots)")
+	agentServer := fs.String("agent-server", "", "Agent API URL the agent connects to (default: --server)")
+	var labels multiString
+	fs.Var(&labels, "label", "Label key=value of the device (can be repeated)")
+	wait := fs.Bool("wait", false, "Wait until the enrollment request is approved and the agent is configured")
+	waitTimeout := fs.Duration("wait-timeout", 30*time.Minute, "How long --wait waits")
+	outputFormat := fs.String("output", "yaml", "Output format (yaml or json)")
+	host := fs.String("host", "", "BoardingPass service hostname or IP")
+	port := fs.Int("port", 0, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding enroll flightctl [flags]
+
+Submit a Flight Control enrollment request from the device. Once an
+administrator approves it, the device writes the agent configuration to
+/etc/flightctl/config.yaml and restarts flightctl-agent.
+
+Without --wait, the command returns once the request is submitted; follow
+it with 'boarding enroll status'. With --wait, it exits with status 1 if
+the request is denied or the enrollment fails.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Examples:
+  # Enroll and wait for approval
+  boarding enroll flightctl --server https://api.flightctl.example.com --token-file ~/.flightctl-token --wait
+
+  # Enroll with labels, through a server with a private CA
+  boarding enroll flightctl --server https://api.flightctl.example.com --server-ca ca.pem \
+    --token "$(cat token)" --label site=store-42 --label role=pos
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	req := &protocol.FlightControlEnrollRequest{
+		Server:      *server,
+		Token:       *token,
+		AgentServer: *agentServer,
+	}
+	if *tokenFile != "" {
+		if *token != "" {
+			exitWithError("--token and --token-file are mutually exclusive")
+		}
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			exitWithError("failed to read token file: %v", err)
+		}
+		req.Token = strings.TrimSpace(string(data))
+	}
+	if req.Token == "" {
+		exitWithError("--token or --token-file is required")
+	}
+	if *serverCA != "" {
+		data, err := os.ReadFile(*serverCA)
+		if err != nil {
+			exitWithError("failed to read server CA: %v", err)
+		}
+		req.CACert = string(data)
+	}
+	for _, label := range labels {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			exitWithError("invalid label %q: must be key=value", label)
+		}
+		if req.Labels == nil {
+			req.Labels = map[string]string{}
+		}
+		req.Labels[key] = value
+	}
+
+	// Load base configuration
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError("failed to load configuration: %v", err)
+	}
+
+	// Apply command-line flags (highest priority)
+	cfg.ApplyFlags(*host, *port, *caCert)
+
+	// Parse output format
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	apiClient, err := c.authenticatedClient(cfg)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	status, err := apiClient.EnrollFlightControl(req)
+	if err != nil {
+		exitWithError("failed to enroll with Flight Control: %v", err)
+	}
+	if *wait {
+		fmt.Fprintf(os.Stderr, "Waiting for approval of enrollment request %s...\n", status.RequestName)
+		status, err = c.waitForEnrollment(apiClient, flightControlBackend, *waitTimeout)
+		if err != nil {
+			exitWithError("%v", err)
+		}
+	}
+	c.printStatus(status, format)
+	if status.State == protocol.EnrollmentStateDenied || status.State == protocol.EnrollmentStateFailed {
+		os.Exit(1)
+	}
+}
+
+func (c *EnrollCommand) executeStatus(args []string) {
+	fs := flag.NewFlagSet("enroll status", flag.ExitOnError)
+
+	// Define flags
+	backend := fs.String("backend", "", "Show the last enrollment with this backend (default: any backend)")
+	outputFormat := fs.String("output", "yaml", "Output format (yaml or json)")
+	host := fs.String("host", "", "BoardingPass service hostname or IP")
+	port := fs.Int("port", 0, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding enroll status [flags]
+
+Show the status of the device's last enrollment: pending_approval,
+approved, running, enrolled, denied or failed.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	// Load base configuration
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError("failed to load configuration: %v", err)
+	}
+
+	// Apply command-line flags (highest priority)
+	cfg.ApplyFlags(*host, *port, *caCert)
+
+	// Parse output format
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	apiClient, err := c.authenticatedClient(cfg)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	var status *protocol.EnrollmentStatus
+	if *backend != "" {
+		status, err = apiClient.GetBackendEnrollment(*backend)
+	} else {
+		status, err = apiClient.GetEnrollment()
+	}
+	if err != nil {
+		exitWithError("failed to query enrollment status: %v", err)
+	}
+	c.printStatus(status, format)
+}
+
+func (c *EnrollCommand) executeBackends(args []string) {
+	fs := flag.NewFlagSet("enroll backends", flag.ExitOnError)
+
+	// Define flags
+	outputFormat := fs.String("output", "table", "Output format (table, yaml or json)")
+	host := fs.String("host", "", "BoardingPass service hostname or IP")
+	port := fs.Int("port", 0, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding enroll backends [flags]
+
+List the management services the device can enroll with and the fields of
+their enrollment requests. Required fields are marked with *.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	// Load base configuration
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError("failed to load configuration: %v", err)
+	}
+
+	// Apply command-line flags (highest priority)
+	cfg.ApplyFlags(*host, *port, *caCert)
+
+	// Parse output format
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	apiClient, err := c.authenticatedClient(cfg)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	list, err := apiClient.ListEnrollmentBackends()
+	if err != nil {
+		exitWithError("failed to list enrollment backends: %v", err)
+	}
+
+	var data any = list
+	if format == output.FormatTable {
+		data = EnrollmentBackends(list.Backends)
+	}
+	formatted, err := output.FormatData(data, format)
+	if err != nil {
+		exitWithError("failed to format output: %v", err)
+	}
+	fmt.Print(formatted)
+}
+
+func (c *EnrollCommand) executeBackend(name string, args []string) {
+	fs := flag.NewFlagSet("enroll "+name, flag.ExitOnError)
+
+	// Define flags
+	var sets multiString
+	fs.Var(&sets, "set", "Field value name=value (can be repeated)")
+	wait := fs.Bool("wait", false, "Wait until the enrollment completes")
+	waitTimeout := fs.Duration("wait-timeout", 30*time.Minute, "How long --wait waits")
+	outputFormat := fs.String("output", "yaml", "Output format (yaml or json)")
+	host := fs.String("host", "", "BoardingPass service hostname or IP")
+	port := fs.Int("port", 0, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding enroll <backend> [flags]
+
+Enroll the device with one of its enrollment backends. The fields of the
+enrollment request are set with --set; required fields that are not set
+are prompted for, with hidden input for secrets. Fields of type labels
+take comma-separated key=value pairs. List the backends and their fields
+with 'boarding enroll backends'.
+
+Without --wait, the command returns once the enrollment started; follow it
+with 'boarding enroll status --backend <backend>'. With --wait, it exits
+with status 1 if the enrollment is denied or fails.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Examples:
+  # Enroll with an AWX backend, prompting for its token
+  boarding enroll awx --set url=https://awx.example.com --set inventory=edge --wait
+
+  # Enroll non-interactively
+  boarding -y enroll awx --set url=https://awx.example.com --set token="$(cat token)"
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	values := map[string]string{}
+	for _, set := range sets {
+		key, value, ok := strings.Cut(set, "=")
+		if !ok {
+			exitWithError("invalid --set %q: must be name=value", set)
+		}
+		values[key] = value
+	}
+
+	// Load base configuration
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError("failed to load configuration: %v", err)
+	}
+
+	// Apply command-line flags (highest priority)
+	cfg.ApplyFlags(*host, *port, *caCert)
+
+	// Parse output format
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	apiClient, err := c.authenticatedClient(cfg)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	list, err := apiClient.ListEnrollmentBackends()
+	if err != nil {
+		exitWithError("failed to list enrollment backends: %v", err)
+	}
+	i := slices.IndexFunc(list.Backends, func(b protocol.EnrollmentBackend) bool { return b.Name == name })
+	if i < 0 {
+		exitWithError("unknown enrollment backend %q. Run 'boarding enroll backends' to list them", name)
+	}
+	backend := list.Backends[i]
+
+	req, err := enrollmentRequest(backend, values)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	status, err := apiClient.Enroll(name, req)
+	if err != nil {
+		exitWithError("failed to enroll with %s: %v", backend.DisplayName, err)
+	}
+	if *wait {
+		fmt.Fprintf(os.Stderr, "Waiting for the %s enrollment to complete...\n", backend.DisplayName)
+		status, err = c.waitForEnrollment(apiClient, name, *waitTimeout)
+		if err != nil {
+			exitWithError("%v", err)
+		}
+	}
+	c.printStatus(status, format)
+	if status.State == protocol.EnrollmentStateDenied || status.State == protocol.EnrollmentStateFailed {
+		os.Exit(1)
+	}
+}
+
+// enrollmentRequest builds the enrollment request for backend from the
+// field values set, prompting for required fields that are not set.
+func enrollmentRequest(backend protocol.EnrollmentBackend, values map[string]string) (map[string]any, error) {
+	interactive := !clicontext.AssumeYes() && term.IsTerminal(int(os.Stdin.Fd()))
+	reader := bufio.NewReader(os.Stdin)
+
+	req := map[string]any{}
+	var missing []string
+	for _, field := range backend.Fields {
+		value, ok := values[field.Name]
+		delete(values, field.Name)
+		if !ok && field.Required && field.Default == "" {
+			if !interactive {
+				missing = append(missing, field.Name)
+				continue
+			}
+			var err error
+			if value, err = promptField(reader, field); err != nil {
+				return nil, err
+			}
+		}
+		if value == "" {
+			continue
+		}
+
+		if field.Type != protocol.FieldTypeLabels {
+			req[field.Name] = value
+			continue
+		}
+		labels := map[string]string{}
+		for _, label := range strings.Split(value, ",") {
+			key, value, ok := strings.Cut(label, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid label %q in field %s: must be key=value", label, field.Name)
+			}
+			labels[key] = value
+		}
+		req[field.Name] = labels
+	}
+
+	for name := range values {
+		return nil, fmt.Errorf("%s has no field %q", backend.DisplayName, name)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required fields: %s (set them with --set name=value)", strings.Join(missing, ", "))
+	}
+	return req, nil
+}
+
+// promptField prompts the user to enter a field's value, with hidden input
+// for secrets.
+func promptField(reader *bufio.Reader, field protocol.EnrollmentField) (string, error) {
+	prompt := field.Name
+	if field.Description != "" {
+		prompt += " (" + field.Description + ")"
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+
+	if field.Type == protocol.FieldTypeSecret {
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintf(os.Stderr, "\n")
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", field.Name, err)
+		}
+		return string(value), nil
+	}
+	value, err := reader.ReadString('\n')
+	if err != nil && value == "" {
+		return "", fmt.Errorf("failed to read %s: %w", field.Name, err)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// authenticatedClient creates an API client with the stored session token.
+func (c *EnrollCommand) authenticatedClient(cfg *config.Config) (*client.Client, error) {
+	// Create API client
+	apiClient, err := createClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load session token
+	store, err := session.NewStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access session store: %w", err)
+	}
+
+	token, err := store.Load(cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session token: %w", err)
+	}
+
+	if token == "" {
+		return nil, fmt.Errorf("no active session. Run 'boarding pass' to authenticate")
+	}
+
+	apiClient.SetSessionToken(token)
+	return apiClient, nil
+}
+
+// waitForEnrollment polls the status of the enrollment with backend until
+// it is denied, completed or failed.
+func (c *EnrollCommand) waitForEnrollment(apiClient *client.Client, backend string, timeout time.Duration) (*protocol.EnrollmentStatus, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := apiClient.GetBackendEnrollment(backend)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query enrollment status: %w", err)
+		}
+		switch status.State {
+		case protocol.EnrollmentStatePending, protocol.EnrollmentStateApproved, protocol.EnrollmentStateRunning:
+		default:
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("enrollment did not complete within %s; check again with 'boarding enroll status --backend %s'",
+				timeout, backend)
+		}
+		time.Sleep(enrollPollInterval)
+	}
+}
+
+func (c *EnrollCommand) printStatus(status *protocol.EnrollmentStatus, format output.Format) {
+	formatted, err := output.FormatData(status, format)
+	if err != nil {
+		exitWithError("failed to format output: %v", err)
+	}
+	fmt.Print(formatted)
+}
@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/client"
+	"github.com/fzdarsky/boardingpass/internal/cli/config"
+	"github.com/fzdarsky/boardingpass/internal/cli/fleet"
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/cli/session"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// FleetCommand implements the 'fleet' command for provisioning many
+// devices in parallel.
+type FleetCommand struct{}
+
+// NewFleetCommand creates a new fleet command instance.
+func NewFleetCommand() *FleetCommand {
+	return &FleetCommand{}
+}
+
+// Execute runs the fleet command with the provided arguments.
+func (c *FleetCommand) Execute(args []string) {
+	fs := flag.NewFlagSet("fleet", flag.ExitOnError)
+
+	// Define flags
+	loadDir := fs.String("load", "", "Upload configuration from this directory to each device")
+	var commands multiString
+	fs.Var(&commands, "command", "Execute an allow-listed command with optional parameters, e.g. 'set-hostname ${hostname}' (can be repeated)")
+	complete := fs.Bool("complete", false, "Complete provisioning on each device")
+	reboot := fs.Bool("reboot", false, "Reboot each device after completing provisioning")
+	parallel := fs.Int("parallel", fleet.DefaultParallel, "Maximum number of devices to provision at once")
+	reportFile := fs.String("report", "", "Write a JSON report of the run to this file")
+	outputFormat := fs.String("output", "table", "Format of the result matrix (table, yaml or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding fleet [flags] <inventory>
+
+Authenticate with every device in an inventory file and apply the same
+steps to each of them, several devices at a time. A device's remaining
+steps are skipped once one fails; other devices carry on. A result matrix
+is printed at the end, and the command exits non-zero if any device failed.
+
+Steps run in this order: authentication, --load, each --command in the
+order given, --complete. Session tokens are stored per device, so single
+device commands can follow up with --host.
+
+The inventory is a YAML file listing devices, with defaults for fields
+they leave out. Passwords are given literally or printed by a command run
+on this machine. ${var} in password commands and command parameters is
+replaced by the device's vars, or by its name, host or port:
+
+  defaults:
+    username: admin
+    password_command: ["/usr/local/bin/device-password", "${serial}"]
+  devices:
+    - host: 192.168.1.101
+      vars: {serial: SN1001, hostname: edge-01}
+    - name: rack1-u2
+      host: 192.168.1.102
+      password: 4f9a-21c7-e0d3
+
+Unknown certificates are prompted for one at a time; use -y to accept
+them, or set ca_cert in the inventory.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Examples:
+  # Authenticate with all devices
+  boarding fleet rack1.yaml
+
+  # Configure, set per-device hostnames and complete, 20 devices at a time
+  boarding -y fleet --load ./edge-config --command 'set-hostname ${hostname}' \
+    --complete --parallel 20 --report rack1-report.json rack1.yaml
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: inventory file is required\n\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *reboot && !*complete {
+		exitWithError("--reboot requires --complete")
+	}
+	if *parallel < 1 {
+		exitWithError("--parallel must be at least 1")
+	}
+
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	devices, err := fleet.LoadInventory(fs.Arg(0))
+	if err != nil {
+		exitWithError("%v", err)
+	}
+
+	store, err := session.NewStore()
+	if err != nil {
+		exitWithError("failed to access session store: %v", err)
+	}
+
+	steps := []fleet.Step{c.passStep(store)}
+	if *loadDir != "" {
+		// The same files go to every device, so scan them once
+		files, err := (&LoadCommand{}).scanDirectory(*loadDir)
+		if err != nil {
+			exitWithError("failed to scan directory: %v", err)
+		}
+		if len(files) == 0 {
+			exitWithError("no files found in directory")
+		}
+		steps = append(steps, c.loadStep(&protocol.ConfigBundle{Files: files}))
+	}
+	for _, command := range commands {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			exitWithError("--command must not be empty")
+		}
+		steps = append(steps, c.commandStep(fields[0], fields[1:]))
+	}
+	if *complete {
+		steps = append(steps, c.completeStep(store, *reboot))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Provisioning %d device(s), %d at a time...\n", len(devices), *parallel)
+	runner := &fleet.Runner{
+		Parallel: *parallel,
+		OnStep: func(dev fleet.Device, result fleet.StepResult) {
+			elapsed := (time.Duration(result.DurationMS) * time.Millisecond).String()
+			switch result.Status {
+			case fleet.StatusOK:
+				fmt.Fprintf(os.Stderr, "[%s] %s: ok (%s)\n", dev.Name, result.Step, elapsed)
+			case fleet.StatusFailed:
+				fmt.Fprintf(os.Stderr, "[%s] %s: failed: %s\n", dev.Name, result.Step, result.Error)
+			}
+		},
+	}
+	report := runner.Run(ctx, devices, steps)
+
+	if *reportFile != "" {
+		data, err := output.FormatData(report, output.FormatJSON)
+		if err != nil {
+			exitWithError("failed to format report: %v", err)
+		}
+		if err := os.WriteFile(*reportFile, []byte(data+"\n"), 0o600); err != nil {
+			exitWithError("failed to write report: %v", err)
+		}
+	}
+
+	formatted, err := output.FormatData(report, format)
+	if err != nil {
+		exitWithError("failed to format output: %v", err)
+	}
+	fmt.Print(formatted)
+	if format == output.FormatTable {
+		fmt.Fprintf(os.Stderr, "\n%d succeeded, %d failed.\n", report.Succeeded, report.Failed)
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// passStep authenticates with the device and stores the session token.
+func (c *FleetCommand) passStep(store *session.Store) fleet.Step {
+	return fleet.Step{Name: "pass", Run: func(ctx context.Context, t *fleet.Target) error {
+		password, err := t.ResolvePassword(ctx)
+		if err != nil {
+			return err
+		}
+
+		apiClient, err := client.NewClient(&config.Config{Host: t.Host, Port: t.Port, CACert: t.CACert})
+		if err != nil {
+			return fmt.Errorf("failed to create API client: %w", err)
+		}
+		token, err := apiClient.Authenticate(t.Username, password)
+		if err != nil {
+			return err
+		}
+		t.Client = apiClient
+
+		return store.Save(t.Host, t.Port, token)
+	}}
+}
+
+// loadStep uploads the configuration bundle.
+func (c *FleetCommand) loadStep(bundle *protocol.ConfigBundle) fleet.Step {
+	return fleet.Step{Name: "load", Run: func(_ context.Context, t *fleet.Target) error {
+		return t.Client.PostConfigure(bundle)
+	}}
+}
+
+// commandStep executes an allow-listed command, expanding the device's
+// variables in its parameters.
+func (c *FleetCommand) commandStep(commandID string, params []string) fleet.Step {
+	return fleet.Step{Name: "command:" + commandID, Run: func(_ context.Context, t *fleet.Target) error {
+		expanded := make([]string, len(params))
+		for i, p := range params {
+			expanded[i] = t.Expand(p)
+		}
+
+		resp, err := t.Client.ExecuteCommand(commandID, expanded)
+		if err != nil {
+			return err
+		}
+		if resp.ExitCode != 0 {
+			if msg := lastLine(resp.Stderr); msg != "" {
+				return fmt.Errorf("exited with code %d: %s", resp.ExitCode, msg)
+			}
+			return fmt.Errorf("exited with code %d", resp.ExitCode)
+		}
+		return nil
+	}}
+}
+
+// completeStep completes provisioning and deletes the session token.
+func (c *FleetCommand) completeStep(store *session.Store, reboot bool) fleet.Step {
+	return fleet.Step{Name: "complete", Run: func(_ context.Context, t *fleet.Target) error {
+		if _, err := t.Client.Complete(reboot); err != nil {
+			return err
+		}
+		if err := store.Delete(t.Host, t.Port); err != nil {
+			return fmt.Errorf("provisioning completed, but %w", err)
+		}
+		return nil
+	}}
+}
+
+// lastLine returns the last non-empty line of s.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
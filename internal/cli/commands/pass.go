@@ -4,16 +4,23 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/fzdarsky/boardingpass/internal/cli/client"
 	"github.com/fzdarsky/boardingpass/internal/cli/config"
 	"github.com/fzdarsky/boardingpass/internal/cli/session"
-	"github.com/fzdarsky/boardingpass/pkg/srp"
+	cliTLS "github.com/fzdarsky/boardingpass/internal/cli/tls"
+	"github.com/fzdarsky/boardingpass/internal/qr"
 	"golang.org/x/term"
 )
 
+// maxQRURIBytes limits the length of an onboarding URI read from a file.
+const maxQRURIBytes = 64 << 10
+
 // PassCommand implements the 'pass' command for authentication.
 type PassCommand struct{}
 
@@ -32,6 +39,7 @@ func (c *PassCommand) Execute(args []string) {
 	host := fs.String("host", "", "BoardingPass service hostname or IP")
 	port := fs.Int("port", 0, "BoardingPass service port")
 	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+	qrFile := fs.String("qr", "", "File with the onboarding URI from the device's QR code, or - for stdin")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Usage: boarding pass [flags]
@@ -55,6 +63,12 @@ Examples:
 
   # With custom CA certificate
   boarding pass --host internal.corp --ca-cert /etc/ssl/ca.pem --username admin
+
+  # From a scanned onboarding QR code (host, credentials and certificate included)
+  boarding pass --qr onboard.txt
+
+  # From an onboarding URI on stdin, keeping the password out of the process list
+  ssh root@device boardingpass qr --format uri | boarding pass --qr -
 `)
 	}
 
@@ -68,6 +82,32 @@ Examples:
 		exitWithError("failed to load configuration: %v", err)
 	}
 
+	// Fill in connection details and credentials from the onboarding URI.
+	// Explicit flags still take precedence.
+	var payload *qr.Payload
+	if *qrFile != "" {
+		uri, err := readQRURI(*qrFile)
+		if err != nil {
+			exitWithError("%v", err)
+		}
+		payload, err = qr.ParseURI(uri)
+		if err != nil {
+			exitWithError("%v", err)
+		}
+		if *host == "" {
+			*host = selectPayloadHost(payload)
+		}
+		if *port == 0 {
+			*port = payload.Port
+		}
+		if *username == "" {
+			*username = payload.Username
+		}
+		if *password == "" {
+			*password = payload.Password
+		}
+	}
+
 	// Apply command-line flags (highest priority)
 	cfg.ApplyFlags(*host, *port, *caCert)
 
@@ -76,8 +116,23 @@ Examples:
 		exitWithError("%v", err)
 	}
 
+	// Pre-trust the certificate fingerprint from the QR code, so the
+	// connection is verified without a TOFU prompt
+	if payload != nil && payload.Fingerprint != "" && cfg.CACert == "" {
+		store, err := cliTLS.NewCertificateStore()
+		if err != nil {
+			exitWithError("failed to access certificate store: %v", err)
+		}
+		if err := store.Trust(cfg.Address(), payload.Fingerprint); err != nil {
+			exitWithError("failed to store certificate fingerprint: %v", err)
+		}
+	}
+
 	// Get username
 	user := *username
+	if user == "" {
+		user = cfg.Username
+	}
 	if user == "" {
 		user = promptUsername()
 	}
@@ -104,49 +159,9 @@ func (c *PassCommand) authenticate(cfg *config.Config, username, password string
 
 	fmt.Fprintf(os.Stderr, "Authenticating with %s...\n", cfg.Address())
 
-	// Normalize password to canonical form (lowercase, no separators)
-	// Both client and server must apply the same normalization before SRP
-	normalizedPassword := srp.NormalizePassword(password)
-
-	// Initialize SRP client
-	srpClient := client.NewSRPClient(username, normalizedPassword)
-	defer srpClient.ClearSecrets()
-
-	// Phase 1: Generate ephemeral keypair and send Init request
-	A, err := srpClient.GenerateEphemeralKeypair()
-	if err != nil {
-		return fmt.Errorf("failed to generate ephemeral keypair: %w", err)
-	}
-
-	initResp, err := apiClient.SRPInit(username, A)
-	if err != nil {
-		return fmt.Errorf("SRP init failed: %w", err)
-	}
-
-	// Set server response (salt and B)
-	if err := srpClient.SetServerResponse(initResp.Salt, initResp.B); err != nil {
-		return fmt.Errorf("invalid server response: %w", err)
-	}
-
-	// Compute shared secret and session key
-	if err := srpClient.ComputeSharedSecret(); err != nil {
-		return fmt.Errorf("failed to compute shared secret: %w", err)
-	}
-
-	// Phase 2: Compute client proof and send Verify request
-	M1, err := srpClient.ComputeClientProof()
-	if err != nil {
-		return fmt.Errorf("failed to compute client proof: %w", err)
-	}
-
-	verifyResp, err := apiClient.SRPVerify(initResp.SessionID, M1)
+	token, err := apiClient.Authenticate(username, password)
 	if err != nil {
-		return fmt.Errorf("SRP verify failed: %w", err)
-	}
-
-	// Verify server proof
-	if err := srpClient.VerifyServerProof(verifyResp.M2); err != nil {
-		return fmt.Errorf("server authentication failed: %w", err)
+		return err
 	}
 
 	// Save session token
@@ -155,11 +170,16 @@ func (c *PassCommand) authenticate(cfg *config.Config, username, password string
 		return fmt.Errorf("failed to access session store: %w", err)
 	}
 
-	if err := store.Save(cfg.Host, cfg.Port, verifyResp.SessionToken); err != nil {
+	if err := store.Save(cfg.Host, cfg.Port, token); err != nil {
 		return fmt.Errorf("failed to save session token: %w", err)
 	}
 
-	// Save connection config for future commands (so --host isn't required next time)
+	// Save connection config for future commands (so --host isn't required
+	// next time), unless a context already remembers it
+	if cfg.ContextName() != "" {
+		fmt.Fprintf(os.Stderr, "Authentication successful. Session token saved for context %s.\n", cfg.ContextName())
+		return nil
+	}
 	if err := cfg.Save(); err != nil {
 		// Log warning but don't fail - authentication already succeeded
 		fmt.Fprintf(os.Stderr, "Warning: failed to save connection config: %v\n", err)
@@ -169,6 +189,47 @@ func (c *PassCommand) authenticate(cfg *config.Config, username, password string
 	return nil
 }
 
+// readQRURI reads an onboarding URI from a file, or from stdin if path is
+// "-". The URI carries the device password, so it is not taken as an
+// argument, where other users could see it in the process list.
+func readQRURI(path string) (string, error) {
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path) // #nosec G304 - path is given by the user
+		if err != nil {
+			return "", fmt.Errorf("failed to read onboarding URI: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+	data, err := io.ReadAll(io.LimitReader(in, maxQRURIBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read onboarding URI: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// selectPayloadHost returns the first address from the onboarding payload that
+// accepts TCP connections on the service port. If none responds in time, the
+// first address is returned so the error surfaces during authentication.
+func selectPayloadHost(payload *qr.Payload) string {
+	addrs := payload.Addresses()
+	if len(addrs) == 0 {
+		return ""
+	}
+
+	for _, addr := range addrs {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(payload.Port)), 2*time.Second)
+		if err != nil {
+			continue
+		}
+		_ = conn.Close()
+		return addr
+	}
+
+	return addrs[0]
+}
+
 // promptUsername prompts the user to enter their username.
 func promptUsername() string {
 	fmt.Fprintf(os.Stderr, "Username: ")
@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/relay"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+)
+
+const defaultRelayListen = ":9457"
+
+// RelayCommand implements the 'relay' command, a rendezvous server that
+// devices behind NAT keep a tunnel open to and operators connect through.
+type RelayCommand struct{}
+
+// NewRelayCommand creates a new relay command instance.
+func NewRelayCommand() *RelayCommand {
+	return &RelayCommand{}
+}
+
+// Execute runs the relay command with the provided arguments.
+func (c *RelayCommand) Execute(args []string) {
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+
+	// Define flags
+	listen := fs.String("listen", defaultRelayListen, "Address to listen on")
+	certFile := fs.String("cert", "", "TLS certificate (default: generated self-signed certificate)")
+	keyFile := fs.String("key", "", "TLS private key (required with --cert)")
+	tokenFile := fs.String("token-file", "", "File with a token devices must present to open a tunnel")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding relay [flags]
+
+Run a rendezvous server for devices that cannot accept incoming
+connections, e.g. behind NAT. Devices with transports.relay enabled keep a
+WebSocket tunnel open to wss://<host>:9457; operators then reach a device
+with the global --relay flag:
+
+  boarding --relay wss://<host>:9457/devices/<device-id> pass
+
+TLS and SRP run end to end between the CLI and the device, so the relay
+only forwards ciphertext. GET /devices lists the connected devices as JSON.
+
+Without --cert, a self-signed certificate is generated on first use and
+kept in the user configuration directory. Copy it to the devices and set
+transports.relay.ca_cert to its path there, and pass it to the CLI with
+BOARDING_RELAY_CA_CERT.
+
+Flags:
+`)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Examples:
+  # Serve with a generated self-signed certificate
+  boarding relay
+
+  # Require devices to present a token
+  boarding relay --token-file relay-token
+
+  # Provision a device through the relay
+  BOARDING_RELAY_CA_CERT=relay.crt boarding --relay wss://relay.example.com:9457/devices/SN1234 pass
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		exitWithError("--cert and --key must be given together")
+	}
+
+	var token string
+	if *tokenFile != "" {
+		data, err := os.ReadFile(*tokenFile) // #nosec G304 - tokenFile is user-provided
+		if err != nil {
+			exitWithError("failed to read token: %v", err)
+		}
+		if token = strings.TrimSpace(string(data)); token == "" {
+			exitWithError("token file %s is empty", *tokenFile)
+		}
+	}
+
+	if *certFile == "" {
+		var err error
+		if *certFile, *keyFile, err = selfSignedCertificate("relay"); err != nil {
+			exitWithError("%v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := c.serve(ctx, *listen, *certFile, *keyFile, token); err != nil {
+		exitWithError("%v", err)
+	}
+}
+
+// serve relays connections until ctx is done.
+func (c *RelayCommand) serve(ctx context.Context, listen, certFile, keyFile, token string) error {
+	rendezvous := relay.NewServer(token)
+	rendezvous.SetTunnelCallback(func(dev relay.Device, connected bool) {
+		event := "disconnected"
+		if connected {
+			event = "connected"
+		}
+		fmt.Printf("%s  %s %s from %s\n", time.Now().Format(time.DateTime), dev.ID, event, dev.RemoteAddr)
+	})
+
+	// WebSocket upgrades take over the connection, which HTTP/2 does not allow
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           rendezvous,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+		Protocols:         protocols,
+	}
+
+	if fp, err := tlspkg.CertificateFingerprint(certFile); err == nil {
+		fmt.Fprintf(os.Stderr, "Relay certificate: %s (%s)\n", certFile, fp)
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s, press Ctrl+C to stop.\n", listen)
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServeTLS(certFile, keyFile) }()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("relay server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Tunnels and relayed connections are hijacked, so Shutdown does not
+	// wait for them
+	_ = rendezvous.Close()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to stop relay server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,554 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/client"
+	"github.com/fzdarsky/boardingpass/internal/cli/config"
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+	"github.com/fzdarsky/boardingpass/internal/cli/session"
+	"github.com/fzdarsky/boardingpass/internal/cli/shell"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"golang.org/x/term"
+)
+
+const (
+	shellHistoryFile = "shell_history"
+	keyCtrlC         = 3
+)
+
+// shellVerbs are the commands understood by 'boarding shell'.
+var shellVerbs = []string{"info", "connections", "commands", "command", "load", "complete", "help", "exit"}
+
+const shellVerbHelp = `  info [yaml|json]               Query system information
+  connections [yaml|json]        Query network interfaces
+  commands                       List the device's allow-listed commands
+  command <command-id> [params]  Execute an allow-listed command
+  load <directory>               Upload configuration
+  complete [--reboot]            Complete provisioning and leave the shell
+  help                           Show the verbs
+  exit                           Leave the shell (also Ctrl+D)
+`
+
+// ShellCommand implements the 'shell' command, an interactive session with
+// one device.
+type ShellCommand struct {
+	cfg      *config.Config
+	client   *client.Client
+	store    *session.Store
+	username string
+	password string
+
+	// commands are the device's allow-listed commands, for completion
+	commands []protocol.CommandInfo
+
+	// terminal is nil when stdin is not a terminal, e.g. for scripts
+	terminal *term.Terminal
+	out      io.Writer
+}
+
+// NewShellCommand creates a new shell command instance.
+func NewShellCommand() *ShellCommand {
+	return &ShellCommand{out: os.Stdout}
+}
+
+// Execute runs the shell command with the provided arguments.
+func (c *ShellCommand) Execute(args []string) {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+
+	// Define flags
+	host := fs.String("host", "", "BoardingPass service hostname or IP")
+	port := fs.Int("port", 0, "BoardingPass service port")
+	caCert := fs.String("ca-cert", "", "Path to custom CA certificate bundle")
+	username := fs.String("username", "", "Username for authentication")
+	password := fs.String("password", "", "Password for authentication (prompts if needed)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: boarding shell [flags]
+
+Start an interactive session with a device. The shell keeps one connection
+and session open, re-authenticates when the session expires, and completes
+verbs, command IDs (fetched from the device) and directories with Tab.
+History is kept across sessions.
+
+Verbs:
+%s
+An existing session token is used if there is one; otherwise the shell
+authenticates first. Quote parameters containing spaces.
+
+Flags:
+`, shellVerbHelp)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, `
+Examples:
+  # Open a shell on the device remembered from 'boarding pass'
+  boarding shell
+
+  # Open a shell on a device, authenticating as admin
+  boarding shell --host 192.168.1.100 --username admin
+
+  # Run verbs from a script
+  printf 'info json\ncommand set-hostname edge-01\n' | boarding shell
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		exitWithError("failed to parse flags: %v", err)
+	}
+
+	// Load base configuration
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError("failed to load configuration: %v", err)
+	}
+
+	// Apply command-line flags (highest priority)
+	cfg.ApplyFlags(*host, *port, *caCert)
+	c.cfg = cfg
+	c.username = *username
+	c.password = *password
+
+	if err := c.connect(); err != nil {
+		exitWithError("%v", err)
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		err = c.runTerminal()
+	} else {
+		err = c.run(bufio.NewScanner(os.Stdin))
+	}
+	if err != nil {
+		exitWithError("%v", err)
+	}
+}
+
+// connect creates the API client and makes sure it has a valid session,
+// which also fetches the command IDs for completion.
+func (c *ShellCommand) connect() error {
+	apiClient, err := createClient(c.cfg)
+	if err != nil {
+		return err
+	}
+	c.client = apiClient
+
+	if c.store, err = session.NewStore(); err != nil {
+		return fmt.Errorf("failed to access session store: %w", err)
+	}
+	token, err := c.store.Load(c.cfg.Host, c.cfg.Port)
+	if err != nil {
+		return fmt.Errorf("failed to load session token: %w", err)
+	}
+	if token == "" {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	} else {
+		c.client.SetSessionToken(token)
+	}
+
+	return c.refreshCommands()
+}
+
+// runTerminal reads verbs with line editing, completion and history.
+func (c *ShellCommand) runTerminal() error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to set up terminal: %w", err)
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	c.terminal = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, c.prompt())
+	c.out = c.terminal
+	if width, height, err := term.GetSize(fd); err == nil {
+		_ = c.terminal.SetSize(width, height)
+	}
+
+	var history *shell.History
+	if cacheDir, err := config.UserCacheDir(); err == nil {
+		history = shell.LoadHistory(filepath.Join(cacheDir, shellHistoryFile), shell.DefaultHistorySize)
+		c.terminal.History = history
+	}
+
+	completer := &shell.Completer{
+		Verbs: shellVerbs,
+		Args:  c.completeArgs,
+		Show: func(candidates []string) {
+			_, _ = fmt.Fprintln(c.terminal, strings.Join(candidates, "  "))
+		},
+	}
+	c.terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key == keyCtrlC {
+			// Discard the line rather than leaving the shell
+			_, _ = fmt.Fprintln(c.terminal, line+"^C")
+			return "", 0, true
+		}
+		return completer.Complete(line, pos, key)
+	}
+
+	fmt.Fprintf(c.out, "Connected to %s. Type 'help' for the verbs, Tab to complete.\n", c.cfg.Address())
+	for {
+		line, err := c.terminal.ReadLine()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		done, err := c.runLine(line)
+		if err != nil {
+			fmt.Fprintf(c.out, "Error: %v\n", err)
+		}
+		if done {
+			break
+		}
+	}
+
+	if history != nil {
+		if err := history.Save(); err != nil {
+			fmt.Fprintf(c.out, "Warning: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// run reads verbs from a non-interactive input, one per line, stopping at
+// the first error.
+func (c *ShellCommand) run(scanner *bufio.Scanner) error {
+	for scanner.Scan() {
+		done, err := c.runLine(scanner.Text())
+		if err != nil || done {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	return nil
+}
+
+// runLine executes one line of input and reports whether the shell is done.
+func (c *ShellCommand) runLine(line string) (bool, error) {
+	words, err := shell.Split(line)
+	if err != nil || len(words) == 0 {
+		return false, err
+	}
+
+	verb, args := words[0], words[1:]
+	switch verb {
+	case "info":
+		return false, c.withSession(func() error { return c.info(args) })
+	case "connections":
+		return false, c.withSession(func() error { return c.connections(args) })
+	case "commands":
+		return false, c.listCommands()
+	case "command":
+		return false, c.withSession(func() error { return c.command(args) })
+	case "load":
+		return false, c.withSession(func() error { return c.load(args) })
+	case "complete":
+		err := c.withSession(func() error { return c.complete(args) })
+		return err == nil, err
+	case "help", "?":
+		c.help()
+		return false, nil
+	case "exit", "quit":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown verb %q, type 'help' for the verbs", verb)
+	}
+}
+
+// withSession runs fn, re-authenticating and running it again if the
+// session expired.
+func (c *ShellCommand) withSession(fn func() error) error {
+	err := fn()
+	if !client.IsAuthError(err) {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Session expired, re-authenticating...\n")
+	if err := c.authenticate(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// authenticate runs the SRP handshake and stores the session token. The
+// credentials are kept for later re-authentication, unless rejected.
+func (c *ShellCommand) authenticate() error {
+	if c.username == "" {
+		c.username = c.cfg.Username
+	}
+	if c.username == "" {
+		username, err := c.readLine("Username: ")
+		if err != nil {
+			return err
+		}
+		c.username = username
+	}
+	if c.password == "" {
+		password, err := c.readPassword()
+		if err != nil {
+			return err
+		}
+		c.password = password
+	}
+
+	token, err := c.client.Authenticate(c.username, c.password)
+	if err != nil {
+		c.password = ""
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	if err := c.store.Save(c.cfg.Host, c.cfg.Port, token); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Authenticated with %s.\n", c.cfg.Address())
+	return nil
+}
+
+// readLine prompts for a line of input.
+func (c *ShellCommand) readLine(prompt string) (string, error) {
+	if c.terminal == nil {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", errors.New("no username given, use --username")
+		}
+		return promptUsername(), nil
+	}
+
+	c.terminal.SetPrompt(prompt)
+	defer c.terminal.SetPrompt(c.prompt())
+	line, err := c.terminal.ReadLine()
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readPassword prompts for the password without echoing it.
+func (c *ShellCommand) readPassword() (string, error) {
+	if c.terminal == nil {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", errors.New("no password given, use --password")
+		}
+		return promptPassword(), nil
+	}
+
+	password, err := c.terminal.ReadPassword("Password: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return password, nil
+}
+
+func (c *ShellCommand) prompt() string {
+	name := c.cfg.ContextName()
+	if name == "" {
+		name = c.cfg.Host
+	}
+	return fmt.Sprintf("boarding %s> ", name)
+}
+
+// completeArgs returns the completion candidates for verb arguments.
+func (c *ShellCommand) completeArgs(words []string, prefix string) []string {
+	switch words[0] {
+	case "info", "connections":
+		if len(words) == 1 {
+			return []string{"yaml", "json"}
+		}
+	case "command":
+		if len(words) == 1 {
+			ids := make([]string, 0, len(c.commands))
+			for _, cmd := range c.commands {
+				ids = append(ids, cmd.ID)
+			}
+			return ids
+		}
+		// Offer the allowed values of the param being typed
+		for _, cmd := range c.commands {
+			if cmd.ID == words[1] && len(words)-2 < len(cmd.Params) {
+				return cmd.Params[len(words)-2].Enum
+			}
+		}
+	case "load":
+		if len(words) == 1 {
+			return shell.Paths(prefix, true)
+		}
+	case "complete":
+		if len(words) == 1 {
+			return []string{"--reboot"}
+		}
+	}
+	return nil
+}
+
+func (c *ShellCommand) help() {
+	fmt.Fprintf(c.out, "Verbs:\n%s", shellVerbHelp)
+}
+
+// refreshCommands fetches the command catalog for completion.
+func (c *ShellCommand) refreshCommands() error {
+	return c.withSession(func() error {
+		list, err := c.client.ListCommands()
+		if err != nil {
+			return fmt.Errorf("failed to list commands: %w", err)
+		}
+		c.commands = list.Commands
+		return nil
+	})
+}
+
+func (c *ShellCommand) info(args []string) error {
+	format, err := shellFormat(args)
+	if err != nil {
+		return err
+	}
+	info, err := c.client.GetInfo()
+	if err != nil {
+		return fmt.Errorf("failed to query system information: %w", err)
+	}
+	return c.print(info, format)
+}
+
+func (c *ShellCommand) connections(args []string) error {
+	format, err := shellFormat(args)
+	if err != nil {
+		return err
+	}
+	network, err := c.client.GetNetwork()
+	if err != nil {
+		return fmt.Errorf("failed to query network configuration: %w", err)
+	}
+	return c.print(network, format)
+}
+
+func (c *ShellCommand) listCommands() error {
+	if err := c.refreshCommands(); err != nil {
+		return err
+	}
+	for _, cmd := range c.commands {
+		synopsis := commandSynopsis(cmd)
+		if cmd.Description == "" {
+			fmt.Fprintln(c.out, synopsis)
+			continue
+		}
+		fmt.Fprintf(c.out, "%-30s %s\n", synopsis, cmd.Description)
+	}
+	return nil
+}
+
+// commandSynopsis returns the command ID followed by its params, with
+// optional ones in brackets.
+func commandSynopsis(cmd protocol.CommandInfo) string {
+	words := []string{cmd.ID}
+	switch {
+	case len(cmd.Params) > 0:
+		for _, p := range cmd.Params {
+			if p.Optional {
+				words = append(words, "["+p.Name+"]")
+			} else {
+				words = append(words, "<"+p.Name+">")
+			}
+		}
+	case cmd.MaxParams > 0:
+		words = append(words, fmt.Sprintf("[params (max %d)]", cmd.MaxParams))
+	}
+	return strings.Join(words, " ")
+}
+
+func (c *ShellCommand) command(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: command <command-id> [params...]")
+	}
+
+	resp, err := c.client.ExecuteCommand(args[0], args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to execute command: %w", err)
+	}
+	fmt.Fprint(c.out, resp.Stdout)
+	fmt.Fprint(c.out, resp.Stderr)
+	if resp.Truncated {
+		fmt.Fprintln(c.out, "(output truncated by the device)")
+	}
+	if resp.ExitCode != 0 {
+		return fmt.Errorf("command exited with code %d", resp.ExitCode)
+	}
+	return nil
+}
+
+func (c *ShellCommand) load(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: load <directory>")
+	}
+
+	files, err := (&LoadCommand{}).scanDirectory(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to scan directory: %w", err)
+	}
+	if len(files) == 0 {
+		return errors.New("no files found in directory")
+	}
+	if err := c.client.PostConfigure(&protocol.ConfigBundle{Files: files}); err != nil {
+		return fmt.Errorf("failed to upload configuration: %w", err)
+	}
+	fmt.Fprintf(c.out, "Configuration uploaded successfully (%d file(s))\n", len(files))
+	return nil
+}
+
+func (c *ShellCommand) complete(args []string) error {
+	reboot := false
+	for _, arg := range args {
+		if arg != "--reboot" {
+			return errors.New("usage: complete [--reboot]")
+		}
+		reboot = true
+	}
+
+	resp, err := c.client.Complete(reboot)
+	if err != nil {
+		return fmt.Errorf("failed to complete provisioning: %w", err)
+	}
+	if err := c.store.Delete(c.cfg.Host, c.cfg.Port); err != nil {
+		fmt.Fprintf(c.out, "Warning: %v\n", err)
+	}
+	fmt.Fprintf(c.out, "Provisioning completed (status: %s).\n", resp.Status)
+	if resp.Message != nil && *resp.Message != "" {
+		fmt.Fprintf(c.out, "%s\n", *resp.Message)
+	}
+	return nil
+}
+
+// print writes data in the given format.
+func (c *ShellCommand) print(data any, format output.Format) error {
+	formatted, err := output.FormatData(data, format)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+	if !strings.HasSuffix(formatted, "\n") {
+		formatted += "\n"
+	}
+	fmt.Fprint(c.out, formatted)
+	return nil
+}
+
+// shellFormat parses the optional output format argument of a verb.
+func shellFormat(args []string) (output.Format, error) {
+	switch len(args) {
+	case 0:
+		return output.FormatYAML, nil
+	case 1:
+		return output.ParseFormat(args[0])
+	default:
+		return "", errors.New("too many arguments")
+	}
+}
@@ -2,10 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 
+	"github.com/fzdarsky/boardingpass/internal/cli/clicontext"
+	"github.com/fzdarsky/boardingpass/internal/serial"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,22 +19,47 @@ const (
 	envHost        = "BOARDING_HOST"
 	envPort        = "BOARDING_PORT"
 	envCACert      = "BOARDING_CA_CERT"
+	envSerial      = "BOARDING_SERIAL"
+	envBaudRate    = "BOARDING_BAUD_RATE"
+	envRelay       = "BOARDING_RELAY"
+	envRelayCACert = "BOARDING_RELAY_CA_CERT"
 	minPort        = 1
 	maxPort        = 65535
 )
 
 // Config holds the configuration for the boarding CLI tool.
 type Config struct {
-	Host   string `yaml:"host"`
-	Port   int    `yaml:"port"`
-	CACert string `yaml:"ca_cert"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	CACert   string `yaml:"ca_cert"`
+	Serial   string `yaml:"serial,omitempty"`
+	BaudRate int    `yaml:"baud_rate,omitempty"`
+
+	// Username is the default for 'boarding pass', set by contexts.
+	Username string `yaml:"username,omitempty"`
+
+	// Relay is the rendezvous server URL of a device that cannot be reached
+	// directly, e.g. wss://relay.example.com:9457/devices/SN1234.
+	Relay       string `yaml:"relay,omitempty"`
+	RelayCACert string `yaml:"relay_ca_cert,omitempty"`
+
+	// serialSelected and relaySelected record that the serial device or
+	// relay was chosen for this invocation rather than remembered in the
+	// config file.
+	serialSelected bool
+	relaySelected  bool
+
+	// contextName is the context the settings came from, if any.
+	contextName string
 }
 
 // Load loads configuration from file, environment variables, and applies defaults.
 // Precedence order (highest to lowest):
-// 1. Environment variables
-// 2. Config file
-// 3. Defaults
+// 1. Global flags (--context, --serial, --relay)
+// 2. Environment variables
+// 3. Current context
+// 4. Config file
+// 5. Defaults
 //
 // Note: Command-line flags are applied by individual commands after calling Load().
 func Load() (*Config, error) {
@@ -46,9 +75,30 @@ func Load() (*Config, error) {
 		}
 	}
 
+	// Layer 1b: The current context, or the one selected with --context,
+	// which is applied with the global flags
+	ctx, err := selectedContext()
+	if err != nil {
+		return nil, err
+	}
+	if ctx != nil && clicontext.Context() == "" {
+		cfg.applyContext(ctx)
+	}
+
 	// Layer 2: Load from environment variables (medium priority)
 	cfg.loadFromEnv()
 
+	// Layer 3: Global flags
+	if ctx != nil && clicontext.Context() != "" {
+		cfg.applyContext(ctx)
+	}
+	if serial := clicontext.Serial(); serial != "" {
+		cfg.selectSerial(serial)
+	}
+	if relay := clicontext.Relay(); relay != "" {
+		cfg.selectRelay(relay)
+	}
+
 	// Validation
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -86,6 +136,21 @@ func (c *Config) loadFromFile() error {
 	if fileConfig.CACert != "" {
 		c.CACert = fileConfig.CACert
 	}
+	if fileConfig.Serial != "" {
+		c.Serial = fileConfig.Serial
+	}
+	if fileConfig.BaudRate != 0 {
+		c.BaudRate = fileConfig.BaudRate
+	}
+	if fileConfig.Username != "" {
+		c.Username = fileConfig.Username
+	}
+	if fileConfig.Relay != "" {
+		c.Relay = fileConfig.Relay
+	}
+	if fileConfig.RelayCACert != "" {
+		c.RelayCACert = fileConfig.RelayCACert
+	}
 
 	return nil
 }
@@ -105,6 +170,61 @@ func (c *Config) loadFromEnv() {
 	if caCert := os.Getenv(envCACert); caCert != "" {
 		c.CACert = caCert
 	}
+
+	if serial := os.Getenv(envSerial); serial != "" {
+		c.selectSerial(serial)
+	}
+
+	if baudStr := os.Getenv(envBaudRate); baudStr != "" {
+		if baud, err := strconv.Atoi(baudStr); err == nil {
+			c.BaudRate = baud
+		}
+	}
+
+	if relay := os.Getenv(envRelay); relay != "" {
+		c.selectRelay(relay)
+	}
+
+	if caCert := os.Getenv(envRelayCACert); caCert != "" {
+		c.RelayCACert = caCert
+	}
+}
+
+// selectSerial connects through a serial device for this invocation. The host
+// then only names the device for certificate pinning and session storage, and
+// defaults to the device's base name (e.g. ttyUSB0).
+func (c *Config) selectSerial(device string) {
+	c.Serial = device
+	c.Host = filepath.Base(device)
+	c.serialSelected = true
+	if !c.relaySelected {
+		c.Relay = ""
+	}
+}
+
+// selectRelay connects through a rendezvous server for this invocation. As
+// with a serial device, the host defaults to the device ID, the last
+// element of the URL path.
+func (c *Config) selectRelay(relayURL string) {
+	c.Relay = relayURL
+	c.Host = relayDeviceID(relayURL)
+	c.relaySelected = true
+	if !c.serialSelected {
+		c.Serial = ""
+	}
+}
+
+// relayDeviceID returns the device ID in a relay URL, or "" if it has none.
+func relayDeviceID(relayURL string) string {
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return ""
+	}
+	id := path.Base(u.Path)
+	if id == "/" || id == "." {
+		return ""
+	}
+	return id
 }
 
 // ApplyFlags applies command-line flag values to the configuration.
@@ -112,6 +232,14 @@ func (c *Config) loadFromEnv() {
 func (c *Config) ApplyFlags(host string, port int, caCert string) {
 	if host != "" {
 		c.Host = host
+		// An explicit host switches back to the network unless a serial
+		// device or relay was also selected for this invocation
+		if !c.serialSelected {
+			c.Serial = ""
+		}
+		if !c.relaySelected {
+			c.Relay = ""
+		}
 	}
 	if port != 0 {
 		c.Port = port
@@ -132,6 +260,20 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid port %d: must be between %d and %d", c.Port, minPort, maxPort)
 	}
 
+	if c.Serial != "" && c.BaudRate != 0 && !serial.SupportedBaudRate(c.BaudRate) {
+		return fmt.Errorf("unsupported baud rate %d", c.BaudRate)
+	}
+
+	if c.Relay != "" {
+		if c.Serial != "" {
+			return fmt.Errorf("cannot connect through both a serial line and a relay")
+		}
+		u, err := url.Parse(c.Relay)
+		if err != nil || u.Scheme != "wss" || u.Host == "" || relayDeviceID(c.Relay) == "" {
+			return fmt.Errorf("invalid relay URL %q: must be wss://<host>[:port]/devices/<device-id>", c.Relay)
+		}
+	}
+
 	// CA cert validation - if specified, file must exist
 	if c.CACert != "" {
 		if _, err := os.Stat(c.CACert); err != nil {
@@ -156,6 +298,11 @@ func (c *Config) RequireHost() error {
 	return nil
 }
 
+// ContextName returns the name of the context in use, or "" if none is.
+func (c *Config) ContextName() string {
+	return c.contextName
+}
+
 // Address returns the host:port address for connecting to BoardingPass service.
 func (c *Config) Address() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/fzdarsky/boardingpass/internal/cli/clicontext"
 	"github.com/fzdarsky/boardingpass/internal/cli/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -401,14 +402,193 @@ func TestConfig_Address(t *testing.T) {
 	}
 }
 
+func TestConfig_Serial(t *testing.T) {
+	t.Run("env selects serial and names the host after the device", func(t *testing.T) {
+		clearEnv(t)
+		setupNoConfigFile(t)
+		t.Setenv("BOARDING_SERIAL", "/dev/ttyUSB0")
+		t.Setenv("BOARDING_BAUD_RATE", "921600")
+
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "/dev/ttyUSB0", cfg.Serial)
+		assert.Equal(t, 921600, cfg.BaudRate)
+		assert.Equal(t, "ttyUSB0", cfg.Host)
+
+		// --host only renames the device when serial was selected explicitly
+		cfg.ApplyFlags("gateway.local", 0, "")
+		assert.Equal(t, "/dev/ttyUSB0", cfg.Serial)
+		assert.Equal(t, "gateway.local", cfg.Host)
+	})
+
+	t.Run("explicit host overrides remembered serial device", func(t *testing.T) {
+		clearEnv(t)
+		setupConfigFile(t, "host: ttyUSB0\nserial: /dev/ttyUSB0\n")
+
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "/dev/ttyUSB0", cfg.Serial)
+
+		cfg.ApplyFlags("192.168.1.100", 0, "")
+		assert.Empty(t, cfg.Serial)
+		assert.Equal(t, "192.168.1.100", cfg.Host)
+	})
+
+	t.Run("unsupported baud rate", func(t *testing.T) {
+		clearEnv(t)
+		setupNoConfigFile(t)
+		t.Setenv("BOARDING_SERIAL", "/dev/ttyUSB0")
+		t.Setenv("BOARDING_BAUD_RATE", "12345")
+
+		_, err := config.Load()
+		assert.ErrorContains(t, err, "unsupported baud rate")
+	})
+}
+
+func TestConfig_Relay(t *testing.T) {
+	t.Run("env selects relay and names the host after the device", func(t *testing.T) {
+		clearEnv(t)
+		setupNoConfigFile(t)
+		t.Setenv("BOARDING_RELAY", "wss://relay.example.com:9457/devices/SN%201234")
+
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "wss://relay.example.com:9457/devices/SN%201234", cfg.Relay)
+		assert.Equal(t, "SN 1234", cfg.Host)
+
+		// --host only renames the device when the relay was selected explicitly
+		cfg.ApplyFlags("gateway.local", 0, "")
+		assert.NotEmpty(t, cfg.Relay)
+		assert.Equal(t, "gateway.local", cfg.Host)
+	})
+
+	t.Run("relay replaces remembered serial device", func(t *testing.T) {
+		clearEnv(t)
+		setupConfigFile(t, "host: ttyUSB0\nserial: /dev/ttyUSB0\n")
+		t.Setenv("BOARDING_RELAY", "wss://relay.example.com/devices/SN1234")
+
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Empty(t, cfg.Serial)
+		assert.Equal(t, "SN1234", cfg.Host)
+	})
+
+	t.Run("explicit host overrides remembered relay", func(t *testing.T) {
+		clearEnv(t)
+		setupConfigFile(t, "host: SN1234\nrelay: wss://relay.example.com/devices/SN1234\n")
+
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		cfg.ApplyFlags("192.168.1.100", 0, "")
+		assert.Empty(t, cfg.Relay)
+	})
+
+	t.Run("serial and relay together", func(t *testing.T) {
+		clearEnv(t)
+		setupNoConfigFile(t)
+		t.Setenv("BOARDING_SERIAL", "/dev/ttyUSB0")
+		t.Setenv("BOARDING_RELAY", "wss://relay.example.com/devices/SN1234")
+
+		_, err := config.Load()
+		assert.ErrorContains(t, err, "both a serial line and a relay")
+	})
+
+	t.Run("invalid relay URL", func(t *testing.T) {
+		for _, u := range []string{"https://relay.example.com/devices/SN1234", "wss://relay.example.com"} {
+			clearEnv(t)
+			setupNoConfigFile(t)
+			t.Setenv("BOARDING_RELAY", u)
+
+			_, err := config.Load()
+			assert.ErrorContains(t, err, "invalid relay URL", u)
+		}
+	})
+}
+
+func TestContexts(t *testing.T) {
+	clearEnv(t)
+	setupConfigFile(t, "host: remembered.local\nport: 9443\n")
+
+	contexts, err := config.LoadContexts()
+	require.NoError(t, err)
+	assert.Empty(t, contexts.Contexts)
+
+	require.NoError(t, contexts.Set(config.Context{Name: "edge-01", Host: "192.168.1.101", Username: "admin"}))
+	require.NoError(t, contexts.Set(config.Context{Name: "edge-02", Host: "192.168.1.102", Port: 9000}))
+	require.NoError(t, contexts.Set(config.Context{Name: "edge-01", Host: "192.168.1.111", Username: "admin"}))
+	assert.ErrorContains(t, contexts.Set(config.Context{Name: "no host"}), "invalid context name")
+	assert.ErrorContains(t, contexts.Set(config.Context{Name: "edge-03"}), "host is required")
+	assert.ErrorContains(t, contexts.Use("missing"), "not found")
+	require.NoError(t, contexts.Use("edge-01"))
+	require.NoError(t, contexts.Save())
+
+	t.Run("current context overrides the config file", func(t *testing.T) {
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "192.168.1.111", cfg.Host)
+		assert.Equal(t, 9455, cfg.Port, "context port replaces the remembered one")
+		assert.Equal(t, "admin", cfg.Username)
+		assert.Equal(t, "edge-01", cfg.ContextName())
+	})
+
+	t.Run("environment overrides the current context", func(t *testing.T) {
+		t.Setenv("BOARDING_HOST", "env.local")
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "env.local", cfg.Host)
+	})
+
+	t.Run("--context overrides the current context and environment", func(t *testing.T) {
+		t.Setenv("BOARDING_HOST", "env.local")
+		selectContext(t, "edge-02")
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "192.168.1.102", cfg.Host)
+		assert.Equal(t, 9000, cfg.Port)
+		assert.Empty(t, cfg.Username)
+		assert.Equal(t, "edge-02", cfg.ContextName())
+	})
+
+	t.Run("unknown context", func(t *testing.T) {
+		selectContext(t, "missing")
+		_, err := config.Load()
+		assert.ErrorContains(t, err, `context "missing" not found`)
+	})
+
+	t.Run("deleting the current context", func(t *testing.T) {
+		contexts, err := config.LoadContexts()
+		require.NoError(t, err)
+		assert.True(t, contexts.Delete("edge-01"))
+		assert.False(t, contexts.Delete("edge-01"))
+		assert.Empty(t, contexts.Current)
+		require.NoError(t, contexts.Save())
+
+		cfg, err := config.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "remembered.local", cfg.Host)
+		assert.Equal(t, 9443, cfg.Port)
+		assert.Empty(t, cfg.ContextName())
+	})
+}
+
 // Helper functions
 
+func selectContext(t *testing.T, name string) {
+	t.Helper()
+	clicontext.SetContext(name)
+	t.Cleanup(func() { clicontext.SetContext("") })
+}
+
 func clearEnv(t *testing.T) {
 	t.Helper()
 	// Clear relevant environment variables
 	_ = os.Unsetenv("BOARDING_HOST")
 	_ = os.Unsetenv("BOARDING_PORT")
 	_ = os.Unsetenv("BOARDING_CA_CERT")
+	_ = os.Unsetenv("BOARDING_SERIAL")
+	_ = os.Unsetenv("BOARDING_BAUD_RATE")
+	_ = os.Unsetenv("BOARDING_RELAY")
+	_ = os.Unsetenv("BOARDING_RELAY_CA_CERT")
 }
 
 func setupConfigFile(t *testing.T, content string) {
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/clicontext"
+	"gopkg.in/yaml.v3"
+)
+
+const contextsFileName = "contexts.yaml"
+
+// Context is a named set of connection settings for one device, so
+// switching devices doesn't require --host on every command.
+type Context struct {
+	Name     string `json:"name" yaml:"name"`
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port,omitempty" yaml:"port,omitempty"`
+	CACert   string `json:"ca_cert,omitempty" yaml:"ca_cert,omitempty"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+
+	// Session is the file holding the context's session token.
+	Session string `json:"session,omitempty" yaml:"session,omitempty"`
+}
+
+// Contexts is the set of contexts stored in the user config directory.
+type Contexts struct {
+	Current  string    `yaml:"current,omitempty"`
+	Contexts []Context `yaml:"contexts"`
+}
+
+// LoadContexts loads the contexts file. A missing file yields no contexts.
+func LoadContexts() (*Contexts, error) {
+	path, err := contextsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 - path is in the user config directory
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Contexts{}, nil
+		}
+		return nil, fmt.Errorf("failed to read contexts: %w", err)
+	}
+
+	var contexts Contexts
+	if err := yaml.Unmarshal(data, &contexts); err != nil {
+		return nil, fmt.Errorf("failed to parse contexts file %s: %w", path, err)
+	}
+	return &contexts, nil
+}
+
+// Save persists the contexts file.
+func (c *Contexts) Save() error {
+	configDir, err := UserConfigDir()
+	if err != nil {
+		return fmt.Errorf("failed to get config directory: %w", err)
+	}
+	if err := EnsureDir(configDir); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal contexts: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, contextsFileName), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write contexts file: %w", err)
+	}
+	return nil
+}
+
+// Get returns the named context.
+func (c *Contexts) Get(name string) (*Context, bool) {
+	i := slices.IndexFunc(c.Contexts, func(ctx Context) bool { return ctx.Name == name })
+	if i < 0 {
+		return nil, false
+	}
+	return &c.Contexts[i], true
+}
+
+// Set adds a context, replacing any context of the same name.
+func (c *Contexts) Set(ctx Context) error {
+	if err := ctx.validate(); err != nil {
+		return err
+	}
+	if existing, ok := c.Get(ctx.Name); ok {
+		*existing = ctx
+		return nil
+	}
+	c.Contexts = append(c.Contexts, ctx)
+	return nil
+}
+
+// Delete removes the named context. Deleting the current context unsets it.
+func (c *Contexts) Delete(name string) bool {
+	n := len(c.Contexts)
+	c.Contexts = slices.DeleteFunc(c.Contexts, func(ctx Context) bool { return ctx.Name == name })
+	if c.Current == name {
+		c.Current = ""
+	}
+	return len(c.Contexts) < n
+}
+
+// Use makes the named context the current one.
+func (c *Contexts) Use(name string) error {
+	if _, ok := c.Get(name); !ok {
+		return fmt.Errorf("context %q not found", name)
+	}
+	c.Current = name
+	return nil
+}
+
+func (ctx *Context) validate() error {
+	if ctx.Name == "" || strings.ContainsAny(ctx.Name, " \t\n/") {
+		return fmt.Errorf("invalid context name %q", ctx.Name)
+	}
+	if ctx.Host == "" {
+		return errors.New("context host is required")
+	}
+	if ctx.Port != 0 && (ctx.Port < minPort || ctx.Port > maxPort) {
+		return fmt.Errorf("invalid port %d: must be between %d and %d", ctx.Port, minPort, maxPort)
+	}
+	return nil
+}
+
+// selectedContext returns the context selected with --context, or else the
+// current context, if any.
+func selectedContext() (*Context, error) {
+	contexts, err := LoadContexts()
+	if err != nil {
+		return nil, err
+	}
+	name := clicontext.Context()
+	if name == "" {
+		name = contexts.Current
+	}
+	if name == "" {
+		return nil, nil
+	}
+	ctx, ok := contexts.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("context %q not found", name)
+	}
+	return ctx, nil
+}
+
+// applyContext uses the context's connection settings. Like an explicit
+// host, a context switches back to the network unless a serial device or
+// relay was selected for this invocation.
+func (c *Config) applyContext(ctx *Context) {
+	c.Host = ctx.Host
+	c.Port = ctx.Port
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	c.CACert = ctx.CACert
+	c.Username = ctx.Username
+	c.contextName = ctx.Name
+	if !c.serialSelected {
+		c.Serial = ""
+	}
+	if !c.relaySelected {
+		c.Relay = ""
+	}
+}
+
+func contextsPath() (string, error) {
+	configDir, err := UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, contextsFileName), nil
+}
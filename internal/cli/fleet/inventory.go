@@ -0,0 +1,163 @@
+// Package fleet provisions many BoardingPass devices concurrently. An
+// inventory lists the devices with their credentials; a runner applies the
+// same steps to each of them with bounded parallelism, continuing past
+// failed devices, and collects a per-device report.
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPort is the service port used unless the inventory sets one.
+const DefaultPort = 9455
+
+// Device is an inventory entry. Defaults apply to fields a device leaves
+// empty.
+type Device struct {
+	Name            string            `yaml:"name,omitempty"` // label in reports (default: host)
+	Host            string            `yaml:"host,omitempty"`
+	Port            int               `yaml:"port,omitempty"`
+	CACert          string            `yaml:"ca_cert,omitempty"`
+	Username        string            `yaml:"username,omitempty"`
+	Password        string            `yaml:"password,omitempty"`
+	PasswordCommand []string          `yaml:"password_command,omitempty"` // prints the password on stdout
+	Vars            map[string]string `yaml:"vars,omitempty"`             // for ${var} in password commands and command parameters
+}
+
+// Inventory is a list of devices to provision.
+type Inventory struct {
+	Defaults Device   `yaml:"defaults"`
+	Devices  []Device `yaml:"devices"`
+}
+
+// LoadInventory reads an inventory file and applies its defaults to each
+// device.
+func LoadInventory(path string) ([]Device, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - path is the user-provided inventory
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+	return ParseInventory(data)
+}
+
+// ParseInventory parses an inventory and applies its defaults to each
+// device.
+func ParseInventory(data []byte) ([]Device, error) {
+	var inv Inventory
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&inv); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory: %w", err)
+	}
+	if len(inv.Devices) == 0 {
+		return nil, errors.New("inventory lists no devices")
+	}
+
+	devices := make([]Device, 0, len(inv.Devices))
+	seen := make(map[string]bool, len(inv.Devices))
+	for i, dev := range inv.Devices {
+		dev = dev.withDefaults(inv.Defaults)
+		if dev.Host == "" {
+			return nil, fmt.Errorf("device %d: host is required", i+1)
+		}
+		if dev.Port < 1 || dev.Port > 65535 {
+			return nil, fmt.Errorf("device %s: invalid port %d", dev.Name, dev.Port)
+		}
+		if dev.Username == "" {
+			return nil, fmt.Errorf("device %s: username is required", dev.Name)
+		}
+		if dev.Password == "" && len(dev.PasswordCommand) == 0 {
+			return nil, fmt.Errorf("device %s: password or password_command is required", dev.Name)
+		}
+		if seen[dev.Name] {
+			return nil, fmt.Errorf("device %s is listed more than once", dev.Name)
+		}
+		seen[dev.Name] = true
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+// withDefaults fills in the fields the device leaves empty. A device's
+// password takes precedence over a default password command and vice versa.
+func (d Device) withDefaults(defaults Device) Device {
+	if d.Port == 0 {
+		d.Port = defaults.Port
+	}
+	if d.Port == 0 {
+		d.Port = DefaultPort
+	}
+	if d.CACert == "" {
+		d.CACert = defaults.CACert
+	}
+	if d.Username == "" {
+		d.Username = defaults.Username
+	}
+	if d.Password == "" && len(d.PasswordCommand) == 0 {
+		d.Password = defaults.Password
+		d.PasswordCommand = defaults.PasswordCommand
+	}
+	vars := make(map[string]string, len(defaults.Vars)+len(d.Vars))
+	maps.Copy(vars, defaults.Vars)
+	maps.Copy(vars, d.Vars)
+	d.Vars = vars
+	if d.Name == "" {
+		d.Name = d.Host
+	}
+	return d
+}
+
+// Expand replaces ${var} and $var in s with the device's variables. Besides
+// those from the inventory, name, host and port are always defined.
+func (d Device) Expand(s string) string {
+	return os.Expand(s, func(key string) string {
+		switch key {
+		case "name":
+			return d.Name
+		case "host":
+			return d.Host
+		case "port":
+			return strconv.Itoa(d.Port)
+		}
+		return d.Vars[key]
+	})
+}
+
+// ResolvePassword returns the device's password, running its password
+// command if it has one.
+func (d Device) ResolvePassword(ctx context.Context) (string, error) {
+	if len(d.PasswordCommand) == 0 {
+		return d.Password, nil
+	}
+
+	args := make([]string, len(d.PasswordCommand))
+	for i, arg := range d.PasswordCommand {
+		args[i] = d.Expand(arg)
+	}
+	//nolint:gosec // G204: the password command comes from the user's inventory
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("password command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+	password := strings.TrimSpace(string(out))
+	if password == "" {
+		return "", errors.New("password command printed no password")
+	}
+	return password, nil
+}
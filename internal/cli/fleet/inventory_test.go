@@ -0,0 +1,99 @@
+package fleet_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/fleet"
+)
+
+func TestParseInventory(t *testing.T) {
+	devices, err := fleet.ParseInventory([]byte(`
+defaults:
+  username: admin
+  port: 8443
+  password_command: ["echo", "pw-${serial}"]
+  vars:
+    site: lab
+devices:
+  - host: 192.0.2.1
+    vars:
+      serial: SN1
+  - name: rack1-u2
+    host: 192.0.2.2
+    port: 9455
+    username: root
+    password: secret
+`))
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+
+	assert.Equal(t, "192.0.2.1", devices[0].Name)
+	assert.Equal(t, 8443, devices[0].Port)
+	assert.Equal(t, "admin", devices[0].Username)
+	assert.Equal(t, map[string]string{"site": "lab", "serial": "SN1"}, devices[0].Vars)
+
+	assert.Equal(t, "rack1-u2", devices[1].Name)
+	assert.Equal(t, 9455, devices[1].Port)
+	assert.Equal(t, "root", devices[1].Username)
+	assert.Equal(t, "secret", devices[1].Password)
+	assert.Empty(t, devices[1].PasswordCommand, "a device password overrides the default command")
+
+	password, err := devices[0].ResolvePassword(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "pw-SN1", password)
+	password, err = devices[1].ResolvePassword(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "secret", password)
+}
+
+func TestParseInventory_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		inventory   string
+		expectedErr string
+	}{
+		{name: "empty", inventory: "devices: []\n", expectedErr: "no devices"},
+		{name: "missing host", inventory: "devices:\n  - username: a\n    password: b\n", expectedErr: "host is required"},
+		{name: "missing username", inventory: "devices:\n  - host: h\n    password: b\n", expectedErr: "username is required"},
+		{name: "missing password", inventory: "devices:\n  - host: h\n    username: a\n", expectedErr: "password"},
+		{
+			name:        "invalid port",
+			inventory:   "devices:\n  - host: h\n    port: 70000\n    username: a\n    password: b\n",
+			expectedErr: "invalid port",
+		},
+		{
+			name:        "duplicate",
+			inventory:   "defaults:\n  username: a\n  password: b\ndevices:\n  - host: h\n  - host: h\n",
+			expectedErr: "more than once",
+		},
+		{name: "unknown field", inventory: "devices:\n  - hots: h\n", expectedErr: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fleet.ParseInventory([]byte(tt.inventory))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedErr)
+		})
+	}
+}
+
+func TestDevice_Expand(t *testing.T) {
+	dev := fleet.Device{Name: "u1", Host: "192.0.2.1", Port: 9455, Vars: map[string]string{"hostname": "edge-01"}}
+	assert.Equal(t, "edge-01 u1 192.0.2.1:9455 ", dev.Expand("${hostname} $name ${host}:${port} ${unset}"))
+}
+
+func TestDevice_ResolvePassword_CommandFails(t *testing.T) {
+	dev := fleet.Device{PasswordCommand: []string{"sh", "-c", "echo no such device >&2; exit 3"}}
+	_, err := dev.ResolvePassword(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such device")
+
+	dev.PasswordCommand = []string{"true"}
+	_, err = dev.ResolvePassword(context.Background())
+	assert.ErrorContains(t, err, "no password")
+}
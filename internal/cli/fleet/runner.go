@@ -0,0 +1,189 @@
+package fleet
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/client"
+)
+
+// Step results.
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped" // an earlier step failed or the run was cancelled
+)
+
+// DefaultParallel is the number of devices provisioned at once by default.
+const DefaultParallel = 10
+
+// Target is a device being provisioned. Steps share it, e.g. the
+// authentication step sets the client later steps use.
+type Target struct {
+	Device
+	Client *client.Client
+}
+
+// Step is an operation applied to every device.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context, t *Target) error
+}
+
+// StepResult is the outcome of a step on one device.
+type StepResult struct {
+	Step       string `json:"step" yaml:"step"`
+	Status     string `json:"status" yaml:"status"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms" yaml:"duration_ms"`
+}
+
+// DeviceResult is the outcome of all steps on one device.
+type DeviceResult struct {
+	Name    string       `json:"name" yaml:"name"`
+	Host    string       `json:"host" yaml:"host"`
+	Port    int          `json:"port" yaml:"port"`
+	Success bool         `json:"success" yaml:"success"`
+	Steps   []StepResult `json:"steps" yaml:"steps"`
+}
+
+// Error returns the first error of the device's steps, or "".
+func (r *DeviceResult) Error() string {
+	for _, s := range r.Steps {
+		if s.Status == StatusFailed {
+			return s.Error
+		}
+	}
+	return ""
+}
+
+// Report is the outcome of a fleet run, with devices in inventory order.
+type Report struct {
+	StartedAt  time.Time      `json:"started_at" yaml:"started_at"`
+	FinishedAt time.Time      `json:"finished_at" yaml:"finished_at"`
+	Steps      []string       `json:"steps" yaml:"steps"`
+	Succeeded  int            `json:"succeeded" yaml:"succeeded"`
+	Failed     int            `json:"failed" yaml:"failed"`
+	Devices    []DeviceResult `json:"devices" yaml:"devices"`
+}
+
+// TableHeader implements output.Table.
+func (r *Report) TableHeader() []string {
+	header := []string{"DEVICE", "HOST"}
+	for _, step := range r.Steps {
+		header = append(header, strings.ToUpper(step))
+	}
+	return append(header, "ERROR")
+}
+
+// TableRows implements output.Table.
+func (r *Report) TableRows() [][]string {
+	rows := make([][]string, 0, len(r.Devices))
+	for i := range r.Devices {
+		dev := &r.Devices[i]
+		row := []string{dev.Name, dev.Host}
+		for _, s := range dev.Steps {
+			row = append(row, s.Status)
+		}
+		errMsg := dev.Error()
+		if errMsg == "" {
+			errMsg = "-"
+		}
+		rows = append(rows, append(row, errMsg))
+	}
+	return rows
+}
+
+// Runner applies steps to devices concurrently.
+type Runner struct {
+	// Parallel bounds the number of devices provisioned at once.
+	Parallel int
+	// OnStep, if set, is called as each step finishes. Calls are
+	// serialized.
+	OnStep func(dev Device, result StepResult)
+
+	mu sync.Mutex
+}
+
+// Run applies the steps to each device in order. A device's remaining steps
+// are skipped once one fails, while other devices carry on. Run returns when
+// all devices are done; if ctx is cancelled, steps not yet started are
+// skipped.
+func (r *Runner) Run(ctx context.Context, devices []Device, steps []Step) *Report {
+	report := &Report{
+		StartedAt: time.Now(),
+		Devices:   make([]DeviceResult, len(devices)),
+	}
+	for _, step := range steps {
+		report.Steps = append(report.Steps, step.Name)
+	}
+
+	parallel := r.Parallel
+	if parallel < 1 {
+		parallel = DefaultParallel
+	}
+	slots := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, dev := range devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+			}
+			report.Devices[i] = r.runDevice(ctx, dev, steps)
+		}()
+	}
+	wg.Wait()
+
+	for _, dev := range report.Devices {
+		if dev.Success {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+	report.FinishedAt = time.Now()
+	return report
+}
+
+// runDevice applies the steps to one device.
+func (r *Runner) runDevice(ctx context.Context, dev Device, steps []Step) DeviceResult {
+	result := DeviceResult{Name: dev.Name, Host: dev.Host, Port: dev.Port, Success: true}
+	target := &Target{Device: dev}
+
+	for _, step := range steps {
+		sr := StepResult{Step: step.Name, Status: StatusSkipped}
+		if result.Success && ctx.Err() == nil {
+			start := time.Now()
+			err := step.Run(ctx, target)
+			sr.DurationMS = time.Since(start).Milliseconds()
+			sr.Status = StatusOK
+			if err != nil {
+				sr.Status = StatusFailed
+				sr.Error = err.Error()
+				result.Success = false
+			}
+		} else if result.Success {
+			// Cancelled before this device finished
+			result.Success = false
+		}
+		result.Steps = append(result.Steps, sr)
+		r.notify(dev, sr)
+	}
+	return result
+}
+
+func (r *Runner) notify(dev Device, result StepResult) {
+	if r.OnStep == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.OnStep(dev, result)
+}
@@ -0,0 +1,122 @@
+package fleet_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/fleet"
+	"github.com/fzdarsky/boardingpass/internal/cli/output"
+)
+
+func testDevices(n int) []fleet.Device {
+	devices := make([]fleet.Device, n)
+	for i := range devices {
+		devices[i] = fleet.Device{Name: fmt.Sprintf("dev%d", i), Host: fmt.Sprintf("192.0.2.%d", i+1), Port: 9455}
+	}
+	return devices
+}
+
+func TestRunner_BoundedParallelism(t *testing.T) {
+	var running, peak atomic.Int32
+	step := fleet.Step{Name: "pass", Run: func(context.Context, *fleet.Target) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	}}
+
+	runner := &fleet.Runner{Parallel: 3}
+	report := runner.Run(context.Background(), testDevices(10), []fleet.Step{step})
+
+	assert.Equal(t, int32(3), peak.Load())
+	assert.Equal(t, 10, report.Succeeded)
+	assert.Zero(t, report.Failed)
+}
+
+func TestRunner_ContinuesPastFailures(t *testing.T) {
+	var mu sync.Mutex
+	var notified []string
+	runner := &fleet.Runner{Parallel: 2, OnStep: func(dev fleet.Device, r fleet.StepResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, dev.Name+"/"+r.Step+"/"+r.Status)
+	}}
+
+	steps := []fleet.Step{
+		{Name: "pass", Run: func(_ context.Context, t *fleet.Target) error {
+			if t.Name == "dev1" {
+				return errors.New("authentication failed")
+			}
+			return nil
+		}},
+		{Name: "load", Run: func(context.Context, *fleet.Target) error { return nil }},
+	}
+	report := runner.Run(context.Background(), testDevices(3), steps)
+
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, []string{"pass", "load"}, report.Steps)
+
+	failed := report.Devices[1]
+	assert.False(t, failed.Success)
+	assert.Equal(t, "authentication failed", failed.Error())
+	assert.Equal(t, fleet.StatusFailed, failed.Steps[0].Status)
+	assert.Equal(t, fleet.StatusSkipped, failed.Steps[1].Status)
+	assert.Equal(t, fleet.StatusOK, report.Devices[2].Steps[1].Status)
+	assert.Len(t, notified, 6)
+
+	// The result matrix has a column per step
+	table, err := output.FormatData(report, output.FormatTable)
+	require.NoError(t, err)
+	assert.Contains(t, table, "DEVICE  HOST       PASS    LOAD     ERROR")
+	assert.Contains(t, table, "dev1    192.0.2.2  failed  skipped  authentication failed")
+
+	// The report is machine-readable
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.InDelta(t, 1, decoded["failed"], 0)
+	assert.Len(t, decoded["devices"], 3)
+}
+
+func TestRunner_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	steps := []fleet.Step{
+		{Name: "pass", Run: func(context.Context, *fleet.Target) error {
+			cancel()
+			return nil
+		}},
+		{Name: "complete", Run: func(context.Context, *fleet.Target) error {
+			t.Error("step ran after cancellation")
+			return nil
+		}},
+	}
+
+	report := (&fleet.Runner{Parallel: 1}).Run(ctx, testDevices(2), steps)
+	assert.Equal(t, 2, report.Failed)
+
+	// Whichever device ran first completed its first step only
+	var statuses []string
+	for _, dev := range report.Devices {
+		for _, step := range dev.Steps {
+			statuses = append(statuses, step.Status)
+		}
+	}
+	assert.ElementsMatch(t, []string{fleet.StatusOK, fleet.StatusSkipped, fleet.StatusSkipped, fleet.StatusSkipped}, statuses)
+}
@@ -4,6 +4,8 @@ package output
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"text/tabwriter"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,8 +18,18 @@ const (
 	FormatYAML Format = "yaml"
 	// FormatJSON represents JSON output format.
 	FormatJSON Format = "json"
+	// FormatTable represents human-readable table output format.
+	FormatTable Format = "table"
 )
 
+// Table is implemented by data that can be rendered in table format.
+type Table interface {
+	// TableHeader returns the column headings.
+	TableHeader() []string
+	// TableRows returns one row of cells per entry.
+	TableRows() [][]string
+}
+
 // FormatData formats data according to the specified format.
 // Returns the formatted output as a string.
 func FormatData(data any, format Format) (string, error) {
@@ -26,6 +38,8 @@ func FormatData(data any, format Format) (string, error) {
 		return formatYAML(data)
 	case FormatJSON:
 		return formatJSON(data)
+	case FormatTable:
+		return formatTable(data)
 	default:
 		return "", fmt.Errorf("unsupported output format: %s", format)
 	}
@@ -49,6 +63,25 @@ func formatJSON(data any) (string, error) {
 	return string(bytes), nil
 }
 
+// formatTable formats data as aligned columns.
+func formatTable(data any) (string, error) {
+	table, ok := data.(Table)
+	if !ok {
+		return "", fmt.Errorf("table output format is not supported for this data")
+	}
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, strings.Join(table.TableHeader(), "\t"))
+	for _, row := range table.TableRows() {
+		_, _ = fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("failed to format as table: %w", err)
+	}
+	return sb.String(), nil
+}
+
 // ParseFormat parses a format string into a Format value.
 func ParseFormat(s string) (Format, error) {
 	switch s {
@@ -56,7 +89,9 @@ func ParseFormat(s string) (Format, error) {
 		return FormatYAML, nil
 	case "json":
 		return FormatJSON, nil
+	case "table":
+		return FormatTable, nil
 	default:
-		return "", fmt.Errorf("invalid output format '%s': must be 'yaml' or 'json'", s)
+		return "", fmt.Errorf("invalid output format '%s': must be 'table', 'yaml' or 'json'", s)
 	}
 }
@@ -0,0 +1,33 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTable [][]string
+
+func (t testTable) TableHeader() []string { return []string{"NAME", "PORT"} }
+func (t testTable) TableRows() [][]string { return t }
+
+func TestFormatData_Table(t *testing.T) {
+	out, err := FormatData(testTable{{"device-a", "9455"}, {"b", "1"}}, FormatTable)
+	require.NoError(t, err)
+	assert.Equal(t, "NAME      PORT\ndevice-a  9455\nb         1\n", out)
+
+	_, err = FormatData(map[string]string{"a": "b"}, FormatTable)
+	assert.Error(t, err, "data without table support")
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"yaml": FormatYAML, "yml": FormatYAML, "json": FormatJSON, "table": FormatTable} {
+		got, err := ParseFormat(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
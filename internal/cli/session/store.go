@@ -83,6 +83,12 @@ func (s *Store) Delete(host string, port int) error {
 	return nil
 }
 
+// Path returns the file holding the session token for the specified host and
+// port.
+func (s *Store) Path(host string, port int) string {
+	return s.tokenFilename(host, port)
+}
+
 // tokenFilename generates a filename for the session token based on host:port.
 // The filename uses the first 16 hex characters of the SHA-256 hash of "host:port".
 // Format: session-<hash>.token
@@ -0,0 +1,76 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultHistorySize is the number of lines kept in the history file.
+const DefaultHistorySize = 1000
+
+// History is a bounded line history kept in a file. It implements the
+// History interface of golang.org/x/term's Terminal.
+type History struct {
+	path    string
+	max     int
+	entries []string // oldest first
+}
+
+// LoadHistory reads the history file at path, keeping at most max lines. A
+// missing or unreadable file yields an empty history.
+func LoadHistory(path string, max int) *History {
+	h := &History{path: path, max: max}
+	data, err := os.ReadFile(path) // #nosec G304 - path is in the user cache directory
+	if err != nil {
+		return h
+	}
+	for line := range strings.SplitSeq(string(data), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	h.trim()
+	return h
+}
+
+// Add appends a line, skipping blank lines and repeats of the last one.
+func (h *History) Add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	h.trim()
+}
+
+// Len returns the number of lines in the history.
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// At returns a line from the history, 0 being the most recent one.
+func (h *History) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+// Save writes the history file.
+func (h *History) Save() error {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		b.WriteString(entry)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(h.path, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to save history: %w", err)
+	}
+	return nil
+}
+
+func (h *History) trim() {
+	if h.max > 0 && len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+}
@@ -0,0 +1,170 @@
+// Package shell provides the line editing support of 'boarding shell':
+// splitting input lines into words, Tab completion and a persistent history.
+package shell
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Split splits a line into words like a POSIX shell does, honoring single
+// and double quotes and backslash escapes, but without any expansion.
+func Split(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Completer completes the word before the cursor when Tab is pressed: the
+// first word from Verbs, later ones from Args.
+type Completer struct {
+	Verbs []string
+
+	// Args returns the candidates for the word being typed, given the
+	// words before it (starting with the verb) and its beginning.
+	Args func(words []string, prefix string) []string
+
+	// Show, if set, is called with the candidates when there are several
+	// and Tab cannot complete further.
+	Show func(candidates []string)
+}
+
+// Complete implements the AutoCompleteCallback of golang.org/x/term's
+// Terminal.
+func (c *Completer) Complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	before := line[:pos]
+	start := strings.LastIndexAny(before, " \t") + 1
+	words := strings.Fields(before[:start])
+	prefix := before[start:]
+
+	var candidates []string
+	switch {
+	case len(words) == 0:
+		candidates = c.Verbs
+	case c.Args != nil:
+		candidates = c.Args(words, prefix)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	slices.Sort(matches)
+	matches = slices.Compact(matches)
+
+	completion := prefix
+	switch len(matches) {
+	case 0:
+		return line, pos, true
+	case 1:
+		completion = matches[0]
+		if !strings.HasSuffix(completion, "/") && !strings.HasPrefix(line[pos:], " ") {
+			completion += " "
+		}
+	default:
+		completion = commonPrefix(matches)
+		if completion == prefix && c.Show != nil {
+			c.Show(matches)
+		}
+	}
+
+	newLine := before[:start] + completion + line[pos:]
+	return newLine, start + len(completion), true
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// Paths returns the directories, with a trailing slash, and unless dirsOnly
+// the files whose path starts with prefix.
+func Paths(prefix string, dirsOnly bool) []string {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		switch {
+		case isDir:
+			paths = append(paths, dir+name+"/")
+		case !dirsOnly:
+			paths = append(paths, dir+name)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,119 @@
+package shell_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/cli/shell"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "", want: nil},
+		{line: "  info  ", want: []string{"info"}},
+		{line: "command set-hostname edge-01", want: []string{"command", "set-hostname", "edge-01"}},
+		{line: `command set-motd "hello world"`, want: []string{"command", "set-motd", "hello world"}},
+		{line: `command set-motd 'it''s' ""`, want: []string{"command", "set-motd", "its", ""}},
+		{line: `load my\ config`, want: []string{"load", "my config"}},
+		{line: `echo "a \"b\" c"`, want: []string{"echo", `a "b" c`}},
+	}
+	for _, tt := range tests {
+		got, err := shell.Split(tt.line)
+		require.NoError(t, err, tt.line)
+		assert.Equal(t, tt.want, got, tt.line)
+	}
+
+	for _, line := range []string{`command "unterminated`, `load dir\`} {
+		_, err := shell.Split(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	var shown []string
+	c := &shell.Completer{
+		Verbs: []string{"command", "complete", "connections", "info"},
+		Args: func(words []string, _ string) []string {
+			if words[0] == "command" && len(words) == 1 {
+				return []string{"set-hostname", "set-timezone", "reboot"}
+			}
+			return nil
+		},
+		Show: func(candidates []string) { shown = candidates },
+	}
+
+	tests := []struct {
+		name     string
+		line     string
+		pos      int
+		wantLine string
+		wantPos  int
+		wantShow []string
+	}{
+		{name: "unique verb", line: "in", pos: 2, wantLine: "info ", wantPos: 5},
+		{name: "common prefix", line: "c", pos: 1, wantLine: "co", wantPos: 2},
+		{name: "ambiguous shows candidates", line: "co", pos: 2, wantLine: "co", wantPos: 2,
+			wantShow: []string{"command", "complete", "connections"}},
+		{name: "argument", line: "command set-h", pos: 13, wantLine: "command set-hostname ", wantPos: 21},
+		{name: "argument common prefix", line: "command s", pos: 9, wantLine: "command set-", wantPos: 12},
+		{name: "keeps text after the cursor", line: "command re edge-01", pos: 10,
+			wantLine: "command reboot edge-01", wantPos: 14},
+		{name: "no match", line: "command x", pos: 9, wantLine: "command x", wantPos: 9},
+		{name: "no candidates", line: "info j", pos: 6, wantLine: "info j", wantPos: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shown = nil
+			line, pos, ok := c.Complete(tt.line, tt.pos, '\t')
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantLine, line)
+			assert.Equal(t, tt.wantPos, pos)
+			assert.Equal(t, tt.wantShow, shown)
+		})
+	}
+
+	_, _, ok := c.Complete("in", 2, 'f')
+	assert.False(t, ok, "only Tab completes")
+}
+
+func TestPaths(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "edge-config"), 0o700))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".hidden"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "edge.yaml"), nil, 0o600))
+
+	assert.ElementsMatch(t, []string{dir + "/edge-config/", dir + "/edge.yaml"}, shell.Paths(dir+"/ed", false))
+	assert.Equal(t, []string{dir + "/edge-config/"}, shell.Paths(dir+"/", true))
+	assert.Equal(t, []string{dir + "/.hidden/"}, shell.Paths(dir+"/.h", true))
+	assert.Empty(t, shell.Paths(filepath.Join(dir, "missing", "x"), false))
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := shell.LoadHistory(path, 3)
+	assert.Equal(t, 0, h.Len())
+
+	for _, line := range []string{"info", "info", " ", "connections", "command reboot", "load ./config"} {
+		h.Add(line)
+	}
+	require.Equal(t, 3, h.Len())
+	assert.Equal(t, "load ./config", h.At(0))
+	assert.Equal(t, "connections", h.At(2))
+	require.NoError(t, h.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	h = shell.LoadHistory(path, 2)
+	require.Equal(t, 2, h.Len())
+	assert.Equal(t, "load ./config", h.At(0))
+	assert.Equal(t, "command reboot", h.At(1))
+}
@@ -8,23 +8,26 @@ import (
 	"fmt"
 )
 
-// ComputeFingerprint computes the SHA-256 fingerprint of a TLS certificate.
-// The fingerprint is returned in the format "SHA256:<base64-encoded-hash>".
+// ComputeFingerprint computes the SHA-256 fingerprint of the public key of a
+// TLS certificate. The fingerprint is returned in the format
+// "SHA256:<base64-encoded-hash>".
 //
-// This is used for Trust-on-First-Use (TOFU) certificate verification.
+// This is used for Trust-on-First-Use (TOFU) certificate verification. The
+// service regenerates its certificate with the same key when its addresses
+// change, so the key is pinned rather than the certificate.
 func ComputeFingerprint(cert *x509.Certificate) string {
-	// Compute SHA-256 hash of the DER-encoded certificate
-	hash := sha256.Sum256(cert.Raw)
-
-	// Encode as base64
-	encoded := base64.StdEncoding.EncodeToString(hash[:])
-
-	// Format as "SHA256:<hash>"
-	return fmt.Sprintf("SHA256:%s", encoded)
+	return formatFingerprint(cert.RawSubjectPublicKeyInfo)
 }
 
 // FingerprintMatches checks if a certificate's fingerprint matches the expected value.
+// Fingerprints of the whole certificate, stored by earlier versions, also match.
 func FingerprintMatches(cert *x509.Certificate, expected string) bool {
-	actual := ComputeFingerprint(cert)
-	return actual == expected
+	return expected == ComputeFingerprint(cert) || expected == formatFingerprint(cert.Raw)
+}
+
+// formatFingerprint hashes DER-encoded data with SHA-256 and formats it as
+// "SHA256:<hash>".
+func formatFingerprint(der []byte) string {
+	hash := sha256.Sum256(der)
+	return fmt.Sprintf("SHA256:%s", base64.StdEncoding.EncodeToString(hash[:]))
 }
@@ -3,9 +3,12 @@ package tls_test
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
 	"math/big"
+	"net"
 	"testing"
 	"time"
 
@@ -140,6 +143,25 @@ func TestFingerprintMatches_MalformedFingerprint(t *testing.T) {
 	}
 }
 
+func TestComputeFingerprint_SameKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// A certificate regenerated with new SANs keeps its fingerprint
+	cert1 := createTestCertificateWithKey(t, "test.local", privateKey)
+	cert2 := createTestCertificateWithKey(t, "test.local", privateKey, "192.168.1.100")
+	assert.NotEqual(t, cert1.Raw, cert2.Raw)
+	assert.Equal(t, cliTLS.ComputeFingerprint(cert1), cliTLS.ComputeFingerprint(cert2))
+}
+
+func TestFingerprintMatches_CertificateFingerprint(t *testing.T) {
+	cert := createTestCertificate(t, "test.local")
+
+	// Fingerprints of the whole certificate, as stored by earlier versions
+	sum := sha256.Sum256(cert.Raw)
+	assert.True(t, cliTLS.FingerprintMatches(cert, "SHA256:"+base64.StdEncoding.EncodeToString(sum[:])))
+}
+
 // Helper function to create a test certificate
 
 func createTestCertificate(t *testing.T, commonName string) *x509.Certificate {
@@ -149,6 +171,12 @@ func createTestCertificate(t *testing.T, commonName string) *x509.Certificate {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	require.NoError(t, err)
 
+	return createTestCertificateWithKey(t, commonName, privateKey)
+}
+
+func createTestCertificateWithKey(t *testing.T, commonName string, privateKey *rsa.PrivateKey, ips ...string) *x509.Certificate {
+	t.Helper()
+
 	// Create certificate template
 	template := &x509.Certificate{
 		SerialNumber: big.NewInt(1),
@@ -163,6 +191,9 @@ func createTestCertificate(t *testing.T, commonName string) *x509.Certificate {
 		BasicConstraintsValid: true,
 		DNSNames:              []string{commonName},
 	}
+	for _, ip := range ips {
+		template.IPAddresses = append(template.IPAddresses, net.ParseIP(ip))
+	}
 
 	// Create self-signed certificate
 	derBytes, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/fzdarsky/boardingpass/internal/cli/clicontext"
 )
 
+// promptMu keeps prompts for concurrent connections from interleaving.
+var promptMu sync.Mutex
+
 // PromptAcceptCertificate prompts the user to accept or reject an unknown certificate.
 // Returns true if the user accepts, false if they reject.
 // If --assumeyes flag is set, automatically accepts the certificate without prompting.
 func PromptAcceptCertificate(host string, cert *x509.Certificate) bool {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
 	fingerprint := ComputeFingerprint(cert)
 
 	fmt.Fprintf(os.Stderr, "\n")
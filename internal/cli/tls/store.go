@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/fzdarsky/boardingpass/internal/cli/config"
@@ -13,6 +14,10 @@ import (
 
 const knownCertsFileName = "known_certs.yaml"
 
+// fileMu serializes updates of the known certificates file, e.g. by fleet
+// runs that connect to many devices at once.
+var fileMu sync.Mutex
+
 // CertificateEntry represents a known certificate fingerprint.
 type CertificateEntry struct {
 	Host        string    `yaml:"host"`
@@ -114,8 +119,7 @@ func (s *CertificateStore) IsKnown(host string, cert *x509.Certificate) bool {
 		return false
 	}
 
-	actualFingerprint := ComputeFingerprint(cert)
-	return entry.Fingerprint == actualFingerprint
+	return FingerprintMatches(cert, entry.Fingerprint)
 }
 
 // Add adds a new certificate fingerprint to the store.
@@ -128,9 +132,19 @@ func (s *CertificateStore) Add(host string, cert *x509.Certificate) error {
 		AcceptedAt:  time.Now(),
 	}
 
-	s.certs[host] = entry
+	return s.update(func() { s.certs[host] = entry })
+}
 
-	return s.save()
+// Trust records a fingerprint obtained out of band (e.g. from an onboarding
+// QR code) for the given host, replacing any previously stored entry.
+func (s *CertificateStore) Trust(host, fingerprint string) error {
+	return s.update(func() {
+		s.certs[host] = CertificateEntry{
+			Host:        host,
+			Fingerprint: fingerprint,
+			AcceptedAt:  time.Now(),
+		}
+	})
 }
 
 // Get retrieves the stored certificate entry for a host.
@@ -144,7 +158,19 @@ func (s *CertificateStore) Get(host string) *CertificateEntry {
 
 // Remove removes a certificate fingerprint from the store.
 func (s *CertificateStore) Remove(host string) error {
-	delete(s.certs, host)
+	return s.update(func() { delete(s.certs, host) })
+}
+
+// update applies a change on top of the file's current contents, so that
+// stores used at the same time do not drop each other's entries.
+func (s *CertificateStore) update(change func()) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	change()
 	return s.save()
 }
 
@@ -157,8 +183,8 @@ func (s *CertificateStore) VerifyFingerprint(host string, cert *x509.Certificate
 		return nil // No known fingerprint, not an error (user will be prompted)
 	}
 
-	actualFingerprint := ComputeFingerprint(cert)
-	if entry.Fingerprint != actualFingerprint {
+	if !FingerprintMatches(cert, entry.Fingerprint) {
+		actualFingerprint := ComputeFingerprint(cert)
 		return fmt.Errorf("certificate fingerprint mismatch for %s\n"+
 			"Expected: %s\n"+
 			"Got:      %s\n"+
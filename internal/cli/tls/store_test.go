@@ -0,0 +1,32 @@
+package tls_test
+
+import (
+	"testing"
+
+	cliTLS "github.com/fzdarsky/boardingpass/internal/cli/tls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateStore_Trust(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	cert := createTestCertificate(t, "device.local")
+	other := createTestCertificate(t, "other.local")
+
+	store, err := cliTLS.NewCertificateStore()
+	require.NoError(t, err)
+
+	// Pre-trusting replaces an existing entry
+	require.NoError(t, store.Add("10.0.0.1:9455", other))
+	require.NoError(t, store.Trust("10.0.0.1:9455", cliTLS.ComputeFingerprint(cert)))
+
+	assert.True(t, store.IsKnown("10.0.0.1:9455", cert))
+	assert.Error(t, store.VerifyFingerprint("10.0.0.1:9455", other))
+
+	// Trusted fingerprints are persisted
+	reloaded, err := cliTLS.NewCertificateStore()
+	require.NoError(t, err)
+	assert.True(t, reloaded.IsKnown("10.0.0.1:9455", cert))
+}
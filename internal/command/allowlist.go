@@ -11,6 +11,7 @@ import (
 // AllowList validates and retrieves commands from the allow-list.
 type AllowList struct {
 	commands map[string]*config.CommandDefinition
+	ordered  []*config.CommandDefinition
 }
 
 var commandIDPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
@@ -22,6 +23,7 @@ func NewAllowList(commands []config.CommandDefinition) (*AllowList, error) {
 	}
 
 	commandMap := make(map[string]*config.CommandDefinition, len(commands))
+	ordered := make([]*config.CommandDefinition, 0, len(commands))
 	for i := range commands {
 		cmd := &commands[i]
 
@@ -41,10 +43,12 @@ func NewAllowList(commands []config.CommandDefinition) (*AllowList, error) {
 		}
 
 		commandMap[cmd.ID] = cmd
+		ordered = append(ordered, cmd)
 	}
 
 	return &AllowList{
 		commands: commandMap,
+		ordered:  ordered,
 	}, nil
 }
 
@@ -61,6 +65,11 @@ func (a *AllowList) IsAllowed(id string) bool {
 	return ok
 }
 
+// List returns the command definitions in configuration order.
+func (a *AllowList) List() []*config.CommandDefinition {
+	return a.ordered
+}
+
 // Count returns the number of commands in the allow-list.
 func (a *AllowList) Count() int {
 	return len(a.commands)
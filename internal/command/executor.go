@@ -1,16 +1,20 @@
 package command
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os/exec"
 	"syscall"
+	"time"
 
 	"github.com/fzdarsky/boardingpass/internal/config"
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
 )
 
+// killDelay is how long a command may take to exit after it was asked to
+// terminate, before it is killed.
+const killDelay = 5 * time.Second
+
 // CommandExecutor defines the interface for executing commands.
 // This interface is defined at the consumer for testing purposes.
 //
@@ -50,47 +54,82 @@ func (e *Executor) Execute(ctx context.Context, cmd *config.CommandDefinition, r
 		return nil, fmt.Errorf("command definition cannot be nil")
 	}
 
-	// Build the full argument list: <cmd.Args> [-- <params...>]
+	fullArgs := commandArgs(cmd, params)
+
+	if runUsingSudo {
+		// Build command arguments: sudo <path> <fullArgs...>
+		args := make([]string, 0, len(fullArgs)+1)
+		args = append(args, cmd.Path)
+		args = append(args, fullArgs...)
+		return run(ctx, cmd, e.sudoPath, args)
+	}
+
+	// Run command directly without sudo
+	return run(ctx, cmd, cmd.Path, fullArgs)
+}
+
+// commandArgs builds the full argument list: <cmd.Args> [-- <params...>]
+func commandArgs(cmd *config.CommandDefinition, params []string) []string {
 	fullArgs := make([]string, 0, len(cmd.Args)+len(params)+1)
 	fullArgs = append(fullArgs, cmd.Args...)
 	if len(params) > 0 {
 		fullArgs = append(fullArgs, "--")
 		fullArgs = append(fullArgs, params...)
 	}
+	return fullArgs
+}
+
+// run runs a command within the limits of its definition, capturing its
+// stdout, stderr and exit code. It waits for commands of the same exclusive
+// group to finish first, stops the command when its timeout expires and keeps
+// at most max_output_bytes of stdout and of stderr each.
+func run(ctx context.Context, cmd *config.CommandDefinition, name string, args []string) (*protocol.CommandResponse, error) {
+	timeout, err := cmd.GetTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("command %s: %w", cmd.ID, err)
+	}
 
-	var command *exec.Cmd
+	release, err := acquireExclusive(ctx, cmd.Exclusive)
+	if err != nil {
+		return nil, fmt.Errorf("command execution cancelled: %w", err)
+	}
+	defer release()
 
-	if runUsingSudo {
-		// Build command arguments: sudo <path> <fullArgs...>
-		args := make([]string, 0, len(fullArgs)+1)
-		args = append(args, cmd.Path)
-		args = append(args, fullArgs...)
-		//nolint:gosec // G204: Command execution with allow-listed commands is by design
-		command = exec.CommandContext(ctx, e.sudoPath, args...)
-	} else {
-		// Run command directly without sudo
-		//nolint:gosec // G204: Command execution with allow-listed commands is by design
-		command = exec.CommandContext(ctx, cmd.Path, fullArgs...)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	//nolint:gosec // G204: Command execution with allow-listed commands is by design
+	command := exec.CommandContext(runCtx, name, args...)
+	// Terminate rather than kill, so that sudo and systemd-run pass the
+	// signal on, then give up on the command and its output after a while
+	command.Cancel = func() error {
+		return command.Process.Signal(syscall.SIGTERM)
 	}
+	command.WaitDelay = killDelay
 
 	// Capture stdout and stderr
-	var stdout, stderr bytes.Buffer
-	command.Stdout = &stdout
-	command.Stderr = &stderr
+	stdout := &limitedBuffer{limit: cmd.GetMaxOutputBytes()}
+	stderr := &limitedBuffer{limit: cmd.GetMaxOutputBytes()}
+	command.Stdout = stdout
+	command.Stderr = stderr
 
 	// Execute command
-	err := command.Run()
+	err = command.Run()
 
 	// Check if context was cancelled
 	if ctx.Err() != nil {
 		return nil, fmt.Errorf("command execution cancelled: %w", ctx.Err())
 	}
+	if runCtx.Err() != nil {
+		return nil, protocol.NewCommandTimeoutError(cmd.ID, timeout)
+	}
 
 	// Build response
 	response := &protocol.CommandResponse{
-		ExitCode: 0,
-		Stdout:   stdout.String(),
-		Stderr:   stderr.String(),
+		ExitCode:  0,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
 	}
 
 	// Extract exit code from error
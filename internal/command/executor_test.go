@@ -2,12 +2,15 @@ package command_test
 
 import (
 	"context"
+	"errors"
 	"os/exec"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/fzdarsky/boardingpass/internal/command"
 	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
 )
 
 // checkSudoAvailable checks if passwordless sudo is available for testing.
@@ -202,3 +205,148 @@ func TestExecutor_Execute_StderrCapture(t *testing.T) {
 		t.Errorf("Stderr = %q, want %q", response.Stderr, "error\n")
 	}
 }
+
+func TestExecutor_Execute_Timeout(t *testing.T) {
+	executor, err := command.NewExecutor()
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	sleepPath := lookPathOrSkip(t, "sleep")
+	cmd := &config.CommandDefinition{
+		ID:      "sleep-test",
+		Path:    sleepPath,
+		Args:    []string{"5"},
+		Timeout: "1s",
+	}
+
+	start := time.Now()
+	_, err = executor.Execute(context.Background(), cmd, false, nil)
+
+	var errResp *protocol.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Code != protocol.ErrCodeCommandTimeout {
+		t.Fatalf("expected command timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("command was stopped after %s, want about 1s", elapsed)
+	}
+}
+
+func TestExecutor_Execute_MaxOutputBytes(t *testing.T) {
+	executor, err := command.NewExecutor()
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	shPath := lookPathOrSkip(t, "sh")
+	tests := []struct {
+		name          string
+		script        string
+		wantStdout    string
+		wantStderr    string
+		wantTruncated bool
+	}{
+		{name: "within limit", script: "printf 12345678", wantStdout: "12345678"},
+		{name: "stdout truncated", script: "printf 0123456789", wantStdout: "01234567", wantTruncated: true},
+		{
+			name:          "stderr truncated",
+			script:        "printf out; printf 0123456789 >&2",
+			wantStdout:    "out",
+			wantStderr:    "01234567",
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &config.CommandDefinition{
+				ID:             "output-test",
+				Path:           shPath,
+				Args:           []string{"-c", tt.script},
+				MaxOutputBytes: 8,
+			}
+
+			response, err := executor.Execute(context.Background(), cmd, false, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if response.Stdout != tt.wantStdout {
+				t.Errorf("Stdout = %q, want %q", response.Stdout, tt.wantStdout)
+			}
+			if response.Stderr != tt.wantStderr {
+				t.Errorf("Stderr = %q, want %q", response.Stderr, tt.wantStderr)
+			}
+			if response.Truncated != tt.wantTruncated {
+				t.Errorf("Truncated = %v, want %v", response.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestExecutor_Execute_Exclusive(t *testing.T) {
+	executor, err := command.NewExecutor()
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	// Each command fails if the other one's marker exists while it runs
+	shPath := lookPathOrSkip(t, "sh")
+	marker := t.TempDir() + "/running"
+	script := `[ ! -e "$1" ] || exit 1; touch "$1"; sleep 0.3; rm "$1"`
+	cmds := []*config.CommandDefinition{
+		{ID: "set-ip", Path: shPath, Args: []string{"-c", script, "sh", marker}, Exclusive: "network"},
+		{ID: "set-dns", Path: shPath, Args: []string{"-c", script, "sh", marker}, Exclusive: "network"},
+	}
+
+	var wg sync.WaitGroup
+	exitCodes := make([]int, len(cmds))
+	for i, cmd := range cmds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := executor.Execute(context.Background(), cmd, false, nil)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			exitCodes[i] = response.ExitCode
+		}()
+	}
+	wg.Wait()
+
+	for i, code := range exitCodes {
+		if code != 0 {
+			t.Errorf("command %s ran concurrently with the other one", cmds[i].ID)
+		}
+	}
+}
+
+func TestExecutor_Execute_ExclusiveCancelled(t *testing.T) {
+	executor, err := command.NewExecutor()
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	sleepPath := lookPathOrSkip(t, "sleep")
+	truePath := lookPathOrSkip(t, "true")
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		_, _ = executor.Execute(context.Background(), &config.CommandDefinition{
+			ID: "sleep-test", Path: sleepPath, Args: []string{"1"}, Exclusive: "cancel-test",
+		}, false, nil)
+	}()
+	<-started
+	time.Sleep(100 * time.Millisecond)
+
+	// Waiting for the group ends with the request
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = executor.Execute(ctx, &config.CommandDefinition{
+		ID: "true-test", Path: truePath, Exclusive: "cancel-test",
+	}, false, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// exclusiveGroups holds a lock per exclusive group. The groups are shared by
+// all executors, so they hold for sandboxed and other commands alike.
+var exclusiveGroups sync.Map // group name -> chan struct{}
+
+// acquireExclusive waits until no other command of the group runs, and
+// returns the function that lets the next one run. Commands outside of any
+// group don't wait.
+func acquireExclusive(ctx context.Context, group string) (func(), error) {
+	if group == "" {
+		return func() {}, nil
+	}
+
+	lock, _ := exclusiveGroups.LoadOrStore(group, make(chan struct{}, 1))
+	ch := lock.(chan struct{}) //nolint:errcheck,forcetypeassert // only channels are stored
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limitedBuffer is a buffer that keeps the first limit bytes written to it
+// and discards the rest, without failing the writer.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
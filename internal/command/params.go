@@ -0,0 +1,118 @@
+package command
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+)
+
+// ValidateParams checks params against the command's parameter schemas. An
+// empty value for an optional param stands for omitting it, so that later
+// params can still be passed. Commands without schemas only limit the number
+// of params, which callers check against ParamLimit.
+func ValidateParams(cmd *config.CommandDefinition, params []string) error {
+	if len(cmd.Params) == 0 {
+		return nil
+	}
+	if required := cmd.RequiredParams(); len(params) < required {
+		return fmt.Errorf("command %q requires %d params, got %d", cmd.ID, required, len(params))
+	}
+
+	for i, value := range params {
+		if i >= len(cmd.Params) {
+			return fmt.Errorf("command %q accepts at most %d params, got %d", cmd.ID, len(cmd.Params), len(params))
+		}
+		if err := ValidateParam(&cmd.Params[i], value); err != nil {
+			return fmt.Errorf("param %s: %w", cmd.Params[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateParam checks a single value against the param's schema.
+func ValidateParam(p *config.CommandParam, value string) error {
+	if p.Optional && value == "" {
+		return nil
+	}
+	if err := validateType(p.Type, value); err != nil {
+		return err
+	}
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, value) {
+		return fmt.Errorf("must be one of %s", strings.Join(p.Enum, ", "))
+	}
+	re, err := p.PatternRegexp()
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	if re != nil && !re.MatchString(value) {
+		return fmt.Errorf("must match %s", p.Pattern)
+	}
+	return nil
+}
+
+func validateType(paramType, value string) error {
+	switch paramType {
+	case "", config.ParamTypeString:
+		return nil
+	case config.ParamTypeInteger:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+	case config.ParamTypeBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+	case config.ParamTypeIP, config.ParamTypeIPv4, config.ParamTypeIPv6:
+		addr, err := netip.ParseAddr(value)
+		if err != nil || addr.Zone() != "" ||
+			(paramType == config.ParamTypeIPv4 && !addr.Is4()) ||
+			(paramType == config.ParamTypeIPv6 && !addr.Is6()) {
+			return fmt.Errorf("%q is not an %s address", value, ipVersion(paramType))
+		}
+	case config.ParamTypeCIDR:
+		if _, err := netip.ParsePrefix(value); err != nil {
+			return fmt.Errorf("%q is not an address with prefix length", value)
+		}
+	case config.ParamTypeHostname:
+		if !IsHostname(value) {
+			return fmt.Errorf("%q is not a valid hostname", value)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", paramType)
+	}
+	return nil
+}
+
+func ipVersion(paramType string) string {
+	switch paramType {
+	case config.ParamTypeIPv4:
+		return "IPv4"
+	case config.ParamTypeIPv6:
+		return "IPv6"
+	}
+	return "IP"
+}
+
+// IsHostname reports whether s is a host name per RFC 1123: dot-separated
+// labels of letters, digits and hyphens, not starting or ending with a
+// hyphen. A single trailing dot, as in a fully qualified name, is allowed.
+func IsHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for label := range strings.SplitSeq(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package command_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/config"
+)
+
+func TestValidateParams(t *testing.T) {
+	setIP := &config.CommandDefinition{
+		ID:   "set-ip",
+		Path: "/usr/lib/boardingpass/scripts/set-ip.sh",
+		Params: []config.CommandParam{
+			{Name: "interface", Pattern: "[a-zA-Z0-9._-]+"},
+			{Name: "address", Type: config.ParamTypeCIDR},
+			{Name: "gateway", Type: config.ParamTypeIPv4},
+			{Name: "dns", Type: config.ParamTypeIP, Optional: true},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		cmd     *config.CommandDefinition
+		params  []string
+		wantErr string
+	}{
+		{name: "required params", cmd: setIP, params: []string{"eth0", "192.168.1.10/24", "192.168.1.1"}},
+		{name: "optional param", cmd: setIP, params: []string{"eth0", "192.168.1.10/24", "192.168.1.1", "2001:db8::53"}},
+		{name: "empty optional param", cmd: setIP, params: []string{"eth0", "192.168.1.10/24", "192.168.1.1", ""}},
+		{name: "missing params", cmd: setIP, params: []string{"eth0"}, wantErr: "requires 3 params, got 1"},
+		{
+			name:    "too many params",
+			cmd:     setIP,
+			params:  []string{"eth0", "192.168.1.10/24", "192.168.1.1", "192.168.1.1", "x"},
+			wantErr: "at most 4 params",
+		},
+		{
+			name:    "pattern mismatch",
+			cmd:     setIP,
+			params:  []string{"eth0; reboot", "192.168.1.10/24", "192.168.1.1"},
+			wantErr: "param interface: must match",
+		},
+		{
+			name:    "not a prefix",
+			cmd:     setIP,
+			params:  []string{"eth0", "192.168.1.10", "192.168.1.1"},
+			wantErr: "param address",
+		},
+		{
+			name:    "IPv6 for IPv4",
+			cmd:     setIP,
+			params:  []string{"eth0", "192.168.1.10/24", "2001:db8::1"},
+			wantErr: "is not an IPv4 address",
+		},
+		{
+			name:    "empty required param",
+			cmd:     setIP,
+			params:  []string{"eth0", "", "192.168.1.1"},
+			wantErr: "param address",
+		},
+		{name: "no schemas", cmd: &config.CommandDefinition{ID: "reboot", MaxParams: 1}, params: []string{"now"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := command.ValidateParams(tt.cmd, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ValidateParams() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ValidateParams() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateParams_Types(t *testing.T) {
+	tests := []struct {
+		paramType string
+		valid     []string
+		invalid   []string
+	}{
+		{paramType: config.ParamTypeString, valid: []string{"", "any value"}},
+		{paramType: config.ParamTypeInteger, valid: []string{"0", "-42", "8443"}, invalid: []string{"", "1.5", "ten"}},
+		{paramType: config.ParamTypeBoolean, valid: []string{"true", "false"}, invalid: []string{"yes", "1", "True"}},
+		{paramType: config.ParamTypeIP, valid: []string{"192.0.2.1", "2001:db8::1"}, invalid: []string{"192.0.2.1/24", "fe80::1%eth0"}},
+		{paramType: config.ParamTypeIPv4, valid: []string{"192.0.2.1"}, invalid: []string{"2001:db8::1", "192.0.2"}},
+		{paramType: config.ParamTypeIPv6, valid: []string{"2001:db8::1"}, invalid: []string{"192.0.2.1"}},
+		{paramType: config.ParamTypeCIDR, valid: []string{"192.0.2.0/24", "2001:db8::/64"}, invalid: []string{"192.0.2.1", "192.0.2.0/33"}},
+		{
+			paramType: config.ParamTypeHostname,
+			valid:     []string{"edge-01", "edge-01.example.com", "edge-01.example.com."},
+			invalid:   []string{"", "-edge", "edge-", "edge_01", "edge..example.com", "edge 01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.paramType, func(t *testing.T) {
+			cmd := &config.CommandDefinition{
+				ID:     "test",
+				Params: []config.CommandParam{{Name: "value", Type: tt.paramType}},
+			}
+			for _, value := range tt.valid {
+				if err := command.ValidateParams(cmd, []string{value}); err != nil {
+					t.Errorf("ValidateParams(%q) unexpected error = %v", value, err)
+				}
+			}
+			for _, value := range tt.invalid {
+				if err := command.ValidateParams(cmd, []string{value}); err == nil {
+					t.Errorf("ValidateParams(%q) expected error", value)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateParams_Enum(t *testing.T) {
+	cmd := &config.CommandDefinition{
+		ID:     "set-mode",
+		Params: []config.CommandParam{{Name: "mode", Enum: []string{"dhcp", "static"}}},
+	}
+
+	if err := command.ValidateParams(cmd, []string{"dhcp"}); err != nil {
+		t.Errorf("ValidateParams() unexpected error = %v", err)
+	}
+	if err := command.ValidateParams(cmd, []string{"auto"}); err == nil ||
+		!strings.Contains(err.Error(), "must be one of dhcp, static") {
+		t.Errorf("ValidateParams() error = %v, want enum error", err)
+	}
+}
@@ -0,0 +1,151 @@
+package command
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// sandboxUnitPrefix prefixes the names of the transient units commands run in.
+const sandboxUnitPrefix = "boardingpass-cmd-"
+
+// SandboxExecutor runs commands that have a sandbox configured as transient
+// systemd services, and hands all others to another executor.
+//
+// The services run with NoNewPrivileges and a read-only file system except
+// for the sandbox's read_write_paths, and with its resource limits and
+// environment. systemd-run is started via sudo, as only the system service
+// manager can apply the limits; commands with sudo: false run as the
+// service's own user inside the unit.
+type SandboxExecutor struct {
+	next           CommandExecutor
+	sudoPath       string
+	systemdRunPath string
+}
+
+// NewExecutorFor creates the executor for the configured commands: an
+// Executor, wrapped in a SandboxExecutor if any command has a sandbox.
+func NewExecutorFor(commands []config.CommandDefinition) (CommandExecutor, error) {
+	executor, err := NewExecutor()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(commands, func(cmd config.CommandDefinition) bool { return cmd.Sandbox != nil }) {
+		return executor, nil
+	}
+	return NewSandboxExecutor(executor)
+}
+
+// NewSandboxExecutor creates an executor that sandboxes commands and passes
+// commands without a sandbox to next.
+// It verifies that sudo and systemd-run are available in the system.
+func NewSandboxExecutor(next CommandExecutor) (*SandboxExecutor, error) {
+	sudoPath, err := exec.LookPath("sudo")
+	if err != nil {
+		return nil, fmt.Errorf("sudo not found in PATH: %w", err)
+	}
+	systemdRunPath, err := exec.LookPath("systemd-run")
+	if err != nil {
+		return nil, fmt.Errorf("systemd-run not found in PATH: %w", err)
+	}
+
+	return &SandboxExecutor{
+		next:           next,
+		sudoPath:       sudoPath,
+		systemdRunPath: systemdRunPath,
+	}, nil
+}
+
+// Execute runs a command from the allow-list. Sandboxed commands are run as:
+// sudo systemd-run <properties...> -- <path> <args...> [-- <params...>]
+func (e *SandboxExecutor) Execute(ctx context.Context, cmd *config.CommandDefinition, runUsingSudo bool, params []string) (*protocol.CommandResponse, error) {
+	if cmd == nil {
+		return nil, fmt.Errorf("command definition cannot be nil")
+	}
+	if cmd.Sandbox == nil {
+		return e.next.Execute(ctx, cmd, runUsingSudo, params)
+	}
+
+	runArgs, err := systemdRunArgs(cmd, runUsingSudo)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, len(runArgs)+len(cmd.Args)+len(params)+4)
+	args = append(args, e.systemdRunPath)
+	args = append(args, runArgs...)
+	args = append(args, "--", cmd.Path)
+	args = append(args, commandArgs(cmd, params)...)
+
+	return run(ctx, cmd, e.sudoPath, args)
+}
+
+// systemdRunArgs returns the systemd-run options that confine the command to
+// a transient service.
+func systemdRunArgs(cmd *config.CommandDefinition, runUsingSudo bool) ([]string, error) {
+	sb := cmd.Sandbox
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate unit name: %w", err)
+	}
+
+	args := []string{
+		"--unit=" + sandboxUnitPrefix + cmd.ID + "-" + hex.EncodeToString(suffix),
+		"--description=BoardingPass command " + cmd.ID,
+		"--quiet",
+		"--collect",
+		"--wait",
+		"--pipe",
+		"--service-type=exec",
+		"--property=NoNewPrivileges=yes",
+		"--property=ProtectSystem=strict",
+		"--property=ProtectHome=read-only",
+	}
+	for _, path := range sb.ReadWritePaths {
+		args = append(args, "--property=ReadWritePaths="+systemdQuote(path))
+	}
+
+	// Stop the unit itself, as stopping systemd-run leaves it running
+	timeout, err := cmd.GetTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("command %s: %w", cmd.ID, err)
+	}
+	args = append(args, "--property=RuntimeMaxSec="+strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64))
+	if sb.MemoryMax != "" {
+		args = append(args, "--property=MemoryMax="+sb.MemoryMax)
+	}
+	if sb.CPUQuota != "" {
+		args = append(args, "--property=CPUQuota="+sb.CPUQuota)
+	}
+
+	if !runUsingSudo {
+		args = append(args, "--uid="+strconv.Itoa(os.Getuid()), "--gid="+strconv.Itoa(os.Getgid()))
+	}
+
+	names := make([]string, 0, len(sb.Environment))
+	for name := range sb.Environment {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		args = append(args, "--setenv="+name+"="+sb.Environment[name])
+	}
+
+	return args, nil
+}
+
+// systemdQuote quotes a word of a systemd list setting, so that spaces and
+// quotes in it are kept.
+func systemdQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,185 @@
+package command_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// fakeSystemdRun puts sudo and systemd-run stand-ins on PATH. systemd-run
+// prints its arguments, one per line, and exits with code 3 if one is
+// "fail".
+func fakeSystemdRun(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"sudo": "#!/bin/sh\nexec \"$@\"\n",
+		"systemd-run": "#!/bin/sh\nfor arg in \"$@\"; do\n  echo \"$arg\"\n" +
+			"  [ \"$arg\" = fail ] && { echo failed >&2; exit 3; }\ndone\nexit 0\n",
+	}
+	for name, script := range scripts {
+		//nolint:gosec // G306: test scripts must be executable
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSandboxExecutor_Execute(t *testing.T) {
+	fakeSystemdRun(t)
+
+	executor, err := command.NewSandboxExecutor(nil)
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	cmd := &config.CommandDefinition{
+		ID:      "set-ntp",
+		Path:    "/usr/lib/boardingpass/scripts/set-ntp.sh",
+		Args:    []string{"--apply"},
+		Timeout: "1m30s",
+		Sandbox: &config.CommandSandbox{
+			MemoryMax:      "64M",
+			CPUQuota:       "50%",
+			ReadWritePaths: []string{"/etc/chrony.d", "/run/chrony", "/var/lib/my app"},
+			Environment:    map[string]string{"LANG": "C", "HOME": "/var/lib/boardingpass"},
+		},
+	}
+
+	resp, err := executor.Execute(context.Background(), cmd, true, []string{"pool.ntp.org"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.ExitCode != 0 {
+		t.Errorf("ExitCode = %d, want 0", resp.ExitCode)
+	}
+
+	args := strings.Split(strings.TrimSuffix(resp.Stdout, "\n"), "\n")
+	if !regexp.MustCompile(`^--unit=boardingpass-cmd-set-ntp-[0-9a-f]{8}$`).MatchString(args[0]) {
+		t.Errorf("unexpected unit name option %q", args[0])
+	}
+	want := []string{
+		"--description=BoardingPass command set-ntp",
+		"--quiet",
+		"--collect",
+		"--wait",
+		"--pipe",
+		"--service-type=exec",
+		"--property=NoNewPrivileges=yes",
+		"--property=ProtectSystem=strict",
+		"--property=ProtectHome=read-only",
+		`--property=ReadWritePaths="/etc/chrony.d"`,
+		`--property=ReadWritePaths="/run/chrony"`,
+		`--property=ReadWritePaths="/var/lib/my app"`,
+		"--property=RuntimeMaxSec=90",
+		"--property=MemoryMax=64M",
+		"--property=CPUQuota=50%",
+		"--setenv=HOME=/var/lib/boardingpass",
+		"--setenv=LANG=C",
+		"--",
+		"/usr/lib/boardingpass/scripts/set-ntp.sh",
+		"--apply",
+		"--",
+		"pool.ntp.org",
+	}
+	if got := strings.Join(args[1:], "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("systemd-run arguments:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestSandboxExecutor_Execute_WithoutSudo(t *testing.T) {
+	fakeSystemdRun(t)
+
+	executor, err := command.NewSandboxExecutor(nil)
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	cmd := &config.CommandDefinition{
+		ID:      "show-status",
+		Path:    "/usr/lib/boardingpass/scripts/show-status.sh",
+		Sandbox: &config.CommandSandbox{},
+	}
+
+	resp, err := executor.Execute(context.Background(), cmd, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"--uid=" + strconv.Itoa(os.Getuid()), "--gid=" + strconv.Itoa(os.Getgid())} {
+		if !strings.Contains(resp.Stdout, want+"\n") {
+			t.Errorf("missing %s in arguments:\n%s", want, resp.Stdout)
+		}
+	}
+	if !strings.Contains(resp.Stdout, "--property=RuntimeMaxSec=300\n") {
+		t.Errorf("missing default timeout in arguments:\n%s", resp.Stdout)
+	}
+	for _, unwanted := range []string{"ReadWritePaths", "MemoryMax", "CPUQuota", "--setenv"} {
+		if strings.Contains(resp.Stdout, unwanted) {
+			t.Errorf("unexpected %s in arguments:\n%s", unwanted, resp.Stdout)
+		}
+	}
+}
+
+func TestSandboxExecutor_Execute_ExitCode(t *testing.T) {
+	fakeSystemdRun(t)
+
+	executor, err := command.NewSandboxExecutor(nil)
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	cmd := &config.CommandDefinition{
+		ID:      "fail-test",
+		Path:    "/bin/false",
+		Args:    []string{"fail"},
+		Sandbox: &config.CommandSandbox{},
+	}
+
+	resp, err := executor.Execute(context.Background(), cmd, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.ExitCode != 3 {
+		t.Errorf("ExitCode = %d, want 3", resp.ExitCode)
+	}
+	if resp.Stderr != "failed\n" {
+		t.Errorf("Stderr = %q, want %q", resp.Stderr, "failed\n")
+	}
+}
+
+func TestSandboxExecutor_Execute_Unsandboxed(t *testing.T) {
+	fakeSystemdRun(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cmd := &config.CommandDefinition{ID: "echo-test", Path: "/bin/echo"}
+	want := &protocol.CommandResponse{Stdout: "hello\n"}
+
+	next := command.NewMockCommandExecutor(ctrl)
+	next.EXPECT().Execute(gomock.Any(), cmd, true, []string{"hello"}).Return(want, nil)
+
+	executor, err := command.NewSandboxExecutor(next)
+	if err != nil {
+		t.Fatalf("failed to create executor: %v", err)
+	}
+
+	resp, err := executor.Execute(context.Background(), cmd, true, []string{"hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp != want {
+		t.Errorf("expected the response of the next executor, got %+v", resp)
+	}
+}
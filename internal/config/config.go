@@ -3,10 +3,17 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/fzdarsky/boardingpass/internal/serial"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,6 +22,8 @@ const (
 	DefaultTLSCertPath = "/var/lib/boardingpass/tls/server.crt"
 	// DefaultTLSKeyPath is the default path for the TLS private key
 	DefaultTLSKeyPath = "/var/lib/boardingpass/tls/server.key"
+	// DefaultAuditLogPath is the default path for the audit log
+	DefaultAuditLogPath = "/var/lib/boardingpass/audit.jsonl"
 )
 
 // Config represents the BoardingPass service configuration.
@@ -24,23 +33,34 @@ type Config struct {
 	Commands   []CommandDefinition `yaml:"commands"`
 	Logging    LoggingSettings     `yaml:"logging"`
 	Paths      PathSettings        `yaml:"paths"`
+	Enrollment EnrollmentSettings  `yaml:"enrollment"`
 }
 
 // ServiceSettings contains service-level configuration.
 type ServiceSettings struct {
-	InactivityTimeout string       `yaml:"inactivity_timeout"`
-	SessionTTL        string       `yaml:"session_ttl"`
-	SentinelFile      string       `yaml:"sentinel_file"`
-	Port              int          `yaml:"port"`
-	TLSCert           string       `yaml:"tls_cert"`
-	TLSKey            string       `yaml:"tls_key"`
-	MDNS              MDNSSettings `yaml:"mdns"`
+	InactivityTimeout string           `yaml:"inactivity_timeout"`
+	SessionTTL        string           `yaml:"session_ttl"`
+	SentinelFile      string           `yaml:"sentinel_file"`
+	Port              int              `yaml:"port"`
+	TLSCert           string           `yaml:"tls_cert"`
+	TLSKey            string           `yaml:"tls_key"`
+	AuditLog          string           `yaml:"audit_log"` // hash-chained record of provisioning actions, kept after completion
+	MDNS              MDNSSettings     `yaml:"mdns"`
+	DNSSD             DNSSDSettings    `yaml:"dnssd"`
+	Callback          CallbackSettings `yaml:"callback"`
 }
 
+// mDNS renaming styles applied when another device uses the instance name.
+const (
+	MDNSRenameSuffix = "suffix" // append the serial number or MAC address, then a counter
+	MDNSRenameNumber = "number" // append "-2", "-3", ...
+)
+
 // MDNSSettings contains mDNS service announcement configuration.
 type MDNSSettings struct {
 	Enabled      *bool  `yaml:"enabled,omitempty"`       // default: true
 	InstanceName string `yaml:"instance_name,omitempty"` // default: "BoardingPass-<hostname>"
+	Rename       string `yaml:"rename,omitempty"`        // default: "suffix"
 }
 
 // IsEnabled returns whether mDNS announcements are enabled.
@@ -49,18 +69,61 @@ func (m *MDNSSettings) IsEnabled() bool {
 	return m.Enabled == nil || *m.Enabled
 }
 
+// DNSSDSettings contains wide-area DNS-SD configuration: the service
+// registers its records in a unicast DNS zone with dynamic updates, for
+// networks that mDNS multicast does not reach.
+type DNSSDSettings struct {
+	Enabled bool         `yaml:"enabled"`
+	Server  string       `yaml:"server"`        // DNS server accepting updates, "host" or "host:port"
+	Zone    string       `yaml:"zone"`          // zone to register in, e.g. "prov.example.com"
+	TTL     string       `yaml:"ttl,omitempty"` // record TTL, default: "2m"
+	TSIG    TSIGSettings `yaml:"tsig,omitempty"`
+}
+
+// TSIGSettings contains the key that signs dynamic updates.
+type TSIGSettings struct {
+	KeyName    string `yaml:"key_name"`
+	Algorithm  string `yaml:"algorithm,omitempty"` // "hmac-sha256" (default) or "hmac-sha512"
+	SecretFile string `yaml:"secret_file"`         // file with the base64-encoded secret
+}
+
+// GetTTL parses and returns the TTL of registered records.
+func (d *DNSSDSettings) GetTTL() (time.Duration, error) {
+	if d.TTL == "" {
+		return 2 * time.Minute, nil
+	}
+	ttl, err := time.ParseDuration(d.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid service.dnssd.ttl: %w", err)
+	}
+	if ttl < time.Second {
+		return 0, fmt.Errorf("service.dnssd.ttl must be at least 1 second")
+	}
+	return ttl, nil
+}
+
+// CallbackSettings contains the provisioning controller the service reports
+// to on start and whenever its addresses change.
+type CallbackSettings struct {
+	URL    string `yaml:"url,omitempty"`     // HTTPS URL to POST announcements to (empty = disabled)
+	CACert string `yaml:"ca_cert,omitempty"` // PEM file to verify the controller (default: system roots)
+}
+
 // TransportSettings contains transport-specific configuration.
 type TransportSettings struct {
 	Ethernet  EthernetTransport  `yaml:"ethernet"`
 	WiFi      WiFiTransport      `yaml:"wifi"`
 	Bluetooth BluetoothTransport `yaml:"bluetooth"`
+	BLE       BLETransport       `yaml:"ble"`
 	USB       USBTransport       `yaml:"usb"`
+	Serial    SerialTransport    `yaml:"serial"`
+	Relay     RelayTransport     `yaml:"relay"`
 }
 
 // EthernetTransport contains Ethernet transport configuration.
 type EthernetTransport struct {
 	Enabled    bool     `yaml:"enabled"`
-	Interfaces []string `yaml:"interfaces"`
+	Interfaces []string `yaml:"interfaces"` // bind to these interfaces' addresses (empty = Address)
 	Address    string   `yaml:"address"`
 }
 
@@ -82,20 +145,154 @@ type BluetoothTransport struct {
 	Address    string `yaml:"address"`
 }
 
+// BLETransport contains configuration for serving the API over a BLE GATT service.
+type BLETransport struct {
+	Enabled    bool   `yaml:"enabled"`
+	Adapter    string `yaml:"adapter"`
+	DeviceName string `yaml:"device_name"`
+}
+
+// USB transport modes.
+const (
+	USBModeHost   = "host"   // detect tethering from a phone or laptop acting as USB device
+	USBModeGadget = "gadget" // present the board itself as a USB network adapter
+)
+
 // USBTransport contains USB tethering transport configuration.
 type USBTransport struct {
-	Enabled         bool   `yaml:"enabled"`
-	InterfacePrefix string `yaml:"interface_prefix"`
-	Address         string `yaml:"address,omitempty"`
+	Enabled         bool              `yaml:"enabled"`
+	Mode            string            `yaml:"mode,omitempty"` // "host" (default) or "gadget"
+	InterfacePrefix string            `yaml:"interface_prefix"`
+	Address         string            `yaml:"address,omitempty"` // gadget mode only, default: 10.0.2.1
+	Gadget          USBGadgetSettings `yaml:"gadget,omitempty"`
+}
+
+// USBGadgetSettings contains USB gadget mode configuration.
+type USBGadgetSettings struct {
+	Function string `yaml:"function,omitempty"` // "ncm" (default), "ecm" or "rndis"
+	UDC      string `yaml:"udc,omitempty"`      // USB device controller (default: first in /sys/class/udc)
+}
+
+// IsGadget returns whether the board presents itself as a USB network adapter.
+func (u *USBTransport) IsGadget() bool {
+	return u.Mode == USBModeGadget
+}
+
+// SerialTransport contains serial console transport configuration.
+type SerialTransport struct {
+	Enabled  bool   `yaml:"enabled"`
+	Device   string `yaml:"device"`              // e.g. /dev/ttyGS0 (USB ACM gadget) or /dev/ttyS0
+	BaudRate int    `yaml:"baud_rate,omitempty"` // default: 115200
+}
+
+// RelayTransport contains configuration for serving the API through a
+// rendezvous server, for devices that cannot accept incoming connections.
+type RelayTransport struct {
+	Enabled   bool   `yaml:"enabled"`
+	URL       string `yaml:"url"`                  // wss:// URL of the rendezvous server
+	DeviceID  string `yaml:"device_id,omitempty"`  // default: serial number or first hardware address
+	CACert    string `yaml:"ca_cert,omitempty"`    // PEM file to verify the server (default: system roots)
+	TokenFile string `yaml:"token_file,omitempty"` // file with the bearer token the server requires
 }
 
 // CommandDefinition defines an allow-listed command.
 type CommandDefinition struct {
-	ID        string   `yaml:"id"`
-	Path      string   `yaml:"path"`
-	Args      []string `yaml:"args"`
-	MaxParams int      `yaml:"max_params"`     // 0 means no params accepted
-	Sudo      *bool    `yaml:"sudo,omitempty"` // nil or true = use sudo (default), false = run directly
+	ID          string          `yaml:"id"`
+	Description string          `yaml:"description,omitempty"`
+	Path        string          `yaml:"path"`
+	Args        []string        `yaml:"args"`
+	MaxParams   int             `yaml:"max_params"`        // 0 means no params accepted; implied by params if set
+	Params      []CommandParam  `yaml:"params,omitempty"`  // schemas the params are validated against, in order
+	Sudo        *bool           `yaml:"sudo,omitempty"`    // nil or true = use sudo (default), false = run directly
+	Sandbox     *CommandSandbox `yaml:"sandbox,omitempty"` // run in a transient systemd service if set
+
+	Timeout        string `yaml:"timeout,omitempty"`          // e.g. "30s" (default: 5m)
+	MaxOutputBytes int    `yaml:"max_output_bytes,omitempty"` // limit of stdout and of stderr each (default: 1 MiB)
+	Exclusive      string `yaml:"exclusive,omitempty"`        // group of commands that never run concurrently
+}
+
+// Command limits applied unless configured otherwise.
+const (
+	DefaultCommandTimeout        = 5 * time.Minute
+	DefaultCommandMaxOutputBytes = 1 << 20
+)
+
+// CommandSandbox confines a command to a transient systemd service with
+// NoNewPrivileges and a read-only file system. The service is stopped when
+// the command's timeout expires.
+type CommandSandbox struct {
+	MemoryMax      string            `yaml:"memory_max,omitempty"`       // e.g. "256M" (default: no limit)
+	CPUQuota       string            `yaml:"cpu_quota,omitempty"`        // e.g. "50%", relative to one CPU (default: no limit)
+	ReadWritePaths []string          `yaml:"read_write_paths,omitempty"` // paths the command may write to
+	Environment    map[string]string `yaml:"environment,omitempty"`      // variables set for the command
+}
+
+// GetTimeout parses and returns the time the command may run.
+func (c *CommandDefinition) GetTimeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return DefaultCommandTimeout, nil
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout: %w", err)
+	}
+	if timeout < time.Second {
+		return 0, fmt.Errorf("timeout must be at least 1 second")
+	}
+	return timeout, nil
+}
+
+// GetMaxOutputBytes returns the number of bytes of stdout and of stderr kept.
+func (c *CommandDefinition) GetMaxOutputBytes() int {
+	if c.MaxOutputBytes == 0 {
+		return DefaultCommandMaxOutputBytes
+	}
+	return c.MaxOutputBytes
+}
+
+// Command parameter types.
+const (
+	ParamTypeString   = "string" // any value (default)
+	ParamTypeInteger  = "integer"
+	ParamTypeBoolean  = "boolean" // true or false
+	ParamTypeIP       = "ip"      // IPv4 or IPv6 address
+	ParamTypeIPv4     = "ipv4"
+	ParamTypeIPv6     = "ipv6"
+	ParamTypeCIDR     = "cidr"     // address with prefix length, e.g. 192.168.1.10/24
+	ParamTypeHostname = "hostname" // RFC 1123 host name
+)
+
+// CommandParam is the schema of a positional command parameter.
+type CommandParam struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Type        string   `yaml:"type,omitempty"`     // default: string
+	Pattern     string   `yaml:"pattern,omitempty"`  // regular expression the whole value must match
+	Enum        []string `yaml:"enum,omitempty"`     // allowed values
+	Optional    bool     `yaml:"optional,omitempty"` // only allowed after the required params
+	Secret      bool     `yaml:"secret,omitempty"`   // e.g. a token; masked by clients, redacted in the audit log
+
+	pattern *regexp.Regexp // Pattern anchored to the whole value, compiled by Validate
+}
+
+// PatternRegexp returns Pattern compiled to match the whole value, or nil if
+// the param has no pattern. Validate compiles it once; params of
+// configurations that were not validated compile it on each call.
+func (p *CommandParam) PatternRegexp() (*regexp.Regexp, error) {
+	if p.pattern != nil || p.Pattern == "" {
+		return p.pattern, nil
+	}
+	return compileParamPattern(p.Pattern)
+}
+
+// compileParamPattern compiles pattern anchored to the whole value. The
+// pattern is first compiled on its own, so that one like "a)|(b" cannot
+// escape the group it is wrapped in.
+func compileParamPattern(pattern string) (*regexp.Regexp, error) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	return regexp.Compile(`^(?:` + pattern + `)$`)
 }
 
 // NeedsSudo returns whether this command should be executed via sudo.
@@ -104,6 +301,26 @@ func (c *CommandDefinition) NeedsSudo() bool {
 	return c.Sudo == nil || *c.Sudo
 }
 
+// ParamLimit returns the maximum number of params the command accepts: the
+// number of declared params if there are any, else max_params.
+func (c *CommandDefinition) ParamLimit() int {
+	if len(c.Params) > 0 {
+		return len(c.Params)
+	}
+	return c.MaxParams
+}
+
+// RequiredParams returns the number of params that must be given.
+func (c *CommandDefinition) RequiredParams() int {
+	n := 0
+	for _, p := range c.Params {
+		if !p.Optional {
+			n++
+		}
+	}
+	return n
+}
+
 // LoggingSettings contains logging configuration.
 type LoggingSettings struct {
 	Level  string `yaml:"level"`
@@ -116,6 +333,58 @@ type PathSettings struct {
 	RootDirectory string   `yaml:"root_directory,omitempty"` // Optional chroot-like root for testing
 }
 
+// EnrollmentSettings contains settings of the enrollment with management
+// services.
+type EnrollmentSettings struct {
+	FlightControl FlightControlSettings       `yaml:"flightctl"`
+	Backends      []EnrollmentBackendSettings `yaml:"backends,omitempty"`
+}
+
+// EnrollmentBackendSettings registers an enrollment backend that runs an
+// allow-listed command. The command's params are the backend's input fields.
+type EnrollmentBackendSettings struct {
+	Name         string   `yaml:"name"`                    // e.g. "awx"; used in /enrollment/{name}
+	DisplayName  string   `yaml:"display_name,omitempty"`  // default: name
+	Description  string   `yaml:"description,omitempty"`   // default: the command's description
+	Command      string   `yaml:"command"`                 // ID of the allow-listed command that enrolls
+	SecretParams []string `yaml:"secret_params,omitempty"` // params clients mask, e.g. tokens
+}
+
+// FlightControlSettings contains settings of the enrollment with Flight
+// Control.
+type FlightControlSettings struct {
+	Server          string `yaml:"server,omitempty"`           // API URL used unless the request names one
+	CACert          string `yaml:"ca_cert,omitempty"`          // PEM file to verify the API (default: system roots)
+	ApprovalTimeout string `yaml:"approval_timeout,omitempty"` // how long to wait for approval (default: 1h)
+}
+
+var (
+	enrollmentBackendNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+	// reservedEnrollmentBackendNames are the built-in backends and the
+	// names of other /enrollment endpoints.
+	reservedEnrollmentBackendNames = map[string]bool{"flightctl": true, "backends": true}
+)
+
+// DefaultApprovalTimeout is how long an enrollment request may await
+// approval unless configured otherwise.
+const DefaultApprovalTimeout = time.Hour
+
+// GetApprovalTimeout parses and returns how long to wait for approval.
+func (f *FlightControlSettings) GetApprovalTimeout() (time.Duration, error) {
+	if f.ApprovalTimeout == "" {
+		return DefaultApprovalTimeout, nil
+	}
+	timeout, err := time.ParseDuration(f.ApprovalTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid approval_timeout: %w", err)
+	}
+	if timeout < time.Minute {
+		return 0, fmt.Errorf("approval_timeout must be at least 1 minute")
+	}
+	return timeout, nil
+}
+
 // Load reads and parses the configuration file.
 //
 //nolint:gosec // G304: Config path is from command-line argument
@@ -145,6 +414,9 @@ func Load(path string) (*Config, error) {
 	if cfg.Service.TLSKey == "" {
 		cfg.Service.TLSKey = DefaultTLSKeyPath
 	}
+	if cfg.Service.AuditLog == "" {
+		cfg.Service.AuditLog = DefaultAuditLogPath
+	}
 
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
@@ -180,6 +452,28 @@ func (c *Config) validate() error {
 		return fmt.Errorf("service.tls_key is required")
 	}
 
+	if !filepath.IsAbs(c.Service.AuditLog) {
+		return fmt.Errorf("service.audit_log must be an absolute path")
+	}
+
+	switch c.Service.MDNS.Rename {
+	case "", MDNSRenameSuffix, MDNSRenameNumber:
+	default:
+		return fmt.Errorf("service.mdns.rename must be %q or %q", MDNSRenameSuffix, MDNSRenameNumber)
+	}
+
+	if err := c.validateDNSSD(); err != nil {
+		return err
+	}
+
+	if err := c.validateCallback(); err != nil {
+		return err
+	}
+
+	if err := c.validateEthernet(); err != nil {
+		return err
+	}
+
 	if err := c.validateWiFi(); err != nil {
 		return err
 	}
@@ -188,6 +482,38 @@ func (c *Config) validate() error {
 		return err
 	}
 
+	if err := c.validateBLE(); err != nil {
+		return err
+	}
+
+	if err := c.validateUSB(); err != nil {
+		return err
+	}
+
+	if err := c.validateSerial(); err != nil {
+		return err
+	}
+
+	if err := c.validateRelay(); err != nil {
+		return err
+	}
+
+	if err := c.validateEnrollment(); err != nil {
+		return err
+	}
+
+	if err := c.validateCommandParams(); err != nil {
+		return err
+	}
+
+	if err := c.validateCommandLimits(); err != nil {
+		return err
+	}
+
+	if err := c.validateCommandSandboxes(); err != nil {
+		return err
+	}
+
 	// Validate root directory (if specified)
 	if c.Paths.RootDirectory != "" {
 		// Ensure it's an absolute path
@@ -205,6 +531,26 @@ func (c *Config) validate() error {
 	return nil
 }
 
+func (c *Config) validateEthernet() error {
+	eth := c.Transports.Ethernet
+	if !eth.Enabled || len(eth.Interfaces) == 0 {
+		return nil
+	}
+
+	// Listeners bind to the interfaces' own addresses
+	if eth.Address != "" {
+		return fmt.Errorf("transports.ethernet.address and transports.ethernet.interfaces are mutually exclusive")
+	}
+
+	for _, name := range eth.Interfaces {
+		if name == "" || strings.ContainsAny(name, "/ ") {
+			return fmt.Errorf("transports.ethernet.interfaces contains invalid interface name %q", name)
+		}
+	}
+
+	return nil
+}
+
 func (c *Config) validateWiFi() error {
 	if !c.Transports.WiFi.Enabled {
 		return nil
@@ -232,6 +578,202 @@ func (c *Config) validateBluetooth() error {
 	return nil
 }
 
+func (c *Config) validateBLE() error {
+	if !c.Transports.BLE.Enabled || !c.Transports.Bluetooth.Enabled {
+		return nil
+	}
+
+	// Both transports advertise the BoardingPass GATT service
+	btAdapter := c.Transports.Bluetooth.Adapter
+	if btAdapter == "" {
+		btAdapter = "hci0"
+	}
+	bleAdapter := c.Transports.BLE.Adapter
+	if bleAdapter == "" {
+		bleAdapter = "hci0"
+	}
+	if btAdapter == bleAdapter {
+		return fmt.Errorf("transports.ble and transports.bluetooth cannot both use adapter %s", bleAdapter)
+	}
+
+	return nil
+}
+
+func (c *Config) validateUSB() error {
+	if !c.Transports.USB.Enabled {
+		return nil
+	}
+
+	usb := c.Transports.USB
+	switch usb.Mode {
+	case "", USBModeHost:
+		return nil
+	case USBModeGadget:
+	default:
+		return fmt.Errorf("transports.usb.mode must be %q or %q", USBModeHost, USBModeGadget)
+	}
+
+	switch usb.Gadget.Function {
+	case "", "ncm", "ecm", "rndis":
+	default:
+		return fmt.Errorf("transports.usb.gadget.function must be one of ncm, ecm, rndis")
+	}
+
+	if usb.Gadget.UDC != "" && strings.ContainsAny(usb.Gadget.UDC, "/ ") {
+		return fmt.Errorf("transports.usb.gadget.udc must be a controller name from /sys/class/udc")
+	}
+
+	if usb.Address != "" {
+		if ip := net.ParseIP(usb.Address); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("transports.usb.address must be an IPv4 address")
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateSerial() error {
+	if !c.Transports.Serial.Enabled {
+		return nil
+	}
+
+	if c.Transports.Serial.Device == "" {
+		return fmt.Errorf("transports.serial.device is required")
+	}
+	if !filepath.IsAbs(c.Transports.Serial.Device) {
+		return fmt.Errorf("transports.serial.device must be an absolute path")
+	}
+
+	baud := c.Transports.Serial.BaudRate
+	if baud != 0 && !serial.SupportedBaudRate(baud) {
+		return fmt.Errorf("transports.serial.baud_rate %d is not supported", baud)
+	}
+
+	return nil
+}
+
+func (c *Config) validateRelay() error {
+	r := &c.Transports.Relay
+	if !r.Enabled {
+		return nil
+	}
+
+	if r.URL == "" {
+		return fmt.Errorf("transports.relay.url is required")
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || u.Scheme != "wss" || u.Host == "" {
+		return fmt.Errorf("transports.relay.url must be a wss:// URL")
+	}
+	if r.CACert != "" && !filepath.IsAbs(r.CACert) {
+		return fmt.Errorf("transports.relay.ca_cert must be an absolute path")
+	}
+	if r.TokenFile != "" && !filepath.IsAbs(r.TokenFile) {
+		return fmt.Errorf("transports.relay.token_file must be an absolute path")
+	}
+
+	return nil
+}
+
+func (c *Config) validateDNSSD() error {
+	d := &c.Service.DNSSD
+	if !d.Enabled {
+		return nil
+	}
+
+	if d.Server == "" {
+		return fmt.Errorf("service.dnssd.server is required")
+	}
+	if d.Zone == "" {
+		return fmt.Errorf("service.dnssd.zone is required")
+	}
+	if _, err := d.GetTTL(); err != nil {
+		return err
+	}
+
+	switch d.TSIG.Algorithm {
+	case "", "hmac-sha256", "hmac-sha512":
+	default:
+		return fmt.Errorf("service.dnssd.tsig.algorithm must be \"hmac-sha256\" or \"hmac-sha512\"")
+	}
+	if (d.TSIG.KeyName == "") != (d.TSIG.SecretFile == "") {
+		return fmt.Errorf("service.dnssd.tsig requires both key_name and secret_file")
+	}
+	if d.TSIG.SecretFile != "" && !filepath.IsAbs(d.TSIG.SecretFile) {
+		return fmt.Errorf("service.dnssd.tsig.secret_file must be an absolute path")
+	}
+
+	return nil
+}
+
+func (c *Config) validateCallback() error {
+	cb := &c.Service.Callback
+	if cb.URL == "" {
+		if cb.CACert != "" {
+			return fmt.Errorf("service.callback.ca_cert requires service.callback.url")
+		}
+		return nil
+	}
+
+	u, err := url.Parse(cb.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("service.callback.url must be an absolute URL")
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("service.callback.url must use https")
+	}
+	if cb.CACert != "" && !filepath.IsAbs(cb.CACert) {
+		return fmt.Errorf("service.callback.ca_cert must be an absolute path")
+	}
+
+	return nil
+}
+
+func (c *Config) validateEnrollment() error {
+	fc := &c.Enrollment.FlightControl
+	if fc.Server != "" {
+		u, err := url.Parse(fc.Server)
+		if err != nil || u.Host == "" || u.Scheme != "https" {
+			return fmt.Errorf("enrollment.flightctl.server must be an https URL")
+		}
+	}
+	if fc.CACert != "" && !filepath.IsAbs(fc.CACert) {
+		return fmt.Errorf("enrollment.flightctl.ca_cert must be an absolute path")
+	}
+	if _, err := fc.GetApprovalTimeout(); err != nil {
+		return fmt.Errorf("enrollment.flightctl: %w", err)
+	}
+
+	names := map[string]bool{}
+	for i, b := range c.Enrollment.Backends {
+		if !enrollmentBackendNamePattern.MatchString(b.Name) {
+			return fmt.Errorf("enrollment.backends[%d].name must consist of lower-case letters, digits and dashes", i)
+		}
+		if reservedEnrollmentBackendNames[b.Name] || names[b.Name] {
+			return fmt.Errorf("enrollment.backends[%d].name %q is already used", i, b.Name)
+		}
+		names[b.Name] = true
+
+		cmd, ok := c.GetCommandByID(b.Command)
+		if !ok {
+			return fmt.Errorf("enrollment.backends[%d].command %q is not an allow-listed command", i, b.Command)
+		}
+		// Clients build forms from the param schemas
+		if len(cmd.Params) == 0 && cmd.MaxParams > 0 {
+			return fmt.Errorf("enrollment.backends[%d].command %q must declare its params", i, b.Command)
+		}
+		for _, secret := range b.SecretParams {
+			j := slices.IndexFunc(cmd.Params, func(p CommandParam) bool { return p.Name == secret })
+			if j < 0 {
+				return fmt.Errorf("enrollment.backends[%d].secret_params: command %q has no param %q", i, b.Command, secret)
+			}
+			cmd.Params[j].Secret = true
+		}
+	}
+
+	return nil
+}
+
 // GetInactivityTimeout parses and returns the inactivity timeout duration.
 func (c *Config) GetInactivityTimeout() (time.Duration, error) {
 	duration, err := time.ParseDuration(c.Service.InactivityTimeout)
@@ -260,6 +802,96 @@ func (c *Config) GetSessionTTL() (time.Duration, error) {
 	return duration, nil
 }
 
+func (c *Config) validateCommandParams() error {
+	for ci := range c.Commands {
+		cmd := &c.Commands[ci]
+		if len(cmd.Params) == 0 {
+			continue
+		}
+		if cmd.MaxParams != 0 && cmd.MaxParams != len(cmd.Params) {
+			return fmt.Errorf("command %s: max_params must match the number of params", cmd.ID)
+		}
+
+		seen := make(map[string]bool, len(cmd.Params))
+		optional := false
+		for i := range cmd.Params {
+			p := &cmd.Params[i]
+			if p.Name == "" {
+				return fmt.Errorf("command %s: params[%d].name is required", cmd.ID, i)
+			}
+			if seen[p.Name] {
+				return fmt.Errorf("command %s: duplicate param %s", cmd.ID, p.Name)
+			}
+			seen[p.Name] = true
+
+			switch p.Type {
+			case "", ParamTypeString, ParamTypeInteger, ParamTypeBoolean, ParamTypeIP, ParamTypeIPv4,
+				ParamTypeIPv6, ParamTypeCIDR, ParamTypeHostname:
+			default:
+				return fmt.Errorf("command %s: param %s has unknown type %q", cmd.ID, p.Name, p.Type)
+			}
+			if p.Pattern != "" {
+				re, err := compileParamPattern(p.Pattern)
+				if err != nil {
+					return fmt.Errorf("command %s: param %s has invalid pattern: %w", cmd.ID, p.Name, err)
+				}
+				p.pattern = re
+			}
+
+			if p.Optional {
+				optional = true
+			} else if optional {
+				return fmt.Errorf("command %s: required param %s follows an optional one", cmd.ID, p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateCommandLimits() error {
+	for _, cmd := range c.Commands {
+		if _, err := cmd.GetTimeout(); err != nil {
+			return fmt.Errorf("command %s: %w", cmd.ID, err)
+		}
+		if cmd.MaxOutputBytes < 0 {
+			return fmt.Errorf("command %s: max_output_bytes must not be negative", cmd.ID)
+		}
+	}
+	return nil
+}
+
+var (
+	memoryMaxPattern = regexp.MustCompile(`^([0-9]+[KMGT]?|[0-9]+%|infinity)$`)
+	cpuQuotaPattern  = regexp.MustCompile(`^[0-9]+%$`)
+	envNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func (c *Config) validateCommandSandboxes() error {
+	for _, cmd := range c.Commands {
+		sb := cmd.Sandbox
+		if sb == nil {
+			continue
+		}
+		if sb.MemoryMax != "" && !memoryMaxPattern.MatchString(sb.MemoryMax) {
+			return fmt.Errorf("command %s: sandbox.memory_max must be bytes with an optional K, M, G or T suffix, a percentage or \"infinity\"", cmd.ID)
+		}
+		if sb.CPUQuota != "" && (!cpuQuotaPattern.MatchString(sb.CPUQuota) || sb.CPUQuota == "0%") {
+			return fmt.Errorf("command %s: sandbox.cpu_quota must be a positive percentage", cmd.ID)
+		}
+		for _, path := range sb.ReadWritePaths {
+			if !filepath.IsAbs(path) || strings.ContainsFunc(path, unicode.IsControl) {
+				return fmt.Errorf("command %s: sandbox.read_write_paths contains invalid path %q", cmd.ID, path)
+			}
+		}
+		for name, value := range sb.Environment {
+			if !envNamePattern.MatchString(name) || strings.Contains(value, "\n") {
+				return fmt.Errorf("command %s: sandbox.environment contains invalid variable %q", cmd.ID, name)
+			}
+		}
+	}
+	return nil
+}
+
 // GetCommandByID returns the command definition for the given ID.
 func (c *Config) GetCommandByID(id string) (*CommandDefinition, bool) {
 	for i := range c.Commands {
@@ -4,6 +4,7 @@ package config_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -342,6 +343,25 @@ service:
 	}
 }
 
+func TestConfig_AuditLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "/etc/boardingpass/issued"
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(base), 0644))
+	cfg, err := config.Load(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultAuditLogPath, cfg.Service.AuditLog)
+
+	require.NoError(t, os.WriteFile(configFile, []byte(base+"  audit_log: \"audit.jsonl\"\n"), 0644))
+	_, err = config.Load(configFile)
+	assert.ErrorContains(t, err, "service.audit_log must be an absolute path")
+}
+
 func TestConfig_Validate_InvalidPort(t *testing.T) {
 	tmpDir := t.TempDir()
 	sentinelDir := filepath.Join(tmpDir, "etc", "boardingpass")
@@ -369,3 +389,848 @@ transports:
 	assert.Nil(t, cfg)
 	assert.Contains(t, err.Error(), "port must be between 1 and 65535")
 }
+
+func TestConfig_Validate_BLEAdapterConflict(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  bluetooth:
+    enabled: true
+`
+
+	tests := []struct {
+		name        string
+		ble         string
+		expectedErr string
+	}{
+		{
+			name: "same default adapter",
+			ble: `  ble:
+    enabled: true
+`,
+			expectedErr: "cannot both use adapter hci0",
+		},
+		{
+			name: "different adapters",
+			ble: `  ble:
+    enabled: true
+    adapter: hci1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.ble), 0644))
+
+			cfg, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, cfg.Transports.BLE.Enabled)
+			assert.Equal(t, "hci1", cfg.Transports.BLE.Adapter)
+		})
+	}
+}
+
+func TestConfig_Validate_USBGadget(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  usb:
+    enabled: true
+`
+
+	tests := []struct {
+		name        string
+		usb         string
+		expectedErr string
+	}{
+		{
+			name: "gadget defaults",
+			usb: `    mode: gadget
+`,
+		},
+		{
+			name: "gadget with function and address",
+			usb: `    mode: gadget
+    address: 10.0.9.1
+    gadget:
+      function: rndis
+      udc: fe980000.usb
+`,
+		},
+		{
+			name: "unknown mode",
+			usb: `    mode: device
+`,
+			expectedErr: "transports.usb.mode",
+		},
+		{
+			name: "unknown function",
+			usb: `    mode: gadget
+    gadget:
+      function: acm
+`,
+			expectedErr: "transports.usb.gadget.function",
+		},
+		{
+			name: "udc with path",
+			usb: `    mode: gadget
+    gadget:
+      udc: ../udc
+`,
+			expectedErr: "transports.usb.gadget.udc",
+		},
+		{
+			name: "IPv6 address",
+			usb: `    mode: gadget
+    address: fd00::1
+`,
+			expectedErr: "transports.usb.address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.usb), 0644))
+
+			cfg, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, cfg.Transports.USB.IsGadget())
+		})
+	}
+}
+
+func TestConfig_Validate_EthernetInterfaces(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  ethernet:
+    enabled: true
+`
+
+	tests := []struct {
+		name        string
+		ethernet    string
+		expectedErr string
+	}{
+		{
+			name: "interfaces",
+			ethernet: `    interfaces: [eth1, enp3s0]
+`,
+		},
+		{
+			name: "interfaces with address",
+			ethernet: `    interfaces: [eth1]
+    address: 192.168.1.10
+`,
+			expectedErr: "mutually exclusive",
+		},
+		{
+			name: "invalid interface name",
+			ethernet: `    interfaces: ["../eth1"]
+`,
+			expectedErr: "invalid interface name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.ethernet), 0644))
+
+			cfg, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"eth1", "enp3s0"}, cfg.Transports.Ethernet.Interfaces)
+		})
+	}
+}
+
+func TestConfig_Validate_MDNSRename(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+  mdns:
+`
+
+	tests := []struct {
+		name        string
+		rename      string
+		expectedErr string
+	}{
+		{name: "default", rename: `""`},
+		{name: "suffix", rename: "suffix"},
+		{name: "number", rename: "number"},
+		{name: "invalid", rename: "random", expectedErr: "service.mdns.rename"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+"    rename: "+tt.rename+"\n"), 0644))
+
+			_, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_Validate_DNSSD(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+  dnssd:
+`
+
+	tests := []struct {
+		name        string
+		dnssd       string
+		expectedErr string
+	}{
+		{name: "disabled", dnssd: "    enabled: false\n"},
+		{
+			name:  "unsigned",
+			dnssd: "    enabled: true\n    server: \"192.0.2.53\"\n    zone: \"prov.example.com\"\n",
+		},
+		{
+			name: "signed",
+			dnssd: "    enabled: true\n    server: \"ns.example.com:53\"\n    zone: \"prov.example.com\"\n" +
+				"    ttl: \"5m\"\n    tsig:\n      key_name: \"boardingpass\"\n      algorithm: \"hmac-sha512\"\n" +
+				"      secret_file: \"/etc/boardingpass/tsig.key\"\n",
+		},
+		{
+			name:        "missing server",
+			dnssd:       "    enabled: true\n    zone: \"prov.example.com\"\n",
+			expectedErr: "service.dnssd.server",
+		},
+		{
+			name:        "missing zone",
+			dnssd:       "    enabled: true\n    server: \"192.0.2.53\"\n",
+			expectedErr: "service.dnssd.zone",
+		},
+		{
+			name:        "invalid ttl",
+			dnssd:       "    enabled: true\n    server: \"192.0.2.53\"\n    zone: \"prov.example.com\"\n    ttl: \"10ms\"\n",
+			expectedErr: "service.dnssd.ttl",
+		},
+		{
+			name: "invalid algorithm",
+			dnssd: "    enabled: true\n    server: \"192.0.2.53\"\n    zone: \"prov.example.com\"\n" +
+				"    tsig:\n      key_name: \"boardingpass\"\n      algorithm: \"hmac-md5\"\n" +
+				"      secret_file: \"/etc/boardingpass/tsig.key\"\n",
+			expectedErr: "service.dnssd.tsig.algorithm",
+		},
+		{
+			name: "key without secret",
+			dnssd: "    enabled: true\n    server: \"192.0.2.53\"\n    zone: \"prov.example.com\"\n" +
+				"    tsig:\n      key_name: \"boardingpass\"\n",
+			expectedErr: "key_name and secret_file",
+		},
+		{
+			name: "relative secret file",
+			dnssd: "    enabled: true\n    server: \"192.0.2.53\"\n    zone: \"prov.example.com\"\n" +
+				"    tsig:\n      key_name: \"boardingpass\"\n      secret_file: \"tsig.key\"\n",
+			expectedErr: "absolute path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.dnssd), 0644))
+
+			_, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_Validate_Callback(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+  callback:
+`
+
+	tests := []struct {
+		name        string
+		callback    string
+		expectedErr string
+	}{
+		{name: "disabled", callback: "    url: \"\"\n"},
+		{name: "system roots", callback: "    url: \"https://controller.example.com:9456/devices\"\n"},
+		{
+			name:     "custom CA",
+			callback: "    url: \"https://192.0.2.1:9456/devices\"\n    ca_cert: \"/etc/boardingpass/controller-ca.crt\"\n",
+		},
+		{name: "plain HTTP", callback: "    url: \"http://controller.example.com/devices\"\n", expectedErr: "https"},
+		{name: "relative URL", callback: "    url: \"/devices\"\n", expectedErr: "absolute URL"},
+		{
+			name:        "relative CA",
+			callback:    "    url: \"https://controller.example.com/devices\"\n    ca_cert: \"ca.crt\"\n",
+			expectedErr: "absolute path",
+		},
+		{name: "CA without URL", callback: "    ca_cert: \"/etc/boardingpass/ca.crt\"\n", expectedErr: "requires"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.callback), 0644))
+
+			_, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_Validate_Enrollment(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+enrollment:
+  flightctl:
+`
+
+	tests := []struct {
+		name        string
+		flightctl   string
+		expectedErr string
+	}{
+		{name: "unconfigured", flightctl: "    server: \"\"\n"},
+		{
+			name:      "server and CA",
+			flightctl: "    server: \"https://api.flightctl.example.com\"\n    ca_cert: \"/etc/boardingpass/flightctl-ca.crt\"\n",
+		},
+		{name: "approval timeout", flightctl: "    approval_timeout: \"4h\"\n"},
+		{name: "plain HTTP", flightctl: "    server: \"http://api.flightctl.example.com\"\n", expectedErr: "https URL"},
+		{name: "relative CA", flightctl: "    ca_cert: \"ca.crt\"\n", expectedErr: "absolute path"},
+		{name: "short approval timeout", flightctl: "    approval_timeout: \"10s\"\n", expectedErr: "at least 1 minute"},
+		{name: "invalid approval timeout", flightctl: "    approval_timeout: \"soon\"\n", expectedErr: "invalid approval_timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.flightctl), 0644))
+
+			_, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_Validate_EnrollmentBackends(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+commands:
+  - id: "enroll-awx"
+    path: "/usr/lib/boardingpass/scripts/enroll-awx.sh"
+    params:
+      - name: "url"
+        type: "string"
+      - name: "token"
+      - name: "inventory"
+        optional: true
+  - id: "reboot"
+    path: "/usr/bin/systemctl"
+    args: ["reboot"]
+  - id: "run-anything"
+    path: "/usr/bin/run"
+    max_params: 2
+enrollment:
+  backends:
+`
+
+	tests := []struct {
+		name        string
+		backends    string
+		expectedErr string
+	}{
+		{
+			name:     "command backend",
+			backends: "    - name: \"awx\"\n      display_name: \"AWX\"\n      command: \"enroll-awx\"\n      secret_params: [\"token\"]\n",
+		},
+		{name: "command without params", backends: "    - name: \"reboot\"\n      command: \"reboot\"\n"},
+		{name: "invalid name", backends: "    - name: \"AWX\"\n      command: \"enroll-awx\"\n", expectedErr: "lower-case letters"},
+		{name: "reserved name", backends: "    - name: \"flightctl\"\n      command: \"enroll-awx\"\n", expectedErr: "already used"},
+		{
+			name:        "duplicate name",
+			backends:    "    - name: \"awx\"\n      command: \"enroll-awx\"\n    - name: \"awx\"\n      command: \"reboot\"\n",
+			expectedErr: "already used",
+		},
+		{name: "unknown command", backends: "    - name: \"acm\"\n      command: \"enroll-acm\"\n", expectedErr: "not an allow-listed command"},
+		{name: "undeclared params", backends: "    - name: \"any\"\n      command: \"run-anything\"\n", expectedErr: "must declare its params"},
+		{
+			name:        "unknown secret param",
+			backends:    "    - name: \"awx\"\n      command: \"enroll-awx\"\n      secret_params: [\"password\"]\n",
+			expectedErr: "has no param \"password\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.backends), 0644))
+
+			cfg, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			// Secret params of a backend are secret params of its command
+			cmd, ok := cfg.GetCommandByID("enroll-awx")
+			require.True(t, ok)
+			assert.Equal(t, strings.Contains(tt.backends, `secret_params: ["token"]`), cmd.Params[1].Secret)
+			assert.False(t, cmd.Params[0].Secret)
+		})
+	}
+}
+
+func TestConfig_Validate_Relay(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  relay:
+    enabled: true
+`
+
+	tests := []struct {
+		name        string
+		relay       string
+		expectedErr string
+	}{
+		{name: "system roots", relay: "    url: \"wss://relay.example.com\"\n"},
+		{
+			name: "custom CA, device ID and token",
+			relay: `    url: "wss://192.0.2.1:9457"
+    device_id: "SN1234"
+    ca_cert: "/etc/boardingpass/relay-ca.crt"
+    token_file: "/etc/boardingpass/relay-token"
+`,
+		},
+		{name: "missing URL", relay: "    device_id: \"SN1234\"\n", expectedErr: "transports.relay.url is required"},
+		{name: "plain WebSocket", relay: "    url: \"ws://relay.example.com\"\n", expectedErr: "wss://"},
+		{name: "HTTPS", relay: "    url: \"https://relay.example.com\"\n", expectedErr: "wss://"},
+		{
+			name:        "relative CA",
+			relay:       "    url: \"wss://relay.example.com\"\n    ca_cert: \"ca.crt\"\n",
+			expectedErr: "transports.relay.ca_cert",
+		},
+		{
+			name:        "relative token file",
+			relay:       "    url: \"wss://relay.example.com\"\n    token_file: \"token\"\n",
+			expectedErr: "transports.relay.token_file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.relay), 0644))
+
+			_, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_Validate_CommandParams(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  ethernet:
+    enabled: true
+
+commands:
+  - id: "set-ip"
+    path: "/usr/lib/boardingpass/scripts/set-ip.sh"
+`
+
+	tests := []struct {
+		name        string
+		command     string
+		expectedErr string
+	}{
+		{
+			name: "typed params",
+			command: `    params:
+      - name: interface
+        pattern: "[a-z0-9]+"
+      - name: address
+        type: cidr
+      - name: gateway
+        type: ipv4
+        optional: true
+`,
+		},
+		{
+			name:    "matching max_params",
+			command: "    max_params: 1\n    params:\n      - name: interface\n",
+		},
+		{
+			name:        "conflicting max_params",
+			command:     "    max_params: 2\n    params:\n      - name: interface\n",
+			expectedErr: "max_params must match",
+		},
+		{
+			name:        "missing name",
+			command:     "    params:\n      - type: ip\n",
+			expectedErr: "params[0].name is required",
+		},
+		{
+			name:        "duplicate name",
+			command:     "    params:\n      - name: dns\n      - name: dns\n",
+			expectedErr: "duplicate param dns",
+		},
+		{
+			name:        "unknown type",
+			command:     "    params:\n      - name: address\n        type: mac\n",
+			expectedErr: `unknown type "mac"`,
+		},
+		{
+			name:        "invalid pattern",
+			command:     "    params:\n      - name: interface\n        pattern: \"[a-z\"\n",
+			expectedErr: "invalid pattern",
+		},
+		{
+			name:        "pattern escaping its group",
+			command:     "    params:\n      - name: interface\n        pattern: \"a)|(b\"\n",
+			expectedErr: "invalid pattern",
+		},
+		{
+			name: "required after optional",
+			command: `    params:
+      - name: interface
+        optional: true
+      - name: address
+`,
+			expectedErr: "follows an optional one",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.command), 0644))
+
+			_, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCommandParam_PatternRegexp(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "`+filepath.Join(tmpDir, "issued")+`"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  ethernet:
+    enabled: true
+
+commands:
+  - id: "set-ip"
+    path: "/usr/lib/boardingpass/scripts/set-ip.sh"
+    params:
+      - name: interface
+        pattern: "eth[0-9]|wlan[0-9]"
+      - name: address
+`), 0644))
+
+	cfg, err := config.Load(configFile)
+	require.NoError(t, err)
+	cmd, ok := cfg.GetCommandByID("set-ip")
+	require.True(t, ok)
+
+	re, err := cmd.Params[0].PatternRegexp()
+	require.NoError(t, err)
+	assert.True(t, re.MatchString("wlan0"))
+	assert.False(t, re.MatchString("eth0; reboot"), "the pattern must match the whole value")
+	again, err := cmd.Params[0].PatternRegexp()
+	require.NoError(t, err)
+	assert.Same(t, re, again, "compiled once at load time")
+
+	re, err = cmd.Params[1].PatternRegexp()
+	require.NoError(t, err)
+	assert.Nil(t, re)
+}
+
+func TestConfig_Validate_CommandSandbox(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  ethernet:
+    enabled: true
+
+commands:
+  - id: "set-ntp"
+    path: "/usr/lib/boardingpass/scripts/set-ntp.sh"
+    sandbox:
+`
+
+	tests := []struct {
+		name        string
+		sandbox     string
+		expectedErr string
+	}{
+		{
+			name: "all settings",
+			sandbox: `      memory_max: "256M"
+      cpu_quota: "50%"
+      read_write_paths: ["/etc/chrony.d", "/run/chrony", "/var/lib/my app"]
+      environment:
+        LANG: "C"
+`,
+		},
+		{name: "no limits", sandbox: "      environment: {}\n"},
+		{name: "invalid memory_max", sandbox: "      memory_max: \"lots\"\n", expectedErr: "sandbox.memory_max"},
+		{name: "invalid cpu_quota", sandbox: "      cpu_quota: \"0.5\"\n", expectedErr: "sandbox.cpu_quota"},
+		{name: "zero cpu_quota", sandbox: "      cpu_quota: \"0%\"\n", expectedErr: "sandbox.cpu_quota"},
+		{
+			name:        "relative read_write_path",
+			sandbox:     "      read_write_paths: [\"etc/chrony.d\"]\n",
+			expectedErr: "sandbox.read_write_paths",
+		},
+		{
+			name:        "read_write_path with newline",
+			sandbox:     "      read_write_paths: [\"/etc/my\\ndir\"]\n",
+			expectedErr: "sandbox.read_write_paths",
+		},
+		{
+			name:        "invalid variable name",
+			sandbox:     "      environment:\n        \"MY-VAR\": \"1\"\n",
+			expectedErr: "sandbox.environment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.sandbox), 0644))
+
+			_, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_Validate_CommandLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	base := `
+service:
+  inactivity_timeout: "10m"
+  session_ttl: "30m"
+  sentinel_file: "` + filepath.Join(tmpDir, "issued") + `"
+  port: 8443
+  tls_cert: "/var/lib/boardingpass/tls/server.crt"
+  tls_key: "/var/lib/boardingpass/tls/server.key"
+
+transports:
+  ethernet:
+    enabled: true
+
+commands:
+  - id: "set-ip"
+    path: "/usr/lib/boardingpass/scripts/set-ip.sh"
+`
+
+	tests := []struct {
+		name          string
+		limits        string
+		expectedErr   string
+		wantTimeout   time.Duration
+		wantMaxOutput int
+		wantExclusive string
+	}{
+		{
+			name:          "defaults",
+			wantTimeout:   config.DefaultCommandTimeout,
+			wantMaxOutput: config.DefaultCommandMaxOutputBytes,
+		},
+		{
+			name:          "all limits",
+			limits:        "    timeout: \"90s\"\n    max_output_bytes: 4096\n    exclusive: \"network\"\n",
+			wantTimeout:   90 * time.Second,
+			wantMaxOutput: 4096,
+			wantExclusive: "network",
+		},
+		{name: "invalid timeout", limits: "    timeout: \"soon\"\n", expectedErr: "command set-ip: invalid timeout"},
+		{name: "short timeout", limits: "    timeout: \"10ms\"\n", expectedErr: "timeout must be at least 1 second"},
+		{name: "negative max_output_bytes", limits: "    max_output_bytes: -1\n", expectedErr: "max_output_bytes must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(base+tt.limits), 0644))
+
+			cfg, err := config.Load(configFile)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			cmd := cfg.Commands[0]
+			timeout, err := cmd.GetTimeout()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTimeout, timeout)
+			assert.Equal(t, tt.wantMaxOutput, cmd.GetMaxOutputBytes())
+			assert.Equal(t, tt.wantExclusive, cmd.Exclusive)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// maxAnnouncementSize bounds the request body of an announcement.
+const maxAnnouncementSize = 1 << 20
+
+// Device is a device that called in, with its latest announcement.
+type Device struct {
+	protocol.DeviceAnnouncement `yaml:",inline"`
+	RemoteAddr                  string    `json:"remote_address" yaml:"remote_address"`
+	FirstSeen                   time.Time `json:"first_seen" yaml:"first_seen"`
+	LastSeen                    time.Time `json:"last_seen" yaml:"last_seen"`
+}
+
+// Registry records the devices that called in. As an http.Handler, it
+// accepts announcements with POST and lists the devices with GET.
+type Registry struct {
+	mu       sync.RWMutex
+	devices  map[string]*Device
+	onReport func(Device, bool)
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		devices: make(map[string]*Device),
+	}
+}
+
+// SetReportCallback sets a function that is called with every announcement
+// received, and whether the device called in for the first time.
+func (r *Registry) SetReportCallback(fn func(device Device, first bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReport = fn
+}
+
+// Devices returns the devices that called in, in order of their first call.
+func (r *Registry) Devices() []Device {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	devices := make([]Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		devices = append(devices, *d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].FirstSeen.Before(devices[j].FirstSeen) })
+	return devices
+}
+
+// ServeHTTP handles POST (announce) and GET (list) requests.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		r.handleReport(w, req)
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(r.Devices()); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Registry) handleReport(w http.ResponseWriter, req *http.Request) {
+	var announcement protocol.DeviceAnnouncement
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxAnnouncementSize))
+	if err := dec.Decode(&announcement); err != nil {
+		http.Error(w, "Invalid announcement", http.StatusBadRequest)
+		return
+	}
+	if announcement.ID == "" {
+		http.Error(w, "Announcement lacks a device ID", http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	device, known := r.devices[announcement.ID]
+	if !known {
+		device = &Device{FirstSeen: now}
+		r.devices[announcement.ID] = device
+	}
+	device.DeviceAnnouncement = announcement
+	device.RemoteAddr = req.RemoteAddr
+	device.LastSeen = now
+	snapshot := *device
+	onReport := r.onReport
+	r.mu.Unlock()
+
+	if onReport != nil {
+		onReport(snapshot, !known)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postAnnouncement(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/devices", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.10:40000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRegistry_Report(t *testing.T) {
+	registry := controller.NewRegistry()
+	var reports []bool
+	registry.SetReportCallback(func(_ controller.Device, first bool) {
+		reports = append(reports, first)
+	})
+
+	rec := postAnnouncement(t, registry, `{"id":"SN1","addresses":["192.0.2.10"],"port":9455,"fingerprint":"SHA256:a"}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = postAnnouncement(t, registry, `{"id":"SN2","addresses":["192.0.2.20"],"port":9455}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// A repeated announcement updates the device
+	rec = postAnnouncement(t, registry, `{"id":"SN1","addresses":["192.0.2.11"],"port":9455,"fingerprint":"SHA256:b"}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []bool{true, true, false}, reports)
+
+	devices := registry.Devices()
+	require.Len(t, devices, 2)
+	assert.Equal(t, "SN1", devices[0].ID)
+	assert.Equal(t, []string{"192.0.2.11"}, devices[0].Addresses)
+	assert.Equal(t, "SHA256:b", devices[0].Fingerprint)
+	assert.Equal(t, "192.0.2.10:40000", devices[0].RemoteAddr)
+	assert.False(t, devices[0].LastSeen.Before(devices[0].FirstSeen))
+	assert.Equal(t, "SN2", devices[1].ID)
+}
+
+func TestRegistry_List(t *testing.T) {
+	registry := controller.NewRegistry()
+	postAnnouncement(t, registry, `{"id":"SN1","addresses":["192.0.2.10"],"port":9455}`)
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/devices", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var devices []controller.Device
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &devices))
+	require.Len(t, devices, 1)
+	assert.Equal(t, "SN1", devices[0].ID)
+	assert.Equal(t, 9455, devices[0].Port)
+}
+
+func TestRegistry_InvalidRequests(t *testing.T) {
+	registry := controller.NewRegistry()
+
+	assert.Equal(t, http.StatusBadRequest, postAnnouncement(t, registry, `not json`).Code)
+	assert.Equal(t, http.StatusBadRequest, postAnnouncement(t, registry, `{"addresses":["192.0.2.10"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		postAnnouncement(t, registry, `{"id":"SN1","pad":"`+strings.Repeat("x", 2<<20)+`"}`).Code)
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/devices", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	assert.Empty(t, registry.Devices())
+}
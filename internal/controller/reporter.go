@@ -0,0 +1,72 @@
+// Package controller implements the phone-home protocol between the
+// BoardingPass service and a provisioning controller: the service reports
+// how to reach it, and the controller keeps track of the devices that
+// called in.
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const reportTimeout = 30 * time.Second
+
+// Reporter announces the device to a provisioning controller.
+type Reporter struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewReporter creates a reporter that posts to the controller URL. The
+// controller's certificate is verified against rootCAs, or the system roots
+// if rootCAs is nil.
+func NewReporter(url string, rootCAs *x509.CertPool) *Reporter {
+	return &Reporter{
+		url: url,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					MinVersion: tls.VersionTLS12,
+					RootCAs:    rootCAs,
+				},
+			},
+			Timeout: reportTimeout,
+		},
+	}
+}
+
+// Report posts an announcement to the controller.
+func (r *Reporter) Report(ctx context.Context, announcement *protocol.DeviceAnnouncement) error {
+	body, err := json.Marshal(announcement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal announcement: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach controller: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("controller responded with %s", resp.Status)
+	}
+	return nil
+}
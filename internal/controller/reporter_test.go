@@ -0,0 +1,64 @@
+package controller_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/controller"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporter_Report(t *testing.T) {
+	registry := controller.NewRegistry()
+	server := httptest.NewTLSServer(registry)
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	reporter := controller.NewReporter(server.URL+"/devices", pool)
+
+	announcement := &protocol.DeviceAnnouncement{
+		ID:          "SN1234",
+		System:      protocol.SystemInfo{Hostname: "edge-01"},
+		Fingerprint: "SHA256:abc",
+		Addresses:   []string{"192.0.2.10"},
+		Port:        9455,
+	}
+	require.NoError(t, reporter.Report(context.Background(), announcement))
+
+	devices := registry.Devices()
+	require.Len(t, devices, 1)
+	assert.Equal(t, "edge-01", devices[0].System.Hostname)
+	assert.Equal(t, []string{"192.0.2.10"}, devices[0].Addresses)
+}
+
+func TestReporter_Errors(t *testing.T) {
+	announcement := &protocol.DeviceAnnouncement{ID: "SN1234"}
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		server := httptest.NewTLSServer(controller.NewRegistry())
+		defer server.Close()
+
+		err := controller.NewReporter(server.URL, x509.NewCertPool()).Report(context.Background(), announcement)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to reach controller")
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "no", http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		err := controller.NewReporter(server.URL, pool).Report(context.Background(), announcement)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "403")
+	})
+}
@@ -0,0 +1,473 @@
+// Package dbus implements a minimal D-Bus client for talking to system
+// services such as BlueZ, NetworkManager and systemd's hostnamed.
+//
+// It supports method calls, signals and exporting objects over Unix domain
+// sockets with EXTERNAL authentication, which covers the system and session
+// buses on Linux. File descriptor passing is not supported.
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultSystemBusAddress is used when DBUS_SYSTEM_BUS_ADDRESS is unset.
+	DefaultSystemBusAddress = "unix:path=/var/run/dbus/system_bus_socket"
+
+	busName      = "org.freedesktop.DBus"
+	busPath      = ObjectPath("/org/freedesktop/DBus")
+	busInterface = "org.freedesktop.DBus"
+)
+
+// ErrClosed is returned for calls on a closed connection.
+var ErrClosed = errors.New("dbus: connection closed")
+
+// Method handles an incoming method call on an exported object.
+// The returned values form the reply body; their signature is inferred.
+// Returning an *Error sends a D-Bus error with that name.
+type Method func(call *Message) ([]any, error)
+
+// Conn is a connection to a message bus.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	name   string
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	serial   uint32
+	pending  map[uint32]chan *Message
+	objects  map[ObjectPath]map[string]map[string]Method
+	signals  []chan<- *Message
+	closed   bool
+	closeErr error
+
+	calls chan *Message
+	done  chan struct{}
+}
+
+// SystemBus connects to the system message bus.
+func SystemBus() (*Conn, error) {
+	addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	if addr == "" {
+		addr = DefaultSystemBusAddress
+	}
+	return Dial(addr)
+}
+
+// SessionBus connects to the session message bus.
+func SessionBus() (*Conn, error) {
+	addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if addr == "" {
+		return nil, fmt.Errorf("dbus: DBUS_SESSION_BUS_ADDRESS is not set")
+	}
+	return Dial(addr)
+}
+
+// Dial connects to the bus at the given address, such as
+// "unix:path=/run/dbus/system_bus_socket". Multiple addresses separated by
+// ';' are tried in order.
+func Dial(address string) (*Conn, error) {
+	var lastErr error
+	for _, addr := range strings.Split(address, ";") {
+		if addr == "" {
+			continue
+		}
+		c, err := dialOne(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn, err := NewConn(c)
+		if err != nil {
+			_ = c.Close()
+			lastErr = err
+			continue
+		}
+		return conn, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("dbus: no usable address in %q", address)
+	}
+	return nil, lastErr
+}
+
+func dialOne(addr string) (net.Conn, error) {
+	transport, params, ok := strings.Cut(addr, ":")
+	if !ok || transport != "unix" {
+		return nil, fmt.Errorf("dbus: unsupported address %q", addr)
+	}
+	for _, kv := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(kv, "=")
+		switch key {
+		case "path":
+			return net.Dial("unix", value)
+		case "abstract":
+			return net.Dial("unix", "@"+value)
+		}
+	}
+	return nil, fmt.Errorf("dbus: address %q has no path", addr)
+}
+
+// NewConn authenticates over an established stream and registers with the bus.
+func NewConn(c net.Conn) (*Conn, error) {
+	conn := &Conn{
+		conn:    c,
+		reader:  bufio.NewReader(c),
+		pending: make(map[uint32]chan *Message),
+		objects: make(map[ObjectPath]map[string]map[string]Method),
+		calls:   make(chan *Message, 64),
+		done:    make(chan struct{}),
+	}
+
+	if err := conn.authenticate(); err != nil {
+		return nil, err
+	}
+
+	go conn.readLoop()
+	go conn.dispatchLoop()
+
+	reply, err := conn.Call(context.Background(), busName, busPath, busInterface, "Hello")
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("dbus: Hello failed: %w", err)
+	}
+	if len(reply) == 1 {
+		conn.name, _ = reply[0].(string)
+	}
+
+	return conn, nil
+}
+
+// authenticate performs SASL EXTERNAL authentication with the current uid.
+func (c *Conn) authenticate() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return fmt.Errorf("dbus: auth failed: %w", err)
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("dbus: auth failed: %w", err)
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus: auth rejected: %s", strings.TrimSpace(line))
+	}
+
+	if _, err := c.conn.Write([]byte("BEGIN\r\n")); err != nil {
+		return fmt.Errorf("dbus: auth failed: %w", err)
+	}
+	return nil
+}
+
+// UniqueName returns the unique bus name assigned to this connection.
+func (c *Conn) UniqueName() string {
+	return c.name
+}
+
+// Close closes the connection. Pending calls fail with ErrClosed.
+func (c *Conn) Close() error {
+	c.shutdown(ErrClosed)
+	return nil
+}
+
+func (c *Conn) shutdown(err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.closeErr = err
+	c.pending = nil
+	c.mu.Unlock()
+
+	_ = c.conn.Close()
+	close(c.done)
+}
+
+func (c *Conn) nextSerial() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serial++
+	if c.serial == 0 {
+		c.serial = 1
+	}
+	return c.serial
+}
+
+// send assigns a serial number to msg and writes it to the bus.
+func (c *Conn) send(msg *Message) error {
+	if msg.Serial == 0 {
+		msg.Serial = c.nextSerial()
+	}
+	data, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(data); err != nil {
+		return fmt.Errorf("dbus: write failed: %w", err)
+	}
+	return nil
+}
+
+// Call invokes a method and waits for its reply. The argument signature is
+// inferred from args (see SignatureOf).
+func (c *Conn) Call(ctx context.Context, dest string, path ObjectPath, iface, member string, args ...any) ([]any, error) {
+	sig, err := SignatureOf(args...)
+	if err != nil {
+		return nil, err
+	}
+	return c.CallWithSignature(ctx, dest, path, iface, member, sig, args...)
+}
+
+// CallWithSignature invokes a method with an explicit argument signature.
+func (c *Conn) CallWithSignature(ctx context.Context, dest string, path ObjectPath, iface, member string, sig Signature, args ...any) ([]any, error) {
+	msg := &Message{
+		Type:        TypeMethodCall,
+		Serial:      c.nextSerial(),
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Destination: dest,
+		Signature:   sig,
+		Body:        args,
+	}
+
+	ch := make(chan *Message, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	c.pending[msg.Serial] = ch
+	c.mu.Unlock()
+
+	if err := c.send(msg); err != nil {
+		c.forget(msg.Serial)
+		return nil, err
+	}
+
+	select {
+	case reply := <-ch:
+		if reply.Type == TypeError {
+			return nil, errorFromMessage(reply)
+		}
+		return reply.Body, nil
+	case <-c.done:
+		return nil, c.err()
+	case <-ctx.Done():
+		c.forget(msg.Serial)
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Conn) forget(serial uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil {
+		delete(c.pending, serial)
+	}
+}
+
+func (c *Conn) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeErr != nil {
+		return c.closeErr
+	}
+	return ErrClosed
+}
+
+// Emit sends a signal from the given object path.
+func (c *Conn) Emit(path ObjectPath, iface, member string, args ...any) error {
+	sig, err := SignatureOf(args...)
+	if err != nil {
+		return err
+	}
+	return c.send(&Message{
+		Type:      TypeSignal,
+		Path:      path,
+		Interface: iface,
+		Member:    member,
+		Signature: sig,
+		Body:      args,
+	})
+}
+
+// Export registers methods for an interface on an object path. Calls to
+// unknown methods or objects are answered with UnknownMethod/UnknownObject.
+func (c *Conn) Export(path ObjectPath, iface string, methods map[string]Method) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.objects[path] == nil {
+		c.objects[path] = make(map[string]map[string]Method)
+	}
+	c.objects[path][iface] = methods
+}
+
+// Unexport removes all interfaces exported on an object path.
+func (c *Conn) Unexport(path ObjectPath) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objects, path)
+}
+
+// Signal registers a channel that receives every incoming signal.
+// Sends are non-blocking; signals are dropped when the channel is full.
+// Use AddMatch to ask the bus to route signals to this connection.
+func (c *Conn) Signal(ch chan<- *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signals = append(c.signals, ch)
+}
+
+// RemoveSignal unregisters a channel registered with Signal.
+func (c *Conn) RemoveSignal(ch chan<- *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, s := range c.signals {
+		if s == ch {
+			c.signals = append(c.signals[:i], c.signals[i+1:]...)
+			return
+		}
+	}
+}
+
+// RequestName asks the bus to assign a well-known name to this connection.
+func (c *Conn) RequestName(ctx context.Context, name string) error {
+	reply, err := c.Call(ctx, busName, busPath, busInterface, "RequestName", name, uint32(0))
+	if err != nil {
+		return err
+	}
+	// 1 = DBUS_REQUEST_NAME_REPLY_PRIMARY_OWNER
+	if len(reply) != 1 || reply[0] != uint32(1) {
+		return fmt.Errorf("dbus: could not acquire name %s", name)
+	}
+	return nil
+}
+
+// AddMatch adds a match rule so the bus routes matching signals to this connection.
+func (c *Conn) AddMatch(ctx context.Context, rule string) error {
+	_, err := c.Call(ctx, busName, busPath, busInterface, "AddMatch", rule)
+	return err
+}
+
+func (c *Conn) readLoop() {
+	for {
+		msg, err := ReadMessage(c.reader)
+		if err != nil {
+			c.shutdown(fmt.Errorf("dbus: connection lost: %w", err))
+			return
+		}
+
+		switch msg.Type {
+		case TypeMethodReturn, TypeError:
+			c.mu.Lock()
+			ch := c.pending[msg.ReplySerial]
+			delete(c.pending, msg.ReplySerial)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		case TypeSignal:
+			c.mu.Lock()
+			signals := append([]chan<- *Message(nil), c.signals...)
+			c.mu.Unlock()
+			for _, ch := range signals {
+				select {
+				case ch <- msg:
+				default:
+				}
+			}
+		case TypeMethodCall:
+			select {
+			case c.calls <- msg:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+// dispatchLoop handles incoming method calls one at a time, in arrival order.
+// Running handlers outside the read loop lets them make calls of their own.
+func (c *Conn) dispatchLoop() {
+	for {
+		select {
+		case call := <-c.calls:
+			c.handleCall(call)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Conn) handleCall(call *Message) {
+	c.mu.Lock()
+	ifaces, known := c.objects[call.Path]
+	var method Method
+	if known {
+		if call.Interface != "" {
+			method = ifaces[call.Interface][call.Member]
+		} else {
+			for _, methods := range ifaces {
+				if m, ok := methods[call.Member]; ok {
+					method = m
+					break
+				}
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	var body []any
+	var err error
+	switch {
+	case !known:
+		err = &Error{Name: "org.freedesktop.DBus.Error.UnknownObject", Message: fmt.Sprintf("no object at %s", call.Path)}
+	case method == nil:
+		err = &Error{Name: "org.freedesktop.DBus.Error.UnknownMethod", Message: fmt.Sprintf("unknown method %s.%s", call.Interface, call.Member)}
+	default:
+		body, err = method(call)
+	}
+
+	if call.Flags&FlagNoReplyExpected != 0 {
+		return
+	}
+
+	reply := &Message{
+		Type:        TypeMethodReturn,
+		ReplySerial: call.Serial,
+		Destination: call.Sender,
+	}
+	if err == nil {
+		reply.Signature, err = SignatureOf(body...)
+		reply.Body = body
+	}
+	if err != nil {
+		var dbusErr *Error
+		if !errors.As(err, &dbusErr) {
+			dbusErr = &Error{Name: "org.freedesktop.DBus.Error.Failed", Message: err.Error()}
+		}
+		reply.Type = TypeError
+		reply.ErrorName = dbusErr.Name
+		reply.Signature = "s"
+		reply.Body = []any{dbusErr.Message}
+	}
+
+	_ = c.send(reply)
+}
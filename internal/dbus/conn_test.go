@@ -0,0 +1,174 @@
+package dbus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/internal/dbus/dbustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn_CallExportedMethod(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	service := bus.Dial(t)
+	client := bus.Dial(t)
+
+	assert.NotEmpty(t, service.UniqueName())
+	assert.NotEqual(t, service.UniqueName(), client.UniqueName())
+
+	ctx := context.Background()
+	require.NoError(t, service.RequestName(ctx, "org.example.Test"))
+
+	service.Export("/org/example", "org.example.Echo", map[string]dbus.Method{
+		"Echo": func(call *dbus.Message) ([]any, error) {
+			return call.Body, nil
+		},
+		"Fail": func(*dbus.Message) ([]any, error) {
+			return nil, &dbus.Error{Name: "org.example.Error.Nope", Message: "nope"}
+		},
+		"Broken": func(*dbus.Message) ([]any, error) {
+			return nil, errors.New("plain error")
+		},
+	})
+
+	reply, err := client.Call(ctx, "org.example.Test", "/org/example", "org.example.Echo", "Echo",
+		"hi", []byte{1, 2}, map[string]any{"k": dbus.MakeVariant(uint32(3))})
+	require.NoError(t, err)
+	assert.Equal(t, []any{"hi", []byte{1, 2}, map[string]any{"k": dbus.MakeVariant(uint32(3))}}, reply)
+
+	_, err = client.Call(ctx, "org.example.Test", "/org/example", "org.example.Echo", "Fail")
+	var dbusErr *dbus.Error
+	require.ErrorAs(t, err, &dbusErr)
+	assert.Equal(t, "org.example.Error.Nope", dbusErr.Name)
+	assert.Equal(t, "nope", dbusErr.Message)
+
+	_, err = client.Call(ctx, "org.example.Test", "/org/example", "org.example.Echo", "Broken")
+	require.ErrorAs(t, err, &dbusErr)
+	assert.Equal(t, "org.freedesktop.DBus.Error.Failed", dbusErr.Name)
+
+	_, err = client.Call(ctx, "org.example.Test", "/org/example", "org.example.Echo", "Missing")
+	require.ErrorAs(t, err, &dbusErr)
+	assert.Equal(t, "org.freedesktop.DBus.Error.UnknownMethod", dbusErr.Name)
+
+	_, err = client.Call(ctx, "org.example.Test", "/nowhere", "org.example.Echo", "Echo")
+	require.ErrorAs(t, err, &dbusErr)
+	assert.Equal(t, "org.freedesktop.DBus.Error.UnknownObject", dbusErr.Name)
+
+	_, err = client.Call(ctx, "org.example.Absent", "/", "org.example.Echo", "Echo")
+	require.ErrorAs(t, err, &dbusErr)
+	assert.Equal(t, "org.freedesktop.DBus.Error.ServiceUnknown", dbusErr.Name)
+}
+
+func TestConn_Properties(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	service := bus.Dial(t)
+	client := bus.Dial(t)
+	ctx := context.Background()
+
+	service.ExportProperties("/obj", func() map[string]map[string]any {
+		return map[string]map[string]any{
+			"org.example.Thing": {"Name": "thing", "Count": uint32(2)},
+		}
+	})
+
+	v, err := client.GetProperty(ctx, service.UniqueName(), "/obj", "org.example.Thing", "Name")
+	require.NoError(t, err)
+	assert.Equal(t, "thing", v)
+
+	all, err := client.GetAllProperties(ctx, service.UniqueName(), "/obj", "org.example.Thing")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"Name": "thing", "Count": uint32(2)}, all)
+
+	err = client.SetProperty(ctx, service.UniqueName(), "/obj", "org.example.Thing", "Name", "other")
+	assert.Error(t, err)
+}
+
+func TestConn_Signals(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	emitter := bus.Dial(t)
+	listener := bus.Dial(t)
+
+	ch := make(chan *dbus.Message, 4)
+	listener.Signal(ch)
+	require.NoError(t, listener.AddMatch(context.Background(), "type='signal'"))
+
+	require.NoError(t, emitter.EmitPropertiesChanged("/obj", "org.example.Thing", map[string]any{"Value": []byte{9}}))
+
+	select {
+	case msg := <-ch:
+		assert.Equal(t, dbus.ObjectPath("/obj"), msg.Path)
+		assert.Equal(t, "PropertiesChanged", msg.Member)
+		assert.Equal(t, emitter.UniqueName(), msg.Sender)
+		require.Len(t, msg.Body, 3)
+		assert.Equal(t, "org.example.Thing", msg.Body[0])
+		assert.Equal(t, map[string]any{"Value": dbus.MakeVariant([]byte{9})}, msg.Body[1])
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal not received")
+	}
+}
+
+func TestConn_CloseFailsPendingCalls(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	service := bus.Dial(t)
+	client := bus.Dial(t)
+
+	block := make(chan struct{})
+	defer close(block)
+	service.Export("/obj", "org.example.Slow", map[string]dbus.Method{
+		"Wait": func(*dbus.Message) ([]any, error) {
+			<-block
+			return nil, nil
+		},
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.Call(context.Background(), service.UniqueName(), "/obj", "org.example.Slow", "Wait")
+		errCh <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, client.Close())
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, dbus.ErrClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending call did not fail after Close")
+	}
+
+	_, err := client.Call(context.Background(), service.UniqueName(), "/obj", "org.example.Slow", "Wait")
+	assert.ErrorIs(t, err, dbus.ErrClosed)
+}
+
+func TestConn_CallContextTimeout(t *testing.T) {
+	bus := dbustest.NewBus(t)
+	service := bus.Dial(t)
+	client := bus.Dial(t)
+
+	block := make(chan struct{})
+	defer close(block)
+	service.Export("/obj", "org.example.Slow", map[string]dbus.Method{
+		"Wait": func(*dbus.Message) ([]any, error) {
+			<-block
+			return nil, nil
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Call(ctx, service.UniqueName(), "/obj", "org.example.Slow", "Wait")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDial_InvalidAddress(t *testing.T) {
+	_, err := dbus.Dial("tcp:host=localhost,port=1")
+	assert.Error(t, err)
+
+	_, err = dbus.Dial("unix:path=/nonexistent/socket")
+	assert.Error(t, err)
+}
@@ -0,0 +1,285 @@
+// Package dbustest provides an in-process message bus for testing D-Bus clients
+// and fake services without a system or session bus.
+package dbustest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+)
+
+// Bus is a minimal message bus. It routes method calls and replies by
+// destination (unique or well-known name) and broadcasts signals to every
+// connection; match rules are accepted but not evaluated.
+type Bus struct {
+	listener net.Listener
+	address  string
+
+	mu     sync.Mutex
+	nextID int
+	peers  map[string]*peer
+	names  map[string]string // well-known name -> unique name
+	wg     sync.WaitGroup
+}
+
+type peer struct {
+	name    string
+	conn    net.Conn
+	writeMu sync.Mutex
+}
+
+// NewBus starts a bus listening on a Unix socket in a temporary directory.
+// The bus is closed when the test finishes.
+func NewBus(t testing.TB) *Bus {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "dbustest")
+	if err != nil {
+		t.Fatalf("failed to create socket directory: %v", err)
+	}
+	sock := filepath.Join(dir, "bus")
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatalf("failed to listen on %s: %v", sock, err)
+	}
+
+	b := &Bus{
+		listener: ln,
+		address:  "unix:path=" + sock,
+		peers:    make(map[string]*peer),
+		names:    make(map[string]string),
+	}
+
+	b.wg.Add(1)
+	go b.acceptLoop()
+
+	t.Cleanup(func() {
+		b.Close()
+		_ = os.RemoveAll(dir)
+	})
+	return b
+}
+
+// Address returns the bus address for dbus.Dial.
+func (b *Bus) Address() string {
+	return b.address
+}
+
+// Dial connects a new client to the bus. The connection is closed when the test finishes.
+func (b *Bus) Dial(t testing.TB) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Dial(b.address)
+	if err != nil {
+		t.Fatalf("failed to connect to test bus: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+// Close stops the bus and disconnects all peers.
+func (b *Bus) Close() {
+	_ = b.listener.Close()
+	b.mu.Lock()
+	for _, p := range b.peers {
+		_ = p.conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+func (b *Bus) acceptLoop() {
+	defer b.wg.Done()
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go b.serve(c)
+	}
+}
+
+func (b *Bus) serve(c net.Conn) {
+	defer b.wg.Done()
+	defer func() {
+		_ = c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+	if err := handshake(c, r); err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	p := &peer{name: fmt.Sprintf(":1.%d", b.nextID), conn: c}
+	b.peers[p.name] = p
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.peers, p.name)
+		for name, owner := range b.names {
+			if owner == p.name {
+				delete(b.names, name)
+			}
+		}
+		b.mu.Unlock()
+	}()
+
+	for {
+		msg, err := dbus.ReadMessage(r)
+		if err != nil {
+			return
+		}
+		msg.Sender = p.name
+		b.route(p, msg)
+	}
+}
+
+// handshake accepts any EXTERNAL authentication.
+func handshake(c net.Conn, r *bufio.Reader) error {
+	if _, err := r.ReadByte(); err != nil { // leading NUL byte
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "AUTH"):
+			if _, err := c.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n")); err != nil {
+				return err
+			}
+		case line == "BEGIN":
+			return nil
+		default:
+			if _, err := c.Write([]byte("ERROR\r\n")); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (b *Bus) route(from *peer, msg *dbus.Message) {
+	if msg.Type == dbus.TypeMethodCall && msg.Destination == "org.freedesktop.DBus" {
+		b.handleBusCall(from, msg)
+		return
+	}
+
+	if msg.Type == dbus.TypeSignal && msg.Destination == "" {
+		b.mu.Lock()
+		peers := make([]*peer, 0, len(b.peers))
+		for _, p := range b.peers {
+			peers = append(peers, p)
+		}
+		b.mu.Unlock()
+		for _, p := range peers {
+			p.send(msg)
+		}
+		return
+	}
+
+	b.mu.Lock()
+	dest := msg.Destination
+	if owner, ok := b.names[dest]; ok {
+		dest = owner
+	}
+	target := b.peers[dest]
+	b.mu.Unlock()
+
+	if target == nil {
+		if msg.Type == dbus.TypeMethodCall && msg.Flags&dbus.FlagNoReplyExpected == 0 {
+			from.send(errorReply(msg, "org.freedesktop.DBus.Error.ServiceUnknown",
+				fmt.Sprintf("the name %s was not provided by any service", msg.Destination)))
+		}
+		return
+	}
+	target.send(msg)
+}
+
+func (b *Bus) handleBusCall(from *peer, msg *dbus.Message) {
+	reply := &dbus.Message{
+		Type:        dbus.TypeMethodReturn,
+		ReplySerial: msg.Serial,
+		Destination: from.name,
+		Sender:      "org.freedesktop.DBus",
+	}
+
+	switch msg.Member {
+	case "Hello":
+		reply.Signature = "s"
+		reply.Body = []any{from.name}
+	case "RequestName":
+		name, _ := msg.Body[0].(string)
+		b.mu.Lock()
+		owner, taken := b.names[name]
+		if !taken {
+			b.names[name] = from.name
+		}
+		b.mu.Unlock()
+		result := uint32(1) // primary owner
+		if taken && owner != from.name {
+			result = 3 // exists
+		}
+		reply.Signature = "u"
+		reply.Body = []any{result}
+	case "AddMatch", "RemoveMatch":
+		// Signals are broadcast unconditionally
+	case "GetNameOwner":
+		name, _ := msg.Body[0].(string)
+		b.mu.Lock()
+		owner, ok := b.names[name]
+		b.mu.Unlock()
+		if !ok {
+			from.send(errorReply(msg, "org.freedesktop.DBus.Error.NameHasNoOwner", name))
+			return
+		}
+		reply.Signature = "s"
+		reply.Body = []any{owner}
+	default:
+		from.send(errorReply(msg, "org.freedesktop.DBus.Error.UnknownMethod", msg.Member))
+		return
+	}
+
+	from.send(reply)
+}
+
+func errorReply(call *dbus.Message, name, text string) *dbus.Message {
+	return &dbus.Message{
+		Type:        dbus.TypeError,
+		ReplySerial: call.Serial,
+		Destination: call.Sender,
+		Sender:      "org.freedesktop.DBus",
+		ErrorName:   name,
+		Signature:   "s",
+		Body:        []any{text},
+	}
+}
+
+func (p *peer) send(msg *dbus.Message) {
+	out := *msg
+	if out.Serial == 0 {
+		out.Serial = 1
+	}
+	data, err := out.Marshal()
+	if err != nil {
+		return
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, _ = p.conn.Write(data)
+}
@@ -0,0 +1,339 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxDepth bounds container nesting, as required by the D-Bus specification.
+const maxDepth = 64
+
+var errShortBuffer = errors.New("dbus: message truncated")
+
+// decoder unmarshals values from the D-Bus wire format.
+//
+// Decoded values use these Go types: y byte, b bool, n int16, q uint16,
+// i int32, u/h uint32, x int64, t uint64, d float64, s string, o ObjectPath,
+// g Signature, v Variant, ay []byte, as []string, ao []ObjectPath, other
+// arrays []any, dicts with string keys map[string]any, dicts with object
+// path keys map[ObjectPath]any, other dicts map[any]any and structs []any.
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+	depth int
+}
+
+func newDecoder(buf []byte, order binary.ByteOrder) *decoder {
+	return &decoder{buf: buf, order: order}
+}
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		if d.pos >= len(d.buf) {
+			return errShortBuffer
+		}
+		d.pos++
+	}
+	return nil
+}
+
+func (d *decoder) take(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errShortBuffer
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint8() (uint8, error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	if err := d.align(2); err != nil {
+		return 0, err
+	}
+	b, err := d.take(2)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint16(b), nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.take(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	if err := d.align(8); err != nil {
+		return 0, err
+	}
+	b, err := d.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint64(b), nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.take(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	if b[n] != 0 {
+		return "", fmt.Errorf("dbus: string not NUL-terminated")
+	}
+	return string(b[:n]), nil
+}
+
+func (d *decoder) signature() (string, error) {
+	n, err := d.uint8()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.take(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	if b[n] != 0 {
+		return "", fmt.Errorf("dbus: signature not NUL-terminated")
+	}
+	return string(b[:n]), nil
+}
+
+// decode unmarshals one value per complete type in sig.
+func (d *decoder) decode(sig string) ([]any, error) {
+	types, err := splitSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, 0, len(types))
+	for _, t := range types {
+		v, err := d.value(t)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+//nolint:gocyclo // One case per D-Bus type code
+func (d *decoder) value(sig string) (any, error) {
+	switch sig[0] {
+	case 'y':
+		return d.uint8()
+	case 'b':
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		if n > 1 {
+			return nil, fmt.Errorf("dbus: invalid boolean value %d", n)
+		}
+		return n == 1, nil
+	case 'n':
+		n, err := d.uint16()
+		return int16(n), err // #nosec G115 - two's complement reinterpretation
+	case 'q':
+		return d.uint16()
+	case 'i':
+		n, err := d.uint32()
+		return int32(n), err // #nosec G115 - two's complement reinterpretation
+	case 'u', 'h':
+		return d.uint32()
+	case 'x':
+		n, err := d.uint64()
+		return int64(n), err // #nosec G115 - two's complement reinterpretation
+	case 't':
+		return d.uint64()
+	case 'd':
+		n, err := d.uint64()
+		return math.Float64frombits(n), err
+	case 's':
+		return d.string()
+	case 'o':
+		s, err := d.string()
+		return ObjectPath(s), err
+	case 'g':
+		s, err := d.signature()
+		return Signature(s), err
+	case 'v':
+		s, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		if _, rest, err := nextType(s); err != nil || rest != "" {
+			return nil, fmt.Errorf("dbus: invalid variant signature %q", s)
+		}
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		v, err := d.value(s)
+		return Variant{Sig: Signature(s), Value: v}, err
+	case 'a':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		return d.array(sig[1:])
+	case '(':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		return d.decode(sig[1 : len(sig)-1])
+	default:
+		return nil, fmt.Errorf("dbus: cannot decode type %q", sig)
+	}
+}
+
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > maxDepth {
+		return fmt.Errorf("dbus: container nesting too deep")
+	}
+	return nil
+}
+
+func (d *decoder) leave() {
+	d.depth--
+}
+
+func (d *decoder) array(elemSig string) (any, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if n > 64*1024*1024 {
+		return nil, fmt.Errorf("dbus: array too long (%d bytes)", n)
+	}
+	if err := d.align(alignment(elemSig[0])); err != nil {
+		return nil, err
+	}
+	end := d.pos + int(n)
+	if end > len(d.buf) {
+		return nil, errShortBuffer
+	}
+
+	switch elemSig {
+	case "y":
+		b, err := d.take(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case "s":
+		out := []string{}
+		for d.pos < end {
+			s, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	case "o":
+		out := []ObjectPath{}
+		for d.pos < end {
+			s, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ObjectPath(s))
+		}
+		return out, nil
+	}
+
+	if elemSig[0] == '{' {
+		return d.dict(elemSig, end)
+	}
+
+	out := []any{}
+	for d.pos < end {
+		v, err := d.value(elemSig)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *decoder) dict(elemSig string, end int) (any, error) {
+	kv, err := splitSignature(elemSig[1 : len(elemSig)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(kv) != 2 || !isBasicType(kv[0][0]) {
+		return nil, fmt.Errorf("dbus: invalid dict entry signature %q", elemSig)
+	}
+
+	entry := func() (any, any, error) {
+		if err := d.align(8); err != nil {
+			return nil, nil, err
+		}
+		k, err := d.value(kv[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err := d.value(kv[1])
+		return k, v, err
+	}
+
+	switch kv[0] {
+	case "s":
+		out := map[string]any{}
+		for d.pos < end {
+			k, v, err := entry()
+			if err != nil {
+				return nil, err
+			}
+			out[k.(string)] = v
+		}
+		return out, nil
+	case "o":
+		out := map[ObjectPath]any{}
+		for d.pos < end {
+			k, v, err := entry()
+			if err != nil {
+				return nil, err
+			}
+			out[k.(ObjectPath)] = v
+		}
+		return out, nil
+	default:
+		out := map[any]any{}
+		for d.pos < end {
+			k, v, err := entry()
+			if err != nil {
+				return nil, err
+			}
+			out[k] = v
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,315 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// encoder marshals values into the D-Bus wire format.
+// Alignment is relative to the start of buf, which must itself start on an
+// 8-byte boundary of the message.
+type encoder struct {
+	buf   []byte
+	order byteOrder
+}
+
+// byteOrder is implemented by binary.LittleEndian and binary.BigEndian.
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+func newEncoder(order byteOrder) *encoder {
+	return &encoder{order: order}
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.align(2)
+	e.buf = e.order.AppendUint16(e.buf, v)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = e.order.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.align(8)
+	e.buf = e.order.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s))) // #nosec G115 - message size is bounded well below 4 GiB
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// encode marshals values according to sig, which must contain one complete
+// type per value.
+func (e *encoder) encode(sig string, values ...any) error {
+	types, err := splitSignature(sig)
+	if err != nil {
+		return err
+	}
+	if len(types) != len(values) {
+		return fmt.Errorf("dbus: signature %q has %d types but %d values were given", sig, len(types), len(values))
+	}
+	for i, t := range types {
+		if err := e.value(t, reflect.ValueOf(values[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//nolint:gocyclo // One case per D-Bus type code
+func (e *encoder) value(sig string, v reflect.Value) error {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) {
+		if v.IsNil() {
+			return fmt.Errorf("dbus: cannot encode nil as %q", sig)
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return fmt.Errorf("dbus: cannot encode nil as %q", sig)
+	}
+
+	switch sig[0] {
+	case 'y':
+		n, err := uintOf(v, math.MaxUint8)
+		if err != nil {
+			return err
+		}
+		e.uint8(uint8(n)) // #nosec G115 - range checked by uintOf
+	case 'b':
+		if v.Kind() != reflect.Bool {
+			return typeError(sig, v)
+		}
+		var n uint32
+		if v.Bool() {
+			n = 1
+		}
+		e.uint32(n)
+	case 'n':
+		n, err := intOf(v, math.MinInt16, math.MaxInt16)
+		if err != nil {
+			return err
+		}
+		e.uint16(uint16(n)) // #nosec G115 - two's complement of a range-checked value
+	case 'q':
+		n, err := uintOf(v, math.MaxUint16)
+		if err != nil {
+			return err
+		}
+		e.uint16(uint16(n)) // #nosec G115 - range checked by uintOf
+	case 'i':
+		n, err := intOf(v, math.MinInt32, math.MaxInt32)
+		if err != nil {
+			return err
+		}
+		e.uint32(uint32(n)) // #nosec G115 - two's complement of a range-checked value
+	case 'u', 'h':
+		n, err := uintOf(v, math.MaxUint32)
+		if err != nil {
+			return err
+		}
+		e.uint32(uint32(n)) // #nosec G115 - range checked by uintOf
+	case 'x':
+		n, err := intOf(v, math.MinInt64, math.MaxInt64)
+		if err != nil {
+			return err
+		}
+		e.uint64(uint64(n)) // #nosec G115 - two's complement
+	case 't':
+		n, err := uintOf(v, math.MaxUint64)
+		if err != nil {
+			return err
+		}
+		e.uint64(n)
+	case 'd':
+		if v.Kind() != reflect.Float64 && v.Kind() != reflect.Float32 {
+			return typeError(sig, v)
+		}
+		e.uint64(math.Float64bits(v.Float()))
+	case 's', 'o':
+		if v.Kind() != reflect.String {
+			return typeError(sig, v)
+		}
+		e.string(v.String())
+	case 'g':
+		if v.Kind() != reflect.String {
+			return typeError(sig, v)
+		}
+		e.signature(v.String())
+	case 'v':
+		variant, ok := v.Interface().(Variant)
+		if !ok {
+			s, err := SignatureOf(v.Interface())
+			if err != nil {
+				return err
+			}
+			variant = Variant{Sig: s, Value: v.Interface()}
+		}
+		if _, rest, err := nextType(string(variant.Sig)); err != nil || rest != "" {
+			return fmt.Errorf("dbus: variant signature %q is not a single complete type", variant.Sig)
+		}
+		e.signature(string(variant.Sig))
+		return e.value(string(variant.Sig), reflect.ValueOf(variant.Value))
+	case 'a':
+		return e.array(sig, v)
+	case '(':
+		return e.structure(sig, v)
+	default:
+		return fmt.Errorf("dbus: cannot encode type %q", sig)
+	}
+	return nil
+}
+
+func (e *encoder) array(sig string, v reflect.Value) error {
+	elemSig := sig[1:]
+
+	e.uint32(0) // length placeholder
+	lenPos := len(e.buf) - 4
+	e.align(alignment(elemSig[0]))
+	start := len(e.buf)
+
+	switch {
+	case elemSig[0] == '{':
+		if v.Kind() != reflect.Map {
+			return typeError(sig, v)
+		}
+		kv, err := splitSignature(elemSig[1 : len(elemSig)-1])
+		if err != nil {
+			return err
+		}
+		if len(kv) != 2 {
+			return fmt.Errorf("dbus: invalid dict entry signature %q", elemSig)
+		}
+		for _, k := range sortedMapKeys(v) {
+			e.align(8)
+			if err := e.value(kv[0], k); err != nil {
+				return err
+			}
+			if err := e.value(kv[1], v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if elemSig == "y" && v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			e.buf = append(e.buf, v.Bytes()...)
+			break
+		}
+		for i := range v.Len() {
+			if err := e.value(elemSig, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return typeError(sig, v)
+	}
+
+	e.order.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start)) // #nosec G115 - bounded by message size
+	return nil
+}
+
+func (e *encoder) structure(sig string, v reflect.Value) error {
+	fields, err := splitSignature(sig[1 : len(sig)-1])
+	if err != nil {
+		return err
+	}
+	e.align(8)
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Len() != len(fields) {
+			return fmt.Errorf("dbus: struct %q needs %d fields, got %d", sig, len(fields), v.Len())
+		}
+		for i, f := range fields {
+			if err := e.value(f, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		i := 0
+		for j := range v.NumField() {
+			if !v.Type().Field(j).IsExported() {
+				continue
+			}
+			if i >= len(fields) {
+				return fmt.Errorf("dbus: struct %q has fewer fields than %s", sig, v.Type())
+			}
+			if err := e.value(fields[i], v.Field(j)); err != nil {
+				return err
+			}
+			i++
+		}
+		if i != len(fields) {
+			return fmt.Errorf("dbus: struct %q has more fields than %s", sig, v.Type())
+		}
+	default:
+		return typeError(sig, v)
+	}
+	return nil
+}
+
+func intOf(v reflect.Value, lo, hi int64) (int64, error) {
+	var n int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return 0, fmt.Errorf("dbus: value %d out of range", u)
+		}
+		n = int64(u)
+	default:
+		return 0, fmt.Errorf("dbus: expected integer, got %s", v.Type())
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("dbus: value %d out of range", n)
+	}
+	return n, nil
+}
+
+func uintOf(v reflect.Value, hi uint64) (uint64, error) {
+	var n uint64
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = v.Uint()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			return 0, fmt.Errorf("dbus: value %d out of range", i)
+		}
+		n = uint64(i)
+	default:
+		return 0, fmt.Errorf("dbus: expected integer, got %s", v.Type())
+	}
+	if n > hi {
+		return 0, fmt.Errorf("dbus: value %d out of range", n)
+	}
+	return n, nil
+}
+
+func typeError(sig string, v reflect.Value) error {
+	return fmt.Errorf("dbus: cannot encode %s as %q", v.Type(), sig)
+}
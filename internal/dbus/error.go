@@ -0,0 +1,25 @@
+package dbus
+
+import "fmt"
+
+// Error is a D-Bus error reply.
+type Error struct {
+	Name    string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.Message)
+}
+
+func errorFromMessage(m *Message) *Error {
+	e := &Error{Name: m.ErrorName}
+	if len(m.Body) > 0 {
+		e.Message, _ = m.Body[0].(string)
+	}
+	return e
+}
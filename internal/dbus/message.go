@@ -0,0 +1,214 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MessageType is the D-Bus message type.
+type MessageType byte
+
+// Message types.
+const (
+	TypeMethodCall   MessageType = 1
+	TypeMethodReturn MessageType = 2
+	TypeError        MessageType = 3
+	TypeSignal       MessageType = 4
+)
+
+// Message flags.
+const (
+	FlagNoReplyExpected byte = 0x1
+	FlagNoAutoStart     byte = 0x2
+)
+
+// Header field codes.
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSender      byte = 7
+	fieldSignature   byte = 8
+)
+
+// maxMessageSize is the maximum message size permitted by the specification.
+const maxMessageSize = 128 * 1024 * 1024
+
+// Message is a single D-Bus message.
+type Message struct {
+	Type        MessageType
+	Flags       byte
+	Serial      uint32
+	Path        ObjectPath
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   Signature
+	Body        []any
+}
+
+// Marshal serializes the message in little-endian byte order.
+func (m *Message) Marshal() ([]byte, error) {
+	order := binary.LittleEndian
+
+	body := newEncoder(order)
+	if m.Signature != "" {
+		if err := body.encode(string(m.Signature), m.Body...); err != nil {
+			return nil, err
+		}
+	} else if len(m.Body) > 0 {
+		return nil, fmt.Errorf("dbus: message body without signature")
+	}
+
+	type field struct {
+		Code  byte
+		Value Variant
+	}
+	var fields []field
+	add := func(code byte, sig Signature, v any) {
+		fields = append(fields, field{Code: code, Value: Variant{Sig: sig, Value: v}})
+	}
+	if m.Path != "" {
+		add(fieldPath, "o", m.Path)
+	}
+	if m.Interface != "" {
+		add(fieldInterface, "s", m.Interface)
+	}
+	if m.Member != "" {
+		add(fieldMember, "s", m.Member)
+	}
+	if m.ErrorName != "" {
+		add(fieldErrorName, "s", m.ErrorName)
+	}
+	if m.ReplySerial != 0 {
+		add(fieldReplySerial, "u", m.ReplySerial)
+	}
+	if m.Destination != "" {
+		add(fieldDestination, "s", m.Destination)
+	}
+	if m.Sender != "" {
+		add(fieldSender, "s", m.Sender)
+	}
+	if m.Signature != "" {
+		add(fieldSignature, "g", m.Signature)
+	}
+
+	hdr := newEncoder(order)
+	hdr.uint8('l')
+	hdr.uint8(byte(m.Type))
+	hdr.uint8(m.Flags)
+	hdr.uint8(1)                      // protocol version
+	hdr.uint32(uint32(len(body.buf))) // #nosec G115 - checked against maxMessageSize below
+	hdr.uint32(m.Serial)
+	if err := hdr.encode("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	hdr.align(8)
+
+	if len(hdr.buf)+len(body.buf) > maxMessageSize {
+		return nil, fmt.Errorf("dbus: message exceeds maximum size")
+	}
+	return append(hdr.buf, body.buf...), nil
+}
+
+// ReadMessage reads and decodes a single message.
+func ReadMessage(r io.Reader) (*Message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("dbus: invalid endianness marker %q", fixed[0])
+	}
+	if fixed[3] != 1 {
+		return nil, fmt.Errorf("dbus: unsupported protocol version %d", fixed[3])
+	}
+
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	hdrLen := 16 + int(fieldsLen)
+	padded := (hdrLen + 7) &^ 7
+	if uint64(padded)+uint64(bodyLen) > maxMessageSize {
+		return nil, fmt.Errorf("dbus: message exceeds maximum size")
+	}
+
+	buf := make([]byte, padded+int(bodyLen))
+	copy(buf, fixed)
+	if _, err := io.ReadFull(r, buf[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		Type:   MessageType(fixed[1]),
+		Flags:  fixed[2],
+		Serial: order.Uint32(fixed[8:]),
+	}
+
+	hdr := newDecoder(buf[:hdrLen], order)
+	hdr.pos = 12
+	values, err := hdr.decode("a(yv)")
+	if err != nil {
+		return nil, fmt.Errorf("dbus: invalid header fields: %w", err)
+	}
+	for _, f := range values[0].([]any) {
+		entry := f.([]any)
+		code := entry[0].(byte)
+		v := entry[1].(Variant).Value
+		if err := m.setField(code, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Signature != "" {
+		body := newDecoder(buf[padded:], order)
+		m.Body, err = body.decode(string(m.Signature))
+		if err != nil {
+			return nil, fmt.Errorf("dbus: invalid message body: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Message) setField(code byte, v any) error {
+	var ok bool
+	switch code {
+	case fieldPath:
+		m.Path, ok = v.(ObjectPath)
+	case fieldInterface:
+		m.Interface, ok = v.(string)
+	case fieldMember:
+		m.Member, ok = v.(string)
+	case fieldErrorName:
+		m.ErrorName, ok = v.(string)
+	case fieldReplySerial:
+		m.ReplySerial, ok = v.(uint32)
+	case fieldDestination:
+		m.Destination, ok = v.(string)
+	case fieldSender:
+		m.Sender, ok = v.(string)
+	case fieldSignature:
+		m.Signature, ok = v.(Signature)
+	default:
+		// Unknown fields (including UNIX_FDS) must be ignored
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("dbus: header field %d has wrong type %T", code, v)
+	}
+	return nil
+}
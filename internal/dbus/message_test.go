@@ -0,0 +1,182 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureOf(t *testing.T) {
+	tests := []struct {
+		value any
+		want  Signature
+	}{
+		{byte(1), "y"},
+		{true, "b"},
+		{int16(1), "n"},
+		{uint16(1), "q"},
+		{int32(1), "i"},
+		{1, "i"},
+		{uint32(1), "u"},
+		{int64(1), "x"},
+		{uint64(1), "t"},
+		{1.5, "d"},
+		{"s", "s"},
+		{ObjectPath("/"), "o"},
+		{Signature("s"), "g"},
+		{MakeVariant("x"), "v"},
+		{[]byte{1}, "ay"},
+		{[]string{"a"}, "as"},
+		{map[string]any{}, "a{sv}"},
+		{map[ObjectPath]map[string]map[string]any{}, "a{oa{sa{sv}}}"},
+		{struct {
+			A string
+			B uint32
+		}{}, "(su)"},
+	}
+
+	for _, tt := range tests {
+		got, err := SignatureOf(tt.value)
+		require.NoError(t, err, "%T", tt.value)
+		assert.Equal(t, tt.want, got, "%T", tt.value)
+	}
+
+	_, err := SignatureOf(map[[2]int]string{})
+	assert.Error(t, err)
+	_, err = SignatureOf(nil)
+	assert.Error(t, err)
+}
+
+func TestSplitSignature(t *testing.T) {
+	types, err := splitSignature("sa{sv}(ia(yv))ay")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s", "a{sv}", "(ia(yv))", "ay"}, types)
+
+	for _, bad := range []string{"(s", "a", "a{sv", "z"} {
+		_, err := splitSignature(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	values := []any{
+		byte(7),
+		true,
+		int16(-2),
+		uint16(65535),
+		int32(-100000),
+		uint32(4000000000),
+		int64(-1 << 40),
+		uint64(1 << 63),
+		3.25,
+		"hello",
+		ObjectPath("/org/example"),
+		Signature("a{sv}"),
+		MakeVariant(uint16(517)),
+		[]byte{1, 2, 3},
+		[]string{"read", "notify"},
+		[]ObjectPath{"/a", "/b"},
+		map[string]any{"Powered": MakeVariant(true), "Name": MakeVariant("hci0")},
+		map[ObjectPath]any{"/x": map[string]any{}},
+		[]any{"struct", uint32(9)},
+		[]any{},
+	}
+	sig := Signature("ybnqiuxtdsogvayasaoa{sv}a{oa{sv}}(su)a(yv)")
+
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		enc := newEncoder(order)
+		require.NoError(t, enc.encode(string(sig), values...))
+
+		dec := newDecoder(enc.buf, order)
+		got, err := dec.decode(string(sig))
+		require.NoError(t, err)
+		assert.Equal(t, values, got)
+		assert.Equal(t, len(enc.buf), dec.pos)
+	}
+}
+
+func TestEncode_Alignment(t *testing.T) {
+	// A byte followed by a uint32 pads to the 4-byte boundary
+	enc := newEncoder(binary.LittleEndian)
+	require.NoError(t, enc.encode("yu", byte(1), uint32(2)))
+	assert.Equal(t, []byte{1, 0, 0, 0, 2, 0, 0, 0}, enc.buf)
+
+	// Empty arrays still pad to the element alignment, which is not counted in the length
+	enc = newEncoder(binary.LittleEndian)
+	require.NoError(t, enc.encode("at", []uint64{}))
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0}, enc.buf)
+}
+
+func TestEncode_Errors(t *testing.T) {
+	tests := []struct {
+		sig   string
+		value any
+	}{
+		{"y", 256},
+		{"q", -1},
+		{"s", 1},
+		{"b", "true"},
+		{"as", "not a slice"},
+		{"a{sv}", []string{}},
+		{"(su)", []any{"only one"}},
+	}
+
+	for _, tt := range tests {
+		enc := newEncoder(binary.LittleEndian)
+		assert.Error(t, enc.encode(tt.sig, tt.value), "%s <- %#v", tt.sig, tt.value)
+	}
+}
+
+func TestDecode_Truncated(t *testing.T) {
+	enc := newEncoder(binary.LittleEndian)
+	require.NoError(t, enc.encode("sas", "hello", []string{"a", "b"}))
+
+	for n := range len(enc.buf) {
+		dec := newDecoder(enc.buf[:n], binary.LittleEndian)
+		_, err := dec.decode("sas")
+		assert.Error(t, err, "truncated to %d bytes", n)
+	}
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+	msg := &Message{
+		Type:        TypeMethodCall,
+		Flags:       FlagNoAutoStart,
+		Serial:      42,
+		Path:        "/org/bluez/hci0",
+		Interface:   "org.bluez.GattManager1",
+		Member:      "RegisterApplication",
+		Destination: "org.bluez",
+		Signature:   "oa{sv}",
+		Body:        []any{ObjectPath("/app"), map[string]any{}},
+	}
+
+	data, err := msg.Marshal()
+	require.NoError(t, err)
+
+	got, err := ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+}
+
+func TestReadMessage_Invalid(t *testing.T) {
+	msg := &Message{Type: TypeSignal, Serial: 1, Path: "/", Interface: "a.b", Member: "C"}
+	data, err := msg.Marshal()
+	require.NoError(t, err)
+
+	bad := append([]byte(nil), data...)
+	bad[0] = 'x'
+	_, err = ReadMessage(bytes.NewReader(bad))
+	assert.Error(t, err)
+
+	bad = append([]byte(nil), data...)
+	bad[3] = 2
+	_, err = ReadMessage(bytes.NewReader(bad))
+	assert.Error(t, err)
+
+	_, err = ReadMessage(bytes.NewReader(data[:len(data)-1]))
+	assert.Error(t, err)
+}
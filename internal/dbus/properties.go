@@ -0,0 +1,102 @@
+package dbus
+
+import (
+	"context"
+	"fmt"
+)
+
+// PropertiesInterface is the standard interface for object properties.
+const PropertiesInterface = "org.freedesktop.DBus.Properties"
+
+// GetProperty reads a single property of a remote object.
+func (c *Conn) GetProperty(ctx context.Context, dest string, path ObjectPath, iface, name string) (any, error) {
+	reply, err := c.Call(ctx, dest, path, PropertiesInterface, "Get", iface, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 1 {
+		return nil, fmt.Errorf("dbus: unexpected reply to Properties.Get")
+	}
+	v, ok := reply[0].(Variant)
+	if !ok {
+		return nil, fmt.Errorf("dbus: unexpected reply to Properties.Get")
+	}
+	return v.Value, nil
+}
+
+// SetProperty writes a single property of a remote object.
+func (c *Conn) SetProperty(ctx context.Context, dest string, path ObjectPath, iface, name string, value any) error {
+	_, err := c.Call(ctx, dest, path, PropertiesInterface, "Set", iface, name, MakeVariant(value))
+	return err
+}
+
+// GetAllProperties reads all properties of an interface of a remote object.
+func (c *Conn) GetAllProperties(ctx context.Context, dest string, path ObjectPath, iface string) (map[string]any, error) {
+	reply, err := c.Call(ctx, dest, path, PropertiesInterface, "GetAll", iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 1 {
+		return nil, fmt.Errorf("dbus: unexpected reply to Properties.GetAll")
+	}
+	raw, ok := reply[0].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("dbus: unexpected reply to Properties.GetAll")
+	}
+	props := make(map[string]any, len(raw))
+	for k, v := range raw {
+		if variant, ok := v.(Variant); ok {
+			props[k] = variant.Value
+		}
+	}
+	return props, nil
+}
+
+// ExportProperties exports read-only org.freedesktop.DBus.Properties methods
+// for an object. props is called on every request, so values may change.
+func (c *Conn) ExportProperties(path ObjectPath, props func() map[string]map[string]any) {
+	c.Export(path, PropertiesInterface, map[string]Method{
+		"Get": func(call *Message) ([]any, error) {
+			iface, name, err := stringArgs2(call)
+			if err != nil {
+				return nil, err
+			}
+			v, ok := props()[iface][name]
+			if !ok {
+				return nil, &Error{Name: "org.freedesktop.DBus.Error.UnknownProperty", Message: name}
+			}
+			return []any{MakeVariant(v)}, nil
+		},
+		"GetAll": func(call *Message) ([]any, error) {
+			if len(call.Body) != 1 {
+				return nil, &Error{Name: "org.freedesktop.DBus.Error.InvalidArgs", Message: "expected interface name"}
+			}
+			iface, _ := call.Body[0].(string)
+			all := props()[iface]
+			if all == nil {
+				all = map[string]any{}
+			}
+			return []any{all}, nil
+		},
+		"Set": func(*Message) ([]any, error) {
+			return nil, &Error{Name: "org.freedesktop.DBus.Error.PropertyReadOnly", Message: "properties are read-only"}
+		},
+	})
+}
+
+// EmitPropertiesChanged sends a PropertiesChanged signal for the given interface.
+func (c *Conn) EmitPropertiesChanged(path ObjectPath, iface string, changed map[string]any) error {
+	return c.Emit(path, PropertiesInterface, "PropertiesChanged", iface, changed, []string{})
+}
+
+func stringArgs2(call *Message) (string, string, error) {
+	if len(call.Body) != 2 {
+		return "", "", &Error{Name: "org.freedesktop.DBus.Error.InvalidArgs", Message: "expected two string arguments"}
+	}
+	a, ok1 := call.Body[0].(string)
+	b, ok2 := call.Body[1].(string)
+	if !ok1 || !ok2 {
+		return "", "", &Error{Name: "org.freedesktop.DBus.Error.InvalidArgs", Message: "expected two string arguments"}
+	}
+	return a, b, nil
+}
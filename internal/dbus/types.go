@@ -0,0 +1,214 @@
+package dbus
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ObjectPath is a D-Bus object path (type code 'o').
+type ObjectPath string
+
+// Signature is a D-Bus type signature (type code 'g').
+type Signature string
+
+// Variant is a value tagged with its D-Bus signature (type code 'v').
+type Variant struct {
+	Sig   Signature
+	Value any
+}
+
+// MakeVariant wraps v in a Variant, inferring its signature.
+// It panics if no signature can be inferred, which indicates a programming error.
+func MakeVariant(v any) Variant {
+	sig, err := SignatureOf(v)
+	if err != nil {
+		panic(err)
+	}
+	return Variant{Sig: sig, Value: v}
+}
+
+// String returns a human-readable form of the variant.
+func (v Variant) String() string {
+	return fmt.Sprintf("%v (%s)", v.Value, v.Sig)
+}
+
+var (
+	objectPathType = reflect.TypeFor[ObjectPath]()
+	signatureType  = reflect.TypeFor[Signature]()
+	variantType    = reflect.TypeFor[Variant]()
+)
+
+// SignatureOf infers the D-Bus signature of a Go value.
+//
+// Interface-typed elements (e.g. the values of a map[string]any) are encoded
+// as variants, so map[string]any becomes a{sv}.
+func SignatureOf(values ...any) (Signature, error) {
+	var b strings.Builder
+	for _, v := range values {
+		if v == nil {
+			return "", fmt.Errorf("dbus: cannot infer signature of nil")
+		}
+		sig, err := signatureOfType(reflect.TypeOf(v))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(sig)
+	}
+	return Signature(b.String()), nil
+}
+
+func signatureOfType(t reflect.Type) (string, error) {
+	switch t {
+	case objectPathType:
+		return "o", nil
+	case signatureType:
+		return "g", nil
+	case variantType:
+		return "v", nil
+	}
+
+	switch t.Kind() {
+	case reflect.Uint8:
+		return "y", nil
+	case reflect.Bool:
+		return "b", nil
+	case reflect.Int16:
+		return "n", nil
+	case reflect.Uint16:
+		return "q", nil
+	case reflect.Int32, reflect.Int:
+		return "i", nil
+	case reflect.Uint32, reflect.Uint:
+		return "u", nil
+	case reflect.Int64:
+		return "x", nil
+	case reflect.Uint64:
+		return "t", nil
+	case reflect.Float64:
+		return "d", nil
+	case reflect.String:
+		return "s", nil
+	case reflect.Interface:
+		return "v", nil
+	case reflect.Slice, reflect.Array:
+		elem, err := signatureOfType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "a" + elem, nil
+	case reflect.Map:
+		key, err := signatureOfType(t.Key())
+		if err != nil {
+			return "", err
+		}
+		if !isBasicType(key[0]) {
+			return "", fmt.Errorf("dbus: invalid dict key type %s", t.Key())
+		}
+		elem, err := signatureOfType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "a{" + key + elem + "}", nil
+	case reflect.Struct:
+		var b strings.Builder
+		b.WriteByte('(')
+		for i := range t.NumField() {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			sig, err := signatureOfType(t.Field(i).Type)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(sig)
+		}
+		b.WriteByte(')')
+		return b.String(), nil
+	case reflect.Pointer:
+		return signatureOfType(t.Elem())
+	default:
+		return "", fmt.Errorf("dbus: unsupported type %s", t)
+	}
+}
+
+func isBasicType(c byte) bool {
+	return strings.IndexByte("ybnqiuxtdsogh", c) >= 0
+}
+
+// nextType splits the first complete type off a signature.
+func nextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("dbus: empty signature")
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := nextType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		i := 1
+		for i < len(sig) && sig[i] != closing {
+			_, rest, err := nextType(sig[i:])
+			if err != nil {
+				return "", "", err
+			}
+			i = len(sig) - len(rest)
+		}
+		if i >= len(sig) {
+			return "", "", fmt.Errorf("dbus: unterminated %c in signature %q", sig[0], sig)
+		}
+		return sig[:i+1], sig[i+1:], nil
+	default:
+		if isBasicType(sig[0]) || sig[0] == 'v' {
+			return sig[:1], sig[1:], nil
+		}
+		return "", "", fmt.Errorf("dbus: invalid type code %q in signature", sig[0])
+	}
+}
+
+// splitSignature splits a signature into its complete types.
+func splitSignature(sig string) ([]string, error) {
+	var types []string
+	for sig != "" {
+		t, rest, err := nextType(sig)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+		sig = rest
+	}
+	return types, nil
+}
+
+// sortedMapKeys returns the keys of a map in a deterministic order.
+func sortedMapKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+// alignment returns the alignment boundary for a type code.
+func alignment(c byte) int {
+	switch c {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a', 'h':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,369 @@
+// Package diagnostics checks the network connectivity of the device: the
+// default route and its MTU, DNS resolution, TCP and TLS reachability of
+// endpoints, optionally through the configured proxy, and the clock offset
+// to NTP servers.
+//
+// It replaces the free-text output of the connectivity-test script with one
+// structured result per check, so clients can tell what is missing before
+// enrolling the device with a management service.
+package diagnostics
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const (
+	// DefaultTimeout bounds each network check.
+	DefaultTimeout = 5 * time.Second
+
+	// defaultMinMTU is the IPv6 minimum link MTU.
+	defaultMinMTU = 1280
+
+	maxEndpoints  = 16
+	maxNTPServers = 8
+
+	// Route flags of /proc/net/route and /proc/net/ipv6_route
+	rtfUp     = 0x1
+	rtfReject = 0x200
+)
+
+// Check names of protocol.ConnectivityCheck.
+const (
+	CheckDefaultRoute = "default_route"
+	CheckMTU          = "mtu"
+	CheckProxy        = "proxy"
+	CheckDNS          = "dns"
+	CheckTCP          = "tcp"
+	CheckTLS          = "tls"
+	CheckNTP          = "ntp"
+)
+
+// Runner runs connectivity checks.
+type Runner struct {
+	rootDir  string
+	timeout  time.Duration
+	resolver *net.Resolver
+	rootCAs  *x509.CertPool
+}
+
+// NewRunner creates a Runner. Routes, interfaces and the proxy and NTP
+// configuration are read below rootDir, or from the real file system if
+// rootDir is empty or "/".
+func NewRunner(rootDir string) *Runner {
+	if rootDir == "/" {
+		rootDir = ""
+	}
+	return &Runner{
+		rootDir:  rootDir,
+		timeout:  DefaultTimeout,
+		resolver: net.DefaultResolver,
+	}
+}
+
+// SetTimeout sets the timeout of each network check.
+func (r *Runner) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// SetResolver sets the resolver used for the DNS checks and to connect to
+// endpoints.
+func (r *Runner) SetResolver(resolver *net.Resolver) {
+	r.resolver = resolver
+}
+
+// SetRootCAs sets the CAs that endpoint certificates are verified against,
+// instead of the system's.
+func (r *Runner) SetRootCAs(pool *x509.CertPool) {
+	r.rootCAs = pool
+}
+
+// Run runs the checks of req. It returns an error only if req is invalid;
+// failed checks are reported in the response.
+func (r *Runner) Run(ctx context.Context, req *protocol.ConnectivityRequest) (*protocol.ConnectivityResponse, error) {
+	endpoints, err := validateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []protocol.ConnectivityCheck
+	routeCheck, iface := r.checkDefaultRoute()
+	checks = append(checks, routeCheck, r.checkMTU(iface, cmp.Or(req.MinMTU, defaultMinMTU)))
+
+	var proxies *proxyConfig
+	if req.UseProxy && len(endpoints) > 0 {
+		var proxyCheck protocol.ConnectivityCheck
+		proxies, proxyCheck = r.loadProxyConfig()
+		checks = append(checks, proxyCheck)
+	}
+
+	ntpServers := req.NTPServers
+	if len(ntpServers) == 0 {
+		ntpServers = r.configuredNTPServers()
+	}
+
+	// The endpoints and NTP servers are checked in parallel, so that a few
+	// unreachable ones do not add up their timeouts
+	results := make([][]protocol.ConnectivityCheck, len(endpoints)+len(ntpServers))
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Go(func() {
+			if req.UseProxy && proxies == nil {
+				results[i] = []protocol.ConnectivityCheck{skipped(CheckTCP, ep.raw, "no proxy configured")}
+				return
+			}
+			results[i] = r.checkEndpoint(ctx, ep, proxies)
+		})
+	}
+	for i, server := range ntpServers {
+		wg.Go(func() {
+			results[len(endpoints)+i] = []protocol.ConnectivityCheck{r.checkNTP(ctx, server)}
+		})
+	}
+	wg.Wait()
+	for _, result := range results {
+		checks = append(checks, result...)
+	}
+	if len(ntpServers) == 0 {
+		checks = append(checks, skipped(CheckNTP, "", "no NTP servers configured"))
+	}
+
+	resp := &protocol.ConnectivityResponse{Passed: true, Checks: checks}
+	for _, c := range checks {
+		if c.Status == protocol.CheckFail {
+			resp.Passed = false
+		}
+	}
+	return resp, nil
+}
+
+// checkDefaultRoute looks up the IPv4 and IPv6 default routes. It returns
+// the interface of the first one found, or "".
+func (r *Runner) checkDefaultRoute() (protocol.ConnectivityCheck, string) {
+	start := time.Now()
+	var routes []string
+	iface := ""
+	if dev, gw, ok := r.defaultRoute4(); ok {
+		routes = append(routes, describeRoute(dev, gw))
+		iface = dev
+	}
+	if dev, gw, ok := r.defaultRoute6(); ok {
+		routes = append(routes, describeRoute(dev, gw))
+		if iface == "" {
+			iface = dev
+		}
+	}
+	if len(routes) == 0 {
+		return result(CheckDefaultRoute, "", start, fmt.Errorf("no default route")), ""
+	}
+	return passed(CheckDefaultRoute, "", start, strings.Join(routes, ", ")), iface
+}
+
+func describeRoute(dev string, gw netip.Addr) string {
+	if gw.IsValid() && !gw.IsUnspecified() {
+		return fmt.Sprintf("via %s dev %s", gw, dev)
+	}
+	return "dev " + dev
+}
+
+// defaultRoute4 returns the interface and gateway of the IPv4 default route
+// with the lowest metric from /proc/net/route.
+func (r *Runner) defaultRoute4() (string, netip.Addr, bool) {
+	lines, err := r.readLines("/proc/net/route")
+	if err != nil {
+		return "", netip.Addr{}, false
+	}
+	best, bestMetric := -1, 0
+	var fields [][]string
+	for _, line := range lines {
+		f := strings.Fields(line)
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		if len(f) < 8 || f[1] != "00000000" || f[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(f[3], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		metric, _ := strconv.Atoi(f[6])
+		fields = append(fields, f)
+		if best < 0 || metric < bestMetric {
+			best, bestMetric = len(fields)-1, metric
+		}
+	}
+	if best < 0 {
+		return "", netip.Addr{}, false
+	}
+	// The kernel prints the address as an integer in host byte order
+	var gw [4]byte
+	if v, err := strconv.ParseUint(fields[best][2], 16, 32); err == nil {
+		binary.NativeEndian.PutUint32(gw[:], uint32(v))
+	}
+	return fields[best][0], netip.AddrFrom4(gw), true
+}
+
+// defaultRoute6 returns the interface and gateway of the IPv6 default route
+// with the lowest metric from /proc/net/ipv6_route.
+func (r *Runner) defaultRoute6() (string, netip.Addr, bool) {
+	lines, err := r.readLines("/proc/net/ipv6_route")
+	if err != nil {
+		return "", netip.Addr{}, false
+	}
+	best, bestMetric := -1, uint64(0)
+	var fields [][]string
+	for _, line := range lines {
+		f := strings.Fields(line)
+		// dest plen src splen nexthop metric refcnt use flags iface
+		if len(f) < 10 || f[1] != "00" || strings.Trim(f[0], "0") != "" || f[9] == "lo" {
+			continue
+		}
+		flags, err := strconv.ParseUint(f[8], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		metric, _ := strconv.ParseUint(f[5], 16, 32)
+		fields = append(fields, f)
+		if best < 0 || metric < bestMetric {
+			best, bestMetric = len(fields)-1, metric
+		}
+	}
+	if best < 0 {
+		return "", netip.Addr{}, false
+	}
+	var gw netip.Addr
+	if raw, err := hex.DecodeString(fields[best][4]); err == nil && len(raw) == 16 {
+		gw = netip.AddrFrom16([16]byte(raw))
+	}
+	return fields[best][9], gw, true
+}
+
+// checkMTU checks the MTU of the default route's interface.
+func (r *Runner) checkMTU(iface string, minMTU int) protocol.ConnectivityCheck {
+	start := time.Now()
+	if iface == "" {
+		return skipped(CheckMTU, "", "no default route")
+	}
+	data, err := os.ReadFile(r.path(filepath.Join("/sys/class/net", iface, "mtu")))
+	if err != nil {
+		return result(CheckMTU, iface, start, fmt.Errorf("failed to read MTU: %w", err))
+	}
+	mtu, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return result(CheckMTU, iface, start, fmt.Errorf("invalid MTU %q", strings.TrimSpace(string(data))))
+	}
+	if mtu < minMTU {
+		return result(CheckMTU, iface, start, fmt.Errorf("MTU %d is below %d", mtu, minMTU))
+	}
+	return passed(CheckMTU, iface, start, fmt.Sprintf("MTU %d", mtu))
+}
+
+// validateRequest checks req and parses its endpoints.
+func validateRequest(req *protocol.ConnectivityRequest) ([]endpoint, error) {
+	var fields []protocol.FieldError
+	add := func(field, format string, args ...any) {
+		fields = append(fields, protocol.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(req.Endpoints) > maxEndpoints {
+		add("endpoints", "at most %d endpoints can be checked", maxEndpoints)
+	}
+	endpoints := make([]endpoint, 0, len(req.Endpoints))
+	for i, s := range req.Endpoints {
+		ep, err := parseEndpoint(s)
+		if err != nil {
+			add(fmt.Sprintf("endpoints[%d]", i), "%v", err)
+			continue
+		}
+		endpoints = append(endpoints, ep)
+	}
+	if len(req.NTPServers) > maxNTPServers {
+		add("ntp_servers", "at most %d NTP servers can be checked", maxNTPServers)
+	}
+	for i, s := range req.NTPServers {
+		if _, err := ntpAddress(s); err != nil {
+			add(fmt.Sprintf("ntp_servers[%d]", i), "%v", err)
+		}
+	}
+	if req.MinMTU != 0 && (req.MinMTU < 68 || req.MinMTU > 65535) {
+		add("min_mtu", "must be between 68 and 65535")
+	}
+
+	if len(fields) > 0 {
+		return nil, protocol.NewValidationError(fields)
+	}
+	return endpoints, nil
+}
+
+// path returns the path of a file below the runner's root directory.
+func (r *Runner) path(name string) string {
+	return filepath.Join(r.rootDir, name)
+}
+
+// readLines returns the lines of a file below the root directory.
+func (r *Runner) readLines(name string) ([]string, error) {
+	f, err := os.Open(r.path(name))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// result returns a check that passed if err is nil, or else failed with
+// err as message.
+func result(check, target string, start time.Time, err error) protocol.ConnectivityCheck {
+	if err == nil {
+		return passed(check, target, start, "")
+	}
+	return protocol.ConnectivityCheck{
+		Check:      check,
+		Target:     target,
+		Status:     protocol.CheckFail,
+		Message:    err.Error(),
+		DurationMS: millis(time.Since(start)),
+	}
+}
+
+func passed(check, target string, start time.Time, message string) protocol.ConnectivityCheck {
+	return protocol.ConnectivityCheck{
+		Check:      check,
+		Target:     target,
+		Status:     protocol.CheckPass,
+		Message:    message,
+		DurationMS: millis(time.Since(start)),
+	}
+}
+
+func skipped(check, target, reason string) protocol.ConnectivityCheck {
+	return protocol.ConnectivityCheck{
+		Check:   check,
+		Target:  target,
+		Status:  protocol.CheckSkip,
+		Message: reason,
+	}
+}
+
+// millis returns d in milliseconds, with microsecond precision.
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,138 @@
+package diagnostics_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/diagnostics"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRoutes = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	00000000	FE01A8C0	0003	0	0	600	00000000	0	0	0
+eth0	00000000	010200C0	0003	0	0	100	00000000	0	0	0
+eth0	000200C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`
+	testRoutes6 = `fd000000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fd000000000000000000000000000001 00000400 00000001 00000000 00000003     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`
+)
+
+// newTestRunner returns a runner for a root directory holding files, by
+// path relative to the root.
+func newTestRunner(t *testing.T, files map[string]string) *diagnostics.Runner {
+	t.Helper()
+	rootDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(rootDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	runner := diagnostics.NewRunner(rootDir)
+	// Resolve names from /etc/hosts only
+	runner.SetResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(context.Context, string, string) (net.Conn, error) {
+			return nil, errors.New("no DNS server in tests")
+		},
+	})
+	return runner
+}
+
+// checksOf returns the checks of resp with check names, ignoring the
+// default route, MTU and NTP checks unless included.
+func checksOf(resp *protocol.ConnectivityResponse, names ...string) []protocol.ConnectivityCheck {
+	var checks []protocol.ConnectivityCheck
+	for _, c := range resp.Checks {
+		for _, name := range names {
+			if c.Check == name {
+				checks = append(checks, c)
+			}
+		}
+	}
+	return checks
+}
+
+func TestRunner_DefaultRoute(t *testing.T) {
+	runner := newTestRunner(t, map[string]string{
+		"proc/net/route":         testRoutes,
+		"proc/net/ipv6_route":    testRoutes6,
+		"sys/class/net/eth0/mtu": "1500\n",
+	})
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{})
+	require.NoError(t, err)
+
+	require.Len(t, resp.Checks, 3)
+	route := resp.Checks[0]
+	assert.Equal(t, diagnostics.CheckDefaultRoute, route.Check)
+	assert.Equal(t, protocol.CheckPass, route.Status)
+	assert.Equal(t, "via 192.0.2.1 dev eth0, via fd00::1 dev eth0", route.Message)
+
+	mtu := resp.Checks[1]
+	assert.Equal(t, diagnostics.CheckMTU, mtu.Check)
+	assert.Equal(t, protocol.CheckPass, mtu.Status)
+	assert.Equal(t, "eth0", mtu.Target)
+	assert.Equal(t, "MTU 1500", mtu.Message)
+
+	ntp := resp.Checks[2]
+	assert.Equal(t, diagnostics.CheckNTP, ntp.Check)
+	assert.Equal(t, protocol.CheckSkip, ntp.Status)
+	assert.True(t, resp.Passed, "skipped checks do not fail")
+}
+
+func TestRunner_NoDefaultRoute(t *testing.T) {
+	runner := newTestRunner(t, map[string]string{
+		"proc/net/route":      "Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT\n",
+		"proc/net/ipv6_route": "",
+	})
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{})
+	require.NoError(t, err)
+
+	assert.False(t, resp.Passed)
+	assert.Equal(t, protocol.CheckFail, resp.Checks[0].Status)
+	assert.Equal(t, "no default route", resp.Checks[0].Message)
+	assert.Equal(t, protocol.CheckSkip, resp.Checks[1].Status)
+}
+
+func TestRunner_MTUTooSmall(t *testing.T) {
+	runner := newTestRunner(t, map[string]string{
+		"proc/net/route":         testRoutes,
+		"sys/class/net/eth0/mtu": "1400\n",
+	})
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{MinMTU: 1500})
+	require.NoError(t, err)
+
+	assert.False(t, resp.Passed)
+	mtu := checksOf(resp, diagnostics.CheckMTU)[0]
+	assert.Equal(t, protocol.CheckFail, mtu.Status)
+	assert.Equal(t, "MTU 1400 is below 1500", mtu.Message)
+}
+
+func TestRunner_Invalid(t *testing.T) {
+	runner := newTestRunner(t, nil)
+
+	_, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{
+		Endpoints:  []string{"https://api.example.com", "ftp://files.example.com", "example.com"},
+		NTPServers: []string{"pool.ntp.org", "bad server"},
+		MinMTU:     20,
+	})
+	var errResp *protocol.ErrorResponse
+	require.True(t, errors.As(err, &errResp))
+	assert.Equal(t, protocol.ErrCodeValidationFailed, errResp.Code)
+	fields := make([]string, len(errResp.Fields))
+	for i, f := range errResp.Fields {
+		fields[i] = f.Field
+	}
+	assert.Equal(t, []string{"endpoints[1]", "endpoints[2]", "ntp_servers[1]", "min_mtu"}, fields)
+}
@@ -0,0 +1,329 @@
+package diagnostics
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/system"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// endpoint is a parsed endpoint of a connectivity request.
+type endpoint struct {
+	raw  string
+	host string
+	port string
+	tls  bool // checked with a TLS handshake
+	http bool // an http URL, reached through the HTTP proxy
+}
+
+// parseEndpoint parses a URL with an http, https, ws or wss scheme, or a
+// "host:port" pair.
+func parseEndpoint(s string) (endpoint, error) {
+	ep := endpoint{raw: s}
+	if !strings.Contains(s, "://") {
+		host, port, err := net.SplitHostPort(s)
+		if err != nil || host == "" || port == "" {
+			return ep, fmt.Errorf("%q is not a URL or host:port", s)
+		}
+		ep.host, ep.port = host, port
+	} else {
+		u, err := url.Parse(s)
+		if err != nil || u.Hostname() == "" {
+			return ep, fmt.Errorf("%q is not a valid URL", s)
+		}
+		defaultPort := ""
+		switch u.Scheme {
+		case "https", "wss":
+			ep.tls, defaultPort = true, "443"
+		case "http", "ws":
+			ep.http, defaultPort = true, "80"
+		default:
+			return ep, fmt.Errorf("scheme must be http, https, ws or wss")
+		}
+		ep.host, ep.port = u.Hostname(), u.Port()
+		if ep.port == "" {
+			ep.port = defaultPort
+		}
+	}
+	if p, err := net.LookupPort("tcp", ep.port); err != nil || p == 0 {
+		return ep, fmt.Errorf("invalid port %q", ep.port)
+	}
+	return ep, nil
+}
+
+func (ep endpoint) address() string {
+	return net.JoinHostPort(ep.host, ep.port)
+}
+
+// checkEndpoint resolves and connects to ep, directly or through the proxy
+// for it, and does a TLS handshake if ep is a TLS endpoint.
+func (r *Runner) checkEndpoint(ctx context.Context, ep endpoint, proxies *proxyConfig) []protocol.ConnectivityCheck {
+	var proxy *url.URL
+	if proxies != nil {
+		proxy = proxies.forEndpoint(ep)
+	}
+
+	// Through a proxy, only the proxy's name is resolved locally
+	dnsHost := ep.host
+	if proxy != nil {
+		dnsHost = proxy.Hostname()
+	}
+	var checks []protocol.ConnectivityCheck
+	if _, err := netip.ParseAddr(dnsHost); err != nil {
+		dns := r.checkDNS(ctx, dnsHost)
+		checks = append(checks, dns)
+		if dns.Status == protocol.CheckFail {
+			checks = append(checks, skipped(CheckTCP, ep.raw, "DNS resolution failed"))
+			if ep.tls {
+				checks = append(checks, skipped(CheckTLS, ep.raw, "DNS resolution failed"))
+			}
+			return checks
+		}
+	}
+
+	start := time.Now()
+	tcpCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var conn net.Conn
+	var err error
+	message := ""
+	if proxy != nil {
+		conn, err = r.dialProxy(tcpCtx, proxy, ep.address())
+		message = "connected through proxy " + proxy.Host
+	} else {
+		dialer := &net.Dialer{Resolver: r.resolver}
+		conn, err = dialer.DialContext(tcpCtx, "tcp", ep.address())
+		if err == nil {
+			message = "connected to " + conn.RemoteAddr().String()
+		}
+	}
+	if err != nil {
+		checks = append(checks, result(CheckTCP, ep.raw, start, err))
+		if ep.tls {
+			checks = append(checks, skipped(CheckTLS, ep.raw, "TCP connection failed"))
+		}
+		return checks
+	}
+	defer func() { _ = conn.Close() }()
+	checks = append(checks, passed(CheckTCP, ep.raw, start, message))
+
+	if ep.tls {
+		checks = append(checks, r.checkTLS(ctx, conn, ep))
+	}
+	return checks
+}
+
+// checkDNS resolves host.
+func (r *Runner) checkDNS(ctx context.Context, host string) protocol.ConnectivityCheck {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return result(CheckDNS, host, start, err)
+	}
+	return passed(CheckDNS, host, start, "resolved to "+strings.Join(addrs, ", "))
+}
+
+// checkTLS does a TLS handshake with ep over conn and verifies its
+// certificate.
+func (r *Runner) checkTLS(ctx context.Context, conn net.Conn, ep endpoint) protocol.ConnectivityCheck {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: ep.host,
+		RootCAs:    r.rootCAs,
+		MinVersion: tls.VersionTLS12,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return result(CheckTLS, ep.raw, start, err)
+	}
+	state := tlsConn.ConnectionState()
+	cert := state.PeerCertificates[0]
+	return passed(CheckTLS, ep.raw, start, fmt.Sprintf("%s, certificate of %s valid until %s",
+		tls.VersionName(state.Version), certificateName(cert), cert.NotAfter.UTC().Format(time.DateOnly)))
+}
+
+// certificateName returns the common name of cert, or else its first
+// subject alternative name.
+func certificateName(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.IPAddresses) > 0:
+		return cert.IPAddresses[0].String()
+	default:
+		return "unnamed subject"
+	}
+}
+
+// dialProxy connects to address through an HTTP(S) proxy with a CONNECT
+// request.
+func (r *Runner) dialProxy(ctx context.Context, proxy *url.URL, address string) (net.Conn, error) {
+	port := proxy.Port()
+	if port == "" {
+		port = "80"
+		if proxy.Scheme == "https" {
+			port = "443"
+		}
+	}
+	dialer := &net.Dialer{Resolver: r.resolver}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(proxy.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname(), RootCAs: r.rootCAs, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("TLS handshake with proxy failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT to proxy: %w", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response of proxy: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT: %s", resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// proxyConfig holds the proxy settings of the system.
+type proxyConfig struct {
+	httpProxy  *url.URL
+	httpsProxy *url.URL
+	noProxy    []string
+}
+
+// loadProxyConfig reads the proxy settings written by PUT /system/proxy,
+// falling back to the service's own environment.
+func (r *Runner) loadProxyConfig() (*proxyConfig, protocol.ConnectivityCheck) {
+	start := time.Now()
+	env := r.proxyEnvironment()
+	cfg := &proxyConfig{}
+	for _, p := range []struct {
+		name string
+		dst  **url.URL
+	}{{"http_proxy", &cfg.httpProxy}, {"https_proxy", &cfg.httpsProxy}} {
+		value := env[p.name]
+		if value == "" {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Hostname() == "" {
+			return nil, result(CheckProxy, "", start, fmt.Errorf("invalid %s %q", p.name, value))
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, result(CheckProxy, u.Redacted(), start, fmt.Errorf("%s proxies are not supported by the diagnostics", u.Scheme))
+		}
+		*p.dst = u
+	}
+	if cfg.httpProxy == nil && cfg.httpsProxy == nil {
+		return nil, result(CheckProxy, "", start, fmt.Errorf("no proxy configured"))
+	}
+	for _, entry := range strings.Split(env["no_proxy"], ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			cfg.noProxy = append(cfg.noProxy, entry)
+		}
+	}
+
+	target := cfg.httpsProxy
+	if target == nil {
+		target = cfg.httpProxy
+	}
+	return cfg, passed(CheckProxy, target.Redacted(), start, "")
+}
+
+// proxyEnvironment returns the proxy variables, lower-cased, from the
+// systemd drop-in of system.ProxyConfPath, or else from the environment.
+func (r *Runner) proxyEnvironment() map[string]string {
+	env := map[string]string{}
+	lines, err := r.readLines(system.ProxyConfPath)
+	if err == nil {
+		for _, line := range lines {
+			assignments, ok := strings.CutPrefix(strings.TrimSpace(line), "DefaultEnvironment=")
+			if !ok {
+				continue
+			}
+			// SetProxy quotes each assignment and rejects values with
+			// quotes or whitespace
+			for _, assignment := range strings.Fields(assignments) {
+				name, value, _ := strings.Cut(strings.Trim(assignment, `"`), "=")
+				env[strings.ToLower(name)] = value
+			}
+		}
+		return env
+	}
+	for _, name := range []string{"http_proxy", "https_proxy", "no_proxy"} {
+		value := os.Getenv(name)
+		if value == "" {
+			value = os.Getenv(strings.ToUpper(name))
+		}
+		env[name] = value
+	}
+	return env
+}
+
+// forEndpoint returns the proxy to reach ep through, or nil if ep is
+// excluded by no_proxy.
+func (c *proxyConfig) forEndpoint(ep endpoint) *url.URL {
+	host := strings.ToLower(ep.host)
+	for _, entry := range c.noProxy {
+		entry = strings.ToLower(entry)
+		if entry == "*" || host == entry || strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")) {
+			return nil
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if addr, err := netip.ParseAddr(host); err == nil && prefix.Contains(addr) {
+				return nil
+			}
+		}
+	}
+	if ep.http && c.httpProxy != nil {
+		return c.httpProxy
+	}
+	if c.httpsProxy != nil {
+		return c.httpsProxy
+	}
+	return c.httpProxy
+}
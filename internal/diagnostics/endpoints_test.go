@@ -0,0 +1,176 @@
+package diagnostics_test
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/diagnostics"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTLSServer starts a TLS server and returns its https URL and a pool
+// with its certificate.
+func newTLSServer(t *testing.T) (string, *x509.CertPool) {
+	t.Helper()
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return server.URL, pool
+}
+
+// newConnectProxy starts an HTTP proxy that tunnels CONNECT requests and
+// returns its URL and a function returning the tunneled addresses.
+func newConnectProxy(t *testing.T) (string, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var targets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		targets = append(targets, r.Host)
+		mu.Unlock()
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, buf)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), targets...)
+	}
+}
+
+func TestRunner_Endpoints(t *testing.T) {
+	tlsURL, pool := newTLSServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	runner := newTestRunner(t, nil)
+	runner.SetRootCAs(pool)
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{
+		Endpoints: []string{tlsURL, "localhost:" + port},
+	})
+	require.NoError(t, err)
+
+	checks := checksOf(resp, diagnostics.CheckDNS, diagnostics.CheckTCP, diagnostics.CheckTLS)
+	require.Len(t, checks, 4)
+
+	assert.Equal(t, diagnostics.CheckTCP, checks[0].Check)
+	assert.Equal(t, tlsURL, checks[0].Target)
+	assert.Equal(t, protocol.CheckPass, checks[0].Status)
+	assert.Equal(t, diagnostics.CheckTLS, checks[1].Check)
+	assert.Equal(t, protocol.CheckPass, checks[1].Status, checks[1].Message)
+	assert.Contains(t, checks[1].Message, "TLS 1.3")
+
+	assert.Equal(t, diagnostics.CheckDNS, checks[2].Check)
+	assert.Equal(t, "localhost", checks[2].Target)
+	assert.Equal(t, protocol.CheckPass, checks[2].Status)
+	assert.Equal(t, diagnostics.CheckTCP, checks[3].Check)
+	assert.Equal(t, protocol.CheckPass, checks[3].Status)
+}
+
+func TestRunner_Endpoints_Failures(t *testing.T) {
+	untrustedURL, _ := newTLSServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	runner := newTestRunner(t, nil)
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{
+		Endpoints: []string{
+			untrustedURL,
+			"https://" + closedAddr,
+			"https://api.example.invalid",
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, resp.Passed)
+
+	var got []string
+	for _, c := range checksOf(resp, diagnostics.CheckDNS, diagnostics.CheckTCP, diagnostics.CheckTLS) {
+		got = append(got, c.Check+" "+c.Status)
+	}
+	assert.Equal(t, []string{
+		"tcp pass", "tls fail", // untrusted certificate
+		"tcp fail", "tls skip", // connection refused
+		"dns fail", "tcp skip", "tls skip", // unknown name
+	}, got)
+}
+
+func TestRunner_Endpoints_Proxy(t *testing.T) {
+	tlsURL, pool := newTLSServer(t)
+	proxyURL, targets := newConnectProxy(t)
+
+	runner := newTestRunner(t, map[string]string{
+		"etc/systemd/system.conf.d/50-boardingpass-proxy.conf": "[Manager]\nDefaultEnvironment=" +
+			`"https_proxy=` + proxyURL + `" "HTTPS_PROXY=` + proxyURL + `" "no_proxy=.internal.example.com"` + "\n",
+	})
+	runner.SetRootCAs(pool)
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{
+		Endpoints: []string{tlsURL},
+		UseProxy:  true,
+	})
+	require.NoError(t, err)
+
+	checks := checksOf(resp, diagnostics.CheckProxy, diagnostics.CheckTCP, diagnostics.CheckTLS)
+	require.Len(t, checks, 3)
+	assert.Equal(t, proxyURL, checks[0].Target)
+	assert.Equal(t, "connected through proxy "+strings.TrimPrefix(proxyURL, "http://"), checks[1].Message)
+	assert.Equal(t, protocol.CheckPass, checks[2].Status)
+	assert.Equal(t, []string{strings.TrimPrefix(tlsURL, "https://")}, targets())
+}
+
+func TestRunner_Endpoints_NoProxy(t *testing.T) {
+	runner := newTestRunner(t, nil)
+	t.Setenv("https_proxy", "")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("http_proxy", "")
+	t.Setenv("HTTP_PROXY", "")
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{
+		Endpoints: []string{"https://api.example.com"},
+		UseProxy:  true,
+	})
+	require.NoError(t, err)
+	assert.False(t, resp.Passed)
+
+	checks := checksOf(resp, diagnostics.CheckProxy, diagnostics.CheckTCP)
+	require.Len(t, checks, 2)
+	assert.Equal(t, protocol.CheckFail, checks[0].Status)
+	assert.Equal(t, "no proxy configured", checks[0].Message)
+	assert.Equal(t, protocol.CheckSkip, checks[1].Status)
+}
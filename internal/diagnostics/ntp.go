@@ -0,0 +1,154 @@
+package diagnostics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/system"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const (
+	ntpPort       = "123"
+	ntpPacketSize = 48
+
+	// ntpEpochOffset is the number of seconds from the NTP epoch (1900) to
+	// the Unix epoch (1970).
+	ntpEpochOffset = 2208988800
+
+	// maxClockOffset is the largest clock offset to an NTP server that
+	// passes. Larger offsets break the validity checks of certificates and
+	// tokens of management services.
+	maxClockOffset = 5 * time.Second
+
+	// chronyConfPath is chrony's main configuration file, read for NTP
+	// servers if BoardingPass did not configure any.
+	chronyConfPath = "/etc/chrony.conf"
+)
+
+// checkNTP queries an NTP server with SNTP and checks the clock offset to
+// it.
+func (r *Runner) checkNTP(ctx context.Context, server string) protocol.ConnectivityCheck {
+	start := time.Now()
+	offset, stratum, err := r.queryNTP(ctx, server)
+	if err != nil {
+		return result(CheckNTP, server, start, err)
+	}
+	if offset.Abs() > maxClockOffset {
+		return result(CheckNTP, server, start, fmt.Errorf("clock offset %s exceeds %s", formatOffset(offset), maxClockOffset))
+	}
+	return passed(CheckNTP, server, start, fmt.Sprintf("offset %s, stratum %d", formatOffset(offset), stratum))
+}
+
+// queryNTP returns the offset of the local clock to server, and the
+// server's stratum.
+func (r *Runner) queryNTP(ctx context.Context, server string) (time.Duration, int, error) {
+	address, err := ntpAddress(server)
+	if err != nil {
+		return 0, 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	dialer := &net.Dialer{Resolver: r.resolver}
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// A client request (LI 0, version 4, mode 3). The transmit timestamp is
+	// random, as recommended by RFC 9109, and only used to match the reply.
+	req := make([]byte, ntpPacketSize)
+	req[0] = 0<<6 | 4<<3 | 3
+	_, _ = rand.Read(req[40:48])
+	t1 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, err
+	}
+
+	resp := make([]byte, ntpPacketSize)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return 0, 0, err
+		}
+		// Ignore stray packets that do not answer the request
+		if n >= ntpPacketSize && resp[0]&0x7 == 4 && string(resp[24:32]) == string(req[40:48]) {
+			break
+		}
+	}
+	t4 := time.Now()
+
+	stratum := int(resp[1])
+	if stratum == 0 {
+		return 0, 0, fmt.Errorf("server sent kiss code %q", strings.TrimRight(string(resp[12:16]), "\x00"))
+	}
+	if resp[0]>>6 == 3 {
+		return 0, 0, fmt.Errorf("server clock is not synchronized")
+	}
+	t2 := ntpTime(resp[32:40])
+	t3 := ntpTime(resp[40:48])
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	return offset, stratum, nil
+}
+
+// ntpTime converts an NTP timestamp into a time.
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(seconds, fraction*1e9>>32)
+}
+
+// ntpAddress returns the host:port address of an NTP server given as a
+// host, IP address or host:port.
+func ntpAddress(server string) (string, error) {
+	if host, port, err := net.SplitHostPort(server); err == nil {
+		if host == "" || port == "" {
+			return "", fmt.Errorf("%q is not a host or host:port", server)
+		}
+		return server, nil
+	}
+	if server == "" || strings.ContainsAny(server, " /\t") {
+		return "", fmt.Errorf("%q is not a host or host:port", server)
+	}
+	return net.JoinHostPort(server, ntpPort), nil
+}
+
+// configuredNTPServers returns the servers and pools of the chrony
+// configuration written by PUT /system/time, or else of chrony's main
+// configuration file.
+func (r *Runner) configuredNTPServers() []string {
+	for _, path := range []string{system.ChronySourcesPath, chronyConfPath} {
+		lines, err := r.readLines(path)
+		if err != nil {
+			continue
+		}
+		var servers []string
+		for _, line := range lines {
+			f := strings.Fields(line)
+			if len(f) >= 2 && (f[0] == "server" || f[0] == "pool") {
+				servers = append(servers, f[1])
+			}
+		}
+		if len(servers) > maxNTPServers {
+			servers = servers[:maxNTPServers]
+		}
+		if len(servers) > 0 {
+			return servers
+		}
+	}
+	return nil
+}
+
+// formatOffset formats an offset with sign in seconds, like "+0.012s".
+func formatOffset(d time.Duration) string {
+	return fmt.Sprintf("%+.3fs", d.Seconds())
+}
@@ -0,0 +1,104 @@
+package diagnostics_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/diagnostics"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNTPServer starts an SNTP server whose clock is offset from the local
+// one and returns its address.
+func newNTPServer(t *testing.T, offset time.Duration, stratum byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		req := make([]byte, 48)
+		for {
+			n, addr, err := conn.ReadFrom(req)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			resp := make([]byte, 48)
+			resp[0] = 4<<3 | 4 // version 4, server mode
+			resp[1] = stratum
+			copy(resp[24:32], req[40:48])
+			now := time.Now().Add(offset)
+			putNTPTime(resp[32:40], now)
+			putNTPTime(resp[40:48], now)
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+2208988800))
+	binary.BigEndian.PutUint32(b[4:8], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
+
+func TestRunner_NTP(t *testing.T) {
+	inSync := newNTPServer(t, 20*time.Millisecond, 2)
+	skewed := newNTPServer(t, -90*time.Second, 2)
+	kissOfDeath := newNTPServer(t, 0, 0)
+
+	runner := newTestRunner(t, nil)
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{
+		NTPServers: []string{inSync, skewed, kissOfDeath},
+	})
+	require.NoError(t, err)
+
+	checks := checksOf(resp, diagnostics.CheckNTP)
+	require.Len(t, checks, 3)
+	assert.Equal(t, protocol.CheckPass, checks[0].Status, checks[0].Message)
+	assert.Regexp(t, `^offset \+0\.0[12]\ds, stratum 2$`, checks[0].Message)
+	assert.Equal(t, protocol.CheckFail, checks[1].Status)
+	assert.Regexp(t, `^clock offset -90\.0\d\ds exceeds 5s$`, checks[1].Message)
+	assert.Equal(t, protocol.CheckFail, checks[2].Status)
+	assert.Contains(t, checks[2].Message, "kiss code")
+}
+
+func TestRunner_NTP_Configured(t *testing.T) {
+	server := newNTPServer(t, 0, 1)
+	runner := newTestRunner(t, map[string]string{
+		"etc/chrony.d/boardingpass.conf": "# Written by BoardingPass\nserver " + server + " iburst\n",
+	})
+
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{})
+	require.NoError(t, err)
+
+	checks := checksOf(resp, diagnostics.CheckNTP)
+	require.Len(t, checks, 1)
+	assert.Equal(t, server, checks[0].Target)
+	assert.Equal(t, protocol.CheckPass, checks[0].Status)
+}
+
+func TestRunner_NTP_Unreachable(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() }) // never answers
+
+	runner := newTestRunner(t, nil)
+	runner.SetTimeout(100 * time.Millisecond)
+	resp, err := runner.Run(context.Background(), &protocol.ConnectivityRequest{
+		NTPServers: []string{conn.LocalAddr().String()},
+	})
+	require.NoError(t, err)
+
+	checks := checksOf(resp, diagnostics.CheckNTP)
+	require.Len(t, checks, 1)
+	assert.Equal(t, protocol.CheckFail, checks[0].Status)
+	assert.Contains(t, checks[0].Message, "timeout")
+}
@@ -0,0 +1,188 @@
+package enrollment
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	enrollmentRequestsPath  = "/api/v1/enrollmentrequests"
+	flightControlAPIVersion = "flightctl.io/v1alpha1"
+	enrollmentRequestKind   = "EnrollmentRequest"
+
+	// Condition types of an enrollment request's status
+	conditionApproved = "Approved"
+	conditionDenied   = "Denied"
+	conditionFailed   = "Failed"
+
+	apiTimeout      = 30 * time.Second
+	maxResponseSize = 1 << 20
+)
+
+// enrollmentRequest is a Flight Control EnrollmentRequest resource.
+type enrollmentRequest struct {
+	APIVersion string                   `json:"apiVersion"`
+	Kind       string                   `json:"kind"`
+	Metadata   objectMeta               `json:"metadata"`
+	Spec       enrollmentRequestSpec    `json:"spec"`
+	Status     *enrollmentRequestStatus `json:"status,omitempty"`
+}
+
+type objectMeta struct {
+	Name string `json:"name"`
+}
+
+type enrollmentRequestSpec struct {
+	CSR          string            `json:"csr"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	DeviceStatus *deviceStatus     `json:"deviceStatus,omitempty"`
+}
+
+type deviceStatus struct {
+	SystemInfo systemInfo `json:"systemInfo"`
+}
+
+type systemInfo struct {
+	Architecture    string `json:"architecture"`
+	OperatingSystem string `json:"operatingSystem"`
+}
+
+type enrollmentRequestStatus struct {
+	Certificate string      `json:"certificate,omitempty"`
+	Conditions  []condition `json:"conditions,omitempty"`
+}
+
+type condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"` // "True", "False" or "Unknown"
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// condition returns the condition of type t if it is true.
+func (s *enrollmentRequestStatus) condition(t string) (condition, bool) {
+	if s == nil {
+		return condition{}, false
+	}
+	for _, c := range s.Conditions {
+		if c.Type == t && c.Status == "True" {
+			return c, true
+		}
+	}
+	return condition{}, false
+}
+
+// apiError is an error response of the Flight Control API.
+type apiError struct {
+	status  string
+	code    int
+	message string
+}
+
+func (e *apiError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("Flight Control API responded with %s: %s", e.status, e.message)
+	}
+	return "Flight Control API responded with " + e.status
+}
+
+// permanent reports whether retrying the request cannot succeed, e.g.
+// because the token was rejected.
+func (e *apiError) permanent() bool {
+	return e.code >= 400 && e.code < 500 && e.code != http.StatusTooManyRequests
+}
+
+// flightControlAPI is a client of the Flight Control API.
+type flightControlAPI struct {
+	server     string
+	token      string
+	httpClient *http.Client
+}
+
+// newFlightControlAPI creates a client of the API at server that
+// authenticates with token. The server's certificate is verified against
+// rootCAs, or the system roots if rootCAs is nil.
+func newFlightControlAPI(server, token string, rootCAs *x509.CertPool) *flightControlAPI {
+	return &flightControlAPI{
+		server: server,
+		token:  token,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					MinVersion: tls.VersionTLS12,
+					RootCAs:    rootCAs,
+				},
+			},
+			Timeout: apiTimeout,
+		},
+	}
+}
+
+// createEnrollmentRequest submits er.
+func (a *flightControlAPI) createEnrollmentRequest(ctx context.Context, er *enrollmentRequest) error {
+	return a.do(ctx, http.MethodPost, enrollmentRequestsPath, er, nil)
+}
+
+// getEnrollmentRequest returns the enrollment request name.
+func (a *flightControlAPI) getEnrollmentRequest(ctx context.Context, name string) (*enrollmentRequest, error) {
+	var er enrollmentRequest
+	if err := a.do(ctx, http.MethodGet, enrollmentRequestsPath+"/"+url.PathEscape(name), nil, &er); err != nil {
+		return nil, err
+	}
+	return &er, nil
+}
+
+func (a *flightControlAPI) do(ctx context.Context, method, path string, body, result any) error {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.server+path, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.token)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Flight Control API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response of Flight Control API: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Errors are Status resources with a message
+		var status struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &status)
+		return &apiError{status: resp.Status, code: resp.StatusCode, message: status.Message}
+	}
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("invalid response of Flight Control API: %w", err)
+		}
+	}
+	return nil
+}
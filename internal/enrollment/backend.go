@@ -0,0 +1,169 @@
+package enrollment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// Backend enrolls the device with a management service.
+//
+// Enrollment requests are JSON objects with the fields that Info describes.
+// Enroll returns once the request is accepted; enrollments that take longer,
+// e.g. because they await approval, continue in the background and Status
+// reports their progress.
+type Backend interface {
+	// Info describes the backend and the fields of its enrollment request.
+	Info() protocol.EnrollmentBackend
+
+	// Validate checks an enrollment request without enrolling, returning
+	// a validation error for invalid fields.
+	Validate(req json.RawMessage) error
+
+	// Enroll validates the request and starts the enrollment. It fails
+	// with ENROLLMENT_IN_PROGRESS while the last enrollment still runs.
+	Enroll(ctx context.Context, req json.RawMessage) (*protocol.EnrollmentStatus, error)
+
+	// Status returns the status of the last enrollment, or nil if there
+	// was none.
+	Status() *protocol.EnrollmentStatus
+}
+
+// Registry holds the available backends by name.
+type Registry struct {
+	mu       sync.RWMutex
+	backends map[string]Backend
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{backends: make(map[string]Backend)}
+}
+
+// Register adds a backend. Names must be unique.
+func (r *Registry) Register(b Backend) error {
+	name := b.Info().Name
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.backends[name]; exists {
+		return fmt.Errorf("enrollment backend %q is already registered", name)
+	}
+	r.backends[name] = b
+	return nil
+}
+
+// Get returns the backend with the given name.
+func (r *Registry) Get(name string) (Backend, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	b, ok := r.backends[name]
+	return b, ok
+}
+
+// List returns the backends sorted by name.
+func (r *Registry) List() []Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Backend, 0, len(r.backends))
+	for _, b := range r.backends {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Info().Name < list[j].Info().Name })
+	return list
+}
+
+// Status returns the status of the most recently submitted enrollment of
+// any backend, or nil if there was none.
+func (r *Registry) Status() *protocol.EnrollmentStatus {
+	var latest *protocol.EnrollmentStatus
+	for _, b := range r.List() {
+		if status := b.Status(); status != nil && (latest == nil || status.SubmittedAt.After(latest.SubmittedAt)) {
+			latest = status
+		}
+	}
+	return latest
+}
+
+// InProgress reports whether an enrollment of any backend has not finished
+// yet, e.g. because it awaits approval. Its state lives in memory only, so
+// the service must not exit until it finishes.
+func (r *Registry) InProgress() bool {
+	for _, b := range r.List() {
+		if status := b.Status(); status != nil {
+			switch status.State {
+			case protocol.EnrollmentStatePending, protocol.EnrollmentStateApproved, protocol.EnrollmentStateRunning:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tracker keeps the status of a backend's last enrollment and ensures that
+// one enrollment runs at a time.
+type tracker struct {
+	mu      sync.Mutex
+	running bool
+	status  *protocol.EnrollmentStatus
+}
+
+// Status returns the status of the last enrollment, or nil if there was
+// none.
+func (t *tracker) Status() *protocol.EnrollmentStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status == nil {
+		return nil
+	}
+	status := *t.status
+	return &status
+}
+
+// begin reserves the enrollment, unless another one is running.
+func (t *tracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running {
+		return false
+	}
+	t.running = true
+	return true
+}
+
+func (t *tracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = false
+}
+
+func (t *tracker) setStatus(status *protocol.EnrollmentStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = status
+}
+
+// update records a new state of the current enrollment.
+func (t *tracker) update(state, message string, files []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.State = state
+	t.status.Message = message
+	t.status.Files = files
+	t.status.UpdatedAt = time.Now().UTC()
+}
+
+// decodeRequest decodes an enrollment request, rejecting unknown fields.
+func decodeRequest(req json.RawMessage, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(req))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return protocol.NewInvalidRequestError(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package enrollment_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend is a Backend with a fixed status.
+type fakeBackend struct {
+	name   string
+	status *protocol.EnrollmentStatus
+}
+
+func (f *fakeBackend) Info() protocol.EnrollmentBackend {
+	return protocol.EnrollmentBackend{Name: f.name}
+}
+
+func (f *fakeBackend) Validate(json.RawMessage) error {
+	return nil
+}
+
+func (f *fakeBackend) Enroll(context.Context, json.RawMessage) (*protocol.EnrollmentStatus, error) {
+	return f.status, nil
+}
+
+func (f *fakeBackend) Status() *protocol.EnrollmentStatus {
+	return f.status
+}
+
+func TestRegistry(t *testing.T) {
+	registry := enrollment.NewRegistry()
+	fc := enrollment.NewFlightControl(config.FlightControlSettings{}, config.PathSettings{},
+		logging.New(logging.LevelError, logging.FormatJSON))
+	require.NoError(t, registry.Register(fc))
+	require.NoError(t, registry.Register(&fakeBackend{name: "awx"}))
+	assert.ErrorContains(t, registry.Register(&fakeBackend{name: "flightctl"}), "already registered")
+
+	var names []string
+	for _, b := range registry.List() {
+		names = append(names, b.Info().Name)
+	}
+	assert.Equal(t, []string{"awx", "flightctl"}, names)
+
+	b, ok := registry.Get("flightctl")
+	require.True(t, ok)
+	assert.Same(t, fc, b)
+	_, ok = registry.Get("acm")
+	assert.False(t, ok)
+	assert.Nil(t, registry.Status())
+}
+
+func TestRegistry_Status(t *testing.T) {
+	now := time.Now()
+	registry := enrollment.NewRegistry()
+	require.NoError(t, registry.Register(&fakeBackend{name: "acm", status: &protocol.EnrollmentStatus{
+		Backend: "acm", State: protocol.EnrollmentStateFailed, SubmittedAt: now.Add(-time.Minute),
+	}}))
+	require.NoError(t, registry.Register(&fakeBackend{name: "awx", status: &protocol.EnrollmentStatus{
+		Backend: "awx", State: protocol.EnrollmentStateRunning, SubmittedAt: now,
+	}}))
+	require.NoError(t, registry.Register(&fakeBackend{name: "none"}))
+
+	status := registry.Status()
+	require.NotNil(t, status)
+	assert.Equal(t, "awx", status.Backend)
+}
+
+func TestRegistry_InProgress(t *testing.T) {
+	registry := enrollment.NewRegistry()
+	require.NoError(t, registry.Register(&fakeBackend{name: "none"}))
+	assert.False(t, registry.InProgress())
+
+	done := &fakeBackend{name: "acm", status: &protocol.EnrollmentStatus{State: protocol.EnrollmentStateEnrolled}}
+	require.NoError(t, registry.Register(done))
+	assert.False(t, registry.InProgress())
+
+	for _, state := range []string{
+		protocol.EnrollmentStatePending, protocol.EnrollmentStateApproved, protocol.EnrollmentStateRunning,
+	} {
+		done.status = &protocol.EnrollmentStatus{State: state}
+		assert.True(t, registry.InProgress(), state)
+	}
+}
+
+func TestFlightControl_Info(t *testing.T) {
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	info := enrollment.NewFlightControl(config.FlightControlSettings{}, config.PathSettings{}, logger).Info()
+	assert.Equal(t, enrollment.FlightControlBackend, info.Name)
+	require.Len(t, info.Fields, 5)
+	assert.Equal(t, protocol.EnrollmentField{
+		Name: "server", Description: "URL of the Flight Control API", Type: protocol.FieldTypeURL, Required: true,
+	}, info.Fields[0])
+	assert.Equal(t, protocol.FieldTypeSecret, info.Fields[1].Type)
+
+	// A configured server is the default
+	info = enrollment.NewFlightControl(config.FlightControlSettings{Server: "https://api.example.com"},
+		config.PathSettings{}, logger).Info()
+	assert.False(t, info.Fields[0].Required)
+	assert.Equal(t, "https://api.example.com", info.Fields[0].Default)
+}
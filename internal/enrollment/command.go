@@ -0,0 +1,185 @@
+package enrollment
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// maxMessageBytes limits the part of a failed command's output kept in its
+// status.
+const maxMessageBytes = 1024
+
+// CommandBackend is a Backend that enrolls the device by running an
+// allow-listed command, e.g. a script that registers it with ACM or AWX.
+//
+// Enrollment requests are objects of string values, one per param of the
+// command, which receives them in the order the params are declared. The
+// command runs in the background; it enrolled the device if it exits 0.
+type CommandBackend struct {
+	settings config.EnrollmentBackendSettings
+	cmd      *config.CommandDefinition
+	executor command.CommandExecutor
+	logger   *logging.Logger
+
+	tracker
+}
+
+// NewCommandBackend creates a backend that runs cmd with executor.
+func NewCommandBackend(settings config.EnrollmentBackendSettings, cmd *config.CommandDefinition,
+	executor command.CommandExecutor, logger *logging.Logger) *CommandBackend {
+	return &CommandBackend{
+		settings: settings,
+		cmd:      cmd,
+		executor: executor,
+		logger:   logger,
+	}
+}
+
+// Info describes the backend, with the command's params as its fields.
+func (c *CommandBackend) Info() protocol.EnrollmentBackend {
+	info := protocol.EnrollmentBackend{
+		Name:        c.settings.Name,
+		DisplayName: cmp.Or(c.settings.DisplayName, c.settings.Name),
+		Description: cmp.Or(c.settings.Description, c.cmd.Description),
+		Fields:      make([]protocol.EnrollmentField, 0, len(c.cmd.Params)),
+	}
+	for _, p := range c.cmd.Params {
+		fieldType := cmp.Or(p.Type, config.ParamTypeString)
+		if p.Secret || slices.Contains(c.settings.SecretParams, p.Name) {
+			fieldType = protocol.FieldTypeSecret
+		}
+		info.Fields = append(info.Fields, protocol.EnrollmentField{
+			Name:        p.Name,
+			Description: p.Description,
+			Type:        fieldType,
+			Required:    !p.Optional,
+			Pattern:     p.Pattern,
+			Enum:        p.Enum,
+		})
+	}
+	return info
+}
+
+// Validate checks the fields of an enrollment request against the
+// command's param schemas.
+func (c *CommandBackend) Validate(req json.RawMessage) error {
+	_, err := c.params(req)
+	return err
+}
+
+// Enroll starts the command with the request's fields as its params.
+func (c *CommandBackend) Enroll(_ context.Context, req json.RawMessage) (*protocol.EnrollmentStatus, error) {
+	params, err := c.params(req)
+	if err != nil {
+		return nil, err
+	}
+	if !c.begin() {
+		return nil, protocol.NewEnrollmentInProgressError(fmt.Sprintf("%s enrollment is running", c.settings.Name))
+	}
+
+	now := time.Now().UTC()
+	c.setStatus(&protocol.EnrollmentStatus{
+		Backend:     c.settings.Name,
+		State:       protocol.EnrollmentStateRunning,
+		SubmittedAt: now,
+		UpdatedAt:   now,
+	})
+	c.logger.Info("Enrollment command started", map[string]any{
+		"backend":    c.settings.Name,
+		"command_id": c.cmd.ID,
+	})
+	// The command outlives the request; its timeout limits it
+	go c.run(params)
+	return c.Status(), nil
+}
+
+// run runs the command and records the outcome.
+func (c *CommandBackend) run(params []string) {
+	defer c.end()
+
+	resp, err := c.executor.Execute(context.Background(), c.cmd, c.cmd.NeedsSudo(), params)
+	switch {
+	case err != nil:
+		c.update(protocol.EnrollmentStateFailed, err.Error(), nil)
+		c.logger.Error("Enrollment command failed", map[string]any{
+			"backend":    c.settings.Name,
+			"command_id": c.cmd.ID,
+			"error":      err.Error(),
+		})
+	case resp.ExitCode != 0:
+		message := fmt.Sprintf("exit code %d", resp.ExitCode)
+		if output := tail(cmp.Or(strings.TrimSpace(resp.Stderr), strings.TrimSpace(resp.Stdout))); output != "" {
+			message += ": " + output
+		}
+		c.update(protocol.EnrollmentStateFailed, message, nil)
+		c.logger.Warn("Enrollment command failed", map[string]any{
+			"backend":    c.settings.Name,
+			"command_id": c.cmd.ID,
+			"exit_code":  resp.ExitCode,
+		})
+	default:
+		c.update(protocol.EnrollmentStateEnrolled, "", nil)
+		c.logger.Info("Enrollment command completed", map[string]any{
+			"backend":    c.settings.Name,
+			"command_id": c.cmd.ID,
+		})
+	}
+}
+
+// params validates the fields of req and returns them as the command's
+// params. Omitted optional params are passed as empty values, unless no
+// later param follows.
+func (c *CommandBackend) params(req json.RawMessage) ([]string, error) {
+	var values map[string]string
+	if err := decodeRequest(req, &values); err != nil {
+		return nil, err
+	}
+
+	var fields []protocol.FieldError
+	for name := range values {
+		if !slices.ContainsFunc(c.cmd.Params, func(p config.CommandParam) bool { return p.Name == name }) {
+			fields = append(fields, protocol.FieldError{Field: name, Message: "is not a field of this backend"})
+		}
+	}
+	params := make([]string, len(c.cmd.Params))
+	last := 0
+	for i := range c.cmd.Params {
+		p := &c.cmd.Params[i]
+		value, ok := values[p.Name]
+		if !ok || value == "" {
+			if !p.Optional {
+				fields = append(fields, protocol.FieldError{Field: p.Name, Message: "is required"})
+			}
+			continue
+		}
+		if err := command.ValidateParam(p, value); err != nil {
+			fields = append(fields, protocol.FieldError{Field: p.Name, Message: err.Error()})
+			continue
+		}
+		params[i] = value
+		last = i + 1
+	}
+	if len(fields) > 0 {
+		slices.SortFunc(fields, func(a, b protocol.FieldError) int { return strings.Compare(a.Field, b.Field) })
+		return nil, protocol.NewValidationError(fields)
+	}
+	return params[:last], nil
+}
+
+// tail returns the end of a command's output.
+func tail(output string) string {
+	if len(output) <= maxMessageBytes {
+		return output
+	}
+	return "..." + strings.ToValidUTF8(output[len(output)-maxMessageBytes:], "")
+}
@@ -0,0 +1,152 @@
+package enrollment_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newAWXBackend(executor command.CommandExecutor) *enrollment.CommandBackend {
+	return enrollment.NewCommandBackend(config.EnrollmentBackendSettings{
+		Name:         "awx",
+		DisplayName:  "AWX",
+		Command:      "enroll-awx",
+		SecretParams: []string{"token"},
+	}, &config.CommandDefinition{
+		ID:          "enroll-awx",
+		Description: "Register the device with AWX",
+		Path:        "/usr/lib/boardingpass/scripts/enroll-awx.sh",
+		Params: []config.CommandParam{
+			{Name: "url", Description: "AWX URL", Pattern: `https://\S+`},
+			{Name: "token"},
+			{Name: "inventory", Optional: true, Enum: []string{"edge", "lab"}},
+			{Name: "retries", Type: config.ParamTypeInteger, Optional: true},
+		},
+	}, executor, logging.New(logging.LevelError, logging.FormatJSON))
+}
+
+func TestCommandBackend_Info(t *testing.T) {
+	info := newAWXBackend(nil).Info()
+
+	assert.Equal(t, "awx", info.Name)
+	assert.Equal(t, "AWX", info.DisplayName)
+	assert.Equal(t, "Register the device with AWX", info.Description)
+	assert.Equal(t, []protocol.EnrollmentField{
+		{Name: "url", Description: "AWX URL", Type: protocol.FieldTypeString, Required: true, Pattern: `https://\S+`},
+		{Name: "token", Type: protocol.FieldTypeSecret, Required: true},
+		{Name: "inventory", Type: protocol.FieldTypeString, Enum: []string{"edge", "lab"}},
+		{Name: "retries", Type: config.ParamTypeInteger},
+	}, info.Fields)
+}
+
+func TestCommandBackend_Validate(t *testing.T) {
+	backend := newAWXBackend(nil)
+
+	tests := []struct {
+		name   string
+		req    string
+		code   protocol.ErrorCode
+		fields []string
+	}{
+		{name: "valid", req: `{"url":"https://awx.example.com","token":"secret","inventory":"edge"}`},
+		{name: "not an object of strings", req: `{"url":"https://awx.example.com","token":42}`, code: protocol.ErrCodeInvalidRequest},
+		{name: "missing fields", req: `{"inventory":"edge"}`, code: protocol.ErrCodeValidationFailed, fields: []string{"token", "url"}},
+		{
+			name:   "invalid and unknown fields",
+			req:    `{"url":"http://awx.example.com","token":"secret","inventory":"prod","user":"admin"}`,
+			code:   protocol.ErrCodeValidationFailed,
+			fields: []string{"inventory", "url", "user"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := backend.Validate(json.RawMessage(tt.req))
+			if tt.code == "" {
+				require.NoError(t, err)
+				return
+			}
+			var errResp *protocol.ErrorResponse
+			require.ErrorAs(t, err, &errResp)
+			assert.Equal(t, tt.code, errResp.Code)
+			var fields []string
+			for _, f := range errResp.Fields {
+				fields = append(fields, f.Field)
+			}
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestCommandBackend_Enroll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	executor := command.NewMockCommandExecutor(ctrl)
+	backend := newAWXBackend(executor)
+
+	release := make(chan struct{})
+	executor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), true, []string{"https://awx.example.com", "secret", "", "3"}).
+		DoAndReturn(func(context.Context, *config.CommandDefinition, bool, []string) (*protocol.CommandResponse, error) {
+			<-release
+			return &protocol.CommandResponse{ExitCode: 0, Stdout: "registered\n"}, nil
+		})
+
+	assert.Nil(t, backend.Status())
+	status, err := backend.Enroll(context.Background(), json.RawMessage(`{"url":"https://awx.example.com","token":"secret","retries":"3"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "awx", status.Backend)
+	assert.Equal(t, protocol.EnrollmentStateRunning, status.State)
+
+	// One enrollment runs at a time
+	_, err = backend.Enroll(context.Background(), json.RawMessage(`{"url":"https://awx.example.com","token":"secret"}`))
+	var errResp *protocol.ErrorResponse
+	require.ErrorAs(t, err, &errResp)
+	assert.Equal(t, protocol.ErrCodeEnrollmentInProgress, errResp.Code)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return backend.Status().State == protocol.EnrollmentStateEnrolled
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, backend.Status().Message)
+}
+
+func TestCommandBackend_Enroll_Failed(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    *protocol.CommandResponse
+		err     error
+		message string
+	}{
+		{
+			name:    "exit code",
+			resp:    &protocol.CommandResponse{ExitCode: 2, Stdout: "connecting\n", Stderr: "401 Unauthorized\n"},
+			message: "exit code 2: 401 Unauthorized",
+		},
+		{name: "execution error", err: errors.New("sudo not found"), message: "sudo not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			executor := command.NewMockCommandExecutor(ctrl)
+			executor.EXPECT().Execute(gomock.Any(), gomock.Any(), true, gomock.Any()).Return(tt.resp, tt.err)
+			backend := newAWXBackend(executor)
+
+			_, err := backend.Enroll(context.Background(), json.RawMessage(`{"url":"https://awx.example.com","token":"secret"}`))
+			require.NoError(t, err)
+			require.Eventually(t, func() bool {
+				return backend.Status().State == protocol.EnrollmentStateFailed
+			}, 5*time.Second, 10*time.Millisecond)
+			assert.Equal(t, tt.message, backend.Status().Message)
+		})
+	}
+}
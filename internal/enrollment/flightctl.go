@@ -0,0 +1,507 @@
+// Package enrollment enrolls the device with management services, so it is
+// managed once provisioning completes. Each service is a Backend: Flight
+// Control is built in, others run allow-listed commands.
+//
+// It replaces the enroll-flightctl script, which ran the flightctl CLI
+// without reporting whether the enrollment was ever approved: the device
+// submits an enrollment request itself, awaits its approval in the
+// background and configures the agent with the issued certificate.
+package enrollment
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/provisioning"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FlightControlBackend is the name of the Flight Control backend.
+	FlightControlBackend = "flightctl"
+
+	// agentConfigPath is the configuration file of the Flight Control agent,
+	// relative to /etc like the paths of configuration bundles. It must be
+	// in the path allow-list.
+	agentConfigPath = "flightctl/config.yaml"
+
+	// agentUnit is restarted to load the new configuration.
+	agentUnit = "flightctl-agent.service"
+
+	defaultPollInterval = 10 * time.Second
+
+	maxLabels = 32
+)
+
+var (
+	// Kubernetes-style label keys, with an optional DNS subdomain prefix,
+	// and values
+	labelKeyPattern   = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?/)?[A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// FlightControl is the Backend that enrolls the device with Flight Control.
+// It keeps the status of the last enrollment; one enrollment runs at a time.
+type FlightControl struct {
+	settings     config.FlightControlSettings
+	paths        config.PathSettings
+	logger       *logging.Logger
+	pollInterval time.Duration
+	restart      func(ctx context.Context, unit string) error
+
+	tracker
+}
+
+// NewFlightControl creates a Flight Control enrollment. The agent
+// configuration is written to the paths allowed by paths.
+func NewFlightControl(settings config.FlightControlSettings, paths config.PathSettings, logger *logging.Logger) *FlightControl {
+	return &FlightControl{
+		settings:     settings,
+		paths:        paths,
+		logger:       logger,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// SetPollInterval sets how often the enrollment request is checked for
+// approval.
+func (f *FlightControl) SetPollInterval(d time.Duration) {
+	f.pollInterval = d
+}
+
+// SetRestartFunc sets the function that restarts the agent once it is
+// configured. Without one, the agent loads its configuration when it next
+// starts.
+func (f *FlightControl) SetRestartFunc(fn func(ctx context.Context, unit string) error) {
+	f.restart = fn
+}
+
+// Info describes the backend and its enrollment request.
+func (f *FlightControl) Info() protocol.EnrollmentBackend {
+	return protocol.EnrollmentBackend{
+		Name:        FlightControlBackend,
+		DisplayName: "Flight Control",
+		Description: "Enroll the device with a Flight Control service, which approves it and manages its fleet configuration",
+		Fields: []protocol.EnrollmentField{
+			{
+				Name:        "server",
+				Description: "URL of the Flight Control API",
+				Type:        protocol.FieldTypeURL,
+				Required:    f.settings.Server == "",
+				Default:     f.settings.Server,
+			},
+			{
+				Name:        "token",
+				Description: "Token to authenticate the enrollment request with",
+				Type:        protocol.FieldTypeSecret,
+				Required:    true,
+			},
+			{
+				Name:        "ca_cert",
+				Description: "CA certificates of the API, if not signed by a system CA",
+				Type:        protocol.FieldTypePEM,
+			},
+			{
+				Name:        "agent_server",
+				Description: "URL of the agent API, if it differs from the server",
+				Type:        protocol.FieldTypeURL,
+			},
+			{
+				Name:        "labels",
+				Description: "Labels to request for the device",
+				Type:        protocol.FieldTypeLabels,
+			},
+		},
+	}
+}
+
+// Validate checks a FlightControlEnrollRequest.
+func (f *FlightControl) Validate(req json.RawMessage) error {
+	var r protocol.FlightControlEnrollRequest
+	if err := decodeRequest(req, &r); err != nil {
+		return err
+	}
+	_, _, err := f.validate(&r)
+	return err
+}
+
+// Enroll submits a FlightControlEnrollRequest; see Submit.
+func (f *FlightControl) Enroll(ctx context.Context, req json.RawMessage) (*protocol.EnrollmentStatus, error) {
+	var r protocol.FlightControlEnrollRequest
+	if err := decodeRequest(req, &r); err != nil {
+		return nil, err
+	}
+	return f.Submit(ctx, &r)
+}
+
+// Submit submits an enrollment request for the device and returns its
+// status. Awaiting approval and configuring the agent continue in the
+// background; Status reports their progress.
+func (f *FlightControl) Submit(ctx context.Context, req *protocol.FlightControlEnrollRequest) (*protocol.EnrollmentStatus, error) {
+	server, agentServer, err := f.validate(req)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, rootCAs, err := f.serverCA(req.CACert)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := f.settings.GetApprovalTimeout()
+	if err != nil {
+		return nil, protocol.NewConfigurationError(err.Error())
+	}
+
+	if !f.begin() {
+		return nil, protocol.NewEnrollmentInProgressError("an enrollment request awaits approval")
+	}
+	key, name, csrPEM, err := newCSR()
+	if err != nil {
+		f.end()
+		return nil, protocol.NewSystemError(err.Error())
+	}
+
+	now := time.Now().UTC()
+	f.setStatus(&protocol.EnrollmentStatus{
+		Backend:     FlightControlBackend,
+		State:       protocol.EnrollmentStatePending,
+		Server:      server,
+		RequestName: name,
+		SubmittedAt: now,
+		UpdatedAt:   now,
+	})
+
+	api := newFlightControlAPI(server, req.Token, rootCAs)
+	if err := api.createEnrollmentRequest(ctx, &enrollmentRequest{
+		APIVersion: flightControlAPIVersion,
+		Kind:       enrollmentRequestKind,
+		Metadata:   objectMeta{Name: name},
+		Spec: enrollmentRequestSpec{
+			CSR:    string(csrPEM),
+			Labels: req.Labels,
+			DeviceStatus: &deviceStatus{SystemInfo: systemInfo{
+				Architecture:    runtime.GOARCH,
+				OperatingSystem: runtime.GOOS,
+			}},
+		},
+	}); err != nil {
+		f.update(protocol.EnrollmentStateFailed, err.Error(), nil)
+		f.end()
+		return nil, protocol.NewEnrollmentFailedError(err.Error())
+	}
+
+	f.logger.Info("Flight Control enrollment request submitted", map[string]any{
+		"server":       server,
+		"request_name": name,
+	})
+	go f.complete(api, key, name, agentServer, caPEM, timeout)
+	return f.Status(), nil
+}
+
+// complete awaits the approval of the enrollment request and configures the
+// agent with the issued certificate.
+func (f *FlightControl) complete(api *flightControlAPI, key *ecdsa.PrivateKey, name, agentServer string,
+	caPEM []byte, timeout time.Duration) {
+	defer f.end()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	certPEM, err := f.awaitApproval(ctx, api, name, key)
+	if err != nil {
+		state := protocol.EnrollmentStateFailed
+		var denied *deniedError
+		if errors.As(err, &denied) {
+			state = protocol.EnrollmentStateDenied
+		} else if ctx.Err() != nil {
+			err = fmt.Errorf("enrollment request was not approved within %s", timeout)
+		}
+		f.update(state, err.Error(), nil)
+		f.logger.Warn("Flight Control enrollment did not complete", map[string]any{
+			"request_name": name,
+			"state":        state,
+			"error":        err.Error(),
+		})
+		return
+	}
+	f.update(protocol.EnrollmentStateApproved, "", nil)
+
+	if err := f.configureAgent(ctx, key, certPEM, agentServer, caPEM); err != nil {
+		f.update(protocol.EnrollmentStateFailed, err.Error(), nil)
+		f.logger.Error("Failed to configure Flight Control agent", map[string]any{
+			"request_name": name,
+			"error":        err.Error(),
+		})
+		return
+	}
+
+	files := []string{filepath.Join("/etc", agentConfigPath)}
+	message := ""
+	if f.restart != nil {
+		if err := f.restart(ctx, agentUnit); err != nil {
+			// The agent loads the configuration when it next starts
+			message = err.Error()
+			f.logger.Warn("Failed to restart Flight Control agent", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+	f.update(protocol.EnrollmentStateEnrolled, message, files)
+	f.logger.Info("Flight Control enrollment completed", map[string]any{
+		"request_name": name,
+		"files":        files,
+	})
+}
+
+// deniedError reports that the enrollment request was denied.
+type deniedError struct {
+	reason string
+}
+
+func (e *deniedError) Error() string {
+	return "enrollment request was denied: " + e.reason
+}
+
+// awaitApproval polls the enrollment request until it is approved, and
+// returns the issued certificate.
+func (f *FlightControl) awaitApproval(ctx context.Context, api *flightControlAPI, name string,
+	key *ecdsa.PrivateKey) ([]byte, error) {
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+	for {
+		er, err := api.getEnrollmentRequest(ctx, name)
+		var apiErr *apiError
+		switch {
+		case errors.As(err, &apiErr) && apiErr.permanent():
+			return nil, err
+		case err != nil:
+			// The network or the API may be back at the next poll
+			f.logger.Debug("Failed to check Flight Control enrollment request", map[string]any{
+				"request_name": name,
+				"error":        err.Error(),
+			})
+		default:
+			if c, ok := er.Status.condition(conditionDenied); ok {
+				return nil, &deniedError{reason: cmp.Or(c.Message, c.Reason, "no reason given")}
+			}
+			if c, ok := er.Status.condition(conditionFailed); ok {
+				return nil, fmt.Errorf("enrollment request failed: %s", cmp.Or(c.Message, c.Reason, "no reason given"))
+			}
+			if _, ok := er.Status.condition(conditionApproved); ok && er.Status.Certificate != "" {
+				certPEM := []byte(er.Status.Certificate)
+				if err := verifyCertificate(certPEM, key); err != nil {
+					return nil, err
+				}
+				return certPEM, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// agentConfig is the part of the Flight Control agent's configuration that
+// connects it to the management service.
+type agentConfig struct {
+	ManagementService agentServiceConfig `yaml:"management-service"`
+}
+
+type agentServiceConfig struct {
+	Service struct {
+		Server                   string `yaml:"server"`
+		CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	} `yaml:"service"`
+	Authentication struct {
+		ClientCertificateData string `yaml:"client-certificate-data"`
+		ClientKeyData         string `yaml:"client-key-data"`
+	} `yaml:"authentication"`
+}
+
+// configureAgent writes the agent configuration with the device's key and
+// certificate, like the provisioning of a configuration bundle.
+func (f *FlightControl) configureAgent(ctx context.Context, key *ecdsa.PrivateKey, certPEM []byte,
+	agentServer string, caPEM []byte) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	var cfg agentConfig
+	cfg.ManagementService.Service.Server = agentServer
+	if len(caPEM) > 0 {
+		cfg.ManagementService.Service.CertificateAuthorityData = base64.StdEncoding.EncodeToString(caPEM)
+	}
+	cfg.ManagementService.Authentication.ClientCertificateData = base64.StdEncoding.EncodeToString(certPEM)
+	cfg.ManagementService.Authentication.ClientKeyData = base64.StdEncoding.EncodeToString(keyPEM)
+	data, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode agent configuration: %w", err)
+	}
+
+	validator := provisioning.NewPathValidator(f.paths.AllowList)
+	applier, err := provisioning.NewApplier(validator, f.paths.RootDirectory)
+	if err != nil {
+		return fmt.Errorf("failed to create applier: %w", err)
+	}
+	defer func() { _ = applier.Cleanup() }()
+	return applier.Apply(ctx, &protocol.ConfigBundle{Files: []protocol.ConfigFile{{
+		Path:    agentConfigPath,
+		Content: base64.StdEncoding.EncodeToString(data),
+		Mode:    0o600,
+	}}})
+}
+
+// validate checks req and returns the URLs of the API and the agent API.
+func (f *FlightControl) validate(req *protocol.FlightControlEnrollRequest) (string, string, error) {
+	var fields []protocol.FieldError
+	add := func(field, format string, args ...any) {
+		fields = append(fields, protocol.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	server := cmp.Or(req.Server, f.settings.Server)
+	if server == "" {
+		add("server", "is required, as no Flight Control server is configured")
+	} else if err := validateServerURL(server); err != nil {
+		add("server", "%v", err)
+	}
+	if req.Token == "" {
+		add("token", "is required")
+	} else if strings.ContainsFunc(req.Token, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		add("token", "must not contain whitespace or control characters")
+	}
+	if req.AgentServer != "" {
+		if err := validateServerURL(req.AgentServer); err != nil {
+			add("agent_server", "%v", err)
+		}
+	}
+	if req.CACert != "" {
+		if _, err := certPool([]byte(req.CACert)); err != nil {
+			add("ca_cert", "%v", err)
+		}
+	}
+	if len(req.Labels) > maxLabels {
+		add("labels", "at most %d labels are allowed", maxLabels)
+	}
+	for k, v := range req.Labels {
+		if !labelKeyPattern.MatchString(k) {
+			add("labels", "%q is not a valid label key", k)
+		}
+		if !labelValuePattern.MatchString(v) {
+			add("labels."+k, "%q is not a valid label value", v)
+		}
+	}
+
+	if len(fields) > 0 {
+		return "", "", protocol.NewValidationError(fields)
+	}
+	server = strings.TrimSuffix(server, "/")
+	return server, cmp.Or(strings.TrimSuffix(req.AgentServer, "/"), server), nil
+}
+
+func validateServerURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", s)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("must use https")
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("must not contain credentials, a query or a fragment")
+	}
+	return nil
+}
+
+// serverCA returns the CA certificates to verify the API with, from the
+// request or else the configured file, or nil to use the system roots.
+func (f *FlightControl) serverCA(requestPEM string) ([]byte, *x509.CertPool, error) {
+	caPEM := []byte(requestPEM)
+	if len(caPEM) == 0 && f.settings.CACert != "" {
+		data, err := os.ReadFile(f.settings.CACert)
+		if err != nil {
+			return nil, nil, protocol.NewConfigurationError(fmt.Sprintf("failed to read Flight Control CA: %v", err))
+		}
+		caPEM = data
+	}
+	if len(caPEM) == 0 {
+		return nil, nil, nil
+	}
+	pool, err := certPool(caPEM)
+	if err != nil {
+		return nil, nil, protocol.NewConfigurationError(fmt.Sprintf("%s: %v", f.settings.CACert, err))
+	}
+	return caPEM, pool, nil
+}
+
+func certPool(caPEM []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no PEM certificates found")
+	}
+	return pool, nil
+}
+
+// newCSR generates the device's key and a certificate signing request for
+// it. The request is named, like Flight Control's agent names devices,
+// after the hash of the public key.
+func newCSR() (*ecdsa.PrivateKey, string, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(publicDER)
+	name := hex.EncodeToString(sum[:])
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name},
+	}, key)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to create certificate signing request: %w", err)
+	}
+	return key, name, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}), nil
+}
+
+// verifyCertificate checks that the issued certificate is for key.
+func verifyCertificate(certPEM []byte, key *ecdsa.PrivateKey) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("issued certificate is not PEM-encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid issued certificate: %w", err)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return fmt.Errorf("issued certificate is not for the device's key")
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package enrollment_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testToken = "test-token"
+
+// stubFlightControl imitates the enrollment request API of Flight Control.
+// Requests are approved, denied or left pending by decide.
+type stubFlightControl struct {
+	*httptest.Server
+	t      *testing.T
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+	decide func(name string) string // "approve", "deny" or ""
+
+	mu       sync.Mutex
+	requests map[string]map[string]any
+}
+
+func newStubFlightControl(t *testing.T, decide func(string) string) *stubFlightControl {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "flightctl-device-enrollment"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	s := &stubFlightControl{t: t, caKey: caKey, caCert: caCert, decide: decide, requests: map[string]map[string]any{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/enrollmentrequests", s.create)
+	mux.HandleFunc("GET /api/v1/enrollmentrequests/{name}", s.get)
+	s.Server = httptest.NewTLSServer(s.authenticate(mux))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubFlightControl) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"kind":"Status","code":401,"message":"invalid token"}`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *stubFlightControl) create(w http.ResponseWriter, r *http.Request) {
+	var er map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&er); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := er["metadata"].(map[string]any)["name"].(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[name] = er
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(er)
+}
+
+func (s *stubFlightControl) get(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	er, ok := s.requests[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"kind":"Status","code":404,"message":"not found"}`))
+		return
+	}
+
+	switch s.decide(name) {
+	case "approve":
+		er["status"] = map[string]any{
+			"certificate": s.sign(er["spec"].(map[string]any)["csr"].(string)),
+			"conditions":  []any{map[string]any{"type": "Approved", "status": "True", "reason": "ManuallyApproved"}},
+		}
+	case "deny":
+		er["status"] = map[string]any{
+			"conditions": []any{map[string]any{"type": "Denied", "status": "True", "message": "unknown device"}},
+		}
+	}
+	_ = json.NewEncoder(w).Encode(er)
+}
+
+// sign issues a certificate for a CSR.
+func (s *stubFlightControl) sign(csrPEM string) string {
+	block, _ := pem.Decode([]byte(csrPEM))
+	require.NotNil(s.t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(s.t, err)
+	require.NoError(s.t, csr.CheckSignature())
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, s.caCert, csr.PublicKey, s.caKey)
+	require.NoError(s.t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func (s *stubFlightControl) request(name string) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[name]
+}
+
+// serverCA returns the PEM certificate of the stub's TLS server.
+func (s *stubFlightControl) serverCA() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}))
+}
+
+func newTestFlightControl(t *testing.T, settings config.FlightControlSettings) (*enrollment.FlightControl, string) {
+	t.Helper()
+	root := t.TempDir()
+	fc := enrollment.NewFlightControl(settings, config.PathSettings{
+		AllowList:     []string{"/etc/flightctl/"},
+		RootDirectory: root,
+	}, logging.New(logging.LevelError, logging.FormatJSON))
+	fc.SetPollInterval(10 * time.Millisecond)
+	return fc, root
+}
+
+// waitForState polls the status until it leaves the pending and approved
+// states.
+func waitForState(t *testing.T, fc *enrollment.FlightControl) *protocol.EnrollmentStatus {
+	t.Helper()
+	var status *protocol.EnrollmentStatus
+	require.Eventually(t, func() bool {
+		status = fc.Status()
+		return status.State != protocol.EnrollmentStatePending && status.State != protocol.EnrollmentStateApproved
+	}, 5*time.Second, 10*time.Millisecond)
+	return status
+}
+
+func TestFlightControl_Submit(t *testing.T) {
+	approved := false
+	var mu sync.Mutex
+	stub := newStubFlightControl(t, func(string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if approved {
+			return "approve"
+		}
+		return ""
+	})
+	fc, root := newTestFlightControl(t, config.FlightControlSettings{})
+	var restarted []string
+	fc.SetRestartFunc(func(_ context.Context, unit string) error {
+		restarted = append(restarted, unit)
+		return nil
+	})
+
+	status, err := fc.Submit(context.Background(), &protocol.FlightControlEnrollRequest{
+		Server:      stub.URL,
+		Token:       testToken,
+		CACert:      stub.serverCA(),
+		AgentServer: "https://agent-api.flightctl.example.com:7443",
+		Labels:      map[string]string{"site": "store-42"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, enrollment.FlightControlBackend, status.Backend)
+	assert.Equal(t, protocol.EnrollmentStatePending, status.State)
+	assert.Equal(t, stub.URL, status.Server)
+	assert.Len(t, status.RequestName, 64)
+
+	er := stub.request(status.RequestName)
+	require.NotNil(t, er)
+	spec := er["spec"].(map[string]any)
+	assert.Equal(t, map[string]any{"site": "store-42"}, spec["labels"])
+	assert.Contains(t, spec["csr"], "BEGIN CERTIFICATE REQUEST")
+
+	// Another enrollment must wait for the pending one
+	_, err = fc.Submit(context.Background(), &protocol.FlightControlEnrollRequest{Server: stub.URL, Token: testToken})
+	var errResp *protocol.ErrorResponse
+	require.ErrorAs(t, err, &errResp)
+	assert.Equal(t, protocol.ErrCodeEnrollmentInProgress, errResp.Code)
+
+	mu.Lock()
+	approved = true
+	mu.Unlock()
+	status = waitForState(t, fc)
+	require.Equal(t, protocol.EnrollmentStateEnrolled, status.State, status.Message)
+	assert.Equal(t, []string{"/etc/flightctl/config.yaml"}, status.Files)
+	assert.Equal(t, []string{"flightctl-agent.service"}, restarted)
+
+	path := filepath.Join(root, "etc/flightctl/config.yaml")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var agentCfg struct {
+		ManagementService struct {
+			Service struct {
+				Server                   string `yaml:"server"`
+				CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			} `yaml:"service"`
+			Authentication struct {
+				ClientCertificateData string `yaml:"client-certificate-data"`
+				ClientKeyData         string `yaml:"client-key-data"`
+			} `yaml:"authentication"`
+		} `yaml:"management-service"`
+	}
+	require.NoError(t, yaml.Unmarshal(data, &agentCfg))
+	svc := agentCfg.ManagementService
+	assert.Equal(t, "https://agent-api.flightctl.example.com:7443", svc.Service.Server)
+	assertBase64(t, stub.serverCA(), svc.Service.CertificateAuthorityData)
+
+	// The key matches the certificate issued for the request
+	certPEM, err := base64.StdEncoding.DecodeString(svc.Authentication.ClientCertificateData)
+	require.NoError(t, err)
+	keyPEM, err := base64.StdEncoding.DecodeString(svc.Authentication.ClientKeyData)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, status.RequestName, cert.Subject.CommonName)
+	block, _ = pem.Decode(keyPEM)
+	require.NotNil(t, block)
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(cert.PublicKey))
+}
+
+func assertBase64(t *testing.T, expected, encoded string) {
+	t.Helper()
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(decoded))
+}
+
+func TestFlightControl_Submit_Denied(t *testing.T) {
+	stub := newStubFlightControl(t, func(string) string { return "deny" })
+	fc, root := newTestFlightControl(t, config.FlightControlSettings{})
+
+	_, err := fc.Submit(context.Background(), &protocol.FlightControlEnrollRequest{
+		Server: stub.URL,
+		Token:  testToken,
+		CACert: stub.serverCA(),
+	})
+	require.NoError(t, err)
+
+	status := waitForState(t, fc)
+	assert.Equal(t, protocol.EnrollmentStateDenied, status.State)
+	assert.Contains(t, status.Message, "unknown device")
+	assert.NoFileExists(t, filepath.Join(root, "etc/flightctl/config.yaml"))
+}
+
+func TestFlightControl_Submit_PathNotAllowed(t *testing.T) {
+	stub := newStubFlightControl(t, func(string) string { return "approve" })
+	fc := enrollment.NewFlightControl(config.FlightControlSettings{}, config.PathSettings{
+		AllowList:     []string{"/etc/systemd/"},
+		RootDirectory: t.TempDir(),
+	}, logging.New(logging.LevelError, logging.FormatJSON))
+	fc.SetPollInterval(10 * time.Millisecond)
+
+	_, err := fc.Submit(context.Background(), &protocol.FlightControlEnrollRequest{
+		Server: stub.URL,
+		Token:  testToken,
+		CACert: stub.serverCA(),
+	})
+	require.NoError(t, err)
+
+	status := waitForState(t, fc)
+	assert.Equal(t, protocol.EnrollmentStateFailed, status.State)
+	assert.Contains(t, status.Message, "not in allow-list")
+}
+
+func TestFlightControl_Submit_Rejected(t *testing.T) {
+	stub := newStubFlightControl(t, func(string) string { return "" })
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte(stub.serverCA()), 0o644))
+	// The server and CA are configured
+	fc, _ := newTestFlightControl(t, config.FlightControlSettings{Server: stub.URL, CACert: caFile})
+
+	_, err := fc.Submit(context.Background(), &protocol.FlightControlEnrollRequest{Token: "wrong-token"})
+	var errResp *protocol.ErrorResponse
+	require.ErrorAs(t, err, &errResp)
+	assert.Equal(t, protocol.ErrCodeEnrollmentFailed, errResp.Code)
+	assert.Contains(t, errResp.Details, "invalid token")
+
+	status := fc.Status()
+	require.NotNil(t, status)
+	assert.Equal(t, protocol.EnrollmentStateFailed, status.State)
+
+	// A failed enrollment can be retried
+	status, err = fc.Submit(context.Background(), &protocol.FlightControlEnrollRequest{Token: testToken})
+	require.NoError(t, err)
+	assert.Equal(t, protocol.EnrollmentStatePending, status.State)
+}
+
+func TestFlightControl_Submit_Invalid(t *testing.T) {
+	fc, _ := newTestFlightControl(t, config.FlightControlSettings{})
+
+	tests := []struct {
+		name   string
+		req    protocol.FlightControlEnrollRequest
+		fields []string
+	}{
+		{"no server", protocol.FlightControlEnrollRequest{Token: testToken}, []string{"server"}},
+		{"plain HTTP", protocol.FlightControlEnrollRequest{Server: "http://api.example.com", Token: testToken}, []string{"server"}},
+		{"no token", protocol.FlightControlEnrollRequest{Server: "https://api.example.com"}, []string{"token"}},
+		{"token with newline", protocol.FlightControlEnrollRequest{Server: "https://api.example.com", Token: "a\nb"}, []string{"token"}},
+		{"bad CA", protocol.FlightControlEnrollRequest{Server: "https://api.example.com", Token: testToken, CACert: "junk"}, []string{"ca_cert"}},
+		{
+			"bad labels",
+			protocol.FlightControlEnrollRequest{Server: "https://api.example.com", Token: testToken,
+				Labels: map[string]string{"-bad": "ok", "site": strings.Repeat("x", 64)}},
+			[]string{"labels", "labels.site"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fc.Submit(context.Background(), &tt.req)
+			var errResp *protocol.ErrorResponse
+			require.ErrorAs(t, err, &errResp)
+			assert.Equal(t, protocol.ErrCodeValidationFailed, errResp.Code)
+			var fields []string
+			for _, f := range errResp.Fields {
+				fields = append(fields, f.Field)
+			}
+			assert.ElementsMatch(t, tt.fields, fields)
+		})
+	}
+	assert.Nil(t, fc.Status())
+}
@@ -0,0 +1,67 @@
+package inventory
+
+import (
+	"time"
+
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+// GetSystemInfo collects system information from all inventory components.
+// Components that cannot be inspected are reported as unknown.
+func GetSystemInfo() protocol.SystemInfo {
+	hostname, err := GetHostname()
+	if err != nil {
+		// Non-fatal: continue with empty hostname
+		hostname = "unknown"
+	}
+
+	tpmInfo, err := GetTPMInfo()
+	if err != nil {
+		// Non-fatal: continue with empty TPM info
+		tpmInfo = protocol.TPMInfo{Present: false}
+	}
+
+	firmwareInfo := GetFirmwareInfo()
+
+	productInfo, err := GetProductInfo()
+	if err != nil {
+		// Non-fatal: continue with unknown product info
+		productInfo = protocol.ProductInfo{
+			Vendor:  "Unknown",
+			Family:  "Unknown",
+			Name:    "Unknown",
+			Version: "Unknown",
+			Serial:  "Unknown",
+		}
+	}
+
+	cpuInfo := GetCPUInfo()
+
+	osInfo, err := GetOSInfo()
+	if err != nil {
+		// Non-fatal: continue with unknown OS info
+		osInfo = protocol.OSInfo{
+			Distribution: "Unknown",
+			Version:      "Unknown",
+			FIPSEnabled:  false,
+		}
+	}
+
+	clockTime, clockSync, err := GetClockStatus()
+	if err != nil {
+		// Non-fatal: use current time and unsynchronized
+		clockTime = time.Now().UTC()
+		clockSync = false
+	}
+	osInfo.SystemTime = clockTime.UTC().Format(time.RFC3339)
+	osInfo.ClockSynchronized = clockSync
+
+	return protocol.SystemInfo{
+		Hostname: hostname,
+		TPM:      tpmInfo,
+		Firmware: firmwareInfo,
+		Product:  productInfo,
+		CPU:      cpuInfo,
+		OS:       osInfo,
+	}
+}
@@ -0,0 +1,22 @@
+package inventory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/inventory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSystemInfo(t *testing.T) {
+	info := inventory.GetSystemInfo()
+
+	// Every component falls back to placeholder values
+	assert.NotEmpty(t, info.Hostname)
+	assert.NotEmpty(t, info.Product.Serial)
+	assert.NotEmpty(t, info.CPU.Architecture)
+	assert.NotEmpty(t, info.OS.Distribution)
+
+	_, err := time.Parse(time.RFC3339, info.OS.SystemTime)
+	assert.NoError(t, err, "system time should be RFC 3339")
+}
@@ -23,6 +23,7 @@ type InactivityTracker struct {
 	lastActivity time.Time
 	mu           sync.RWMutex
 	shutdownFunc func()
+	busyFunc     func() bool
 	timer        *time.Timer
 	stopped      bool
 }
@@ -84,6 +85,12 @@ func (t *InactivityTracker) Start(ctx context.Context) {
 				return
 			}
 
+			if timeSinceActivity >= t.timeout && t.busy() {
+				// Work is still in progress; check again after another timeout
+				t.RecordActivity()
+				continue
+			}
+
 			if timeSinceActivity >= t.timeout {
 				// Inactivity timeout reached, trigger shutdown
 				if t.shutdownFunc != nil {
@@ -103,6 +110,22 @@ func (t *InactivityTracker) Start(ctx context.Context) {
 	}
 }
 
+// SetBusyFunc sets a function that reports whether work without client
+// activity is in progress, e.g. an enrollment awaiting approval. The
+// timeout does not trigger while it returns true.
+func (t *InactivityTracker) SetBusyFunc(busy func() bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.busyFunc = busy
+}
+
+func (t *InactivityTracker) busy() bool {
+	t.mu.RLock()
+	busy := t.busyFunc
+	t.mu.RUnlock()
+	return busy != nil && busy()
+}
+
 // RecordActivity records that activity has occurred, resetting the inactivity timer.
 func (t *InactivityTracker) RecordActivity() {
 	t.mu.Lock()
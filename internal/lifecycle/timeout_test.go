@@ -145,6 +145,33 @@ func TestInactivityTracker_Start(t *testing.T) {
 		tracker.Stop()
 	})
 
+	t.Run("busy work defers timeout", func(t *testing.T) {
+		var shutdownCalled, busy atomic.Bool
+		busy.Store(true)
+
+		tracker := newInactivityTrackerInternal(200*time.Millisecond, func() {
+			shutdownCalled.Store(true)
+		})
+		tracker.SetBusyFunc(busy.Load)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		go tracker.Start(ctx)
+
+		time.Sleep(500 * time.Millisecond)
+		if shutdownCalled.Load() {
+			t.Error("shutdown should not be called while busy")
+		}
+
+		// Once idle, the timeout runs again from the last check
+		busy.Store(false)
+		time.Sleep(500 * time.Millisecond)
+		if !shutdownCalled.Load() {
+			t.Error("expected shutdown to be called after work finished")
+		}
+	})
+
 	t.Run("stops when context is cancelled", func(t *testing.T) {
 		var shutdownCalled atomic.Bool
 
@@ -2,8 +2,11 @@ package mdns
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -12,8 +15,31 @@ import (
 )
 
 const (
-	mdnsAddr          = "224.0.0.251:5353"
+	mdnsPort          = 5353
 	defaultTTL uint32 = 120 // seconds
+	legacyTTL  uint32 = 10  // seconds, for one-shot queriers (RFC 6762 Section 6.7)
+)
+
+// mDNS multicast groups (RFC 6762 Section 3).
+var (
+	mdnsGroup4 = net.IPv4(224, 0, 0, 251)
+	mdnsGroup6 = net.ParseIP("ff02::fb")
+)
+
+// TXT record keys published for the BoardingPass service.
+const (
+	TXTVersion     = "version"    // service version
+	TXTSerial      = "serial"     // device serial number
+	TXTModel       = "model"      // device vendor and product name
+	TXTFingerprint = "fp"         // TLS certificate fingerprint ("SHA256:<base64>")
+	TXTTransports  = "transports" // comma-separated enabled transports
+	TXTState       = "state"      // provisioning state
+)
+
+// Provisioning states published in the TXT record.
+const (
+	StateUnprovisioned = "unprovisioned" // waiting for configuration
+	StateConfigured    = "configured"    // configuration applied, not yet completed
 )
 
 // ServiceRecord holds the mDNS service information to announce.
@@ -23,7 +49,7 @@ type ServiceRecord struct {
 	Domain   string            // "local"
 	Port     int               // 9455
 	TXT      map[string]string // optional metadata
-	Addrs    []net.IP          // IPv4 addresses to announce
+	Addrs    []net.IP          // IPv4 and IPv6 addresses to announce
 }
 
 // fqServiceName returns the fully qualified service name, e.g. "_boardingpass._tcp.local."
@@ -42,69 +68,79 @@ func (r *ServiceRecord) fqHostName() string {
 	return r.Instance + "." + r.Domain + "."
 }
 
-// Announcer manages mDNS service announcements and query responses.
+// Announcer manages mDNS service announcements and query responses over
+// IPv4 and IPv6. Each link only hears about the addresses that are reachable
+// on it. Before announcing, the announcer probes for its instance name and
+// renames itself on conflicts (RFC 6762 Sections 8 and 9).
 type Announcer struct {
-	record ServiceRecord
-	conn   *net.UDPConn
-	logger *logging.Logger
-	mu     sync.RWMutex
-	cancel context.CancelFunc
-	done   chan struct{}
+	record      ServiceRecord
+	base        string // configured instance name, before renaming
+	suffix      string // preferred rename suffix, e.g. from the serial number
+	renames     int    // number of renames so far
+	established bool   // probing succeeded; announcing and answering queries
+	events      chan probeEvent
+	conn4       *net.UDPConn
+	conn6       *net.UDPConn
+	links       func() []link // multicast-capable interfaces, replaced in tests
+	logger      *logging.Logger
+	mu          sync.RWMutex
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
 }
 
 // NewAnnouncer creates a new mDNS announcer for the given service record.
 func NewAnnouncer(record ServiceRecord, logger *logging.Logger) *Announcer {
 	return &Announcer{
 		record: record,
+		base:   record.Instance,
+		events: make(chan probeEvent, 1),
+		links:  multicastLinks,
 		logger: logger,
-		done:   make(chan struct{}),
 	}
 }
 
-// Start begins mDNS announcements and query listening.
-// The announcer joins the multicast group, sends initial announcements,
-// and listens for queries in a background goroutine.
+// Start begins mDNS probing, announcements and query listening.
+// The announcer joins the IPv4 and IPv6 multicast groups and, in background
+// goroutines, probes for its name, announces the service and answers
+// queries. It fails only if neither address family is available.
 func (a *Announcer) Start(ctx context.Context) error {
-	addr, err := net.ResolveUDPAddr("udp4", mdnsAddr)
-	if err != nil {
-		return fmt.Errorf("resolving mDNS address: %w", err)
+	conn4, err4 := a.listenGroup("udp4", mdnsGroup4)
+	conn6, err6 := a.listenGroup("udp6", mdnsGroup6)
+	if conn4 == nil && conn6 == nil {
+		return fmt.Errorf("joining mDNS multicast group: %w", errors.Join(err4, err6))
 	}
-
-	conn, err := net.ListenMulticastUDP("udp4", nil, addr)
-	if err != nil {
-		return fmt.Errorf("joining mDNS multicast group: %w", err)
+	if err4 != nil {
+		a.logger.Warn("mDNS over IPv4 unavailable", map[string]any{"error": err4.Error()})
+	}
+	if err6 != nil {
+		a.logger.Warn("mDNS over IPv6 unavailable", map[string]any{"error": err6.Error()})
 	}
 
 	a.mu.Lock()
-	a.conn = conn
+	a.conn4 = conn4
+	a.conn6 = conn6
 	a.mu.Unlock()
 
-	// Set read buffer size
-	if err := conn.SetReadBuffer(65536); err != nil {
-		a.logger.Warn("failed to set mDNS read buffer", map[string]any{
-			"error": err.Error(),
-		})
-	}
-
 	ctx, a.cancel = context.WithCancel(ctx)
+	a.joinGroups()
 
-	// Send initial announcements (RFC 6762 Section 8.3)
-	a.announce()
-
-	// Start query listener
-	go a.listen(ctx)
+	// Start query listeners
+	for _, conn := range []*net.UDPConn{conn4, conn6} {
+		if conn == nil {
+			continue
+		}
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.listen(ctx, conn)
+		}()
+	}
 
-	// Send follow-up announcements at t=1s and t=3s
+	// Probe, announce, and handle conflicts
+	a.wg.Add(1)
 	go func() {
-		delays := []time.Duration{1 * time.Second, 2 * time.Second}
-		for _, d := range delays {
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(d):
-				a.announce()
-			}
-		}
+		defer a.wg.Done()
+		a.run(ctx)
 	}()
 
 	a.logger.Info("mDNS announcer started", map[string]any{
@@ -117,46 +153,79 @@ func (a *Announcer) Start(ctx context.Context) error {
 	return nil
 }
 
+// listenGroup opens a socket on the mDNS port for one address family and
+// enables reporting of the interface each packet arrives on.
+func (a *Announcer) listenGroup(network string, group net.IP) (*net.UDPConn, error) {
+	conn, err := net.ListenMulticastUDP(network, nil, &net.UDPAddr{IP: group, Port: mdnsPort})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set read buffer size
+	if err := conn.SetReadBuffer(65536); err != nil {
+		a.logger.Warn("failed to set mDNS read buffer", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	if err := enablePacketInfo(conn, group.To4() == nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("enabling packet info: %w", err)
+	}
+	return conn, nil
+}
+
 // Stop sends goodbye packets and shuts down the announcer.
 func (a *Announcer) Stop() {
 	if a.cancel != nil {
 		a.cancel()
 	}
 
-	// Send goodbye (TTL=0)
-	a.sendRecords(0)
+	// Send goodbye (TTL=0) for a name that was announced
+	if a.isEstablished() {
+		a.sendRecords(0)
+	}
 
 	a.mu.Lock()
-	conn := a.conn
-	a.conn = nil
+	conns := []*net.UDPConn{a.conn4, a.conn6}
+	a.conn4 = nil
+	a.conn6 = nil
 	a.mu.Unlock()
 
-	if conn != nil {
-		_ = conn.Close()
+	for _, conn := range conns {
+		if conn != nil {
+			_ = conn.Close()
+		}
 	}
 
-	// Wait for listener to exit
-	<-a.done
+	// Wait for listeners and the prober to exit
+	a.wg.Wait()
 
 	a.logger.Info("mDNS announcer stopped")
 }
 
+// Refresh joins the multicast groups on links that appeared since the last
+// announcement and re-announces the service.
+func (a *Announcer) Refresh() {
+	a.announce()
+}
+
 // AddAddress adds an IP address and re-announces the service.
 func (a *Announcer) AddAddress(ip net.IP) {
-	v4 := ip.To4()
-	if v4 == nil {
+	ip = normalizeIP(ip)
+	if ip == nil {
 		return
 	}
 
 	a.mu.Lock()
 	// Check for duplicate
 	for _, existing := range a.record.Addrs {
-		if existing.Equal(v4) {
+		if existing.Equal(ip) {
 			a.mu.Unlock()
 			return
 		}
 	}
-	a.record.Addrs = append(a.record.Addrs, v4)
+	a.record.Addrs = append(a.record.Addrs, ip)
 	a.mu.Unlock()
 
 	a.logger.Info("mDNS address added", map[string]any{
@@ -167,14 +236,14 @@ func (a *Announcer) AddAddress(ip net.IP) {
 
 // RemoveAddress removes an IP address and re-announces the service.
 func (a *Announcer) RemoveAddress(ip net.IP) {
-	v4 := ip.To4()
-	if v4 == nil {
+	ip = normalizeIP(ip)
+	if ip == nil {
 		return
 	}
 
 	a.mu.Lock()
 	for i, existing := range a.record.Addrs {
-		if existing.Equal(v4) {
+		if existing.Equal(ip) {
 			a.record.Addrs = append(a.record.Addrs[:i], a.record.Addrs[i+1:]...)
 			break
 		}
@@ -187,41 +256,185 @@ func (a *Announcer) RemoveAddress(ip net.IP) {
 	a.announce()
 }
 
+// SetAddresses replaces the announced IP addresses and re-announces the
+// service if they changed.
+func (a *Announcer) SetAddresses(ips []net.IP) {
+	var addrs []net.IP
+	for _, ip := range ips {
+		if ip = normalizeIP(ip); ip != nil {
+			addrs = append(addrs, ip)
+		}
+	}
+
+	a.mu.Lock()
+	if sameIPs(a.record.Addrs, addrs) {
+		a.mu.Unlock()
+		return
+	}
+	a.record.Addrs = addrs
+	a.mu.Unlock()
+
+	a.logger.Info("mDNS addresses updated", map[string]any{
+		"addrs": ipStrings(addrs),
+	})
+	a.announce()
+}
+
+// SetTXT sets a TXT record value and re-announces the service if it changed.
+func (a *Announcer) SetTXT(key, value string) {
+	a.mu.Lock()
+	if current, ok := a.record.TXT[key]; ok && current == value {
+		a.mu.Unlock()
+		return
+	}
+	txt := maps.Clone(a.record.TXT)
+	if txt == nil {
+		txt = make(map[string]string)
+	}
+	txt[key] = value
+	a.record.TXT = txt
+	a.mu.Unlock()
+
+	a.logger.Info("mDNS TXT record updated", map[string]any{
+		"key":   key,
+		"value": value,
+	})
+	a.announce()
+}
+
+// normalizeIP returns IPv4 addresses in their 4-byte form and drops
+// addresses that cannot be announced.
+func normalizeIP(ip net.IP) net.IP {
+	if ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// sameIPs reports whether two lists contain the same addresses, ignoring order.
+func sameIPs(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, ip := range a {
+		seen[ip.String()] = true
+	}
+	for _, ip := range b {
+		if !seen[ip.String()] {
+			return false
+		}
+	}
+	return true
+}
+
+// announce sends the records unless the name is still being probed; the
+// announcements after probing then carry the current records.
 func (a *Announcer) announce() {
-	a.sendRecords(defaultTTL)
+	a.joinGroups()
+	if a.isEstablished() {
+		a.sendRecords(defaultTTL)
+	}
 }
 
+func (a *Announcer) isEstablished() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.established
+}
+
+// joinGroups joins the multicast groups on every multicast-capable link, so
+// queries are heard on links that came up after the announcer started.
+func (a *Announcer) joinGroups() {
+	a.mu.RLock()
+	conn4, conn6 := a.conn4, a.conn6
+	a.mu.RUnlock()
+
+	for _, l := range a.links() {
+		if conn4 != nil && l.hasIPv4() {
+			if err := joinGroup(conn4, false, l.index); err != nil {
+				a.logger.Warn("failed to join mDNS group", map[string]any{
+					"interface": l.name,
+					"group":     mdnsGroup4.String(),
+					"error":     err.Error(),
+				})
+			}
+		}
+		if conn6 != nil && l.hasIPv6() {
+			if err := joinGroup(conn6, true, l.index); err != nil {
+				a.logger.Warn("failed to join mDNS group", map[string]any{
+					"interface": l.name,
+					"group":     mdnsGroup6.String(),
+					"error":     err.Error(),
+				})
+			}
+		}
+	}
+}
+
+// sendRecords multicasts the records on every link, each carrying only the
+// addresses reachable on that link.
 func (a *Announcer) sendRecords(ttl uint32) {
-	msg := a.buildResponse(ttl)
+	for _, scope := range a.scopes() {
+		a.sendScope(ttl, scope)
+	}
+}
+
+func (a *Announcer) sendScope(ttl uint32, scope linkScope) {
+	a.sendMessage(a.buildResponseFor(ttl, scope.addrs), scope)
+}
 
+// sendMessage multicasts a message on a link.
+func (a *Announcer) sendMessage(msg *Message, scope linkScope) {
 	data, err := PackMessage(msg)
 	if err != nil {
-		a.logger.Warn("failed to pack mDNS announcement", map[string]any{
+		a.logger.Warn("failed to pack mDNS message", map[string]any{
 			"error": err.Error(),
 		})
 		return
 	}
 
 	a.mu.RLock()
-	conn := a.conn
+	conn4, conn6 := a.conn4, a.conn6
 	a.mu.RUnlock()
 
-	if conn == nil {
-		return
+	if conn4 != nil && scope.ipv4 {
+		dst := &net.UDPAddr{IP: mdnsGroup4, Port: mdnsPort}
+		if _, _, err := conn4.WriteMsgUDP(data, outgoingInterface(scope.index), dst); err != nil {
+			a.logSendError(scope, err)
+		}
 	}
-
-	dst, _ := net.ResolveUDPAddr("udp4", mdnsAddr)
-	if _, err := conn.WriteTo(data, dst); err != nil {
-		a.logger.Warn("failed to send mDNS announcement", map[string]any{
-			"error": err.Error(),
-		})
+	if conn6 != nil && scope.ipv6 {
+		// The zone selects the outgoing interface for the link-local group
+		dst := &net.UDPAddr{IP: mdnsGroup6, Port: mdnsPort, Zone: scope.name}
+		if _, err := conn6.WriteToUDP(data, dst); err != nil {
+			a.logSendError(scope, err)
+		}
 	}
 }
 
-func (a *Announcer) listen(ctx context.Context) {
-	defer close(a.done)
+func (a *Announcer) logSendError(scope linkScope, err error) {
+	a.logger.Warn("failed to send mDNS announcement", map[string]any{
+		"interface": scope.name,
+		"error":     err.Error(),
+	})
+}
+
+// scopes returns the links to announce on with their addresses.
+func (a *Announcer) scopes() []linkScope {
+	a.mu.RLock()
+	addrs := slices.Clone(a.record.Addrs)
+	a.mu.RUnlock()
+
+	return linkScopes(a.links(), addrs)
+}
 
+func (a *Announcer) listen(ctx context.Context, conn *net.UDPConn) {
 	buf := make([]byte, 65536)
+	oob := make([]byte, 512)
 	for {
 		select {
 		case <-ctx.Done():
@@ -229,19 +442,12 @@ func (a *Announcer) listen(ctx context.Context) {
 		default:
 		}
 
-		a.mu.RLock()
-		conn := a.conn
-		a.mu.RUnlock()
-		if conn == nil {
-			return
-		}
-
 		// Set read deadline so we can check context cancellation
 		if err := conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
 			return
 		}
 
-		n, _, err := conn.ReadFromUDP(buf)
+		n, oobn, _, src, err := conn.ReadMsgUDP(buf, oob)
 		if err != nil {
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				continue // read deadline expired, check context
@@ -250,29 +456,99 @@ func (a *Announcer) listen(ctx context.Context) {
 			return
 		}
 
-		a.handleQuery(buf[:n])
+		ifindex := packetInterface(oob[:oobn])
+		if ifindex == 0 && src.Zone != "" {
+			if iface, err := net.InterfaceByName(src.Zone); err == nil {
+				ifindex = iface.Index
+			}
+		}
+		a.handlePacket(buf[:n], conn, src, ifindex)
 	}
 }
 
-func (a *Announcer) handleQuery(data []byte) {
+// handlePacket dispatches a received message. Responses are checked for
+// conflicts with our records; queries are answered once the name is
+// established, while probes from other hosts are checked against ours.
+func (a *Announcer) handlePacket(data []byte, conn *net.UDPConn, src *net.UDPAddr, ifindex int) {
 	msg, err := UnpackMessage(data)
 	if err != nil {
 		return // silently ignore malformed messages
 	}
 
-	// Only respond to queries (QR=0)
 	if msg.Header.Flags&flagQR != 0 {
+		a.handleResponse(msg)
 		return
 	}
+	if !a.isEstablished() {
+		a.handleProbe(msg)
+		return
+	}
+	a.handleQuery(msg, conn, src, ifindex)
+}
 
+// handleQuery answers a query on the link it arrived on, or directly to the
+// querier if it asked for a unicast response (RFC 6762 Section 5.4) or is a
+// one-shot querier not using the mDNS port (RFC 6762 Section 6.7).
+func (a *Announcer) handleQuery(msg *Message, conn *net.UDPConn, src *net.UDPAddr, ifindex int) {
 	// Check if any question matches our service
 	for _, q := range msg.Questions {
 		qName := strings.ToLower(q.Name)
-		if a.matchesQuestion(qName, q.Type) {
-			a.announce()
-			return // one response per query is sufficient
+		if !a.matchesQuestion(qName, q.Type) {
+			continue
+		}
+
+		// Without a known arrival interface, answer on all links
+		var scopes []linkScope
+		for _, scope := range a.scopes() {
+			if ifindex == 0 || scope.index == 0 || scope.index == ifindex {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		if q.Class&ClassINUnicast == ClassINUnicast || src.Port != mdnsPort {
+			a.sendUnicast(conn, src, scopes, msg)
+			return
+		}
+		for _, scope := range scopes {
+			a.sendScope(defaultTTL, scope)
+		}
+		return // one response per query is sufficient
+	}
+}
+
+func (a *Announcer) sendUnicast(conn *net.UDPConn, dst *net.UDPAddr, scopes []linkScope, query *Message) {
+	var addrs []net.IP
+	for _, scope := range scopes {
+		for _, ip := range scope.addrs {
+			if !slices.ContainsFunc(addrs, ip.Equal) {
+				addrs = append(addrs, ip)
+			}
+		}
+	}
+
+	resp := a.buildResponseFor(defaultTTL, addrs)
+	if dst.Port != mdnsPort {
+		// One-shot queriers expect a conventional DNS response (RFC 6762 Section 6.7)
+		resp.Header.ID = query.Header.ID
+		resp.Questions = query.Questions
+		for _, rrs := range [][]ResourceRecord{resp.Answers, resp.Additional} {
+			for i := range rrs {
+				rrs[i].Class = ClassIN
+				rrs[i].TTL = min(rrs[i].TTL, legacyTTL)
+			}
 		}
 	}
+
+	data, err := PackMessage(resp)
+	if err != nil {
+		return
+	}
+	if _, err := conn.WriteToUDP(data, dst); err != nil {
+		a.logger.Warn("failed to send mDNS response", map[string]any{
+			"destination": dst.String(),
+			"error":       err.Error(),
+		})
+	}
 }
 
 func (a *Announcer) matchesQuestion(qName string, qType uint16) bool {
@@ -290,7 +566,9 @@ func (a *Announcer) matchesQuestion(qName string, qType uint16) bool {
 		return true
 	case qType == TypeTXT && qName == instName:
 		return true
-	case qType == TypeA && qName == hostName:
+	case (qType == TypeA || qType == TypeAAAA) && qName == hostName:
+		return true
+	case qType == TypeANY && (qName == svcName || qName == instName || qName == hostName):
 		return true
 	// Also respond to DNS-SD browse queries
 	case qType == TypePTR && qName == "_services._dns-sd._udp."+strings.ToLower(a.record.Domain)+".":
@@ -300,66 +578,68 @@ func (a *Announcer) matchesQuestion(qName string, qType uint16) bool {
 	}
 }
 
-// buildResponse constructs a full mDNS response with PTR, SRV, TXT, and A records.
+// buildResponse constructs a full mDNS response with PTR, SRV, TXT, and
+// address records for all announced addresses.
 func (a *Announcer) buildResponse(ttl uint32) *Message {
 	a.mu.RLock()
-	defer a.mu.RUnlock()
+	addrs := slices.Clone(a.record.Addrs)
+	a.mu.RUnlock()
 
-	instName := a.record.fqInstanceName()
-	svcName := a.record.fqServiceName()
-	hostName := a.record.fqHostName()
+	return a.buildResponseFor(ttl, addrs)
+}
 
-	ptrData, _ := NewPTRRecord(instName)
-	srvData, _ := NewSRVRecord(0, 0, uint16(a.record.Port), hostName) //nolint:gosec // port is validated 1-65535
-	txtData := NewTXTRecord(a.record.TXT)
+// buildResponseFor constructs an mDNS response whose A and AAAA records
+// carry only the given addresses.
+func (a *Announcer) buildResponseFor(ttl uint32, addrs []net.IP) *Message {
+	a.mu.RLock()
+	ptr, unique := a.record.records(ttl, addrs, ClassINFlush)
+	a.mu.RUnlock()
 
-	msg := &Message{
+	return &Message{
 		Header: Header{
 			Flags: flagQR | flagAA, // Response, Authoritative
 		},
-		Answers: []ResourceRecord{
-			{
-				Name:  svcName,
-				Type:  TypePTR,
-				Class: ClassIN, // PTR records don't use cache-flush
-				TTL:   ttl,
-				Data:  ptrData,
-			},
-		},
-		Additional: []ResourceRecord{
-			{
-				Name:  instName,
-				Type:  TypeSRV,
-				Class: ClassINFlush,
-				TTL:   ttl,
-				Data:  srvData,
-			},
-			{
-				Name:  instName,
-				Type:  TypeTXT,
-				Class: ClassINFlush,
-				TTL:   ttl,
-				Data:  txtData,
-			},
-		},
+		Answers:    []ResourceRecord{ptr},
+		Additional: unique,
+	}
+}
+
+// records returns the shared PTR record of the service and the unique SRV,
+// TXT, A and AAAA records of the instance, for the given addresses. The
+// unique records use the given class, e.g. with the mDNS cache-flush bit.
+func (r *ServiceRecord) records(ttl uint32, addrs []net.IP, class uint16) (ResourceRecord, []ResourceRecord) {
+	instName := r.fqInstanceName()
+	hostName := r.fqHostName()
+
+	ptrData, _ := NewPTRRecord(instName)
+	srvData, _ := NewSRVRecord(0, 0, uint16(r.Port), hostName) //nolint:gosec // port is validated 1-65535
+	txtData := NewTXTRecord(r.TXT)
+
+	ptr := ResourceRecord{
+		Name:  r.fqServiceName(),
+		Type:  TypePTR,
+		Class: ClassIN, // PTR records don't use cache-flush
+		TTL:   ttl,
+		Data:  ptrData,
+	}
+	unique := []ResourceRecord{
+		{Name: instName, Type: TypeSRV, Class: class, TTL: ttl, Data: srvData},
+		{Name: instName, Type: TypeTXT, Class: class, TTL: ttl, Data: txtData},
 	}
 
-	// Add A record for each address
-	for _, ip := range a.record.Addrs {
-		aData := NewARecord(ip)
-		if aData == nil {
+	// Add an A or AAAA record for each address
+	for _, ip := range addrs {
+		rrType, data := TypeA, NewARecord(ip)
+		if data == nil {
+			rrType, data = TypeAAAA, NewAAAARecord(ip)
+		}
+		if data == nil {
 			continue
 		}
-		msg.Additional = append(msg.Additional, ResourceRecord{
-			Name:  hostName,
-			Type:  TypeA,
-			Class: ClassINFlush,
-			TTL:   ttl,
-			Data:  aData,
-		})
+		unique = append(unique, ResourceRecord{Name: hostName, Type: rrType, Class: class, TTL: ttl, Data: data})
 	}
 
-	return msg
+	return ptr, unique
 }
 
 func ipStrings(ips []net.IP) []string {
@@ -91,6 +91,70 @@ func TestBuildResponse_MultipleAddresses(t *testing.T) {
 	assert.Equal(t, []byte{10, 0, 1, 1}, msg.Additional[3].Data)
 }
 
+func TestBuildResponse_IPv6(t *testing.T) {
+	r := testRecord()
+	r.Addrs = []net.IP{net.IPv4(10, 0, 0, 1), net.ParseIP("fe80::1")}
+	a := NewAnnouncer(r, testLogger())
+	msg := a.buildResponse(120)
+
+	// Should have SRV + TXT + A + AAAA
+	require.Len(t, msg.Additional, 4)
+	assert.Equal(t, TypeA, msg.Additional[2].Type)
+	assert.Equal(t, TypeAAAA, msg.Additional[3].Type)
+	assert.Equal(t, "BoardingPass-test.local.", msg.Additional[3].Name)
+	assert.Equal(t, []byte(net.ParseIP("fe80::1")), msg.Additional[3].Data)
+	assert.Equal(t, ClassINFlush, msg.Additional[3].Class)
+}
+
+func TestBuildResponseFor_OnlyGivenAddresses(t *testing.T) {
+	r := testRecord()
+	r.Addrs = []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 1, 1)}
+	a := NewAnnouncer(r, testLogger())
+	msg := a.buildResponseFor(120, []net.IP{net.IPv4(10, 0, 1, 1)})
+
+	require.Len(t, msg.Additional, 3)
+	assert.Equal(t, []byte{10, 0, 1, 1}, msg.Additional[2].Data)
+}
+
+func TestLinkScopes(t *testing.T) {
+	eth0 := link{index: 2, name: "eth0", addrs: []net.IP{
+		net.IPv4(10, 0, 0, 1).To4(), net.ParseIP("fe80::1"),
+	}}
+	usb0 := link{index: 3, name: "usb0", addrs: []net.IP{net.ParseIP("fe80::2")}}
+	wlan0 := link{index: 4, name: "wlan0", addrs: []net.IP{net.IPv4(192, 168, 1, 5).To4()}}
+	links := []link{eth0, usb0, wlan0}
+
+	t.Run("addresses stay on their link", func(t *testing.T) {
+		scopes := linkScopes(links, []net.IP{net.IPv4(10, 0, 0, 1), net.ParseIP("fe80::1"), net.ParseIP("fe80::2")})
+		require.Len(t, scopes, 2)
+
+		assert.Equal(t, "eth0", scopes[0].name)
+		assert.Equal(t, []string{"10.0.0.1", "fe80::1"}, ipStrings(scopes[0].addrs))
+		assert.True(t, scopes[0].ipv4)
+		assert.True(t, scopes[0].ipv6)
+
+		assert.Equal(t, "usb0", scopes[1].name)
+		assert.Equal(t, []string{"fe80::2"}, ipStrings(scopes[1].addrs))
+		assert.False(t, scopes[1].ipv4)
+		assert.True(t, scopes[1].ipv6)
+	})
+
+	t.Run("unknown addresses go to every link", func(t *testing.T) {
+		scopes := linkScopes(links, []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 2, 1)})
+		require.Len(t, scopes, 3)
+		assert.Equal(t, []string{"10.0.0.1", "10.0.2.1"}, ipStrings(scopes[0].addrs))
+		assert.Equal(t, []string{"10.0.2.1"}, ipStrings(scopes[1].addrs))
+		assert.Equal(t, []string{"10.0.2.1"}, ipStrings(scopes[2].addrs))
+	})
+
+	t.Run("no known links", func(t *testing.T) {
+		scopes := linkScopes(nil, []net.IP{net.IPv4(10, 0, 0, 1)})
+		require.Len(t, scopes, 1)
+		assert.Equal(t, 0, scopes[0].index)
+		assert.Equal(t, []string{"10.0.0.1"}, ipStrings(scopes[0].addrs))
+	})
+}
+
 func TestBuildResponse_PackableMessage(t *testing.T) {
 	a := NewAnnouncer(testRecord(), testLogger())
 	msg := a.buildResponse(120)
@@ -120,6 +184,8 @@ func TestMatchesQuestion(t *testing.T) {
 		{"SRV for instance", "BoardingPass-test._boardingpass._tcp.local.", TypeSRV, true},
 		{"TXT for instance", "BoardingPass-test._boardingpass._tcp.local.", TypeTXT, true},
 		{"A for host", "BoardingPass-test.local.", TypeA, true},
+		{"AAAA for host", "BoardingPass-test.local.", TypeAAAA, true},
+		{"ANY for instance", "BoardingPass-test._boardingpass._tcp.local.", TypeANY, true},
 		{"DNS-SD browse", "_services._dns-sd._udp.local.", TypePTR, true},
 		{"case insensitive", "_BOARDINGPASS._TCP.LOCAL.", TypePTR, true},
 		{"wrong service", "_other._tcp.local.", TypePTR, false},
@@ -157,11 +223,32 @@ func TestAddRemoveAddress(t *testing.T) {
 	assert.True(t, a.record.Addrs[0].Equal(net.IPv4(10, 0, 1, 1)))
 	a.mu.RUnlock()
 
-	// Ignore IPv6
-	a.AddAddress(net.ParseIP("::1"))
+	// Add IPv6
+	a.AddAddress(net.ParseIP("fe80::1"))
 	a.mu.RLock()
-	assert.Len(t, a.record.Addrs, 1)
+	assert.Equal(t, []string{"10.0.1.1", "fe80::1"}, ipStrings(a.record.Addrs))
 	a.mu.RUnlock()
+
+	// Ignore unspecified
+	a.AddAddress(net.IPv6unspecified)
+	a.mu.RLock()
+	assert.Len(t, a.record.Addrs, 2)
+	a.mu.RUnlock()
+}
+
+func TestSetAddresses(t *testing.T) {
+	a := NewAnnouncer(testRecord(), testLogger())
+
+	a.SetAddresses([]net.IP{net.IPv4(192, 168, 1, 5), net.ParseIP("fe80::1"), net.IPv4(10, 0, 2, 1)})
+	a.mu.RLock()
+	assert.Equal(t, []string{"192.168.1.5", "fe80::1", "10.0.2.1"}, ipStrings(a.record.Addrs))
+	a.mu.RUnlock()
+
+	assert.True(t, sameIPs(
+		[]net.IP{net.IPv4(10, 0, 2, 1), net.IPv4(192, 168, 1, 5)},
+		[]net.IP{net.IPv4(192, 168, 1, 5), net.IPv4(10, 0, 2, 1)},
+	))
+	assert.False(t, sameIPs([]net.IP{net.IPv4(10, 0, 2, 1)}, []net.IP{net.IPv4(10, 0, 2, 2)}))
 }
 
 func TestIPStrings(t *testing.T) {
@@ -0,0 +1,194 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// queryInterval is the delay between repeated browse queries; responses to
+// the first query may be lost on busy or lossy links.
+const queryInterval = time.Second
+
+// ServiceEntry is a service instance found by browsing.
+type ServiceEntry struct {
+	Instance string            // instance label, e.g. "BoardingPass-myhostname"
+	Host     string            // target host name, e.g. "BoardingPass-myhostname.local."
+	Port     int               // service port
+	TXT      map[string]string // TXT key/value pairs
+	Addrs    []net.IP          // IPv4 and IPv6 addresses of the host
+}
+
+// Browse queries for instances of a service, e.g. "_boardingpass._tcp" in
+// domain "local", until ctx is done, and returns the instances found. The
+// queries ask for unicast responses, so Browse runs alongside a system mDNS
+// responder that holds the mDNS port.
+func Browse(ctx context.Context, service, domain string) ([]ServiceEntry, error) {
+	svcName := service + "." + domain + "."
+	query, err := PackMessage(&Message{
+		Questions: []Question{{Name: svcName, Type: TypePTR, Class: ClassINUnicast}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	conn4, err4 := net.ListenUDP("udp4", &net.UDPAddr{})
+	conn6, err6 := net.ListenUDP("udp6", &net.UDPAddr{})
+	if conn4 == nil && conn6 == nil {
+		return nil, fmt.Errorf("opening mDNS query socket: %w", errors.Join(err4, err6))
+	}
+
+	b := newBrowseResult(svcName)
+	responses := make(chan []byte)
+	for _, conn := range []*net.UDPConn{conn4, conn6} {
+		if conn == nil {
+			continue
+		}
+		defer func() { _ = conn.Close() }()
+		go readResponses(ctx, conn, responses)
+	}
+
+	sendQuery(conn4, conn6, query)
+	ticker := time.NewTicker(queryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return b.entries(), nil
+		case <-ticker.C:
+			sendQuery(conn4, conn6, query)
+		case data := <-responses:
+			if msg, err := UnpackMessage(data); err == nil && msg.Header.Flags&flagQR != 0 {
+				b.add(msg)
+			}
+		}
+	}
+}
+
+// sendQuery multicasts a query on every multicast-capable link, or on the
+// default interface if none is known.
+func sendQuery(conn4, conn6 *net.UDPConn, query []byte) {
+	group4 := &net.UDPAddr{IP: mdnsGroup4, Port: mdnsPort}
+	links := multicastLinks()
+	if len(links) == 0 {
+		if conn4 != nil {
+			_, _ = conn4.WriteToUDP(query, group4)
+		}
+		return
+	}
+
+	// Send errors are ignored; a link that cannot be queried yields no results
+	for _, l := range links {
+		if conn4 != nil && l.hasIPv4() {
+			_, _, _ = conn4.WriteMsgUDP(query, outgoingInterface(l.index), group4)
+		}
+		if conn6 != nil && l.hasIPv6() {
+			_, _ = conn6.WriteToUDP(query, &net.UDPAddr{IP: mdnsGroup6, Port: mdnsPort, Zone: l.name})
+		}
+	}
+}
+
+// readResponses forwards received datagrams until the connection is closed.
+func readResponses(ctx context.Context, conn *net.UDPConn, responses chan<- []byte) {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case responses <- slices.Clone(buf[:n]):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// browseResult accumulates the records of responses into service entries.
+// Records may arrive in any order and across several responses.
+type browseResult struct {
+	svcName   string
+	instances map[string]*ServiceEntry // lower-cased instance name -> entry
+	hosts     map[string][]net.IP      // lower-cased host name -> addresses
+}
+
+func newBrowseResult(svcName string) *browseResult {
+	return &browseResult{
+		svcName:   strings.ToLower(svcName),
+		instances: make(map[string]*ServiceEntry),
+		hosts:     make(map[string][]net.IP),
+	}
+}
+
+func (b *browseResult) instance(name string) *ServiceEntry {
+	key := strings.ToLower(name)
+	e, ok := b.instances[key]
+	if !ok {
+		label := name
+		if len(name) > len(b.svcName) {
+			label = strings.TrimSuffix(name[:len(name)-len(b.svcName)], ".")
+		}
+		e = &ServiceEntry{Instance: label}
+		b.instances[key] = e
+	}
+	return e
+}
+
+func (b *browseResult) isInstance(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), "."+b.svcName)
+}
+
+func (b *browseResult) add(msg *Message) {
+	for _, rr := range slices.Concat(msg.Answers, msg.Additional) {
+		switch rr.Type {
+		case TypePTR:
+			if !strings.EqualFold(rr.Name, b.svcName) {
+				continue
+			}
+			if target, err := ParsePTRRecord(rr.Data); err == nil && b.isInstance(target) {
+				b.instance(target)
+			}
+		case TypeSRV:
+			if !b.isInstance(rr.Name) {
+				continue
+			}
+			if port, target, err := ParseSRVRecord(rr.Data); err == nil {
+				e := b.instance(rr.Name)
+				e.Port = int(port)
+				e.Host = target
+			}
+		case TypeTXT:
+			if b.isInstance(rr.Name) {
+				b.instance(rr.Name).TXT = ParseTXTRecord(rr.Data)
+			}
+		case TypeA, TypeAAAA:
+			if len(rr.Data) != net.IPv4len && len(rr.Data) != net.IPv6len {
+				continue
+			}
+			key := strings.ToLower(rr.Name)
+			ip := normalizeIP(net.IP(rr.Data))
+			if ip != nil && !slices.ContainsFunc(b.hosts[key], ip.Equal) {
+				b.hosts[key] = append(b.hosts[key], ip)
+			}
+		}
+	}
+}
+
+// entries returns the instances sorted by name, with the addresses of their
+// hosts. Goodbye records are not tracked, as browsing is short-lived.
+func (b *browseResult) entries() []ServiceEntry {
+	entries := make([]ServiceEntry, 0, len(b.instances))
+	for _, e := range b.instances {
+		entry := *e
+		entry.Addrs = slices.Clone(b.hosts[strings.ToLower(e.Host)])
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Instance < entries[j].Instance })
+	return entries
+}
@@ -0,0 +1,65 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip packs and unpacks a message as it would travel on the wire.
+func roundTrip(t *testing.T, msg *Message) *Message {
+	t.Helper()
+	data, err := PackMessage(msg)
+	require.NoError(t, err)
+	parsed, err := UnpackMessage(data)
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestBrowseResult_FromAnnouncement(t *testing.T) {
+	r := testRecord()
+	r.Addrs = []net.IP{net.IPv4(10, 0, 0, 1), net.ParseIP("fe80::1")}
+	r.TXT = map[string]string{TXTSerial: "ABC123", TXTState: StateUnprovisioned}
+	a := NewAnnouncer(r, testLogger())
+
+	b := newBrowseResult("_boardingpass._tcp.local.")
+	b.add(roundTrip(t, a.buildResponse(120)))
+	// Repeated responses do not duplicate addresses
+	b.add(roundTrip(t, a.buildResponse(120)))
+
+	entries := b.entries()
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, "BoardingPass-test", e.Instance)
+	assert.Equal(t, "BoardingPass-test.local.", e.Host)
+	assert.Equal(t, 9455, e.Port)
+	assert.Equal(t, "ABC123", e.TXT[TXTSerial])
+	assert.Equal(t, StateUnprovisioned, e.TXT[TXTState])
+	assert.Equal(t, []string{"10.0.0.1", "fe80::1"}, ipStrings(e.Addrs))
+}
+
+func TestBrowseResult_IgnoresOtherServices(t *testing.T) {
+	r := testRecord()
+	r.Service = "_other._tcp"
+	a := NewAnnouncer(r, testLogger())
+
+	b := newBrowseResult("_boardingpass._tcp.local.")
+	b.add(roundTrip(t, a.buildResponse(120)))
+	assert.Empty(t, b.entries())
+}
+
+func TestBrowseResult_SortsInstances(t *testing.T) {
+	b := newBrowseResult("_boardingpass._tcp.local.")
+	for _, name := range []string{"b-device", "a-device"} {
+		r := testRecord()
+		r.Instance = name
+		b.add(roundTrip(t, NewAnnouncer(r, testLogger()).buildResponse(120)))
+	}
+
+	entries := b.entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "a-device", entries[0].Instance)
+	assert.Equal(t, "b-device", entries[1].Instance)
+}
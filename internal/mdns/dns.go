@@ -1,28 +1,41 @@
-// Package mdns implements a minimal mDNS/DNS-SD responder for service announcement.
+// Package mdns implements a minimal mDNS/DNS-SD responder for service announcement
+// and a browser for discovering announced services. For networks that
+// multicast does not reach, a registrar publishes the same records in a
+// unicast DNS zone via dynamic updates (wide-area DNS-SD).
 //
-// Only the DNS record types needed for DNS-SD are supported: A, PTR, SRV, and TXT.
-// The wire format follows RFC 1035 (DNS) and RFC 6762 (mDNS).
+// Only the DNS record types needed for DNS-SD are supported: A, AAAA, PTR, SRV,
+// and TXT.
+// The wire format follows RFC 1035 (DNS), RFC 6762 (mDNS), RFC 2136 (dynamic
+// updates) and RFC 8945 (TSIG).
 package mdns
 
 import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"slices"
 	"strings"
 )
 
-// DNS record type constants (RFC 1035, RFC 2782).
+// DNS record type constants (RFC 1035, RFC 2782, RFC 3596, RFC 8945).
 const (
-	TypeA   uint16 = 1
-	TypePTR uint16 = 12
-	TypeTXT uint16 = 16
-	TypeSRV uint16 = 33
+	TypeA    uint16 = 1
+	TypeSOA  uint16 = 6
+	TypePTR  uint16 = 12
+	TypeTXT  uint16 = 16
+	TypeAAAA uint16 = 28
+	TypeSRV  uint16 = 33
+	TypeTSIG uint16 = 250
+	TypeANY  uint16 = 255 // Question type only (RFC 1035 Section 3.2.3)
 )
 
 // DNS class constants.
 const (
 	ClassIN        uint16 = 1
+	ClassNONE      uint16 = 254        // Delete a specific record in updates (RFC 2136 Section 2.5.4)
+	ClassANY       uint16 = 255        // Delete an RRset in updates, and TSIG records
 	ClassINFlush   uint16 = 1 | 0x8000 // Cache-flush bit set (RFC 6762 Section 10.2)
 	ClassINUnicast uint16 = 1 | 0x8000 // QU bit in questions (RFC 6762 Section 5.4)
 )
@@ -217,12 +230,35 @@ func unpackRRs(data []byte, off, count int) ([]ResourceRecord, int, error) {
 		}
 		rr.Data = make([]byte, rdLen)
 		copy(rr.Data, data[off:off+int(rdLen)])
+		expandRDATA(&rr, data, off)
 		off += int(rdLen)
 		rrs = append(rrs, rr)
 	}
 	return rrs, off, nil
 }
 
+// expandRDATA replaces compressed names in PTR and SRV RDATA with their
+// uncompressed form, so the RDATA can be parsed without the message.
+func expandRDATA(rr *ResourceRecord, data []byte, off int) {
+	switch rr.Type {
+	case TypePTR:
+		if target, _, err := decodeName(data, off); err == nil {
+			if name, err := encodeName(target); err == nil {
+				rr.Data = name
+			}
+		}
+	case TypeSRV:
+		if len(rr.Data) <= 6 {
+			return
+		}
+		if target, _, err := decodeName(data, off+6); err == nil {
+			if name, err := encodeName(target); err == nil {
+				rr.Data = append(rr.Data[:6:6], name...)
+			}
+		}
+	}
+}
+
 // encodeName converts a dotted DNS name to wire format (uncompressed).
 // Input: "example.local." or "example.local" (trailing dot optional).
 func encodeName(name string) ([]byte, error) {
@@ -315,6 +351,18 @@ func NewARecord(ip net.IP) []byte {
 	return []byte(v4)
 }
 
+// NewAAAARecord builds RDATA for a DNS AAAA record (IPv6 address, RFC 3596).
+func NewAAAARecord(ip net.IP) []byte {
+	if ip.To4() != nil {
+		return nil
+	}
+	v6 := ip.To16()
+	if v6 == nil {
+		return nil
+	}
+	return []byte(v6)
+}
+
 // NewPTRRecord builds RDATA for a DNS PTR record.
 func NewPTRRecord(target string) ([]byte, error) {
 	return encodeName(target)
@@ -341,9 +389,10 @@ func NewTXTRecord(kv map[string]string) []byte {
 		return []byte{0}
 	}
 
+	// Sorted keys keep the RDATA identical across announcements
 	buf := make([]byte, 0, len(kv)*16)
-	for k, v := range kv {
-		s := k + "=" + v
+	for _, k := range slices.Sorted(maps.Keys(kv)) {
+		s := k + "=" + kv[k]
 		if len(s) > 255 {
 			s = s[:255]
 		}
@@ -352,3 +401,44 @@ func NewTXTRecord(kv map[string]string) []byte {
 	}
 	return buf
 }
+
+// RDATA parsers
+
+// ParsePTRRecord returns the target name of PTR RDATA.
+func ParsePTRRecord(data []byte) (string, error) {
+	name, _, err := decodeName(data, 0)
+	return name, err
+}
+
+// ParseSRVRecord returns the port and target name of SRV RDATA (RFC 2782).
+func ParseSRVRecord(data []byte) (port uint16, target string, err error) {
+	if len(data) < 7 {
+		return 0, "", errors.New("SRV record truncated")
+	}
+	target, _, err = decodeName(data, 6)
+	if err != nil {
+		return 0, "", err
+	}
+	return binary.BigEndian.Uint16(data[4:6]), target, nil
+}
+
+// ParseTXTRecord returns the key=value pairs of TXT RDATA. Keys are
+// lower-cased, as they are case-insensitive (RFC 6763 Section 6.4), and
+// keys without a value map to the empty string.
+func ParseTXTRecord(data []byte) map[string]string {
+	kv := make(map[string]string)
+	for len(data) > 0 {
+		n := int(data[0])
+		if 1+n > len(data) {
+			break
+		}
+		s := string(data[1 : 1+n])
+		data = data[1+n:]
+		if s == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(s, "=")
+		kv[strings.ToLower(k)] = v
+	}
+	return kv
+}
@@ -186,6 +186,22 @@ func TestNewARecord(t *testing.T) {
 	}
 }
 
+func TestNewAAAARecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       net.IP
+		expected []byte
+	}{
+		{"IPv6", net.ParseIP("fe80::1"), []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{"IPv4 returns nil", net.IPv4(192, 168, 1, 1), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewAAAARecord(tt.ip))
+		})
+	}
+}
+
 func TestNewSRVRecord(t *testing.T) {
 	data, err := NewSRVRecord(0, 0, 9455, "myhost.local.")
 	require.NoError(t, err)
@@ -240,6 +256,59 @@ func TestNewPTRRecord(t *testing.T) {
 	assert.Equal(t, "MyDevice._boardingpass._tcp.local.", name)
 }
 
+func TestParseSRVRecord(t *testing.T) {
+	data, err := NewSRVRecord(0, 0, 9455, "myhost.local.")
+	require.NoError(t, err)
+
+	port, target, err := ParseSRVRecord(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(9455), port)
+	assert.Equal(t, "myhost.local.", target)
+
+	_, _, err = ParseSRVRecord(data[:6])
+	assert.Error(t, err)
+}
+
+func TestParseTXTRecord(t *testing.T) {
+	data := NewTXTRecord(map[string]string{"serial": "ABC123", "fp": "SHA256:x=="})
+	assert.Equal(t, map[string]string{"serial": "ABC123", "fp": "SHA256:x=="}, ParseTXTRecord(data))
+
+	// Keys are case-insensitive, boolean keys have no value, truncation is tolerated
+	data = []byte{7, 'S', 'e', 'r', 'i', 'a', 'l', '='}
+	data = append(data, 4, 'f', 'l', 'a', 'g', 9, 'x')
+	assert.Equal(t, map[string]string{"serial": "", "flag": ""}, ParseTXTRecord(data))
+
+	assert.Empty(t, ParseTXTRecord([]byte{0}))
+}
+
+func TestUnpackMessage_ExpandsCompressedRDATA(t *testing.T) {
+	// Hand-built response whose PTR and SRV targets point back into the message
+	data := []byte{
+		0, 0, 0x84, 0, 0, 0, 0, 2, 0, 0, 0, 0, // header: response, 2 answers
+	}
+	svcOff := len(data)
+	data = append(data, mustEncodeName(t, "_bp._tcp.local.")...)
+	data = append(data, 0, 12, 0, 1, 0, 0, 0, 120, 0, 6) // PTR, RDLENGTH 6
+	instOff := len(data)
+	data = append(data, 3, 'd', 'e', 'v', 0xC0, byte(svcOff))
+	data = append(data, 0xC0, byte(instOff))                         // owner: dev._bp._tcp.local.
+	data = append(data, 0, 33, 0, 1, 0, 0, 0, 120, 0, 8)             // SRV, RDLENGTH 8
+	data = append(data, 0, 0, 0, 0, 0x24, 0xEF, 0xC0, byte(instOff)) // port 9455, target: pointer
+
+	msg, err := UnpackMessage(data)
+	require.NoError(t, err)
+	require.Len(t, msg.Answers, 2)
+
+	target, err := ParsePTRRecord(msg.Answers[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, "dev._bp._tcp.local.", target)
+
+	port, host, err := ParseSRVRecord(msg.Answers[1].Data)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(9455), port)
+	assert.Equal(t, "dev._bp._tcp.local.", host)
+}
+
 func TestUnpackMessage_TooShort(t *testing.T) {
 	_, err := UnpackMessage([]byte{0, 1, 2})
 	require.Error(t, err)
@@ -0,0 +1,98 @@
+package mdns
+
+import (
+	"net"
+	"slices"
+)
+
+// link is a multicast-capable network interface and its addresses.
+type link struct {
+	index int
+	name  string
+	addrs []net.IP
+}
+
+func (l link) hasIPv4() bool {
+	return slices.ContainsFunc(l.addrs, func(ip net.IP) bool { return ip.To4() != nil })
+}
+
+func (l link) hasIPv6() bool {
+	return slices.ContainsFunc(l.addrs, func(ip net.IP) bool { return ip.To4() == nil })
+}
+
+// linkScope is a link to announce on, with the announced addresses that are
+// reachable on it and the address families to send with.
+type linkScope struct {
+	index int // 0 if the interface is unknown
+	name  string
+	addrs []net.IP
+	ipv4  bool
+	ipv6  bool
+}
+
+// multicastLinks returns the interfaces that are up and support multicast.
+func multicastLinks() []link {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var links []link
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		l := link{index: iface.Index, name: iface.Name}
+		for _, a := range ifAddrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				l.addrs = append(l.addrs, normalizeIP(ipNet.IP))
+			}
+		}
+		links = append(links, l)
+	}
+	return links
+}
+
+// linkScopes assigns the announced addresses to the links they belong to.
+// Addresses not found on any link, e.g. a static address whose interface is
+// not up yet, are announced on every link. Links without any address to
+// announce are skipped, so the service is not advertised on unrelated
+// networks. Without any known link, all addresses are announced on the
+// default interface.
+func linkScopes(links []link, addrs []net.IP) []linkScope {
+	var unmatched []net.IP
+	for _, ip := range addrs {
+		if !slices.ContainsFunc(links, func(l link) bool { return slices.ContainsFunc(l.addrs, ip.Equal) }) {
+			unmatched = append(unmatched, ip)
+		}
+	}
+
+	var scopes []linkScope
+	for _, l := range links {
+		var own []net.IP
+		for _, ip := range addrs {
+			if slices.ContainsFunc(l.addrs, ip.Equal) {
+				own = append(own, ip)
+			}
+		}
+		if len(own) == 0 && len(unmatched) == 0 {
+			continue
+		}
+		scopes = append(scopes, linkScope{
+			index: l.index,
+			name:  l.name,
+			addrs: append(own, unmatched...),
+			ipv4:  l.hasIPv4(),
+			ipv6:  l.hasIPv6(),
+		})
+	}
+
+	if len(links) == 0 && len(addrs) > 0 {
+		scopes = append(scopes, linkScope{addrs: addrs, ipv4: true, ipv6: true})
+	}
+	return scopes
+}
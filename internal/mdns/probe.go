@@ -0,0 +1,334 @@
+package mdns
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Probing and conflict resolution (RFC 6762 Sections 8 and 9).
+const (
+	probeWait      = 250 * time.Millisecond // maximum initial delay and interval between probes
+	probeCount     = 3                      // probes sent before claiming a name
+	tieBreakDelay  = time.Second            // delay after losing a simultaneous probe tie-break
+	conflictLimit  = 15                     // renames before probing is rate limited
+	conflictDelay  = 5 * time.Second        // delay between probes once rate limited
+	maxLabelLength = 63                     // maximum DNS label length (RFC 1035 Section 2.3.4)
+)
+
+// announceDelays are the gaps before each announcement once a name is
+// claimed, sending announcements at t=0s, 1s and 3s (RFC 6762 Section 8.3).
+var announceDelays = []time.Duration{0, time.Second, 2 * time.Second}
+
+// probeEvent is reported by the packet handlers to the prober.
+type probeEvent int
+
+const (
+	eventConflict     probeEvent = iota + 1 // another host uses our name
+	eventLostTieBreak                       // a simultaneous prober won the tie-break
+)
+
+// SetConflictSuffix sets the suffix appended to the instance name on the
+// first conflict, e.g. derived from the device serial number. Later
+// conflicts append a counter as well. Without a suffix, conflicts are
+// resolved by appending "-2", "-3", and so on.
+func (a *Announcer) SetConflictSuffix(suffix string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.suffix = suffix
+}
+
+// Instance returns the announced instance name, which differs from the
+// configured one after a conflict.
+func (a *Announcer) Instance() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.record.Instance
+}
+
+// run claims the name by probing, announces it, and starts over under a new
+// name whenever another host turns out to use it.
+func (a *Announcer) run(ctx context.Context) {
+	for a.probe(ctx) {
+		if !a.defend(ctx) {
+			return
+		}
+		a.rename()
+	}
+}
+
+// probe sends probes for the instance and host names until no other host
+// objects (RFC 6762 Section 8.1), renaming on conflicts. It returns false
+// if ctx is done first.
+func (a *Announcer) probe(ctx context.Context) bool {
+	delay := rand.N(probeWait) // #nosec G404 - timing jitter, not security relevant
+	for {
+		a.drainEvents()
+
+		event, ok := a.wait(ctx, delay)
+		for i := 0; ok && event == 0 && i < probeCount; i++ {
+			a.sendProbe()
+			event, ok = a.wait(ctx, probeWait)
+		}
+		if !ok {
+			return false
+		}
+
+		switch event {
+		case 0:
+			a.mu.Lock()
+			a.established = true
+			instance := a.record.Instance
+			a.mu.Unlock()
+
+			a.logger.Info("mDNS name claimed", map[string]any{
+				"instance": instance,
+			})
+			return true
+		case eventLostTieBreak:
+			// The other host keeps probing; probe again once it has claimed the name
+			delay = tieBreakDelay
+		case eventConflict:
+			a.rename()
+			delay = rand.N(probeWait) // #nosec G404 - timing jitter, not security relevant
+			a.mu.RLock()
+			if a.renames >= conflictLimit {
+				delay = conflictDelay
+			}
+			a.mu.RUnlock()
+		}
+	}
+}
+
+// defend announces the claimed name and answers queries until another host
+// claims the name. It returns false if ctx is done first.
+func (a *Announcer) defend(ctx context.Context) bool {
+	for _, d := range announceDelays {
+		event, ok := a.wait(ctx, d)
+		if !ok {
+			return false
+		}
+		if event == eventConflict {
+			return true
+		}
+		a.announce()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event := <-a.events:
+			if event == eventConflict {
+				return true
+			}
+		}
+	}
+}
+
+// wait waits for d, returning early with an event. It returns false if ctx
+// is done first.
+func (a *Announcer) wait(ctx context.Context, d time.Duration) (probeEvent, bool) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return 0, false
+	case event := <-a.events:
+		return event, true
+	case <-timer.C:
+		return 0, true
+	}
+}
+
+// signal reports an event to the prober without blocking the packet handler.
+func (a *Announcer) signal(event probeEvent) {
+	select {
+	case a.events <- event:
+	default:
+	}
+}
+
+func (a *Announcer) drainEvents() {
+	for {
+		select {
+		case <-a.events:
+		default:
+			return
+		}
+	}
+}
+
+// rename switches to the next candidate instance name and host name.
+func (a *Announcer) rename() {
+	a.mu.Lock()
+	previous := a.record.Instance
+	a.renames++
+	a.record.Instance = nextInstanceName(a.base, a.suffix, a.renames)
+	a.established = false
+	instance := a.record.Instance
+	a.mu.Unlock()
+
+	a.logger.Warn("mDNS name conflict, renaming", map[string]any{
+		"previous": previous,
+		"instance": instance,
+	})
+}
+
+// nextInstanceName returns the instance name to use after the given number
+// of conflicts: "<base>-<suffix>", then "<base>-<suffix>-2", and so on, or
+// "<base>-2", "<base>-3", and so on without a suffix. The base is shortened
+// to keep the name within a single DNS label.
+func nextInstanceName(base, suffix string, renames int) string {
+	var tail string
+	switch {
+	case suffix == "":
+		tail = fmt.Sprintf("-%d", renames+1)
+	case renames == 1:
+		tail = "-" + suffix
+	default:
+		tail = fmt.Sprintf("-%s-%d", suffix, renames)
+	}
+
+	if len(base)+len(tail) > maxLabelLength {
+		base = base[:max(0, maxLabelLength-len(tail))]
+	}
+	return base + tail
+}
+
+// sendProbe queries for the instance and host names, proposing our records
+// in the authority section for simultaneous probe tie-breaking. Probes are
+// multicast, without the QU bit, as the announcer's sockets only receive
+// multicast.
+func (a *Announcer) sendProbe() {
+	msg := a.probeMessage()
+	for _, scope := range a.scopes() {
+		a.sendMessage(msg, scope)
+	}
+}
+
+func (a *Announcer) probeMessage() *Message {
+	a.mu.RLock()
+	instName := a.record.fqInstanceName()
+	hostName := a.record.fqHostName()
+	a.mu.RUnlock()
+
+	return &Message{
+		Questions: []Question{
+			{Name: instName, Type: TypeANY, Class: ClassIN},
+			{Name: hostName, Type: TypeANY, Class: ClassIN},
+		},
+		Authority: a.ownRecords(),
+	}
+}
+
+// ownRecords returns the unique records of the instance and host names for
+// all announced addresses, so the records match whichever link they were
+// sent on.
+func (a *Announcer) ownRecords() []ResourceRecord {
+	records := a.buildResponse(defaultTTL).Additional
+	for i := range records {
+		records[i].Class = ClassIN
+	}
+	return records
+}
+
+// ownsName reports whether a record name is our instance or host name.
+func (a *Announcer) ownsName(name string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return strings.EqualFold(name, a.record.fqInstanceName()) || strings.EqualFold(name, a.record.fqHostName())
+}
+
+// handleResponse reports a conflict if a response carries records for our
+// names that we did not send (RFC 6762 Section 9). Our own announcements are
+// received as well and never conflict.
+func (a *Announcer) handleResponse(msg *Message) {
+	own := a.ownRecords()
+	for _, rr := range slices.Concat(msg.Answers, msg.Additional) {
+		switch rr.Type {
+		case TypeSRV, TypeTXT, TypeA, TypeAAAA:
+		default:
+			continue // shared records such as PTR cannot conflict
+		}
+		if rr.TTL == 0 || !a.ownsName(rr.Name) {
+			continue
+		}
+		if !slices.ContainsFunc(own, func(o ResourceRecord) bool { return sameRecord(o, rr) }) {
+			a.signal(eventConflict)
+			return
+		}
+	}
+}
+
+// handleProbe resolves simultaneous probes for our names while we are still
+// probing (RFC 6762 Section 8.2): the host whose proposed records are
+// lexicographically later wins, and the other defers. Our own probes compare
+// equal and are ignored.
+func (a *Announcer) handleProbe(msg *Message) {
+	if len(msg.Authority) == 0 {
+		return
+	}
+
+	own := a.ownRecords()
+	a.mu.RLock()
+	names := []string{a.record.fqInstanceName(), a.record.fqHostName()}
+	a.mu.RUnlock()
+
+	for _, name := range names {
+		theirs := recordsNamed(msg.Authority, name)
+		if len(theirs) == 0 {
+			continue
+		}
+		if compareRecordSets(recordsNamed(own, name), theirs) < 0 {
+			a.signal(eventLostTieBreak)
+			return
+		}
+	}
+}
+
+func recordsNamed(records []ResourceRecord, name string) []ResourceRecord {
+	var named []ResourceRecord
+	for _, rr := range records {
+		if strings.EqualFold(rr.Name, name) {
+			named = append(named, rr)
+		}
+	}
+	return named
+}
+
+func sameRecord(x, y ResourceRecord) bool {
+	return x.Type == y.Type && strings.EqualFold(x.Name, y.Name) && bytes.Equal(x.Data, y.Data)
+}
+
+// compareRecordSets compares two sets of records after sorting them; a set
+// that is a prefix of the other compares lower.
+func compareRecordSets(x, y []ResourceRecord) int {
+	x = slices.SortedFunc(slices.Values(x), compareRecords)
+	y = slices.SortedFunc(slices.Values(y), compareRecords)
+	for i := range min(len(x), len(y)) {
+		if c := compareRecords(x[i], y[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(x), len(y))
+}
+
+// compareRecords orders records by class without the cache-flush bit, then
+// type, then RDATA bytes.
+func compareRecords(x, y ResourceRecord) int {
+	const cacheFlush = ClassINFlush &^ ClassIN
+	if c := cmp.Compare(x.Class&^cacheFlush, y.Class&^cacheFlush); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(x.Type, y.Type); c != 0 {
+		return c
+	}
+	return bytes.Compare(x.Data, y.Data)
+}
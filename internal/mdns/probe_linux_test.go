@@ -0,0 +1,106 @@
+package mdns
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopbackLink returns the loopback interface, so announcers in the same
+// process see each other's multicast traffic without touching the network.
+func loopbackLink(t *testing.T) link {
+	t.Helper()
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return link{index: iface.Index, name: iface.Name, addrs: []net.IP{net.IPv4(127, 0, 0, 1).To4()}}
+		}
+	}
+	t.Skip("no loopback interface")
+	return link{}
+}
+
+// startLoopbackAnnouncer starts an announcer restricted to the loopback interface.
+func startLoopbackAnnouncer(t *testing.T, instance string, addr net.IP, suffix string) *Announcer {
+	t.Helper()
+	lo := loopbackLink(t)
+
+	r := testRecord()
+	r.Instance = instance
+	r.Addrs = []net.IP{addr}
+	a := NewAnnouncer(r, testLogger())
+	a.links = func() []link { return []link{lo} }
+	a.SetConflictSuffix(suffix)
+
+	require.NoError(t, a.Start(t.Context()))
+	t.Cleanup(a.Stop)
+	return a
+}
+
+// uniqueInstance avoids clashes with announcers of concurrently running tests.
+func uniqueInstance() string {
+	return fmt.Sprintf("conflict-test-%08x", rand.Uint32()) // #nosec G404 - test name
+}
+
+func established(announcers ...*Announcer) func() bool {
+	return func() bool {
+		for _, a := range announcers {
+			if !a.isEstablished() {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestAnnouncers_SimultaneousProbesRenameOne(t *testing.T) {
+	name := uniqueInstance()
+	a := startLoopbackAnnouncer(t, name, net.IPv4(127, 0, 0, 2), "aaaaaa")
+	b := startLoopbackAnnouncer(t, name, net.IPv4(127, 0, 0, 3), "bbbbbb")
+
+	require.Eventually(t, func() bool {
+		return established(a, b)() && a.Instance() != b.Instance()
+	}, 10*time.Second, 50*time.Millisecond)
+
+	names := []string{a.Instance(), b.Instance()}
+	assert.Contains(t, names, name, "one announcer keeps the name")
+	assert.Subset(t, []string{name, name + "-aaaaaa", name + "-bbbbbb"}, names)
+}
+
+func TestAnnouncer_DefendsClaimedName(t *testing.T) {
+	name := uniqueInstance()
+	a := startLoopbackAnnouncer(t, name, net.IPv4(127, 0, 0, 2), "")
+	require.Eventually(t, established(a), 5*time.Second, 50*time.Millisecond)
+
+	b := startLoopbackAnnouncer(t, name, net.IPv4(127, 0, 0, 3), "")
+	require.Eventually(t, func() bool {
+		return established(b)() && b.Instance() == name+"-2"
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, name, a.Instance())
+
+	// A third device resolves to the next free number
+	c := startLoopbackAnnouncer(t, name, net.IPv4(127, 0, 0, 4), "")
+	require.Eventually(t, func() bool {
+		return established(c)() && c.Instance() == name+"-3"
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, name, a.Instance())
+	assert.Equal(t, name+"-2", b.Instance())
+}
+
+func TestAnnouncer_IdenticalRecordsDoNotConflict(t *testing.T) {
+	// The same announcer's traffic loops back to itself; it must keep its name
+	name := uniqueInstance()
+	a := startLoopbackAnnouncer(t, name, net.IPv4(127, 0, 0, 2), "aaaaaa")
+	require.Eventually(t, established(a), 5*time.Second, 50*time.Millisecond)
+
+	a.AddAddress(net.IPv4(127, 0, 0, 5))
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, name, a.Instance())
+	assert.True(t, a.isEstablished())
+}
@@ -0,0 +1,100 @@
+package mdns
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextInstanceName(t *testing.T) {
+	assert.Equal(t, "BoardingPass-localhost-SN1234", nextInstanceName("BoardingPass-localhost", "SN1234", 1))
+	assert.Equal(t, "BoardingPass-localhost-SN1234-2", nextInstanceName("BoardingPass-localhost", "SN1234", 2))
+	assert.Equal(t, "BoardingPass-localhost-2", nextInstanceName("BoardingPass-localhost", "", 1))
+	assert.Equal(t, "BoardingPass-localhost-3", nextInstanceName("BoardingPass-localhost", "", 2))
+
+	long := nextInstanceName(strings.Repeat("x", 63), "a1b2c3", 1)
+	assert.Len(t, long, maxLabelLength)
+	assert.True(t, strings.HasSuffix(long, "-a1b2c3"))
+}
+
+func TestCompareRecordSets(t *testing.T) {
+	a := ResourceRecord{Class: ClassIN, Type: TypeA, Data: []byte{169, 254, 99, 200}}
+	b := ResourceRecord{Class: ClassIN, Type: TypeA, Data: []byte{169, 254, 200, 50}}
+	srv := ResourceRecord{Class: ClassINFlush, Type: TypeSRV, Data: []byte{0, 0, 0, 0, 0x24, 0xEF, 0}}
+
+	// RFC 6762 Section 8.2.1: the numerically greater address wins
+	assert.Equal(t, -1, compareRecordSets([]ResourceRecord{a}, []ResourceRecord{b}))
+	assert.Equal(t, 1, compareRecordSets([]ResourceRecord{b}, []ResourceRecord{a}))
+
+	// Order does not matter and the cache-flush bit is ignored
+	srvNoFlush := srv
+	srvNoFlush.Class = ClassIN
+	assert.Equal(t, 0, compareRecordSets([]ResourceRecord{srv, a}, []ResourceRecord{a, srvNoFlush}))
+
+	// A set that is a prefix of the other loses
+	assert.Equal(t, -1, compareRecordSets([]ResourceRecord{a}, []ResourceRecord{a, b}))
+}
+
+func TestHandleResponse(t *testing.T) {
+	a := NewAnnouncer(testRecord(), testLogger())
+
+	// Our own announcement, as received through multicast loopback
+	a.handleResponse(roundTrip(t, a.buildResponse(120)))
+	assert.Empty(t, a.events)
+
+	// Goodbyes from another host do not conflict
+	other := testRecord()
+	other.Addrs = []net.IP{net.IPv4(10, 0, 0, 2)}
+	b := NewAnnouncer(other, testLogger())
+	a.handleResponse(roundTrip(t, b.buildResponse(0)))
+	assert.Empty(t, a.events)
+
+	// Another host announcing our host name with a different address
+	a.handleResponse(roundTrip(t, b.buildResponse(120)))
+	require.Len(t, a.events, 1)
+	assert.Equal(t, eventConflict, <-a.events)
+
+	// Records for other names are none of our business
+	other.Instance = "BoardingPass-other"
+	c := NewAnnouncer(other, testLogger())
+	a.handleResponse(roundTrip(t, c.buildResponse(120)))
+	assert.Empty(t, a.events)
+}
+
+func TestHandleProbe(t *testing.T) {
+	low := testRecord()
+	low.Addrs = []net.IP{net.IPv4(10, 0, 0, 1)}
+	high := testRecord()
+	high.Addrs = []net.IP{net.IPv4(10, 0, 0, 2)}
+	a := NewAnnouncer(low, testLogger())
+	b := NewAnnouncer(high, testLogger())
+
+	// Our own probe compares equal
+	a.handleProbe(roundTrip(t, a.probeMessage()))
+	assert.Empty(t, a.events)
+
+	// The prober with the lexicographically later records wins
+	b.handleProbe(roundTrip(t, a.probeMessage()))
+	assert.Empty(t, b.events)
+
+	a.handleProbe(roundTrip(t, b.probeMessage()))
+	require.Len(t, a.events, 1)
+	assert.Equal(t, eventLostTieBreak, <-a.events)
+}
+
+func TestRename(t *testing.T) {
+	a := NewAnnouncer(testRecord(), testLogger())
+	a.SetConflictSuffix("a1b2c3")
+	a.established = true
+
+	a.rename()
+	assert.Equal(t, "BoardingPass-test-a1b2c3", a.Instance())
+	assert.False(t, a.isEstablished())
+	assert.Equal(t, "BoardingPass-test-a1b2c3.local.", a.record.fqHostName())
+
+	a.rename()
+	assert.Equal(t, "BoardingPass-test-a1b2c3-2", a.Instance())
+}
@@ -0,0 +1,85 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// enablePacketInfo makes the kernel report the arrival interface of each
+// received packet.
+func enablePacketInfo(conn *net.UDPConn, ipv6 bool) error {
+	return control(conn, func(fd int) error {
+		if ipv6 {
+			return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_RECVPKTINFO, 1)
+		}
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_PKTINFO, 1)
+	})
+}
+
+// joinGroup joins the mDNS group of the socket's address family on the given
+// interface. Joining a group twice is not an error.
+func joinGroup(conn *net.UDPConn, ipv6 bool, ifindex int) error {
+	err := control(conn, func(fd int) error {
+		if ipv6 {
+			mreq := &unix.IPv6Mreq{Interface: uint32(ifindex)} // #nosec G115 - interface indexes are positive
+			copy(mreq.Multiaddr[:], mdnsGroup6.To16())
+			return unix.SetsockoptIPv6Mreq(fd, unix.IPPROTO_IPV6, unix.IPV6_JOIN_GROUP, mreq)
+		}
+		mreq := &unix.IPMreqn{Ifindex: int32(ifindex)} // #nosec G115 - interface indexes fit in int32
+		copy(mreq.Multiaddr[:], mdnsGroup4.To4())
+		return unix.SetsockoptIPMreqn(fd, unix.IPPROTO_IP, unix.IP_ADD_MEMBERSHIP, mreq)
+	})
+	if errors.Is(err, unix.EADDRINUSE) {
+		return nil
+	}
+	return err
+}
+
+// packetInterface returns the arrival interface index from the control
+// messages of a received packet, or 0 if unknown.
+func packetInterface(oob []byte) int {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_PKTINFO &&
+			len(m.Data) >= unix.SizeofInet4Pktinfo:
+			// struct in_pktinfo starts with the interface index
+			return int(int32(binary.NativeEndian.Uint32(m.Data[0:4]))) // #nosec G115 - kernel-provided index
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_PKTINFO &&
+			len(m.Data) >= unix.SizeofInet6Pktinfo:
+			// struct in6_pktinfo has the interface index after the address
+			return int(binary.NativeEndian.Uint32(m.Data[16:20]))
+		}
+	}
+	return 0
+}
+
+// outgoingInterface returns the control message that sends an IPv4 packet
+// out of the given interface, or nil for the default interface.
+func outgoingInterface(ifindex int) []byte {
+	if ifindex == 0 {
+		return nil
+	}
+	return unix.PktInfo4(&unix.Inet4Pktinfo{Ifindex: int32(ifindex)}) // #nosec G115 - interface indexes fit in int32
+}
+
+// control runs fn on the socket's file descriptor.
+func control(conn *net.UDPConn, fn func(fd int) error) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := raw.Control(func(fd uintptr) {
+		fnErr = fn(int(fd)) // #nosec G115 - file descriptors fit in int
+	}); err != nil {
+		return err
+	}
+	return fnErr
+}
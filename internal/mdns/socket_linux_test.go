@@ -0,0 +1,14 @@
+package mdns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestPacketInterface(t *testing.T) {
+	assert.Equal(t, 3, packetInterface(unix.PktInfo4(&unix.Inet4Pktinfo{Ifindex: 3})))
+	assert.Equal(t, 5, packetInterface(unix.PktInfo6(&unix.Inet6Pktinfo{Ifindex: 5})))
+	assert.Equal(t, 0, packetInterface(nil))
+}
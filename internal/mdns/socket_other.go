@@ -0,0 +1,24 @@
+//go:build !linux
+
+package mdns
+
+import "net"
+
+// enablePacketInfo is a no-op; without arrival interfaces, queries are
+// answered on all links.
+func enablePacketInfo(_ *net.UDPConn, _ bool) error {
+	return nil
+}
+
+// joinGroup is a no-op; the socket is only joined on the default interface.
+func joinGroup(_ *net.UDPConn, _ bool, _ int) error {
+	return nil
+}
+
+func packetInterface(_ []byte) int {
+	return 0
+}
+
+func outgoingInterface(_ int) []byte {
+	return nil
+}
@@ -0,0 +1,293 @@
+package mdns
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TSIG algorithms (RFC 8945 Section 6).
+const (
+	TSIGHMACSHA256 = "hmac-sha256"
+	TSIGHMACSHA512 = "hmac-sha512"
+)
+
+// tsigFudge is the permitted clock skew in seconds (RFC 8945 Section 10).
+const tsigFudge = 300
+
+// TSIG error codes (RFC 8945 Section 3).
+const (
+	tsigBadSig  uint16 = 16
+	tsigBadKey  uint16 = 17
+	tsigBadTime uint16 = 18
+)
+
+// errNoTSIG is returned when a message that must be signed is not.
+var errNoTSIG = errors.New("message is not signed")
+
+// TSIGKey is a shared secret for authenticating DNS messages (RFC 8945).
+type TSIGKey struct {
+	Name      string // key name, e.g. "boardingpass"
+	Algorithm string // TSIGHMACSHA256 (default) or TSIGHMACSHA512
+	Secret    []byte
+}
+
+// algorithmName returns the algorithm as a DNS name, e.g. "hmac-sha256.".
+func (k *TSIGKey) algorithmName() string {
+	if k.Algorithm == "" {
+		return TSIGHMACSHA256 + "."
+	}
+	return strings.ToLower(strings.TrimSuffix(k.Algorithm, ".")) + "."
+}
+
+func (k *TSIGKey) hash() (func() hash.Hash, error) {
+	switch k.algorithmName() {
+	case TSIGHMACSHA256 + ".":
+		return sha256.New, nil
+	case TSIGHMACSHA512 + ".":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported TSIG algorithm %q", k.Algorithm)
+	}
+}
+
+// tsigRecord holds the RDATA fields of a TSIG record (RFC 8945 Section 4.2).
+type tsigRecord struct {
+	algorithm  string
+	timeSigned uint64 // seconds since the epoch, 48 bits on the wire
+	fudge      uint16
+	mac        []byte
+	originalID uint16
+	err        uint16
+	other      []byte
+}
+
+func (t *tsigRecord) pack() ([]byte, error) {
+	alg, err := encodeName(t.algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("encoding TSIG algorithm: %w", err)
+	}
+	buf := make([]byte, 0, len(alg)+16+len(t.mac)+len(t.other))
+	buf = append(buf, alg...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(t.timeSigned>>32)) // #nosec G115 - upper 16 of 48 bits
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.timeSigned))     // #nosec G115 - lower 32 of 48 bits
+	buf = binary.BigEndian.AppendUint16(buf, t.fudge)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(t.mac))) // #nosec G115 - MAC is at most 64 bytes
+	buf = append(buf, t.mac...)
+	buf = binary.BigEndian.AppendUint16(buf, t.originalID)
+	buf = binary.BigEndian.AppendUint16(buf, t.err)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(t.other))) // #nosec G115 - other data is at most 6 bytes
+	buf = append(buf, t.other...)
+	return buf, nil
+}
+
+func parseTSIG(data []byte) (*tsigRecord, error) {
+	alg, off, err := decodeName(data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding TSIG algorithm: %w", err)
+	}
+	if off+10 > len(data) {
+		return nil, errors.New("TSIG record truncated")
+	}
+	t := &tsigRecord{
+		algorithm:  strings.ToLower(alg),
+		timeSigned: uint64(binary.BigEndian.Uint16(data[off:]))<<32 | uint64(binary.BigEndian.Uint32(data[off+2:])),
+		fudge:      binary.BigEndian.Uint16(data[off+6:]),
+	}
+	macLen := int(binary.BigEndian.Uint16(data[off+8:]))
+	off += 10
+	if off+macLen+6 > len(data) {
+		return nil, errors.New("TSIG record truncated")
+	}
+	t.mac = slices.Clone(data[off : off+macLen])
+	off += macLen
+	t.originalID = binary.BigEndian.Uint16(data[off:])
+	t.err = binary.BigEndian.Uint16(data[off+2:])
+	otherLen := int(binary.BigEndian.Uint16(data[off+4:]))
+	off += 6
+	if off+otherLen > len(data) {
+		return nil, errors.New("TSIG record truncated")
+	}
+	t.other = slices.Clone(data[off : off+otherLen])
+	return t, nil
+}
+
+// sign packs msg with a TSIG record appended and returns the packed message
+// and its MAC. Responses cover the MAC of the request they answer.
+func (k *TSIGKey) sign(msg *Message, requestMAC []byte, now time.Time) ([]byte, []byte, error) {
+	data, err := PackMessage(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := &tsigRecord{
+		algorithm:  k.algorithmName(),
+		timeSigned: uint64(now.Unix()), // #nosec G115 - current time is positive
+		fudge:      tsigFudge,
+		originalID: msg.Header.ID,
+	}
+	if t.mac, err = k.mac(data, requestMAC, t); err != nil {
+		return nil, nil, err
+	}
+	rdata, err := t.pack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signed := *msg
+	signed.Additional = append(slices.Clone(msg.Additional), ResourceRecord{
+		Name:  k.Name,
+		Type:  TypeTSIG,
+		Class: ClassANY,
+		Data:  rdata,
+	})
+	data, err = PackMessage(&signed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, t.mac, nil
+}
+
+// verify checks the TSIG record that signs data, which is a request if
+// requestMAC is nil and otherwise the response to that request. It returns
+// the MAC of the message, and errNoTSIG if the message is not signed.
+func (k *TSIGKey) verify(data, requestMAC []byte, now time.Time) ([]byte, error) {
+	msg, err := UnpackMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Additional) == 0 || msg.Additional[len(msg.Additional)-1].Type != TypeTSIG {
+		return nil, errNoTSIG
+	}
+	rr := msg.Additional[len(msg.Additional)-1]
+	if !strings.EqualFold(strings.TrimSuffix(rr.Name, "."), strings.TrimSuffix(k.Name, ".")) {
+		return nil, fmt.Errorf("signed with unknown TSIG key %q", rr.Name)
+	}
+	t, err := parseTSIG(rr.Data)
+	if err != nil {
+		return nil, err
+	}
+	if t.err != 0 {
+		return nil, fmt.Errorf("TSIG error %s", tsigErrorName(t.err))
+	}
+	if t.algorithm != k.algorithmName() {
+		return nil, fmt.Errorf("unexpected TSIG algorithm %q", t.algorithm)
+	}
+
+	// The MAC covers the message as it was before the TSIG record was added
+	off, err := lastRecordOffset(data)
+	if err != nil {
+		return nil, err
+	}
+	unsigned := slices.Clone(data[:off])
+	binary.BigEndian.PutUint16(unsigned[0:2], t.originalID)
+	binary.BigEndian.PutUint16(unsigned[10:12], msg.Header.ARCount-1)
+
+	expected, err := k.mac(unsigned, requestMAC, t)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(expected, t.mac) {
+		return nil, errors.New("TSIG signature mismatch")
+	}
+	if skew := now.Unix() - int64(t.timeSigned); max(skew, -skew) > int64(t.fudge) { // #nosec G115 - 48-bit value
+		return nil, errors.New("TSIG time outside the permitted clock skew")
+	}
+	return t.mac, nil
+}
+
+// mac computes the MAC over the request MAC (for responses), the message
+// without its TSIG record, and the TSIG variables (RFC 8945 Section 4.3).
+func (k *TSIGKey) mac(msg, requestMAC []byte, t *tsigRecord) ([]byte, error) {
+	newHash, err := k.hash()
+	if err != nil {
+		return nil, err
+	}
+	name, err := encodeName(strings.ToLower(k.Name))
+	if err != nil {
+		return nil, fmt.Errorf("encoding TSIG key name: %w", err)
+	}
+	alg, err := encodeName(t.algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("encoding TSIG algorithm: %w", err)
+	}
+
+	var buf []byte
+	if requestMAC != nil {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(requestMAC))) // #nosec G115 - MAC is at most 64 bytes
+		buf = append(buf, requestMAC...)
+	}
+	buf = append(buf, msg...)
+	buf = append(buf, name...)
+	buf = binary.BigEndian.AppendUint16(buf, ClassANY)
+	buf = binary.BigEndian.AppendUint32(buf, 0) // TTL
+	buf = append(buf, alg...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(t.timeSigned>>32)) // #nosec G115 - upper 16 of 48 bits
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.timeSigned))     // #nosec G115 - lower 32 of 48 bits
+	buf = binary.BigEndian.AppendUint16(buf, t.fudge)
+	buf = binary.BigEndian.AppendUint16(buf, t.err)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(t.other))) // #nosec G115 - other data is at most 6 bytes
+	buf = append(buf, t.other...)
+
+	m := hmac.New(newHash, k.Secret)
+	m.Write(buf)
+	return m.Sum(nil), nil
+}
+
+// lastRecordOffset returns the offset of the last resource record in a
+// message, where a TSIG record must be placed.
+func lastRecordOffset(data []byte) (int, error) {
+	if len(data) < headerSize {
+		return 0, errors.New("message too short for header")
+	}
+	off := headerSize
+	for range binary.BigEndian.Uint16(data[4:6]) {
+		_, next, err := decodeName(data, off)
+		if err != nil {
+			return 0, err
+		}
+		off = next + 4
+	}
+
+	count := int(binary.BigEndian.Uint16(data[6:8])) + int(binary.BigEndian.Uint16(data[8:10])) +
+		int(binary.BigEndian.Uint16(data[10:12]))
+	if count == 0 {
+		return 0, errors.New("message has no records")
+	}
+	last := off
+	for range count {
+		last = off
+		_, next, err := decodeName(data, off)
+		if err != nil {
+			return 0, err
+		}
+		if next+10 > len(data) {
+			return 0, errors.New("resource record truncated")
+		}
+		off = next + 10 + int(binary.BigEndian.Uint16(data[next+8:next+10]))
+	}
+	if off > len(data) {
+		return 0, errors.New("RDATA truncated")
+	}
+	return last, nil
+}
+
+func tsigErrorName(code uint16) string {
+	switch code {
+	case tsigBadSig:
+		return "BADSIG"
+	case tsigBadKey:
+		return "BADKEY"
+	case tsigBadTime:
+		return "BADTIME"
+	default:
+		return rcodeName(code)
+	}
+}
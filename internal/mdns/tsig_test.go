@@ -0,0 +1,153 @@
+package mdns
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTSIG_SignAndVerify(t *testing.T) {
+	key := testKey()
+	now := time.Unix(1700000000, 0)
+	msg := &Message{
+		Header:    Header{ID: 0x1234, Flags: opcodeUpdate},
+		Questions: []Question{{Name: "prov.example.com.", Type: TypeSOA, Class: ClassIN}},
+		Authority: []ResourceRecord{{Name: "host.prov.example.com.", Type: TypeA, Class: ClassIN, TTL: 120,
+			Data: []byte{192, 0, 2, 10}}},
+	}
+
+	data, mac, err := key.sign(msg, nil, now)
+	require.NoError(t, err)
+	assert.Len(t, mac, 32)
+
+	signed, err := UnpackMessage(data)
+	require.NoError(t, err)
+	require.Len(t, signed.Additional, 1)
+	rr := signed.Additional[0]
+	assert.Equal(t, TypeTSIG, rr.Type)
+	assert.Equal(t, ClassANY, rr.Class)
+	tsig, err := parseTSIG(rr.Data)
+	require.NoError(t, err)
+	assert.Equal(t, "hmac-sha256.", tsig.algorithm)
+	assert.Equal(t, uint64(now.Unix()), tsig.timeSigned)
+	assert.Equal(t, uint16(0x1234), tsig.originalID)
+
+	verified, err := key.verify(data, nil, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, mac, verified)
+
+	// Responses are bound to the request MAC
+	resp := &Message{Header: Header{ID: 0x1234, Flags: flagQR | opcodeUpdate}, Questions: msg.Questions}
+	respData, _, err := key.sign(resp, mac, now)
+	require.NoError(t, err)
+	_, err = key.verify(respData, mac, now)
+	require.NoError(t, err)
+	_, err = key.verify(respData, []byte("other request"), now)
+	assert.ErrorContains(t, err, "signature mismatch")
+
+	// Tampering, stale signatures and missing signatures are rejected
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-len(rr.Data)-20]++
+	_, err = key.verify(tampered, nil, now)
+	assert.Error(t, err)
+
+	_, err = key.verify(data, nil, now.Add(10*time.Minute))
+	assert.ErrorContains(t, err, "clock skew")
+
+	unsigned, err := PackMessage(msg)
+	require.NoError(t, err)
+	_, err = key.verify(unsigned, nil, now)
+	assert.ErrorIs(t, err, errNoTSIG)
+}
+
+// tsigVector decodes a hex test vector; whitespace separates its fields.
+func tsigVector(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	require.NoError(t, err)
+	return data
+}
+
+// TestTSIG_KnownAnswer checks signatures against messages laid out by hand
+// following RFC 8945, with MACs computed independently of this package.
+func TestTSIG_KnownAnswer(t *testing.T) {
+	key := testKey()
+	now := time.Unix(1700000000, 0)
+
+	const (
+		zone  = "0470726f76076578616d706c6503636f6d00 0006 0001"       // prov.example.com. SOA IN
+		tsig  = "0c626f617264696e677061737300 00fa 00ff 00000000 003d" // boardingpass. TSIG ANY TTL 0, RDLENGTH
+		alg   = "0b686d61632d73686132353600"                           // hmac-sha256.
+		times = "00006553f100 012c 0020"                               // time signed (48 bits), fudge, MAC size
+	)
+	request := tsigVector(t, "1234 2800 0001 0000 0001 0001"+ // ID, UPDATE, 1 zone, 1 update, 1 additional
+		zone+
+		"04686f73740470726f76076578616d706c6503636f6d00 0001 0001 00000078 0004 c000020a"+ // host A 192.0.2.10
+		tsig+alg+times+
+		"2093d9649124f61676d7a30fc43982ad195118eea2064a34b7e355cfe5f6be42"+
+		"1234 0000 0000") // original ID, error, other length
+	requestMAC := request[len(request)-38 : len(request)-6]
+
+	msg := &Message{
+		Header:    Header{ID: 0x1234, Flags: opcodeUpdate},
+		Questions: []Question{{Name: "prov.example.com.", Type: TypeSOA, Class: ClassIN}},
+		Authority: []ResourceRecord{{Name: "host.prov.example.com.", Type: TypeA, Class: ClassIN, TTL: 120,
+			Data: []byte{192, 0, 2, 10}}},
+	}
+	data, mac, err := key.sign(msg, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(request), hex.EncodeToString(data))
+	assert.Equal(t, requestMAC, mac)
+
+	verified, err := key.verify(request, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, requestMAC, verified)
+
+	// The response MAC covers the request MAC first
+	response := tsigVector(t, "1234 a800 0001 0000 0000 0001"+
+		zone+
+		tsig+alg+times+
+		"5b0cf675adc8efc71ee71c5d27ee582be19d47a543eb3d3ca738b8d91f43b22b"+
+		"1234 0000 0000")
+	verified, err = key.verify(response, requestMAC, now)
+	require.NoError(t, err)
+	assert.Equal(t, response[len(response)-38:len(response)-6], verified)
+}
+
+func TestTSIG_SHA512(t *testing.T) {
+	key := testKey()
+	key.Algorithm = TSIGHMACSHA512
+	msg := &Message{Questions: []Question{{Name: "prov.example.com.", Type: TypeSOA, Class: ClassIN}}}
+
+	data, mac, err := key.sign(msg, nil, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, mac, 64)
+	_, err = key.verify(data, nil, time.Now())
+	require.NoError(t, err)
+
+	key.Algorithm = "hmac-md5"
+	_, _, err = key.sign(msg, nil, time.Now())
+	assert.ErrorContains(t, err, "unsupported TSIG algorithm")
+}
+
+func TestLastRecordOffset(t *testing.T) {
+	msg := &Message{
+		Questions: []Question{{Name: "example.com.", Type: TypeSOA, Class: ClassIN}},
+		Answers:   []ResourceRecord{{Name: "a.example.com.", Type: TypeA, Class: ClassIN, Data: []byte{1, 2, 3, 4}}},
+	}
+	data, err := PackMessage(msg)
+	require.NoError(t, err)
+	off, err := lastRecordOffset(data)
+	require.NoError(t, err)
+	assert.Equal(t, headerSize+len("\x07example\x03com\x00")+4, off)
+
+	msg.Answers = nil
+	data, err = PackMessage(msg)
+	require.NoError(t, err)
+	_, err = lastRecordOffset(data)
+	assert.Error(t, err)
+}
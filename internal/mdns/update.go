@@ -0,0 +1,327 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/logging"
+)
+
+// Dynamic update message fields (RFC 2136 Section 2).
+const (
+	opcodeUpdate  uint16 = 5 << 11 // UPDATE opcode in the header flags
+	rcodeMask     uint16 = 0x000F
+	updateTimeout        = 5 * time.Second // per exchange, unless ctx ends earlier
+)
+
+// Response codes (RFC 1035 Section 4.1.1, RFC 2136 Section 2.2).
+const (
+	rcodeNoError  uint16 = 0
+	rcodeYXDomain uint16 = 6 // a name that should not exist does
+)
+
+// Registrar publishes a service in a unicast DNS zone with dynamic updates
+// (RFC 2136), so it can be discovered by DNS-SD browsers on networks that
+// mDNS multicast does not reach (RFC 6763 Section 11). Updates are signed
+// with TSIG when a key is given.
+//
+// The instance name is claimed on first registration: if another device
+// already uses it, the registrar renames itself like the mDNS announcer.
+type Registrar struct {
+	server     string
+	key        *TSIGKey
+	ttl        uint32
+	record     ServiceRecord
+	base       string // configured instance name, before renaming
+	suffix     string // preferred rename suffix, e.g. from the serial number
+	renames    int    // number of renames so far
+	registered bool   // the records are in the zone
+	stopped    bool   // deregistered; no further updates
+	logger     *logging.Logger
+	mu         sync.Mutex // serializes updates
+}
+
+// NewRegistrar creates a registrar that sends updates to a DNS server
+// ("host" or "host:port", port 53 by default). The record's Domain is the
+// zone to register in, e.g. "prov.example.com". The key may be nil for
+// servers that accept unsigned updates.
+func NewRegistrar(server string, record ServiceRecord, key *TSIGKey, ttl time.Duration,
+	logger *logging.Logger) *Registrar {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	record.Domain = strings.TrimSuffix(record.Domain, ".")
+	record.Addrs = routableIPs(record.Addrs)
+
+	return &Registrar{
+		server: server,
+		key:    key,
+		ttl:    uint32(ttl.Seconds()), // #nosec G115 - TTL is validated to be positive
+		record: record,
+		base:   record.Instance,
+		logger: logger,
+	}
+}
+
+// SetConflictSuffix sets the suffix appended to the instance name when it
+// is already registered by another device, as for Announcer.
+func (r *Registrar) SetConflictSuffix(suffix string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.suffix = suffix
+}
+
+// Instance returns the registered instance name, which differs from the
+// configured one after a conflict.
+func (r *Registrar) Instance() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record.Instance
+}
+
+// Register adds the service records to the zone, or replaces them if they
+// were registered before.
+func (r *Registrar) Register(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.register(ctx)
+}
+
+// SetAddresses replaces the registered addresses. Link-local and loopback
+// addresses are not registered, as they are meaningless in a unicast zone.
+// If the records are not registered yet, e.g. because the server was
+// unreachable, it registers them.
+func (r *Registrar) SetAddresses(ctx context.Context, ips []net.IP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ips = routableIPs(ips)
+	if r.registered && sameIPs(r.record.Addrs, ips) {
+		return nil
+	}
+	r.record.Addrs = ips
+	return r.register(ctx)
+}
+
+// SetTXT sets a TXT record key, updating the zone if the value changed.
+func (r *Registrar) SetTXT(ctx context.Context, key, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, ok := r.record.TXT[key]; ok && current == value {
+		return nil
+	}
+	txt := maps.Clone(r.record.TXT)
+	if txt == nil {
+		txt = make(map[string]string)
+	}
+	txt[key] = value
+	r.record.TXT = txt
+
+	if !r.registered {
+		return nil
+	}
+	return r.register(ctx)
+}
+
+// Deregister removes the service records from the zone. No further updates
+// are sent afterwards.
+func (r *Registrar) Deregister(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopped = true
+	if !r.registered {
+		return nil
+	}
+
+	ptr, _ := r.record.records(r.ttl, nil, ClassIN)
+	msg := r.updateMessage()
+	msg.Authority = []ResourceRecord{
+		{Name: ptr.Name, Type: TypePTR, Class: ClassNONE, Data: ptr.Data},
+		{Name: r.record.fqInstanceName(), Type: TypeANY, Class: ClassANY},
+		{Name: r.record.fqHostName(), Type: TypeANY, Class: ClassANY},
+	}
+	if err := r.update(ctx, msg); err != nil {
+		return err
+	}
+
+	r.registered = false
+	r.logger.Info("DNS-SD records removed", map[string]any{
+		"server":   r.server,
+		"instance": r.record.Instance,
+	})
+	return nil
+}
+
+// register claims the instance name with a prerequisite that it is unused,
+// renaming on conflicts, or replaces the records once the name is ours.
+func (r *Registrar) register(ctx context.Context) error {
+	if r.stopped {
+		return nil
+	}
+
+	for {
+		ptr, unique := r.record.records(r.ttl, r.record.Addrs, ClassIN)
+		instName := r.record.fqInstanceName()
+		hostName := r.record.fqHostName()
+
+		msg := r.updateMessage()
+		if r.registered {
+			// Delete the previous records of our names before adding the new ones
+			msg.Authority = []ResourceRecord{
+				{Name: instName, Type: TypeANY, Class: ClassANY},
+				{Name: hostName, Type: TypeANY, Class: ClassANY},
+			}
+		} else {
+			// The prerequisite section travels in the answer section
+			msg.Answers = []ResourceRecord{
+				{Name: instName, Type: TypeANY, Class: ClassNONE},
+				{Name: hostName, Type: TypeANY, Class: ClassNONE},
+			}
+		}
+		msg.Authority = append(msg.Authority, ptr)
+		msg.Authority = append(msg.Authority, unique...)
+
+		err := r.update(ctx, msg)
+		var rerr rcodeError
+		if errors.As(err, &rerr) && rerr == rcodeError(rcodeYXDomain) && !r.registered {
+			if r.renames >= conflictLimit {
+				return fmt.Errorf("DNS-SD instance name %q in use: %w", r.record.Instance, err)
+			}
+			r.rename()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !r.registered {
+			r.logger.Info("DNS-SD records registered", map[string]any{
+				"server":   r.server,
+				"instance": r.record.Instance,
+			})
+		}
+		r.registered = true
+		return nil
+	}
+}
+
+func (r *Registrar) rename() {
+	previous := r.record.Instance
+	r.renames++
+	r.record.Instance = nextInstanceName(r.base, r.suffix, r.renames)
+
+	r.logger.Warn("DNS-SD name conflict, renaming", map[string]any{
+		"previous": previous,
+		"instance": r.record.Instance,
+	})
+}
+
+// updateMessage returns an empty update for the zone.
+func (r *Registrar) updateMessage() *Message {
+	return &Message{
+		Header:    Header{Flags: opcodeUpdate},
+		Questions: []Question{{Name: r.record.Domain + ".", Type: TypeSOA, Class: ClassIN}},
+	}
+}
+
+// update sends an update to the server and waits for its response.
+func (r *Registrar) update(ctx context.Context, msg *Message) error {
+	msg.Header.ID = uint16(rand.N(1 << 16)) // #nosec G404 G115 - transaction ID, not a secret
+
+	var data, mac []byte
+	var err error
+	if r.key != nil {
+		data, mac, err = r.key.sign(msg, nil, time.Now())
+	} else {
+		data, err = PackMessage(msg)
+	}
+	if err != nil {
+		return fmt.Errorf("packing update: %w", err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", r.server)
+	if err != nil {
+		return fmt.Errorf("connecting to DNS server: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	deadline := time.Now().Add(updateTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("setting deadline: %w", err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		return fmt.Errorf("sending update: %w", err)
+	}
+
+	buf := make([]byte, 65536)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return fmt.Errorf("waiting for update response: %w", err)
+		}
+		resp, err := UnpackMessage(buf[:n])
+		if err != nil || resp.Header.ID != msg.Header.ID || resp.Header.Flags&flagQR == 0 {
+			continue // not a response to our update
+		}
+		rcode := resp.Header.Flags & rcodeMask
+
+		if r.key != nil {
+			_, err := r.key.verify(buf[:n], mac, time.Now())
+			switch {
+			case errors.Is(err, errNoTSIG) && rcode != rcodeNoError:
+				// Servers may refuse without signing, e.g. for an unknown zone
+			case err != nil:
+				return fmt.Errorf("verifying update response: %w", err)
+			}
+		}
+		if rcode != rcodeNoError {
+			return rcodeError(rcode)
+		}
+		return nil
+	}
+}
+
+// rcodeError is a DNS response code other than NOERROR.
+type rcodeError uint16
+
+func (e rcodeError) Error() string {
+	return "DNS update failed: " + rcodeName(uint16(e))
+}
+
+func rcodeName(rcode uint16) string {
+	names := map[uint16]string{
+		0: "NOERROR", 1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+		6: "YXDOMAIN", 7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE",
+	}
+	if name, ok := names[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// routableIPs returns the addresses worth publishing in a unicast zone.
+func routableIPs(ips []net.IP) []net.IP {
+	var routable []net.IP
+	for _, ip := range ips {
+		ip = normalizeIP(ip)
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || slices.ContainsFunc(routable, ip.Equal) {
+			continue
+		}
+		routable = append(routable, ip)
+	}
+	return routable
+}
@@ -0,0 +1,286 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fzdarsky/boardingpass/internal/logging"
+)
+
+// testDNSServer is an in-process authoritative server for one zone that
+// applies dynamic updates (RFC 2136 Section 3) and checks their signatures.
+type testDNSServer struct {
+	conn    *net.UDPConn
+	zone    string
+	key     *TSIGKey // required signature, or nil
+	mu      sync.Mutex
+	records []ResourceRecord
+	updates int
+}
+
+func newTestDNSServer(t *testing.T, zone string, key *TSIGKey) *testDNSServer {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	s := &testDNSServer{conn: conn, zone: zone + ".", key: key}
+	t.Cleanup(func() { _ = conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *testDNSServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *testDNSServer) serve() {
+	buf := make([]byte, 65536)
+	for {
+		n, src, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.handle(buf[:n]); resp != nil {
+			_, _ = s.conn.WriteToUDP(resp, src)
+		}
+	}
+}
+
+func (s *testDNSServer) handle(data []byte) []byte {
+	req, err := UnpackMessage(data)
+	if err != nil {
+		return nil
+	}
+	resp := &Message{
+		Header:    Header{ID: req.Header.ID, Flags: flagQR | opcodeUpdate},
+		Questions: req.Questions,
+	}
+
+	var mac []byte
+	if s.key != nil {
+		if mac, err = s.key.verify(data, nil, time.Now()); err != nil {
+			// Unsigned NOTAUTH response carrying the TSIG error
+			resp.Header.Flags |= 9
+			t := &tsigRecord{algorithm: s.key.algorithmName(), timeSigned: uint64(time.Now().Unix()),
+				fudge: tsigFudge, originalID: req.Header.ID, err: tsigBadSig}
+			rdata, _ := t.pack()
+			resp.Additional = []ResourceRecord{{Name: s.key.Name, Type: TypeTSIG, Class: ClassANY, Data: rdata}}
+			packed, _ := PackMessage(resp)
+			return packed
+		}
+		req.Additional = req.Additional[:len(req.Additional)-1]
+	}
+
+	resp.Header.Flags |= s.apply(req)
+	if s.key != nil {
+		packed, _, _ := s.key.sign(resp, mac, time.Now())
+		return packed
+	}
+	packed, _ := PackMessage(resp)
+	return packed
+}
+
+// apply checks the prerequisites and applies the update section.
+func (s *testDNSServer) apply(req *Message) uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(req.Questions) != 1 || !strings.EqualFold(req.Questions[0].Name, s.zone) ||
+		req.Questions[0].Type != TypeSOA {
+		return 10 // NOTZONE
+	}
+	for _, rr := range req.Answers {
+		if rr.Class == ClassNONE && rr.Type == TypeANY &&
+			slices.ContainsFunc(s.records, func(r ResourceRecord) bool { return strings.EqualFold(r.Name, rr.Name) }) {
+			return rcodeYXDomain
+		}
+	}
+
+	s.updates++
+	for _, rr := range req.Authority {
+		switch rr.Class {
+		case ClassANY:
+			s.records = slices.DeleteFunc(s.records, func(r ResourceRecord) bool {
+				return strings.EqualFold(r.Name, rr.Name) && (rr.Type == TypeANY || r.Type == rr.Type)
+			})
+		case ClassNONE:
+			s.records = slices.DeleteFunc(s.records, func(r ResourceRecord) bool { return sameRecord(r, rr) })
+		default:
+			if !slices.ContainsFunc(s.records, func(r ResourceRecord) bool { return sameRecord(r, rr) }) {
+				s.records = append(s.records, rr)
+			}
+		}
+	}
+	return rcodeNoError
+}
+
+func (s *testDNSServer) zoneRecords() []ResourceRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.records)
+}
+
+func (s *testDNSServer) updateCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updates
+}
+
+func (s *testDNSServer) addRecord(rr ResourceRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rr)
+}
+
+func testKey() *TSIGKey {
+	return &TSIGKey{Name: "boardingpass", Algorithm: TSIGHMACSHA256, Secret: []byte("0123456789abcdef0123456789abcdef")}
+}
+
+func testRegistrar(server string, key *TSIGKey) *Registrar {
+	return NewRegistrar(server, ServiceRecord{
+		Instance: "BoardingPass-test",
+		Service:  "_boardingpass._tcp",
+		Domain:   "prov.example.com",
+		Port:     9455,
+		TXT:      map[string]string{TXTState: StateUnprovisioned},
+		Addrs:    []net.IP{net.ParseIP("192.0.2.10"), net.ParseIP("fe80::1")},
+	}, key, 2*time.Minute, logging.New(logging.LevelError, logging.FormatJSON))
+}
+
+func recordsOfType(records []ResourceRecord, name string, rrType uint16) []ResourceRecord {
+	return slices.DeleteFunc(recordsNamed(records, name), func(rr ResourceRecord) bool { return rr.Type != rrType })
+}
+
+func TestRegistrar_RegisterAndDeregister(t *testing.T) {
+	server := newTestDNSServer(t, "prov.example.com", testKey())
+	r := testRegistrar(server.addr(), testKey())
+	ctx := context.Background()
+
+	require.NoError(t, r.Register(ctx))
+
+	records := server.zoneRecords()
+	ptrs := recordsOfType(records, "_boardingpass._tcp.prov.example.com.", TypePTR)
+	require.Len(t, ptrs, 1)
+	target, err := ParsePTRRecord(ptrs[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, "BoardingPass-test._boardingpass._tcp.prov.example.com.", target)
+	assert.Equal(t, uint32(120), ptrs[0].TTL)
+
+	srvs := recordsOfType(records, target, TypeSRV)
+	require.Len(t, srvs, 1)
+	port, host, err := ParseSRVRecord(srvs[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(9455), port)
+	assert.Equal(t, "BoardingPass-test.prov.example.com.", host)
+
+	txts := recordsOfType(records, target, TypeTXT)
+	require.Len(t, txts, 1)
+	assert.Equal(t, StateUnprovisioned, ParseTXTRecord(txts[0].Data)[TXTState])
+
+	// Link-local addresses are not published
+	assert.Len(t, recordsOfType(records, host, TypeA), 1)
+	assert.Empty(t, recordsOfType(records, host, TypeAAAA))
+
+	require.NoError(t, r.Deregister(ctx))
+	assert.Empty(t, server.zoneRecords())
+
+	// No updates after deregistration
+	require.NoError(t, r.SetAddresses(ctx, []net.IP{net.ParseIP("192.0.2.11")}))
+	assert.Empty(t, server.zoneRecords())
+}
+
+func TestRegistrar_Updates(t *testing.T) {
+	server := newTestDNSServer(t, "prov.example.com", testKey())
+	r := testRegistrar(server.addr(), testKey())
+	ctx := context.Background()
+	require.NoError(t, r.Register(ctx))
+	host := "BoardingPass-test.prov.example.com."
+
+	require.NoError(t, r.SetAddresses(ctx, []net.IP{net.ParseIP("192.0.2.20"), net.ParseIP("2001:db8::20")}))
+	records := server.zoneRecords()
+	a := recordsOfType(records, host, TypeA)
+	require.Len(t, a, 1)
+	assert.Equal(t, []byte{192, 0, 2, 20}, a[0].Data)
+	assert.Len(t, recordsOfType(records, host, TypeAAAA), 1)
+	assert.Len(t, recordsOfType(records, "_boardingpass._tcp.prov.example.com.", TypePTR), 1)
+
+	// Unchanged addresses do not trigger an update
+	updates := server.updateCount()
+	require.NoError(t, r.SetAddresses(ctx, []net.IP{net.ParseIP("2001:db8::20"), net.ParseIP("192.0.2.20")}))
+	assert.Equal(t, updates, server.updateCount())
+
+	require.NoError(t, r.SetTXT(ctx, TXTState, StateConfigured))
+	txts := recordsOfType(server.zoneRecords(), "BoardingPass-test._boardingpass._tcp.prov.example.com.", TypeTXT)
+	require.Len(t, txts, 1)
+	assert.Equal(t, StateConfigured, ParseTXTRecord(txts[0].Data)[TXTState])
+}
+
+func TestRegistrar_NameConflict(t *testing.T) {
+	server := newTestDNSServer(t, "prov.example.com", nil)
+	server.addRecord(ResourceRecord{
+		Name: "BoardingPass-test.prov.example.com.", Type: TypeA, Class: ClassIN, TTL: 120, Data: []byte{192, 0, 2, 99},
+	})
+	r := testRegistrar(server.addr(), nil)
+	r.SetConflictSuffix("SN1234")
+
+	require.NoError(t, r.Register(context.Background()))
+	assert.Equal(t, "BoardingPass-test-SN1234", r.Instance())
+
+	// The other device's record is untouched
+	records := server.zoneRecords()
+	assert.Len(t, recordsOfType(records, "BoardingPass-test.prov.example.com.", TypeA), 1)
+	assert.Len(t, recordsOfType(records, "BoardingPass-test-SN1234.prov.example.com.", TypeA), 1)
+}
+
+func TestRegistrar_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("wrong key", func(t *testing.T) {
+		server := newTestDNSServer(t, "prov.example.com", testKey())
+		key := testKey()
+		key.Secret = []byte("wrong")
+		err := testRegistrar(server.addr(), key).Register(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "BADSIG")
+		assert.Empty(t, server.zoneRecords())
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		server := newTestDNSServer(t, "prov.example.com", testKey())
+		err := testRegistrar(server.addr(), nil).Register(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "NOTAUTH")
+	})
+
+	t.Run("wrong zone", func(t *testing.T) {
+		server := newTestDNSServer(t, "other.example.com", nil)
+		err := testRegistrar(server.addr(), nil).Register(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "NOTZONE")
+	})
+
+	t.Run("no response", func(t *testing.T) {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		err = testRegistrar(conn.LocalAddr().String(), nil).Register(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "waiting for update response")
+	})
+}
+
+func TestNewRegistrar_DefaultPort(t *testing.T) {
+	assert.Equal(t, "192.0.2.53:53", testRegistrar("192.0.2.53", nil).server)
+	assert.Equal(t, "[2001:db8::53]:53", testRegistrar("2001:db8::53", nil).server)
+	assert.Equal(t, "ns.example.com:5353", testRegistrar("ns.example.com:5353", nil).server)
+}
@@ -0,0 +1,112 @@
+// Package mux multiplexes independent byte streams over a single connection,
+// such as a serial line. Each stream is a net.Conn, so TLS and HTTP run over
+// streams unchanged, and a Session doubles as a net.Listener for the side
+// that accepts streams.
+//
+// Frames have a 13-byte header, a payload of up to MaxPayload bytes and a
+// CRC-32 trailer:
+//
+//	bytes 0-1    magic (0xB5 0x9A)
+//	byte 2       frame type
+//	bytes 3-6    stream ID, big-endian (odd: opened by the client side)
+//	bytes 7-8    per-stream frame sequence number, big-endian
+//	bytes 9-10   payload length, big-endian
+//	bytes 11-12  low 16 bits of the CRC-32 of bytes 0-10
+//	...          payload
+//	last 4       CRC-32 of the payload, big-endian
+//
+// Frames that fail a checksum are skipped and the reader resynchronizes on
+// the next magic sequence, so stray console output on a line does not end the
+// session. A gap in a stream's sequence numbers resets that stream.
+package mux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// Frame types.
+const (
+	typeOpen   byte = 1 // open a stream
+	typeData   byte = 2 // stream data
+	typeWindow byte = 3 // grant the peer more send window (uint32 payload)
+	typeClose  byte = 4 // sender will send no more data on the stream
+	typeReset  byte = 5 // abort the stream
+	typePing   byte = 6 // liveness check on stream 0, echoed as typePong
+	typePong   byte = 7
+)
+
+const (
+	magic0      byte = 0xB5
+	magic1      byte = 0x9A
+	headerSize       = 13
+	trailerSize      = 4
+
+	// MaxPayload is the largest payload carried by a single frame.
+	MaxPayload = 4096
+
+	maxFrameSize = headerSize + MaxPayload + trailerSize
+)
+
+type frame struct {
+	typ     byte
+	stream  uint32
+	seq     uint16
+	payload []byte
+}
+
+// marshal encodes a frame including header and payload checksums.
+func (f *frame) marshal() []byte {
+	buf := make([]byte, headerSize, headerSize+len(f.payload)+trailerSize)
+	buf[0] = magic0
+	buf[1] = magic1
+	buf[2] = f.typ
+	binary.BigEndian.PutUint32(buf[3:], f.stream)
+	binary.BigEndian.PutUint16(buf[7:], f.seq)
+	binary.BigEndian.PutUint16(buf[9:], uint16(len(f.payload))) // #nosec G115 - bounded by MaxPayload
+	binary.BigEndian.PutUint16(buf[11:], uint16(crc32.ChecksumIEEE(buf[:11])))
+	buf = append(buf, f.payload...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(f.payload))
+}
+
+// readFrame reads the next valid frame, skipping bytes that do not start one.
+// It only returns an error when the underlying reader fails.
+func readFrame(r *bufio.Reader) (*frame, error) {
+	for {
+		b, err := r.Peek(headerSize)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != magic0 || b[1] != magic1 ||
+			binary.BigEndian.Uint16(b[11:]) != uint16(crc32.ChecksumIEEE(b[:11])) {
+			_, _ = r.Discard(1)
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(b[9:]))
+		if length > MaxPayload {
+			_, _ = r.Discard(1)
+			continue
+		}
+
+		b, err = r.Peek(headerSize + length + trailerSize)
+		if err != nil {
+			return nil, err
+		}
+		payload := b[headerSize : headerSize+length]
+		if binary.BigEndian.Uint32(b[headerSize+length:]) != crc32.ChecksumIEEE(payload) {
+			_, _ = r.Discard(1)
+			continue
+		}
+
+		f := &frame{
+			typ:     b[2],
+			stream:  binary.BigEndian.Uint32(b[3:]),
+			seq:     binary.BigEndian.Uint16(b[7:]),
+			payload: append([]byte(nil), payload...),
+		}
+		_, _ = r.Discard(len(b))
+		return f, nil
+	}
+}
@@ -0,0 +1,329 @@
+package mux
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pair connects a client and server session over an in-memory link.
+func pair(t *testing.T) (*Session, *Session) {
+	t.Helper()
+	a, b := net.Pipe()
+	client := Client(a, Addr{Net: "test", Name: "client"})
+	server := Server(b, Addr{Net: "test", Name: "server"})
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+func echoServer(t *testing.T, server *Session) {
+	t.Helper()
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+}
+
+func TestFrame_RoundTrip(t *testing.T) {
+	f := frame{typ: typeData, stream: 7, seq: 300, payload: []byte("hello")}
+	got, err := readFrame(bufio.NewReader(bytes.NewReader(f.marshal())))
+	require.NoError(t, err)
+	assert.Equal(t, f, *got)
+}
+
+func TestFrame_Resync(t *testing.T) {
+	good := frame{typ: typeData, stream: 1, seq: 1, payload: []byte("payload")}
+	corrupt := good.marshal()
+	corrupt[len(corrupt)-6] ^= 0xff // flip a payload byte
+
+	var stream []byte
+	stream = append(stream, "login: \xb5\x9a garbage\r\n"...)
+	stream = append(stream, corrupt...)
+	stream = append(stream, magic0, magic1, 0, 0)
+	stream = append(stream, good.marshal()...)
+
+	r := bufio.NewReader(bytes.NewReader(stream))
+	got, err := readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, good, *got)
+
+	_, err = readFrame(r)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestSession_OpenAccept(t *testing.T) {
+	client, server := pair(t)
+	echoServer(t, server)
+
+	conn, err := client.Open(context.Background())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	assert.Equal(t, "client:1", conn.RemoteAddr().String())
+	assert.Equal(t, "test", conn.RemoteAddr().Network())
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestSession_ConcurrentStreams(t *testing.T) {
+	client, server := pair(t)
+	echoServer(t, server)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := client.Open(context.Background())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+
+			want := bytes.Repeat([]byte(fmt.Sprintf("stream-%d|", i)), 2000)
+			go func() { _, _ = conn.Write(want) }()
+			got := make([]byte, len(want))
+			_, err = io.ReadFull(conn, got)
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSession_FlowControl(t *testing.T) {
+	client, server := pair(t)
+
+	// Send more than the initial window to a reader that only starts later
+	data := make([]byte, 3*initialWindow)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	conn, err := client.Open(context.Background())
+	require.NoError(t, err)
+
+	writeDone := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(data)
+		if err == nil {
+			err = conn.Close()
+		}
+		writeDone <- err
+	}()
+
+	accepted, err := server.Accept()
+	require.NoError(t, err)
+
+	select {
+	case <-writeDone:
+		t.Fatal("write completed before the receiver granted more window")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	got, err := io.ReadAll(accepted)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	require.NoError(t, <-writeDone)
+}
+
+func TestStream_CloseSendsEOF(t *testing.T) {
+	client, server := pair(t)
+
+	conn, err := client.Open(context.Background())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("last words"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	accepted, err := server.Accept()
+	require.NoError(t, err)
+	got, err := io.ReadAll(accepted)
+	require.NoError(t, err)
+	assert.Equal(t, "last words", string(got))
+
+	_, err = conn.Write([]byte("x"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestStream_ReadDeadline(t *testing.T) {
+	client, server := pair(t)
+	echoServer(t, server)
+
+	conn, err := client.Open(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// Clearing the deadline makes the stream usable again
+	require.NoError(t, conn.SetReadDeadline(time.Time{}))
+	_, err = conn.Write([]byte("a"))
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(buf))
+}
+
+func TestSession_CloseResetsStreams(t *testing.T) {
+	client, server := pair(t)
+
+	conn, err := client.Open(context.Background())
+	require.NoError(t, err)
+	_, err = server.Accept()
+	require.NoError(t, err)
+
+	require.NoError(t, server.Close())
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrSessionClosed)
+
+	_, err = server.Accept()
+	assert.ErrorIs(t, err, ErrSessionClosed)
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client session did not end")
+	}
+	_, err = client.Open(context.Background())
+	assert.Error(t, err)
+}
+
+func TestSession_Ping(t *testing.T) {
+	client, server := pair(t)
+
+	rtt, err := client.Ping(context.Background())
+	require.NoError(t, err)
+	assert.Positive(t, rtt)
+
+	_, err = server.Ping(context.Background())
+	require.NoError(t, err)
+}
+
+func TestSession_RejectsWrongParity(t *testing.T) {
+	a, b := net.Pipe()
+	server := Server(b, Addr{Net: "test", Name: "server"})
+	t.Cleanup(func() { _ = server.Close() })
+
+	go func() {
+		// Even stream IDs belong to the server
+		f := frame{typ: typeOpen, stream: 2}
+		_, _ = a.Write(f.marshal())
+	}()
+
+	got, err := readFrame(bufio.NewReader(a))
+	require.NoError(t, err)
+	assert.Equal(t, typeReset, got.typ)
+	assert.Equal(t, uint32(2), got.stream)
+}
+
+// lossyConn drops the first data frame written after drop is set.
+type lossyConn struct {
+	net.Conn
+	mu   sync.Mutex
+	drop bool
+}
+
+func (c *lossyConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.drop && len(b) > 2 && b[2] == typeData {
+		c.drop = false
+		c.mu.Unlock()
+		return len(b), nil
+	}
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+func TestSession_LostFrameResetsStream(t *testing.T) {
+	a, b := net.Pipe()
+	link := &lossyConn{Conn: a}
+	client := Client(link, Addr{Net: "test", Name: "client"})
+	server := Server(b, Addr{Net: "test", Name: "server"})
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	conn, err := client.Open(context.Background())
+	require.NoError(t, err)
+	accepted, err := server.Accept()
+	require.NoError(t, err)
+
+	link.mu.Lock()
+	link.drop = true
+	link.mu.Unlock()
+	_, err = conn.Write([]byte("lost"))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("found"))
+	require.NoError(t, err)
+
+	_, err = accepted.Read(make([]byte, 16))
+	assert.True(t, errors.Is(err, ErrStreamReset), "unexpected error: %v", err)
+
+	// The peer's reset reaches the sender too
+	require.Eventually(t, func() bool {
+		_, err := conn.Write([]byte("x"))
+		return errors.Is(err, ErrStreamReset)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSession_ReopenedStreamReplacesStale(t *testing.T) {
+	a, b := net.Pipe()
+	server := Server(b, Addr{Net: "test", Name: "server"})
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = a.Close()
+	})
+
+	// Drain frames the server sends back
+	go func() { _, _ = io.Copy(io.Discard, a) }()
+
+	open := frame{typ: typeOpen, stream: 1}
+	_, err := a.Write(open.marshal())
+	require.NoError(t, err)
+	stale, err := server.Accept()
+	require.NoError(t, err)
+
+	// A restarted client reuses stream ID 1
+	_, err = a.Write(open.marshal())
+	require.NoError(t, err)
+	fresh, err := server.Accept()
+	require.NoError(t, err)
+	assert.NotSame(t, stale, fresh)
+
+	_, err = stale.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrStreamReset)
+}
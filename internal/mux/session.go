@@ -0,0 +1,355 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// initialWindow is the number of bytes either side may send on a stream
+	// before the receiver grants more.
+	initialWindow = 256 * 1024
+
+	// acceptBacklog bounds streams opened by the peer but not yet accepted.
+	acceptBacklog = 16
+)
+
+// Errors returned by sessions and streams.
+var (
+	ErrSessionClosed = errors.New("mux: session closed")
+	ErrStreamReset   = errors.New("mux: stream reset by peer")
+	ErrStreamsFull   = errors.New("mux: stream IDs exhausted")
+)
+
+// Addr names the link a session runs over, e.g. a serial device.
+type Addr struct {
+	Net  string
+	Name string
+}
+
+// Network returns the link type.
+func (a Addr) Network() string { return a.Net }
+
+// String returns the link name.
+func (a Addr) String() string { return a.Name }
+
+// Session multiplexes streams over a connection. It implements net.Listener;
+// Accept returns streams opened by the peer.
+type Session struct {
+	conn io.ReadWriteCloser
+	addr Addr
+
+	writeMu sync.Mutex // serializes frames on conn and guards stream send sequence numbers
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	pings   map[uint64]chan struct{}
+	pingID  uint64
+	err     error
+
+	accept    chan *Stream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Client starts the session for the side that opens streams, e.g. the CLI.
+func Client(conn io.ReadWriteCloser, addr Addr) *Session {
+	return newSession(conn, addr, 1)
+}
+
+// Server starts the session for the side that accepts streams, e.g. the service.
+func Server(conn io.ReadWriteCloser, addr Addr) *Session {
+	return newSession(conn, addr, 2)
+}
+
+func newSession(conn io.ReadWriteCloser, addr Addr, firstID uint32) *Session {
+	s := &Session{
+		conn:    conn,
+		addr:    addr,
+		streams: make(map[uint32]*Stream),
+		nextID:  firstID,
+		pings:   make(map[uint64]chan struct{}),
+		accept:  make(chan *Stream, acceptBacklog),
+		done:    make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+// Open opens a new stream to the peer.
+func (s *Session) Open(ctx context.Context) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	id := s.nextID
+	if id > ^uint32(0)-2 {
+		s.mu.Unlock()
+		return nil, ErrStreamsFull
+	}
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(st, typeOpen, nil); err != nil {
+		s.remove(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for the next stream opened by the peer.
+func (s *Session) Accept() (net.Conn, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.done:
+		return nil, s.closeErr()
+	}
+}
+
+// Addr returns the link address.
+func (s *Session) Addr() net.Addr {
+	return s.addr
+}
+
+// Done is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason the session ended, or nil while it is running.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the session, resetting all streams, and closes the connection.
+func (s *Session) Close() error {
+	s.shutdown(ErrSessionClosed)
+	return nil
+}
+
+// Ping sends a ping to the peer and returns the round-trip time.
+func (s *Session) Ping(ctx context.Context) (time.Duration, error) {
+	ch := make(chan struct{})
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return 0, s.err
+	}
+	s.pingID++
+	id := s.pingID
+	s.pings[id] = ch
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pings, id)
+		s.mu.Unlock()
+	}()
+
+	start := time.Now()
+	if err := s.writeFrame(nil, typePing, binary.BigEndian.AppendUint64(nil, id)); err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-s.done:
+		return 0, s.closeErr()
+	}
+}
+
+func (s *Session) closeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Session) shutdown(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.mu.Unlock()
+
+		close(s.done)
+		_ = s.conn.Close()
+		for _, st := range streams {
+			st.abort(err)
+		}
+	})
+}
+
+// writeFrame sends a frame. For stream frames it assigns the stream's next
+// sequence number, so sequence numbers match the order frames hit the wire.
+func (s *Session) writeFrame(st *Stream, typ byte, payload []byte) error {
+	f := frame{typ: typ, payload: payload}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if st != nil {
+		f.stream = st.id
+		f.seq = st.sendSeq
+		st.sendSeq++
+	}
+
+	select {
+	case <-s.done:
+		return s.closeErr()
+	default:
+	}
+
+	if _, err := s.conn.Write(f.marshal()); err != nil {
+		s.shutdown(fmt.Errorf("mux: write failed: %w", err))
+		return s.closeErr()
+	}
+	return nil
+}
+
+// sendReset aborts a stream the peer refers to without it being known locally.
+func (s *Session) sendReset(id uint32) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	f := frame{typ: typeReset, stream: id}
+	_, _ = s.conn.Write(f.marshal())
+}
+
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+func (s *Session) readLoop() {
+	r := bufio.NewReaderSize(s.conn, 2*maxFrameSize)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrSessionClosed
+			}
+			s.shutdown(err)
+			return
+		}
+		s.handle(f)
+	}
+}
+
+func (s *Session) handle(f *frame) {
+	switch f.typ {
+	case typePing:
+		// Writes from the read loop run asynchronously, so two sessions
+		// writing to each other at once cannot deadlock on a synchronous link
+		go func() { _ = s.writeFrame(nil, typePong, f.payload) }()
+		return
+	case typePong:
+		if len(f.payload) == 8 {
+			s.mu.Lock()
+			if ch, ok := s.pings[binary.BigEndian.Uint64(f.payload)]; ok {
+				close(ch)
+				delete(s.pings, binary.BigEndian.Uint64(f.payload))
+			}
+			s.mu.Unlock()
+		}
+		return
+	case typeOpen:
+		s.handleOpen(f)
+		return
+	}
+
+	s.mu.Lock()
+	st := s.streams[f.stream]
+	s.mu.Unlock()
+
+	if st == nil {
+		if f.typ != typeReset {
+			go s.sendReset(f.stream)
+		}
+		return
+	}
+
+	if f.typ == typeReset {
+		s.remove(st.id)
+		st.abort(ErrStreamReset)
+		return
+	}
+
+	if !st.checkSeq(f.seq) {
+		// A frame on this stream was lost
+		s.remove(st.id)
+		st.abort(ErrStreamReset)
+		go s.sendReset(st.id)
+		return
+	}
+
+	switch f.typ {
+	case typeData:
+		if !st.receive(f.payload) {
+			s.remove(st.id)
+			go s.sendReset(st.id)
+		}
+	case typeWindow:
+		if len(f.payload) == 4 {
+			st.grant(binary.BigEndian.Uint32(f.payload))
+		}
+	case typeClose:
+		if st.remoteClose() {
+			s.remove(st.id)
+		}
+	}
+}
+
+func (s *Session) handleOpen(f *frame) {
+	// Streams opened by the peer have the opposite parity to ours
+	if f.stream%2 == s.nextID%2 || f.stream == 0 {
+		go s.sendReset(f.stream)
+		return
+	}
+
+	st := newStream(s, f.stream)
+	st.recvSeq = f.seq + 1
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	// A peer that restarted reuses stream IDs; the new stream replaces the stale one
+	old := s.streams[f.stream]
+	s.streams[f.stream] = st
+	s.mu.Unlock()
+
+	if old != nil {
+		old.abort(ErrStreamReset)
+	}
+
+	select {
+	case s.accept <- st:
+	default:
+		s.remove(st.id)
+		st.abort(ErrStreamReset)
+		go s.sendReset(st.id)
+	}
+}
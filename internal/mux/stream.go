@@ -0,0 +1,314 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stream is a bidirectional byte stream within a session. It implements net.Conn.
+type Stream struct {
+	session *Session
+	id      uint32
+	sendSeq uint16 // guarded by session.writeMu
+
+	mu           sync.Mutex
+	recvSeq      uint16
+	buf          bytes.Buffer
+	recvWindow   int // bytes the peer may still send
+	unacked      int // bytes read but not yet granted back to the peer
+	sendWindow   int // bytes we may still send
+	closed       bool
+	remoteClosed bool
+	err          error // set when the stream was reset or the session ended
+
+	readReady  chan struct{}
+	writeReady chan struct{}
+
+	readDeadline  *deadline
+	writeDeadline *deadline
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		session:       s,
+		id:            id,
+		recvWindow:    initialWindow,
+		sendWindow:    initialWindow,
+		readReady:     make(chan struct{}, 1),
+		writeReady:    make(chan struct{}, 1),
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+	}
+}
+
+// Read reads data sent by the peer.
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		switch {
+		case st.closed:
+			st.mu.Unlock()
+			return 0, net.ErrClosed
+		case st.buf.Len() > 0:
+			n, _ := st.buf.Read(b)
+			st.unacked += n
+			var grant int
+			if st.unacked >= initialWindow/2 {
+				grant = st.unacked
+				st.recvWindow += grant
+				st.unacked = 0
+			}
+			st.mu.Unlock()
+			if grant > 0 {
+				_ = st.session.writeFrame(st, typeWindow, binary.BigEndian.AppendUint32(nil, uint32(grant))) // #nosec G115 - bounded by initialWindow
+			}
+			return n, nil
+		case st.err != nil:
+			err := st.err
+			st.mu.Unlock()
+			return 0, err
+		case st.remoteClosed:
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		st.mu.Unlock()
+
+		select {
+		case <-st.readReady:
+		case <-st.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// Write sends data to the peer, blocking while the peer's receive window is full.
+func (st *Stream) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		st.mu.Lock()
+		switch {
+		case st.closed:
+			st.mu.Unlock()
+			return written, net.ErrClosed
+		case st.err != nil:
+			err := st.err
+			st.mu.Unlock()
+			return written, err
+		case st.sendWindow == 0:
+			st.mu.Unlock()
+			select {
+			case <-st.writeReady:
+			case <-st.writeDeadline.wait():
+				return written, os.ErrDeadlineExceeded
+			}
+			continue
+		}
+		n := min(len(b), MaxPayload, st.sendWindow)
+		st.sendWindow -= n
+		st.mu.Unlock()
+
+		select {
+		case <-st.writeDeadline.wait():
+			return written, os.ErrDeadlineExceeded
+		default:
+		}
+
+		if err := st.session.writeFrame(st, typeData, b[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// Close closes the stream. The peer reads EOF once it has consumed all data.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	failed := st.err != nil
+	remoteClosed := st.remoteClosed
+	st.mu.Unlock()
+	st.notify()
+
+	if failed {
+		return nil
+	}
+	err := st.session.writeFrame(st, typeClose, nil)
+	if remoteClosed {
+		st.session.remove(st.id)
+	}
+	return err
+}
+
+// LocalAddr returns the link address qualified with the stream ID.
+func (st *Stream) LocalAddr() net.Addr {
+	return st.addr()
+}
+
+// RemoteAddr returns the link address qualified with the stream ID.
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.addr()
+}
+
+func (st *Stream) addr() net.Addr {
+	a := st.session.addr
+	return Addr{Net: a.Net, Name: fmt.Sprintf("%s:%d", a.Name, st.id)}
+}
+
+// SetDeadline sets the read and write deadlines.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.readDeadline.set(t)
+	st.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline sets the read deadline.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.writeDeadline.set(t)
+	return nil
+}
+
+// checkSeq verifies and advances the receive sequence number.
+func (st *Stream) checkSeq(seq uint16) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if seq != st.recvSeq {
+		return false
+	}
+	st.recvSeq++
+	return true
+}
+
+// receive buffers data from the peer. It returns false if the stream must
+// be reset because it was closed locally or the peer overran its window.
+func (st *Stream) receive(data []byte) bool {
+	st.mu.Lock()
+	if st.closed || len(data) > st.recvWindow {
+		if st.err == nil {
+			st.err = ErrStreamReset
+		}
+		st.mu.Unlock()
+		st.notify()
+		return false
+	}
+	st.recvWindow -= len(data)
+	st.buf.Write(data)
+	st.mu.Unlock()
+	st.notify()
+	return true
+}
+
+// grant extends the send window.
+func (st *Stream) grant(n uint32) {
+	st.mu.Lock()
+	st.sendWindow += int(n)
+	st.mu.Unlock()
+	st.notify()
+}
+
+// remoteClose records that the peer sends no more data. It returns true when
+// both sides have closed and the stream can be forgotten.
+func (st *Stream) remoteClose() bool {
+	st.mu.Lock()
+	st.remoteClosed = true
+	closed := st.closed
+	st.mu.Unlock()
+	st.notify()
+	return closed
+}
+
+// abort fails pending and future reads and writes with err.
+func (st *Stream) abort(err error) {
+	st.mu.Lock()
+	if st.err == nil {
+		st.err = err
+	}
+	st.mu.Unlock()
+	st.notify()
+}
+
+func (st *Stream) notify() {
+	select {
+	case st.readReady <- struct{}{}:
+	default:
+	}
+	select {
+	case st.writeReady <- struct{}{}:
+	default:
+	}
+}
+
+// deadline is a resettable read or write deadline. wait returns a channel
+// that is closed once the deadline has passed.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{cancel: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // the timer fired; wait for it to close cancel
+	}
+	d.timer = nil
+
+	expired := isClosed(d.cancel)
+	if t.IsZero() {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !expired {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
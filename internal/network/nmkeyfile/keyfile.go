@@ -0,0 +1,288 @@
+// Package nmkeyfile renders and validates NetworkManager connection profiles
+// in keyfile format, as stored in /etc/NetworkManager/system-connections/.
+//
+// Keyfiles use GLib's key file syntax: [group] headers followed by
+// key=value lines, with '#' comments. Validate checks that syntax and the
+// settings NetworkManager would otherwise only reject when loading the
+// profile, so that a typo is reported before the file reaches the device.
+package nmkeyfile
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Keyfile is a parsed keyfile. Groups and their entries are kept in file
+// order.
+type Keyfile struct {
+	Groups []*Group
+}
+
+// Group is a [group] section of a keyfile.
+type Group struct {
+	Name    string
+	Line    int // 0 for groups not read from a file
+	Entries []Entry
+}
+
+// Entry is a key=value line. Value is unescaped.
+type Entry struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// Problem describes an error found in a keyfile.
+type Problem struct {
+	Line    int // 0 if the problem is not tied to a line
+	Group   string
+	Key     string
+	Message string
+}
+
+// String formats the problem as "line 12: ipv4.address1: message".
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", p.Line)
+	}
+	switch {
+	case p.Group != "" && p.Key != "":
+		b.WriteString(p.Group + "." + p.Key + ": ")
+	case p.Group != "":
+		b.WriteString("[" + p.Group + "]: ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ValidationError lists the problems found in a keyfile.
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Parse parses a keyfile. Syntax errors are returned as a *ValidationError.
+func Parse(data []byte) (*Keyfile, error) {
+	kf := &Keyfile{}
+	var problems []Problem
+	var group *Group
+
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		line = strings.TrimLeft(strings.TrimSuffix(line, "\r"), " \t")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			name, ok := strings.CutSuffix(strings.TrimRight(line, " \t"), "]")
+			name = name[1:]
+			if !ok || name == "" || strings.ContainsAny(name, "[]") {
+				problems = append(problems, Problem{Line: lineNo, Message: fmt.Sprintf("invalid group header %q", line)})
+				group = &Group{} // check the group's keys, but drop them
+				continue
+			}
+			if prev := kf.Group(name); prev != nil {
+				problems = append(problems, Problem{Line: lineNo, Group: name,
+					Message: fmt.Sprintf("duplicate group, first defined on line %d", prev.Line)})
+			}
+			group = &Group{Name: name, Line: lineNo}
+			kf.Groups = append(kf.Groups, group)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimRight(key, " \t")
+		if !ok || key == "" {
+			problems = append(problems, Problem{Line: lineNo, Message: fmt.Sprintf("expected [group] or key=value, got %q", line)})
+			continue
+		}
+		if strings.ContainsAny(key, " \t[]") {
+			problems = append(problems, Problem{Line: lineNo, Message: fmt.Sprintf("invalid key %q", key)})
+			continue
+		}
+		if group == nil {
+			problems = append(problems, Problem{Line: lineNo, Key: key, Message: "key outside of a group"})
+			continue
+		}
+		if _, dup := group.Get(key); dup {
+			problems = append(problems, Problem{Line: lineNo, Group: group.Name, Key: key, Message: "duplicate key"})
+			continue
+		}
+		unescaped, err := unescape(strings.TrimLeft(value, " \t"))
+		if err != nil {
+			problems = append(problems, Problem{Line: lineNo, Group: group.Name, Key: key, Message: err.Error()})
+			continue
+		}
+		group.Entries = append(group.Entries, Entry{Key: key, Value: unescaped, Line: lineNo})
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return kf, nil
+}
+
+// Group returns the named group, or nil.
+func (k *Keyfile) Group(name string) *Group {
+	for _, g := range k.Groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// Get returns the value of a key and whether it is set.
+func (k *Keyfile) Get(group, key string) (string, bool) {
+	g := k.Group(group)
+	if g == nil {
+		return "", false
+	}
+	return g.Get(key)
+}
+
+// AddGroup returns the named group, adding an empty one if needed.
+func (k *Keyfile) AddGroup(name string) *Group {
+	if g := k.Group(name); g != nil {
+		return g
+	}
+	g := &Group{Name: name}
+	k.Groups = append(k.Groups, g)
+	return g
+}
+
+// Set sets the value of a key, adding the group and key if needed.
+func (k *Keyfile) Set(group, key, value string) {
+	g := k.AddGroup(group)
+	for i := range g.Entries {
+		if g.Entries[i].Key == key {
+			g.Entries[i].Value = value
+			return
+		}
+	}
+	g.Entries = append(g.Entries, Entry{Key: key, Value: value})
+}
+
+// Get returns the value of a key in the group and whether it is set.
+func (g *Group) Get(key string) (string, bool) {
+	if e := g.entry(key); e != nil {
+		return e.Value, true
+	}
+	return "", false
+}
+
+func (g *Group) entry(key string) *Entry {
+	for i := range g.Entries {
+		if g.Entries[i].Key == key {
+			return &g.Entries[i]
+		}
+	}
+	return nil
+}
+
+// Bytes formats the keyfile, escaping values as needed.
+func (k *Keyfile) Bytes() []byte {
+	var b bytes.Buffer
+	for i, g := range k.Groups {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("[" + g.Name + "]\n")
+		for _, e := range g.Entries {
+			b.WriteString(e.Key + "=" + escape(e.Value) + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// unescape resolves the escape sequences of key file values. "\;" is kept,
+// as it escapes the separator of list values.
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("value ends with an incomplete escape sequence")
+		}
+		switch s[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		case ';':
+			b.WriteString(`\;`)
+		default:
+			return "", fmt.Errorf("invalid escape sequence \\%c", s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// escape is the inverse of unescape.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' && i == 0:
+			b.WriteString(`\s`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\\' && (i+1 == len(s) || s[i+1] != ';'):
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// splitList splits a list value at unescaped ';' separators, dropping the
+// trailing empty element of lists terminated by ';'.
+func splitList(s string) []string {
+	var items []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ';':
+			cur.WriteByte(';')
+			i++
+		case s[i] == ';':
+			items = append(items, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	if cur.Len() > 0 {
+		items = append(items, cur.String())
+	}
+	return items
+}
@@ -0,0 +1,87 @@
+package nmkeyfile_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/network/nmkeyfile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`# Generated by hand
+[connection]
+id=Wired\sconnection
+type = ethernet
+
+  [ipv4]
+method=manual
+address1=192.168.1.10/24
+dns=1.1.1.1;8.8.8.8;
+`)
+
+	kf, err := nmkeyfile.Parse(data)
+	require.NoError(t, err)
+	require.Len(t, kf.Groups, 2)
+
+	id, ok := kf.Get("connection", "id")
+	assert.True(t, ok)
+	assert.Equal(t, "Wired connection", id)
+
+	connType, _ := kf.Get("connection", "type")
+	assert.Equal(t, "ethernet", connType)
+
+	ipv4 := kf.Group("ipv4")
+	require.NotNil(t, ipv4)
+	assert.Equal(t, 6, ipv4.Line)
+	assert.Equal(t, "address1", ipv4.Entries[1].Key)
+	assert.Equal(t, 8, ipv4.Entries[1].Line)
+
+	_, ok = kf.Get("ipv6", "method")
+	assert.False(t, ok)
+}
+
+func TestParse_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		line    int
+		message string
+	}{
+		{"key outside group", "id=eth0\n", 1, "key outside of a group"},
+		{"unterminated group", "[connection\nid=eth0\n", 1, "invalid group header"},
+		{"missing equals", "[connection]\nid eth0\n", 2, "expected [group] or key=value"},
+		{"duplicate key", "[connection]\nid=a\nid=b\n", 3, "duplicate key"},
+		{"duplicate group", "[connection]\nid=a\n[connection]\n", 3, "duplicate group"},
+		{"invalid escape", "[connection]\nid=a\\qb\n", 2, "invalid escape sequence"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := nmkeyfile.Parse([]byte(tt.data))
+			var verr *nmkeyfile.ValidationError
+			require.True(t, errors.As(err, &verr), "expected ValidationError, got %v", err)
+			require.Len(t, verr.Problems, 1)
+			assert.Equal(t, tt.line, verr.Problems[0].Line)
+			assert.Contains(t, verr.Problems[0].Message, tt.message)
+		})
+	}
+}
+
+func TestKeyfile_Bytes(t *testing.T) {
+	kf := &nmkeyfile.Keyfile{}
+	kf.Set("connection", "id", " leading space")
+	kf.Set("connection", "type", "ethernet")
+	kf.AddGroup("ethernet")
+	kf.Set("ipv4", "dns-search", `a\;b;c;`)
+	kf.Set("connection", "type", "wifi")
+
+	expected := "[connection]\nid=\\sleading space\ntype=wifi\n\n[ethernet]\n\n[ipv4]\ndns-search=a\\;b;c;\n"
+	assert.Equal(t, expected, string(kf.Bytes()))
+
+	parsed, err := nmkeyfile.Parse(kf.Bytes())
+	require.NoError(t, err)
+	id, _ := parsed.Get("connection", "id")
+	assert.Equal(t, " leading space", id)
+}
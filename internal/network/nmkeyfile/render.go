@@ -0,0 +1,214 @@
+package nmkeyfile
+
+import (
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Connection types supported by Render.
+const (
+	TypeEthernet = "ethernet"
+	TypeWiFi     = "wifi"
+	TypeVLAN     = "vlan"
+	TypeBond     = "bond"
+	TypeBridge   = "bridge"
+)
+
+// Connection is a typed connection profile for Render.
+type Connection struct {
+	ID            string `json:"id"`
+	UUID          string `json:"uuid,omitempty"` // generated if empty
+	Type          string `json:"type"`
+	InterfaceName string `json:"interface_name,omitempty"`
+	Autoconnect   *bool  `json:"autoconnect,omitempty"`
+
+	// Controller and PortType make the connection a port of a bond or
+	// bridge, in which case IPv4 and IPv6 are ignored.
+	Controller string `json:"controller,omitempty"`
+	PortType   string `json:"port_type,omitempty"`
+
+	WiFi   *WiFiConfig   `json:"wifi,omitempty"`
+	VLAN   *VLANConfig   `json:"vlan,omitempty"`
+	Bond   *BondConfig   `json:"bond,omitempty"`
+	Bridge *BridgeConfig `json:"bridge,omitempty"`
+
+	IPv4 *IPConfig `json:"ipv4,omitempty"`
+	IPv6 *IPConfig `json:"ipv6,omitempty"`
+}
+
+// WiFiConfig holds the settings of a wifi connection. An empty PSK
+// configures an open network.
+type WiFiConfig struct {
+	SSID string `json:"ssid"`
+	Mode string `json:"mode,omitempty"` // infrastructure (default), ap, adhoc or mesh
+	PSK  string `json:"psk,omitempty"`
+}
+
+// VLANConfig holds the settings of a vlan connection.
+type VLANConfig struct {
+	Parent string `json:"parent"`
+	ID     int    `json:"id"`
+}
+
+// BondConfig holds the settings of a bond connection.
+type BondConfig struct {
+	Mode    string            `json:"mode,omitempty"`
+	Options map[string]string `json:"options,omitempty"` // e.g. "miimon": "100"
+}
+
+// BridgeConfig holds the settings of a bridge connection.
+type BridgeConfig struct {
+	STP *bool `json:"stp,omitempty"`
+}
+
+// IPConfig holds the IPv4 or IPv6 settings of a connection.
+type IPConfig struct {
+	// Method is "auto" (DHCP or SLAAC), "manual" or "disabled". If empty, it
+	// is "manual" when Addresses are given and "auto" otherwise.
+	Method    string   `json:"method,omitempty"`
+	Addresses []string `json:"addresses,omitempty"` // CIDR notation
+	Gateway   string   `json:"gateway,omitempty"`
+	DNS       []string `json:"dns,omitempty"`
+	DNSSearch []string `json:"dns_search,omitempty"`
+}
+
+// Render renders a connection as a keyfile. The result is checked with
+// Validate, so problems with the connection's values are returned as a
+// *ValidationError.
+func Render(c *Connection) ([]byte, error) {
+	if c.ID == "" {
+		return nil, fmt.Errorf("connection id is required")
+	}
+
+	kf := &Keyfile{}
+	kf.Set("connection", "id", c.ID)
+	id := c.UUID
+	if id == "" {
+		id = newUUID()
+	}
+	kf.Set("connection", "uuid", id)
+	kf.Set("connection", "type", c.Type)
+	if c.InterfaceName != "" {
+		kf.Set("connection", "interface-name", c.InterfaceName)
+	}
+	if c.Autoconnect != nil {
+		kf.Set("connection", "autoconnect", strconv.FormatBool(*c.Autoconnect))
+	}
+	if c.Controller != "" || c.PortType != "" {
+		kf.Set("connection", "controller", c.Controller)
+		kf.Set("connection", "port-type", c.PortType)
+	}
+
+	switch c.Type {
+	case TypeEthernet:
+		kf.AddGroup("ethernet")
+	case TypeWiFi:
+		if c.WiFi == nil {
+			return nil, fmt.Errorf("wifi settings are required for a %s connection", c.Type)
+		}
+		renderWiFi(kf, c.WiFi)
+	case TypeVLAN:
+		if c.VLAN == nil {
+			return nil, fmt.Errorf("vlan settings are required for a %s connection", c.Type)
+		}
+		kf.Set("vlan", "id", strconv.Itoa(c.VLAN.ID))
+		kf.Set("vlan", "parent", c.VLAN.Parent)
+	case TypeBond:
+		kf.Set("bond", "mode", "balance-rr")
+		if c.Bond != nil {
+			renderBond(kf, c.Bond)
+		}
+	case TypeBridge:
+		kf.AddGroup("bridge")
+		if c.Bridge != nil && c.Bridge.STP != nil {
+			kf.Set("bridge", "stp", strconv.FormatBool(*c.Bridge.STP))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported connection type %q", c.Type)
+	}
+
+	if c.Controller == "" {
+		renderIP(kf, "ipv4", c.IPv4)
+		renderIP(kf, "ipv6", c.IPv6)
+	}
+
+	data := kf.Bytes()
+	if err := Validate(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func renderWiFi(kf *Keyfile, w *WiFiConfig) {
+	// A ';' would make NetworkManager read the SSID as a list of bytes.
+	kf.Set("wifi", "ssid", strings.ReplaceAll(w.SSID, ";", `\;`))
+	mode := w.Mode
+	if mode == "" {
+		mode = "infrastructure"
+	}
+	kf.Set("wifi", "mode", mode)
+	if w.PSK != "" {
+		kf.Set("wifi-security", "key-mgmt", "wpa-psk")
+		kf.Set("wifi-security", "psk", w.PSK)
+	}
+}
+
+func renderBond(kf *Keyfile, b *BondConfig) {
+	if b.Mode != "" {
+		kf.Set("bond", "mode", b.Mode)
+	}
+	for _, key := range slices.Sorted(maps.Keys(b.Options)) {
+		kf.Set("bond", key, b.Options[key])
+	}
+}
+
+// renderIP renders the [ipv4] or [ipv6] group. A nil config renders
+// method=auto.
+func renderIP(kf *Keyfile, family string, ip *IPConfig) {
+	if ip == nil {
+		ip = &IPConfig{}
+	}
+	method := ip.Method
+	if method == "" {
+		method = "auto"
+		if len(ip.Addresses) > 0 {
+			method = "manual"
+		}
+	}
+	kf.Set(family, "method", method)
+	for i, addr := range ip.Addresses {
+		kf.Set(family, "address"+strconv.Itoa(i+1), addr)
+	}
+	if ip.Gateway != "" {
+		kf.Set(family, "gateway", ip.Gateway)
+	}
+	if len(ip.DNS) > 0 {
+		kf.Set(family, "dns", joinList(ip.DNS))
+	}
+	if len(ip.DNSSearch) > 0 {
+		kf.Set(family, "dns-search", joinList(ip.DNSSearch))
+	}
+}
+
+// joinList formats a list value the way NetworkManager writes it, with a
+// trailing separator.
+func joinList(items []string) string {
+	escaped := make([]string, len(items))
+	for i, item := range items {
+		escaped[i] = strings.ReplaceAll(item, ";", `\;`) + ";"
+	}
+	return strings.Join(escaped, "")
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,217 @@
+package nmkeyfile_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/network/nmkeyfile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	stp := false
+	tests := []struct {
+		name     string
+		conn     nmkeyfile.Connection
+		expected string
+	}{
+		{
+			name: "ethernet dhcp",
+			conn: nmkeyfile.Connection{ID: "eth0", UUID: "2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21", Type: nmkeyfile.TypeEthernet, InterfaceName: "eth0"},
+			expected: `[connection]
+id=eth0
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=ethernet
+interface-name=eth0
+
+[ethernet]
+
+[ipv4]
+method=auto
+
+[ipv6]
+method=auto
+`,
+		},
+		{
+			name: "ethernet static",
+			conn: nmkeyfile.Connection{
+				ID: "uplink", UUID: "2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21", Type: nmkeyfile.TypeEthernet,
+				IPv4: &nmkeyfile.IPConfig{
+					Addresses: []string{"192.168.1.10/24"},
+					Gateway:   "192.168.1.1",
+					DNS:       []string{"1.1.1.1", "9.9.9.9"},
+					DNSSearch: []string{"example.com"},
+				},
+				IPv6: &nmkeyfile.IPConfig{Method: "disabled"},
+			},
+			expected: `[connection]
+id=uplink
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=ethernet
+
+[ethernet]
+
+[ipv4]
+method=manual
+address1=192.168.1.10/24
+gateway=192.168.1.1
+dns=1.1.1.1;9.9.9.9;
+dns-search=example.com;
+
+[ipv6]
+method=disabled
+`,
+		},
+		{
+			name: "wifi",
+			conn: nmkeyfile.Connection{
+				ID: "office", UUID: "2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21", Type: nmkeyfile.TypeWiFi,
+				WiFi: &nmkeyfile.WiFiConfig{SSID: "Office;5G", PSK: "correct horse"},
+			},
+			expected: `[connection]
+id=office
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=wifi
+
+[wifi]
+ssid=Office\;5G
+mode=infrastructure
+
+[wifi-security]
+key-mgmt=wpa-psk
+psk=correct horse
+
+[ipv4]
+method=auto
+
+[ipv6]
+method=auto
+`,
+		},
+		{
+			name: "vlan",
+			conn: nmkeyfile.Connection{
+				ID: "vlan10", UUID: "2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21", Type: nmkeyfile.TypeVLAN,
+				VLAN: &nmkeyfile.VLANConfig{Parent: "eth0", ID: 10},
+				IPv6: &nmkeyfile.IPConfig{Method: "disabled"},
+			},
+			expected: `[connection]
+id=vlan10
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=vlan
+
+[vlan]
+id=10
+parent=eth0
+
+[ipv4]
+method=auto
+
+[ipv6]
+method=disabled
+`,
+		},
+		{
+			name: "bond",
+			conn: nmkeyfile.Connection{
+				ID: "bond0", UUID: "2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21", Type: nmkeyfile.TypeBond, InterfaceName: "bond0",
+				Bond: &nmkeyfile.BondConfig{Mode: "802.3ad", Options: map[string]string{"xmit_hash_policy": "layer3+4", "miimon": "100"}},
+			},
+			expected: `[connection]
+id=bond0
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=bond
+interface-name=bond0
+
+[bond]
+mode=802.3ad
+miimon=100
+xmit_hash_policy=layer3+4
+
+[ipv4]
+method=auto
+
+[ipv6]
+method=auto
+`,
+		},
+		{
+			name: "bridge port",
+			conn: nmkeyfile.Connection{
+				ID: "br0-eth1", UUID: "2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21", Type: nmkeyfile.TypeEthernet, InterfaceName: "eth1",
+				Controller: "br0", PortType: "bridge",
+				IPv4: &nmkeyfile.IPConfig{Addresses: []string{"10.0.0.1/24"}},
+			},
+			expected: `[connection]
+id=br0-eth1
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=ethernet
+interface-name=eth1
+controller=br0
+port-type=bridge
+
+[ethernet]
+`,
+		},
+		{
+			name: "bridge",
+			conn: nmkeyfile.Connection{
+				ID: "br0", UUID: "2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21", Type: nmkeyfile.TypeBridge, InterfaceName: "br0",
+				Bridge: &nmkeyfile.BridgeConfig{STP: &stp},
+			},
+			expected: `[connection]
+id=br0
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=bridge
+interface-name=br0
+
+[bridge]
+stp=false
+
+[ipv4]
+method=auto
+
+[ipv6]
+method=auto
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := nmkeyfile.Render(&tt.conn)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestRender_GeneratesUUID(t *testing.T) {
+	data, err := nmkeyfile.Render(&nmkeyfile.Connection{ID: "eth0", Type: nmkeyfile.TypeEthernet})
+	require.NoError(t, err)
+
+	kf, err := nmkeyfile.Parse(data)
+	require.NoError(t, err)
+	id, _ := kf.Get("connection", "uuid")
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+}
+
+func TestRender_Invalid(t *testing.T) {
+	_, err := nmkeyfile.Render(&nmkeyfile.Connection{ID: "x", Type: "team"})
+	assert.ErrorContains(t, err, `unsupported connection type "team"`)
+
+	_, err = nmkeyfile.Render(&nmkeyfile.Connection{ID: "x", Type: nmkeyfile.TypeWiFi})
+	assert.ErrorContains(t, err, "wifi settings are required")
+
+	_, err = nmkeyfile.Render(&nmkeyfile.Connection{
+		ID: "x", Type: nmkeyfile.TypeVLAN,
+		VLAN: &nmkeyfile.VLANConfig{Parent: "eth0", ID: 5000},
+		IPv4: &nmkeyfile.IPConfig{Addresses: []string{"192.168.1.10"}, Gateway: "fe80::1"},
+	})
+	var verr *nmkeyfile.ValidationError
+	require.True(t, errors.As(err, &verr), "expected ValidationError, got %v", err)
+	assert.Len(t, verr.Problems, 2)
+}
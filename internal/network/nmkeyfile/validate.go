@@ -0,0 +1,410 @@
+package nmkeyfile
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// connectionTypes are the values NetworkManager accepts for connection.type:
+// setting names and the aliases keyfiles use for some of them.
+var connectionTypes = []string{
+	"6lowpan", "802-11-olpc-mesh", "802-11-wireless", "802-3-ethernet", "adsl",
+	"bluetooth", "bond", "bridge", "cdma", "dummy", "ethernet", "generic", "gsm",
+	"hsr", "infiniband", "ip-tunnel", "ipvlan", "loopback", "macsec", "macvlan",
+	"olpc-mesh", "ovs-bridge", "ovs-interface", "ovs-port", "pppoe", "team",
+	"tun", "veth", "vlan", "vpn", "vrf", "vxlan", "wifi", "wifi-p2p", "wimax",
+	"wireguard", "wpan",
+}
+
+// typeAliases maps setting names to the group names keyfiles use for them.
+var typeAliases = map[string]string{
+	"802-3-ethernet":  "ethernet",
+	"802-11-wireless": "wifi",
+}
+
+// ifNameSize is the kernel's IFNAMSIZ, including the terminating NUL.
+const ifNameSize = 16
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	macPattern  = regexp.MustCompile(`^[0-9a-fA-F]{2}(:[0-9a-fA-F]{2}){5}$`)
+	hexPSK      = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+var (
+	wifiModes    = []string{"infrastructure", "adhoc", "ap", "mesh"}
+	keyMgmtModes = []string{"none", "ieee8021x", "owe", "wpa-psk", "sae", "wpa-eap", "wpa-eap-suite-b-192"}
+	bondModes    = []string{
+		"balance-rr", "active-backup", "balance-xor", "broadcast", "802.3ad", "balance-tlb", "balance-alb",
+		"0", "1", "2", "3", "4", "5", "6",
+	}
+	portTypes   = []string{"bond", "bridge", "team", "ovs-port", "ovs-bridge", "vrf"}
+	ipv4Methods = []string{"auto", "manual", "disabled", "link-local", "shared"}
+	ipv6Methods = []string{"auto", "dhcp", "manual", "ignore", "disabled", "link-local", "shared"}
+	clonedMACs  = []string{"preserve", "permanent", "random", "stable"}
+)
+
+// Validate checks that data is a well-formed NetworkManager keyfile. Problems
+// are returned as a *ValidationError.
+func Validate(data []byte) error {
+	kf, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	v := &validator{kf: kf}
+	v.connection()
+	v.ethernet()
+	v.wifi()
+	v.vlan()
+	v.bond()
+	v.ip("ipv4", ipv4Methods)
+	v.ip("ipv6", ipv6Methods)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validator collects the problems found in a parsed keyfile.
+type validator struct {
+	kf       *Keyfile
+	problems []Problem
+}
+
+func (v *validator) addf(g *Group, key string, format string, args ...any) {
+	p := Problem{Group: g.Name, Key: key, Message: fmt.Sprintf(format, args...), Line: g.Line}
+	if e := g.entry(key); e != nil {
+		p.Line = e.Line
+	}
+	v.problems = append(v.problems, p)
+}
+
+// require reports a missing key and returns its value.
+func (v *validator) require(g *Group, key string) (string, bool) {
+	value, ok := g.Get(key)
+	if !ok || value == "" {
+		v.addf(g, key, "required")
+		return "", false
+	}
+	return value, true
+}
+
+func (v *validator) oneOf(g *Group, key string, allowed []string) {
+	if value, ok := g.Get(key); ok && !slices.Contains(allowed, value) {
+		v.addf(g, key, "invalid value %q, expected one of %s", value, strings.Join(allowed, ", "))
+	}
+}
+
+func (v *validator) boolean(g *Group, keys ...string) {
+	for _, key := range keys {
+		if value, ok := g.Get(key); ok && !slices.Contains([]string{"true", "false", "1", "0"}, value) {
+			v.addf(g, key, "invalid boolean %q", value)
+		}
+	}
+}
+
+func (v *validator) integer(g *Group, key string, minimum, maximum int64) {
+	value, ok := g.Get(key)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < minimum || n > maximum {
+		v.addf(g, key, "invalid value %q, expected an integer between %d and %d", value, minimum, maximum)
+	}
+}
+
+func (v *validator) mac(g *Group, key string, keywords []string) {
+	if value, ok := g.Get(key); ok && !macPattern.MatchString(value) && !slices.Contains(keywords, value) {
+		v.addf(g, key, "invalid MAC address %q", value)
+	}
+}
+
+func (v *validator) connection() {
+	g := v.kf.Group("connection")
+	if g == nil {
+		v.problems = append(v.problems, Problem{Group: "connection", Message: "missing group"})
+		return
+	}
+
+	v.require(g, "id")
+	if connType, ok := v.require(g, "type"); ok && !slices.Contains(connectionTypes, connType) {
+		v.addf(g, "type", "unknown connection type %q", connType)
+	}
+	if uuid, ok := g.Get("uuid"); ok && !uuidPattern.MatchString(uuid) {
+		v.addf(g, "uuid", "invalid UUID %q", uuid)
+	}
+	if name, ok := g.Get("interface-name"); ok && !isInterfaceName(name) {
+		v.addf(g, "interface-name", "invalid interface name %q", name)
+	}
+	v.boolean(g, "autoconnect", "autoconnect-ports", "autoconnect-slaves")
+	v.integer(g, "autoconnect-priority", -999, 999)
+
+	if v.isType("bond", "bridge", "team") {
+		v.require(g, "interface-name")
+	}
+
+	// A port needs both its controller and the controller's type.
+	_, hasController := v.first(g, "controller", "master")
+	_, hasPortType := v.first(g, "port-type", "slave-type")
+	switch {
+	case hasController && !hasPortType:
+		v.addf(g, "port-type", "required when controller is set")
+	case hasPortType && !hasController:
+		v.addf(g, "controller", "required when port-type is set")
+	}
+	v.oneOf(g, "port-type", portTypes)
+	v.oneOf(g, "slave-type", portTypes)
+}
+
+func (v *validator) ethernet() {
+	g := v.kf.Group("ethernet")
+	if g == nil {
+		return
+	}
+	v.mac(g, "mac-address", nil)
+	v.mac(g, "cloned-mac-address", clonedMACs)
+	v.integer(g, "mtu", 0, 65535)
+}
+
+func (v *validator) wifi() {
+	g := v.kf.Group("wifi")
+	if g == nil {
+		if v.isType("wifi") {
+			v.problems = append(v.problems, Problem{Group: "wifi", Message: "missing group"})
+		}
+		return
+	}
+	if ssid, ok := v.require(g, "ssid"); ok && len(ssid) > 32 {
+		v.addf(g, "ssid", "must be at most 32 bytes")
+	}
+	v.oneOf(g, "mode", wifiModes)
+	v.mac(g, "mac-address", nil)
+	v.mac(g, "cloned-mac-address", clonedMACs)
+	v.boolean(g, "hidden")
+
+	sec := v.kf.Group("wifi-security")
+	if sec == nil {
+		return
+	}
+	keyMgmt, ok := v.require(sec, "key-mgmt")
+	if !ok {
+		return
+	}
+	v.oneOf(sec, "key-mgmt", keyMgmtModes)
+	psk, hasPSK := sec.Get("psk")
+	switch keyMgmt {
+	case "wpa-psk":
+		if hasPSK && !hexPSK.MatchString(psk) && (len(psk) < 8 || len(psk) > 63) {
+			v.addf(sec, "psk", "must be 8 to 63 characters or 64 hexadecimal digits")
+		}
+	case "sae":
+		if hasPSK && psk == "" {
+			v.addf(sec, "psk", "must not be empty")
+		}
+	}
+}
+
+func (v *validator) vlan() {
+	g := v.kf.Group("vlan")
+	if g == nil {
+		if v.isType("vlan") {
+			v.problems = append(v.problems, Problem{Group: "vlan", Message: "missing group"})
+		}
+		return
+	}
+	if _, ok := v.require(g, "id"); ok {
+		v.integer(g, "id", 0, 4094)
+	}
+	// Without a parent, NetworkManager matches the parent by MAC address.
+	if _, ok := g.Get("parent"); !ok {
+		if _, ok := v.kf.Get("ethernet", "mac-address"); !ok {
+			v.addf(g, "parent", "required unless ethernet.mac-address is set")
+		}
+	}
+}
+
+func (v *validator) bond() {
+	g := v.kf.Group("bond")
+	if g == nil {
+		return
+	}
+	v.oneOf(g, "mode", bondModes)
+	for _, key := range []string{"miimon", "updelay", "downdelay", "arp_interval"} {
+		v.integer(g, key, 0, 1<<31-1)
+	}
+}
+
+// ip validates the [ipv4] or [ipv6] group.
+func (v *validator) ip(family string, methods []string) {
+	g := v.kf.Group(family)
+	if g == nil {
+		return
+	}
+	is4 := family == "ipv4"
+
+	method, _ := g.Get("method")
+	if method == "" {
+		method = "auto"
+	} else {
+		v.oneOf(g, "method", methods)
+	}
+
+	var addresses int
+	for _, e := range g.Entries {
+		switch {
+		case e.Key == "addresses" || isNumbered(e.Key, "address"):
+			for _, item := range splitList(e.Value) {
+				addresses++
+				if err := checkAddress(item, is4); err != nil {
+					v.addf(g, e.Key, "%v", err)
+				}
+			}
+		case e.Key == "routes" || isNumbered(e.Key, "route"):
+			for _, item := range splitList(e.Value) {
+				if err := checkRoute(item, is4); err != nil {
+					v.addf(g, e.Key, "%v", err)
+				}
+			}
+		}
+	}
+	switch {
+	case method == "manual" && addresses == 0:
+		v.addf(g, "method", "method \"manual\" requires at least one address")
+	case (method == "disabled" || method == "ignore") && addresses > 0:
+		v.addf(g, "method", "addresses are not allowed with method %q", method)
+	}
+
+	if gw, ok := g.Get("gateway"); ok {
+		if _, err := parseIP(gw, is4); err != nil {
+			v.addf(g, "gateway", "%v", err)
+		}
+	}
+	if dns, ok := g.Get("dns"); ok {
+		for _, server := range splitList(dns) {
+			// NetworkManager accepts "address#server-name" for DNS over TLS.
+			addr, _, _ := strings.Cut(server, "#")
+			if _, err := parseIP(addr, is4); err != nil {
+				v.addf(g, "dns", "%v", err)
+			}
+		}
+	}
+	v.boolean(g, "may-fail", "never-default", "ignore-auto-dns", "ignore-auto-routes")
+}
+
+// isType reports whether the connection has one of the given types.
+func (v *validator) isType(types ...string) bool {
+	connType, _ := v.kf.Get("connection", "type")
+	if alias, ok := typeAliases[connType]; ok {
+		connType = alias
+	}
+	return slices.Contains(types, connType)
+}
+
+// first returns the value of the first of keys that is set, for settings
+// that NetworkManager renamed but still accepts under the old name.
+func (v *validator) first(g *Group, keys ...string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := g.Get(key); ok && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// checkAddress checks an "address/prefix[,gateway]" entry.
+func checkAddress(s string, is4 bool) error {
+	addr, gw, hasGW := strings.Cut(s, ",")
+	if err := checkPrefix(addr, is4); err != nil {
+		return err
+	}
+	if hasGW {
+		if _, err := parseIP(gw, is4); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRoute checks a "destination/prefix[,next-hop[,metric]]" entry.
+func checkRoute(s string, is4 bool) error {
+	parts := strings.Split(s, ",")
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid route %q", s)
+	}
+	if err := checkPrefix(parts[0], is4); err != nil {
+		return err
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		if _, err := parseIP(parts[1], is4); err != nil {
+			return err
+		}
+	}
+	if len(parts) > 2 {
+		if _, err := strconv.ParseUint(parts[2], 10, 32); err != nil {
+			return fmt.Errorf("invalid route metric %q", parts[2])
+		}
+	}
+	return nil
+}
+
+// checkPrefix checks an address with an optional prefix length of the given
+// family. Without a prefix length, NetworkManager assumes /24 or /64.
+func checkPrefix(s string, is4 bool) error {
+	if !strings.Contains(s, "/") {
+		_, err := parseIP(s, is4)
+		return err
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil || prefix.Addr().Zone() != "" {
+		return fmt.Errorf("invalid address %q", s)
+	}
+	if prefix.Addr().Is4() != is4 {
+		return fmt.Errorf("%q is not an %s address", s, familyName(is4))
+	}
+	return nil
+}
+
+// parseIP parses an address of the given family.
+func parseIP(s string, is4 bool) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	if addr.Is4() != is4 {
+		return netip.Addr{}, fmt.Errorf("%q is not an %s address", s, familyName(is4))
+	}
+	return addr, nil
+}
+
+func familyName(is4 bool) string {
+	if is4 {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// isNumbered reports whether key is prefix followed by a number, such as
+// "address1".
+func isNumbered(key, prefix string) bool {
+	n, ok := strings.CutPrefix(key, prefix)
+	if !ok || n == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(n, 10, 32)
+	return err == nil
+}
+
+// isInterfaceName reports whether s is a valid kernel interface name.
+func isInterfaceName(s string) bool {
+	if s == "" || len(s) >= ifNameSize || s == "." || s == ".." {
+		return false
+	}
+	return !strings.ContainsAny(s, "/: \t\n")
+}
@@ -0,0 +1,210 @@
+package nmkeyfile_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/network/nmkeyfile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_Valid(t *testing.T) {
+	tests := map[string]string{
+		"ethernet dhcp": `[connection]
+id=eth0
+uuid=2b4b2f6c-3f4a-4c63-9d1e-5f1b0a3c7e21
+type=ethernet
+interface-name=eth0
+
+[ethernet]
+
+[ipv4]
+method=auto
+
+[ipv6]
+addr-gen-mode=default
+method=auto
+`,
+		"ethernet static": `[connection]
+id=eth0
+type=802-3-ethernet
+autoconnect=true
+
+[ipv4]
+method=manual
+address1=192.168.1.10/24,192.168.1.1
+address2=10.0.0.5
+dns=1.1.1.1;9.9.9.9#dns.quad9.net;
+route1=10.10.0.0/16,192.168.1.254,100
+
+[ipv6]
+method=manual
+address1=2001:db8::10/64
+gateway=2001:db8::1
+`,
+		"wifi wpa-psk": `[connection]
+id=office
+type=wifi
+
+[wifi]
+ssid=Office WiFi
+mode=infrastructure
+
+[wifi-security]
+key-mgmt=wpa-psk
+psk=correct horse
+`,
+		"vlan": `[connection]
+id=vlan10
+type=vlan
+
+[vlan]
+id=10
+parent=eth0
+`,
+		"bond port": `[connection]
+id=bond0-port1
+type=ethernet
+interface-name=eth1
+master=bond0
+slave-type=bond
+`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, nmkeyfile.Validate([]byte(data)))
+		})
+	}
+}
+
+func TestValidate_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		problem string
+	}{
+		{
+			name:    "missing connection group",
+			data:    "[ipv4]\nmethod=auto\n",
+			problem: "[connection]: missing group",
+		},
+		{
+			name:    "missing id",
+			data:    "[connection]\ntype=ethernet\n",
+			problem: "line 1: connection.id: required",
+		},
+		{
+			name:    "unknown type",
+			data:    "[connection]\nid=x\ntype=ethrenet\n",
+			problem: `line 3: connection.type: unknown connection type "ethrenet"`,
+		},
+		{
+			name:    "invalid uuid",
+			data:    "[connection]\nid=x\ntype=ethernet\nuuid=1234\n",
+			problem: `line 4: connection.uuid: invalid UUID "1234"`,
+		},
+		{
+			name:    "interface name too long",
+			data:    "[connection]\nid=x\ntype=ethernet\ninterface-name=enp0s20f0u1u2u3c4\n",
+			problem: `connection.interface-name: invalid interface name`,
+		},
+		{
+			name:    "invalid boolean",
+			data:    "[connection]\nid=x\ntype=ethernet\nautoconnect=yes\n",
+			problem: `line 4: connection.autoconnect: invalid boolean "yes"`,
+		},
+		{
+			name:    "port without port type",
+			data:    "[connection]\nid=x\ntype=ethernet\ncontroller=br0\n",
+			problem: "connection.port-type: required when controller is set",
+		},
+		{
+			name:    "bond without interface name",
+			data:    "[connection]\nid=x\ntype=bond\n",
+			problem: "connection.interface-name: required",
+		},
+		{
+			name:    "invalid bond mode",
+			data:    "[connection]\nid=x\ntype=bond\ninterface-name=bond0\n[bond]\nmode=active-passive\n",
+			problem: `line 6: bond.mode: invalid value "active-passive"`,
+		},
+		{
+			name:    "wifi without ssid",
+			data:    "[connection]\nid=x\ntype=wifi\n[wifi]\nmode=infrastructure\n",
+			problem: "line 4: wifi.ssid: required",
+		},
+		{
+			name:    "short psk",
+			data:    "[connection]\nid=x\ntype=wifi\n[wifi]\nssid=a\n[wifi-security]\nkey-mgmt=wpa-psk\npsk=secret\n",
+			problem: "line 8: wifi-security.psk: must be 8 to 63 characters or 64 hexadecimal digits",
+		},
+		{
+			name:    "vlan id out of range",
+			data:    "[connection]\nid=x\ntype=vlan\n[vlan]\nid=4095\nparent=eth0\n",
+			problem: `line 5: vlan.id: invalid value "4095"`,
+		},
+		{
+			name:    "vlan without parent",
+			data:    "[connection]\nid=x\ntype=vlan\n[vlan]\nid=10\n",
+			problem: "vlan.parent: required unless ethernet.mac-address is set",
+		},
+		{
+			name:    "invalid mac",
+			data:    "[connection]\nid=x\ntype=ethernet\n[ethernet]\nmac-address=00:11:22:33:44\n",
+			problem: `line 5: ethernet.mac-address: invalid MAC address`,
+		},
+		{
+			name:    "invalid ipv4 method",
+			data:    "[connection]\nid=x\ntype=ethernet\n[ipv4]\nmethod=static\n",
+			problem: `line 5: ipv4.method: invalid value "static"`,
+		},
+		{
+			name:    "manual without addresses",
+			data:    "[connection]\nid=x\ntype=ethernet\n[ipv4]\nmethod=manual\n",
+			problem: `ipv4.method: method "manual" requires at least one address`,
+		},
+		{
+			name:    "invalid address",
+			data:    "[connection]\nid=x\ntype=ethernet\n[ipv4]\nmethod=manual\naddress1=192.168.1.300/24\n",
+			problem: `line 6: ipv4.address1: invalid address "192.168.1.300/24"`,
+		},
+		{
+			name:    "ipv6 address in ipv4",
+			data:    "[connection]\nid=x\ntype=ethernet\n[ipv4]\nmethod=manual\naddress1=2001:db8::1/64\n",
+			problem: `ipv4.address1: "2001:db8::1/64" is not an IPv4 address`,
+		},
+		{
+			name:    "invalid dns",
+			data:    "[connection]\nid=x\ntype=ethernet\n[ipv6]\ndns=1.1.1.1;\n",
+			problem: `line 5: ipv6.dns: "1.1.1.1" is not an IPv6 address`,
+		},
+		{
+			name:    "addresses with method disabled",
+			data:    "[connection]\nid=x\ntype=ethernet\n[ipv6]\nmethod=disabled\naddress1=2001:db8::1/64\n",
+			problem: `ipv6.method: addresses are not allowed with method "disabled"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := nmkeyfile.Validate([]byte(tt.data))
+			var verr *nmkeyfile.ValidationError
+			require.True(t, errors.As(err, &verr), "expected ValidationError, got %v", err)
+			require.Len(t, verr.Problems, 1, verr.Error())
+			assert.Contains(t, verr.Problems[0].String(), tt.problem)
+		})
+	}
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	err := nmkeyfile.Validate([]byte("[connection]\ntype=ethernet\n[ipv4]\nmethod=manual\naddress1=10.0.0.1/33\ngateway=10.0.0\n"))
+
+	var verr *nmkeyfile.ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Len(t, verr.Problems, 3)
+	assert.Equal(t,
+		`line 1: connection.id: required; line 5: ipv4.address1: invalid address "10.0.0.1/33"; line 6: ipv4.gateway: invalid address "10.0.0"`,
+		verr.Error())
+}
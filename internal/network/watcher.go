@@ -0,0 +1,196 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/logging"
+)
+
+const (
+	// DefaultPollInterval is how often the watcher compares interface
+	// snapshots when link notifications are unavailable.
+	DefaultPollInterval = 2 * time.Second
+
+	// settleDelay coalesces bursts of link and address events (e.g. a link
+	// coming up followed by IPv4 and IPv6 address assignment).
+	settleDelay = 100 * time.Millisecond
+)
+
+// Watcher notifies subscribers when network links or addresses change.
+// On Linux it subscribes to rtnetlink link and address notifications; where
+// that is unavailable it falls back to polling the interface list.
+type Watcher struct {
+	logger       *logging.Logger
+	pollInterval time.Duration
+	snapshot     func() string // interface state used by the polling fallback
+
+	mu     sync.Mutex
+	subs   map[int]chan struct{}
+	nextID int
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWatcher creates a watcher. Call Start to begin watching.
+func NewWatcher(logger *logging.Logger) *Watcher {
+	return &Watcher{
+		logger:       logger,
+		pollInterval: DefaultPollInterval,
+		snapshot:     interfaceSnapshot,
+		subs:         make(map[int]chan struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives a value after links or addresses
+// change. Notifications are coalesced: a subscriber that is busy receives a
+// single pending notification. The returned function cancels the subscription.
+func (w *Watcher) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	id := w.nextID
+	w.nextID++
+	w.subs[id] = ch
+	w.mu.Unlock()
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Start begins watching in the background until ctx is cancelled or Stop is called.
+func (w *Watcher) Start(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		return fmt.Errorf("watcher already started")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w.cancel = cancel
+	w.done = make(chan struct{})
+
+	events, err := subscribeLinkEvents(ctx)
+	if err != nil {
+		w.logger.Warn("link notifications unavailable, polling interfaces", map[string]any{
+			"error":    err.Error(),
+			"interval": w.pollInterval.String(),
+		})
+		events = w.poll(ctx)
+	} else {
+		w.logger.Info("watching network links via rtnetlink")
+	}
+
+	go w.run(ctx, events)
+	return nil
+}
+
+// Stop stops watching.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// run forwards events to subscribers once they settle. If the events end
+// before ctx is cancelled, it polls instead.
+func (w *Watcher) run(ctx context.Context, events <-chan struct{}) {
+	defer close(w.done)
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return
+				}
+				// Changes may have been missed, so notify subscribers as well
+				w.logger.Warn("link notifications failed, polling interfaces", map[string]any{
+					"interval": w.pollInterval.String(),
+				})
+				events = w.poll(ctx)
+			}
+			if settle == nil {
+				settle = time.After(settleDelay)
+			}
+		case <-settle:
+			settle = nil
+			w.notify()
+		}
+	}
+}
+
+func (w *Watcher) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range w.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// poll emits an event whenever the interface snapshot changes.
+func (w *Watcher) poll(ctx context.Context) <-chan struct{} {
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+
+		last := w.snapshot()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if current := w.snapshot(); current != last {
+				last = current
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// interfaceSnapshot describes the interfaces with their flags and addresses.
+func interfaceSnapshot() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	var lines []string
+	for _, iface := range ifaces {
+		line := fmt.Sprintf("%d %s %s", iface.Index, iface.Name, iface.Flags)
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, a := range addrs {
+				line += " " + a.String()
+			}
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
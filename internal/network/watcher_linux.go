@@ -0,0 +1,81 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// subscribeLinkEvents opens an rtnetlink socket subscribed to link and
+// address changes and emits an event for each relevant notification.
+func subscribeLinkEvents(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rtnetlink socket: %w", err)
+	}
+
+	addr := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	}
+	if err := unix.Bind(fd, addr); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to subscribe to rtnetlink groups: %w", err)
+	}
+
+	// A non-blocking descriptor is handed to the runtime poller, so Close
+	// unblocks a pending Read
+	sock := os.NewFile(uintptr(fd), "rtnetlink") // #nosec G115 - file descriptors are non-negative
+
+	events := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		_ = sock.Close()
+	}()
+	go readLinkEvents(sock.Read, events)
+
+	return events, nil
+}
+
+// readLinkEvents reads netlink datagrams with read and emits an event for
+// each relevant notification. It closes events when read fails.
+func readLinkEvents(read func([]byte) (int, error), events chan<- struct{}) {
+	defer close(events)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := read(buf)
+		switch {
+		case errors.Is(err, unix.ENOBUFS):
+			// The socket buffer overflowed and notifications were lost;
+			// have subscribers rescan
+		case err != nil:
+			return
+		case !isLinkEvent(buf[:n]):
+			continue
+		}
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// isLinkEvent reports whether a netlink datagram announces a link or address change.
+func isLinkEvent(data []byte) bool {
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil || len(msgs) == 0 {
+		// An unparseable datagram still means something changed
+		return true
+	}
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case unix.RTM_NEWLINK, unix.RTM_DELLINK, unix.RTM_NEWADDR, unix.RTM_DELADDR:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func netlinkMessage(typ uint16) []byte {
+	buf := make([]byte, syscall.NLMSG_HDRLEN)
+	hdr := (*syscall.NlMsghdr)(unsafe.Pointer(&buf[0])) // #nosec G103 - building a test message
+	hdr.Len = uint32(len(buf))                          // #nosec G115 - header length is constant
+	hdr.Type = typ
+	return buf
+}
+
+func TestIsLinkEvent(t *testing.T) {
+	assert.True(t, isLinkEvent(netlinkMessage(unix.RTM_NEWADDR)))
+	assert.True(t, isLinkEvent(netlinkMessage(unix.RTM_DELLINK)))
+	assert.False(t, isLinkEvent(netlinkMessage(unix.RTM_NEWROUTE)))
+	assert.True(t, isLinkEvent([]byte{1, 2, 3}), "truncated datagrams count as changes")
+}
+
+func TestReadLinkEvents_RescansOnOverflow(t *testing.T) {
+	datagrams := [][]byte{netlinkMessage(unix.RTM_NEWROUTE), nil, netlinkMessage(unix.RTM_NEWADDR)}
+	errs := []error{nil, unix.ENOBUFS, nil, errors.New("socket closed")}
+	var reads int
+	read := func(buf []byte) (int, error) {
+		defer func() { reads++ }()
+		if reads < len(datagrams) {
+			return copy(buf, datagrams[reads]), errs[reads]
+		}
+		return 0, errs[reads]
+	}
+
+	events := make(chan struct{}, 4)
+	readLinkEvents(read, events)
+
+	// The overflow and the address change, but not the route change
+	var n int
+	for range events {
+		n++
+	}
+	require.Equal(t, 4, reads, "reading continues after an overflow")
+	assert.Equal(t, 2, n)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package network
+
+import (
+	"context"
+	"errors"
+)
+
+// subscribeLinkEvents is only implemented on Linux; other platforms poll.
+func subscribeLinkEvents(_ context.Context) (<-chan struct{}, error) {
+	return nil, errors.ErrUnsupported
+}
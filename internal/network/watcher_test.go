@@ -0,0 +1,146 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWatcher() *Watcher {
+	return NewWatcher(logging.New(logging.LevelError, logging.FormatJSON))
+}
+
+func receive(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+	}
+}
+
+func assertQuiet(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification")
+	case <-time.After(2 * settleDelay):
+	}
+}
+
+func TestWatcher_CoalescesEvents(t *testing.T) {
+	w := newTestWatcher()
+	ch, cancel := w.Subscribe()
+	defer cancel()
+
+	ctx, stop := context.WithCancel(context.Background())
+	events := make(chan struct{}, 3)
+	w.done = make(chan struct{})
+	go w.run(ctx, events)
+	defer func() {
+		stop()
+		<-w.done
+	}()
+
+	for range 3 {
+		events <- struct{}{}
+	}
+	receive(t, ch)
+	assertQuiet(t, ch)
+}
+
+func TestWatcher_Unsubscribe(t *testing.T) {
+	w := newTestWatcher()
+	ch, cancel := w.Subscribe()
+	other, cancelOther := w.Subscribe()
+	defer cancelOther()
+
+	cancel()
+	w.notify()
+
+	receive(t, other)
+	assertQuiet(t, ch)
+}
+
+func TestWatcher_PollFallback(t *testing.T) {
+	var mu sync.Mutex
+	state := "eth0 10.0.0.2/24"
+
+	w := newTestWatcher()
+	w.pollInterval = 10 * time.Millisecond
+	w.snapshot = func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return state
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := w.poll(ctx)
+
+	select {
+	case <-events:
+		t.Fatal("event without a change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mu.Lock()
+	state = "eth0 10.0.0.2/24\nusb0 10.0.2.1/24"
+	mu.Unlock()
+	receive(t, events)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-events
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWatcher_PollsWhenEventsEnd(t *testing.T) {
+	var mu sync.Mutex
+	state := "eth0 10.0.0.2/24"
+
+	w := newTestWatcher()
+	w.pollInterval = 10 * time.Millisecond
+	w.snapshot = func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return state
+	}
+	ch, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+
+	ctx, stop := context.WithCancel(context.Background())
+	events := make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run(ctx, events)
+	defer func() {
+		stop()
+		<-w.done
+	}()
+
+	// Changes may have been missed while the notifications failed
+	close(events)
+	receive(t, ch)
+
+	mu.Lock()
+	state = "eth0 10.0.0.2/24\nusb0 10.0.2.1/24"
+	mu.Unlock()
+	receive(t, ch)
+}
+
+func TestWatcher_StartStop(t *testing.T) {
+	w := newTestWatcher()
+	require.NoError(t, w.Start(context.Background()))
+	assert.Error(t, w.Start(context.Background()), "second start must fail")
+	w.Stop()
+}
+
+func TestInterfaceSnapshot_IncludesLoopback(t *testing.T) {
+	assert.Contains(t, interfaceSnapshot(), "127.0.0.1/8")
+}
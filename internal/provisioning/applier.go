@@ -5,13 +5,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/fzdarsky/boardingpass/internal/network/nmkeyfile"
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
 )
 
 const (
 	// StagingDirBase is the base directory for staging temporary files
 	StagingDirBase = "/var/lib/boardingpass/staging"
+
+	// NMConnectionsDir is NetworkManager's keyfile directory, relative to /etc.
+	// Files in it are validated as keyfiles and installed with mode 0600, as
+	// NetworkManager ignores keyfiles readable by other users.
+	NMConnectionsDir = "NetworkManager/system-connections/"
 )
 
 // Applier handles atomic application of configuration bundles.
@@ -103,7 +110,7 @@ func (a *Applier) resolveTargetPath(relPath string) string {
 // Steps:
 // 1. Validate bundle (size, file count, Base64 encoding)
 // 2. Validate all paths against allow-list
-// 3. Decode and write all files to temp directory
+// 3. Decode, validate NetworkManager keyfiles, and write to temp directory
 // 4. Backup existing target files
 // 5. Atomically rename all files to target paths
 // 6. Clean up temp directory
@@ -132,6 +139,15 @@ func (a *Applier) Apply(ctx context.Context, bundle *protocol.ConfigBundle) erro
 			return fmt.Errorf("failed to decode file %s: %w", file.Path, err)
 		}
 
+		// #nosec G115 - file mode values are guaranteed to be within uint32 range
+		mode := os.FileMode(file.Mode)
+		if isNMKeyfile(file.Path) {
+			if err := nmkeyfile.Validate(decoded); err != nil {
+				return fmt.Errorf("invalid NetworkManager keyfile %s: %w", file.Path, err)
+			}
+			mode = 0o600
+		}
+
 		// Write to temp directory preserving directory structure
 		tempPath := filepath.Join(a.tempDir, file.Path)
 
@@ -142,8 +158,7 @@ func (a *Applier) Apply(ctx context.Context, bundle *protocol.ConfigBundle) erro
 			return fmt.Errorf("failed to create staging directory %s: %w", tempDir, err)
 		}
 
-		// #nosec G115 - file mode values are guaranteed to be within uint32 range
-		if err := os.WriteFile(tempPath, decoded, os.FileMode(file.Mode)); err != nil {
+		if err := os.WriteFile(tempPath, decoded, mode); err != nil {
 			return fmt.Errorf("failed to write temp file %s: %w", file.Path, err)
 		}
 
@@ -183,6 +198,13 @@ func (a *Applier) Apply(ctx context.Context, bundle *protocol.ConfigBundle) erro
 	return nil
 }
 
+// isNMKeyfile reports whether relPath is in NetworkManager's keyfile directory.
+// It resolves relPath like resolveTargetPath does, so that spellings such as
+// "/NetworkManager/..." or "./NetworkManager/..." are recognized too.
+func isNMKeyfile(relPath string) bool {
+	return strings.HasPrefix(filepath.Join("/etc", relPath), "/etc/"+NMConnectionsDir)
+}
+
 // Cleanup removes the temporary staging directory and all backups.
 // Call this after successful provisioning.
 func (a *Applier) Cleanup() error {
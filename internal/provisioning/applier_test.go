@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/fzdarsky/boardingpass/internal/network/nmkeyfile"
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -273,3 +274,92 @@ func TestApplier_DecodeAndStageFiles(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
 }
+
+func TestApplier_Apply_NMKeyfile(t *testing.T) {
+	rootDir := testRootDir(t)
+
+	validator := NewPathValidator([]string{"/etc/NetworkManager/system-connections/"})
+	applier, err := NewApplier(validator, rootDir)
+	require.NoError(t, err)
+
+	keyfile := "[connection]\nid=eth0\ntype=ethernet\n\n[ipv4]\nmethod=auto\n"
+	bundle := &protocol.ConfigBundle{
+		Files: []protocol.ConfigFile{
+			{
+				Path:    "NetworkManager/system-connections/eth0.nmconnection",
+				Content: base64.StdEncoding.EncodeToString([]byte(keyfile)),
+				Mode:    0o644,
+			},
+		},
+	}
+
+	require.NoError(t, applier.Apply(context.Background(), bundle))
+
+	// Keyfiles are installed with mode 0600 regardless of the requested mode
+	info, err := os.Stat(filepath.Join(rootDir, "etc/NetworkManager/system-connections/eth0.nmconnection"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestApplier_Apply_NMKeyfileLeadingSlash(t *testing.T) {
+	rootDir := testRootDir(t)
+
+	validator := NewPathValidator([]string{"/etc/NetworkManager/system-connections/"})
+	applier, err := NewApplier(validator, rootDir)
+	require.NoError(t, err)
+
+	// A leading slash resolves to the same target and must not bypass
+	// keyfile validation or the forced mode
+	bundle := &protocol.ConfigBundle{
+		Files: []protocol.ConfigFile{
+			{
+				Path:    "/NetworkManager/system-connections/bad.nmconnection",
+				Content: base64.StdEncoding.EncodeToString([]byte("[connection]\nid=bad\ntype=ethernet\n\n[ipv4]\nmethod=static\n")),
+				Mode:    0o644,
+			},
+		},
+	}
+	var verr *nmkeyfile.ValidationError
+	require.ErrorAs(t, applier.Apply(context.Background(), bundle), &verr)
+
+	bundle.Files[0].Path = "/NetworkManager/system-connections/eth0.nmconnection"
+	bundle.Files[0].Content = base64.StdEncoding.EncodeToString([]byte("[connection]\nid=eth0\ntype=ethernet\n"))
+	require.NoError(t, applier.Apply(context.Background(), bundle))
+
+	info, err := os.Stat(filepath.Join(rootDir, "etc/NetworkManager/system-connections/eth0.nmconnection"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestApplier_Apply_InvalidNMKeyfile(t *testing.T) {
+	rootDir := testRootDir(t)
+
+	validator := NewPathValidator([]string{"/etc/NetworkManager/system-connections/"})
+	applier, err := NewApplier(validator, rootDir)
+	require.NoError(t, err)
+
+	bundle := &protocol.ConfigBundle{
+		Files: []protocol.ConfigFile{
+			{
+				Path:    "NetworkManager/system-connections/good.nmconnection",
+				Content: base64.StdEncoding.EncodeToString([]byte("[connection]\nid=good\ntype=ethernet\n")),
+				Mode:    0o600,
+			},
+			{
+				Path:    "NetworkManager/system-connections/bad.nmconnection",
+				Content: base64.StdEncoding.EncodeToString([]byte("[connection]\nid=bad\ntype=ethernet\n\n[ipv4]\nmethod=static\n")),
+				Mode:    0o600,
+			},
+		},
+	}
+
+	err = applier.Apply(context.Background(), bundle)
+	var verr *nmkeyfile.ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Contains(t, err.Error(), "bad.nmconnection")
+	assert.Contains(t, err.Error(), `line 6: ipv4.method: invalid value "static"`)
+
+	// Nothing reaches the target directory, not even the valid keyfile
+	_, err = os.Stat(filepath.Join(rootDir, "etc/NetworkManager/system-connections"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,191 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestByteCapacity(t *testing.T) {
+	// Reference capacities from ISO/IEC 18004 Table 7 (byte mode)
+	tests := []struct {
+		version int
+		level   Level
+		want    int
+	}{
+		{1, LevelL, 17},
+		{1, LevelM, 14},
+		{1, LevelQ, 11},
+		{1, LevelH, 7},
+		{10, LevelM, 213},
+		{40, LevelL, 2953},
+		{40, LevelM, 2331},
+		{40, LevelQ, 1663},
+		{40, LevelH, 1273},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, byteCapacity(tt.version, tt.level), "version %d level %d", tt.version, tt.level)
+	}
+}
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// "HELLO WORLD" as 1-M data codewords, with the published ECC codewords
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	assert.Equal(t, want, got)
+}
+
+func TestFormatAndVersionInfo(t *testing.T) {
+	assert.Equal(t, 0x5412, formatInfo(LevelM, 0))
+	assert.Equal(t, 0x77C4, formatInfo(LevelL, 0))
+	assert.Equal(t, 0x07C94, versionInfo(7))
+	assert.Equal(t, 0x28C69, versionInfo(40))
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	assert.Nil(t, alignmentPositions(1, 21))
+	assert.Equal(t, []int{6, 18}, alignmentPositions(2, 25))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPositions(7, 45))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPositions(32, 145))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, alignmentPositions(40, 177))
+}
+
+func TestEncode_SelectsSmallestVersion(t *testing.T) {
+	c, err := Encode([]byte("hello"), LevelM)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Version)
+	assert.Equal(t, 21, c.Size)
+
+	c, err = Encode(bytes.Repeat([]byte("x"), 15), LevelM)
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Version)
+
+	_, err = Encode(bytes.Repeat([]byte("x"), 2954), LevelL)
+	assert.ErrorIs(t, err, ErrDataTooLong)
+}
+
+func TestEncode_FinderPatterns(t *testing.T) {
+	c, err := Encode([]byte("boardingpass"), LevelM)
+	require.NoError(t, err)
+
+	for _, origin := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		for dy := range 7 {
+			for dx := range 7 {
+				dist := max(abs(dx-3), abs(dy-3))
+				assert.Equal(t, dist != 2, c.Dark(origin[0]+dx, origin[1]+dy),
+					"finder at %v, module (%d,%d)", origin, dx, dy)
+			}
+		}
+	}
+
+	// Always-dark module next to the bottom-left finder
+	assert.True(t, c.Dark(8, c.Size-8))
+}
+
+func TestEncode_FormatInfoMatchesMask(t *testing.T) {
+	c, err := Encode([]byte("boardingpass://onboard?v=1"), LevelQ)
+	require.NoError(t, err)
+
+	// Read the first copy of the format information back from the symbol
+	var bits int
+	read := func(i, x, y int) {
+		if c.Dark(x, y) {
+			bits |= 1 << uint(i)
+		}
+	}
+	for i := range 6 {
+		read(i, 8, i)
+	}
+	read(6, 8, 7)
+	read(7, 8, 8)
+	read(8, 7, 8)
+	for i := 9; i < 15; i++ {
+		read(i, 14-i, 8)
+	}
+
+	assert.Equal(t, formatInfo(LevelQ, c.Mask), bits)
+}
+
+func TestEncode_DataRoundTrip(t *testing.T) {
+	inputs := []string{
+		"hi",
+		"boardingpass://onboard?v=1&id=SN12345&t=wifi%4010.0.0.1",
+		strings.Repeat("0123456789abcdef", 30), // multi-block, version >= 7
+	}
+
+	for _, in := range inputs {
+		c, err := Encode([]byte(in), LevelM)
+		require.NoError(t, err)
+
+		want := addErrorCorrection(buildDataCodewords([]byte(in), c.Version, c.Level), c.Version, c.Level)
+		assert.Equal(t, want, readCodewords(c), "input of %d bytes (version %d)", len(in), c.Version)
+	}
+}
+
+// readCodewords removes the mask and reads codewords back in placement order.
+func readCodewords(c *Code) []byte {
+	c.applyMask(c.Mask)
+	defer c.applyMask(c.Mask)
+
+	var out []byte
+	var cur byte
+	n := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range c.Size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y][x] {
+					continue
+				}
+				cur <<= 1
+				if c.modules[y][x] {
+					cur |= 1
+				}
+				n++
+				if n%8 == 0 {
+					out = append(out, cur)
+					cur = 0
+				}
+			}
+		}
+	}
+	return out
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode([]byte("render"), LevelM)
+	require.NoError(t, err)
+
+	dim := c.Size + 2*QuietZone
+
+	lines := strings.Split(strings.TrimSuffix(c.Terminal(), "\n"), "\n")
+	assert.Len(t, lines, (dim+1)/2)
+	for _, line := range lines {
+		assert.Equal(t, dim, len([]rune(line)))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WritePNG(&buf, 4))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, dim*4, img.Bounds().Dx())
+	assert.Equal(t, dim*4, img.Bounds().Dy())
+
+	svg := c.SVG()
+	assert.True(t, strings.HasPrefix(svg, "<?xml"))
+	assert.Contains(t, svg, "viewBox=\"0 0 29 29\"")
+}
@@ -0,0 +1,168 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Scheme is the URI scheme of onboarding payloads.
+	Scheme = "boardingpass"
+	// PayloadVersion is the current onboarding payload format version.
+	PayloadVersion = 1
+
+	uriHost = "onboard"
+
+	// defaultPort mirrors the service's default HTTPS port.
+	defaultPort = 9455
+)
+
+// Query parameter keys. They are kept short so the URI fits into small QR versions.
+const (
+	keyVersion     = "v"
+	keyDeviceID    = "id"
+	keyPort        = "port"
+	keyTransport   = "t"
+	keySSID        = "ssid"
+	keyPSK         = "psk"
+	keyFingerprint = "fp"
+	keyUsername    = "u"
+	keyPassword    = "pw"
+)
+
+// Transport describes one way of reaching the device.
+// Address is empty for transports whose address is only known at runtime (e.g. USB).
+type Transport struct {
+	Type    string
+	Address string
+}
+
+// Payload is the information a client needs to onboard a device in one step.
+//
+// The URI form is:
+//
+//	boardingpass://onboard?v=1&id=<device-id>&port=9455&t=wifi@10.0.0.1&t=usb&ssid=...&psk=...&fp=SHA256:...&u=boardingpass&pw=...
+type Payload struct {
+	DeviceID    string
+	Port        int
+	Transports  []Transport
+	WiFiSSID    string
+	WiFiPSK     string
+	Fingerprint string // "SHA256:<base64>", as shown by the boarding CLI
+	Username    string
+	Password    string
+}
+
+// URI encodes the payload as a versioned onboarding URI.
+func (p *Payload) URI() string {
+	q := url.Values{}
+	q.Set(keyVersion, strconv.Itoa(PayloadVersion))
+	setIfNotEmpty(q, keyDeviceID, p.DeviceID)
+	if p.Port != 0 && p.Port != defaultPort {
+		q.Set(keyPort, strconv.Itoa(p.Port))
+	}
+	for _, t := range p.Transports {
+		if t.Address != "" {
+			q.Add(keyTransport, t.Type+"@"+t.Address)
+		} else {
+			q.Add(keyTransport, t.Type)
+		}
+	}
+	setIfNotEmpty(q, keySSID, p.WiFiSSID)
+	setIfNotEmpty(q, keyPSK, p.WiFiPSK)
+	setIfNotEmpty(q, keyFingerprint, p.Fingerprint)
+	setIfNotEmpty(q, keyUsername, p.Username)
+	setIfNotEmpty(q, keyPassword, p.Password)
+
+	u := url.URL{
+		Scheme:   Scheme,
+		Host:     uriHost,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// Addresses returns the transport addresses in payload order, without duplicates.
+func (p *Payload) Addresses() []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, t := range p.Transports {
+		if t.Address == "" || seen[t.Address] {
+			continue
+		}
+		seen[t.Address] = true
+		addrs = append(addrs, t.Address)
+	}
+	return addrs
+}
+
+// ParseURI decodes an onboarding URI produced by Payload.URI.
+func ParseURI(raw string) (*Payload, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid onboarding URI: %w", err)
+	}
+	if u.Scheme != Scheme || u.Host != uriHost {
+		return nil, fmt.Errorf("invalid onboarding URI: must start with %s://%s", Scheme, uriHost)
+	}
+
+	q := u.Query()
+	version, err := strconv.Atoi(q.Get(keyVersion))
+	if err != nil {
+		return nil, errors.New("invalid onboarding URI: missing or malformed version")
+	}
+	if version != PayloadVersion {
+		return nil, fmt.Errorf("unsupported onboarding URI version %d (supported: %d)", version, PayloadVersion)
+	}
+
+	p := &Payload{
+		DeviceID:    q.Get(keyDeviceID),
+		Port:        defaultPort,
+		WiFiSSID:    q.Get(keySSID),
+		WiFiPSK:     q.Get(keyPSK),
+		Fingerprint: q.Get(keyFingerprint),
+		Username:    q.Get(keyUsername),
+		Password:    q.Get(keyPassword),
+	}
+
+	if s := q.Get(keyPort); s != "" {
+		port, err := strconv.Atoi(s)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid onboarding URI: port %q out of range", s)
+		}
+		p.Port = port
+	}
+
+	for _, s := range q[keyTransport] {
+		typ, addr, _ := strings.Cut(s, "@")
+		if typ == "" {
+			return nil, fmt.Errorf("invalid onboarding URI: empty transport type in %q", s)
+		}
+		if addr != "" && net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid onboarding URI: transport %s has invalid address %q", typ, addr)
+		}
+		p.Transports = append(p.Transports, Transport{Type: typ, Address: addr})
+	}
+
+	if p.Fingerprint != "" && !strings.HasPrefix(p.Fingerprint, "SHA256:") {
+		return nil, fmt.Errorf("invalid onboarding URI: unsupported fingerprint format %q", p.Fingerprint)
+	}
+
+	return p, nil
+}
+
+func setIfNotEmpty(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+// QRCode encodes the payload URI as a QR code at error correction level M,
+// which keeps codes readable from slightly damaged labels and phone screens.
+func (p *Payload) QRCode() (*Code, error) {
+	return Encode([]byte(p.URI()), LevelM)
+}
@@ -0,0 +1,80 @@
+package qr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayload_RoundTrip(t *testing.T) {
+	p := &Payload{
+		DeviceID: "SN-0042",
+		Port:     8443,
+		Transports: []Transport{
+			{Type: "ethernet", Address: "192.168.1.10"},
+			{Type: "wifi", Address: "10.0.0.1"},
+			{Type: "bluetooth", Address: "fe80::1"},
+			{Type: "usb"},
+		},
+		WiFiSSID:    "BoardingPass-edge01",
+		WiFiPSK:     "s3cret & more",
+		Fingerprint: "SHA256:aGVsbG8rd29ybGQ/Zm9vYmFy=",
+		Username:    "boardingpass",
+		Password:    "pw+with/special=chars",
+	}
+
+	got, err := ParseURI(p.URI())
+	require.NoError(t, err)
+	assert.Equal(t, p, got)
+}
+
+func TestPayload_DefaultPortOmitted(t *testing.T) {
+	p := &Payload{DeviceID: "dev", Port: defaultPort}
+	uri := p.URI()
+	assert.Equal(t, "boardingpass://onboard?id=dev&v=1", uri)
+
+	got, err := ParseURI(uri)
+	require.NoError(t, err)
+	assert.Equal(t, defaultPort, got.Port)
+}
+
+func TestPayload_Addresses(t *testing.T) {
+	p := &Payload{Transports: []Transport{
+		{Type: "ethernet", Address: "10.0.0.1"},
+		{Type: "usb"},
+		{Type: "wifi", Address: "10.0.0.1"},
+		{Type: "bluetooth", Address: "10.0.1.1"},
+	}}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.1.1"}, p.Addresses())
+}
+
+func TestParseURI_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+	}{
+		{"wrong scheme", "https://onboard?v=1"},
+		{"wrong host", "boardingpass://device?v=1"},
+		{"missing version", "boardingpass://onboard?id=x"},
+		{"future version", "boardingpass://onboard?v=2"},
+		{"port out of range", "boardingpass://onboard?v=1&port=70000"},
+		{"bad transport address", "boardingpass://onboard?v=1&t=wifi@not-an-ip"},
+		{"empty transport type", "boardingpass://onboard?v=1&t=@10.0.0.1"},
+		{"bad fingerprint", "boardingpass://onboard?v=1&fp=MD5:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseURI(tt.uri)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPayload_QRCode(t *testing.T) {
+	p := &Payload{DeviceID: "dev", Transports: []Transport{{Type: "wifi", Address: "10.0.0.1"}}}
+	c, err := p.QRCode()
+	require.NoError(t, err)
+	assert.Equal(t, LevelM, c.Level)
+}
@@ -0,0 +1,88 @@
+package qr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// QuietZone is the width of the light border around the symbol, in modules.
+const QuietZone = 4
+
+// Terminal renders the code using Unicode half blocks, two module rows per
+// text line. Light modules are drawn with block characters and dark modules
+// are left as background, which renders correctly on dark terminal themes.
+func (c *Code) Terminal() string {
+	var b strings.Builder
+	lo, hi := -QuietZone, c.Size+QuietZone
+	for y := lo; y < hi; y += 2 {
+		for x := lo; x < hi; x++ {
+			top, bottom := c.Dark(x, y), c.Dark(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune(' ')
+			case top:
+				b.WriteRune('▄')
+			case bottom:
+				b.WriteRune('▀')
+			default:
+				b.WriteRune('█')
+			}
+		}
+		b.WriteRune('\n')
+	}
+	return b.String()
+}
+
+// Image renders the code as a grayscale image with scale pixels per module.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	dim := (c.Size + 2*QuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, dim, dim))
+	for py := range dim {
+		for px := range dim {
+			v := color.Gray{Y: 0xFF}
+			if c.Dark(px/scale-QuietZone, py/scale-QuietZone) {
+				v = color.Gray{Y: 0x00}
+			}
+			img.SetGray(px, py, v)
+		}
+	}
+	return img
+}
+
+// WritePNG writes the code as a PNG image with scale pixels per module.
+func (c *Code) WritePNG(w io.Writer, scale int) error {
+	if err := png.Encode(w, c.Image(scale)); err != nil {
+		return fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return nil
+}
+
+// SVG renders the code as a standalone SVG document. Each module is one user
+// unit, so the image scales cleanly to any size.
+func (c *Code) SVG() string {
+	dim := c.Size + 2*QuietZone
+
+	var path strings.Builder
+	for y := range c.Size {
+		for x := range c.Size {
+			if c.Dark(x, y) {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+QuietZone, y+QuietZone)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", dim, dim)
+	b.WriteString(`<rect width="100%" height="100%" fill="#FFFFFF"/>` + "\n")
+	fmt.Fprintf(&b, `<path d="%s" fill="#000000"/>`+"\n", path.String())
+	b.WriteString("</svg>\n")
+	return b.String()
+}
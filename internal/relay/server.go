@@ -0,0 +1,217 @@
+// Package relay reaches BoardingPass services that cannot accept incoming
+// connections, e.g. behind NAT. The service dials a rendezvous server over
+// a TLS WebSocket and serves streams multiplexed over it (see internal/mux).
+// For each operator connection, the rendezvous server opens a stream to the
+// device and splices the two, so TLS to the service runs end to end and the
+// rendezvous server only ever sees ciphertext.
+//
+// Endpoints of the rendezvous server:
+//
+//	GET /devices              devices with an open tunnel (JSON)
+//	GET /devices/{id}         operator connection to a device (WebSocket)
+//	GET /devices/{id}/tunnel  device tunnel (WebSocket, optional bearer token)
+package relay
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/mux"
+)
+
+// streamOpenTimeout bounds opening a stream to a device for an operator.
+const streamOpenTimeout = 10 * time.Second
+
+// DeviceURL returns the URL operators connect to a device through.
+func DeviceURL(base, id string) string {
+	return strings.TrimSuffix(base, "/") + "/devices/" + url.PathEscape(id)
+}
+
+// TunnelURL returns the URL a device opens its tunnel to.
+func TunnelURL(base, id string) string {
+	return DeviceURL(base, id) + "/tunnel"
+}
+
+// Device describes a device with an open tunnel.
+type Device struct {
+	ID          string    `json:"id" yaml:"id"`
+	RemoteAddr  string    `json:"remote_addr" yaml:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at" yaml:"connected_at"`
+}
+
+// tunnel is a device's multiplexed connection to the server.
+type tunnel struct {
+	Device
+	session *mux.Session
+}
+
+// Server is a rendezvous server that devices keep a tunnel open to and
+// operators connect through.
+type Server struct {
+	token    string
+	routes   *http.ServeMux
+	mu       sync.Mutex
+	tunnels  map[string]*tunnel
+	onTunnel func(dev Device, connected bool)
+}
+
+// NewServer creates a rendezvous server. If token is not empty, devices
+// must present it as a bearer token to open a tunnel.
+func NewServer(token string) *Server {
+	s := &Server{
+		token:   token,
+		routes:  http.NewServeMux(),
+		tunnels: make(map[string]*tunnel),
+	}
+	s.routes.HandleFunc("GET /devices", s.handleList)
+	s.routes.HandleFunc("GET /devices/{id}", s.handleConnect)
+	s.routes.HandleFunc("GET /devices/{id}/tunnel", s.handleTunnel)
+	return s
+}
+
+// SetTunnelCallback registers a function called when a device opens or
+// loses its tunnel.
+func (s *Server) SetTunnelCallback(fn func(dev Device, connected bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onTunnel = fn
+}
+
+// Devices returns the devices with an open tunnel, sorted by ID.
+func (s *Server) Devices() []Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices := make([]Device, 0, len(s.tunnels))
+	for _, t := range s.tunnels {
+		devices = append(devices, t.Device)
+	}
+	slices.SortFunc(devices, func(a, b Device) int { return strings.Compare(a.ID, b.ID) })
+	return devices
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.routes.ServeHTTP(w, r)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Devices())
+}
+
+// handleTunnel accepts a device tunnel, replacing an earlier tunnel of the
+// same device, e.g. one that went stale when the device lost its network.
+func (s *Server) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	conn, err := Upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	t := &tunnel{
+		Device:  Device{ID: id, RemoteAddr: r.RemoteAddr, ConnectedAt: time.Now()},
+		session: mux.Client(conn, mux.Addr{Net: "relay", Name: id}),
+	}
+	s.mu.Lock()
+	old := s.tunnels[id]
+	s.tunnels[id] = t
+	onTunnel := s.onTunnel
+	s.mu.Unlock()
+
+	if old != nil {
+		_ = old.session.Close()
+	}
+	if onTunnel != nil {
+		onTunnel(t.Device, true)
+	}
+
+	<-t.session.Done()
+
+	s.mu.Lock()
+	if s.tunnels[id] == t {
+		delete(s.tunnels, id)
+	}
+	s.mu.Unlock()
+	if onTunnel != nil {
+		onTunnel(t.Device, false)
+	}
+}
+
+// handleConnect opens a stream to the device and splices it with the
+// operator's connection.
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	t := s.tunnels[id]
+	s.mu.Unlock()
+	if t == nil {
+		http.Error(w, fmt.Sprintf("device %s is not connected", id), http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), streamOpenTimeout)
+	stream, err := t.session.Open(ctx)
+	cancel()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to reach device %s: %v", id, err), http.StatusBadGateway)
+		return
+	}
+
+	conn, err := Upgrade(w, r)
+	if err != nil {
+		_ = stream.Close()
+		return
+	}
+	splice(conn, stream)
+}
+
+// Close closes all tunnels.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	tunnels := make([]*tunnel, 0, len(s.tunnels))
+	for _, t := range s.tunnels {
+		tunnels = append(tunnels, t)
+	}
+	s.mu.Unlock()
+
+	for _, t := range tunnels {
+		_ = t.session.Close()
+	}
+	return nil
+}
+
+// splice copies data between two connections until either side ends, then
+// closes both.
+func splice(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	copyTo := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go copyTo(a, b)
+	go copyTo(b, a)
+
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+	<-done
+}
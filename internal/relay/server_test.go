@@ -0,0 +1,150 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fzdarsky/boardingpass/internal/mux"
+)
+
+// newTestRelay starts a rendezvous server and returns its wss:// base URL
+// and a TLS configuration trusting it.
+func newTestRelay(t *testing.T, token string) (*Server, string, *tls.Config) {
+	t.Helper()
+	relay := NewServer(token)
+	ts := httptest.NewTLSServer(relay)
+	t.Cleanup(func() {
+		_ = relay.Close()
+		ts.Close()
+	})
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	return relay, "wss://" + strings.TrimPrefix(ts.URL, "https://"), tlsConfig
+}
+
+// openTunnel connects a fake device that echoes every stream back.
+func openTunnel(t *testing.T, base, id string, tlsConfig *tls.Config, header http.Header) *mux.Session {
+	t.Helper()
+	conn, err := Dial(context.Background(), TunnelURL(base, id), tlsConfig, header)
+	require.NoError(t, err)
+	session := mux.Server(conn, mux.Addr{Net: "relay", Name: id})
+	t.Cleanup(func() { _ = session.Close() })
+
+	go func() {
+		for {
+			stream, err := session.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = stream.Close() }()
+				_, _ = io.Copy(stream, stream)
+			}()
+		}
+	}()
+	return session
+}
+
+func waitForDevices(t *testing.T, s *Server, n int) []Device {
+	t.Helper()
+	require.Eventually(t, func() bool { return len(s.Devices()) == n }, 2*time.Second, 10*time.Millisecond)
+	return s.Devices()
+}
+
+func TestServer_RoundTrip(t *testing.T) {
+	server, base, tlsConfig := newTestRelay(t, "")
+	openTunnel(t, base, "SN 1234", tlsConfig, nil)
+	devices := waitForDevices(t, server, 1)
+	assert.Equal(t, "SN 1234", devices[0].ID)
+
+	// Each operator connection is a separate stream to the device
+	for _, msg := range []string{"hello", strings.Repeat("x", 3*maxFramePayload/2)} {
+		conn, err := Dial(context.Background(), DeviceURL(base, "SN 1234"), tlsConfig, nil)
+		require.NoError(t, err)
+
+		go func() { _, _ = conn.Write([]byte(msg)) }()
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(buf))
+		require.NoError(t, conn.Close())
+	}
+
+	// Devices are listed as JSON
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(strings.Replace(base, "wss://", "https://", 1) + "/devices")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var listed []Device
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, "SN 1234", listed[0].ID)
+}
+
+func TestServer_UnknownDevice(t *testing.T) {
+	_, base, tlsConfig := newTestRelay(t, "")
+	_, err := Dial(context.Background(), DeviceURL(base, "missing"), tlsConfig, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+	assert.Contains(t, err.Error(), "device missing is not connected")
+}
+
+func TestServer_Token(t *testing.T) {
+	server, base, tlsConfig := newTestRelay(t, "secret")
+
+	_, err := Dial(context.Background(), TunnelURL(base, "dev"), tlsConfig, nil)
+	assert.ErrorContains(t, err, "401")
+	_, err = Dial(context.Background(), TunnelURL(base, "dev"), tlsConfig,
+		http.Header{"Authorization": {"Bearer wrong"}})
+	assert.ErrorContains(t, err, "401")
+
+	openTunnel(t, base, "dev", tlsConfig, http.Header{"Authorization": {"Bearer secret"}})
+	waitForDevices(t, server, 1)
+}
+
+func TestServer_ReplacesTunnel(t *testing.T) {
+	server, base, tlsConfig := newTestRelay(t, "")
+
+	var events []bool
+	connected := make(chan bool, 4)
+	server.SetTunnelCallback(func(_ Device, c bool) { connected <- c })
+
+	first := openTunnel(t, base, "dev", tlsConfig, nil)
+	events = append(events, <-connected)
+	openTunnel(t, base, "dev", tlsConfig, nil)
+	events = append(events, <-connected, <-connected)
+
+	// The stale tunnel is closed; the new one stays listed
+	select {
+	case <-first.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("first tunnel was not closed")
+	}
+	assert.ElementsMatch(t, []bool{true, true, false}, events)
+	assert.Len(t, server.Devices(), 1)
+}
+
+func TestDial_InvalidURL(t *testing.T) {
+	for _, u := range []string{"https://relay.example.com", "ws://relay.example.com", "wss://"} {
+		_, err := Dial(context.Background(), u, nil, nil)
+		assert.ErrorContains(t, err, "invalid relay URL", u)
+	}
+}
+
+func TestUpgrade_RequiresWebSocket(t *testing.T) {
+	_, base, tlsConfig := newTestRelay(t, "")
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(strings.Replace(TunnelURL(base, "dev"), "wss://", "https://", 1))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+}
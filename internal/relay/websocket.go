@@ -0,0 +1,399 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // G505: SHA-1 is mandated by the WebSocket handshake (RFC 6455 Section 4.2.2)
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the client key to derive the accept key.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes (RFC 6455 Section 5.2).
+const (
+	opContinuation byte = 0x0
+	opText         byte = 0x1
+	opBinary       byte = 0x2
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xA
+)
+
+const (
+	// maxFramePayload bounds the frames a connection accepts and sends.
+	maxFramePayload = 1 << 20
+	// maxControlPayload is the largest payload of a control frame.
+	maxControlPayload = 125
+	// closeTimeout bounds sending the close frame.
+	closeTimeout = time.Second
+)
+
+// conn carries a byte stream in binary WebSocket messages. Only the data
+// methods are overridden; addresses and deadlines are those of the
+// underlying connection.
+type conn struct {
+	net.Conn
+	br     *bufio.Reader
+	client bool // frames sent by the client are masked
+
+	rmu       sync.Mutex
+	remaining int64 // unread payload of the current data frame
+	readErr   error // sticky, once the stream ended
+	mask      [4]byte
+	masked    bool
+	maskPos   int
+
+	wmu        sync.Mutex
+	closeSent  bool
+	closeOnce  sync.Once
+	closeError error
+}
+
+func newConn(nc net.Conn, br *bufio.Reader, client bool) *conn {
+	return &conn{Conn: nc, br: br, client: client}
+}
+
+// Read reads payload data from binary messages, answering pings and
+// returning io.EOF once the peer closes the connection.
+func (c *conn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for c.remaining == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		c.readErr = c.nextFrame()
+	}
+
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.br.Read(b)
+	c.unmask(b[:n])
+	c.remaining -= int64(n)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// nextFrame reads frame headers, handling control frames, until a data
+// frame starts.
+func (c *conn) nextFrame() error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return err
+	}
+	opcode := hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+	if hdr[0]&0x70 != 0 {
+		return errors.New("websocket: unexpected reserved bits")
+	}
+	if masked == c.client {
+		return errors.New("websocket: frame masking does not match the sender's role")
+	}
+
+	length := int64(hdr[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+	if length > maxFramePayload {
+		return fmt.Errorf("websocket: frame of %d bytes exceeds limit", length)
+	}
+
+	c.masked = masked
+	c.maskPos = 0
+	if masked {
+		if _, err := io.ReadFull(c.br, c.mask[:]); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case opBinary, opContinuation:
+		c.remaining = length
+		return nil
+	case opText:
+		return errors.New("websocket: unexpected text message")
+	case opClose, opPing, opPong:
+		if length > maxControlPayload {
+			return errors.New("websocket: control frame too large")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		c.unmask(payload)
+		switch opcode {
+		case opPing:
+			return c.writeFrame(opPong, payload)
+		case opClose:
+			_ = c.sendClose()
+			return io.EOF
+		}
+		return nil
+	default:
+		return fmt.Errorf("websocket: unknown opcode %#x", opcode)
+	}
+}
+
+func (c *conn) unmask(b []byte) {
+	if !c.masked {
+		return
+	}
+	for i := range b {
+		b[i] ^= c.mask[c.maskPos&3]
+		c.maskPos++
+	}
+}
+
+// Write sends b in binary messages.
+func (c *conn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := min(len(b), maxFramePayload)
+		if err := c.writeFrame(opBinary, b[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// writeFrame sends a single final frame, masking it on the client side.
+func (c *conn) writeFrame(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|opcode)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n)) // #nosec G115 - bounded by the case
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n)) // #nosec G115 - length is non-negative
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		for i := range payload {
+			buf[start+i] ^= mask[i&3]
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	_, err := c.Conn.Write(buf)
+	return err
+}
+
+// sendClose sends a normal closure frame, unless one was sent already.
+func (c *conn) sendClose() error {
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	return c.writeFrame(opClose, []byte{0x03, 0xE8}) // 1000: normal closure
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.sendClose()
+		c.closeError = c.Conn.Close()
+	})
+	return c.closeError
+}
+
+// Dial opens a WebSocket connection to a wss:// URL. The header is sent
+// with the handshake, e.g. to authenticate.
+func Dial(ctx context.Context, rawURL string, tlsConfig *tls.Config, header http.Header) (net.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay URL: %w", err)
+	}
+	if u.Scheme != "wss" || u.Host == "" {
+		return nil, fmt.Errorf("invalid relay URL %q: must be wss://<host>[:port]/...", rawURL)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+	cfg.NextProtos = []string{"http/1.1"}
+
+	dialer := &tls.Dialer{Config: cfg}
+	nc, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort the handshake when ctx is done
+	stop := context.AfterFunc(ctx, func() { _ = nc.SetDeadline(time.Unix(1, 0)) })
+	br, err := clientHandshake(nc, u, header)
+	if !stop() || err != nil {
+		_ = nc.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return newConn(nc, br, true), nil
+}
+
+// clientHandshake upgrades the connection and returns a reader positioned
+// after the server's response.
+func clientHandshake(nc net.Conn, u *url.URL, header http.Header) (*bufio.Reader, error) {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header.Clone(),
+		Host:       u.Host,
+	}
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(nc); err != nil {
+		return nil, fmt.Errorf("failed to send handshake: %w", err)
+	}
+
+	br := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handshake response: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer func() { _ = resp.Body.Close() }()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if text := strings.TrimSpace(string(msg)); text != "" {
+			return nil, fmt.Errorf("relay refused connection: %s: %s", resp.Status, text)
+		}
+		return nil, fmt.Errorf("relay refused connection: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, errors.New("relay returned an invalid WebSocket accept key")
+	}
+	return br, nil
+}
+
+// Upgrade completes the WebSocket handshake for a request and takes over
+// its connection. On failure, an error response has been written.
+func Upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a WebSocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing WebSocket key", http.StatusBadRequest)
+		return nil, errors.New("missing WebSocket key")
+	}
+
+	nc, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("failed to take over connection: %w", err)
+	}
+	_ = nc.SetDeadline(time.Time{})
+
+	_, err = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	if err == nil {
+		err = brw.Flush()
+	}
+	if err != nil {
+		_ = nc.Close()
+		return nil, fmt.Errorf("failed to send handshake response: %w", err)
+	}
+	return newConn(nc, brw.Reader, false), nil
+}
+
+// acceptKey derives the Sec-WebSocket-Accept value for a client key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID)) //nolint:gosec // G401: mandated by RFC 6455
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken reports whether a comma-separated header contains
+// a token, ignoring case.
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
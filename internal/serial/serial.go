@@ -0,0 +1,33 @@
+// Package serial opens serial devices (UARTs, USB ACM gadgets and adapters)
+// as raw byte streams for the multiplexed serial transport.
+package serial
+
+import (
+	"fmt"
+	"os"
+)
+
+// DefaultBaudRate is used when no baud rate is configured. USB ACM devices
+// ignore the baud rate.
+const DefaultBaudRate = 115200
+
+// Open opens a serial device in raw mode at the given baud rate
+// (DefaultBaudRate if zero).
+func Open(path string, baud int) (*os.File, error) {
+	if baud == 0 {
+		baud = DefaultBaudRate
+	}
+
+	//nolint:gosec // G304: device path comes from configuration or the command line
+	f, err := os.OpenFile(path, os.O_RDWR|noCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open serial device %s: %w", path, err)
+	}
+
+	if err := configure(f, baud); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to configure serial device %s: %w", path, err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,49 @@
+package serial_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/serial"
+	"github.com/fzdarsky/boardingpass/internal/serial/serialtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen_RawMode(t *testing.T) {
+	master, path := serialtest.OpenPTY(t)
+
+	port, err := serial.Open(path, 0)
+	require.NoError(t, err)
+	defer func() { _ = port.Close() }()
+
+	// Every byte value, including CR, LF, ^C and XOFF, must pass unchanged
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	go func() { _, _ = master.Write(data) }()
+	got := make([]byte, len(data))
+	_, err = io.ReadFull(port, got)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	go func() { _, _ = port.Write(data) }()
+	_, err = io.ReadFull(master, got)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestOpen_Errors(t *testing.T) {
+	_, path := serialtest.OpenPTY(t)
+
+	_, err := serial.Open(path, 12345)
+	assert.ErrorContains(t, err, "unsupported baud rate 12345")
+
+	_, err = serial.Open("/dev/nonexistent-tty", 0)
+	assert.Error(t, err)
+
+	assert.True(t, serial.SupportedBaudRate(115200))
+	assert.False(t, serial.SupportedBaudRate(12345))
+}
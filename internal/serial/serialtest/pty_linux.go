@@ -0,0 +1,48 @@
+// Package serialtest provides pseudo-terminal pairs for testing serial transports.
+package serialtest
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenPTY allocates a pseudo-terminal and returns its master side and the
+// path of the slave device, which behaves like a serial port. The master
+// is closed when the test finishes.
+func OpenPTY(t testing.TB) (*os.File, string) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("pseudo-terminals unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = master.Close()
+	})
+
+	fd := int(master.Fd()) // #nosec G115 - file descriptors fit in int
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatalf("failed to unlock pty: %v", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatalf("failed to get pty number: %v", err)
+	}
+
+	// Put the master side into raw mode too, so bytes pass through unchanged
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		t.Fatalf("failed to get pty attributes: %v", err)
+	}
+	termios.Iflag &^= unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		t.Fatalf("failed to set pty attributes: %v", err)
+	}
+
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
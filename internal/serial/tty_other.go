@@ -0,0 +1,24 @@
+//go:build !linux
+
+package serial
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+const noCTTY = syscall.O_NOCTTY
+
+// SupportedBaudRate reports whether baud can be configured on this platform.
+// Outside Linux only the default is accepted; set other rates with stty(1).
+func SupportedBaudRate(baud int) bool {
+	return baud == DefaultBaudRate
+}
+
+// configure puts the terminal into raw mode. The baud rate is left as is.
+func configure(f *os.File, _ int) error {
+	_, err := term.MakeRaw(int(f.Fd())) // #nosec G115 - file descriptors fit in int
+	return err
+}
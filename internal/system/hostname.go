@@ -0,0 +1,66 @@
+package system
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const (
+	hostnameService   = "org.freedesktop.hostname1"
+	hostnamePath      = dbus.ObjectPath("/org/freedesktop/hostname1")
+	hostnameInterface = "org.freedesktop.hostname1"
+
+	// maxHostnameLength is the kernel's HOST_NAME_MAX.
+	maxHostnameLength = 64
+	// maxPrettyHostnameLength is the limit of systemd-hostnamed.
+	maxPrettyHostnameLength = 255
+)
+
+// SetHostname sets the static and transient hostname and, if given, the
+// pretty hostname, like 'hostnamectl set-hostname' does.
+func (m *Manager) SetHostname(ctx context.Context, cfg *protocol.HostnameConfig) error {
+	if err := validateHostnameConfig(cfg); err != nil {
+		return err
+	}
+
+	if _, err := m.bus.Call(ctx, hostnameService, hostnamePath, hostnameInterface,
+		"SetStaticHostname", cfg.Hostname, false); err != nil {
+		return callError(err, "set static hostname", "hostname")
+	}
+	if _, err := m.bus.Call(ctx, hostnameService, hostnamePath, hostnameInterface,
+		"SetHostname", cfg.Hostname, false); err != nil {
+		return callError(err, "set transient hostname", "hostname")
+	}
+	if cfg.PrettyHostname != "" {
+		if _, err := m.bus.Call(ctx, hostnameService, hostnamePath, hostnameInterface,
+			"SetPrettyHostname", cfg.PrettyHostname, false); err != nil {
+			return callError(err, "set pretty hostname", "pretty_hostname")
+		}
+	}
+	return nil
+}
+
+func validateHostnameConfig(cfg *protocol.HostnameConfig) error {
+	var errs fieldErrors
+	switch {
+	case cfg.Hostname == "":
+		errs.add("hostname", "must not be empty")
+	case len(cfg.Hostname) > maxHostnameLength:
+		errs.add("hostname", "must not be longer than %d characters", maxHostnameLength)
+	case !command.IsHostname(cfg.Hostname) || strings.HasSuffix(cfg.Hostname, "."):
+		errs.add("hostname", "%q is not a valid hostname", cfg.Hostname)
+	}
+
+	if len(cfg.PrettyHostname) > maxPrettyHostnameLength {
+		errs.add("pretty_hostname", "must not be longer than %d characters", maxPrettyHostnameLength)
+	} else if !utf8.ValidString(cfg.PrettyHostname) || strings.ContainsFunc(cfg.PrettyHostname, unicode.IsControl) {
+		errs.add("pretty_hostname", "must be valid UTF-8 without control characters")
+	}
+	return errs.err()
+}
@@ -0,0 +1,312 @@
+package system
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const (
+	nmService             = "org.freedesktop.NetworkManager"
+	nmPath                = dbus.ObjectPath("/org/freedesktop/NetworkManager")
+	nmInterface           = "org.freedesktop.NetworkManager"
+	nmDeviceInterface     = "org.freedesktop.NetworkManager.Device"
+	nmActiveInterface     = "org.freedesktop.NetworkManager.Connection.Active"
+	nmConnectionInterface = "org.freedesktop.NetworkManager.Settings.Connection"
+
+	errUnknownDevice = "org.freedesktop.NetworkManager.UnknownDevice"
+
+	// IP configuration methods accepted in protocol.IPConfig
+	methodAuto     = "auto"
+	methodManual   = "manual"
+	methodDisabled = "disabled"
+)
+
+// secretSettings are the connection settings that may hold secrets.
+// NetworkManager omits secrets from GetSettings, and Update would drop them
+// if they were not sent back.
+var secretSettings = []string{"802-11-wireless-security", "802-1x", "pppoe", "gsm", "cdma", "wireguard", "vpn"}
+
+// interfaceNamePattern matches Linux interface names (IFNAMSIZ - 1 bytes).
+var interfaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,15}$`)
+
+// nmPropertyError matches NetworkManager's messages for invalid settings,
+// like "ipv4.gateway: gateway is invalid".
+var nmPropertyError = regexp.MustCompile(`^(ipv[46])\.([a-z-]+): (.+)$`)
+
+// ConfigureInterface updates the IP configuration of the NetworkManager
+// connection of the named interface and reactivates it, like the set-ip and
+// set-dns scripts do with nmcli. It uses the interface's active connection,
+// or else the first one available for it.
+func (m *Manager) ConfigureInterface(ctx context.Context, name string, cfg *protocol.InterfaceConfig) error {
+	if !interfaceNamePattern.MatchString(name) {
+		return protocol.NewInterfaceNotFoundError(name)
+	}
+	if err := validateInterfaceConfig(cfg); err != nil {
+		return err
+	}
+
+	device, err := m.device(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.deviceConnection(ctx, device)
+	if err != nil {
+		return err
+	}
+	if conn == "" {
+		return protocol.NewNetworkError(fmt.Sprintf("no NetworkManager connection found for interface %s", name))
+	}
+
+	settings, err := m.connectionSettings(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if cfg.IPv4 != nil {
+		applyIPConfig(settings, "ipv4", cfg.IPv4)
+	}
+	if cfg.IPv6 != nil {
+		applyIPConfig(settings, "ipv6", cfg.IPv6)
+	}
+
+	if _, err := m.bus.Call(ctx, nmService, conn, nmConnectionInterface, "Update", settings); err != nil {
+		return updateError(err)
+	}
+	if _, err := m.bus.Call(ctx, nmService, nmPath, nmInterface,
+		"ActivateConnection", conn, device, dbus.ObjectPath("/")); err != nil {
+		return fmt.Errorf("failed to activate connection on %s: %w", name, err)
+	}
+	return nil
+}
+
+// device returns the NetworkManager device of the named interface.
+func (m *Manager) device(ctx context.Context, name string) (dbus.ObjectPath, error) {
+	reply, err := m.bus.Call(ctx, nmService, nmPath, nmInterface, "GetDeviceByIpIface", name)
+	if err != nil {
+		var dbusErr *dbus.Error
+		if errors.As(err, &dbusErr) && dbusErr.Name == errUnknownDevice {
+			return "", protocol.NewInterfaceNotFoundError(name)
+		}
+		return "", fmt.Errorf("failed to look up device %s: %w", name, err)
+	}
+	device, ok := reply[0].(dbus.ObjectPath)
+	if !ok {
+		return "", fmt.Errorf("unexpected reply to GetDeviceByIpIface")
+	}
+	return device, nil
+}
+
+// deviceConnection returns the settings connection active on device, or else
+// the first one available for it, or "" if there is none.
+func (m *Manager) deviceConnection(ctx context.Context, device dbus.ObjectPath) (dbus.ObjectPath, error) {
+	value, err := m.bus.GetProperty(ctx, nmService, device, nmDeviceInterface, "ActiveConnection")
+	if err != nil {
+		return "", fmt.Errorf("failed to get active connection: %w", err)
+	}
+	if active, _ := value.(dbus.ObjectPath); active != "" && active != "/" {
+		value, err := m.bus.GetProperty(ctx, nmService, active, nmActiveInterface, "Connection")
+		if err != nil {
+			return "", fmt.Errorf("failed to get connection of %s: %w", active, err)
+		}
+		if conn, _ := value.(dbus.ObjectPath); conn != "" && conn != "/" {
+			return conn, nil
+		}
+	}
+
+	value, err = m.bus.GetProperty(ctx, nmService, device, nmDeviceInterface, "AvailableConnections")
+	if err != nil {
+		return "", fmt.Errorf("failed to get available connections: %w", err)
+	}
+	if conns, _ := value.([]dbus.ObjectPath); len(conns) > 0 {
+		return conns[0], nil
+	}
+	return "", nil
+}
+
+// connectionSettings returns the settings of conn including its secrets.
+func (m *Manager) connectionSettings(ctx context.Context, conn dbus.ObjectPath) (map[string]map[string]any, error) {
+	reply, err := m.bus.Call(ctx, nmService, conn, nmConnectionInterface, "GetSettings")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings of %s: %w", conn, err)
+	}
+	settings, err := settingsOf(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range secretSettings {
+		if _, ok := settings[name]; !ok {
+			continue
+		}
+		reply, err := m.bus.Call(ctx, nmService, conn, nmConnectionInterface, "GetSecrets", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s secrets of %s: %w", name, conn, err)
+		}
+		secrets, err := settingsOf(reply)
+		if err != nil {
+			return nil, err
+		}
+		for setting, props := range secrets {
+			if settings[setting] == nil {
+				settings[setting] = map[string]any{}
+			}
+			for k, v := range props {
+				settings[setting][k] = v
+			}
+		}
+	}
+	return settings, nil
+}
+
+// settingsOf converts a decoded a{sa{sv}} reply into connection settings,
+// which encode back into the same signature.
+func settingsOf(reply []any) (map[string]map[string]any, error) {
+	if len(reply) != 1 {
+		return nil, fmt.Errorf("unexpected connection settings reply")
+	}
+	raw, ok := reply[0].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected connection settings reply")
+	}
+	settings := make(map[string]map[string]any, len(raw))
+	for name, v := range raw {
+		props, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unexpected connection settings reply")
+		}
+		settings[name] = props
+	}
+	return settings, nil
+}
+
+// applyIPConfig replaces the "ipv4" or "ipv6" setting's method, addresses,
+// gateway and DNS servers with cfg. Other properties, such as routes, are
+// kept.
+func applyIPConfig(settings map[string]map[string]any, family string, cfg *protocol.IPConfig) {
+	props := settings[family]
+	if props == nil {
+		props = map[string]any{}
+		settings[family] = props
+	}
+	// Drop the other forms of the properties set below, so they cannot
+	// conflict
+	delete(props, "addresses")
+	delete(props, "dns-data")
+
+	props["method"] = cfg.Method
+
+	addresses := make([]map[string]any, 0, len(cfg.Addresses))
+	for _, a := range cfg.Addresses {
+		prefix := netip.MustParsePrefix(a)
+		addresses = append(addresses, map[string]any{
+			"address": prefix.Addr().String(),
+			"prefix":  uint32(prefix.Bits()), // #nosec G115 - at most 128
+		})
+	}
+	props["address-data"] = addresses
+
+	if cfg.Gateway != "" {
+		props["gateway"] = cfg.Gateway
+	} else {
+		delete(props, "gateway")
+	}
+
+	// IPv4 DNS servers are integers holding the address in network byte
+	// order, IPv6 ones byte arrays
+	if family == "ipv4" {
+		dns := make([]uint32, 0, len(cfg.DNS))
+		for _, s := range cfg.DNS {
+			a := netip.MustParseAddr(s).As4()
+			dns = append(dns, binary.NativeEndian.Uint32(a[:]))
+		}
+		props["dns"] = dns
+	} else {
+		dns := make([][]byte, 0, len(cfg.DNS))
+		for _, s := range cfg.DNS {
+			a := netip.MustParseAddr(s).As16()
+			dns = append(dns, a[:])
+		}
+		props["dns"] = dns
+	}
+}
+
+// updateError turns NetworkManager's rejection of invalid settings into a
+// validation error.
+func updateError(err error) error {
+	var dbusErr *dbus.Error
+	if !errors.As(err, &dbusErr) ||
+		(dbusErr.Name != errInvalidArgs && !strings.HasSuffix(dbusErr.Name, ".InvalidProperty") &&
+			!strings.HasSuffix(dbusErr.Name, ".InvalidSetting")) {
+		return fmt.Errorf("failed to update connection: %w", err)
+	}
+
+	field, message := "", dbusErr.Message
+	if match := nmPropertyError.FindStringSubmatch(dbusErr.Message); match != nil {
+		property := match[2]
+		if property == "address-data" {
+			property = "addresses"
+		}
+		field, message = match[1]+"."+property, match[3]
+	}
+	return protocol.NewValidationError([]protocol.FieldError{{Field: field, Message: message}})
+}
+
+func validateInterfaceConfig(cfg *protocol.InterfaceConfig) error {
+	var errs fieldErrors
+	if cfg.IPv4 == nil && cfg.IPv6 == nil {
+		errs.add("ipv4", "at least one of ipv4 and ipv6 must be given")
+	}
+	if cfg.IPv4 != nil {
+		validateIPConfig(&errs, "ipv4", cfg.IPv4, netip.Addr.Is4)
+	}
+	if cfg.IPv6 != nil {
+		validateIPConfig(&errs, "ipv6", cfg.IPv6, func(a netip.Addr) bool { return a.Is6() && !a.Is4In6() })
+	}
+	return errs.err()
+}
+
+func validateIPConfig(errs *fieldErrors, family string, cfg *protocol.IPConfig, inFamily func(netip.Addr) bool) {
+	version := "IPv4"
+	if family == "ipv6" {
+		version = "IPv6"
+	}
+
+	switch cfg.Method {
+	case methodAuto:
+	case methodManual:
+		if len(cfg.Addresses) == 0 {
+			errs.add(family+".addresses", "at least one address is required for method manual")
+		}
+	case methodDisabled:
+		if len(cfg.Addresses) > 0 || cfg.Gateway != "" || len(cfg.DNS) > 0 {
+			errs.add(family+".method", "addresses, gateway and dns must be empty for method disabled")
+		}
+	default:
+		errs.add(family+".method", "must be one of %s, %s, %s", methodAuto, methodManual, methodDisabled)
+	}
+
+	for i, a := range cfg.Addresses {
+		prefix, err := netip.ParsePrefix(a)
+		if err != nil || !inFamily(prefix.Addr()) {
+			errs.add(fmt.Sprintf("%s.addresses[%d]", family, i), "%q is not an %s address with prefix length", a, version)
+		}
+	}
+	if cfg.Gateway != "" {
+		if addr, err := netip.ParseAddr(cfg.Gateway); err != nil || addr.Zone() != "" || !inFamily(addr) {
+			errs.add(family+".gateway", "%q is not an %s address", cfg.Gateway, version)
+		}
+	}
+	for i, s := range cfg.DNS {
+		if addr, err := netip.ParseAddr(s); err != nil || addr.Zone() != "" || !inFamily(addr) {
+			errs.add(fmt.Sprintf("%s.dns[%d]", family, i), "%q is not an %s address", s, version)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package system applies typed provisioning settings — hostname, time,
+// proxy and network interface configuration — through the D-Bus APIs of
+// systemd-hostnamed, systemd-timedated, systemd and NetworkManager.
+//
+// It replaces the set-hostname, set-ip, set-dns and set-ntp helper scripts
+// for clients that use the typed endpoints. The D-Bus calls are authorized by
+// polkit (see build/boardingpass.rules); the few files that have no D-Bus
+// API, the chrony sources and the proxy environment, are written with sudo.
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const (
+	systemdService   = "org.freedesktop.systemd1"
+	systemdPath      = dbus.ObjectPath("/org/freedesktop/systemd1")
+	systemdInterface = "org.freedesktop.systemd1.Manager"
+
+	errInvalidArgs = "org.freedesktop.DBus.Error.InvalidArgs"
+)
+
+// Manager applies system settings.
+type Manager struct {
+	bus     *dbus.Conn
+	rootDir string
+}
+
+// NewManager creates a Manager that talks to the services on bus.
+// Files are written below rootDir, or with sudo to the real file system if
+// rootDir is empty or "/".
+func NewManager(bus *dbus.Conn, rootDir string) *Manager {
+	if rootDir == "/" {
+		rootDir = ""
+	}
+	return &Manager{bus: bus, rootDir: rootDir}
+}
+
+// RestartUnit restarts a systemd unit, starting it if it is not running.
+func (m *Manager) RestartUnit(ctx context.Context, unit string) error {
+	if _, err := m.bus.Call(ctx, systemdService, systemdPath, systemdInterface,
+		"RestartUnit", unit, "replace"); err != nil {
+		return fmt.Errorf("failed to restart %s: %w", unit, err)
+	}
+	return nil
+}
+
+// writeFile replaces the file at path with data, readable by everyone and
+// owned by root, creating parent directories as needed.
+func (m *Manager) writeFile(ctx context.Context, path string, data []byte) error {
+	if m.rootDir != "" {
+		path = filepath.Join(m.rootDir, path)
+		//nolint:gosec // G301: directories below /etc are world-readable
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", path, err)
+		}
+		//nolint:gosec // G306: configuration files are world-readable
+		return os.WriteFile(path, data, 0o644)
+	}
+
+	tmp, err := os.CreateTemp("", "boardingpass-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write staging file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write staging file: %w", err)
+	}
+
+	//nolint:gosec // G204: path is one of the package's fixed file paths
+	cmd := exec.CommandContext(ctx, "sudo", "install", "-D", "-m", "0644", tmp.Name(), path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sudo install %s failed: %s: %w", path, out, err)
+	}
+	return nil
+}
+
+// removeFile removes the file at path if it exists.
+func (m *Manager) removeFile(ctx context.Context, path string) error {
+	if m.rootDir != "" {
+		if err := os.Remove(filepath.Join(m.rootDir, path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	//nolint:gosec // G204: path is one of the package's fixed file paths
+	cmd := exec.CommandContext(ctx, "sudo", "rm", "-f", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sudo rm %s failed: %s: %w", path, out, err)
+	}
+	return nil
+}
+
+// callError turns a D-Bus error rejecting the arguments of a call into a
+// validation error for field, and wraps other errors with what failed.
+func callError(err error, what, field string) error {
+	var dbusErr *dbus.Error
+	if errors.As(err, &dbusErr) && dbusErr.Name == errInvalidArgs {
+		return protocol.NewValidationError([]protocol.FieldError{{Field: field, Message: dbusErr.Message}})
+	}
+	return fmt.Errorf("failed to %s: %w", what, err)
+}
+
+// fieldErrors collects validation errors of a request.
+type fieldErrors []protocol.FieldError
+
+func (f *fieldErrors) add(field, format string, args ...any) {
+	*f = append(*f, protocol.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns a validation error for the collected errors, or nil if there
+// are none.
+func (f fieldErrors) err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return protocol.NewValidationError(f)
+}
@@ -0,0 +1,544 @@
+package system_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/internal/dbus/dbustest"
+	"github.com/fzdarsky/boardingpass/internal/system"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDevice     = dbus.ObjectPath("/org/freedesktop/NetworkManager/Devices/2")
+	testActive     = dbus.ObjectPath("/org/freedesktop/NetworkManager/ActiveConnection/1")
+	testConnection = dbus.ObjectPath("/org/freedesktop/NetworkManager/Settings/1")
+
+	testEthernet      = dbus.ObjectPath("/org/freedesktop/NetworkManager/Devices/1")
+	testNewConnection = dbus.ObjectPath("/org/freedesktop/NetworkManager/Settings/2")
+	testNewActive     = dbus.ObjectPath("/org/freedesktop/NetworkManager/ActiveConnection/2")
+	testIP4Config     = dbus.ObjectPath("/org/freedesktop/NetworkManager/IP4Config/2")
+	testAP1           = dbus.ObjectPath("/org/freedesktop/NetworkManager/AccessPoint/1")
+	testAP2           = dbus.ObjectPath("/org/freedesktop/NetworkManager/AccessPoint/2")
+)
+
+// fakeServices implements the parts of hostnamed, timedated, systemd and
+// NetworkManager used by the manager, recording the calls made to them.
+type fakeServices struct {
+	conn *dbus.Conn
+
+	mu    sync.Mutex
+	calls []*dbus.Message
+	fail  map[string]*dbus.Error // method -> error to reply with
+
+	settings map[string]map[string]any // NetworkManager connection settings
+	secrets  map[string]map[string]any
+
+	lastScan    int64  // LastScan of the WiFi device, advanced by RequestScan
+	activeState uint32 // State of connections added by AddAndActivateConnection
+	stateReason uint32 // reason of the WiFi device's last state change
+}
+
+func newFakeServices(t *testing.T, bus *dbustest.Bus) *fakeServices {
+	t.Helper()
+	f := &fakeServices{
+		conn: bus.Dial(t),
+		fail: map[string]*dbus.Error{},
+		settings: map[string]map[string]any{
+			"connection": {"id": dbus.MakeVariant("office"), "type": dbus.MakeVariant("802-11-wireless")},
+			"802-11-wireless-security": {
+				"key-mgmt": dbus.MakeVariant("wpa-psk"),
+			},
+			"ipv4": {
+				"method":    dbus.MakeVariant("auto"),
+				"addresses": dbus.MakeVariant([][]uint32{}),
+				"may-fail":  dbus.MakeVariant(false),
+			},
+		},
+		secrets: map[string]map[string]any{
+			"802-11-wireless-security": {"psk": dbus.MakeVariant("secret123")},
+		},
+		lastScan:    1000,
+		activeState: 2, // activated
+	}
+
+	for _, name := range []string{"org.freedesktop.hostname1", "org.freedesktop.timedate1",
+		"org.freedesktop.systemd1", "org.freedesktop.NetworkManager"} {
+		require.NoError(t, f.conn.RequestName(context.Background(), name))
+	}
+
+	f.conn.Export("/org/freedesktop/hostname1", "org.freedesktop.hostname1", map[string]dbus.Method{
+		"SetStaticHostname": f.method(nil),
+		"SetHostname":       f.method(nil),
+		"SetPrettyHostname": f.method(nil),
+	})
+	f.conn.Export("/org/freedesktop/timedate1", "org.freedesktop.timedate1", map[string]dbus.Method{
+		"SetTimezone": f.method(nil),
+		"SetNTP":      f.method(nil),
+	})
+	f.conn.Export("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager", map[string]dbus.Method{
+		"TryRestartUnit": f.method(nil),
+	})
+	f.conn.Export("/org/freedesktop/NetworkManager", "org.freedesktop.NetworkManager", map[string]dbus.Method{
+		"GetDeviceByIpIface": f.method(func(call *dbus.Message) ([]any, error) {
+			if call.Body[0] != "wlan0" {
+				return nil, &dbus.Error{Name: "org.freedesktop.NetworkManager.UnknownDevice", Message: "No device found"}
+			}
+			return []any{testDevice}, nil
+		}),
+		"ActivateConnection": f.method(func(*dbus.Message) ([]any, error) {
+			return []any{testActive}, nil
+		}),
+		"GetDevices": f.method(func(*dbus.Message) ([]any, error) {
+			return []any{[]dbus.ObjectPath{testEthernet, testDevice}}, nil
+		}),
+		"AddAndActivateConnection": f.method(func(*dbus.Message) ([]any, error) {
+			return []any{testNewConnection, testNewActive}, nil
+		}),
+	})
+	f.conn.Export(testDevice, "org.freedesktop.NetworkManager.Device.Wireless", map[string]dbus.Method{
+		"RequestScan": f.method(func(*dbus.Message) ([]any, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.lastScan++
+			return nil, nil
+		}),
+		"GetAllAccessPoints": f.method(func(*dbus.Message) ([]any, error) {
+			return []any{[]dbus.ObjectPath{testAP1, testAP2}}, nil
+		}),
+	})
+	f.conn.Export(testNewConnection, "org.freedesktop.NetworkManager.Settings.Connection", map[string]dbus.Method{
+		"Delete": f.method(nil),
+	})
+	f.conn.Export(testConnection, "org.freedesktop.NetworkManager.Settings.Connection", map[string]dbus.Method{
+		"GetSettings": f.method(func(*dbus.Message) ([]any, error) {
+			return []any{f.settings}, nil
+		}),
+		"GetSecrets": f.method(func(*dbus.Message) ([]any, error) {
+			return []any{f.secrets}, nil
+		}),
+		"Update": f.method(nil),
+	})
+	f.conn.ExportProperties(testDevice, func() map[string]map[string]any {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return map[string]map[string]any{
+			"org.freedesktop.NetworkManager.Device": {
+				"Interface":            "wlan0",
+				"DeviceType":           uint32(2), // wifi
+				"State":                uint32(100),
+				"StateReason":          struct{ State, Reason uint32 }{100, f.stateReason},
+				"ActiveConnection":     testActive,
+				"AvailableConnections": []dbus.ObjectPath{testConnection},
+				"Ip4Config":            testIP4Config,
+				"Ip6Config":            dbus.ObjectPath("/"),
+			},
+			"org.freedesktop.NetworkManager.Device.Wireless": {
+				"LastScan": f.lastScan,
+			},
+		}
+	})
+	f.conn.ExportProperties(testEthernet, func() map[string]map[string]any {
+		return map[string]map[string]any{"org.freedesktop.NetworkManager.Device": {
+			"Interface":  "eth0",
+			"DeviceType": uint32(1), // ethernet
+		}}
+	})
+	f.conn.ExportProperties(testNewActive, func() map[string]map[string]any {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return map[string]map[string]any{"org.freedesktop.NetworkManager.Connection.Active": {
+			"State": f.activeState,
+		}}
+	})
+	f.conn.ExportProperties(testIP4Config, func() map[string]map[string]any {
+		return map[string]map[string]any{"org.freedesktop.NetworkManager.IP4Config": {
+			"AddressData": []map[string]any{{"address": "192.168.1.50", "prefix": uint32(24)}},
+		}}
+	})
+	for _, ap := range []struct {
+		path     dbus.ObjectPath
+		ssid     string
+		strength uint8
+		freq     uint32
+		rsnFlags uint32
+	}{
+		{testAP1, "guest", 40, 2437, 0},
+		{testAP2, "office", 82, 5180, 0x188}, // PSK, CCMP
+	} {
+		f.conn.ExportProperties(ap.path, func() map[string]map[string]any {
+			return map[string]map[string]any{"org.freedesktop.NetworkManager.AccessPoint": {
+				"Ssid":      []byte(ap.ssid),
+				"HwAddress": fmt.Sprintf("02:00:00:00:00:%02X", ap.strength),
+				"Strength":  ap.strength,
+				"Frequency": ap.freq,
+				"Flags":     uint32(0),
+				"WpaFlags":  uint32(0),
+				"RsnFlags":  ap.rsnFlags,
+			}}
+		})
+	}
+	f.conn.ExportProperties(testActive, func() map[string]map[string]any {
+		return map[string]map[string]any{"org.freedesktop.NetworkManager.Connection.Active": {
+			"Connection": testConnection,
+		}}
+	})
+	return f
+}
+
+// method wraps fn, if any, to record calls and to fail if set to.
+func (f *fakeServices) method(fn dbus.Method) dbus.Method {
+	return func(call *dbus.Message) ([]any, error) {
+		f.mu.Lock()
+		f.calls = append(f.calls, call)
+		err := f.fail[call.Member]
+		f.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if fn == nil {
+			return nil, nil
+		}
+		return fn(call)
+	}
+}
+
+// failWith makes calls of member fail with err.
+func (f *fakeServices) failWith(member string, err *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail[member] = err
+}
+
+// called returns the calls made as "Member args..." strings, with "…"
+// standing for container arguments.
+func (f *fakeServices) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []string
+	for _, call := range f.calls {
+		parts := []string{call.Member}
+		for _, arg := range call.Body {
+			switch arg.(type) {
+			case string, bool, dbus.ObjectPath:
+				parts = append(parts, fmt.Sprint(arg))
+			default:
+				parts = append(parts, "…")
+			}
+		}
+		calls = append(calls, strings.Join(parts, " "))
+	}
+	return calls
+}
+
+// lastCall returns the last call of member.
+func (f *fakeServices) lastCall(t *testing.T, member string) *dbus.Message {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.calls) - 1; i >= 0; i-- {
+		if f.calls[i].Member == member {
+			return f.calls[i]
+		}
+	}
+	t.Fatalf("%s was not called", member)
+	return nil
+}
+
+func newTestManager(t *testing.T) (*system.Manager, *fakeServices, string) {
+	t.Helper()
+	bus := dbustest.NewBus(t)
+	services := newFakeServices(t, bus)
+	rootDir := t.TempDir()
+	return system.NewManager(bus.Dial(t), rootDir), services, rootDir
+}
+
+// requireFieldErrors asserts that err is a validation error for fields.
+func requireFieldErrors(t *testing.T, err error, fields ...string) []protocol.FieldError {
+	t.Helper()
+	var errResp *protocol.ErrorResponse
+	require.True(t, errors.As(err, &errResp), "expected an ErrorResponse, got %v", err)
+	require.Equal(t, protocol.ErrCodeValidationFailed, errResp.Code)
+	got := make([]string, len(errResp.Fields))
+	for i, f := range errResp.Fields {
+		got[i] = f.Field
+	}
+	require.Equal(t, fields, got)
+	return errResp.Fields
+}
+
+func TestManager_SetHostname(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	err := manager.SetHostname(context.Background(), &protocol.HostnameConfig{
+		Hostname:       "edge-01",
+		PrettyHostname: "Edge Gateway 01",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"SetStaticHostname edge-01 false",
+		"SetHostname edge-01 false",
+		"SetPrettyHostname Edge Gateway 01 false",
+	}, services.called())
+}
+
+func TestManager_SetHostname_Invalid(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	tests := []struct {
+		name   string
+		cfg    protocol.HostnameConfig
+		fields []string
+	}{
+		{"empty", protocol.HostnameConfig{}, []string{"hostname"}},
+		{"invalid characters", protocol.HostnameConfig{Hostname: "edge_01"}, []string{"hostname"}},
+		{"leading hyphen", protocol.HostnameConfig{Hostname: "-edge"}, []string{"hostname"}},
+		{"trailing dot", protocol.HostnameConfig{Hostname: "edge.example.com."}, []string{"hostname"}},
+		{"too long", protocol.HostnameConfig{Hostname: strings.Repeat("a", 65)}, []string{"hostname"}},
+		{"control character", protocol.HostnameConfig{Hostname: "edge", PrettyHostname: "Edge\n01"}, []string{"pretty_hostname"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.SetHostname(context.Background(), &tt.cfg)
+			requireFieldErrors(t, err, tt.fields...)
+		})
+	}
+	assert.Empty(t, services.called())
+}
+
+func TestManager_SetHostname_Rejected(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+	services.failWith("SetStaticHostname", &dbus.Error{
+		Name:    "org.freedesktop.DBus.Error.InvalidArgs",
+		Message: "Invalid static hostname 'localhost'",
+	})
+
+	err := manager.SetHostname(context.Background(), &protocol.HostnameConfig{Hostname: "localhost"})
+	fields := requireFieldErrors(t, err, "hostname")
+	assert.Equal(t, "Invalid static hostname 'localhost'", fields[0].Message)
+}
+
+func TestManager_SetHostname_Failed(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+	services.failWith("SetStaticHostname", &dbus.Error{
+		Name:    "org.freedesktop.DBus.Error.InteractiveAuthorizationRequired",
+		Message: "Interactive authentication required.",
+	})
+
+	err := manager.SetHostname(context.Background(), &protocol.HostnameConfig{Hostname: "edge-01"})
+	require.Error(t, err)
+	var errResp *protocol.ErrorResponse
+	assert.False(t, errors.As(err, &errResp), "authorization failures are not validation errors")
+	assert.Contains(t, err.Error(), "failed to set static hostname")
+}
+
+func TestManager_SetTime(t *testing.T) {
+	manager, services, rootDir := newTestManager(t)
+	ntp := true
+
+	err := manager.SetTime(context.Background(), &protocol.TimeConfig{
+		Timezone:   "Europe/Berlin",
+		NTP:        &ntp,
+		NTPServers: []string{"ntp.example.com", "192.168.1.1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"SetTimezone Europe/Berlin false",
+		"SetNTP true false",
+		"TryRestartUnit chronyd.service replace",
+	}, services.called())
+
+	data, err := os.ReadFile(filepath.Join(rootDir, system.ChronySourcesPath))
+	require.NoError(t, err)
+	assert.Equal(t, "# Written by BoardingPass (PUT /system/time)\n"+
+		"server ntp.example.com iburst\nserver 192.168.1.1 iburst\n", string(data))
+}
+
+func TestManager_SetTime_NTPDisabled(t *testing.T) {
+	manager, services, rootDir := newTestManager(t)
+	ntp := false
+
+	err := manager.SetTime(context.Background(), &protocol.TimeConfig{
+		NTP:        &ntp,
+		NTPServers: []string{"ntp.example.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SetNTP false false"}, services.called(), "chronyd must not be restarted")
+	assert.FileExists(t, filepath.Join(rootDir, system.ChronySourcesPath))
+}
+
+func TestManager_SetTime_Invalid(t *testing.T) {
+	manager, services, rootDir := newTestManager(t)
+
+	err := manager.SetTime(context.Background(), &protocol.TimeConfig{
+		Timezone:   "../../etc/passwd",
+		NTPServers: []string{"pool.ntp.org", "ntp server", "fe80::1%eth0"},
+	})
+	requireFieldErrors(t, err, "timezone", "ntp_servers[1]", "ntp_servers[2]")
+	assert.Empty(t, services.called())
+	assert.NoFileExists(t, filepath.Join(rootDir, system.ChronySourcesPath))
+}
+
+func TestManager_SetTime_UnknownTimezone(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+	services.failWith("SetTimezone", &dbus.Error{
+		Name:    "org.freedesktop.DBus.Error.InvalidArgs",
+		Message: "Invalid or not installed time zone 'Mars/Olympus'",
+	})
+
+	err := manager.SetTime(context.Background(), &protocol.TimeConfig{Timezone: "Mars/Olympus"})
+	requireFieldErrors(t, err, "timezone")
+}
+
+func TestManager_SetProxy(t *testing.T) {
+	manager, _, rootDir := newTestManager(t)
+
+	err := manager.SetProxy(context.Background(), &protocol.ProxyConfig{
+		HTTPProxy:  "http://proxy.example.com:3128",
+		HTTPSProxy: "http://proxy.example.com:3128",
+		NoProxy:    []string{"localhost", ".example.com", "10.0.0.0/8"},
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(rootDir, system.ProxyConfPath))
+	require.NoError(t, err)
+	assert.Equal(t, "# Written by BoardingPass (PUT /system/proxy)\n[Manager]\nDefaultEnvironment="+
+		`"http_proxy=http://proxy.example.com:3128" "HTTP_PROXY=http://proxy.example.com:3128" `+
+		`"https_proxy=http://proxy.example.com:3128" "HTTPS_PROXY=http://proxy.example.com:3128" `+
+		`"no_proxy=localhost,.example.com,10.0.0.0/8" "NO_PROXY=localhost,.example.com,10.0.0.0/8"`+"\n",
+		string(data))
+
+	// An empty config removes the settings again
+	err = manager.SetProxy(context.Background(), &protocol.ProxyConfig{})
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(rootDir, system.ProxyConfPath))
+}
+
+func TestManager_SetProxy_Invalid(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	err := manager.SetProxy(context.Background(), &protocol.ProxyConfig{
+		HTTPProxy:  `http://proxy.example.com:3128" "LD_PRELOAD=/tmp/x.so`,
+		HTTPSProxy: "ftp://proxy.example.com",
+		NoProxy:    []string{"localhost", "bad entry"},
+	})
+	requireFieldErrors(t, err, "http_proxy", "https_proxy", "no_proxy[1]")
+	assert.Empty(t, services.called())
+}
+
+func TestManager_ConfigureInterface(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	err := manager.ConfigureInterface(context.Background(), "wlan0", &protocol.InterfaceConfig{
+		IPv4: &protocol.IPConfig{
+			Method:    "manual",
+			Addresses: []string{"192.168.1.10/24"},
+			Gateway:   "192.168.1.1",
+			DNS:       []string{"192.168.1.1", "9.9.9.9"},
+		},
+		IPv6: &protocol.IPConfig{
+			Method: "auto",
+			DNS:    []string{"2620:fe::fe"},
+		},
+	})
+	require.NoError(t, err)
+
+	settings := services.lastCall(t, "Update").Body[0].(map[string]any)
+	assert.Equal(t, "office", settings["connection"].(map[string]any)["id"].(dbus.Variant).Value)
+	assert.Equal(t, "secret123", settings["802-11-wireless-security"].(map[string]any)["psk"].(dbus.Variant).Value,
+		"secrets must be preserved")
+
+	ipv4 := settings["ipv4"].(map[string]any)
+	assert.Equal(t, "manual", ipv4["method"].(dbus.Variant).Value)
+	assert.Equal(t, false, ipv4["may-fail"].(dbus.Variant).Value, "other properties must be preserved")
+	assert.NotContains(t, ipv4, "addresses")
+	assert.Equal(t, "192.168.1.1", ipv4["gateway"].(dbus.Variant).Value)
+	addresses := ipv4["address-data"].(dbus.Variant).Value.([]any)
+	require.Len(t, addresses, 1)
+	address := addresses[0].(map[string]any)
+	assert.Equal(t, "192.168.1.10", address["address"].(dbus.Variant).Value)
+	assert.Equal(t, uint32(24), address["prefix"].(dbus.Variant).Value)
+	assert.Equal(t, []any{
+		binary.NativeEndian.Uint32([]byte{192, 168, 1, 1}),
+		binary.NativeEndian.Uint32([]byte{9, 9, 9, 9}),
+	}, ipv4["dns"].(dbus.Variant).Value)
+
+	ipv6 := settings["ipv6"].(map[string]any)
+	assert.Equal(t, "auto", ipv6["method"].(dbus.Variant).Value)
+	assert.Equal(t, []any{[]byte{0x26, 0x20, 0, 0xfe, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xfe}},
+		ipv6["dns"].(dbus.Variant).Value)
+
+	activate := services.lastCall(t, "ActivateConnection")
+	assert.Equal(t, []any{testConnection, testDevice, dbus.ObjectPath("/")}, activate.Body)
+}
+
+func TestManager_ConfigureInterface_UnknownDevice(t *testing.T) {
+	manager, _, _ := newTestManager(t)
+
+	err := manager.ConfigureInterface(context.Background(), "eth7", &protocol.InterfaceConfig{
+		IPv4: &protocol.IPConfig{Method: "auto"},
+	})
+	var errResp *protocol.ErrorResponse
+	require.True(t, errors.As(err, &errResp))
+	assert.Equal(t, protocol.ErrCodeInterfaceNotFound, errResp.Code)
+}
+
+func TestManager_ConfigureInterface_Invalid(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	tests := []struct {
+		name   string
+		cfg    protocol.InterfaceConfig
+		fields []string
+	}{
+		{"empty", protocol.InterfaceConfig{}, []string{"ipv4"}},
+		{"unknown method", protocol.InterfaceConfig{IPv4: &protocol.IPConfig{Method: "static"}}, []string{"ipv4.method"}},
+		{"manual without addresses", protocol.InterfaceConfig{IPv4: &protocol.IPConfig{Method: "manual"}}, []string{"ipv4.addresses"}},
+		{"disabled with addresses", protocol.InterfaceConfig{IPv6: &protocol.IPConfig{
+			Method: "disabled", Addresses: []string{"fd00::1/64"},
+		}}, []string{"ipv6.method"}},
+		{"wrong families", protocol.InterfaceConfig{
+			IPv4: &protocol.IPConfig{
+				Method:    "manual",
+				Addresses: []string{"192.168.1.10", "fd00::1/64"},
+				Gateway:   "fd00::ff",
+				DNS:       []string{"1.1.1.1", "dns.example.com"},
+			},
+			IPv6: &protocol.IPConfig{Method: "auto", DNS: []string{"::ffff:1.1.1.1"}},
+		}, []string{"ipv4.addresses[0]", "ipv4.addresses[1]", "ipv4.gateway", "ipv4.dns[1]", "ipv6.dns[0]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manager.ConfigureInterface(context.Background(), "wlan0", &tt.cfg)
+			requireFieldErrors(t, err, tt.fields...)
+		})
+	}
+	assert.Empty(t, services.called())
+}
+
+func TestManager_ConfigureInterface_Rejected(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+	services.failWith("Update", &dbus.Error{
+		Name:    "org.freedesktop.NetworkManager.Settings.Connection.InvalidProperty",
+		Message: "ipv4.address-data: 192.168.1.0/24 is a network address",
+	})
+
+	err := manager.ConfigureInterface(context.Background(), "wlan0", &protocol.InterfaceConfig{
+		IPv4: &protocol.IPConfig{Method: "manual", Addresses: []string{"192.168.1.0/24"}},
+	})
+	fields := requireFieldErrors(t, err, "ipv4.addresses")
+	assert.Equal(t, "192.168.1.0/24 is a network address", fields[0].Message)
+	for _, call := range services.called() {
+		assert.NotEqual(t, "ActivateConnection", strings.Fields(call)[0])
+	}
+}
@@ -0,0 +1,87 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const (
+	timedateService   = "org.freedesktop.timedate1"
+	timedatePath      = dbus.ObjectPath("/org/freedesktop/timedate1")
+	timedateInterface = "org.freedesktop.timedate1"
+
+	// ChronySourcesPath is the chrony configuration file the NTP servers are
+	// written to. chrony reads it if its configuration has a
+	// "confdir /etc/chrony.d" directive.
+	ChronySourcesPath = "/etc/chrony.d/boardingpass.conf"
+
+	chronyUnit = "chronyd.service"
+)
+
+// timezonePattern matches tz database names like "UTC" or
+// "America/Argentina/Buenos_Aires". Whether the zone is installed is checked
+// by timedated.
+var timezonePattern = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+
+// SetTime sets the time zone, configures chrony's NTP servers and enables or
+// disables network time synchronization. Omitted settings are left unchanged.
+func (m *Manager) SetTime(ctx context.Context, cfg *protocol.TimeConfig) error {
+	if err := validateTimeConfig(cfg); err != nil {
+		return err
+	}
+
+	if cfg.Timezone != "" {
+		if _, err := m.bus.Call(ctx, timedateService, timedatePath, timedateInterface,
+			"SetTimezone", cfg.Timezone, false); err != nil {
+			return callError(err, "set time zone", "timezone")
+		}
+	}
+
+	if len(cfg.NTPServers) > 0 {
+		var b strings.Builder
+		b.WriteString("# Written by BoardingPass (PUT /system/time)\n")
+		for _, server := range cfg.NTPServers {
+			fmt.Fprintf(&b, "server %s iburst\n", server)
+		}
+		if err := m.writeFile(ctx, ChronySourcesPath, []byte(b.String())); err != nil {
+			return fmt.Errorf("failed to write NTP servers: %w", err)
+		}
+	}
+
+	if cfg.NTP != nil {
+		if _, err := m.bus.Call(ctx, timedateService, timedatePath, timedateInterface,
+			"SetNTP", *cfg.NTP, false); err != nil {
+			return callError(err, "set NTP", "ntp")
+		}
+	}
+
+	// Make a running chronyd pick up the new servers. If synchronization
+	// is disabled, chronyd is not running and reads them when started.
+	if len(cfg.NTPServers) > 0 && (cfg.NTP == nil || *cfg.NTP) {
+		if _, err := m.bus.Call(ctx, systemdService, systemdPath, systemdInterface,
+			"TryRestartUnit", chronyUnit, "replace"); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", chronyUnit, err)
+		}
+	}
+	return nil
+}
+
+func validateTimeConfig(cfg *protocol.TimeConfig) error {
+	var errs fieldErrors
+	if cfg.Timezone != "" && !timezonePattern.MatchString(cfg.Timezone) {
+		errs.add("timezone", "%q is not a valid time zone name", cfg.Timezone)
+	}
+	for i, server := range cfg.NTPServers {
+		if addr, err := netip.ParseAddr(server); (err != nil || addr.Zone() != "") && !command.IsHostname(server) {
+			errs.add(fmt.Sprintf("ntp_servers[%d]", i), "%q is not a hostname or IP address", server)
+		}
+	}
+	return errs.err()
+}
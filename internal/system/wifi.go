@@ -0,0 +1,448 @@
+package system
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+)
+
+const (
+	nmWirelessInterface    = "org.freedesktop.NetworkManager.Device.Wireless"
+	nmAccessPointInterface = "org.freedesktop.NetworkManager.AccessPoint"
+	nmIP4ConfigInterface   = "org.freedesktop.NetworkManager.IP4Config"
+	nmIP6ConfigInterface   = "org.freedesktop.NetworkManager.IP6Config"
+
+	nmDeviceTypeWiFi = 2
+
+	// NMDeviceState value from which on a device can be activated
+	nmDeviceStateDisconnected = 30
+
+	// NMActiveConnectionState values
+	nmActiveStateActivated    = 2
+	nmActiveStateDeactivating = 3
+	nmActiveStateDeactivated  = 4
+
+	// NM80211ApFlags and NM80211ApSecurityFlags bits
+	nmAPFlagPrivacy     = 0x1
+	nmAPSecKeyMgmtPSK   = 0x100
+	nmAPSecKeyMgmt8021X = 0x200
+	nmAPSecKeyMgmtSAE   = 0x400
+	nmAPSecKeyMgmtOWE   = 0x800
+
+	// WiFi security types, named like NetworkManager's key-mgmt values
+	securityOpen   = "open"
+	securityWEP    = "wep"
+	securityOWE    = "owe"
+	securityWPAPSK = "wpa-psk"
+	securitySAE    = "sae"
+	securityWPAEAP = "wpa-eap"
+)
+
+// Timeouts of the WiFi operations. Variables, so tests can shorten them.
+var (
+	// wifiScanTimeout bounds the wait for a requested scan to finish.
+	wifiScanTimeout = 15 * time.Second
+	// wifiConnectTimeout bounds the wait for a connection to activate,
+	// including association, authentication and DHCP.
+	wifiConnectTimeout = 45 * time.Second
+	// wifiDeviceTimeout bounds the wait for a device to become usable, e.g.
+	// after it was created or handed back to NetworkManager.
+	wifiDeviceTimeout = 10 * time.Second
+	// wifiPollInterval is how often the state of an operation is checked.
+	wifiPollInterval = 250 * time.Millisecond
+)
+
+// hexPSK matches a raw WPA pre-shared key.
+var hexPSK = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// nmDeviceStateReasons explains the device state reasons that commonly make
+// a WiFi connection fail.
+var nmDeviceStateReasons = map[uint32]string{
+	5:  "no IP address obtained",
+	7:  "wrong or missing password",
+	8:  "disconnected by the access point",
+	9:  "authentication setup failed",
+	10: "authentication failed",
+	11: "timed out authenticating with the access point",
+	53: "network not found",
+}
+
+// WiFiDevices returns the interface names of the WiFi devices NetworkManager
+// knows.
+func (m *Manager) WiFiDevices(ctx context.Context) ([]string, error) {
+	reply, err := m.bus.Call(ctx, nmService, nmPath, nmInterface, "GetDevices")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	devices, _ := reply[0].([]dbus.ObjectPath)
+
+	var names []string
+	for _, device := range devices {
+		props, err := m.bus.GetAllProperties(ctx, nmService, device, nmDeviceInterface)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get properties of %s: %w", device, err)
+		}
+		if deviceType, _ := props["DeviceType"].(uint32); deviceType != nmDeviceTypeWiFi {
+			continue
+		}
+		if name, _ := props["Interface"].(string); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// ScanWiFi scans for WiFi networks on the named interface, like the
+// wifi-scan script does with nmcli, and returns them strongest first.
+func (m *Manager) ScanWiFi(ctx context.Context, name string) ([]protocol.WiFiNetwork, error) {
+	device, err := m.wifiDevice(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	lastScan, err := m.bus.GetProperty(ctx, nmService, device, nmWirelessInterface, "LastScan")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last scan time of %s: %w", name, err)
+	}
+	// NetworkManager refuses to scan again right after a scan; the results
+	// of that scan are fresh enough then.
+	if _, err := m.bus.Call(ctx, nmService, device, nmWirelessInterface, "RequestScan", map[string]any{}); err == nil {
+		if err := poll(ctx, wifiScanTimeout, func() (bool, error) {
+			v, err := m.bus.GetProperty(ctx, nmService, device, nmWirelessInterface, "LastScan")
+			return v != lastScan, err
+		}); err != nil {
+			return nil, fmt.Errorf("failed to scan on %s: %w", name, err)
+		}
+	} else if !isNMError(err, "NotAllowed") {
+		return nil, fmt.Errorf("failed to scan on %s: %w", name, err)
+	}
+
+	reply, err := m.bus.Call(ctx, nmService, device, nmWirelessInterface, "GetAllAccessPoints")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access points of %s: %w", name, err)
+	}
+	aps, _ := reply[0].([]dbus.ObjectPath)
+
+	networks := make([]protocol.WiFiNetwork, 0, len(aps))
+	for _, ap := range aps {
+		props, err := m.bus.GetAllProperties(ctx, nmService, ap, nmAccessPointInterface)
+		if err != nil {
+			// Access points vanish when they go out of range
+			continue
+		}
+		ssid, _ := props["Ssid"].([]byte)
+		bssid, _ := props["HwAddress"].(string)
+		strength, _ := props["Strength"].(uint8)
+		frequency, _ := props["Frequency"].(uint32)
+		flags, _ := props["Flags"].(uint32)
+		wpaFlags, _ := props["WpaFlags"].(uint32)
+		rsnFlags, _ := props["RsnFlags"].(uint32)
+		networks = append(networks, protocol.WiFiNetwork{
+			SSID:      string(ssid),
+			BSSID:     bssid,
+			Signal:    int(strength),
+			Security:  securityOf(flags, wpaFlags|rsnFlags),
+			Frequency: int(frequency),
+			Channel:   channelOf(int(frequency)),
+		})
+	}
+	slices.SortStableFunc(networks, func(a, b protocol.WiFiNetwork) int {
+		return cmp.Or(cmp.Compare(b.Signal, a.Signal), cmp.Compare(a.SSID, b.SSID))
+	})
+	return networks, nil
+}
+
+// ConnectWiFi creates a NetworkManager connection for the WiFi network of
+// req, activates it on the named interface and waits until the device is
+// connected. It returns the addresses the device got. If the connection
+// does not activate, it is deleted again and a WiFi connect failed error is
+// returned.
+//
+// The connection is not bound to the interface, so that it also comes up on
+// another WiFi device, e.g. if name is a virtual station interface that does
+// not survive a reboot.
+func (m *Manager) ConnectWiFi(ctx context.Context, name string, req *protocol.WiFiConnectRequest) ([]string, error) {
+	if err := ValidateWiFiConnect(req); err != nil {
+		return nil, err
+	}
+	device, err := m.wifiDevice(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// A device handed back to NetworkManager by the access point is
+	// unavailable until wpa_supplicant has taken it over
+	if err := poll(ctx, wifiDeviceTimeout, func() (bool, error) {
+		v, err := m.bus.GetProperty(ctx, nmService, device, nmDeviceInterface, "State")
+		state, _ := v.(uint32)
+		return state >= nmDeviceStateDisconnected, err
+	}); err != nil {
+		return nil, fmt.Errorf("device %s is not ready: %w", name, err)
+	}
+
+	reply, err := m.bus.Call(ctx, nmService, nmPath, nmInterface, "AddAndActivateConnection",
+		wifiSettings(req), device, dbus.ObjectPath("/"))
+	if err != nil {
+		return nil, callError(err, "add WiFi connection", "ssid")
+	}
+	if len(reply) != 2 {
+		return nil, fmt.Errorf("unexpected reply to AddAndActivateConnection")
+	}
+	conn, _ := reply[0].(dbus.ObjectPath)
+	active, _ := reply[1].(dbus.ObjectPath)
+
+	activated := false
+	err = poll(ctx, wifiConnectTimeout, func() (bool, error) {
+		v, err := m.bus.GetProperty(ctx, nmService, active, nmActiveInterface, "State")
+		if err != nil {
+			// The active connection is removed once it is deactivated
+			return true, nil
+		}
+		switch state, _ := v.(uint32); state {
+		case nmActiveStateActivated:
+			activated = true
+			return true, nil
+		case nmActiveStateDeactivating, nmActiveStateDeactivated:
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil || !activated {
+		reason := "timed out"
+		if err == nil {
+			reason = m.failureReason(ctx, device)
+		}
+		// Do not leave a connection behind that NetworkManager would keep
+		// retrying
+		if _, delErr := m.bus.Call(context.WithoutCancel(ctx), nmService, conn, nmConnectionInterface, "Delete"); delErr != nil {
+			reason += fmt.Sprintf(" (failed to delete connection: %v)", delErr)
+		}
+		return nil, protocol.NewWiFiConnectFailedError(req.SSID, reason)
+	}
+
+	return m.deviceAddresses(ctx, device)
+}
+
+// ValidateWiFiConnect checks a WiFi connect request.
+func ValidateWiFiConnect(req *protocol.WiFiConnectRequest) error {
+	var errs fieldErrors
+	if req.SSID == "" || len(req.SSID) > 32 {
+		errs.add("ssid", "must be 1 to 32 bytes")
+	}
+	if req.Interface != "" && !interfaceNamePattern.MatchString(req.Interface) {
+		errs.add("interface", "%q is not a valid interface name", req.Interface)
+	}
+	switch req.Security {
+	case "":
+	case securityWPAPSK, securitySAE:
+		if req.PSK == "" {
+			errs.add("psk", "required for security %s", req.Security)
+		}
+	default:
+		errs.add("security", "must be one of %s, %s", securityWPAPSK, securitySAE)
+	}
+	if req.PSK != "" && req.Security != securitySAE && !hexPSK.MatchString(req.PSK) && (len(req.PSK) < 8 || len(req.PSK) > 63) {
+		errs.add("psk", "must be 8 to 63 characters or 64 hexadecimal digits")
+	}
+	return errs.err()
+}
+
+// wifiDevice returns the NetworkManager device of the named WiFi interface.
+// If the interface exists, but NetworkManager does not know it yet because
+// it was just created, it waits for NetworkManager to pick it up.
+func (m *Manager) wifiDevice(ctx context.Context, name string) (dbus.ObjectPath, error) {
+	if !interfaceNamePattern.MatchString(name) {
+		return "", protocol.NewInterfaceNotFoundError(name)
+	}
+
+	device, err := m.device(ctx, name)
+	if isErrorCode(err, protocol.ErrCodeInterfaceNotFound) {
+		if _, statErr := os.Stat(filepath.Join("/sys/class/net", name)); statErr == nil {
+			if pollErr := poll(ctx, wifiDeviceTimeout, func() (bool, error) {
+				device, err = m.device(ctx, name)
+				return !isErrorCode(err, protocol.ErrCodeInterfaceNotFound), nil
+			}); pollErr != nil {
+				return "", err
+			}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	v, err := m.bus.GetProperty(ctx, nmService, device, nmDeviceInterface, "DeviceType")
+	if err != nil {
+		return "", fmt.Errorf("failed to get type of device %s: %w", name, err)
+	}
+	if deviceType, _ := v.(uint32); deviceType != nmDeviceTypeWiFi {
+		return "", protocol.NewValidationError([]protocol.FieldError{
+			{Field: "interface", Message: fmt.Sprintf("%s is not a WiFi interface", name)},
+		})
+	}
+	return device, nil
+}
+
+// failureReason explains why the last activation on device failed.
+func (m *Manager) failureReason(ctx context.Context, device dbus.ObjectPath) string {
+	v, err := m.bus.GetProperty(ctx, nmService, device, nmDeviceInterface, "StateReason")
+	if err != nil {
+		return "activation failed"
+	}
+	if stateReason, _ := v.([]any); len(stateReason) == 2 {
+		code, _ := stateReason[1].(uint32)
+		if reason, ok := nmDeviceStateReasons[code]; ok {
+			return reason
+		}
+		return fmt.Sprintf("activation failed (reason %d)", code)
+	}
+	return "activation failed"
+}
+
+// deviceAddresses returns the IPv4 and IPv6 addresses of device in CIDR
+// notation.
+func (m *Manager) deviceAddresses(ctx context.Context, device dbus.ObjectPath) ([]string, error) {
+	var addresses []string
+	for _, cfg := range []struct{ property, iface string }{
+		{"Ip4Config", nmIP4ConfigInterface},
+		{"Ip6Config", nmIP6ConfigInterface},
+	} {
+		v, err := m.bus.GetProperty(ctx, nmService, device, nmDeviceInterface, cfg.property)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", cfg.property, err)
+		}
+		path, _ := v.(dbus.ObjectPath)
+		if path == "" || path == "/" {
+			continue
+		}
+		v, err = m.bus.GetProperty(ctx, nmService, path, cfg.iface, "AddressData")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get addresses of %s: %w", path, err)
+		}
+		data, _ := v.([]any)
+		for _, entry := range data {
+			props, _ := entry.(map[string]any)
+			address, _ := variantValue(props["address"]).(string)
+			prefix, _ := variantValue(props["prefix"]).(uint32)
+			if addr, err := netip.ParseAddr(address); err == nil {
+				addresses = append(addresses, netip.PrefixFrom(addr, int(prefix)).String())
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// poll calls done until it reports true or an error, or timeout passes.
+func poll(ctx context.Context, timeout time.Duration, done func() (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wifiPollInterval):
+		}
+	}
+}
+
+// wifiSettings returns the NetworkManager connection settings for req.
+func wifiSettings(req *protocol.WiFiConnectRequest) map[string]map[string]any {
+	settings := map[string]map[string]any{
+		"connection": {
+			"id":          req.SSID,
+			"type":        "802-11-wireless",
+			"autoconnect": true,
+		},
+		"802-11-wireless": {
+			"ssid": []byte(req.SSID),
+			"mode": "infrastructure",
+		},
+		"ipv4": {"method": methodAuto},
+		"ipv6": {"method": methodAuto},
+	}
+	if req.Hidden {
+		settings["802-11-wireless"]["hidden"] = true
+	}
+	if req.PSK != "" {
+		keyMgmt := req.Security
+		if keyMgmt == "" {
+			keyMgmt = securityWPAPSK
+		}
+		settings["802-11-wireless-security"] = map[string]any{
+			"key-mgmt": keyMgmt,
+			"psk":      req.PSK,
+		}
+	}
+	return settings
+}
+
+// securityOf names the security of an access point with the given flags and
+// combined WPA and RSN flags after the key management a connection to it
+// would use.
+func securityOf(flags, secFlags uint32) string {
+	switch {
+	case secFlags&nmAPSecKeyMgmt8021X != 0:
+		return securityWPAEAP
+	case secFlags&nmAPSecKeyMgmtPSK != 0:
+		return securityWPAPSK
+	case secFlags&nmAPSecKeyMgmtSAE != 0:
+		return securitySAE
+	case secFlags&nmAPSecKeyMgmtOWE != 0:
+		return securityOWE
+	case flags&nmAPFlagPrivacy != 0:
+		return securityWEP
+	default:
+		return securityOpen
+	}
+}
+
+// channelOf returns the WiFi channel of a frequency in MHz, or 0.
+func channelOf(frequency int) int {
+	switch {
+	case frequency == 2484:
+		return 14
+	case frequency >= 2412 && frequency < 2484:
+		return (frequency - 2407) / 5
+	case frequency >= 5955 && frequency <= 7115:
+		return (frequency - 5950) / 5
+	case frequency >= 5000 && frequency < 5955:
+		return (frequency - 5000) / 5
+	default:
+		return 0
+	}
+}
+
+// isNMError reports whether err is the NetworkManager D-Bus error with the
+// given name suffix, e.g. "NotAllowed".
+func isNMError(err error, suffix string) bool {
+	var dbusErr *dbus.Error
+	return errors.As(err, &dbusErr) && strings.HasSuffix(dbusErr.Name, "."+suffix)
+}
+
+// isErrorCode reports whether err is a protocol error with the given code.
+func isErrorCode(err error, code protocol.ErrorCode) bool {
+	var errResp *protocol.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Code == code
+}
+
+// variantValue unwraps v if it is a variant.
+func variantValue(v any) any {
+	if variant, ok := v.(dbus.Variant); ok {
+		return variant.Value
+	}
+	return v
+}
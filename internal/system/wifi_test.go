@@ -0,0 +1,136 @@
+package system_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_WiFiDevices(t *testing.T) {
+	manager, _, _ := newTestManager(t)
+
+	devices, err := manager.WiFiDevices(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wlan0"}, devices)
+}
+
+func TestManager_ScanWiFi(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	networks, err := manager.ScanWiFi(context.Background(), "wlan0")
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.WiFiNetwork{
+		{SSID: "office", BSSID: "02:00:00:00:00:52", Signal: 82, Security: "wpa-psk", Frequency: 5180, Channel: 36},
+		{SSID: "guest", BSSID: "02:00:00:00:00:28", Signal: 40, Security: "open", Frequency: 2437, Channel: 6},
+	}, networks)
+	assert.Contains(t, services.called(), "RequestScan …")
+}
+
+func TestManager_ScanWiFi_NotAllowed(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+	services.failWith("RequestScan", &dbus.Error{
+		Name:    "org.freedesktop.NetworkManager.Device.NotAllowed",
+		Message: "Scanning not allowed immediately following previous scan",
+	})
+
+	networks, err := manager.ScanWiFi(context.Background(), "wlan0")
+	require.NoError(t, err)
+	assert.Len(t, networks, 2, "results of the previous scan are returned")
+}
+
+func TestManager_ScanWiFi_UnknownDevice(t *testing.T) {
+	manager, _, _ := newTestManager(t)
+
+	_, err := manager.ScanWiFi(context.Background(), "bp-test0")
+	var errResp *protocol.ErrorResponse
+	require.True(t, errors.As(err, &errResp))
+	assert.Equal(t, protocol.ErrCodeInterfaceNotFound, errResp.Code)
+}
+
+func TestManager_ConnectWiFi(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	addresses, err := manager.ConnectWiFi(context.Background(), "wlan0", &protocol.WiFiConnectRequest{
+		SSID: "office",
+		PSK:  "secret123",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.1.50/24"}, addresses)
+
+	call := services.lastCall(t, "AddAndActivateConnection")
+	assert.Equal(t, testDevice, call.Body[1])
+	settings := call.Body[0].(map[string]any)
+	connection := settings["connection"].(map[string]any)
+	assert.Equal(t, "office", connection["id"].(dbus.Variant).Value)
+	assert.Equal(t, "802-11-wireless", connection["type"].(dbus.Variant).Value)
+	assert.NotContains(t, connection, "interface-name")
+	wireless := settings["802-11-wireless"].(map[string]any)
+	assert.Equal(t, []byte("office"), wireless["ssid"].(dbus.Variant).Value)
+	assert.NotContains(t, wireless, "hidden")
+	security := settings["802-11-wireless-security"].(map[string]any)
+	assert.Equal(t, "wpa-psk", security["key-mgmt"].(dbus.Variant).Value)
+	assert.Equal(t, "secret123", security["psk"].(dbus.Variant).Value)
+	assert.NotContains(t, services.called(), "Delete")
+}
+
+func TestManager_ConnectWiFi_OpenHidden(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	_, err := manager.ConnectWiFi(context.Background(), "wlan0", &protocol.WiFiConnectRequest{
+		SSID:   "lab",
+		Hidden: true,
+	})
+	require.NoError(t, err)
+
+	settings := services.lastCall(t, "AddAndActivateConnection").Body[0].(map[string]any)
+	assert.Equal(t, true, settings["802-11-wireless"].(map[string]any)["hidden"].(dbus.Variant).Value)
+	assert.NotContains(t, settings, "802-11-wireless-security")
+}
+
+func TestManager_ConnectWiFi_Failed(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+	services.mu.Lock()
+	services.activeState = 4 // deactivated
+	services.stateReason = 7 // no secrets
+	services.mu.Unlock()
+
+	_, err := manager.ConnectWiFi(context.Background(), "wlan0", &protocol.WiFiConnectRequest{
+		SSID: "office",
+		PSK:  "wrong-password",
+	})
+	var errResp *protocol.ErrorResponse
+	require.True(t, errors.As(err, &errResp))
+	assert.Equal(t, protocol.ErrCodeWiFiConnectFailed, errResp.Code)
+	assert.Equal(t, "office: wrong or missing password", errResp.Details)
+	assert.Contains(t, services.called(), "Delete", "the failed connection must be removed")
+}
+
+func TestManager_ConnectWiFi_Invalid(t *testing.T) {
+	manager, services, _ := newTestManager(t)
+
+	tests := []struct {
+		name   string
+		req    protocol.WiFiConnectRequest
+		fields []string
+	}{
+		{"missing ssid", protocol.WiFiConnectRequest{}, []string{"ssid"}},
+		{"long ssid", protocol.WiFiConnectRequest{SSID: "a-network-name-of-more-than-32-bytes"}, []string{"ssid"}},
+		{"short psk", protocol.WiFiConnectRequest{SSID: "office", PSK: "short"}, []string{"psk"}},
+		{"psk required", protocol.WiFiConnectRequest{SSID: "office", Security: "sae"}, []string{"psk"}},
+		{"unknown security", protocol.WiFiConnectRequest{SSID: "office", PSK: "secret123", Security: "wep"}, []string{"security"}},
+		{"invalid interface", protocol.WiFiConnectRequest{SSID: "office", Interface: "wlan0/../x"}, []string{"interface"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := manager.ConnectWiFi(context.Background(), "wlan0", &tt.req)
+			requireFieldErrors(t, err, tt.fields...)
+		})
+	}
+	assert.Empty(t, services.called())
+}
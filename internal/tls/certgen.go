@@ -5,8 +5,10 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"math/big"
@@ -280,3 +282,28 @@ func ValidateCertificate(certPath string) error {
 
 	return nil
 }
+
+// CertificateFingerprint returns the SHA-256 fingerprint of the public key of
+// the certificate at certPath in the "SHA256:<base64>" format used by the
+// boarding CLI's TOFU store. Pinning the key rather than the certificate keeps
+// the fingerprint valid when RegenerateCert adds SANs.
+//
+//nolint:gosec // G304: Certificate path is from config
+func CertificateFingerprint(certPath string) (string, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", fmt.Errorf("failed to decode PEM block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(hash[:]), nil
+}
@@ -2,7 +2,9 @@
 package tls_test
 
 import (
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"os"
 	"path/filepath"
@@ -272,3 +274,33 @@ func TestGenerateSelfSignedCert_CustomValidDays(t *testing.T) {
 	expectedDuration := 30 * 24 * time.Hour
 	assert.InDelta(t, expectedDuration, validDuration, float64(time.Hour))
 }
+
+func TestCertificateFingerprint(t *testing.T) {
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "server.crt")
+	keyPath := filepath.Join(tmpDir, "server.key")
+	require.NoError(t, tlspkg.GenerateSelfSignedCert(certPath, keyPath, 365))
+
+	certPEM, err := os.ReadFile(certPath)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	fp, err := tlspkg.CertificateFingerprint(certPath)
+	require.NoError(t, err)
+
+	// Must match the format the CLI stores for TOFU
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	assert.Equal(t, "SHA256:"+base64.StdEncoding.EncodeToString(sum[:]), fp)
+
+	// Regenerating the certificate with the same key keeps the fingerprint
+	require.NoError(t, tlspkg.RegenerateCert(certPath, keyPath, 30))
+	regenerated, err := tlspkg.CertificateFingerprint(certPath)
+	require.NoError(t, err)
+	assert.Equal(t, fp, regenerated)
+
+	_, err = tlspkg.CertificateFingerprint(filepath.Join(tmpDir, "missing.crt"))
+	assert.Error(t, err)
+}
@@ -92,6 +92,41 @@ func (cm *CertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certific
 	return cm.current, nil
 }
 
+// Refresh regenerates the certificate if an interface address is missing
+// from its SANs. It is called when network addresses change, so the first
+// handshake on a new address does not pay for regeneration.
+func (cm *CertManager) Refresh() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var missing []string
+	for _, ip := range getNetworkIPs() {
+		if !cm.sanIPs[ip.String()] {
+			missing = append(missing, ip.String())
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	cm.logger.Info("regenerating TLS certificate for new interface IPs", map[string]any{
+		"ips": missing,
+	})
+
+	if err := RegenerateCert(cm.certPath, cm.keyPath, cm.validDays); err != nil {
+		cm.logger.Warn("failed to regenerate certificate", map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := cm.loadCertLocked(); err != nil {
+		cm.logger.Warn("failed to reload regenerated certificate", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
+
 // ServerTLSConfig returns a tls.Config using this CertManager's GetCertificate callback.
 func (cm *CertManager) ServerTLSConfig() *tls.Config {
 	return &tls.Config{
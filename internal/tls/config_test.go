@@ -227,6 +227,26 @@ func TestCertManager_GetCertificate_RegeneratesForNewIP(t *testing.T) {
 	assert.Equal(t, origKey, afterKey)
 }
 
+func TestCertManager_Refresh_KeepsCurrentCert(t *testing.T) {
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "server.crt")
+	keyPath := filepath.Join(tmpDir, "server.key")
+
+	require.NoError(t, tlspkg.GenerateSelfSignedCert(certPath, keyPath, 365))
+	cm, err := tlspkg.NewCertManager(certPath, keyPath, 365, testLogger())
+	require.NoError(t, err)
+
+	origPEM, err := os.ReadFile(certPath)
+	require.NoError(t, err)
+
+	// The cert was just generated for the current interface IPs
+	cm.Refresh()
+
+	afterPEM, err := os.ReadFile(certPath)
+	require.NoError(t, err)
+	assert.Equal(t, origPEM, afterPEM, "cert should not regenerate when SANs cover all IPs")
+}
+
 // findIPNotInSANs returns an IP address that is not in the certificate's SANs.
 func findIPNotInSANs(cert *x509.Certificate) string {
 	sanSet := make(map[string]bool)
@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/fzdarsky/boardingpass/internal/ble"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+)
+
+// BLEHandler serves the API over a BLE GATT service registered with BlueZ.
+// Unlike the other transports it needs no IP connectivity: requests are
+// passed straight to the API handler.
+type BLEHandler struct {
+	cfg        config.BLETransport
+	port       int
+	certPath   string
+	handler    http.Handler
+	logger     *logging.Logger
+	state      State
+	conn       *dbus.Conn
+	peripheral *ble.Peripheral
+	mu         sync.Mutex
+}
+
+// NewBLEHandler creates a new BLE GATT transport handler serving handler.
+func NewBLEHandler(cfg config.BLETransport, port int, certPath string, handler http.Handler, logger *logging.Logger) *BLEHandler {
+	return &BLEHandler{
+		cfg:      cfg,
+		port:     port,
+		certPath: certPath,
+		handler:  handler,
+		logger:   logger,
+		state:    StateDisabled,
+	}
+}
+
+// Start registers the GATT service and advertisement with BlueZ.
+func (b *BLEHandler) Start(ctx context.Context) error {
+	b.setState(StateStarting)
+
+	adapter := b.cfg.Adapter
+	if adapter == "" {
+		adapter = "hci0"
+	}
+
+	if _, err := os.Stat(fmt.Sprintf("/sys/class/bluetooth/%s", adapter)); err != nil {
+		b.setState(StateFailed)
+		return fmt.Errorf("bluetooth adapter %s not found: %w", adapter, err)
+	}
+
+	deviceName := b.cfg.DeviceName
+	if deviceName == "" {
+		hostname, _ := os.Hostname()
+		deviceName = "BoardingPass-" + hostname
+	}
+
+	fingerprint, err := tlspkg.CertificateFingerprint(b.certPath)
+	if err != nil {
+		b.logger.Warn("failed to read certificate fingerprint for BLE", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		b.setState(StateFailed)
+		return fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+
+	peripheral := ble.NewPeripheral(conn, adapter, ble.Info{
+		DeviceName:  deviceName,
+		Port:        b.port,
+		Fingerprint: fingerprint,
+	}, b.handler, b.logger)
+	if err := peripheral.Start(ctx); err != nil {
+		_ = conn.Close()
+		b.setState(StateFailed)
+		return err
+	}
+
+	b.mu.Lock()
+	b.conn = conn
+	b.peripheral = peripheral
+	b.state = StateActive
+	b.mu.Unlock()
+
+	b.logger.Info("BLE GATT transport started", map[string]any{
+		"adapter":     adapter,
+		"device_name": deviceName,
+	})
+	return nil
+}
+
+// Stop unregisters the GATT service and advertisement.
+func (b *BLEHandler) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	b.state = StateStopping
+	conn, peripheral := b.conn, b.peripheral
+	b.conn, b.peripheral = nil, nil
+	b.mu.Unlock()
+
+	if peripheral != nil {
+		if err := peripheral.Stop(ctx); err != nil {
+			b.logger.Warn("failed to stop BLE GATT transport", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+	if conn != nil {
+		_ = conn.Close()
+	}
+
+	b.setState(StateStopped)
+	return nil
+}
+
+// TransportType returns the transport type.
+func (b *BLEHandler) TransportType() Type {
+	return TypeBLE
+}
+
+// TransportState returns the current state.
+func (b *BLEHandler) TransportState() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *BLEHandler) setState(s State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = s
+}
@@ -0,0 +1,272 @@
+package transport
+
+import (
+	"context"
+	"maps"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/network"
+)
+
+// EthernetHandler binds listeners to the addresses of the interfaces named in
+// transports.ethernet.interfaces, so the API stays off other interfaces such
+// as a production uplink. It follows address changes at runtime, adding and
+// removing listeners for IPv4 and IPv6 addresses, including link-local ones.
+type EthernetHandler struct {
+	cfg              config.EthernetTransport
+	port             int
+	logger           *logging.Logger
+	state            State
+	mu               sync.Mutex
+	cancel           context.CancelFunc
+	done             chan struct{}
+	bound            map[string]string // listener address -> interface name
+	onListenerAdd    ListenerCallback
+	onListenerRemove ListenerRemoveCallback
+	watcher          *network.Watcher
+}
+
+// NewEthernetHandler creates a new per-interface Ethernet transport handler.
+func NewEthernetHandler(cfg config.EthernetTransport, port int, logger *logging.Logger) *EthernetHandler {
+	return &EthernetHandler{
+		cfg:    cfg,
+		port:   port,
+		logger: logger,
+		state:  StateDisabled,
+		bound:  make(map[string]string),
+	}
+}
+
+// SetListenerCallbacks registers callbacks for dynamic listener management.
+func (e *EthernetHandler) SetListenerCallbacks(add ListenerCallback, remove ListenerRemoveCallback) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onListenerAdd = add
+	e.onListenerRemove = remove
+}
+
+// SetWatcher makes the handler resync listeners on link and address changes
+// instead of polling.
+func (e *EthernetHandler) SetWatcher(w *network.Watcher) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.watcher = w
+}
+
+// Start binds listeners to the configured interfaces' addresses and follows changes.
+func (e *EthernetHandler) Start(ctx context.Context) error {
+	e.setState(StateStarting)
+
+	syncCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	e.mu.Lock()
+	e.cancel = cancel
+	e.done = done
+	watcher := e.watcher
+	e.mu.Unlock()
+
+	// Subscribe before the initial sync so no change is missed in between
+	var changes <-chan struct{}
+	if watcher != nil {
+		ch, unsubscribe := watcher.Subscribe()
+		context.AfterFunc(syncCtx, unsubscribe)
+		changes = ch
+	}
+
+	e.syncListeners()
+	e.setState(StateActive)
+
+	go func() {
+		defer close(done)
+		e.syncLoop(syncCtx, changes)
+	}()
+	return nil
+}
+
+// Stop removes all listeners bound by the handler, after waiting for a sync
+// in progress to finish so it cannot add listeners back.
+func (e *EthernetHandler) Stop(_ context.Context) error {
+	e.mu.Lock()
+	e.state = StateStopping
+	cancel, done := e.cancel, e.done
+	e.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	e.mu.Lock()
+	bound := maps.Clone(e.bound)
+	e.bound = make(map[string]string)
+	e.mu.Unlock()
+
+	for addr, iface := range bound {
+		e.removeListener(addr, iface)
+	}
+
+	e.setState(StateStopped)
+	return nil
+}
+
+// TransportType returns the transport type.
+func (e *EthernetHandler) TransportType() Type {
+	return TypeEthernet
+}
+
+// TransportState returns the current state.
+func (e *EthernetHandler) TransportState() State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state
+}
+
+func (e *EthernetHandler) setState(s State) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.state = s
+}
+
+// syncLoop resyncs listeners whenever the watcher reports a change, or
+// every pollInterval without a watcher.
+func (e *EthernetHandler) syncLoop(ctx context.Context, changes <-chan struct{}) {
+	// Only one of the channels is set; receiving from the nil one blocks
+	var ticks <-chan time.Time
+	if changes == nil {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			e.syncListeners()
+		case <-ticks:
+			e.syncListeners()
+		}
+	}
+}
+
+// syncListeners adds listeners for new interface addresses and removes those
+// whose address is gone. Addresses that fail to bind, e.g. IPv6 addresses
+// still undergoing duplicate address detection, are retried on the next sync.
+func (e *EthernetHandler) syncListeners() {
+	current := make(map[string]string) // listener address -> interface name
+	hosts := make(map[string]string)   // listener address -> host to bind
+	for _, name := range e.cfg.Interfaces {
+		for _, host := range interfaceHosts(name) {
+			addr := net.JoinHostPort(host, strconv.Itoa(e.port))
+			current[addr] = name
+			hosts[addr] = host
+		}
+	}
+
+	e.mu.Lock()
+	addCallback := e.onListenerAdd
+	var gone []string
+	for addr := range e.bound {
+		if _, ok := current[addr]; !ok {
+			gone = append(gone, addr)
+		}
+	}
+	var added []string
+	for addr := range current {
+		if _, ok := e.bound[addr]; !ok {
+			added = append(added, addr)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, addr := range gone {
+		e.mu.Lock()
+		iface := e.bound[addr]
+		delete(e.bound, addr)
+		e.mu.Unlock()
+
+		e.logger.Info("ethernet interface address removed", map[string]any{
+			"interface": iface,
+			"address":   addr,
+		})
+		e.removeListener(addr, iface)
+	}
+
+	for _, addr := range added {
+		iface := current[addr]
+		if addCallback != nil {
+			if err := addCallback(hosts[addr], e.port); err != nil {
+				e.logger.Warn("failed to add ethernet listener", map[string]any{
+					"interface": iface,
+					"address":   addr,
+					"error":     err.Error(),
+				})
+				continue
+			}
+		}
+
+		e.mu.Lock()
+		e.bound[addr] = iface
+		e.mu.Unlock()
+
+		e.logger.Info("ethernet interface address detected", map[string]any{
+			"interface": iface,
+			"address":   addr,
+		})
+	}
+}
+
+func (e *EthernetHandler) removeListener(addr, iface string) {
+	e.mu.Lock()
+	removeCallback := e.onListenerRemove
+	e.mu.Unlock()
+
+	if removeCallback == nil {
+		return
+	}
+	if err := removeCallback(addr); err != nil {
+		e.logger.Warn("failed to remove ethernet listener", map[string]any{
+			"interface": iface,
+			"address":   addr,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// interfaceHosts returns the bindable IPv4 and IPv6 addresses of an interface
+// that is up. IPv6 link-local addresses carry the interface as zone.
+func interfaceHosts(name string) []string {
+	iface, err := net.InterfaceByName(name)
+	if err != nil || iface.Flags&net.FlagUp == 0 {
+		return nil
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+
+	var hosts []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		switch {
+		case ip.To4() != nil:
+			hosts = append(hosts, ip.String())
+		case ip.IsLinkLocalUnicast():
+			hosts = append(hosts, ip.String()+"%"+name)
+		default:
+			hosts = append(hosts, ip.String())
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,173 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeListeners records listener callbacks.
+type fakeListeners struct {
+	mu      sync.Mutex
+	bound   []string
+	failing map[string]bool
+
+	// adding, if set, receives each address being added, which then waits
+	// for resume
+	adding chan string
+	resume chan struct{}
+}
+
+func (f *fakeListeners) add(address string, _ int) error {
+	f.mu.Lock()
+	adding, resume := f.adding, f.resume
+	f.mu.Unlock()
+	if adding != nil {
+		adding <- address
+		<-resume
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing[address] {
+		return errors.New("cannot assign requested address")
+	}
+	f.bound = append(f.bound, net.JoinHostPort(address, "9455"))
+	return nil
+}
+
+func (f *fakeListeners) remove(address string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bound = slices.DeleteFunc(f.bound, func(a string) bool { return a == address })
+	return nil
+}
+
+func (f *fakeListeners) list() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Sorted(slices.Values(f.bound))
+}
+
+func loopbackName(t *testing.T) string {
+	t.Helper()
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestEthernetHandler_BindsInterfaceAddresses(t *testing.T) {
+	lo := loopbackName(t)
+	listeners := &fakeListeners{}
+
+	h := NewEthernetHandler(config.EthernetTransport{Enabled: true, Interfaces: []string{lo, "nonexistent0"}},
+		9455, logging.New(logging.LevelError, logging.FormatJSON))
+	h.SetListenerCallbacks(listeners.add, listeners.remove)
+
+	require.NoError(t, h.Start(context.Background()))
+	assert.Equal(t, StateActive, h.TransportState())
+
+	var want []string
+	for _, host := range interfaceHosts(lo) {
+		want = append(want, net.JoinHostPort(host, "9455"))
+	}
+	require.NotEmpty(t, want)
+	assert.Contains(t, listeners.list(), "127.0.0.1:9455")
+	assert.ElementsMatch(t, want, listeners.list())
+
+	require.NoError(t, h.Stop(context.Background()))
+	assert.Empty(t, listeners.list())
+	assert.Equal(t, StateStopped, h.TransportState())
+}
+
+func TestEthernetHandler_RetriesFailedAddresses(t *testing.T) {
+	lo := loopbackName(t)
+	listeners := &fakeListeners{failing: map[string]bool{"127.0.0.1": true}}
+
+	h := NewEthernetHandler(config.EthernetTransport{Enabled: true, Interfaces: []string{lo}},
+		9455, logging.New(logging.LevelError, logging.FormatJSON))
+	h.SetListenerCallbacks(listeners.add, listeners.remove)
+
+	h.syncListeners()
+	assert.NotContains(t, listeners.list(), "127.0.0.1:9455")
+
+	listeners.mu.Lock()
+	listeners.failing = nil
+	listeners.mu.Unlock()
+
+	h.syncListeners()
+	assert.Contains(t, listeners.list(), "127.0.0.1:9455")
+}
+
+func TestEthernetHandler_StopWaitsForSync(t *testing.T) {
+	lo := loopbackName(t)
+	listeners := &fakeListeners{failing: map[string]bool{"127.0.0.1": true}}
+
+	h := NewEthernetHandler(config.EthernetTransport{Enabled: true, Interfaces: []string{lo}},
+		9455, logging.New(logging.LevelError, logging.FormatJSON))
+	h.SetListenerCallbacks(listeners.add, listeners.remove)
+	require.NoError(t, h.Start(context.Background()))
+
+	// Hold the next sync while it retries the failed address
+	listeners.mu.Lock()
+	listeners.failing = nil
+	listeners.adding = make(chan string)
+	listeners.resume = make(chan struct{})
+	listeners.mu.Unlock()
+	for addr := range listeners.adding {
+		if addr == "127.0.0.1" {
+			break
+		}
+		listeners.resume <- struct{}{}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		assert.NoError(t, h.Stop(context.Background()))
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while a sync was adding listeners")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	listeners.mu.Lock()
+	listeners.adding = nil
+	listeners.mu.Unlock()
+	close(listeners.resume)
+	<-stopped
+	assert.Empty(t, listeners.list())
+}
+
+func TestInterfaceHosts_LinkLocalZone(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+
+	for _, iface := range ifaces {
+		for _, host := range interfaceHosts(iface.Name) {
+			ip := net.ParseIP(host)
+			if ip == nil {
+				// Only zoned link-local addresses fail to parse
+				assert.Contains(t, host, "%"+iface.Name)
+				continue
+			}
+			assert.False(t, ip.To4() == nil && ip.IsLinkLocalUnicast(), "link-local %s without zone", host)
+		}
+	}
+}
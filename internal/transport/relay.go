@@ -0,0 +1,243 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/mux"
+	"github.com/fzdarsky/boardingpass/internal/relay"
+)
+
+const (
+	// relayDialTimeout bounds connecting to the rendezvous server.
+	relayDialTimeout = 15 * time.Second
+	// relayPingInterval is how often an idle tunnel is checked, which also
+	// keeps NAT mappings alive.
+	relayPingInterval = 30 * time.Second
+	// Backoff between attempts to reach the rendezvous server.
+	relayRetryMin = 2 * time.Second
+	relayRetryMax = time.Minute
+)
+
+// RelayHandler serves the API over streams multiplexed on an outbound
+// WebSocket to a rendezvous server, for devices behind NAT or firewalls
+// that cannot accept incoming connections. The tunnel is reopened whenever
+// it fails.
+type RelayHandler struct {
+	cfg      config.RelayTransport
+	deviceID string
+	logger   *logging.Logger
+	state    State
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+	onServe  ServeCallback
+	onRemove ListenerRemoveCallback
+}
+
+// NewRelayHandler creates a new relay transport handler for the device
+// with the given ID.
+func NewRelayHandler(cfg config.RelayTransport, deviceID string, logger *logging.Logger) *RelayHandler {
+	return &RelayHandler{
+		cfg:      cfg,
+		deviceID: deviceID,
+		logger:   logger,
+		state:    StateDisabled,
+	}
+}
+
+// SetListenerCallbacks registers callbacks that serve and remove the
+// listener for the tunnel.
+func (r *RelayHandler) SetListenerCallbacks(serve ServeCallback, remove ListenerRemoveCallback) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onServe = serve
+	r.onRemove = remove
+}
+
+// Start loads the credentials for the rendezvous server and begins
+// keeping a tunnel open to it.
+func (r *RelayHandler) Start(ctx context.Context) error {
+	r.setState(StateStarting)
+
+	tlsConfig, header, err := r.credentials()
+	if err != nil {
+		r.setState(StateFailed)
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	r.mu.Lock()
+	r.cancel = cancel
+	r.done = done
+	r.state = StateActive
+	r.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		r.run(runCtx, tlsConfig, header)
+	}()
+
+	return nil
+}
+
+// Stop closes the tunnel and removes its listener.
+func (r *RelayHandler) Stop(_ context.Context) error {
+	r.mu.Lock()
+	r.state = StateStopping
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	r.setState(StateStopped)
+	return nil
+}
+
+// TransportType returns the transport type.
+func (r *RelayHandler) TransportType() Type {
+	return TypeRelay
+}
+
+// TransportState returns the current state.
+func (r *RelayHandler) TransportState() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+func (r *RelayHandler) setState(st State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = st
+}
+
+// credentials returns the TLS configuration trusting the configured CA and
+// the handshake header carrying the configured token.
+func (r *RelayHandler) credentials() (*tls.Config, http.Header, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if r.cfg.CACert != "" {
+		pem, err := os.ReadFile(r.cfg.CACert)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read relay CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", r.cfg.CACert)
+		}
+	}
+
+	header := http.Header{}
+	if r.cfg.TokenFile != "" {
+		token, err := os.ReadFile(r.cfg.TokenFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read relay token: %w", err)
+		}
+		header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return tlsConfig, header, nil
+}
+
+// run keeps a tunnel open until ctx is cancelled, retrying with backoff
+// while the rendezvous server cannot be reached.
+func (r *RelayHandler) run(ctx context.Context, tlsConfig *tls.Config, header http.Header) {
+	backoff := relayRetryMin
+	for {
+		connected, err := r.serveOnce(ctx, tlsConfig, header)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = relayRetryMin
+		}
+		r.logger.Warn("relay tunnel interrupted", map[string]any{
+			"url":      r.cfg.URL,
+			"error":    err.Error(),
+			"retry_in": backoff.String(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, relayRetryMax)
+	}
+}
+
+// serveOnce opens a tunnel and serves one session until the tunnel fails
+// or ctx is cancelled. It reports whether the tunnel was established.
+func (r *RelayHandler) serveOnce(ctx context.Context, tlsConfig *tls.Config, header http.Header) (bool, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, relayDialTimeout)
+	conn, err := relay.Dial(dialCtx, relay.TunnelURL(r.cfg.URL, r.deviceID), tlsConfig, header)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+
+	session := mux.Server(conn, mux.Addr{Net: "relay", Name: r.deviceID})
+
+	r.mu.Lock()
+	serve, remove := r.onServe, r.onRemove
+	r.mu.Unlock()
+
+	if serve != nil {
+		serve(session)
+	}
+	r.logger.Info("relay tunnel established", map[string]any{
+		"url":       r.cfg.URL,
+		"device_id": r.deviceID,
+	})
+
+	sessionErr := r.keepAlive(ctx, session)
+
+	if remove != nil {
+		if err := remove(session.Addr().String()); err != nil {
+			r.logger.Warn("failed to remove relay listener", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+	return true, sessionErr
+}
+
+// keepAlive pings the rendezvous server until the session ends or ctx is
+// cancelled, closing the session if the server stops answering.
+func (r *RelayHandler) keepAlive(ctx context.Context, session *mux.Session) error {
+	ticker := time.NewTicker(relayPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-session.Done():
+			if err := session.Err(); err != nil {
+				return err
+			}
+			return errors.New("tunnel closed")
+		case <-ctx.Done():
+			_ = session.Close()
+			return nil
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, relayPingInterval)
+			_, err := session.Ping(pingCtx)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				_ = session.Close()
+				return fmt.Errorf("rendezvous server not responding: %w", err)
+			}
+		}
+	}
+}
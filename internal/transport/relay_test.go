@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayHandler_ServesThroughRendezvous(t *testing.T) {
+	rendezvous := relay.NewServer("secret")
+	ts := httptest.NewTLSServer(rendezvous)
+	defer ts.Close()
+	defer func() { _ = rendezvous.Close() }()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o600))
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0o600))
+
+	base := "wss://" + strings.TrimPrefix(ts.URL, "https://")
+	h := NewRelayHandler(config.RelayTransport{
+		Enabled:   true,
+		URL:       base,
+		CACert:    caFile,
+		TokenFile: tokenFile,
+	}, "SN1234", logging.New(logging.LevelError, logging.FormatJSON))
+
+	// Serve plain HTTP on the tunnel's listener, standing in for the API server
+	served := make(chan net.Listener, 1)
+	removed := make(chan string, 1)
+	h.SetListenerCallbacks(func(ln net.Listener) {
+		served <- ln
+		go func() {
+			_ = http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = fmt.Fprint(w, "hello from device")
+			}))
+		}()
+	}, func(address string) error {
+		removed <- address
+		return nil
+	})
+
+	require.NoError(t, h.Start(context.Background()))
+	assert.Equal(t, StateActive, h.TransportState())
+	assert.Equal(t, TypeRelay, h.TransportType())
+
+	select {
+	case ln := <-served:
+		assert.Equal(t, "relay", ln.Addr().Network())
+		assert.Equal(t, "SN1234", ln.Addr().String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel was not established")
+	}
+
+	// An operator reaches the device through the rendezvous server
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+	conn, err := relay.Dial(context.Background(), relay.DeviceURL(base, "SN1234"), tlsConfig, nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	req, err := http.NewRequest(http.MethodGet, "http://SN1234/info", nil)
+	require.NoError(t, err)
+	require.NoError(t, req.Write(conn))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, h.Stop(context.Background()))
+	assert.Equal(t, StateStopped, h.TransportState())
+	select {
+	case address := <-removed:
+		assert.Equal(t, "SN1234", address)
+	case <-time.After(time.Second):
+		t.Fatal("listener was not removed")
+	}
+}
+
+func TestRelayHandler_StartFailsWithoutCA(t *testing.T) {
+	h := NewRelayHandler(config.RelayTransport{
+		Enabled: true,
+		URL:     "wss://relay.example.com",
+		CACert:  filepath.Join(t.TempDir(), "missing.crt"),
+	}, "SN1234", logging.New(logging.LevelError, logging.FormatJSON))
+
+	err := h.Start(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read relay CA")
+	assert.Equal(t, StateFailed, h.TransportState())
+}
@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/mux"
+	"github.com/fzdarsky/boardingpass/internal/serial"
+)
+
+// serialRetryInterval is the delay before reopening a serial device after an error.
+const serialRetryInterval = 2 * time.Second
+
+// ServeCallback hands a transport-provided listener to the API server.
+type ServeCallback func(ln net.Listener)
+
+// SerialHandler serves the API over streams multiplexed on a serial device,
+// such as a USB ACM gadget (/dev/ttyGS0) or a UART. The device is reopened
+// whenever the line fails, e.g. when the USB host disconnects.
+type SerialHandler struct {
+	cfg      config.SerialTransport
+	logger   *logging.Logger
+	state    State
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+	onServe  ServeCallback
+	onRemove ListenerRemoveCallback
+}
+
+// NewSerialHandler creates a new serial transport handler.
+func NewSerialHandler(cfg config.SerialTransport, logger *logging.Logger) *SerialHandler {
+	return &SerialHandler{
+		cfg:    cfg,
+		logger: logger,
+		state:  StateDisabled,
+	}
+}
+
+// SetListenerCallbacks registers callbacks that serve and remove the
+// listener for the serial line.
+func (s *SerialHandler) SetListenerCallbacks(serve ServeCallback, remove ListenerRemoveCallback) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onServe = serve
+	s.onRemove = remove
+}
+
+// Start opens the serial device and begins serving streams on it.
+func (s *SerialHandler) Start(ctx context.Context) error {
+	s.setState(StateStarting)
+
+	if _, err := os.Stat(s.cfg.Device); err != nil {
+		s.setState(StateFailed)
+		return fmt.Errorf("serial device %s not found: %w", s.cfg.Device, err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.cancel = cancel
+	s.done = done
+	s.state = StateActive
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		s.run(runCtx)
+	}()
+
+	return nil
+}
+
+// Stop closes the serial device and removes its listener.
+func (s *SerialHandler) Stop(_ context.Context) error {
+	s.mu.Lock()
+	s.state = StateStopping
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	s.setState(StateStopped)
+	return nil
+}
+
+// TransportType returns the transport type.
+func (s *SerialHandler) TransportType() Type {
+	return TypeSerial
+}
+
+// TransportState returns the current state.
+func (s *SerialHandler) TransportState() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *SerialHandler) setState(st State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = st
+}
+
+// run serves sessions on the device until ctx is cancelled.
+func (s *SerialHandler) run(ctx context.Context) {
+	for {
+		if err := s.serveOnce(ctx); err != nil {
+			s.logger.Warn("serial transport interrupted", map[string]any{
+				"device": s.cfg.Device,
+				"error":  err.Error(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(serialRetryInterval):
+		}
+	}
+}
+
+// serveOnce opens the device and serves one session until the line fails
+// or ctx is cancelled.
+func (s *SerialHandler) serveOnce(ctx context.Context) error {
+	port, err := serial.Open(s.cfg.Device, s.cfg.BaudRate)
+	if err != nil {
+		return err
+	}
+
+	session := mux.Server(port, mux.Addr{Net: "serial", Name: filepath.Base(s.cfg.Device)})
+
+	s.mu.Lock()
+	serve, remove := s.onServe, s.onRemove
+	s.mu.Unlock()
+
+	if serve != nil {
+		serve(session)
+	}
+	s.logger.Info("serial transport listening", map[string]any{
+		"device": s.cfg.Device,
+	})
+
+	var sessionErr error
+	select {
+	case <-session.Done():
+		sessionErr = session.Err()
+	case <-ctx.Done():
+		_ = session.Close()
+	}
+
+	if remove != nil {
+		if err := remove(session.Addr().String()); err != nil {
+			s.logger.Warn("failed to remove serial listener", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+	return sessionErr
+}
@@ -11,7 +11,10 @@ const (
 	TypeEthernet  Type = "ethernet"
 	TypeWiFi      Type = "wifi"
 	TypeBluetooth Type = "bluetooth"
+	TypeBLE       Type = "ble"
 	TypeUSB       Type = "usb"
+	TypeSerial    Type = "serial"
+	TypeRelay     Type = "relay"
 )
 
 // State represents the lifecycle state of a transport instance.
@@ -13,11 +13,12 @@ import (
 
 	"github.com/fzdarsky/boardingpass/internal/config"
 	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/network"
 )
 
 const (
 	sysClassNet  = "/sys/class/net"
-	pollInterval = 2 * time.Second
+	pollInterval = 2 * time.Second // used when no network watcher is set
 )
 
 // ListenerCallback is called when a USB interface is detected with an IP address.
@@ -26,7 +27,10 @@ type ListenerCallback func(address string, port int) error
 // ListenerRemoveCallback is called when a USB interface disappears.
 type ListenerRemoveCallback func(address string) error
 
-// USBHandler manages USB tethering interface detection via polling.
+// USBHandler manages USB tethering interface detection. It rescans interfaces
+// when the network watcher reports a change, or polls without one. In gadget
+// mode it also sets up the board as a USB network adapter and detects the
+// gadget's interface instead of host-side tethering drivers.
 type USBHandler struct {
 	cfg              config.USBTransport
 	port             int
@@ -37,6 +41,7 @@ type USBHandler struct {
 	knownInterfaces  map[string]string // iface name -> bound address
 	onListenerAdd    ListenerCallback
 	onListenerRemove ListenerRemoveCallback
+	watcher          *network.Watcher
 }
 
 // NewUSBHandler creates a new USB transport handler.
@@ -58,30 +63,56 @@ func (u *USBHandler) SetListenerCallbacks(add ListenerCallback, remove ListenerR
 	u.onListenerRemove = remove
 }
 
-// Start begins polling for USB tethering interfaces.
+// SetWatcher makes the handler rescan interfaces on link and address changes
+// instead of polling.
+func (u *USBHandler) SetWatcher(w *network.Watcher) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.watcher = w
+}
+
+// Start begins watching for USB tethering interfaces, setting up the USB
+// gadget first in gadget mode.
 func (u *USBHandler) Start(ctx context.Context) error {
 	u.mu.Lock()
 	u.state = StateStarting
 	u.mu.Unlock()
 
+	if u.cfg.IsGadget() {
+		if err := u.startGadget(ctx); err != nil {
+			u.setState(StateFailed)
+			return err
+		}
+	}
+
 	pollCtx, cancel := context.WithCancel(ctx)
 	u.mu.Lock()
 	u.cancel = cancel
+	watcher := u.watcher
 	u.mu.Unlock()
 
+	// Subscribe before the initial scan so no change is missed in between
+	var changes <-chan struct{}
+	if watcher != nil {
+		ch, unsubscribe := watcher.Subscribe()
+		context.AfterFunc(pollCtx, unsubscribe)
+		changes = ch
+	}
+
 	// Do an initial scan
 	u.scanInterfaces()
 
 	u.setState(StateActive)
 
-	// Start polling in background
-	go u.pollLoop(pollCtx)
+	// Watch for interface changes in background
+	go u.pollLoop(pollCtx, changes)
 
 	return nil
 }
 
-// Stop cancels the polling loop and cleans up known interfaces.
-func (u *USBHandler) Stop(_ context.Context) error {
+// Stop cancels the polling loop, cleans up known interfaces and, in gadget
+// mode, removes the USB gadget.
+func (u *USBHandler) Stop(ctx context.Context) error {
 	u.mu.Lock()
 	u.state = StateStopping
 	cancel := u.cancel
@@ -114,6 +145,13 @@ func (u *USBHandler) Stop(_ context.Context) error {
 	u.knownInterfaces = make(map[string]string)
 	u.mu.Unlock()
 
+	if u.cfg.IsGadget() {
+		if err := u.stopGadget(ctx); err != nil {
+			u.setState(StateFailed)
+			return err
+		}
+	}
+
 	u.setState(StateStopped)
 	return nil
 }
@@ -136,15 +174,24 @@ func (u *USBHandler) setState(s State) {
 	u.state = s
 }
 
-func (u *USBHandler) pollLoop(ctx context.Context) {
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
+// pollLoop rescans interfaces whenever the watcher reports a change, or
+// every pollInterval without a watcher.
+func (u *USBHandler) pollLoop(ctx context.Context, changes <-chan struct{}) {
+	// Only one of the channels is set; receiving from the nil one blocks
+	var ticks <-chan time.Time
+	if changes == nil {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-changes:
+			u.scanInterfaces()
+		case <-ticks:
 			u.scanInterfaces()
 		}
 	}
@@ -165,14 +212,7 @@ func (u *USBHandler) scanInterfaces() {
 	for _, entry := range entries {
 		name := entry.Name()
 
-		// Primary detection: check if interface is backed by a known USB driver.
-		// This works regardless of naming scheme (usb0, rndis0, enp0s20f0u1c4i2, etc.)
-		if !u.isUSBInterface(name) {
-			continue
-		}
-
-		// Optional prefix filter: if configured, restrict to matching interfaces
-		if u.cfg.InterfacePrefix != "" && !u.matchesPrefix(name) {
+		if !u.servesInterface(name) {
 			continue
 		}
 
@@ -264,11 +304,44 @@ func (u *USBHandler) scanInterfaces() {
 	}
 }
 
+// IsUSBInterface reports whether the USB transport with cfg serves the
+// network interface name.
+func IsUSBInterface(cfg config.USBTransport, name string) bool {
+	u := &USBHandler{cfg: cfg}
+	return u.servesInterface(name)
+}
+
+// USBAddress returns the board's static address on the USB link, or "" in
+// host mode, where the tethering host assigns it.
+func USBAddress(cfg config.USBTransport) string {
+	if !cfg.IsGadget() {
+		return ""
+	}
+	u := &USBHandler{cfg: cfg}
+	return u.gadgetAddress()
+}
+
+// servesInterface reports whether the handler serves the interface name.
+func (u *USBHandler) servesInterface(name string) bool {
+	// Primary detection: check if interface is backed by a known USB driver.
+	// This works regardless of naming scheme (usb0, rndis0, enp0s20f0u1c4i2, etc.)
+	if !u.isUSBInterface(name) {
+		return false
+	}
+
+	// Optional prefix filter: if configured, restrict to matching interfaces
+	return u.cfg.InterfacePrefix == "" || u.matchesPrefix(name)
+}
+
 func (u *USBHandler) matchesPrefix(name string) bool {
 	return strings.HasPrefix(name, u.cfg.InterfacePrefix)
 }
 
 func (u *USBHandler) isUSBInterface(name string) bool {
+	if u.cfg.IsGadget() {
+		return name == u.gadgetInterface()
+	}
+
 	// Check if the interface is backed by a USB driver
 	driverLink := filepath.Join(sysClassNet, name, "device", "driver")
 	target, err := os.Readlink(driverLink)
@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultUSBGadgetAddress is the board's address on the USB gadget link.
+	DefaultUSBGadgetAddress = "10.0.2.1"
+
+	sysClassUDC = "/sys/class/udc"
+
+	// usbGadgetDir is the configfs gadget created by boardingpass-usb-gadget@.service.
+	usbGadgetDir = "/sys/kernel/config/usb_gadget/boardingpass"
+
+	defaultUSBGadgetFunction = "ncm"
+)
+
+// gadgetFunction returns the configured USB network function.
+func (u *USBHandler) gadgetFunction() string {
+	if u.cfg.Gadget.Function != "" {
+		return u.cfg.Gadget.Function
+	}
+	return defaultUSBGadgetFunction
+}
+
+// gadgetAddress returns the board's address on the gadget link.
+func (u *USBHandler) gadgetAddress() string {
+	if u.cfg.Address != "" {
+		return u.cfg.Address
+	}
+	return DefaultUSBGadgetAddress
+}
+
+// gadgetUnit returns the systemd unit that sets up the gadget and its DHCP server.
+func (u *USBHandler) gadgetUnit() string {
+	return fmt.Sprintf("boardingpass-usb-gadget@%s", u.gadgetFunction())
+}
+
+// startGadget writes the gadget configuration and starts the systemd unit
+// that creates the configfs gadget, binds it to the device controller and
+// serves DHCP on the resulting network interface.
+func (u *USBHandler) startGadget(ctx context.Context) error {
+	udc, err := u.resolveUDC()
+	if err != nil {
+		return err
+	}
+	address := u.gadgetAddress()
+
+	u.logger.Info("usb gadget resolved configuration", map[string]any{
+		"function": u.gadgetFunction(),
+		"udc":      udc,
+		"address":  address,
+	})
+
+	if err := u.generateGadgetEnvFile(udc, address); err != nil {
+		return fmt.Errorf("failed to generate environment file: %w", err)
+	}
+	if err := u.generateGadgetDnsmasqConf(address); err != nil {
+		return fmt.Errorf("failed to generate dnsmasq config: %w", err)
+	}
+
+	unit := u.gadgetUnit()
+	//nolint:gosec // G204: function name is validated in config
+	cmd := exec.CommandContext(ctx, "sudo", "systemctl", "start", unit)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start %s: %s: %w", unit, string(out), err)
+	}
+	return nil
+}
+
+// stopGadget stops the gadget unit, which unbinds and removes the gadget.
+func (u *USBHandler) stopGadget(ctx context.Context) error {
+	unit := u.gadgetUnit()
+	//nolint:gosec // G204: function name is validated in config
+	cmd := exec.CommandContext(ctx, "sudo", "systemctl", "stop", unit)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stop %s: %s: %w", unit, string(out), err)
+	}
+	return nil
+}
+
+// resolveUDC returns the USB device controller to bind the gadget to: from
+// config, or the first controller found.
+func (u *USBHandler) resolveUDC() (string, error) {
+	if u.cfg.Gadget.UDC != "" {
+		if _, err := os.Stat(filepath.Join(sysClassUDC, u.cfg.Gadget.UDC)); err != nil {
+			return "", fmt.Errorf("USB device controller %s not found: %w", u.cfg.Gadget.UDC, err)
+		}
+		return u.cfg.Gadget.UDC, nil
+	}
+
+	entries, err := os.ReadDir(sysClassUDC)
+	if err != nil || len(entries) == 0 {
+		return "", fmt.Errorf("no USB device controller found in %s (is the port in OTG/peripheral mode?)", sysClassUDC)
+	}
+	return entries[0].Name(), nil
+}
+
+// gadgetInterface returns the name of the gadget's network interface, or ""
+// while the gadget is not bound.
+func (u *USBHandler) gadgetInterface() string {
+	path := filepath.Join(usbGadgetDir, "functions", u.gadgetFunction()+".usb0", "ifname")
+	//nolint:gosec // G304: path built from validated function name
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSpace(string(data))
+	// The kernel reports a pattern such as "usb%d" until the interface exists
+	if strings.Contains(name, "%") {
+		return ""
+	}
+	return name
+}
+
+// generateGadgetEnvFile writes a systemd environment file for the gadget unit.
+func (u *USBHandler) generateGadgetEnvFile(udc, address string) error {
+	content := fmt.Sprintf("BOARDINGPASS_USB_UDC=%s\nBOARDINGPASS_USB_ADDRESS=%s\nBOARDINGPASS_USB_NETMASK=24\n",
+		udc, address)
+	path := filepath.Join(runtimeDir, "usb-gadget.env")
+	//nolint:gosec // G306: non-sensitive environment variables
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+// generateGadgetDnsmasqConf writes a dnsmasq configuration that leases an
+// address to the USB host. The interface is passed on the command line once
+// the gadget is bound, as its name is only known then.
+func (u *USBHandler) generateGadgetDnsmasqConf(address string) error {
+	rangeStart, rangeEnd := dhcpRange(address)
+
+	var b strings.Builder
+	b.WriteString("bind-interfaces\n")
+	fmt.Fprintf(&b, "listen-address=%s\n", address)
+	fmt.Fprintf(&b, "dhcp-range=%s,%s,255.255.255.0,12h\n", rangeStart, rangeEnd)
+	// No default route or DNS server, so the host keeps using its own uplink
+	b.WriteString("dhcp-option=option:router\n")
+	b.WriteString("dhcp-option=option:dns-server\n")
+	b.WriteString("port=0\n")
+	b.WriteString("no-resolv\n")
+	b.WriteString("no-hosts\n")
+
+	path := filepath.Join(runtimeDir, "dnsmasq-usb-gadget.conf")
+	//nolint:gosec // G306: config file, not secrets
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
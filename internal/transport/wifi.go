@@ -7,24 +7,47 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fzdarsky/boardingpass/internal/config"
 	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
 )
 
 const (
 	// runtimeDir is where generated configs are written (created by systemd RuntimeDirectory).
 	runtimeDir = "/run/boardingpass"
+
+	// stationIface is the virtual station interface added next to the AP on
+	// radios that can be an access point and a client at the same time.
+	stationIface = "bpsta0"
+)
+
+var (
+	// ifaceLimitPattern matches an interface type limit of an "iw phy info"
+	// combination, like "#{ AP, P2P-client, P2P-GO } <= 1".
+	ifaceLimitPattern = regexp.MustCompile(`#\{\s*([^}]*)\}\s*<=\s*(\d+)`)
+	// totalLimitPattern matches the interface limit of a combination.
+	totalLimitPattern = regexp.MustCompile(`total\s*<=\s*(\d+)`)
 )
 
+// WiFiScanner scans for WiFi networks on an interface.
+type WiFiScanner func(ctx context.Context, iface string) ([]protocol.WiFiNetwork, error)
+
 // WiFiHandler manages the WiFi AP transport lifecycle via systemd.
 type WiFiHandler struct {
 	cfg           config.WiFiTransport
 	logger        *logging.Logger
 	state         State
 	resolvedIface string // set during Start, used by Stop
+	channel       int    // AP channel, set during Start
+	scanner       WiFiScanner
+	scan          []protocol.WiFiNetwork // networks seen before the AP started
+	scannedAt     time.Time
 	mu            sync.Mutex
 }
 
@@ -67,6 +90,10 @@ func (w *WiFiHandler) Start(ctx context.Context) error {
 		return fmt.Errorf("wifi interface %s not found: %w", iface, err)
 	}
 
+	// Scan while the radio is still a client; NetworkManager cannot scan
+	// on it while it serves the AP
+	w.scanNetworks(ctx, iface)
+
 	// Resolve SSID
 	ssid := w.cfg.SSID
 	if ssid == "" {
@@ -82,6 +109,9 @@ func (w *WiFiHandler) Start(ctx context.Context) error {
 	if channel == 0 {
 		channel = 6
 	}
+	w.mu.Lock()
+	w.channel = channel
+	w.mu.Unlock()
 
 	// Resolve address
 	address := w.cfg.Address
@@ -191,6 +221,216 @@ func (w *WiFiHandler) setState(s State) {
 	w.state = s
 }
 
+// SetScanner sets the scanner that Start uses to record the WiFi networks
+// in range before the radio becomes an access point.
+func (w *WiFiHandler) SetScanner(scanner WiFiScanner) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.scanner = scanner
+}
+
+// CachedScan returns the networks found by the scan before the AP started
+// and when that scan ran. The time is zero if there was no scan.
+func (w *WiFiHandler) CachedScan() ([]protocol.WiFiNetwork, time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.scan, w.scannedAt
+}
+
+// Interface returns the interface the AP runs on, or is configured to.
+func (w *WiFiHandler) Interface() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.resolvedIface != "" {
+		return w.resolvedIface
+	}
+	return w.cfg.Interface
+}
+
+// ClientInterface returns the interface to connect to the WiFi network ssid
+// on, or to scan on if ssid is empty, and how the connection relates to the
+// AP:
+//   - protocol.WiFiModeDirect if the AP is not running,
+//   - protocol.WiFiModeConcurrent with a virtual station interface if the
+//     radio can be an access point and a client at the same time, and the
+//     network was seen on the AP's frequency,
+//   - protocol.WiFiModeSwitchOver with the AP interface otherwise, in which
+//     case the AP has to be stopped first.
+func (w *WiFiHandler) ClientInterface(ctx context.Context, ssid string) (string, string, error) {
+	w.mu.Lock()
+	state, iface, channel, networks := w.state, w.resolvedIface, w.channel, w.scan
+	w.mu.Unlock()
+
+	if state != StateActive && state != StateStarting {
+		if iface == "" {
+			var err error
+			if iface, err = w.resolveInterface(); err != nil {
+				return "", "", err
+			}
+		}
+		return iface, protocol.WiFiModeDirect, nil
+	}
+
+	// Single-radio chips keep the AP and the station on one channel, so a
+	// network elsewhere would take the AP along and cut off its clients
+	if ssid != "" {
+		if freq := networkFrequency(networks, ssid); freq != channelFrequency(channel) {
+			w.logger.Info("wifi network is not on the AP's channel, using switch-over", map[string]any{
+				"ssid":         ssid,
+				"frequency":    freq,
+				"ap_frequency": channelFrequency(channel),
+			})
+			return iface, protocol.WiFiModeSwitchOver, nil
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join("/sys/class/net", stationIface)); err == nil {
+		return stationIface, protocol.WiFiModeConcurrent, nil
+	}
+	link, err := os.Readlink(filepath.Join("/sys/class/net", iface, "phy80211"))
+	if err != nil {
+		return iface, protocol.WiFiModeSwitchOver, nil
+	}
+	phy := filepath.Base(link)
+	//nolint:gosec // G204: phy name is read from sysfs
+	info, err := exec.CommandContext(ctx, "iw", "phy", phy, "info").Output()
+	if err != nil || !supportsAPSTA(string(info)) {
+		return iface, protocol.WiFiModeSwitchOver, nil
+	}
+	// NetworkManager manages the new interface; it is removed on reboot
+	//nolint:gosec // G204: phy name is read from sysfs
+	cmd := exec.CommandContext(ctx, "sudo", "iw", "phy", phy, "interface", "add", stationIface, "type", "managed")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		w.logger.Warn("failed to add station interface, falling back to switch-over", map[string]any{
+			"phy":   phy,
+			"error": err.Error(),
+			"out":   string(out),
+		})
+		return iface, protocol.WiFiModeSwitchOver, nil
+	}
+	return stationIface, protocol.WiFiModeConcurrent, nil
+}
+
+// scanNetworks records the networks in range, if a scanner is set. Failures
+// are logged only, as the AP works without them.
+func (w *WiFiHandler) scanNetworks(ctx context.Context, iface string) {
+	w.mu.Lock()
+	scanner := w.scanner
+	w.mu.Unlock()
+	if scanner == nil {
+		return
+	}
+
+	networks, err := scanner(ctx, iface)
+	if err != nil {
+		w.logger.Warn("failed to scan for wifi networks before starting AP", map[string]any{
+			"interface": iface,
+			"error":     err.Error(),
+		})
+		return
+	}
+	w.mu.Lock()
+	w.scan, w.scannedAt = networks, time.Now()
+	w.mu.Unlock()
+}
+
+// channelFrequency returns the center frequency in MHz of a 2.4 GHz channel,
+// the band the AP runs in.
+func channelFrequency(channel int) int {
+	if channel == 14 {
+		return 2484
+	}
+	return 2407 + 5*channel
+}
+
+// networkFrequency returns the frequency of the strongest network named
+// ssid, or 0 if it was not found.
+func networkFrequency(networks []protocol.WiFiNetwork, ssid string) int {
+	freq, signal := 0, -1
+	for _, network := range networks {
+		if network.SSID == ssid && network.Signal > signal {
+			freq, signal = network.Frequency, network.Signal
+		}
+	}
+	return freq
+}
+
+// supportsAPSTA reports whether the "valid interface combinations" of
+// "iw phy <phy> info" output allow a managed (station) interface next to an
+// AP interface.
+func supportsAPSTA(info string) bool {
+	for _, combination := range interfaceCombinations(info) {
+		total := 0
+		if m := totalLimitPattern.FindStringSubmatch(combination); m != nil {
+			total, _ = strconv.Atoi(m[1])
+		}
+		if total < 2 {
+			continue
+		}
+
+		var managed, ap []int // indexes of the limits that include the type
+		for i, m := range ifaceLimitPattern.FindAllStringSubmatch(combination, -1) {
+			limit, _ := strconv.Atoi(m[2])
+			hasManaged, hasAP := false, false
+			for _, t := range strings.Split(m[1], ",") {
+				switch strings.TrimSpace(t) {
+				case "managed":
+					hasManaged = true
+				case "AP":
+					hasAP = true
+				}
+			}
+			if hasManaged && hasAP && limit >= 2 {
+				return true
+			}
+			if hasManaged {
+				managed = append(managed, i)
+			}
+			if hasAP {
+				ap = append(ap, i)
+			}
+		}
+		for _, i := range managed {
+			for _, j := range ap {
+				if i != j {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// interfaceCombinations returns the entries of the "valid interface
+// combinations" section of "iw phy <phy> info" output, with continuation
+// lines joined.
+func interfaceCombinations(info string) []string {
+	var combinations []string
+	inSection, sectionIndent := false, 0
+	for _, line := range strings.Split(info, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if !inSection {
+			if strings.HasPrefix(trimmed, "valid interface combinations:") {
+				inSection, sectionIndent = true, indent
+			}
+			continue
+		}
+		if indent <= sectionIndent {
+			break
+		}
+		if strings.HasPrefix(trimmed, "*") {
+			combinations = append(combinations, strings.TrimPrefix(trimmed, "*"))
+		} else if len(combinations) > 0 {
+			combinations[len(combinations)-1] += " " + trimmed
+		}
+	}
+	return combinations
+}
+
 // resolveInterface returns the WiFi interface to use: from config or auto-detected.
 func (w *WiFiHandler) resolveInterface() (string, error) {
 	if w.cfg.Interface != "" {
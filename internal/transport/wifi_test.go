@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportsAPSTA(t *testing.T) {
+	tests := []struct {
+		name string
+		info string
+		want bool
+	}{
+		{
+			name: "separate managed and AP limits",
+			info: `Wiphy phy0
+	max # scan SSIDs: 10
+	Supported interface modes:
+		 * managed
+		 * AP
+	valid interface combinations:
+		 * #{ managed } <= 1, #{ AP, P2P-client, P2P-GO } <= 1, #{ P2P-device } <= 1,
+		   total <= 3, #channels <= 2
+	HT Capability overrides:
+		 * MCS: ff ff ff ff ff ff ff ff ff ff
+`,
+			want: true,
+		},
+		{
+			name: "shared limit of two",
+			info: `	valid interface combinations:
+		 * #{ managed, AP } <= 2,
+		   total <= 2, #channels <= 1
+`,
+			want: true,
+		},
+		{
+			name: "shared limit of one",
+			info: `	valid interface combinations:
+		 * #{ managed, AP } <= 1,
+		   total <= 1, #channels <= 1
+`,
+			want: false,
+		},
+		{
+			name: "AP only in another combination",
+			info: `	valid interface combinations:
+		 * #{ managed } <= 2,
+		   total <= 2, #channels <= 1
+		 * #{ AP } <= 1,
+		   total <= 1, #channels <= 1
+`,
+			want: false,
+		},
+		{
+			name: "total of one",
+			info: `	valid interface combinations:
+		 * #{ managed } <= 1, #{ AP } <= 1,
+		   total <= 1, #channels <= 1
+`,
+			want: false,
+		},
+		{
+			name: "no combinations",
+			info: "Wiphy phy0\n\tSupported interface modes:\n\t\t * managed\n\t\t * AP\n",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, supportsAPSTA(tt.info))
+		})
+	}
+}
+
+func TestChannelFrequency(t *testing.T) {
+	assert.Equal(t, 2412, channelFrequency(1))
+	assert.Equal(t, 2437, channelFrequency(6))
+	assert.Equal(t, 2484, channelFrequency(14))
+}
+
+func TestWiFiHandler_ClientInterface_OtherChannel(t *testing.T) {
+	w := NewWiFiHandler(config.WiFiTransport{}, logging.New(logging.LevelInfo, logging.FormatJSON))
+	w.state, w.resolvedIface, w.channel = StateActive, "wlan0", 6
+	w.scan = []protocol.WiFiNetwork{
+		{SSID: "office", Signal: 40, Frequency: 2437, Channel: 6},
+		{SSID: "office", Signal: 80, Frequency: 5180, Channel: 36},
+	}
+
+	// The strongest "office" is on 5 GHz, the hidden network was not seen:
+	// neither can share the radio with the AP
+	for _, ssid := range []string{"office", "hidden"} {
+		iface, mode, err := w.ClientInterface(context.Background(), ssid)
+		require.NoError(t, err)
+		assert.Equal(t, "wlan0", iface, ssid)
+		assert.Equal(t, protocol.WiFiModeSwitchOver, mode, ssid)
+	}
+}
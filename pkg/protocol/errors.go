@@ -1,7 +1,11 @@
 // Package protocol defines shared data structures and error codes for the BoardingPass API.
 package protocol
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // ErrorCode represents a standardized error code for the BoardingPass API.
 type ErrorCode string
@@ -38,6 +42,14 @@ const (
 	ErrCodePathNotAllowed ErrorCode = "PATH_NOT_ALLOWED"
 	// ErrCodeCommandNotAllowed indicates the command is not in the allow-list.
 	ErrCodeCommandNotAllowed ErrorCode = "COMMAND_NOT_ALLOWED"
+	// ErrCodeValidationFailed indicates request fields failed validation.
+	ErrCodeValidationFailed ErrorCode = "VALIDATION_FAILED"
+	// ErrCodeInterfaceNotFound indicates the network interface does not exist.
+	ErrCodeInterfaceNotFound ErrorCode = "INTERFACE_NOT_FOUND"
+	// ErrCodeWiFiBusy indicates the WiFi radio is busy with another operation.
+	ErrCodeWiFiBusy ErrorCode = "WIFI_BUSY"
+	// ErrCodeEnrollmentInProgress indicates another enrollment is in progress.
+	ErrCodeEnrollmentInProgress ErrorCode = "ENROLLMENT_IN_PROGRESS"
 
 	// ErrCodeSystemError indicates a system-level error occurred.
 	ErrCodeSystemError ErrorCode = "SYSTEM_ERROR"
@@ -45,12 +57,18 @@ const (
 	ErrCodeFileSystemError ErrorCode = "FILESYSTEM_ERROR"
 	// ErrCodeCommandFailed indicates a command execution failed.
 	ErrCodeCommandFailed ErrorCode = "COMMAND_FAILED"
+	// ErrCodeCommandTimeout indicates a command did not finish in time.
+	ErrCodeCommandTimeout ErrorCode = "COMMAND_TIMEOUT"
 	// ErrCodeTPMError indicates a TPM-related error occurred.
 	ErrCodeTPMError ErrorCode = "TPM_ERROR"
 	// ErrCodeNetworkError indicates a network-related error occurred.
 	ErrCodeNetworkError ErrorCode = "NETWORK_ERROR"
 	// ErrCodeTLSError indicates a TLS-related error occurred.
 	ErrCodeTLSError ErrorCode = "TLS_ERROR"
+	// ErrCodeWiFiConnectFailed indicates the device could not join a WiFi network.
+	ErrCodeWiFiConnectFailed ErrorCode = "WIFI_CONNECT_FAILED"
+	// ErrCodeEnrollmentFailed indicates a management service rejected an enrollment.
+	ErrCodeEnrollmentFailed ErrorCode = "ENROLLMENT_FAILED"
 
 	// ErrCodeAlreadyProvisioned indicates the device is already provisioned.
 	ErrCodeAlreadyProvisioned ErrorCode = "ALREADY_PROVISIONED"
@@ -69,9 +87,17 @@ const (
 
 // ErrorResponse represents a standardized API error response.
 type ErrorResponse struct {
-	Code    ErrorCode `json:"code"`
-	Message string    `json:"message"`
-	Details string    `json:"details,omitempty"`
+	Code    ErrorCode    `json:"code"`
+	Message string       `json:"message"`
+	Details string       `json:"details,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"` // set for VALIDATION_FAILED
+}
+
+// FieldError describes why a request field is invalid. Field is the JSON path
+// of the field, e.g. "ipv4.addresses[0]".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 // Error implements the error interface.
@@ -171,6 +197,35 @@ func NewCommandNotAllowedError(commandID string) *ErrorResponse {
 	return NewErrorWithDetails(ErrCodeCommandNotAllowed, "Command not in allow-list", commandID)
 }
 
+// NewValidationError creates a validation error for the given fields.
+func NewValidationError(fields []FieldError) *ErrorResponse {
+	details := make([]string, len(fields))
+	for i, f := range fields {
+		details[i] = f.Field + ": " + f.Message
+	}
+	return &ErrorResponse{
+		Code:    ErrCodeValidationFailed,
+		Message: "Validation failed",
+		Details: strings.Join(details, "; "),
+		Fields:  fields,
+	}
+}
+
+// NewInterfaceNotFoundError creates an interface not found error.
+func NewInterfaceNotFoundError(name string) *ErrorResponse {
+	return NewErrorWithDetails(ErrCodeInterfaceNotFound, "Network interface not found", name)
+}
+
+// NewWiFiBusyError creates a WiFi busy error.
+func NewWiFiBusyError(details string) *ErrorResponse {
+	return NewErrorWithDetails(ErrCodeWiFiBusy, "WiFi radio is busy", details)
+}
+
+// NewEnrollmentInProgressError creates an enrollment in progress error.
+func NewEnrollmentInProgressError(details string) *ErrorResponse {
+	return NewErrorWithDetails(ErrCodeEnrollmentInProgress, "Another enrollment is in progress", details)
+}
+
 // NewSystemError creates a system error.
 func NewSystemError(details string) *ErrorResponse {
 	return NewErrorWithDetails(ErrCodeSystemError, "System error", details)
@@ -186,6 +241,11 @@ func NewCommandFailedError(exitCode int) *ErrorResponse {
 	return NewErrorWithDetails(ErrCodeCommandFailed, "Command execution failed", fmt.Sprintf("Exit code: %d", exitCode))
 }
 
+// NewCommandTimeoutError creates a command timeout error.
+func NewCommandTimeoutError(commandID string, timeout time.Duration) *ErrorResponse {
+	return NewErrorWithDetails(ErrCodeCommandTimeout, "Command timed out", fmt.Sprintf("%s did not finish within %s", commandID, timeout))
+}
+
 // NewTPMError creates a TPM error.
 func NewTPMError(details string) *ErrorResponse {
 	return NewErrorWithDetails(ErrCodeTPMError, "TPM error", details)
@@ -201,6 +261,16 @@ func NewTLSError(details string) *ErrorResponse {
 	return NewErrorWithDetails(ErrCodeTLSError, "TLS error", details)
 }
 
+// NewWiFiConnectFailedError creates a WiFi connect failed error.
+func NewWiFiConnectFailedError(ssid, reason string) *ErrorResponse {
+	return NewErrorWithDetails(ErrCodeWiFiConnectFailed, "Failed to connect to WiFi network", fmt.Sprintf("%s: %s", ssid, reason))
+}
+
+// NewEnrollmentFailedError creates an enrollment failed error.
+func NewEnrollmentFailedError(details string) *ErrorResponse {
+	return NewErrorWithDetails(ErrCodeEnrollmentFailed, "Enrollment failed", details)
+}
+
 // NewAlreadyProvisionedError creates an already provisioned error.
 func NewAlreadyProvisionedError() *ErrorResponse {
 	return NewError(ErrCodeAlreadyProvisioned, "Device has already been provisioned")
@@ -4,6 +4,7 @@ package protocol_test
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
 	"github.com/stretchr/testify/assert"
@@ -295,6 +296,28 @@ func TestNewCommandFailedError(t *testing.T) {
 	assert.Contains(t, err.Details, "127")
 }
 
+func TestNewCommandTimeoutError(t *testing.T) {
+	err := protocol.NewCommandTimeoutError("set-ntp", 30*time.Second)
+	assert.Equal(t, protocol.ErrCodeCommandTimeout, err.Code)
+	assert.Equal(t, "Command timed out", err.Message)
+	assert.Equal(t, "set-ntp did not finish within 30s", err.Details)
+}
+
+func TestNewValidationError(t *testing.T) {
+	err := protocol.NewValidationError([]protocol.FieldError{
+		{Field: "hostname", Message: "must not be empty"},
+		{Field: "ipv4.dns[1]", Message: `"x" is not an IPv4 address`},
+	})
+	assert.Equal(t, protocol.ErrCodeValidationFailed, err.Code)
+	assert.Equal(t, "Validation failed", err.Message)
+	assert.Equal(t, `hostname: must not be empty; ipv4.dns[1]: "x" is not an IPv4 address`, err.Details)
+	assert.Len(t, err.Fields, 2)
+
+	data, marshalErr := json.Marshal(err)
+	require.NoError(t, marshalErr)
+	assert.Contains(t, string(data), `"fields":[{"field":"hostname","message":"must not be empty"}`)
+}
+
 func TestLifecycleErrors(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -374,3 +397,10 @@ func TestConfigurationErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWiFiConnectFailedError(t *testing.T) {
+	err := protocol.NewWiFiConnectFailedError("office", "wrong or missing password")
+	assert.Equal(t, protocol.ErrCodeWiFiConnectFailed, err.Code)
+	assert.Equal(t, "Failed to connect to WiFi network", err.Message)
+	assert.Equal(t, "office: wrong or missing password", err.Details)
+}
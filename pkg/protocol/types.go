@@ -1,5 +1,7 @@
 package protocol
 
+import "time"
+
 // SystemInfo represents hardware and software characteristics of the device.
 // Derived from system inspection (/sys, /proc, DMI, TPM).
 type SystemInfo struct {
@@ -92,12 +94,245 @@ type ConfigFile struct {
 	Mode    int    `json:"mode"`    // Unix file permissions
 }
 
+// HostnameConfig represents the request body for PUT /system/hostname.
+type HostnameConfig struct {
+	Hostname       string `json:"hostname"`
+	PrettyHostname string `json:"pretty_hostname,omitempty"`
+}
+
+// TimeConfig represents the request body for PUT /system/time.
+// Omitted fields are left unchanged.
+type TimeConfig struct {
+	Timezone   string   `json:"timezone,omitempty"` // e.g. "Europe/Berlin"
+	NTP        *bool    `json:"ntp,omitempty"`      // enables network time synchronization
+	NTPServers []string `json:"ntp_servers,omitempty"`
+}
+
+// ProxyConfig represents the request body for PUT /system/proxy.
+// An empty config removes the proxy settings.
+type ProxyConfig struct {
+	HTTPProxy  string   `json:"http_proxy,omitempty"`
+	HTTPSProxy string   `json:"https_proxy,omitempty"`
+	NoProxy    []string `json:"no_proxy,omitempty"`
+}
+
+// InterfaceConfig represents the request body for PUT /network/interfaces/{name}.
+// Omitted address families are left unchanged.
+type InterfaceConfig struct {
+	IPv4 *IPConfig `json:"ipv4,omitempty"`
+	IPv6 *IPConfig `json:"ipv6,omitempty"`
+}
+
+// IPConfig represents the configuration of one address family of an interface.
+type IPConfig struct {
+	Method    string   `json:"method"`              // "auto", "manual" or "disabled"
+	Addresses []string `json:"addresses,omitempty"` // CIDR notation, e.g. "192.168.1.10/24"
+	Gateway   string   `json:"gateway,omitempty"`
+	DNS       []string `json:"dns,omitempty"`
+}
+
+// WiFiNetwork describes an access point found by a WiFi scan.
+type WiFiNetwork struct {
+	SSID      string `json:"ssid"` // empty for hidden networks
+	BSSID     string `json:"bssid"`
+	Signal    int    `json:"signal"`    // strength in percent
+	Security  string `json:"security"`  // "open", "wep", "owe", "wpa-psk", "sae" or "wpa-eap"
+	Frequency int    `json:"frequency"` // MHz
+	Channel   int    `json:"channel"`
+}
+
+// WiFiScanResponse represents the response to GET /network/wifi/scan.
+type WiFiScanResponse struct {
+	Interface string        `json:"interface"`
+	Networks  []WiFiNetwork `json:"networks"` // strongest first
+	ScannedAt time.Time     `json:"scanned_at"`
+	// Cached is set if the radio serves the WiFi access point and cannot
+	// scan; the networks were found before the access point started.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// WiFiConnectRequest represents the request body for POST /network/wifi/connect.
+type WiFiConnectRequest struct {
+	SSID      string `json:"ssid"`
+	PSK       string `json:"psk,omitempty"`       // empty for open networks
+	Security  string `json:"security,omitempty"`  // "wpa-psk" (default with a PSK) or "sae"
+	Hidden    bool   `json:"hidden,omitempty"`    // the network does not broadcast its SSID
+	Interface string `json:"interface,omitempty"` // defaults to the access point's radio or the first WiFi device
+}
+
+// WiFi client modes, telling how a client connection shares the radio with
+// the WiFi access point.
+const (
+	// WiFiModeDirect: the access point does not use the radio.
+	WiFiModeDirect = "direct"
+	// WiFiModeConcurrent: the radio runs the access point and a station
+	// interface for the client at the same time.
+	WiFiModeConcurrent = "concurrent"
+	// WiFiModeSwitchOver: the access point stops before the client connects,
+	// and restarts if the connection fails.
+	WiFiModeSwitchOver = "switch-over"
+)
+
+// WiFi connection attempt states.
+const (
+	WiFiStateScheduled  = "scheduled"
+	WiFiStateConnecting = "connecting"
+	WiFiStateConnected  = "connected"
+	WiFiStateFailed     = "failed"
+)
+
+// WiFiConnectStatus represents the response to POST and GET
+// /network/wifi/connect: the state of the last connection attempt.
+type WiFiConnectStatus struct {
+	State     string     `json:"state"`
+	SSID      string     `json:"ssid"`
+	Interface string     `json:"interface"`
+	Mode      string     `json:"mode"`
+	SwitchAt  *time.Time `json:"switch_at,omitempty"` // when a scheduled switch-over starts
+	Addresses []string   `json:"addresses,omitempty"` // CIDR notation, once connected
+	Error     string     `json:"error,omitempty"`     // why the attempt failed
+}
+
+// ConnectivityRequest represents the request body for
+// POST /diagnostics/connectivity. All fields are optional.
+type ConnectivityRequest struct {
+	// Endpoints are URLs, like "https://api.example.com", or "host:port"
+	// pairs. Each is resolved and connected to; https and wss URLs are
+	// checked with a TLS handshake, too.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// UseProxy connects to the endpoints through the proxy set with
+	// PUT /system/proxy.
+	UseProxy bool `json:"use_proxy,omitempty"`
+	// NTPServers default to the configured chrony servers.
+	NTPServers []string `json:"ntp_servers,omitempty"`
+	// MinMTU is the smallest acceptable MTU of the default route's
+	// interface; defaults to 1280.
+	MinMTU int `json:"min_mtu,omitempty"`
+}
+
+// Connectivity check statuses.
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// ConnectivityCheck is the result of one connectivity check.
+type ConnectivityCheck struct {
+	Check      string  `json:"check"`            // "default_route", "mtu", "proxy", "dns", "tcp", "tls" or "ntp"
+	Target     string  `json:"target,omitempty"` // endpoint, host or NTP server checked
+	Status     string  `json:"status"`           // CheckPass, CheckFail or CheckSkip
+	Message    string  `json:"message,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// ConnectivityResponse represents the response to POST /diagnostics/connectivity.
+type ConnectivityResponse struct {
+	Passed bool                `json:"passed"` // no check failed
+	Checks []ConnectivityCheck `json:"checks"`
+}
+
+// FlightControlEnrollRequest represents the request body of POST
+// /enrollment/flightctl.
+type FlightControlEnrollRequest struct {
+	Server      string            `json:"server,omitempty"`       // Flight Control API URL (default: configured)
+	Token       string            `json:"token"`                  // bearer token to submit the enrollment request with
+	CACert      string            `json:"ca_cert,omitempty"`      // PEM CA of the API (default: configured or system roots)
+	AgentServer string            `json:"agent_server,omitempty"` // agent API URL the agent connects to (default: server)
+	Labels      map[string]string `json:"labels,omitempty"`       // labels of the device once approved
+}
+
+// Enrollment states.
+const (
+	EnrollmentStatePending  = "pending_approval" // request submitted, awaiting approval
+	EnrollmentStateApproved = "approved"         // certificate issued, agent being configured
+	EnrollmentStateRunning  = "running"          // enrollment command running
+	EnrollmentStateEnrolled = "enrolled"         // agent configured
+	EnrollmentStateDenied   = "denied"
+	EnrollmentStateFailed   = "failed"
+)
+
+// Enrollment field types, besides the command parameter types (integer,
+// boolean, ip, ipv4, ipv6, cidr and hostname).
+const (
+	FieldTypeString = "string"
+	FieldTypeSecret = "secret" // a string to mask in forms, e.g. a token
+	FieldTypeURL    = "url"
+	FieldTypePEM    = "pem"    // PEM-encoded certificates
+	FieldTypeLabels = "labels" // an object of string labels
+)
+
+// EnrollmentField describes an input field of an enrollment backend.
+type EnrollmentField struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Default     string   `json:"default,omitempty"` // value used if the field is omitted
+	Pattern     string   `json:"pattern,omitempty"` // regular expression the whole value must match
+	Enum        []string `json:"enum,omitempty"`    // allowed values
+}
+
+// EnrollmentBackend describes a management service the device can enroll
+// with, and the fields of its enrollment request, so clients can build
+// forms for it.
+type EnrollmentBackend struct {
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	Description string            `json:"description,omitempty"`
+	Fields      []EnrollmentField `json:"fields"`
+}
+
+// EnrollmentBackendList represents the response to GET /enrollment/backends.
+type EnrollmentBackendList struct {
+	Backends []EnrollmentBackend `json:"backends"`
+}
+
+// EnrollmentStatus represents the state of the last enrollment with a
+// management service, returned by GET /enrollment.
+type EnrollmentStatus struct {
+	Backend     string    `json:"backend"`
+	State       string    `json:"state"`
+	Server      string    `json:"server,omitempty"`
+	RequestName string    `json:"request_name,omitempty"` // name of the enrollment request, e.g. the device name
+	Message     string    `json:"message,omitempty"`      // reason of a denial or failure
+	Files       []string  `json:"files,omitempty"`        // agent configuration files written
+	SubmittedAt time.Time `json:"submitted_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
 // CommandRequest represents a request to execute an allow-listed command.
 type CommandRequest struct {
 	ID     string   `json:"id"`
 	Params []string `json:"params,omitempty"`
 }
 
+// CommandInfo describes an allow-listed command.
+type CommandInfo struct {
+	ID          string         `json:"id"`
+	Description string         `json:"description,omitempty"`
+	MaxParams   int            `json:"max_params"`
+	Params      []CommandParam `json:"params,omitempty"` // absent if params are not validated
+	Sudo        bool           `json:"sudo"`
+	Timeout     string         `json:"timeout"` // Go duration, e.g. "5m0s"
+}
+
+// CommandParam describes a positional parameter of a command.
+type CommandParam struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"` // string, integer, boolean, ip, ipv4, ipv6, cidr or hostname
+	Pattern     string   `json:"pattern,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Optional    bool     `json:"optional,omitempty"`
+	Secret      bool     `json:"secret,omitempty"` // a value to mask, e.g. a token
+}
+
+// CommandList represents the response to GET /commands.
+type CommandList struct {
+	Commands []CommandInfo `json:"commands"`
+}
+
 // CompleteRequest represents the optional request body for POST /complete.
 type CompleteRequest struct {
 	Reboot bool `json:"reboot"`
@@ -105,9 +340,10 @@ type CompleteRequest struct {
 
 // CommandResponse represents the result of command execution.
 type CommandResponse struct {
-	ExitCode int    `json:"exit_code"`
-	Stdout   string `json:"stdout"`
-	Stderr   string `json:"stderr"`
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"` // stdout or stderr exceeded max_output_bytes
 }
 
 // SRPInitRequest represents the initial SRP-6a authentication request.
@@ -141,3 +377,68 @@ type CompleteResponse struct {
 	SentinelFile string  `json:"sentinel_file"`
 	Message      *string `json:"message,omitempty"`
 }
+
+// Audit events.
+const (
+	AuditEventAuth      = "auth"
+	AuditEventConfigure = "configure"
+	AuditEventCommand   = "command"
+	AuditEventComplete  = "complete"
+	AuditEventSystem    = "system"
+	AuditEventWiFi      = "wifi"
+	AuditEventEnroll    = "enrollment"
+)
+
+// AuditRecord is an entry of the device's audit log. Records are chained:
+// each carries the hash of the one before, so that changing, inserting or
+// removing records breaks the chain.
+type AuditRecord struct {
+	Seq          uint64        `json:"seq"` // starts at 1
+	Time         time.Time     `json:"time"`
+	Event        string        `json:"event"`
+	Success      bool          `json:"success"`
+	Username     string        `json:"username,omitempty"`      // of the session, or that authenticated
+	Transport    string        `json:"transport,omitempty"`     // e.g. "ethernet", "ble", "relay"
+	ClientIP     string        `json:"client_ip,omitempty"`     // peer of the connection
+	ForwardedFor string        `json:"forwarded_for,omitempty"` // X-Forwarded-For header, unverified
+	Message      string        `json:"message,omitempty"`       // reason of a failure
+	Target       string        `json:"target,omitempty"`        // system: the setting; wifi: the SSID; enrollment: the backend
+	Files        []AuditFile   `json:"files,omitempty"`         // configure: the files of the bundle
+	Command      *AuditCommand `json:"command,omitempty"`
+	Reboot       bool          `json:"reboot,omitempty"` // complete: a reboot was requested
+	PrevHash     string        `json:"prev_hash"`        // hash of the previous record
+	Hash         string        `json:"hash"`             // SHA-256 of the record without hash, hex-encoded
+}
+
+// AuditFile records a file of a configuration bundle, without its content.
+type AuditFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"` // of the decoded content
+	Mode   int    `json:"mode"`
+}
+
+// AuditCommand records an executed command.
+type AuditCommand struct {
+	ID       string   `json:"id"`
+	Params   []string `json:"params,omitempty"`
+	ExitCode *int     `json:"exit_code,omitempty"` // unset if the command did not run
+}
+
+// AuditLog represents the response to GET /audit.
+type AuditLog struct {
+	Records  []AuditRecord `json:"records"`
+	Verified bool          `json:"verified"`        // the hash chain is intact
+	Error    string        `json:"error,omitempty"` // where the chain is broken
+}
+
+// DeviceAnnouncement is posted by the service to a provisioning controller
+// on start and whenever its addresses change.
+type DeviceAnnouncement struct {
+	ID          string             `json:"id"` // serial number, or hardware address without one
+	Version     string             `json:"version"`
+	System      SystemInfo         `json:"system"`
+	Interfaces  []NetworkInterface `json:"interfaces"`
+	Fingerprint string             `json:"fingerprint"` // TLS certificate, "SHA256:<base64>"
+	Addresses   []string           `json:"addresses"`   // IP addresses the API is reachable on
+	Port        int                `json:"port"`
+}
@@ -355,6 +355,34 @@ func TestCompleteResponse_JSON(t *testing.T) {
 	})
 }
 
+func TestDeviceAnnouncement_JSON(t *testing.T) {
+	input := protocol.DeviceAnnouncement{
+		ID:          "SN1234",
+		Version:     "v0.3.0",
+		System:      protocol.SystemInfo{Hostname: "edge-01"},
+		Interfaces:  []protocol.NetworkInterface{{Name: "eth0", MACAddress: "dc:a6:32:12:34:56", LinkState: "up"}},
+		Fingerprint: "SHA256:abc",
+		Addresses:   []string{"192.0.2.10", "2001:db8::10"},
+		Port:        9455,
+	}
+
+	data, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, "SN1234", fields["id"])
+	assert.Equal(t, "SHA256:abc", fields["fingerprint"])
+	assert.Equal(t, []any{"192.0.2.10", "2001:db8::10"}, fields["addresses"])
+	assert.InDelta(t, 9455, fields["port"], 0)
+	assert.Contains(t, fields, "system")
+	assert.Contains(t, fields, "interfaces")
+
+	var decoded protocol.DeviceAnnouncement
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, input, decoded)
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
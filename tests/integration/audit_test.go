@@ -0,0 +1,252 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/api/handlers"
+	"github.com/fzdarsky/boardingpass/internal/api/middleware"
+	"github.com/fzdarsky/boardingpass/internal/audit"
+	"github.com/fzdarsky/boardingpass/internal/auth"
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAuditHandler_RecordsProvisioning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExecutor := command.NewMockCommandExecutor(ctrl)
+	mockExecutor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), true, gomock.Any()).
+		Return(&protocol.CommandResponse{ExitCode: 3}, nil).
+		Times(1)
+
+	testConfig := &config.Config{
+		Paths: config.PathSettings{
+			AllowList:     []string{"/etc/test/"},
+			RootDirectory: testRootDir(t),
+		},
+		Commands: []config.CommandDefinition{
+			{ID: "restart", Path: "/usr/bin/systemctl", Args: []string{"restart"}, MaxParams: 1},
+		},
+	}
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"), logger)
+	require.NoError(t, err)
+
+	sessionManager := auth.NewSessionManager([]byte("test-secret-key-32-bytes-long!!!"), time.Hour)
+	defer sessionManager.Stop()
+	token, err := sessionManager.CreateSession("admin")
+	require.NoError(t, err)
+	authMiddleware := middleware.NewAuthMiddleware(sessionManager)
+
+	configureHandler := handlers.NewConfigureHandler(testConfig, logger)
+	configureHandler.SetAuditLog(auditLog)
+	commandHandler, err := handlers.NewCommandHandlerWithExecutor(testConfig, mockExecutor, logger)
+	require.NoError(t, err)
+	commandHandler.SetAuditLog(auditLog)
+
+	mux := http.NewServeMux()
+	mux.Handle("/configure", authMiddleware.Require(configureHandler))
+	mux.Handle("/command", authMiddleware.Require(commandHandler))
+	mux.Handle("/audit", authMiddleware.Require(handlers.NewAuditHandler(auditLog, logger)))
+	handler := middleware.Transport("ble", mux)
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var data []byte
+		if body != nil {
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	content := []byte("config content")
+	w := do(http.MethodPost, "/configure", protocol.ConfigBundle{Files: []protocol.ConfigFile{
+		{Path: "test/app.conf", Content: base64.StdEncoding.EncodeToString(content), Mode: 0o640},
+	}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = do(http.MethodPost, "/command", protocol.CommandRequest{ID: "restart", Params: []string{"app.service"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = do(http.MethodPost, "/command", protocol.CommandRequest{ID: "reboot"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do(http.MethodGet, "/audit", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var log protocol.AuditLog
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&log))
+	assert.True(t, log.Verified, log.Error)
+	require.Len(t, log.Records, 3)
+
+	sum := sha256.Sum256(content)
+	configure := log.Records[0]
+	assert.Equal(t, protocol.AuditEventConfigure, configure.Event)
+	assert.True(t, configure.Success)
+	assert.Equal(t, "admin", configure.Username)
+	assert.Equal(t, "ble", configure.Transport)
+	assert.Equal(t, "192.0.2.1", configure.ClientIP, "the peer, not the forwarded address")
+	assert.Equal(t, "203.0.113.7", configure.ForwardedFor)
+	assert.Equal(t, []protocol.AuditFile{
+		{Path: "test/app.conf", SHA256: hex.EncodeToString(sum[:]), Mode: 0o640},
+	}, configure.Files)
+
+	restart := log.Records[1]
+	assert.Equal(t, protocol.AuditEventCommand, restart.Event)
+	assert.False(t, restart.Success, "non-zero exit code is a failure")
+	require.NotNil(t, restart.Command)
+	assert.Equal(t, "restart", restart.Command.ID)
+	assert.Equal(t, []string{"app.service"}, restart.Command.Params)
+	require.NotNil(t, restart.Command.ExitCode)
+	assert.Equal(t, 3, *restart.Command.ExitCode)
+
+	reboot := log.Records[2]
+	assert.False(t, reboot.Success)
+	assert.Nil(t, reboot.Command.ExitCode)
+	assert.Equal(t, "command is not in the allow-list", reboot.Message)
+}
+
+func TestAuditHandler_RedactsSecretParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExecutor := command.NewMockCommandExecutor(ctrl)
+	mockExecutor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), true, []string{"example-org", "s3cr3t-key"}).
+		Return(&protocol.CommandResponse{}, nil).
+		Times(1)
+
+	testConfig := &config.Config{
+		Commands: []config.CommandDefinition{
+			{ID: "enroll-insights", Path: "/usr/lib/boardingpass/scripts/enroll-insights.sh", Params: []config.CommandParam{
+				{Name: "org"},
+				{Name: "activation-key", Secret: true},
+			}},
+		},
+	}
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"), logger)
+	require.NoError(t, err)
+	commandHandler, err := handlers.NewCommandHandlerWithExecutor(testConfig, mockExecutor, logger)
+	require.NoError(t, err)
+	commandHandler.SetAuditLog(auditLog)
+
+	body, err := json.Marshal(protocol.CommandRequest{
+		ID:     "enroll-insights",
+		Params: []string{"example-org", "s3cr3t-key"},
+	})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	commandHandler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/command", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	records, err := auditLog.Records()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.NotNil(t, records[0].Command)
+	assert.Equal(t, []string{"example-org", "[redacted]"}, records[0].Command.Params)
+
+	data, err := os.ReadFile(auditLog.Path())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cr3t-key")
+}
+
+func TestAuditHandler_RecordsTypedEndpoints(t *testing.T) {
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"), logger)
+	require.NoError(t, err)
+
+	systemHandler, _ := newSystemHandler(t)
+	systemHandler.SetAuditLog(auditLog)
+	wifiHandler, _ := newWiFiHandler(protocol.WiFiModeConcurrent)
+	wifiHandler.SetAuditLog(auditLog)
+
+	ctrl := gomock.NewController(t)
+	executor := command.NewMockCommandExecutor(ctrl)
+	executor.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&protocol.CommandResponse{}, nil).AnyTimes()
+	backends := enrollment.NewRegistry()
+	require.NoError(t, backends.Register(enrollment.NewCommandBackend(
+		config.EnrollmentBackendSettings{Name: "awx", Command: "enroll-awx", SecretParams: []string{"token"}},
+		&config.CommandDefinition{ID: "enroll-awx", Path: "/usr/libexec/enroll-awx", Params: []config.CommandParam{{Name: "token"}}},
+		executor, logger)))
+	enrollmentHandler := handlers.NewEnrollmentHandler(backends, logger)
+	enrollmentHandler.SetAuditLog(auditLog)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/system/hostname", systemHandler.ServeHostname)
+	mux.HandleFunc("/network/interfaces/{name}", systemHandler.ServeInterface)
+	mux.HandleFunc("/network/wifi/connect", wifiHandler.ServeConnect)
+	mux.HandleFunc("/enrollment/{backend}", enrollmentHandler.ServeBackend)
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPut, "/system/hostname", `{"hostname":"edge-01"}`, http.StatusNoContent},
+		{http.MethodPut, "/network/interfaces/eth9", `{"ipv4":{"method":"auto"}}`, http.StatusNotFound},
+		{http.MethodPost, "/network/wifi/connect", `{"ssid":"office","psk":"secret123"}`, http.StatusOK},
+		{http.MethodPost, "/enrollment/awx", `{"token":"s3cr3t-token"}`, http.StatusAccepted},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		require.Equal(t, tt.want, w.Code, "%s %s: %s", tt.method, tt.path, w.Body.String())
+	}
+
+	records, err := auditLog.Records()
+	require.NoError(t, err)
+	require.NoError(t, audit.Verify(records))
+	type event struct {
+		Event, Target string
+		Success       bool
+	}
+	var events []event
+	for _, rec := range records {
+		events = append(events, event{rec.Event, rec.Target, rec.Success})
+	}
+	assert.Equal(t, []event{
+		{protocol.AuditEventSystem, "hostname", true},
+		{protocol.AuditEventSystem, "interface eth9", false},
+		{protocol.AuditEventWiFi, "office", true},
+		{protocol.AuditEventEnroll, "awx", true},
+	}, events)
+	assert.NotEmpty(t, records[1].Message)
+
+	// Values of the requests, like passwords and tokens, are not recorded
+	data, err := os.ReadFile(auditLog.Path())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret123")
+	assert.NotContains(t, string(data), "s3cr3t-token")
+}
+
+func TestAuditHandler_MethodNotAllowed(t *testing.T) {
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"), logger)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodDelete, "/audit", nil)
+	w := httptest.NewRecorder()
+	handlers.NewAuditHandler(auditLog, logger).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -2,10 +2,13 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/fzdarsky/boardingpass/internal/api/handlers"
 	"github.com/fzdarsky/boardingpass/internal/command"
@@ -194,6 +197,252 @@ func TestCommandHandler_POST_MethodNotAllowed(t *testing.T) {
 	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
 }
 
+func TestCommandHandler_POST_InvalidParams(t *testing.T) {
+	testConfig := &config.Config{
+		Commands: []config.CommandDefinition{
+			{
+				ID:   "set-ip",
+				Path: "/usr/lib/boardingpass/scripts/set-ip.sh",
+				Params: []config.CommandParam{
+					{Name: "interface", Pattern: "[a-zA-Z0-9._-]+"},
+					{Name: "address", Type: config.ParamTypeCIDR},
+					{Name: "dns", Type: config.ParamTypeIPv4, Optional: true},
+				},
+			},
+			{ID: "echo-test", Path: "/bin/echo", MaxParams: 1},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		req       protocol.CommandRequest
+		wantError string
+		wantMsg   string
+	}{
+		{
+			name:      "too many params without schemas",
+			req:       protocol.CommandRequest{ID: "echo-test", Params: []string{"a", "b"}},
+			wantError: "too_many_params",
+			wantMsg:   "at most 1 params",
+		},
+		{
+			name:      "too many params with schemas",
+			req:       protocol.CommandRequest{ID: "set-ip", Params: []string{"eth0", "192.0.2.10/24", "192.0.2.53", "x"}},
+			wantError: "too_many_params",
+			wantMsg:   "at most 3 params",
+		},
+		{
+			name:      "missing param",
+			req:       protocol.CommandRequest{ID: "set-ip", Params: []string{"eth0"}},
+			wantError: "invalid_params",
+			wantMsg:   "requires 2 params",
+		},
+		{
+			name:      "pattern mismatch",
+			req:       protocol.CommandRequest{ID: "set-ip", Params: []string{"eth0;reboot", "192.0.2.10/24"}},
+			wantError: "invalid_params",
+			wantMsg:   "param interface",
+		},
+		{
+			name:      "wrong type",
+			req:       protocol.CommandRequest{ID: "set-ip", Params: []string{"eth0", "192.0.2.10/24", "dns.example.com"}},
+			wantError: "invalid_params",
+			wantMsg:   "param dns",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// Invalid requests must never reach the executor
+			mockExecutor := command.NewMockCommandExecutor(ctrl)
+
+			logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+			handler, err := handlers.NewCommandHandlerWithExecutor(testConfig, mockExecutor, logger)
+			require.NoError(t, err)
+
+			body, err := json.Marshal(tt.req)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/command", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var response map[string]string
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, tt.wantError, response["error"])
+			assert.Contains(t, response["message"], tt.wantMsg)
+		})
+	}
+}
+
+func TestCommandHandler_GET_List(t *testing.T) {
+	noSudo := false
+	testConfig := &config.Config{
+		Commands: []config.CommandDefinition{
+			{
+				ID:          "set-hostname",
+				Description: "Set the static hostname",
+				Path:        "/usr/bin/hostnamectl",
+				Args:        []string{"set-hostname"},
+				Params: []config.CommandParam{
+					{Name: "hostname", Type: config.ParamTypeHostname},
+					{Name: "mode", Enum: []string{"static", "pretty"}, Optional: true},
+				},
+			},
+			{ID: "echo-test", Path: "/bin/echo", Args: []string{"hello"}, MaxParams: 1, Sudo: &noSudo, Timeout: "90s"},
+		},
+	}
+
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	handler, err := handlers.NewCommandHandler(testConfig, logger)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/commands", nil)
+	w := httptest.NewRecorder()
+	handler.ServeList(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list protocol.CommandList
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.Equal(t, []protocol.CommandInfo{
+		{
+			ID:          "set-hostname",
+			Description: "Set the static hostname",
+			MaxParams:   2,
+			Params: []protocol.CommandParam{
+				{Name: "hostname", Type: "hostname"},
+				{Name: "mode", Type: "string", Enum: []string{"static", "pretty"}, Optional: true},
+			},
+			Sudo:    true,
+			Timeout: "5m0s",
+		},
+		{ID: "echo-test", MaxParams: 1, Timeout: "1m30s"},
+	}, list.Commands)
+
+	req = httptest.NewRequest(http.MethodPost, "/commands", nil)
+	w = httptest.NewRecorder()
+	handler.ServeList(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestCommandHandler_POST_Timeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExecutor := command.NewMockCommandExecutor(ctrl)
+	mockExecutor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), true, gomock.Any()).
+		Return(nil, fmt.Errorf("executing: %w", protocol.NewCommandTimeoutError("sleep-test", 30*time.Second))).
+		Times(1)
+
+	testConfig := &config.Config{
+		Commands: []config.CommandDefinition{
+			{ID: "sleep-test", Path: "/bin/sleep", Args: []string{"60"}, Timeout: "30s"},
+		},
+	}
+
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	handler, err := handlers.NewCommandHandlerWithExecutor(testConfig, mockExecutor, logger)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(protocol.CommandRequest{ID: "sleep-test"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/command", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	var response protocol.ErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, protocol.ErrCodeCommandTimeout, response.Code)
+	assert.Contains(t, response.Details, "sleep-test")
+}
+
+func TestCommandHandler_POST_OutlastsWriteTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExecutor := command.NewMockCommandExecutor(ctrl)
+	mockExecutor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), true, gomock.Any()).
+		DoAndReturn(func(context.Context, *config.CommandDefinition, bool, []string) (*protocol.CommandResponse, error) {
+			time.Sleep(300 * time.Millisecond)
+			return &protocol.CommandResponse{ExitCode: 0, Stdout: "done\n"}, nil
+		}).
+		Times(1)
+
+	testConfig := &config.Config{
+		Commands: []config.CommandDefinition{
+			{ID: "slow-test", Path: "/bin/sleep", Args: []string{"1"}, Timeout: "10s"},
+		},
+	}
+
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	handler, err := handlers.NewCommandHandlerWithExecutor(testConfig, mockExecutor, logger)
+	require.NoError(t, err)
+
+	// The command runs longer than the server's write timeout
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	body, err := json.Marshal(protocol.CommandRequest{ID: "slow-test"})
+	require.NoError(t, err)
+	resp, err := server.Client().Post(server.URL+"/command", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var response protocol.CommandResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	assert.Equal(t, "done\n", response.Stdout)
+}
+
+func TestCommandHandler_POST_TruncatedOutput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockExecutor := command.NewMockCommandExecutor(ctrl)
+	mockExecutor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), true, gomock.Any()).
+		Return(&protocol.CommandResponse{Stdout: "0123", Truncated: true}, nil).
+		Times(1)
+
+	testConfig := &config.Config{
+		Commands: []config.CommandDefinition{
+			{ID: "show-status", Path: "/usr/lib/boardingpass/scripts/show-status.sh", MaxOutputBytes: 4},
+		},
+	}
+
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	handler, err := handlers.NewCommandHandlerWithExecutor(testConfig, mockExecutor, logger)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(protocol.CommandRequest{ID: "show-status"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/command", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"exit_code":0,"stdout":"0123","stderr":"","truncated":true}`, w.Body.String())
+}
+
 func TestCommandHandler_POST_NonZeroExitCode(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -71,6 +71,8 @@ func TestConfigureHandler_POST_Success(t *testing.T) {
 
 	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
 	handler := handlers.NewConfigureHandler(testConfig, logger)
+	applied := false
+	handler.SetAppliedCallback(func() { applied = true })
 
 	bundle := protocol.ConfigBundle{
 		Files: []protocol.ConfigFile{
@@ -102,6 +104,7 @@ func TestConfigureHandler_POST_Success(t *testing.T) {
 	err = json.NewDecoder(w.Body).Decode(&response)
 	require.NoError(t, err)
 	assert.Equal(t, "success", response["status"])
+	assert.True(t, applied, "applied callback must run on success")
 
 	// Verify files were written
 	expectedPath1 := filepath.Join(rootDir, "/etc/test/file1.conf")
@@ -124,6 +127,7 @@ func TestConfigureHandler_POST_InvalidJSON(t *testing.T) {
 
 	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
 	handler := handlers.NewConfigureHandler(testConfig, logger)
+	handler.SetAppliedCallback(func() { t.Error("applied callback must not run on failure") })
 
 	// Invalid JSON
 	req := httptest.NewRequest(http.MethodPost, "/configure", bytes.NewReader([]byte("invalid json")))
@@ -264,6 +268,49 @@ func TestConfigureHandler_POST_PathValidationFailure(t *testing.T) {
 	}
 }
 
+func TestConfigureHandler_POST_InvalidNMKeyfile(t *testing.T) {
+	rootDir := testRootDir(t)
+
+	testConfig := &config.Config{
+		Paths: config.PathSettings{
+			AllowList:     []string{"/etc/NetworkManager/system-connections/"},
+			RootDirectory: rootDir,
+		},
+	}
+
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	handler := handlers.NewConfigureHandler(testConfig, logger)
+	applied := false
+	handler.SetAppliedCallback(func() { applied = true })
+
+	bundle := protocol.ConfigBundle{
+		Files: []protocol.ConfigFile{
+			{
+				Path:    "NetworkManager/system-connections/eth0.nmconnection",
+				Content: base64.StdEncoding.EncodeToString([]byte("[connection]\nid=eth0\ntype=ethernet\n[ipv4]\nmethod=manual\n")),
+				Mode:    0o600,
+			},
+		},
+	}
+
+	body, err := json.Marshal(bundle)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/configure", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Keyfile validation failed")
+	assert.Contains(t, w.Body.String(), `ipv4.method: method "manual" requires at least one address`)
+	assert.False(t, applied)
+
+	_, err = os.Stat(filepath.Join(rootDir, "etc/NetworkManager/system-connections/eth0.nmconnection"))
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestConfigureHandler_MethodNotAllowed(t *testing.T) {
 	testConfig := &config.Config{
 		Paths: config.PathSettings{
@@ -0,0 +1,129 @@
+package integration
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/api/handlers"
+	"github.com/fzdarsky/boardingpass/internal/diagnostics"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDiagnosticsHandler returns a diagnostics handler whose runner reads a
+// root with a default route via eth0, and trusts the certificate of the
+// returned TLS server.
+func newDiagnosticsHandler(t *testing.T) (*handlers.DiagnosticsHandler, *httptest.Server) {
+	t.Helper()
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("proc/net/route", "Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n"+
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n")
+	write("sys/class/net/eth0/mtu", "1500\n")
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	runner := diagnostics.NewRunner(root)
+	runner.SetTimeout(time.Second)
+	runner.SetRootCAs(server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs)
+
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	return handlers.NewDiagnosticsHandler(runner, logger), server
+}
+
+func TestDiagnosticsHandler_POST_Connectivity(t *testing.T) {
+	handler, server := newDiagnosticsHandler(t)
+
+	// A port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	body := `{"endpoints":["` + server.URL + `","` + closed + `"],"ntp_servers":["127.0.0.1:1"]}`
+	req := httptest.NewRequest(http.MethodPost, "/diagnostics/connectivity", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeConnectivity(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp protocol.ConnectivityResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Passed)
+
+	statuses := map[string]string{}
+	for _, c := range resp.Checks {
+		statuses[c.Check+" "+c.Target] = c.Status
+	}
+	assert.Equal(t, map[string]string{
+		"default_route ":    protocol.CheckPass,
+		"mtu eth0":          protocol.CheckPass,
+		"tcp " + server.URL: protocol.CheckPass,
+		"tls " + server.URL: protocol.CheckPass,
+		"tcp " + closed:     protocol.CheckFail,
+		"ntp 127.0.0.1:1":   protocol.CheckFail,
+	}, statuses)
+}
+
+func TestDiagnosticsHandler_POST_Connectivity_EmptyBody(t *testing.T) {
+	handler, _ := newDiagnosticsHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/diagnostics/connectivity", nil)
+	w := httptest.NewRecorder()
+	handler.ServeConnectivity(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp protocol.ConnectivityResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Passed)
+	require.Len(t, resp.Checks, 3)
+	assert.Equal(t, protocol.CheckSkip, resp.Checks[2].Status)
+}
+
+func TestDiagnosticsHandler_POST_Connectivity_Invalid(t *testing.T) {
+	handler, _ := newDiagnosticsHandler(t)
+
+	tests := []struct {
+		name string
+		body string
+		code protocol.ErrorCode
+	}{
+		{"unknown field", `{"hosts":["example.com"]}`, protocol.ErrCodeInvalidRequest},
+		{"bad endpoint", `{"endpoints":["ftp://example.com"]}`, protocol.ErrCodeValidationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/diagnostics/connectivity", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ServeConnectivity(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var errResp protocol.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+			assert.Equal(t, tt.code, errResp.Code)
+		})
+	}
+}
+
+func TestDiagnosticsHandler_MethodNotAllowed(t *testing.T) {
+	handler, _ := newDiagnosticsHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/diagnostics/connectivity", nil)
+	w := httptest.NewRecorder()
+	handler.ServeConnectivity(w, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,216 @@
+package integration
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/api/handlers"
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// newEnrollmentMux serves the enrollment handler's routes, enrolling with a
+// stub Flight Control API that denies requests once deny is set. The stub
+// never issues certificates, so requests stay pending until then.
+func newEnrollmentMux(t *testing.T, deny *atomic.Bool) (*http.ServeMux, *httptest.Server) {
+	t.Helper()
+	var submitted atomic.Value
+	api := http.NewServeMux()
+	api.HandleFunc("POST /api/v1/enrollmentrequests", func(w http.ResponseWriter, r *http.Request) {
+		var er map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&er))
+		submitted.Store(er)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(er)
+	})
+	api.HandleFunc("GET /api/v1/enrollmentrequests/{name}", func(w http.ResponseWriter, r *http.Request) {
+		er := submitted.Load().(map[string]any)
+		if deny.Load() {
+			er["status"] = map[string]any{"conditions": []any{
+				map[string]any{"type": "Denied", "status": "True", "reason": "ManuallyDenied"},
+			}}
+		}
+		_ = json.NewEncoder(w).Encode(er)
+	})
+	server := httptest.NewTLSServer(api)
+	t.Cleanup(server.Close)
+
+	fc := enrollment.NewFlightControl(config.FlightControlSettings{}, config.PathSettings{
+		AllowList:     []string{"/etc/flightctl/"},
+		RootDirectory: t.TempDir(),
+	}, logging.New(logging.LevelError, logging.FormatJSON))
+	fc.SetPollInterval(10 * time.Millisecond)
+	backends := enrollment.NewRegistry()
+	require.NoError(t, backends.Register(fc))
+	return newEnrollmentHandlerMux(backends), server
+}
+
+func newEnrollmentHandlerMux(backends *enrollment.Registry) *http.ServeMux {
+	handler := handlers.NewEnrollmentHandler(backends, logging.New(logging.LevelInfo, logging.FormatJSON))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/enrollment", handler.ServeStatus)
+	mux.HandleFunc("/enrollment/backends", handler.ServeBackends)
+	mux.HandleFunc("/enrollment/{backend}", handler.ServeBackend)
+	mux.HandleFunc("/enrollment/{backend}/validate", handler.ServeValidate)
+	return mux
+}
+
+func getEnrollment(t *testing.T, mux *http.ServeMux) (int, *protocol.EnrollmentStatus) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/enrollment", nil))
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var status protocol.EnrollmentStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	return w.Code, &status
+}
+
+func TestEnrollmentHandler_FlightControl(t *testing.T) {
+	var deny atomic.Bool
+	mux, server := newEnrollmentMux(t, &deny)
+
+	code, _ := getEnrollment(t, mux)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	body, err := json.Marshal(&protocol.FlightControlEnrollRequest{
+		Server: server.URL,
+		Token:  "secret",
+		CACert: string(caPEM),
+	})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enrollment/flightctl", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	code, status := getEnrollment(t, mux)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, protocol.EnrollmentStatePending, status.State)
+
+	// A second enrollment conflicts with the pending one
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enrollment/flightctl", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	deny.Store(true)
+	require.Eventually(t, func() bool {
+		_, status = getEnrollment(t, mux)
+		return status.State == protocol.EnrollmentStateDenied
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, status.Message, "ManuallyDenied")
+}
+
+func TestEnrollmentHandler_FlightControl_Invalid(t *testing.T) {
+	var deny atomic.Bool
+	mux, _ := newEnrollmentMux(t, &deny)
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		code       protocol.ErrorCode
+	}{
+		{"unknown field", `{"token":"secret","password":"x"}`, http.StatusBadRequest, protocol.ErrCodeInvalidRequest},
+		{"no server", `{"token":"secret"}`, http.StatusBadRequest, protocol.ErrCodeValidationFailed},
+		{"unreachable server", `{"server":"https://127.0.0.1:1","token":"secret"}`, http.StatusBadGateway, protocol.ErrCodeEnrollmentFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enrollment/flightctl", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.statusCode, w.Code)
+			var errResp protocol.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+			assert.Equal(t, tt.code, errResp.Code)
+		})
+	}
+}
+
+func TestEnrollmentHandler_CommandBackend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	executor := command.NewMockCommandExecutor(ctrl)
+	executor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), false, []string{"https://awx.example.com", "secret"}).
+		Return(&protocol.CommandResponse{ExitCode: 0}, nil)
+
+	sudo := false
+	backends := enrollment.NewRegistry()
+	require.NoError(t, backends.Register(enrollment.NewCommandBackend(config.EnrollmentBackendSettings{
+		Name:         "awx",
+		DisplayName:  "AWX",
+		Command:      "enroll-awx",
+		SecretParams: []string{"token"},
+	}, &config.CommandDefinition{
+		ID:     "enroll-awx",
+		Path:   "/usr/lib/boardingpass/scripts/enroll-awx.sh",
+		Params: []config.CommandParam{{Name: "url"}, {Name: "token"}},
+		Sudo:   &sudo,
+	}, executor, logging.New(logging.LevelError, logging.FormatJSON))))
+	mux := newEnrollmentHandlerMux(backends)
+
+	// Clients discover the backend and its fields
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/enrollment/backends", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var list protocol.EnrollmentBackendList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Backends, 1)
+	assert.Equal(t, "AWX", list.Backends[0].DisplayName)
+	require.Len(t, list.Backends[0].Fields, 2)
+	assert.Equal(t, protocol.FieldTypeSecret, list.Backends[0].Fields[1].Type)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enrollment/awx/validate", strings.NewReader(`{"url":"https://awx.example.com"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errResp protocol.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, protocol.ErrCodeValidationFailed, errResp.Code)
+
+	body := `{"url":"https://awx.example.com","token":"secret"}`
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enrollment/awx/validate", strings.NewReader(body)))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enrollment/awx", strings.NewReader(body)))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/enrollment/awx", nil))
+		var status protocol.EnrollmentStatus
+		return w.Code == http.StatusOK && json.Unmarshal(w.Body.Bytes(), &status) == nil &&
+			status.State == protocol.EnrollmentStateEnrolled
+	}, 5*time.Second, 10*time.Millisecond)
+	_, status := getEnrollment(t, mux)
+	assert.Equal(t, "awx", status.Backend)
+}
+
+func TestEnrollmentHandler_UnknownBackend(t *testing.T) {
+	mux := newEnrollmentHandlerMux(enrollment.NewRegistry())
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/enrollment/acm", nil),
+		httptest.NewRequest(http.MethodPost, "/enrollment/acm", strings.NewReader(`{}`)),
+		httptest.NewRequest(http.MethodPost, "/enrollment/acm/validate", strings.NewReader(`{}`)),
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, req.URL.Path)
+	}
+}
@@ -12,11 +12,15 @@ import (
 	"time"
 
 	"github.com/fzdarsky/boardingpass/internal/api/handlers"
+	"github.com/fzdarsky/boardingpass/internal/command"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/enrollment"
 	"github.com/fzdarsky/boardingpass/internal/lifecycle"
 	"github.com/fzdarsky/boardingpass/internal/logging"
 	"github.com/fzdarsky/boardingpass/pkg/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
 )
 
 func TestCompleteHandler_POST_Success(t *testing.T) {
@@ -94,6 +98,63 @@ func TestCompleteHandler_POST_IdempotentSentinelCreation(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w2.Code)
 }
 
+func TestCompleteHandler_POST_EnrollmentInProgress(t *testing.T) {
+	tempDir := t.TempDir()
+	sentinelPath := filepath.Join(tempDir, "issued")
+
+	release := make(chan struct{})
+	ctrl := gomock.NewController(t)
+	executor := command.NewMockCommandExecutor(ctrl)
+	executor.EXPECT().
+		Execute(gomock.Any(), gomock.Any(), false, []string{"example-org"}).
+		DoAndReturn(func(context.Context, *config.CommandDefinition, bool, []string) (*protocol.CommandResponse, error) {
+			<-release
+			return &protocol.CommandResponse{ExitCode: 0}, nil
+		})
+
+	sudo := false
+	backends := enrollment.NewRegistry()
+	backend := enrollment.NewCommandBackend(config.EnrollmentBackendSettings{
+		Name:    "insights",
+		Command: "enroll-insights",
+	}, &config.CommandDefinition{
+		ID:     "enroll-insights",
+		Path:   "/usr/lib/boardingpass/scripts/enroll-insights.sh",
+		Params: []config.CommandParam{{Name: "org"}},
+		Sudo:   &sudo,
+	}, executor, logging.New(logging.LevelError, logging.FormatJSON))
+	require.NoError(t, backends.Register(backend))
+
+	shutdownCalled := false
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	handler := handlers.NewCompleteHandler(sentinelPath, func(string) {
+		shutdownCalled = true
+	}, nil, logger)
+	handler.SetEnrollments(backends)
+
+	_, err := backend.Enroll(context.Background(), json.RawMessage(`{"org":"example-org"}`))
+	require.NoError(t, err)
+
+	// The enrollment would be lost with the process
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/complete", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var errResp protocol.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, protocol.ErrCodeEnrollmentInProgress, errResp.Code)
+	assert.NoFileExists(t, sentinelPath)
+	assert.False(t, shutdownCalled)
+
+	close(release)
+	require.Eventually(t, func() bool { return !backends.InProgress() }, 5*time.Second, 10*time.Millisecond)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/complete", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.FileExists(t, sentinelPath)
+	assert.True(t, shutdownCalled)
+}
+
 func TestSentinelFileIntegration(t *testing.T) {
 	tempDir := t.TempDir()
 	sentinelPath := filepath.Join(tempDir, "issued")
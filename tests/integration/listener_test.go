@@ -0,0 +1,65 @@
+package integration_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/api"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_RefreshBindsPendingListeners(t *testing.T) {
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	dir := t.TempDir()
+
+	// Hold the Ethernet address so the server cannot bind it at start
+	blocker, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := blocker.Addr().(*net.TCPAddr).Port
+
+	cfg := &config.Config{}
+	cfg.Service.Port = port
+	cfg.Service.TLSCert = filepath.Join(dir, "server.crt")
+	cfg.Service.TLSKey = filepath.Join(dir, "server.key")
+	cfg.Transports.Ethernet = config.EthernetTransport{Enabled: true, Address: "127.0.0.1"}
+	cfg.Transports.WiFi = config.WiFiTransport{Enabled: true, Address: "127.0.0.2"}
+	require.NoError(t, tlspkg.GenerateSelfSignedCert(cfg.Service.TLSCert, cfg.Service.TLSKey, 1))
+
+	server, err := api.New(cfg, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	dial := func(host string) error {
+		dialer := &tls.Dialer{
+			NetDialer: &net.Dialer{Timeout: time.Second},
+			Config:    &tls.Config{InsecureSkipVerify: true}, // #nosec G402 - self-signed test certificate
+		}
+		conn, err := dialer.DialContext(t.Context(), "tcp", fmt.Sprintf("%s:%d", host, port))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	require.Eventually(t, func() bool { return dial("127.0.0.2") == nil }, 5*time.Second, 20*time.Millisecond)
+
+	// The address becomes available; the next refresh binds it
+	require.NoError(t, blocker.Close())
+	server.Refresh()
+	require.NoError(t, dial("127.0.0.1"))
+}
@@ -1,12 +1,14 @@
 package integration_test
 
 import (
+	"context"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/fzdarsky/boardingpass/internal/logging"
 	"github.com/fzdarsky/boardingpass/internal/mdns"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,3 +33,64 @@ func TestMDNSAnnouncer_StartStop(t *testing.T) {
 
 	announcer.Stop()
 }
+
+func TestMDNSBrowse_FindsAnnouncer(t *testing.T) {
+	if !hasMulticastIPv4() {
+		t.Skip("no multicast-capable IPv4 interface")
+	}
+
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	record := mdns.ServiceRecord{
+		Instance: "BoardingPass-browse-test",
+		Service:  "_boardingpass._tcp",
+		Domain:   "local",
+		Port:     9455,
+		TXT: map[string]string{
+			mdns.TXTSerial: "SN1234",
+			mdns.TXTState:  mdns.StateUnprovisioned,
+		},
+		Addrs: []net.IP{net.IPv4(192, 0, 2, 10)},
+	}
+
+	announcer := mdns.NewAnnouncer(record, logger)
+	require.NoError(t, announcer.Start(t.Context()))
+	defer announcer.Stop()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 3*time.Second)
+	defer cancel()
+	entries, err := mdns.Browse(ctx, "_boardingpass._tcp", "local")
+	require.NoError(t, err)
+
+	var found *mdns.ServiceEntry
+	for i := range entries {
+		if entries[i].Instance == record.Instance {
+			found = &entries[i]
+		}
+	}
+	require.NotNil(t, found, "announcer not discovered")
+	assert.Equal(t, 9455, found.Port)
+	assert.Equal(t, "SN1234", found.TXT[mdns.TXTSerial])
+	assert.Equal(t, mdns.StateUnprovisioned, found.TXT[mdns.TXTState])
+	require.Len(t, found.Addrs, 1)
+	assert.True(t, found.Addrs[0].Equal(net.IPv4(192, 0, 2, 10)))
+}
+
+// hasMulticastIPv4 reports whether an interface can carry IPv4 multicast.
+func hasMulticastIPv4() bool {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return false
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
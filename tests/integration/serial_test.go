@@ -0,0 +1,81 @@
+//go:build linux
+
+package integration_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/api"
+	"github.com/fzdarsky/boardingpass/internal/config"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/mux"
+	"github.com/fzdarsky/boardingpass/internal/serial/serialtest"
+	tlspkg "github.com/fzdarsky/boardingpass/internal/tls"
+	"github.com/fzdarsky/boardingpass/internal/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerialTransport_HTTPSOverPTY(t *testing.T) {
+	logger := logging.New(logging.LevelError, logging.FormatJSON)
+	dir := t.TempDir()
+
+	cfg := &config.Config{}
+	cfg.Service.TLSCert = filepath.Join(dir, "server.crt")
+	cfg.Service.TLSKey = filepath.Join(dir, "server.key")
+	require.NoError(t, tlspkg.GenerateSelfSignedCert(cfg.Service.TLSCert, cfg.Service.TLSKey, 1))
+
+	server, err := api.New(cfg, logger)
+	require.NoError(t, err)
+	server.RegisterRouteFunc("/ping", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	})
+	t.Cleanup(func() { _ = server.Shutdown(t.Context()) })
+
+	master, slavePath := serialtest.OpenPTY(t)
+
+	handler := transport.NewSerialHandler(config.SerialTransport{Enabled: true, Device: slavePath}, logger)
+	handler.SetListenerCallbacks(server.ServeListener, server.RemoveListener)
+	require.NoError(t, handler.Start(t.Context()))
+	t.Cleanup(func() { _ = handler.Stop(t.Context()) })
+
+	session := mux.Client(master, mux.Addr{Net: "serial", Name: "pty"})
+	t.Cleanup(func() { _ = session.Close() })
+
+	// Frames written before the service opens the line are flushed, so
+	// wait until it answers pings
+	require.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+		defer cancel()
+		_, err := session.Ping(ctx)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	httpClient := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return session.Open(ctx)
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402 - self-signed test certificate
+		},
+	}
+
+	// Issue several requests to exercise multiple streams over the line
+	for range 3 {
+		resp, err := httpClient.Get("https://boardingpass/ping")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "pong", string(body))
+	}
+}
@@ -0,0 +1,152 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fzdarsky/boardingpass/internal/api/handlers"
+	"github.com/fzdarsky/boardingpass/internal/dbus"
+	"github.com/fzdarsky/boardingpass/internal/dbus/dbustest"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/system"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSystemMux serves the system handler's routes, backed by fake hostnamed
+// and NetworkManager services that know no devices. It returns the mux and
+// a function returning the hostnames set.
+func newSystemMux(t *testing.T) (*http.ServeMux, func() []string) {
+	t.Helper()
+	handler, hostnames := newSystemHandler(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/system/hostname", handler.ServeHostname)
+	mux.HandleFunc("/network/interfaces/{name}", handler.ServeInterface)
+	return mux, hostnames
+}
+
+// newSystemHandler returns a system handler backed by the fake services of
+// newSystemMux, and a function returning the hostnames set.
+func newSystemHandler(t *testing.T) (*handlers.SystemHandler, func() []string) {
+	t.Helper()
+	bus := dbustest.NewBus(t)
+	services := bus.Dial(t)
+	ctx := context.Background()
+	require.NoError(t, services.RequestName(ctx, "org.freedesktop.hostname1"))
+	require.NoError(t, services.RequestName(ctx, "org.freedesktop.NetworkManager"))
+
+	var mu sync.Mutex
+	var hostnames []string
+	setHostname := func(call *dbus.Message) ([]any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		hostnames = append(hostnames, call.Member+" "+call.Body[0].(string))
+		return nil, nil
+	}
+	services.Export("/org/freedesktop/hostname1", "org.freedesktop.hostname1", map[string]dbus.Method{
+		"SetStaticHostname": setHostname,
+		"SetHostname":       setHostname,
+	})
+	services.Export("/org/freedesktop/NetworkManager", "org.freedesktop.NetworkManager", map[string]dbus.Method{
+		"GetDeviceByIpIface": func(*dbus.Message) ([]any, error) {
+			return nil, &dbus.Error{Name: "org.freedesktop.NetworkManager.UnknownDevice", Message: "No device found"}
+		},
+	})
+
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	handler := handlers.NewSystemHandler(system.NewManager(bus.Dial(t), t.TempDir()), logger)
+	return handler, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), hostnames...)
+	}
+}
+
+func TestSystemHandler_PUT_Hostname(t *testing.T) {
+	mux, hostnames := newSystemMux(t)
+
+	req := httptest.NewRequest(http.MethodPut, "/system/hostname", strings.NewReader(`{"hostname":"edge-01"}`))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"SetStaticHostname edge-01", "SetHostname edge-01"}, hostnames())
+}
+
+func TestSystemHandler_PUT_Hostname_ValidationFailed(t *testing.T) {
+	mux, hostnames := newSystemMux(t)
+
+	req := httptest.NewRequest(http.MethodPut, "/system/hostname", strings.NewReader(`{"hostname":"edge_01"}`))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var errResp protocol.ErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+	assert.Equal(t, protocol.ErrCodeValidationFailed, errResp.Code)
+	require.Len(t, errResp.Fields, 1)
+	assert.Equal(t, "hostname", errResp.Fields[0].Field)
+	assert.Empty(t, hostnames())
+}
+
+func TestSystemHandler_PUT_Hostname_InvalidBody(t *testing.T) {
+	mux, _ := newSystemMux(t)
+
+	for _, body := range []string{`{"hostname":`, `{"hostname":"edge-01","domain":"example.com"}`} {
+		req := httptest.NewRequest(http.MethodPut, "/system/hostname", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var errResp protocol.ErrorResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+		assert.Equal(t, protocol.ErrCodeInvalidRequest, errResp.Code)
+	}
+}
+
+func TestSystemHandler_PUT_Interface_NotFound(t *testing.T) {
+	mux, _ := newSystemMux(t)
+
+	req := httptest.NewRequest(http.MethodPut, "/network/interfaces/eth7",
+		strings.NewReader(`{"ipv4":{"method":"auto"}}`))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var errResp protocol.ErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+	assert.Equal(t, protocol.ErrCodeInterfaceNotFound, errResp.Code)
+	assert.Equal(t, "eth7", errResp.Details)
+}
+
+func TestSystemHandler_MethodNotAllowed(t *testing.T) {
+	mux, _ := newSystemMux(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/system/hostname", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestSystemHandler_NoSystemBus(t *testing.T) {
+	logger := logging.New(logging.LevelInfo, logging.FormatJSON)
+	handler := handlers.NewSystemHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodPut, "/system/proxy", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	handler.ServeProxy(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var errResp protocol.ErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+	assert.Equal(t, protocol.ErrCodeSystemError, errResp.Code)
+}
@@ -0,0 +1,277 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fzdarsky/boardingpass/internal/api/handlers"
+	"github.com/fzdarsky/boardingpass/internal/logging"
+	"github.com/fzdarsky/boardingpass/internal/transport"
+	"github.com/fzdarsky/boardingpass/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNetworks = []protocol.WiFiNetwork{
+	{SSID: "office", BSSID: "02:00:00:00:00:01", Signal: 82, Security: "wpa-psk", Frequency: 5180, Channel: 36},
+}
+
+// fakeWiFiClient records the WiFi operations made, connecting successfully
+// unless connectErr is set.
+type fakeWiFiClient struct {
+	mu         sync.Mutex
+	calls      []string
+	connectErr error
+}
+
+func (f *fakeWiFiClient) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeWiFiClient) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *fakeWiFiClient) WiFiDevices(context.Context) ([]string, error) {
+	return []string{"wlan0"}, nil
+}
+
+func (f *fakeWiFiClient) ScanWiFi(_ context.Context, iface string) ([]protocol.WiFiNetwork, error) {
+	f.record("scan " + iface)
+	return testNetworks, nil
+}
+
+func (f *fakeWiFiClient) ConnectWiFi(_ context.Context, iface string, req *protocol.WiFiConnectRequest) ([]string, error) {
+	f.record("connect " + iface + " " + req.SSID)
+	if f.connectErr != nil {
+		return nil, f.connectErr
+	}
+	return []string{"192.168.1.50/24"}, nil
+}
+
+// fakeAccessPoint is a WiFi AP on wlan0 that runs in the given client mode.
+type fakeAccessPoint struct {
+	client *fakeWiFiClient // records Start and Stop
+	mode   string
+	state  transport.State
+}
+
+func (f *fakeAccessPoint) Start(context.Context) error {
+	f.client.record("ap start")
+	return nil
+}
+
+func (f *fakeAccessPoint) Stop(context.Context) error {
+	f.client.record("ap stop")
+	return nil
+}
+
+func (f *fakeAccessPoint) TransportState() transport.State { return f.state }
+
+func (f *fakeAccessPoint) Interface() string { return "wlan0" }
+
+func (f *fakeAccessPoint) ClientInterface(context.Context, string) (string, string, error) {
+	if f.mode == protocol.WiFiModeConcurrent {
+		return "bpsta0", f.mode, nil
+	}
+	return "wlan0", f.mode, nil
+}
+
+func (f *fakeAccessPoint) CachedScan() ([]protocol.WiFiNetwork, time.Time) {
+	return testNetworks, time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+}
+
+// newWiFiHandler returns a WiFi handler with an AP in the given mode, or
+// without an AP if mode is "".
+func newWiFiHandler(mode string) (*handlers.WiFiHandler, *fakeWiFiClient) {
+	client := &fakeWiFiClient{}
+	var ap handlers.AccessPoint
+	if mode != "" {
+		ap = &fakeAccessPoint{client: client, mode: mode, state: transport.StateActive}
+	}
+	handler := handlers.NewWiFiHandler(client, ap, logging.New(logging.LevelInfo, logging.FormatJSON))
+	handler.SetSwitchOverDelay(10 * time.Millisecond)
+	return handler, client
+}
+
+func TestWiFiHandler_GET_Scan(t *testing.T) {
+	handler, client := newWiFiHandler("")
+
+	w := httptest.NewRecorder()
+	handler.ServeScan(w, httptest.NewRequest(http.MethodGet, "/network/wifi/scan", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp protocol.WiFiScanResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "wlan0", resp.Interface)
+	assert.Equal(t, testNetworks, resp.Networks)
+	assert.False(t, resp.Cached)
+	assert.Equal(t, []string{"scan wlan0"}, client.called())
+}
+
+func TestWiFiHandler_GET_Scan_Concurrent(t *testing.T) {
+	handler, client := newWiFiHandler(protocol.WiFiModeConcurrent)
+
+	w := httptest.NewRecorder()
+	handler.ServeScan(w, httptest.NewRequest(http.MethodGet, "/network/wifi/scan", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"scan bpsta0"}, client.called())
+}
+
+func TestWiFiHandler_GET_Scan_Cached(t *testing.T) {
+	handler, client := newWiFiHandler(protocol.WiFiModeSwitchOver)
+
+	w := httptest.NewRecorder()
+	handler.ServeScan(w, httptest.NewRequest(http.MethodGet, "/network/wifi/scan?interface=wlan0", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp protocol.WiFiScanResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.True(t, resp.Cached)
+	assert.Equal(t, testNetworks, resp.Networks)
+	assert.Equal(t, time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), resp.ScannedAt)
+	assert.Empty(t, client.called(), "the radio serving the AP must not scan")
+}
+
+func TestWiFiHandler_POST_Connect(t *testing.T) {
+	handler, client := newWiFiHandler(protocol.WiFiModeConcurrent)
+
+	w := httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodPost, "/network/wifi/connect",
+		strings.NewReader(`{"ssid":"office","psk":"secret123"}`)))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var status protocol.WiFiConnectStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(t, protocol.WiFiConnectStatus{
+		State:     protocol.WiFiStateConnected,
+		SSID:      "office",
+		Interface: "bpsta0",
+		Mode:      protocol.WiFiModeConcurrent,
+		Addresses: []string{"192.168.1.50/24"},
+	}, status)
+	assert.Equal(t, []string{"connect bpsta0 office"}, client.called(), "the AP must keep running")
+}
+
+func TestWiFiHandler_POST_Connect_Failed(t *testing.T) {
+	handler, client := newWiFiHandler("")
+	client.connectErr = protocol.NewWiFiConnectFailedError("office", "wrong or missing password")
+
+	w := httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodPost, "/network/wifi/connect",
+		strings.NewReader(`{"ssid":"office","psk":"secret123"}`)))
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	var errResp protocol.ErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+	assert.Equal(t, protocol.ErrCodeWiFiConnectFailed, errResp.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodGet, "/network/wifi/connect", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var status protocol.WiFiConnectStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(t, protocol.WiFiStateFailed, status.State)
+	assert.Equal(t, "office: wrong or missing password", status.Error)
+}
+
+func TestWiFiHandler_POST_Connect_Invalid(t *testing.T) {
+	handler, client := newWiFiHandler("")
+
+	for _, body := range []string{`{"ssid":""}`, `{"ssid":"office","psk":"short"}`} {
+		w := httptest.NewRecorder()
+		handler.ServeConnect(w, httptest.NewRequest(http.MethodPost, "/network/wifi/connect", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var errResp protocol.ErrorResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+		assert.Equal(t, protocol.ErrCodeValidationFailed, errResp.Code)
+	}
+	assert.Empty(t, client.called())
+}
+
+func TestWiFiHandler_POST_Connect_SwitchOver(t *testing.T) {
+	handler, client := newWiFiHandler(protocol.WiFiModeSwitchOver)
+
+	w := httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodPost, "/network/wifi/connect",
+		strings.NewReader(`{"ssid":"office","psk":"secret123"}`)))
+
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var status protocol.WiFiConnectStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(t, protocol.WiFiStateScheduled, status.State)
+	assert.Equal(t, protocol.WiFiModeSwitchOver, status.Mode)
+	require.NotNil(t, status.SwitchAt)
+
+	// A second attempt and scans are refused until the switch-over is done
+	w = httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodPost, "/network/wifi/connect",
+		strings.NewReader(`{"ssid":"guest"}`)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = httptest.NewRecorder()
+	handler.ServeScan(w, httptest.NewRequest(http.MethodGet, "/network/wifi/scan", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	require.Eventually(t, func() bool {
+		return connectState(t, handler) == protocol.WiFiStateConnected
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"ap stop", "connect wlan0 office"}, client.called())
+}
+
+func TestWiFiHandler_POST_Connect_SwitchOverFailed(t *testing.T) {
+	handler, client := newWiFiHandler(protocol.WiFiModeSwitchOver)
+	client.connectErr = protocol.NewWiFiConnectFailedError("office", "network not found")
+
+	w := httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodPost, "/network/wifi/connect",
+		strings.NewReader(`{"ssid":"office","psk":"secret123"}`)))
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	require.Eventually(t, func() bool {
+		return len(client.called()) == 3
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"ap stop", "connect wlan0 office", "ap start"}, client.called(),
+		"the AP must be restarted")
+	assert.Equal(t, protocol.WiFiStateFailed, connectState(t, handler))
+}
+
+func TestWiFiHandler_GET_Connect_NoAttempt(t *testing.T) {
+	handler, _ := newWiFiHandler("")
+
+	w := httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodGet, "/network/wifi/connect", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWiFiHandler_NoSystemBus(t *testing.T) {
+	handler := handlers.NewWiFiHandler(nil, nil, logging.New(logging.LevelInfo, logging.FormatJSON))
+
+	w := httptest.NewRecorder()
+	handler.ServeScan(w, httptest.NewRequest(http.MethodGet, "/network/wifi/scan", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// connectState returns the state of the last connection attempt.
+func connectState(t *testing.T, handler *handlers.WiFiHandler) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeConnect(w, httptest.NewRequest(http.MethodGet, "/network/wifi/connect", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var status protocol.WiFiConnectStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	return status.State
+}